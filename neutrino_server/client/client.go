@@ -0,0 +1,272 @@
+// Package client is a Go client of the neutrinod REST API, with typed
+// methods for its endpoints that retry requests the node turned away or
+// could not answer.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults of the retry options.
+const (
+	DefaultRetries = 3
+	DefaultBackoff = 500 * time.Millisecond
+)
+
+// maxBackoff bounds the wait between two attempts, including the wait a
+// Retry-After header asks for.
+const maxBackoff = 30 * time.Second
+
+// Client calls the REST API of a neutrinod node. It is safe for concurrent
+// use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	apiKey     string
+	retries    int
+	backoff    time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client requests are made with, such as one
+// with TLS client certificates or a Unix socket transport.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithAPIKey sets the API key requests are authenticated with, for nodes
+// started with --api-keys-file.
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithRetries sets how many times a failed request is retried and the wait
+// before the first retry, which doubles on each retry after it. Zero retries
+// disables retrying.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// New returns a client of the node at baseURL, such as
+// http://localhost:8334 or, behind --base-path, https://example.com/neutrino.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	parsed, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: use an http:// or https:// URL", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    parsed,
+		httpClient: http.DefaultClient,
+		retries:    DefaultRetries,
+		backoff:    DefaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Error is an error response of the API.
+type Error struct {
+	// StatusCode is the HTTP status of the response.
+	StatusCode int
+
+	// Message is the error the node gave, and RequestID the ID it logged
+	// the request under.
+	Message   string
+	RequestID string
+
+	// Reason and Field explain rejected request bodies.
+	Reason string
+	Field  string
+
+	// ResumeHeight is set for scans stopped at their deadline, which can be
+	// resumed from it.
+	ResumeHeight int32
+}
+
+func (e *Error) Error() string {
+	message := e.Message
+	if message == "" {
+		message = http.StatusText(e.StatusCode)
+	}
+	if e.Reason != "" {
+		message += ": " + e.Reason
+	}
+	if e.RequestID != "" {
+		return fmt.Sprintf("neutrinod: %d %s (request %s)", e.StatusCode, message, e.RequestID)
+	}
+	return fmt.Sprintf("neutrinod: %d %s", e.StatusCode, message)
+}
+
+// IsNotFound reports whether err is a 404 response, such as for a height
+// above the tip or a transaction the node does not know.
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// request is a call to the API.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   any
+	header http.Header
+
+	// idempotent marks requests that can be repeated without effect, which
+	// are retried after connection errors and 502 and 503 responses as well
+	// as after 429s
+	idempotent bool
+}
+
+// do makes req, retrying it as the client's options allow, and decodes the
+// response into result unless result is nil.
+func (c *Client) do(ctx context.Context, req request, result any) error {
+	var payload []byte
+	if req.body != nil {
+		var err error
+		if payload, err = json.Marshal(req.body); err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	endpoint := c.baseURL.JoinPath(req.path)
+	endpoint.RawQuery = req.query.Encode()
+
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		wait, err := c.attempt(ctx, req, endpoint.String(), payload, result)
+		if err == nil || attempt >= c.retries || wait < 0 {
+			return err
+		}
+		if wait < backoff {
+			wait = backoff
+		}
+		select {
+		case <-time.After(min(wait, maxBackoff)):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// attempt makes req once. It returns how long to wait before retrying a
+// failed attempt, or -1 if the request must not be retried.
+func (c *Client) attempt(ctx context.Context, req request, endpoint string, payload []byte, result any) (time.Duration, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, endpoint, body)
+	if err != nil {
+		return -1, err
+	}
+	for name, values := range req.header {
+		httpReq.Header[name] = values
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil || !req.idempotent {
+			return -1, err
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		apiErr := decodeError(resp)
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			// The node turned the request away before handling it
+			return retryAfter(resp), apiErr
+		case req.idempotent && (resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable):
+			return retryAfter(resp), apiErr
+		}
+		return -1, apiErr
+	}
+
+	if result == nil {
+		return 0, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return -1, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return 0, nil
+}
+
+// decodeError returns the Error of an error response.
+func decodeError(resp *http.Response) *Error {
+	var body struct {
+		Error        string `json:"error"`
+		RequestID    string `json:"request_id"`
+		Reason       string `json:"reason"`
+		Field        string `json:"field"`
+		ResumeHeight int32  `json:"resume_height"`
+	}
+	// Proxies in front of the node may answer with something else than JSON
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if json.Unmarshal(data, &body) != nil {
+		body.Error = strings.TrimSpace(string(data))
+	}
+	return &Error{
+		StatusCode:   resp.StatusCode,
+		Message:      body.Error,
+		RequestID:    body.RequestID,
+		Reason:       body.Reason,
+		Field:        body.Field,
+		ResumeHeight: body.ResumeHeight,
+	}
+}
+
+// retryAfter returns the wait the Retry-After header of resp asks for, zero
+// if it has none.
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// newIdempotencyKey returns a random key broadcasts are sent with, so the
+// node answers a retried broadcast as a duplicate of the first.
+func newIdempotencyKey() string {
+	key := make([]byte, 16)
+	rand.Read(key)
+	return hex.EncodeToString(key)
+}
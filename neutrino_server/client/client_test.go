@@ -0,0 +1,323 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/neutrino"
+)
+
+func TestClient(t *testing.T) {
+	var gotKeys []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /neutrino/v1/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error":"API key required","request_id":"r1"}`)
+			return
+		}
+		io.WriteString(w, `{"synced":true,"block_height":120,"filter_height":119,"peers":3}`)
+	})
+	mux.HandleFunc("GET /neutrino/v1/block/{height}/header", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("height") != "100" {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error":"block not found"}`)
+			return
+		}
+		io.WriteString(w, `{"hash":"00ab","height":100,"timestamp":1231006505}`)
+	})
+	mux.HandleFunc("POST /neutrino/v1/utxos", func(w http.ResponseWriter, r *http.Request) {
+		var req UTXORequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Addresses) != 1 || req.Addresses[0] != "bcrt1qwatched" || r.URL.RawQuery != "limit=1&min_conf=6&min_value=546&offset=2&order=desc&sort=value" {
+			t.Errorf("GetUTXOs sent %+v with query %q", req, r.URL.RawQuery)
+		}
+		io.WriteString(w, `{"utxos":[{"txid":"aa","vout":1,"value":5000}],"total":3,"limit":1,"offset":2,"confidence":{"level":"complete"}}`)
+	})
+	mux.HandleFunc("POST /neutrino/v1/tx/broadcast", func(w http.ResponseWriter, r *http.Request) {
+		gotKeys = append(gotKeys, r.Header.Get("Idempotency-Key"))
+		io.WriteString(w, `{"txid":"bb","status":"broadcast","peers_announced":2,"duplicate":false}`)
+	})
+	mux.HandleFunc("POST /neutrino/v1/watch/address", func(w http.ResponseWriter, r *http.Request) {
+		var req WatchRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Descriptors) > 0 {
+			io.WriteString(w, `{"status":"ok","addresses":["bcrt1qa","bcrt1qb"]}`)
+			return
+		}
+		io.WriteString(w, `{"status":"ok"}`)
+	})
+	mux.HandleFunc("POST /neutrino/v1/wallets", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		io.WriteString(w, `{"name":"`+req["name"]+`","addresses":0,"archived":false,"created_at":1700000000}`)
+	})
+	mux.HandleFunc("GET /neutrino/v1/wallets/shop/utxos", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "order=desc&sort=value" {
+			t.Errorf("WalletUTXOs sent query %q", r.URL.RawQuery)
+		}
+		io.WriteString(w, `{"utxos":[{"txid":"cc","vout":0,"value":9000}],"total":1,"limit":1000,"offset":0,"confidence":{"level":"cached"}}`)
+	})
+	mux.HandleFunc("POST /neutrino/v1/rescan", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":"invalid request body","reason":"unknown field startheight","field":"startheight"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx := context.Background()
+	c, err := New(server.URL+"/neutrino/", WithAPIKey("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := c.Status(ctx)
+	if err != nil || !status.Synced || status.BlockHeight != 120 || status.Peers != 3 {
+		t.Errorf("Status() = %+v, %v", status, err)
+	}
+
+	header, err := c.GetBlockHeader(ctx, 100)
+	if err != nil || header.Hash != "00ab" || header.Timestamp != 1231006505 {
+		t.Errorf("GetBlockHeader(100) = %+v, %v", header, err)
+	}
+	if _, err := c.GetBlockHeader(ctx, 101); !IsNotFound(err) {
+		t.Errorf("GetBlockHeader(101) error = %v, want a 404", err)
+	}
+
+	utxos, err := c.GetUTXOs(ctx, UTXORequest{Addresses: []string{"bcrt1qwatched"}, Limit: 1, Offset: 2, MinConf: 6, MinValue: 546, Sort: "value", Order: "desc"})
+	if err != nil || len(utxos.UTXOs) != 1 || utxos.UTXOs[0].Value != 5000 || utxos.Total != 3 || utxos.Confidence.Level != "complete" {
+		t.Errorf("GetUTXOs() = %+v, %v", utxos, err)
+	}
+
+	// Broadcasts get a key unless the caller gives one
+	for _, key := range []string{"", "mine"} {
+		result, err := c.Broadcast(ctx, "0100", key)
+		if err != nil || result.TxID != "bb" || result.PeersAnnounced != 2 {
+			t.Errorf("Broadcast() = %+v, %v", result, err)
+		}
+	}
+	if len(gotKeys) != 2 || len(gotKeys[0]) != 32 || gotKeys[1] != "mine" {
+		t.Errorf("broadcasts were sent with idempotency keys %q", gotKeys)
+	}
+
+	if watched, err := c.Watch(ctx, WatchRequest{Address: "bcrt1qone"}); err != nil || !reflect.DeepEqual(watched, []string{"bcrt1qone"}) {
+		t.Errorf("Watch(address) = %v, %v", watched, err)
+	}
+	watched, err := c.Watch(ctx, WatchRequest{Descriptors: []DescriptorRange{{Descriptor: "wpkh(xpub/0/*)", Range: []uint32{0, 1}}}})
+	if err != nil || !reflect.DeepEqual(watched, []string{"bcrt1qa", "bcrt1qb"}) {
+		t.Errorf("Watch(descriptors) = %v, %v", watched, err)
+	}
+
+	wallet, err := c.CreateWallet(ctx, "shop")
+	if err != nil || wallet.Name != "shop" || wallet.CreatedAt != 1700000000 {
+		t.Errorf("CreateWallet() = %+v, %v", wallet, err)
+	}
+	walletUTXOs, err := c.WalletUTXOs(ctx, "shop", UTXORequest{Sort: "value", Order: "desc"})
+	if err != nil || walletUTXOs.Total != 1 || walletUTXOs.UTXOs[0].TxID != "cc" {
+		t.Errorf("WalletUTXOs() = %+v, %v", walletUTXOs, err)
+	}
+
+	var apiErr *Error
+	if err := c.Rescan(ctx, RescanRequest{}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Field != "startheight" {
+		t.Errorf("Rescan() error = %#v, want the body error", err)
+	}
+
+	unauthenticated, _ := New(server.URL + "/neutrino")
+	_, err = unauthenticated.Status(ctx)
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.RequestID != "r1" {
+		t.Errorf("Status() without a key error = %v, want a 401", err)
+	}
+	if want := "neutrinod: 401 API key required (request r1)"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+
+	if _, err := New("localhost:8334"); err == nil {
+		t.Error("New() accepted a URL without a scheme")
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []int
+		call      func(c *Client) error
+		wantCalls int32
+		wantErr   int
+	}{
+		{
+			name:      "429 then success",
+			responses: []int{http.StatusTooManyRequests, http.StatusOK},
+			call:      func(c *Client) error { _, err := c.Status(context.Background()); return err },
+			wantCalls: 2,
+		},
+		{
+			name:      "503 retried until out of retries",
+			responses: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			call:      func(c *Client) error { _, err := c.Status(context.Background()); return err },
+			wantCalls: 3,
+			wantErr:   http.StatusServiceUnavailable,
+		},
+		{
+			name:      "client errors are not retried",
+			responses: []int{http.StatusBadRequest},
+			call:      func(c *Client) error { _, err := c.GetBlockHeader(context.Background(), 1); return err },
+			wantCalls: 1,
+			wantErr:   http.StatusBadRequest,
+		},
+		{
+			name:      "scan deadlines are not retried",
+			responses: []int{http.StatusGatewayTimeout},
+			call: func(c *Client) error {
+				_, err := c.GetUTXOs(context.Background(), UTXORequest{Addresses: []string{"bcrt1q"}})
+				return err
+			},
+			wantCalls: 1,
+			wantErr:   http.StatusGatewayTimeout,
+		},
+		{
+			name:      "rescans are retried after 429",
+			responses: []int{http.StatusTooManyRequests, http.StatusOK},
+			call:      func(c *Client) error { return c.Rescan(context.Background(), RescanRequest{}) },
+			wantCalls: 2,
+		},
+		{
+			name:      "rescans are not retried after 503",
+			responses: []int{http.StatusServiceUnavailable, http.StatusOK},
+			call:      func(c *Client) error { return c.Rescan(context.Background(), RescanRequest{}) },
+			wantCalls: 1,
+			wantErr:   http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			var bodies []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				bodies = append(bodies, string(body))
+				code := tt.responses[min(int(calls.Add(1)), len(tt.responses))-1]
+				w.WriteHeader(code)
+				if code == http.StatusOK {
+					io.WriteString(w, `{}`)
+				} else {
+					io.WriteString(w, `{"error":"try again"}`)
+				}
+			}))
+			defer server.Close()
+
+			c, _ := New(server.URL, WithRetries(2, time.Millisecond))
+			err := tt.call(c)
+
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("made %d requests, want %d", got, tt.wantCalls)
+			}
+			for _, body := range bodies[1:] {
+				if body != bodies[0] {
+					t.Errorf("retried with body %q, want %q", body, bodies[0])
+				}
+			}
+			var apiErr *Error
+			switch {
+			case tt.wantErr == 0 && err != nil:
+				t.Errorf("error = %v", err)
+			case tt.wantErr != 0 && (!errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantErr):
+				t.Errorf("error = %v, want a %d", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Waiting to retry ends with the context
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	c, _ := New(server.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.Status(ctx); err == nil || time.Since(start) > 5*time.Second {
+		t.Errorf("Status() = %v after %s, want a 429 once the context ends", err, time.Since(start))
+	}
+}
+
+// TestTypesMatchServer checks that the client's types decode every field
+// the server's types encode, and no other.
+func TestTypesMatchServer(t *testing.T) {
+	tests := []struct {
+		server any
+		client any
+	}{
+		{&neutrino.Status{}, &Status{}},
+		{&neutrino.UTXO{}, &UTXO{}},
+		{&neutrino.Confidence{}, &Confidence{}},
+		{&neutrino.BroadcastResult{}, &BroadcastResult{}},
+		{&neutrino.RescanStatus{}, &RescanStatus{}},
+		{&neutrino.DescriptorRange{}, &DescriptorRange{}},
+		{&neutrino.WalletInfo{}, &Wallet{}},
+		{&neutrino.WalletBalance{}, &WalletBalance{}},
+	}
+	for _, tt := range tests {
+		name := reflect.TypeOf(tt.client).Elem().Name()
+		t.Run(name, func(t *testing.T) {
+			for _, pair := range [][2]any{{tt.server, tt.client}, {tt.client, tt.server}} {
+				from, to := pair[0], pair[1]
+				populate(reflect.ValueOf(from).Elem())
+				encoded, err := json.Marshal(from)
+				if err != nil {
+					t.Fatal(err)
+				}
+				decoder := json.NewDecoder(bytes.NewReader(encoded))
+				decoder.DisallowUnknownFields()
+				if err := decoder.Decode(reflect.New(reflect.TypeOf(to).Elem()).Interface()); err != nil {
+					t.Errorf("decoding %T into %T: %v", from, to, err)
+				}
+			}
+		})
+	}
+}
+
+// populate sets every field of v to a non-zero value, so that no field is
+// left out of its encoding by omitempty.
+func populate(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+		populate(v.Elem())
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				populate(v.Field(i))
+			}
+		}
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		populate(v.Index(0))
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		key := reflect.New(v.Type().Key()).Elem()
+		populate(key)
+		elem := reflect.New(v.Type().Elem()).Elem()
+		populate(elem)
+		v.SetMapIndex(key, elem)
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1)
+	}
+}
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Status returns the sync status of the node.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var status Status
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/v1/status", idempotent: true}, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// GetBlockHeader returns the header of the block at height.
+func (c *Client) GetBlockHeader(ctx context.Context, height int32) (*BlockHeader, error) {
+	var header BlockHeader
+	path := "/v1/block/" + strconv.FormatInt(int64(height), 10) + "/header"
+	if err := c.do(ctx, request{method: http.MethodGet, path: path, idempotent: true}, &header); err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+// GetUTXOs returns a page of the UTXOs of watched addresses, in the order
+// req selects, and whether the scans finding them checked every block.
+func (c *Client) GetUTXOs(ctx context.Context, req UTXORequest) (*UTXOs, error) {
+	var utxos UTXOs
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/v1/utxos", query: utxoQuery(req), body: req, idempotent: true}, &utxos); err != nil {
+		return nil, err
+	}
+	return &utxos, nil
+}
+
+// utxoQuery returns the query parameters of the page, filters and order of
+// req.
+func utxoQuery(req UTXORequest) url.Values {
+	query := url.Values{}
+	if req.Limit > 0 {
+		query.Set("limit", strconv.Itoa(req.Limit))
+	}
+	if req.Offset > 0 {
+		query.Set("offset", strconv.Itoa(req.Offset))
+	}
+	if req.MinConf > 0 {
+		query.Set("min_conf", strconv.Itoa(req.MinConf))
+	}
+	if req.MaxConf > 0 {
+		query.Set("max_conf", strconv.Itoa(req.MaxConf))
+	}
+	if req.MinValue > 0 {
+		query.Set("min_value", strconv.FormatInt(req.MinValue, 10))
+	}
+	if req.Sort != "" {
+		query.Set("sort", req.Sort)
+	}
+	if req.Order != "" {
+		query.Set("order", req.Order)
+	}
+	return query
+}
+
+// Broadcast broadcasts the hex-encoded transaction. Broadcasts with the same
+// idempotency key within a day return the first one's result; without a key
+// a random one is used, so that retried attempts are not broadcast twice.
+func (c *Client) Broadcast(ctx context.Context, txHex, idempotencyKey string) (*BroadcastResult, error) {
+	if idempotencyKey == "" {
+		idempotencyKey = newIdempotencyKey()
+	}
+	req := request{
+		method:     http.MethodPost,
+		path:       "/v1/tx/broadcast",
+		body:       map[string]string{"tx_hex": txHex},
+		header:     http.Header{"Idempotency-Key": {idempotencyKey}},
+		idempotent: true,
+	}
+	var result BroadcastResult
+	if err := c.do(ctx, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// BroadcastStatus returns the status of a transaction broadcast through the
+// node.
+func (c *Client) BroadcastStatus(ctx context.Context, txid string) (*BroadcastStatus, error) {
+	var status BroadcastStatus
+	path := "/v1/tx/broadcast/" + txid + "/status"
+	if err := c.do(ctx, request{method: http.MethodGet, path: path, idempotent: true}, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Rescan starts a rescan job in the background. Its progress is reported
+// by RescanStatus.
+func (c *Client) Rescan(ctx context.Context, req RescanRequest) error {
+	// Repeating a rescan would start another job, so only 429s are retried
+	return c.do(ctx, request{method: http.MethodPost, path: "/v1/rescan", body: req}, nil)
+}
+
+// RescanStatus returns the progress of the node's rescan jobs.
+func (c *Client) RescanStatus(ctx context.Context) (*RescanStatus, error) {
+	var status RescanStatus
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/v1/rescan/status", idempotent: true}, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// CreateWallet creates an empty wallet, whose addresses are then watched
+// with WatchRequest.Wallet.
+func (c *Client) CreateWallet(ctx context.Context, name string) (*Wallet, error) {
+	var wallet Wallet
+	body := map[string]string{"name": name}
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/v1/wallets", body: body}, &wallet); err != nil {
+		return nil, err
+	}
+	return &wallet, nil
+}
+
+// WalletUTXOs returns a page of the UTXOs of the addresses of wallet, like
+// GetUTXOs. The addresses and descriptors of req are ignored.
+func (c *Client) WalletUTXOs(ctx context.Context, wallet string, req UTXORequest) (*UTXOs, error) {
+	var utxos UTXOs
+	path := "/v1/wallets/" + url.PathEscape(wallet) + "/utxos"
+	if err := c.do(ctx, request{method: http.MethodGet, path: path, query: utxoQuery(req), idempotent: true}, &utxos); err != nil {
+		return nil, err
+	}
+	return &utxos, nil
+}
+
+// WalletBalance returns the balance of the addresses of wallet.
+func (c *Client) WalletBalance(ctx context.Context, wallet string) (*WalletBalance, error) {
+	var balance WalletBalance
+	path := "/v1/wallets/" + url.PathEscape(wallet) + "/balance"
+	if err := c.do(ctx, request{method: http.MethodGet, path: path, idempotent: true}, &balance); err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
+
+// Watch adds an address, or the addresses derived from descriptors, to the
+// watch list and returns the addresses watched.
+func (c *Client) Watch(ctx context.Context, req WatchRequest) ([]string, error) {
+	var resp struct {
+		Addresses []string `json:"addresses"`
+	}
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/v1/watch/address", body: req, idempotent: true}, &resp); err != nil {
+		return nil, err
+	}
+	if len(req.Descriptors) == 0 {
+		return []string{req.Address}, nil
+	}
+	return resp.Addresses, nil
+}
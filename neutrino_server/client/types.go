@@ -0,0 +1,227 @@
+package client
+
+// Status is the sync status of the node.
+type Status struct {
+	Synced       bool  `json:"synced"`
+	BlockHeight  int32 `json:"block_height"`
+	FilterHeight int32 `json:"filter_height"`
+	Peers        int   `json:"peers"`
+
+	// LastReorg is the most recent reorg seen since the node started.
+	LastReorg *Reorg `json:"last_reorg,omitempty"`
+
+	// SyncStall is set while sync is stalled.
+	SyncStall *SyncStall `json:"sync_stall,omitempty"`
+}
+
+// Reorg describes a chain reorganization.
+type Reorg struct {
+	OldTipHeight int32  `json:"old_tip_height"`
+	OldTipHash   string `json:"old_tip_hash"`
+	NewTipHeight int32  `json:"new_tip_height"`
+	NewTipHash   string `json:"new_tip_hash"`
+	ForkHeight   int32  `json:"fork_height"`
+	Depth        int32  `json:"depth"`
+	Time         int64  `json:"time"`
+}
+
+// SyncStall describes a stalled sync and the recovery the node attempted.
+type SyncStall struct {
+	HeaderHeight int32  `json:"header_height"`
+	FilterHeight int32  `json:"filter_height"`
+	PeerHeight   int32  `json:"peer_height"`
+	Peers        int    `json:"peers"`
+	Since        int64  `json:"since"`
+	Recovery     string `json:"recovery"`
+}
+
+// BlockHeader is the header of a block.
+type BlockHeader struct {
+	Hash       string `json:"hash"`
+	Height     int64  `json:"height"`
+	Timestamp  int64  `json:"timestamp"`
+	Version    int32  `json:"version"`
+	PrevBlock  string `json:"prev_block"`
+	MerkleRoot string `json:"merkle_root"`
+	Bits       uint32 `json:"bits"`
+	Nonce      uint32 `json:"nonce"`
+}
+
+// DescriptorRange is an output descriptor and, for ranged descriptors, the
+// first and last index to derive addresses at.
+type DescriptorRange struct {
+	Descriptor string   `json:"descriptor"`
+	Range      []uint32 `json:"range,omitempty"`
+}
+
+// UTXORequest selects the addresses GetUTXOs returns the UTXOs of, given
+// directly or derived from descriptors, and the page of them to return.
+// A zero Limit returns the node's default page size of 1000.
+type UTXORequest struct {
+	Addresses   []string          `json:"addresses,omitempty"`
+	Descriptors []DescriptorRange `json:"descriptors,omitempty"`
+	Limit       int               `json:"-"`
+	Offset      int               `json:"-"`
+
+	// MinConf and MaxConf bound the confirmations of the UTXOs returned,
+	// and MinValue their value in satoshis. Zero leaves a bound unset.
+	MinConf  int   `json:"-"`
+	MaxConf  int   `json:"-"`
+	MinValue int64 `json:"-"`
+
+	// Sort is the field UTXOs are ordered by, "value", "height" or "txid",
+	// and Order "asc" or "desc". Empty leaves the node's default of
+	// ascending height.
+	Sort  string `json:"-"`
+	Order string `json:"-"`
+}
+
+// UTXO is an unspent output paying a watched address.
+type UTXO struct {
+	TxID         string `json:"txid"`
+	Vout         uint32 `json:"vout"`
+	Value        int64  `json:"value"`
+	Address      string `json:"address"`
+	ScriptPubKey string `json:"scriptpubkey"`
+	Height       int32  `json:"height"`
+
+	// Timelock is set for outputs paying to a registered script with
+	// CLTV/CSV locks.
+	Timelock *Timelock `json:"timelock,omitempty"`
+}
+
+// Timelock describes the time locks of an output and when it can be spent.
+type Timelock struct {
+	LockHeight      int32 `json:"lock_height,omitempty"`
+	LockTime        int64 `json:"lock_time,omitempty"`
+	RelativeBlocks  int32 `json:"relative_blocks,omitempty"`
+	RelativeSeconds int64 `json:"relative_seconds,omitempty"`
+	Conditional     bool  `json:"conditional,omitempty"`
+
+	EarliestSpendableHeight int32 `json:"earliest_spendable_height,omitempty"`
+	EarliestSpendableTime   int64 `json:"earliest_spendable_time,omitempty"`
+	Locked                  bool  `json:"locked"`
+}
+
+// UTXOs is a page of the answer of GetUTXOs. Total counts the UTXOs of
+// every page; the next page starts at Offset+len(UTXOs).
+type UTXOs struct {
+	UTXOs      []UTXO      `json:"utxos"`
+	Total      int         `json:"total"`
+	Limit      int         `json:"limit"`
+	Offset     int         `json:"offset"`
+	Confidence *Confidence `json:"confidence"`
+}
+
+// Confidence tells whether a scan checked every block, or skipped ranges it
+// could not fetch.
+type Confidence struct {
+	Level         string        `json:"level"`
+	SkippedRanges []HeightRange `json:"skipped_ranges,omitempty"`
+	AsOfHeight    int32         `json:"as_of_height,omitempty"`
+}
+
+// HeightRange is the range of heights from Start to End inclusive.
+type HeightRange struct {
+	Start int32 `json:"start"`
+	End   int32 `json:"end"`
+}
+
+// BroadcastStatus is the status of a broadcast transaction.
+type BroadcastStatus struct {
+	TxID   string `json:"txid"`
+	Status string `json:"status"`
+
+	FirstBroadcastAt int64 `json:"first_broadcast_at,omitempty"`
+	LastBroadcastAt  int64 `json:"last_broadcast_at,omitempty"`
+
+	PeersAnnounced int    `json:"peers_announced"`
+	Attempts       int    `json:"attempts"`
+	Rebroadcasts   int    `json:"rebroadcasts"`
+	LastError      string `json:"last_error,omitempty"`
+
+	BlockHash     string `json:"block_hash,omitempty"`
+	BlockHeight   int32  `json:"block_height,omitempty"`
+	Confirmations int32  `json:"confirmations"`
+
+	ConflictingTxID string `json:"conflicting_txid,omitempty"`
+	ConflictHeight  int32  `json:"conflict_height,omitempty"`
+}
+
+// BroadcastResult is the answer of Broadcast. Duplicate is set when the
+// transaction was broadcast before, by an earlier request or attempt.
+type BroadcastResult struct {
+	BroadcastStatus
+	Duplicate bool `json:"duplicate"`
+}
+
+// Outpoint is an output of a transaction.
+type Outpoint struct {
+	TxID string `json:"txid"`
+	Vout uint32 `json:"vout"`
+}
+
+// RescanRequest selects the addresses and outpoints a rescan looks for,
+// from StartHeight to the tip.
+type RescanRequest struct {
+	StartHeight int32             `json:"start_height"`
+	Addresses   []string          `json:"addresses,omitempty"`
+	Descriptors []DescriptorRange `json:"descriptors,omitempty"`
+	Outpoints   []Outpoint        `json:"outpoints,omitempty"`
+}
+
+// RescanStatus is the progress of the node's rescan jobs.
+type RescanStatus struct {
+	InProgress bool        `json:"in_progress"`
+	Jobs       []RescanJob `json:"jobs"`
+	LastJob    *RescanJob  `json:"last_job,omitempty"`
+}
+
+// RescanJob is the progress of a rescan job.
+type RescanJob struct {
+	JobID         uint64      `json:"job_id"`
+	Addresses     int         `json:"addresses"`
+	StartHeight   int32       `json:"start_height"`
+	EndHeight     int32       `json:"end_height"`
+	CurrentHeight int32       `json:"current_height"`
+	Metrics       ScanMetrics `json:"metrics"`
+	Error         string      `json:"error,omitempty"`
+}
+
+// ScanMetrics counts the work of a rescan job so far.
+type ScanMetrics struct {
+	BlocksScanned             int64   `json:"blocks_scanned"`
+	BlocksPerSecond           float64 `json:"blocks_per_second"`
+	FiltersMatched            int64   `json:"filters_matched"`
+	BlocksDownloaded          int64   `json:"blocks_downloaded"`
+	BytesDownloaded           int64   `json:"bytes_downloaded"`
+	ElapsedSeconds            float64 `json:"elapsed_seconds"`
+	RemainingBlocks           int64   `json:"remaining_blocks"`
+	EstimatedSecondsRemaining float64 `json:"estimated_seconds_remaining,omitempty"`
+}
+
+// Wallet describes a wallet and its number of watched addresses.
+type Wallet struct {
+	Name       string `json:"name"`
+	Addresses  int    `json:"addresses"`
+	Archived   bool   `json:"archived"`
+	CreatedAt  int64  `json:"created_at,omitempty"`
+	ArchivedAt int64  `json:"archived_at,omitempty"`
+	PurgeAt    int64  `json:"purge_at,omitempty"`
+}
+
+// WalletBalance sums up the UTXOs of the addresses of a wallet.
+type WalletBalance struct {
+	Wallet    string `json:"wallet"`
+	Addresses int    `json:"addresses"`
+	Balance   int64  `json:"balance"`
+	UTXOCount int    `json:"utxo_count"`
+}
+
+// WatchRequest is an address to watch, or descriptors to watch the derived
+// addresses of, for a wallet or, if Wallet is empty, the default wallet.
+type WatchRequest struct {
+	Address     string            `json:"address,omitempty"`
+	Wallet      string            `json:"wallet,omitempty"`
+	Descriptors []DescriptorRange `json:"descriptors,omitempty"`
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/neutrino"
+)
+
+// runCompactDB implements the compact-db subcommand, which rewrites the
+// database of a stopped node to reclaim the space of deleted data.
+func runCompactDB(args []string) {
+	fs := flag.NewFlagSet("compact-db", flag.ExitOnError)
+	dataDir := fs.String("datadir", getEnv("DATA_DIR", "/data/neutrino"), "Data directory of the database to compact")
+	fs.Parse(args)
+
+	compaction, err := neutrino.CompactDatabase(*dataDir)
+	if err != nil {
+		exitf("compact-db: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Compacted %s from %d to %d bytes\n", compaction.Path, compaction.SizeBefore, compaction.SizeAfter)
+}
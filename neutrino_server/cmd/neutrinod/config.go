@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/config"
+)
+
+// fileConfig holds the options of the --config file. Flags override
+// environment variables, which override the file.
+var fileConfig *config.Values
+
+// invalidSettings collects the config file options whose values could not
+// be parsed, reported once the flags are parsed.
+var invalidSettings []string
+
+// loadConfigFile loads the config file named by --config in args or, if
+// the flag is not given, by CONFIG_FILE.
+func loadConfigFile(args []string) error {
+	path := configFlag(args)
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path == "" {
+		return nil
+	}
+	values, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	fileConfig = values
+	return nil
+}
+
+// configFlag returns the value of the --config flag in args, which has to
+// be known before the other flags are defined, since the file sets their
+// defaults. Like the flag package it stops at the first non-flag argument.
+func configFlag(args []string) string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "config" {
+			continue
+		}
+		if !hasValue && i+1 < len(args) {
+			value = args[i+1]
+		}
+		return value
+	}
+	return ""
+}
+
+// checkConfigFile reports the options of the config file that are unknown
+// or have invalid values.
+func checkConfigFile() error {
+	var problems []string
+	if unknown := fileConfig.Unknown(); len(unknown) > 0 {
+		problems = append(problems, "unknown options "+strings.Join(unknown, ", "))
+	}
+	problems = append(problems, invalidSettings...)
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New("config file " + fileConfig.Path() + ": " + strings.Join(problems, "; "))
+}
+
+// setting returns the value of an option from its environment variable or,
+// if that is unset, the config file.
+func setting(key string) (value string, fromFile bool) {
+	fileValue, inFile := fileConfig.Lookup(key)
+	if value := os.Getenv(key); value != "" {
+		return value, false
+	}
+	return fileValue, inFile
+}
+
+// parseSetting parses the value of an option with parse, returning false if
+// it is unset or, for environment variables, invalid. Invalid values from
+// the config file are reported by checkConfigFile.
+func parseSetting[T any](key string, parse func(string) (T, error)) (T, bool) {
+	value, fromFile := setting(key)
+	if value == "" {
+		var zero T
+		return zero, false
+	}
+	parsed, err := parse(value)
+	if err != nil && fromFile {
+		invalidSettings = append(invalidSettings, fmt.Sprintf("invalid %s %q", key, value))
+	}
+	return parsed, err == nil
+}
+
+// getEnv returns the value of an environment variable or a default value.
+func getEnv(key, defaultValue string) string {
+	if value, _ := setting(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvList returns the whitespace-separated values of an environment
+// variable, the list of values in the config file, or a default value.
+func getEnvList(key string, defaultValue []string) []string {
+	if value := os.Getenv(key); value != "" {
+		fileConfig.Lookup(key)
+		return strings.Fields(value)
+	}
+	if values, ok := fileConfig.List(key); ok {
+		return values
+	}
+	return defaultValue
+}
+
+// getEnvInt returns the integer value of an environment variable or a default
+// value if it is unset or not a valid integer.
+func getEnvInt(key string, defaultValue int) int {
+	if parsed, ok := parseSetting(key, strconv.Atoi); ok {
+		return parsed
+	}
+	return defaultValue
+}
+
+// getEnvFloat returns the float value of an environment variable or a default
+// value if it is unset or not a valid number.
+func getEnvFloat(key string, defaultValue float64) float64 {
+	parse := func(value string) (float64, error) { return strconv.ParseFloat(value, 64) }
+	if parsed, ok := parseSetting(key, parse); ok {
+		return parsed
+	}
+	return defaultValue
+}
+
+// getEnvDuration returns the duration value of an environment variable or a
+// default value if it is unset or not a valid duration.
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if parsed, ok := parseSetting(key, time.ParseDuration); ok {
+		return parsed
+	}
+	return defaultValue
+}
+
+// getEnvBool returns the boolean value of an environment variable or a default
+// value if it is unset or not a valid boolean.
+func getEnvBool(key string, defaultValue bool) bool {
+	if parsed, ok := parseSetting(key, strconv.ParseBool); ok {
+		return parsed
+	}
+	return defaultValue
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/btcsuite/btclog"
+	"github.com/gorilla/mux"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/addrindex"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/api"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/auth"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/buildinfo"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// runIndexAPI implements the index-api subcommand, a stateless API replica
+// serving the /v1/address endpoints from an address index a node writes.
+func runIndexAPI(args []string) {
+	fs := flag.NewFlagSet("index-api", flag.ExitOnError)
+	indexDB := fs.String("index-db", getEnv("INDEX_DB", ""), "Address index database written by a node: postgres://... or sqlite:/path")
+	listens := &listenFlag{values: getEnvList("LISTEN_ADDR", []string{"0.0.0.0:8334"})}
+	fs.Var(listens, "listen", "REST API listen address, repeatable, e.g. 0.0.0.0:8334 or unix:/run/neutrinod-index.sock")
+	apiKeysFile := fs.String("api-keys-file", getEnv("API_KEYS_FILE", ""), "JSON file of API keys and their scopes; when set, every request needs a key")
+	swaggerUI := fs.Bool("swagger-ui", getEnvBool("SWAGGER_UI", false), "Serve a Swagger UI page for the OpenAPI document at /docs, with the assets in --swagger-ui-dir")
+	swaggerUIDir := fs.String("swagger-ui-dir", getEnv("SWAGGER_UI_DIR", ""), "Unpacked swagger-ui-dist package the Swagger UI page loads its scripts and styles from")
+	logLevel := fs.String("loglevel", getEnv("LOG_LEVEL", "info"), "Log level (trace, debug, info, warn, error)")
+	fs.Parse(args)
+
+	if *indexDB == "" {
+		exitf("index-api: --index-db is required")
+	}
+	backend, err := logging.NewBackend(os.Stdout, logging.FormatText)
+	if err != nil {
+		exitf("index-api: %v", err)
+	}
+	level, _ := btclog.LevelFromString(*logLevel)
+	logLevels := logging.NewSharedLevel(backend, level)
+	logger := logLevels.Logger("MAIN")
+
+	info := buildinfo.New(version, commit, buildTime)
+	logger.Infof("Starting %s address index replica", info)
+	index, err := addrindex.Open(*indexDB)
+	if err != nil {
+		exitf("index-api: %v", err)
+	}
+	defer index.Close()
+	network, err := index.Network()
+	if err != nil {
+		exitf("index-api: the address index has not been written by a node yet: %v", err)
+	}
+	logger.Infof("Network: %s", network)
+
+	listeners, err := parseListeners(listens.values)
+	if err != nil {
+		exitf("index-api: invalid listen address: %v", err)
+	}
+	bound, err := bindListeners(listeners, false)
+	if err != nil {
+		exitf("index-api: failed to listen: %v", err)
+	}
+
+	handler := api.NewHandler(nil, logLevels.Logger("API"))
+	handler.SetBuildInfo(info)
+	handler.SetAddressIndex(index)
+	if *swaggerUI {
+		assets, err := api.SwaggerUIAssets(*swaggerUIDir)
+		if err != nil {
+			exitf("index-api: invalid --swagger-ui-dir: %v", err)
+		}
+		handler.SetSwaggerUI(assets)
+	}
+	if *apiKeysFile != "" {
+		keyring, err := auth.Load(*apiKeysFile)
+		if err != nil {
+			exitf("index-api: failed to load API keys: %v", err)
+		}
+		handler.SetKeyring(keyring)
+	}
+	router := mux.NewRouter()
+	handler.RegisterIndexRoutes(router)
+	servers := serveAPI(listeners, bound, router, nil, api.DefaultTimeouts(), logger)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+
+	logger.Info("Shutting down...")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Errorf("HTTP server shutdown error: %v", err)
+		}
+	}
+}
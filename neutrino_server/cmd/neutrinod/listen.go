@@ -0,0 +1,191 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btclog"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/api"
+)
+
+// listenFlag collects the values of a repeated --listen flag. The first
+// value given replaces the default.
+type listenFlag struct {
+	values []string
+	set    bool
+}
+
+func (f *listenFlag) String() string {
+	return strings.Join(f.values, " ")
+}
+
+func (f *listenFlag) Set(value string) error {
+	if !f.set {
+		f.values, f.set = nil, true
+	}
+	f.values = append(f.values, value)
+	return nil
+}
+
+// parseListeners parses the listen addresses of specs.
+func parseListeners(specs []string) ([]api.Listener, error) {
+	if len(specs) == 0 {
+		return nil, errors.New("no listen address given")
+	}
+	listeners := make([]api.Listener, 0, len(specs))
+	for _, spec := range specs {
+		l, err := api.ParseListener(spec)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// usesTLS reports whether l is served over TLS when the server has a TLS
+// configuration or, if hasTLS is false, does not.
+func usesTLS(l api.Listener, hasTLS bool) bool {
+	if l.TLS != nil {
+		return *l.TLS
+	}
+	return hasTLS && l.Network == "tcp"
+}
+
+// listenHosts returns the specific hosts of the TCP listeners, which a
+// generated certificate must be valid for.
+func listenHosts(listeners []api.Listener) []string {
+	var hosts []string
+	for _, l := range listeners {
+		if l.Network != "tcp" {
+			continue
+		}
+		if host, _, err := net.SplitHostPort(l.Address); err == nil {
+			if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	return hosts
+}
+
+// tlsPort returns the port of the first TCP listener served over TLS, which
+// plain HTTP requests are redirected to.
+func tlsPort(listeners []api.Listener) string {
+	for _, l := range listeners {
+		if l.Network == "tcp" && usesTLS(l, true) {
+			if _, port, err := net.SplitHostPort(l.Address); err == nil {
+				return port
+			}
+		}
+	}
+	return ""
+}
+
+// onionDefaults returns the address Tor forwards onion connections to and
+// the onion port: the listener with onion=true, reached on loopback if it
+// listens on every address, and its port.
+func onionDefaults(listeners []api.Listener) (string, int) {
+	for _, l := range listeners {
+		if !l.Onion {
+			continue
+		}
+		host, portText, err := net.SplitHostPort(l.Address)
+		if err != nil {
+			continue
+		}
+		if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+			host = "127.0.0.1"
+		}
+		port, _ := strconv.Atoi(portText)
+		return net.JoinHostPort(host, portText), port
+	}
+	return "", 0
+}
+
+// bindListeners binds every listener, so a bad or taken address fails
+// startup before the node starts. hasTLS tells whether the server has a
+// TLS configuration for the listeners that need one.
+func bindListeners(listeners []api.Listener, hasTLS bool) ([]net.Listener, error) {
+	bound := make([]net.Listener, 0, len(listeners))
+	for _, l := range listeners {
+		ln, err := listen(l)
+		if err == nil && usesTLS(l, hasTLS) && !hasTLS {
+			ln.Close()
+			err = fmt.Errorf("listener %s needs TLS: set --tlscert and --tlskey, --tls-self-signed or --acme-domain", l)
+		}
+		if err != nil {
+			for _, ln := range bound {
+				ln.Close()
+			}
+			return nil, err
+		}
+		bound = append(bound, ln)
+	}
+	return bound, nil
+}
+
+// serveAPI serves handler on the bound listeners, each with its own
+// settings, and returns their servers.
+func serveAPI(listeners []api.Listener, bound []net.Listener, handler http.Handler, tlsConfig *tls.Config, timeouts api.TimeoutConfig, logger btclog.Logger) []*http.Server {
+	servers := make([]*http.Server, len(listeners))
+	for i, l := range listeners {
+		secure := usesTLS(l, tlsConfig != nil)
+		server := timeouts.Server(api.ServeListener(l, handler))
+		if secure {
+			server.TLSConfig = tlsConfig
+		}
+		servers[i] = server
+
+		go func(ln net.Listener) {
+			var err error
+			if secure {
+				logger.Infof("HTTPS server listening on %s", l)
+				err = server.ServeTLS(ln, "", "")
+			} else {
+				logger.Infof("HTTP server listening on %s", l)
+				err = server.Serve(ln)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				logger.Errorf("HTTP server error on %s: %v", l, err)
+			}
+		}(bound[i])
+	}
+	return servers
+}
+
+// listen binds l. A stale unix socket left by an unclean exit is replaced,
+// and new sockets are only accessible to the owner and group.
+func listen(l api.Listener) (net.Listener, error) {
+	if l.Network != "unix" {
+		ln, err := net.Listen(l.Network, l.Address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on %s: %w", l, err)
+		}
+		return ln, nil
+	}
+
+	if info, err := os.Lstat(l.Address); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", l.Address); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to listen on %s: socket in use", l)
+		}
+		os.Remove(l.Address)
+	}
+	ln, err := net.Listen("unix", l.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", l, err)
+	}
+	if err := os.Chmod(l.Address, 0660); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to set permissions of %s: %w", l, err)
+	}
+	return ln, nil
+}
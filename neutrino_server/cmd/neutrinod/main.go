@@ -6,11 +6,16 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -18,42 +23,231 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/yourusername/neutrino-api/neutrino_server/internal/api"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/auth"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/buildinfo"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
 	"github.com/yourusername/neutrino-api/neutrino_server/internal/neutrino"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/onion"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/scancache"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/tlscert"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/tracing"
 )
 
 var (
-	// Version is set at build time via ldflags
-	version = "dev"
+	// Version, commit, and build time are set at build time via ldflags
+	version   = "dev"
+	commit    = ""
+	buildTime = ""
 )
 
 func main() {
+	// Subcommands are dispatched before flag parsing
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "version":
+			runVersion(os.Args[2:])
+			return
+		case "export-headers":
+			runExportHeaders(os.Args[2:])
+			return
+		case "import-headers":
+			runImportHeaders(os.Args[2:])
+			return
+		case "backup":
+			runBackup(os.Args[2:])
+			return
+		case "compact-db":
+			runCompactDB(os.Args[2:])
+			return
+		case "index-api":
+			runIndexAPI(os.Args[2:])
+			return
+		}
+	}
+
+	// The config file sets the defaults of the flags, so it is loaded first
+	if err := loadConfigFile(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	// Parse command line flags
+	flag.String("config", getEnv("CONFIG_FILE", ""), "YAML or TOML file setting any option by its environment variable name; environment variables and flags override it")
 	network := flag.String("network", getEnv("NETWORK", "mainnet"), "Bitcoin network (mainnet, testnet, regtest, signet)")
-	listen := flag.String("listen", getEnv("LISTEN_ADDR", "0.0.0.0:8334"), "REST API listen address")
+	listens := &listenFlag{values: getEnvList("LISTEN_ADDR", []string{"0.0.0.0:8334"})}
+	flag.Var(listens, "listen", "REST API listen address, repeatable, with optional settings, e.g. 127.0.0.1:8334, unix:/run/neutrinod.sock?auth=none or 0.0.0.0:8335?tls=true&scopes=read")
 	dataDir := flag.String("datadir", getEnv("DATA_DIR", "/data/neutrino"), "Data directory for headers and filters")
 	logLevel := flag.String("loglevel", getEnv("LOG_LEVEL", "info"), "Log level (trace, debug, info, warn, error)")
+	logFormat := flag.String("logformat", getEnv("LOG_FORMAT", logging.FormatText), "Log format (text, json)")
+	logFile := flag.String("logfile", getEnv("LOG_FILE", ""), "File to write logs to in addition to stdout, rotated by size and age (empty disables it)")
+	logFileMaxSize := flag.Int("logfile-max-size", getEnvInt("LOG_FILE_MAX_SIZE", logging.DefaultFileMaxSizeMB), "Size in MiB at which the log file is rotated")
+	logFileMaxAge := flag.Duration("logfile-max-age", getEnvDuration("LOG_FILE_MAX_AGE", logging.DefaultFileMaxAge), "How long rotated log files are kept (0 keeps them regardless of age)")
+	logFileMaxBackups := flag.Int("logfile-max-backups", getEnvInt("LOG_FILE_MAX_BACKUPS", logging.DefaultFileMaxBackups), "Number of rotated log files kept (0 keeps them all)")
 	connectPeers := flag.String("connect", getEnv("CONNECT_PEERS", ""), "Comma-separated list of peers to connect to")
-	torProxy := flag.String("torproxy", getEnv("TOR_PROXY", ""), "Tor SOCKS5 proxy address (e.g., 127.0.0.1:9050)")
+	addPeers := flag.String("addpeer", getEnv("ADD_PEERS", ""), "Comma-separated list of peers to connect to in addition to discovered peers")
+	checkpointList := flag.String("checkpoints", getEnv("CHECKPOINTS", ""), "Comma-separated known-good blocks as height:block_hash[:filter_header], added to the built-in checkpoints")
+	dnsSeeds := flag.String("dns-seeds", getEnv("DNS_SEEDS", ""), "Comma-separated DNS seeds replacing the built-in ones, or none to disable DNS seeding")
+	peersFile := flag.String("peers-file", getEnv("PEERS_FILE", ""), "File of static peers (peer=host:port) and DNS seeds (dnsseed=host or dnsseed=none), one per line")
+	maxPeers := flag.Int("maxpeers", getEnvInt("MAX_PEERS", neutrino.DefaultMaxPeers), "Number of peers to connect to")
+	maxPeersPerGroup := flag.Int("max-peers-per-group", getEnvInt("MAX_PEERS_PER_GROUP", neutrino.DefaultMaxPeersPerGroup), "Number of discovered peers to connect to in the same network group (/16, /32 for IPv6, or AS)")
+	asnFile := flag.String("asn-file", getEnv("ASN_FILE", ""), "File mapping networks to AS numbers (a CIDR network and an AS number per line), to group peers by AS")
+	stallTimeout := flag.Duration("stall-timeout", getEnvDuration("STALL_TIMEOUT", neutrino.DefaultStallTimeout), "How long sync may not advance while peers are ahead before it counts as stalled")
+	stallRecovery := flag.String("stall-recovery", getEnv("STALL_RECOVERY", neutrino.StallRecoveryNone), "What to do about a sync stall: none, rotate (reconnect to new peers) or restart (restart the daemon)")
+	banDuration := flag.Duration("ban-duration", getEnvDuration("BAN_DURATION", neutrino.DefaultBanDuration), "How long peers are banned for misbehaving")
+	onlyNet := flag.String("onlynet", getEnv("ONLYNET", ""), "Only connect to peers of this network: onion (through --torproxy, bootstrapping from --connect or --addpeer)")
+	torProxy := flag.String("torproxy", getEnv("TOR_PROXY", ""), "Tor SOCKS5 proxy address, or a comma-separated list to fail over between (e.g., 127.0.0.1:9050 or user:password@proxy:1080)")
+	torIsolation := flag.Bool("tor-isolation", getEnvBool("TOR_ISOLATION", false), "Connect through the Tor proxy with random credentials per connection, so every peer gets its own Tor circuit")
+	scanWorkers := flag.Int("scan-workers", getEnvInt("SCAN_WORKERS", neutrino.DefaultScanWorkers), "Number of concurrent filter/block fetchers used by scans")
+	torControl := flag.String("tor-control", getEnv("TOR_CONTROL", ""), "Tor control port, as host:port or unix:/path, used to publish the onion service")
+	torControlPassword := flag.String("tor-control-password", getEnv("TOR_CONTROL_PASSWORD", ""), "Tor control port password (empty uses Tor's cookie file or no authentication)")
+	onionService := flag.Bool("onion", getEnvBool("ONION", false), "Publish the REST API as a Tor v3 onion service through --tor-control")
+	onionPort := flag.Int("onion-port", getEnvInt("ONION_PORT", 0), "Port of the onion address (defaults to the port of the listener with onion=true)")
+	onionTarget := flag.String("onion-target", getEnv("ONION_TARGET", ""), "Address Tor forwards onion connections to (defaults to the listener with onion=true)")
+	scanMode := flag.String("scan-mode", getEnv("SCAN_MODE", string(neutrino.ScanLenient)), "How scans treat blocks that cannot be checked: lenient (skip and label results partial) or strict (fail)")
+	blockMemoryCacheMB := flag.Int("block-memory-cache-mb", getEnvInt("BLOCK_MEMORY_CACHE_MB", 0), "Memory in MiB for recently fetched blocks kept in memory, so scans matching the same blocks do not download them again (0 uses neutrino's default of about 40 MB)")
+	filterCacheMB := flag.Int("filter-cache-mb", getEnvInt("FILTER_CACHE_MB", 0), "Memory in MiB for compact filters kept in memory (0 uses neutrino's default of about 30 MB)")
+	filterBatchSize := flag.Int("filter-batch-size", getEnvInt("FILTER_BATCH_SIZE", neutrino.DefaultFilterBatchSize), "Number of compact filters prefetched per request during scans (1 disables batching)")
+	readyMinPeers := flag.Int("ready-min-peers", getEnvInt("READY_MIN_PEERS", 1), "Minimum connected peers for /readyz (0 disables the check)")
+	readyHeaders := flag.Bool("ready-headers-current", getEnvBool("READY_HEADERS_CURRENT", true), "Require a current header chain for /readyz")
+	readyTipLag := flag.Int("ready-max-tip-lag", getEnvInt("READY_MAX_TIP_LAG", -1), "Maximum blocks headers may trail the best peer for /readyz (negative disables the check)")
+	readyFilterLag := flag.Int("ready-max-filter-lag", getEnvInt("READY_MAX_FILTER_LAG", -1), "Maximum blocks filters may trail headers for /readyz (negative disables the check)")
+	readyScans := flag.Bool("ready-healthy-scans", getEnvBool("READY_HEALTHY_SCANS", false), "Require the last background rescan to have succeeded for /readyz")
+	feeEstimator := flag.String("fee-estimator", getEnv("FEE_ESTIMATOR", neutrino.FeeEstimatorBlockPercentile), "Fee estimator for /v1/fees/estimate (block-percentile, static, mempool-space, bitcoind)")
+	feeStaticRate := flag.Float64("fee-static-rate", getEnvFloat("FEE_STATIC_RATE", neutrino.DefaultStaticFeeRate), "Fee rate in sat/vB returned by the static estimator")
+	feeBlocks := flag.Int("fee-blocks", getEnvInt("FEE_BLOCKS", neutrino.DefaultFeeBlocks), "Number of recent blocks sampled by the block-percentile estimator")
+	feeMempoolURL := flag.String("fee-mempool-url", getEnv("FEE_MEMPOOL_URL", neutrino.DefaultMempoolSpaceURL), "Base URL of the mempool.space API used by the mempool-space estimator")
+	feeBitcoindRPC := flag.String("fee-bitcoind-rpc", getEnv("FEE_BITCOIND_RPC", ""), "bitcoind JSON-RPC URL used by the bitcoind estimator")
+	feeBitcoindUser := flag.String("fee-bitcoind-user", getEnv("FEE_BITCOIND_USER", ""), "bitcoind RPC username")
+	feeBitcoindPass := flag.String("fee-bitcoind-pass", getEnv("FEE_BITCOIND_PASS", ""), "bitcoind RPC password")
+	feeCacheTTL := flag.Duration("fee-cache-ttl", getEnvDuration("FEE_CACHE_TTL", neutrino.DefaultFeeCacheTTL), "How long rates from the mempool-space and bitcoind estimators are reused (0 disables the cache)")
+	feeFallback := flag.Bool("fee-fallback", getEnvBool("FEE_FALLBACK", true), "Answer with the block-percentile estimator when the mempool-space or bitcoind estimator fails")
+	retainBlocks := flag.Bool("retain-blocks", getEnvBool("RETAIN_BLOCKS", false), "Retain merkle proofs of watched transactions from blocks downloaded by rescans")
+	retainMaxMB := flag.Int("retain-max-mb", getEnvInt("RETAIN_MAX_MB", neutrino.DefaultRetentionMaxBytes>>20), "Storage limit in MiB for retained blocks; the oldest are pruned first")
+	spentRetention := flag.Int("spent-retention", getEnvInt("SPENT_RETENTION", neutrino.DefaultSpentRetention), "How many blocks deep spent watched UTXOs are kept for outpoint lookups (0 keeps them forever)")
+	walletRetention := flag.Duration("wallet-retention", getEnvDuration("WALLET_RETENTION", neutrino.DefaultWalletRetention), "How long deleted (archived) wallets keep their data before being purged (0 keeps it until purged explicitly)")
+	checkHeaders := flag.Bool("check-headers-on-start", getEnvBool("CHECK_HEADERS_ON_START", false), "Check the stored header chains at startup and truncate corrupt ones to their last consistent height")
+	compactDB := flag.Bool("compact-db-on-start", getEnvBool("COMPACT_DB_ON_START", false), "Compact the database before opening it, reclaiming the space of deleted data")
+	dbBackend := flag.String("db", getEnv("DB", neutrino.DBBackendBolt), "Database backend: bdb (bbolt), sqlite, which migrates an existing bbolt database once, or memory, which keeps no data across restarts")
+	sqliteJournalMode := flag.String("sqlite-journal-mode", getEnv("SQLITE_JOURNAL_MODE", neutrino.SQLiteJournalWAL), "Journal mode of the SQLite database: wal, or delete on network file systems")
+	indexDB := flag.String("index-db", getEnv("INDEX_DB", ""), "Address index database to copy the UTXOs and transactions of watched addresses into, postgres://... or sqlite:/path (empty disables it)")
+	scanCacheURL := flag.String("scan-cache", getEnv("SCAN_CACHE", ""), "Cache of filter match results: memory, or a redis:// URL shared by several nodes (empty disables it)")
+	scanCacheTTL := flag.Duration("scan-cache-ttl", getEnvDuration("SCAN_CACHE_TTL", 24*time.Hour), "How long cached filter match results are kept (0 keeps them until evicted)")
+	maxRescanJobs := flag.Int("max-rescan-jobs", getEnvInt("MAX_RESCAN_JOBS", neutrino.DefaultMaxRescanJobs), "Rescan jobs started through /v1/rescan running at once; further requests are answered with 429")
+	scanMemoTTL := flag.Duration("scan-memo-ttl", getEnvDuration("SCAN_MEMO_TTL", neutrino.DefaultScanMemoTTL), "How long rescans and filter matches remember the block ranges in which a script matched no filters (0 disables it)")
+	backupDir := flag.String("backup-dir", getEnv("BACKUP_DIR", ""), "Directory backups are written to (defaults to backups in the data directory)")
+	blockCacheMB := flag.Int("block-cache-mb", getEnvInt("BLOCK_CACHE_MB", 0), "Storage limit in MiB for blocks cached by the raw block endpoint; the least recently requested are pruned first (0 disables the cache)")
+	otlpEndpoint := flag.String("otlp-endpoint", getEnv("OTLP_ENDPOINT", ""), "OTLP/HTTP collector URL to export traces to, e.g. http://localhost:4318 (empty disables tracing)")
+	traceSampleRatio := flag.Float64("trace-sample-ratio", getEnvFloat("TRACE_SAMPLE_RATIO", 1), "Share of new traces exported, from 0 to 1; propagated sampled traces are always exported")
+	tlsCert := flag.String("tlscert", getEnv("TLS_CERT", ""), "TLS certificate file to serve the REST API over HTTPS with")
+	tlsKey := flag.String("tlskey", getEnv("TLS_KEY", ""), "TLS key file of the certificate")
+	tlsSelfSigned := flag.Bool("tls-self-signed", getEnvBool("TLS_SELF_SIGNED", false), "Generate a self-signed certificate if the certificate and key files do not exist (defaults to tls.cert and tls.key in the data directory)")
+	tlsHosts := flag.String("tls-hosts", getEnv("TLS_HOSTS", ""), "Comma-separated DNS names and IP addresses a generated certificate is valid for, besides localhost")
+	tlsClientCA := flag.String("tls-client-ca", getEnv("TLS_CLIENT_CA", ""), "PEM file of CA certificates; when set, requests need a client certificate signed by one of them, or an API key")
+	acmeDomain := flag.String("acme-domain", getEnv("ACME_DOMAIN", ""), "Comma-separated domains to get TLS certificates for from Let's Encrypt, renewed automatically")
+	acmeEmail := flag.String("acme-email", getEnv("ACME_EMAIL", ""), "Contact email given to the ACME CA for expiry notices")
+	acmeHTTPListen := flag.String("acme-http-listen", getEnv("ACME_HTTP_LISTEN", ":80"), "Address answering ACME HTTP-01 challenges and redirecting to HTTPS (empty disables it)")
+	acmeDirectory := flag.String("acme-directory", getEnv("ACME_DIRECTORY", ""), "ACME directory URL, e.g. Let's Encrypt staging (defaults to Let's Encrypt production)")
+	rateLimit := flag.Float64("rate-limit", getEnvFloat("RATE_LIMIT", 0), "Requests per second allowed across all clients (0 disables the limit)")
+	rateLimitBurst := flag.Int("rate-limit-burst", getEnvInt("RATE_LIMIT_BURST", 0), "Requests allowed at once across all clients (defaults to the rate)")
+	clientRateLimit := flag.Float64("client-rate-limit", getEnvFloat("CLIENT_RATE_LIMIT", 0), "Requests per second allowed per API key, client certificate or IP address (0 disables the limit)")
+	clientRateLimitBurst := flag.Int("client-rate-limit-burst", getEnvInt("CLIENT_RATE_LIMIT_BURST", 0), "Requests allowed at once per client (defaults to the rate)")
+	maxConcurrentScans := flag.Int("max-concurrent-scans", getEnvInt("MAX_CONCURRENT_SCANS", api.DefaultMaxConcurrentScans), "Requests each scan endpoint (/v1/utxo, /v1/utxos, /v1/rescan, ...) runs at once (0 removes the bound)")
+	maxQueuedScans := flag.Int("max-queued-scans", getEnvInt("MAX_QUEUED_SCANS", api.DefaultMaxQueuedScans), "Requests each scan endpoint queues while busy before answering 429")
+	httpReadTimeout := flag.Duration("http-read-timeout", getEnvDuration("HTTP_READ_TIMEOUT", api.DefaultReadTimeout), "How long the API may take to read a request, including its body (0 disables the timeout)")
+	httpWriteTimeout := flag.Duration("http-write-timeout", getEnvDuration("HTTP_WRITE_TIMEOUT", api.DefaultWriteTimeout), "How long the API may take to answer a request; scans without a timeout parameter stop in time to answer within it (0 disables the timeout)")
+	httpIdleTimeout := flag.Duration("http-idle-timeout", getEnvDuration("HTTP_IDLE_TIMEOUT", api.DefaultIdleTimeout), "How long a kept-alive API connection waits for its next request (0 uses the read timeout)")
+	maxScanTimeout := flag.Duration("max-scan-timeout", getEnvDuration("MAX_SCAN_TIMEOUT", api.DefaultMaxScanTimeout), "Largest timeout parameter scan endpoints accept (0 removes the bound)")
+	maxBodyMB := flag.Int("max-body-mb", getEnvInt("MAX_BODY_MB", api.DefaultMaxBodyBytes>>20), "Largest request body in MiB the API accepts, answering larger ones with 413 (0 removes the bound)")
+	swaggerUI := flag.Bool("swagger-ui", getEnvBool("SWAGGER_UI", false), "Serve a Swagger UI page for the OpenAPI document at /docs, with the assets in --swagger-ui-dir")
+	swaggerUIDir := flag.String("swagger-ui-dir", getEnv("SWAGGER_UI_DIR", ""), "Unpacked swagger-ui-dist package the Swagger UI page loads its scripts and styles from")
+	basePath := flag.String("base-path", getEnv("BASE_PATH", ""), "Path prefix the API is served under, e.g. /neutrino behind a reverse proxy")
+	trustedProxies := flag.String("trusted-proxies", getEnv("TRUSTED_PROXIES", ""), "Comma-separated IP addresses and CIDR ranges of reverse proxies whose X-Forwarded-For and X-Real-IP headers are trusted")
+	apiKeysFile := flag.String("api-keys-file", getEnv("API_KEYS_FILE", ""), "JSON file of API keys and their scopes; when set, every request except /readyz needs a key")
+	debugListen := flag.String("debug-listen", getEnv("DEBUG_LISTEN", ""), "Loopback address serving pprof profiles and runtime stats, e.g. 127.0.0.1:6060 (empty disables it)")
+	webhooksFile := flag.String("webhooks-file", getEnv("WEBHOOKS_FILE", ""), "JSON file of webhooks to register, with their secrets; reloaded on SIGHUP")
+	watchFile := flag.String("watchfile", getEnv("WATCH_FILE", ""), "JSON or CSV file of addresses (with optional birthdays and wallets) to watch at startup")
 	showVersion := flag.Bool("version", false, "Show version and exit")
 	flag.Parse()
+	if err := checkConfigFile(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	info := buildinfo.New(version, commit, buildTime)
 
 	if *showVersion {
-		fmt.Printf("neutrinod %s\n", version)
+		fmt.Println(info.String())
 		os.Exit(0)
 	}
 
 	// Set up logging
-	backend := btclog.NewBackend(os.Stdout)
-	logger := backend.Logger("MAIN")
+	var logOutput io.Writer = os.Stdout
+	var logFileWriter io.WriteCloser
+	if *logFile != "" {
+		var err error
+		logFileWriter, err = logging.OpenFile(logging.FileConfig{
+			Path:       *logFile,
+			MaxSizeMB:  *logFileMaxSize,
+			MaxAge:     *logFileMaxAge,
+			MaxBackups: *logFileMaxBackups,
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		logOutput = io.MultiWriter(os.Stdout, logFileWriter)
+	}
+	backend, err := logging.NewBackend(logOutput, *logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	level, _ := btclog.LevelFromString(*logLevel)
-	logger.SetLevel(level)
+	logLevels := logging.NewSharedLevel(backend, level)
+	logger := logLevels.Logger("MAIN")
 
-	logger.Infof("Starting neutrinod %s", version)
+	logger.Infof("Starting %s", info)
+	if fileConfig != nil {
+		logger.Infof("Config file: %s", fileConfig.Path())
+	}
 	logger.Infof("Network: %s", *network)
-	logger.Infof("Listen address: %s", *listen)
+	listeners, err := parseListeners(listens.values)
+	if err != nil {
+		logger.Errorf("Invalid listen address: %v", err)
+		os.Exit(1)
+	}
+	checkpoints, err := neutrino.ParseCheckpoints(*checkpointList)
+	if err != nil {
+		logger.Errorf("Invalid checkpoints: %v", err)
+		os.Exit(1)
+	}
+	logger.Infof("Listen addresses: %s", listens)
 	logger.Infof("Data directory: %s", *dataDir)
 	if *torProxy != "" {
-		logger.Infof("Tor proxy: %s", *torProxy)
+		logger.Infof("Tor proxy: %s", neutrino.RedactTorProxy(*torProxy))
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Endpoint:    *otlpEndpoint,
+		SampleRatio: *traceSampleRatio,
+		Version:     info.Version,
+	})
+	if err != nil {
+		logger.Errorf("Failed to set up tracing: %v", err)
+		os.Exit(1)
+	}
+	if *otlpEndpoint != "" {
+		logger.Infof("Exporting traces to %s", *otlpEndpoint)
+	}
+
+	// The debug server is separate so profiles never share the API address
+	var debugServer *http.Server
+	if *debugListen != "" {
+		debugServer, err = startDebugServer(*debugListen, logger)
+		if err != nil {
+			logger.Errorf("Failed to start debug server: %v", err)
+			os.Exit(1)
+		}
 	}
 
 	// Ensure data directory exists
@@ -62,15 +256,201 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Set up TLS before starting the node, so a bad certificate or domain
+	// fails fast
+	var tlsConfig *tls.Config
+	var acmeServer *http.Server
+	if *acmeDomain != "" && (*tlsCert != "" || *tlsKey != "" || *tlsSelfSigned) {
+		logger.Error("--acme-domain cannot be combined with --tlscert, --tlskey or --tls-self-signed")
+		os.Exit(1)
+	}
+	if *acmeDomain != "" {
+		manager, err := tlscert.NewACMEManager(tlscert.ACMEConfig{
+			Domains:      strings.Split(*acmeDomain, ","),
+			Email:        *acmeEmail,
+			CacheDir:     filepath.Join(*dataDir, "acme"),
+			DirectoryURL: *acmeDirectory,
+		})
+		if err != nil {
+			logger.Errorf("Failed to set up ACME: %v", err)
+			os.Exit(1)
+		}
+		tlsConfig = manager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		logger.Infof("Serving HTTPS with ACME certificates for %s", *acmeDomain)
+
+		// HTTP-01 challenges arrive on port 80; other requests there are
+		// redirected to the API
+		if *acmeHTTPListen != "" {
+			acmeServer = &http.Server{
+				Addr:         *acmeHTTPListen,
+				Handler:      manager.HTTPHandler(tlscert.RedirectHandler(tlsPort(listeners))),
+				ReadTimeout:  30 * time.Second,
+				WriteTimeout: 30 * time.Second,
+			}
+			go func() {
+				logger.Infof("ACME challenge server listening on %s", *acmeHTTPListen)
+				if err := acmeServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					logger.Errorf("ACME challenge server error: %v", err)
+				}
+			}()
+		}
+	} else if *tlsCert != "" || *tlsKey != "" || *tlsSelfSigned {
+		certConfig := tlscert.Config{
+			CertPath: *tlsCert,
+			KeyPath:  *tlsKey,
+			Generate: *tlsSelfSigned,
+		}
+		if *tlsSelfSigned && *tlsCert == "" && *tlsKey == "" {
+			certConfig.CertPath = filepath.Join(*dataDir, "tls.cert")
+			certConfig.KeyPath = filepath.Join(*dataDir, "tls.key")
+		}
+		if *tlsHosts != "" {
+			certConfig.Hosts = strings.Split(*tlsHosts, ",")
+		}
+		certConfig.Hosts = append(certConfig.Hosts, listenHosts(listeners)...)
+
+		cert, err := tlscert.Load(certConfig)
+		if err != nil {
+			logger.Errorf("Failed to load TLS certificate: %v", err)
+			os.Exit(1)
+		}
+		tlsConfig = &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{cert},
+		}
+		logger.Infof("Serving HTTPS with certificate %s (SHA-256 fingerprint %s, expires %s)",
+			certConfig.CertPath, tlscert.Fingerprint(cert.Leaf), cert.Leaf.NotAfter.Format(time.DateOnly))
+	}
+
+	// Client certificates are verified in the handshake when given; the
+	// API decides which requests need one, so probes can do without
+	if *tlsClientCA != "" {
+		if tlsConfig == nil {
+			logger.Error("--tls-client-ca needs TLS: set --tlscert and --tlskey, --tls-self-signed or --acme-domain")
+			os.Exit(1)
+		}
+		clientCAs, err := tlscert.LoadClientCAs(*tlsClientCA)
+		if err != nil {
+			logger.Errorf("Failed to load client CAs: %v", err)
+			os.Exit(1)
+		}
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		logger.Infof("Client certificate authentication enabled with CAs from %s", *tlsClientCA)
+	}
+
+	proxies, err := api.ParseTrustedProxies(*trustedProxies)
+	if err != nil {
+		logger.Errorf("Invalid trusted proxies: %v", err)
+		os.Exit(1)
+	}
+
+	if *onionService && *torControl == "" {
+		logger.Error("--onion needs Tor's control port: set --tor-control")
+		os.Exit(1)
+	}
+	if target, _ := onionDefaults(listeners); *onionService && target == "" {
+		logger.Error("--onion needs a listener dedicated to it: add --listen with onion=true, such as 127.0.0.1:8336?onion=true")
+		os.Exit(1)
+	}
+	if *onionService && *apiKeysFile == "" && *tlsClientCA == "" {
+		logger.Error("--onion needs authentication on the onion listener: set --api-keys-file or --tls-client-ca")
+		os.Exit(1)
+	}
+
+	bound, err := bindListeners(listeners, tlsConfig != nil)
+	if err != nil {
+		logger.Errorf("Failed to listen: %v", err)
+		os.Exit(1)
+	}
+
+	// Load API keys before starting the node, so a bad keys file fails fast
+	var keyring *auth.Keyring
+	if *apiKeysFile != "" {
+		keyring, err = auth.Load(*apiKeysFile)
+		if err != nil {
+			logger.Errorf("Failed to load API keys: %v", err)
+			os.Exit(1)
+		}
+		logger.Infof("API key authentication enabled with %d keys", len(keyring.List()))
+	}
+
 	// Create neutrino node
 	nodeConfig := &neutrino.Config{
-		Network:      *network,
-		DataDir:      *dataDir,
-		TorProxy:     *torProxy,
-		ConnectPeers: *connectPeers,
-		MaxPeers:     8,
-		Logger:       backend,
-		LogLevel:     *logLevel,
+		Network:              *network,
+		DataDir:              *dataDir,
+		TorProxy:             *torProxy,
+		TorIsolation:         *torIsolation,
+		ConnectPeers:         *connectPeers,
+		AddPeers:             *addPeers,
+		DNSSeeds:             *dnsSeeds,
+		Checkpoints:          checkpoints,
+		PeersFile:            *peersFile,
+		OnlyNet:              *onlyNet,
+		MaxPeers:             *maxPeers,
+		BanDuration:          *banDuration,
+		MaxPeersPerGroup:     *maxPeersPerGroup,
+		ASNFile:              *asnFile,
+		StallTimeout:         *stallTimeout,
+		StallRecovery:        *stallRecovery,
+		FilterCacheSize:      *filterCacheMB << 20,
+		BlockMemoryCacheSize: *blockMemoryCacheMB << 20,
+		ScanWorkers:          *scanWorkers,
+		FilterBatchSize:      *filterBatchSize,
+		ScanMemoTTL:          *scanMemoTTL,
+		MaxRescanJobs:        *maxRescanJobs,
+		ScanMode:             neutrino.ScanMode(*scanMode),
+		Logger:               logLevels,
+		LogLevel:             *logLevel,
+		Readiness: neutrino.ReadinessConfig{
+			MinPeers:              *readyMinPeers,
+			RequireHeadersCurrent: *readyHeaders,
+			RequireTipCurrent:     *readyTipLag >= 0,
+			MaxTipLag:             int32(*readyTipLag),
+			RequireFiltersCurrent: *readyFilterLag >= 0,
+			MaxFilterLag:          int32(*readyFilterLag),
+			RequireHealthyScans:   *readyScans,
+		},
+		Fees: neutrino.FeeConfig{
+			Estimator:        *feeEstimator,
+			StaticRate:       *feeStaticRate,
+			Blocks:           *feeBlocks,
+			MempoolURL:       *feeMempoolURL,
+			BitcoindURL:      *feeBitcoindRPC,
+			BitcoindUser:     *feeBitcoindUser,
+			BitcoindPassword: *feeBitcoindPass,
+			CacheTTL:         *feeCacheTTL,
+			Fallback:         *feeFallback,
+		},
+		WatchFile:           *watchFile,
+		WebhooksFile:        *webhooksFile,
+		WalletRetention:     *walletRetention,
+		SpentRetention:      int32(*spentRetention),
+		BackupDir:           *backupDir,
+		CompactDBOnStart:    *compactDB,
+		DBBackend:           *dbBackend,
+		SQLiteJournalMode:   *sqliteJournalMode,
+		IndexDB:             *indexDB,
+		CheckHeadersOnStart: *checkHeaders,
+		BlockCacheMaxBytes:  int64(*blockCacheMB) << 20,
+		Retention: neutrino.RetentionConfig{
+			Enabled:  *retainBlocks,
+			MaxBytes: int64(*retainMaxMB) << 20,
+		},
+	}
+
+	// The scan cache is opened before the node, which only reads and writes
+	// it
+	var cache scancache.Cache
+	if *scanCacheURL != "" {
+		cache, err = scancache.Open(*scanCacheURL, *scanCacheTTL)
+		if err != nil {
+			logger.Errorf("Failed to open the scan cache: %v", err)
+			os.Exit(1)
+		}
+		nodeConfig.ScanCache = cache
+		logger.Infof("Scan cache: %s", scancache.Redact(*scanCacheURL))
 	}
 
 	node, err := neutrino.NewNode(nodeConfig)
@@ -86,35 +466,104 @@ func main() {
 	}
 
 	// Create API handler
-	apiLogger := backend.Logger("API")
-	apiLogger.SetLevel(level)
-	handler := api.NewHandler(node, apiLogger)
+	handler := api.NewHandler(node, logLevels.Logger("API"))
+	handler.SetBuildInfo(info)
+	handler.SetKeyring(keyring)
+	handler.SetRequireClientCert(*tlsClientCA != "")
+	rateLimits := api.RateLimitConfig{
+		Global:         *rateLimit,
+		GlobalBurst:    *rateLimitBurst,
+		PerClient:      *clientRateLimit,
+		PerClientBurst: *clientRateLimitBurst,
+	}
+	handler.SetRateLimits(rateLimits)
+	handler.SetTrustedProxies(proxies)
+	if index := node.AddressIndex(); index != nil {
+		handler.SetAddressIndex(index)
+	}
+	handler.SetConcurrencyLimits(api.ConcurrencyConfig{
+		MaxConcurrent: *maxConcurrentScans,
+		MaxQueued:     *maxQueuedScans,
+	})
+	timeouts := api.TimeoutConfig{
+		Read:    *httpReadTimeout,
+		Write:   *httpWriteTimeout,
+		Idle:    *httpIdleTimeout,
+		MaxScan: *maxScanTimeout,
+	}
+	handler.SetTimeouts(timeouts)
+	handler.SetMaxBodyBytes(int64(*maxBodyMB) << 20)
+	if *swaggerUI {
+		assets, err := api.SwaggerUIAssets(*swaggerUIDir)
+		if err != nil {
+			logger.Errorf("Invalid --swagger-ui-dir: %v", err)
+			os.Exit(1)
+		}
+		handler.SetSwaggerUI(assets)
+	}
 
 	// Set up router
 	router := mux.NewRouter()
 	handler.RegisterRoutes(router)
-
-	// Create HTTP server
-	server := &http.Server{
-		Addr:         *listen,
-		Handler:      router,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	mounted, err := api.MountAt(*basePath, router)
+	if err != nil {
+		logger.Errorf("Invalid base path: %v", err)
+		os.Exit(1)
 	}
 
-	// Start HTTP server in background
-	go func() {
-		logger.Infof("HTTP server listening on %s", *listen)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Errorf("HTTP server error: %v", err)
+	// Serve the API on every listener
+	servers := serveAPI(listeners, bound, mounted, tlsConfig, timeouts, logger)
+
+	// Publish the onion service once the API is served, so Tor never
+	// forwards connections nobody accepts
+	var onionSvc *onion.Service
+	if *onionService {
+		onionConfig := onion.Config{
+			ControlAddr:     *torControl,
+			ControlPassword: *torControlPassword,
+			KeyPath:         filepath.Join(*dataDir, "onion", "api.key"),
+			Port:            *onionPort,
+			Target:          *onionTarget,
 		}
-	}()
+		target, port := onionDefaults(listeners)
+		if onionConfig.Target == "" {
+			onionConfig.Target = target
+		}
+		if onionConfig.Port == 0 {
+			onionConfig.Port = port
+		}
+		onionSvc, err = onion.Publish(context.Background(), onionConfig, logger)
+		if err != nil {
+			logger.Errorf("Failed to publish onion service: %v", err)
+		} else {
+			logger.Infof("REST API published as onion service %s", onionSvc.Address())
+		}
+	}
 
-	// Wait for shutdown signal
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	// Wait for shutdown signal, reloading the configuration on SIGHUP, or
+	// for the node to ask for a restart
+	reloader := newReloader(reloadable{
+		logLevel:     *logLevel,
+		rateLimits:   rateLimits,
+		addPeers:     *addPeers,
+		webhooksFile: *webhooksFile,
+	}, logLevels, handler, node, logger)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	restart := false
+wait:
+	for {
+		select {
+		case sig := <-signals:
+			if sig != syscall.SIGHUP {
+				break wait
+			}
+			reloader.reload()
+		case <-node.Restart():
+			restart = true
+			break wait
+		}
+	}
 
 	logger.Info("Shutting down...")
 
@@ -122,21 +571,73 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
-		logger.Errorf("HTTP server shutdown error: %v", err)
+	if onionSvc != nil {
+		onionSvc.Close()
+	}
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Errorf("HTTP server shutdown error: %v", err)
+		}
+	}
+	if debugServer != nil {
+		debugServer.Close()
+	}
+	if acmeServer != nil {
+		acmeServer.Close()
 	}
 
 	if err := node.Stop(); err != nil {
 		logger.Errorf("Neutrino node shutdown error: %v", err)
 	}
+	if cache != nil {
+		cache.Close()
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Errorf("Tracing shutdown error: %v", err)
+	}
 
 	logger.Info("Shutdown complete")
+	if restart {
+		logger.Info("Restarting...")
+	}
+	if logFileWriter != nil {
+		logFileWriter.Close()
+	}
+	if restart {
+		if err := restartDaemon(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to restart: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// restartDaemon replaces the process with a new one started with the same
+// arguments and environment.
+func restartDaemon() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(executable, os.Args, os.Environ())
 }
 
-// getEnv returns the value of an environment variable or a default value.
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// runVersion implements the version subcommand.
+func runVersion(args []string) {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print build information as JSON")
+	fs.Parse(args)
+
+	info := buildinfo.New(version, commit, buildTime)
+	if !*asJSON {
+		fmt.Println(info.String())
+		return
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(info); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to encode build info: %v\n", err)
+		os.Exit(1)
 	}
-	return defaultValue
 }
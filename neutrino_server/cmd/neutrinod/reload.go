@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"slices"
+	"strings"
+
+	"github.com/btcsuite/btclog"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/api"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/config"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/neutrino"
+)
+
+// reloadableKeys are the options applied again on SIGHUP. Changes to any
+// other option of the config file only take effect on restart.
+var reloadableKeys = []string{
+	"LOG_LEVEL",
+	"RATE_LIMIT", "RATE_LIMIT_BURST", "CLIENT_RATE_LIMIT", "CLIENT_RATE_LIMIT_BURST",
+	"ADD_PEERS", "WEBHOOKS_FILE",
+}
+
+// reloadable are the settings SIGHUP reloads.
+type reloadable struct {
+	logLevel     string
+	rateLimits   api.RateLimitConfig
+	addPeers     string
+	webhooksFile string
+}
+
+// reloader applies the reloadable settings to the running daemon.
+type reloader struct {
+	logLevels *logging.SharedLevel
+	handler   *api.Handler
+	node      *neutrino.Node
+	logger    btclog.Logger
+
+	// known are the options of the config file looked up at startup, so
+	// the reloaded file can be checked for unknown ones.
+	known   []string
+	current reloadable
+}
+
+// newReloader returns a reloader of the settings in current. It has to be
+// created once every option has been looked up.
+func newReloader(current reloadable, logLevels *logging.SharedLevel, handler *api.Handler, node *neutrino.Node, logger btclog.Logger) *reloader {
+	return &reloader{
+		logLevels: logLevels,
+		handler:   handler,
+		node:      node,
+		logger:    logger,
+		known:     fileConfig.Known(),
+		current:   current,
+	}
+}
+
+// reload reads the config file and the peers and webhooks files again and
+// applies the reloadable settings. A config file that fails to load or has
+// invalid options is ignored, keeping the settings as they were.
+func (r *reloader) reload() {
+	r.logger.Info("Reloading configuration...")
+
+	next, err := r.settings()
+	if err != nil {
+		r.logger.Errorf("Configuration not reloaded: %v", err)
+		return
+	}
+
+	if next.logLevel != r.current.logLevel {
+		if level, ok := btclog.LevelFromString(next.logLevel); ok {
+			r.logLevels.SetLevel(level)
+			r.logger.Infof("Log level: %s", next.logLevel)
+		} else {
+			r.logger.Errorf("Invalid log level %q, keeping %s", next.logLevel, r.current.logLevel)
+			next.logLevel = r.current.logLevel
+		}
+	}
+	if next.rateLimits != r.current.rateLimits {
+		r.handler.SetRateLimits(next.rateLimits)
+		r.logger.Infof("Rate limits: %g/s (burst %d) in total, %g/s (burst %d) per client",
+			next.rateLimits.Global, next.rateLimits.GlobalBurst, next.rateLimits.PerClient, next.rateLimits.PerClientBurst)
+	}
+	if err := r.node.ReloadPeers(next.addPeers); err != nil {
+		r.logger.Errorf("Peers not reloaded: %v", err)
+		next.addPeers = r.current.addPeers
+	}
+	if err := r.node.ReloadWebhooks(next.webhooksFile); err != nil {
+		r.logger.Errorf("Webhooks not reloaded: %v", err)
+		next.webhooksFile = r.current.webhooksFile
+	}
+
+	r.current = next
+	r.logger.Info("Configuration reloaded")
+}
+
+// settings loads the config file again and returns the reloadable settings
+// it results in. Options given as flags keep their values, and environment
+// variables still override the file.
+func (r *reloader) settings() (reloadable, error) {
+	previous := fileConfig
+	if previous != nil {
+		values, err := config.Load(previous.Path())
+		if err != nil {
+			return reloadable{}, err
+		}
+		for _, key := range r.known {
+			values.Lookup(key)
+		}
+		fileConfig = values
+	}
+	invalidSettings = nil
+
+	flags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { flags[f.Name] = true })
+
+	next := r.current
+	if !flags["loglevel"] {
+		next.logLevel = getEnv("LOG_LEVEL", "info")
+	}
+	if !flags["rate-limit"] {
+		next.rateLimits.Global = getEnvFloat("RATE_LIMIT", 0)
+	}
+	if !flags["rate-limit-burst"] {
+		next.rateLimits.GlobalBurst = getEnvInt("RATE_LIMIT_BURST", 0)
+	}
+	if !flags["client-rate-limit"] {
+		next.rateLimits.PerClient = getEnvFloat("CLIENT_RATE_LIMIT", 0)
+	}
+	if !flags["client-rate-limit-burst"] {
+		next.rateLimits.PerClientBurst = getEnvInt("CLIENT_RATE_LIMIT_BURST", 0)
+	}
+	if !flags["addpeer"] {
+		next.addPeers = getEnv("ADD_PEERS", "")
+	}
+	if !flags["webhooks-file"] {
+		next.webhooksFile = getEnv("WEBHOOKS_FILE", "")
+	}
+
+	if previous != nil {
+		if err := checkConfigFile(); err != nil {
+			fileConfig = previous
+			return reloadable{}, err
+		}
+		var restart []string
+		for _, key := range previous.Changed(fileConfig) {
+			if !slices.Contains(reloadableKeys, key) {
+				restart = append(restart, key)
+			}
+		}
+		if len(restart) > 0 {
+			r.logger.Warnf("Changes to %s take effect on restart", strings.Join(restart, ", "))
+		}
+	}
+	return next, nil
+}
@@ -37,6 +37,8 @@ import (
 	"syscall"
 	"testing"
 	"time"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/client"
 )
 
 const (
@@ -73,49 +75,12 @@ var (
 	genesisTimestamp = int64(1231006505)
 )
 
-// StatusResponse represents the /v1/status response
-type StatusResponse struct {
-	Synced       bool  `json:"synced"`
-	BlockHeight  int32 `json:"block_height"`
-	FilterHeight int32 `json:"filter_height"`
-	Peers        int   `json:"peers"`
-}
-
-// BlockHeaderResponse represents the /v1/block/{height}/header response
-type BlockHeaderResponse struct {
-	Hash       string `json:"hash"`
-	Height     int64  `json:"height"`
-	Timestamp  int64  `json:"timestamp"`
-	Version    int32  `json:"version"`
-	PrevBlock  string `json:"prev_block"`
-	MerkleRoot string `json:"merkle_root"`
-	Bits       uint32 `json:"bits"`
-	Nonce      uint32 `json:"nonce"`
-}
-
 // PeersResponse represents the /v1/peers response
 type PeersResponse struct {
 	Peers []any `json:"peers"`
 	Count int   `json:"count"`
 }
 
-// UTXOsResponse represents the /v1/utxos response
-type UTXOsResponse struct {
-	UTXOs []struct {
-		TxID         string `json:"txid"`
-		Vout         uint32 `json:"vout"`
-		Value        int64  `json:"value"`
-		Address      string `json:"address"`
-		ScriptPubKey string `json:"scriptpubkey"`
-		Height       int32  `json:"height"`
-	} `json:"utxos"`
-}
-
-// WatchResponse represents the /v1/watch/address response
-type WatchResponse struct {
-	Status string `json:"status"`
-}
-
 // TestMainnetE2E is the main test function that sets up the server and runs all e2e tests
 func TestMainnetE2E(t *testing.T) {
 	if testing.Short() {
@@ -301,26 +266,19 @@ func waitForSync(t *testing.T, baseURL string) error {
 	t.Logf("Waiting for sync to height %d...", minBlockHeight)
 
 	deadline := time.Now().Add(syncTimeout)
-	client := &http.Client{Timeout: requestTimeout}
+	c := newClient(t, baseURL)
 	lastHeight := int32(0)
 
 	for time.Now().Before(deadline) {
-		resp, err := client.Get(baseURL + "/v1/status")
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		status, err := c.Status(ctx)
+		cancel()
 		if err != nil {
 			t.Logf("Status request failed: %v", err)
 			time.Sleep(syncPollInterval)
 			continue
 		}
 
-		var status StatusResponse
-		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
-			resp.Body.Close()
-			t.Logf("Failed to decode status: %v", err)
-			time.Sleep(syncPollInterval)
-			continue
-		}
-		resp.Body.Close()
-
 		// Log progress
 		if status.BlockHeight != lastHeight {
 			t.Logf("Sync progress: height=%d, peers=%d, synced=%v",
@@ -342,41 +300,29 @@ func waitForSync(t *testing.T, baseURL string) error {
 
 // HTTP helpers
 
-func getJSON(t *testing.T, baseURL, path string, result any) error {
+// newClient returns an API client of the server at baseURL.
+func newClient(t *testing.T, baseURL string) *client.Client {
 	t.Helper()
-	client := &http.Client{Timeout: requestTimeout}
-
-	resp, err := client.Get(baseURL + path)
+	c, err := client.New(baseURL, client.WithHTTPClient(&http.Client{Timeout: requestTimeout}))
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		t.Fatalf("Failed to create client: %v", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	return nil
+	return c
 }
 
-func postJSON(t *testing.T, baseURL, path string, body string, result any) error {
+func getJSON(t *testing.T, baseURL, path string, result any) error {
 	t.Helper()
 	client := &http.Client{Timeout: requestTimeout}
 
-	resp, err := client.Post(baseURL+path, "application/json", strings.NewReader(body))
+	resp, err := client.Get(baseURL + path)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, respBody)
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
@@ -389,8 +335,8 @@ func postJSON(t *testing.T, baseURL, path string, body string, result any) error
 // Individual test cases
 
 func testStatus(t *testing.T, baseURL string) {
-	var status StatusResponse
-	if err := getJSON(t, baseURL, "/v1/status", &status); err != nil {
+	status, err := newClient(t, baseURL).Status(context.Background())
+	if err != nil {
 		t.Fatalf("Failed to get status: %v", err)
 	}
 
@@ -420,8 +366,9 @@ func testPeers(t *testing.T, baseURL string) {
 }
 
 func testGenesisBlock(t *testing.T, baseURL string) {
-	var header BlockHeaderResponse
-	if err := getJSON(t, baseURL, "/v1/block/0/header", &header); err != nil {
+	c := newClient(t, baseURL)
+	header, err := c.GetBlockHeader(context.Background(), 0)
+	if err != nil {
 		t.Fatalf("Failed to get genesis block header: %v", err)
 	}
 
@@ -450,8 +397,9 @@ func testGenesisBlock(t *testing.T, baseURL string) {
 }
 
 func testBlock100000(t *testing.T, baseURL string) {
-	var header BlockHeaderResponse
-	if err := getJSON(t, baseURL, "/v1/block/100000/header", &header); err != nil {
+	c := newClient(t, baseURL)
+	header, err := c.GetBlockHeader(context.Background(), 100000)
+	if err != nil {
 		t.Fatalf("Failed to get block 100000 header: %v", err)
 	}
 
@@ -469,9 +417,11 @@ func testBlock100000(t *testing.T, baseURL string) {
 }
 
 func testBlock500000(t *testing.T, baseURL string) {
+	c := newClient(t, baseURL)
+
 	// First check if we're synced high enough
-	var status StatusResponse
-	if err := getJSON(t, baseURL, "/v1/status", &status); err != nil {
+	status, err := c.Status(context.Background())
+	if err != nil {
 		t.Fatalf("Failed to get status: %v", err)
 	}
 
@@ -479,8 +429,8 @@ func testBlock500000(t *testing.T, baseURL string) {
 		t.Skipf("Skipping block 500000 test - current height %d is too low", status.BlockHeight)
 	}
 
-	var header BlockHeaderResponse
-	if err := getJSON(t, baseURL, "/v1/block/500000/header", &header); err != nil {
+	header, err := c.GetBlockHeader(context.Background(), 500000)
+	if err != nil {
 		t.Fatalf("Failed to get block 500000 header: %v", err)
 	}
 
@@ -499,26 +449,22 @@ func testBlock500000(t *testing.T, baseURL string) {
 
 func testWatchAddress(t *testing.T, baseURL string) {
 	// Watch Satoshi's address
-	body := fmt.Sprintf(`{"address": "%s"}`, satoshiAddress)
-	var resp WatchResponse
-	if err := postJSON(t, baseURL, "/v1/watch/address", body, &resp); err != nil {
+	watched, err := newClient(t, baseURL).Watch(context.Background(), client.WatchRequest{Address: satoshiAddress})
+	if err != nil {
 		t.Fatalf("Failed to watch address: %v", err)
 	}
 
-	t.Logf("Watch address response: status=%s", resp.Status)
-
-	if resp.Status != "ok" {
-		t.Errorf("Expected status 'ok', got '%s'", resp.Status)
-	}
+	t.Logf("Watched addresses: %v", watched)
 }
 
 func testUTXOs(t *testing.T, baseURL string) {
 	// Query UTXOs for known addresses
 	// Note: Since we haven't done a full rescan, this may return empty
 	// but the endpoint should work without errors
-	body := fmt.Sprintf(`{"addresses": ["%s", "%s"]}`, satoshiAddress, halFinneyAddress)
-	var resp UTXOsResponse
-	if err := postJSON(t, baseURL, "/v1/utxos", body, &resp); err != nil {
+	resp, err := newClient(t, baseURL).GetUTXOs(context.Background(), client.UTXORequest{
+		Addresses: []string{satoshiAddress, halFinneyAddress},
+	})
+	if err != nil {
 		t.Fatalf("Failed to get UTXOs: %v", err)
 	}
 
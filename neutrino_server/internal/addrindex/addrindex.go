@@ -0,0 +1,557 @@
+// Package addrindex keeps an external index of the UTXOs and confirmed
+// transactions of watched addresses in a Postgres or SQLite database, which
+// answers address history and balance queries with indexed lookups and can
+// be shared by API replicas that run no node.
+package addrindex
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // Register the Postgres database/sql driver
+	_ "modernc.org/sqlite"             // Register the SQLite database/sql driver
+)
+
+// schema creates the index tables. It is plain SQL both Postgres and SQLite
+// run. A UTXO row stays once spent, with its spend, so that history covers
+// both sides of every transaction.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS index_meta (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS index_utxos (
+		txid            TEXT NOT NULL,
+		vout            BIGINT NOT NULL,
+		address         TEXT NOT NULL,
+		value           BIGINT NOT NULL,
+		script_pubkey   TEXT NOT NULL,
+		height          BIGINT NOT NULL,
+		spent           INTEGER NOT NULL DEFAULT 0,
+		spending_txid   TEXT,
+		spending_input  BIGINT,
+		spending_height BIGINT,
+		PRIMARY KEY (txid, vout)
+	)`,
+	`CREATE INDEX IF NOT EXISTS index_utxos_address ON index_utxos (address, height)`,
+	`CREATE INDEX IF NOT EXISTS index_utxos_spending ON index_utxos (spending_txid)`,
+	`CREATE TABLE IF NOT EXISTS index_transactions (
+		txid         TEXT PRIMARY KEY,
+		block_hash   TEXT NOT NULL,
+		block_height BIGINT NOT NULL,
+		block_time   BIGINT NOT NULL,
+		hex          TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS index_transactions_height ON index_transactions (block_height)`,
+}
+
+// HistoryLimit bounds the entries History returns at once.
+const HistoryLimit = 1000
+
+// UTXO is an output paying a watched address, with its spend once spent.
+type UTXO struct {
+	TxID           string `json:"txid"`
+	Vout           uint32 `json:"vout"`
+	Address        string `json:"address"`
+	Value          int64  `json:"value"`
+	ScriptPubKey   string `json:"scriptpubkey"`
+	Height         int32  `json:"height"`
+	Spent          bool   `json:"spent"`
+	SpendingTxID   string `json:"spending_txid,omitempty"`
+	SpendingInput  uint32 `json:"spending_input,omitempty"`
+	SpendingHeight int32  `json:"spending_height,omitempty"`
+}
+
+// Spend marks the UTXO TxID:Vout spent.
+type Spend struct {
+	TxID           string
+	Vout           uint32
+	SpendingTxID   string
+	SpendingInput  uint32
+	SpendingHeight int32
+}
+
+// Transaction is a confirmed transaction touching a watched address.
+type Transaction struct {
+	TxID        string
+	BlockHash   string
+	BlockHeight int32
+	BlockTime   int64
+	Hex         string
+}
+
+// HistoryEntry is a transaction in the history of an address, with what it
+// paid to and spent from the address. BlockHash and BlockTime are empty for
+// transactions the node has not indexed.
+type HistoryEntry struct {
+	TxID        string `json:"txid"`
+	BlockHeight int32  `json:"block_height"`
+	BlockHash   string `json:"block_hash,omitempty"`
+	BlockTime   int64  `json:"block_time,omitempty"`
+	Received    int64  `json:"received"`
+	Sent        int64  `json:"sent"`
+}
+
+// Balance sums up the UTXOs of an address. AsOfHeight is set for balances
+// as of a past block.
+type Balance struct {
+	Address    string `json:"address"`
+	Confirmed  int64  `json:"confirmed"`
+	UTXOCount  int    `json:"utxo_count"`
+	Received   int64  `json:"received"`
+	Sent       int64  `json:"sent"`
+	TxCount    int    `json:"tx_count"`
+	AsOfHeight *int32 `json:"as_of_height,omitempty"`
+}
+
+// DB is an address index database.
+type DB struct {
+	db       *sql.DB
+	postgres bool
+}
+
+// Open opens the index database named by dsn: a postgres:// or
+// postgresql:// URL, or sqlite: followed by the path of a SQLite file.
+func Open(dsn string) (*DB, error) {
+	var d DB
+	var err error
+	switch {
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		d.postgres = true
+		d.db, err = sql.Open("pgx", dsn)
+	case strings.HasPrefix(dsn, "sqlite:"):
+		path := strings.TrimPrefix(dsn, "sqlite:")
+		if path == "" {
+			return nil, errors.New("invalid index database sqlite: with no path")
+		}
+		d.db, err = sql.Open("sqlite", path+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)")
+	default:
+		return nil, fmt.Errorf("invalid index database %q: use postgres://... or sqlite:/path", redact(dsn))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := d.db.Ping(); err != nil {
+		d.db.Close()
+		return nil, fmt.Errorf("failed to connect to the index database: %w", err)
+	}
+	return &d, nil
+}
+
+// redact drops everything but the scheme of dsn, which may hold a password.
+func redact(dsn string) string {
+	if scheme, _, ok := strings.Cut(dsn, "://"); ok {
+		return scheme + "://..."
+	}
+	return dsn
+}
+
+// Close closes the database.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// rebind rewrites the ? placeholders of query into the $1, $2, ... ones
+// Postgres takes.
+func (d *DB) rebind(query string) string {
+	if !d.postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// Init creates the index tables if needed and claims the index for network,
+// refusing an index of another network.
+func (d *DB) Init(network string) error {
+	for _, stmt := range schema {
+		if _, err := d.db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create the index schema: %w", err)
+		}
+	}
+	current, err := d.Network()
+	switch {
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		return err
+	case err != nil:
+		_, err := d.db.Exec(d.rebind("INSERT INTO index_meta (key, value) VALUES ('network', ?)"), network)
+		return err
+	case current != network:
+		return fmt.Errorf("the index database holds %s data, not %s", current, network)
+	}
+	return nil
+}
+
+// Network returns the network the index holds data of, sql.ErrNoRows if no
+// node has initialized it.
+func (d *DB) Network() (string, error) {
+	var network string
+	err := d.db.QueryRow("SELECT value FROM index_meta WHERE key = 'network'").Scan(&network)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("failed to read the index network: %w", err)
+	}
+	return network, err
+}
+
+// SetTip records height as the chain tip the index is current to.
+func (d *DB) SetTip(height int32) error {
+	_, err := d.db.Exec(d.rebind(`INSERT INTO index_meta (key, value) VALUES ('tip', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`), strconv.Itoa(int(height)))
+	if err != nil {
+		return fmt.Errorf("failed to record the index tip: %w", err)
+	}
+	return nil
+}
+
+// Tip returns the chain tip the index is current to, -1 if no node has
+// recorded one.
+func (d *DB) Tip() (int32, error) {
+	var value string
+	err := d.db.QueryRow("SELECT value FROM index_meta WHERE key = 'tip'").Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the index tip: %w", err)
+	}
+	tip, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid index tip %q: %w", value, err)
+	}
+	return int32(tip), nil
+}
+
+// SetSyncToken records token as the one a node holds for the state it last
+// copied into the index. An empty token records none.
+func (d *DB) SetSyncToken(token string) error {
+	_, err := d.db.Exec(d.rebind(`INSERT INTO index_meta (key, value) VALUES ('sync_token', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`), token)
+	if err != nil {
+		return fmt.Errorf("failed to record the index sync token: %w", err)
+	}
+	return nil
+}
+
+// SyncToken returns the token recorded by SetSyncToken, "" if none is.
+func (d *DB) SyncToken() (string, error) {
+	var token string
+	err := d.db.QueryRow("SELECT value FROM index_meta WHERE key = 'sync_token'").Scan(&token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read the index sync token: %w", err)
+	}
+	return token, nil
+}
+
+// Apply adds utxos and txs, then marks spends, in one transaction. Rows
+// already indexed are overwritten, so changes may be applied again.
+func (d *DB) Apply(utxos []UTXO, spends []Spend, txs []Transaction) error {
+	if len(utxos) == 0 && len(spends) == 0 && len(txs) == 0 {
+		return nil
+	}
+	return d.update(func(tx *sql.Tx) error {
+		if err := d.putUTXOs(tx, utxos); err != nil {
+			return err
+		}
+		if err := d.putTransactions(tx, txs); err != nil {
+			return err
+		}
+		stmt, err := tx.Prepare(d.rebind(`UPDATE index_utxos
+			SET spent = 1, spending_txid = ?, spending_input = ?, spending_height = ?
+			WHERE txid = ? AND vout = ?`))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, spend := range spends {
+			if _, err := stmt.Exec(spend.SpendingTxID, int64(spend.SpendingInput), int64(spend.SpendingHeight), spend.TxID, int64(spend.Vout)); err != nil {
+				return fmt.Errorf("failed to index the spend of %s:%d: %w", spend.TxID, spend.Vout, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Replace replaces everything indexed with utxos and txs.
+func (d *DB) Replace(utxos []UTXO, txs []Transaction) error {
+	return d.update(func(tx *sql.Tx) error {
+		for _, table := range []string{"index_utxos", "index_transactions"} {
+			if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+				return fmt.Errorf("failed to clear %s: %w", table, err)
+			}
+		}
+		if err := d.putUTXOs(tx, utxos); err != nil {
+			return err
+		}
+		return d.putTransactions(tx, txs)
+	})
+}
+
+// RemoveUnspent drops the unspent UTXOs of addresses, which are no longer
+// watched.
+func (d *DB) RemoveUnspent(addresses []string) error {
+	if len(addresses) == 0 {
+		return nil
+	}
+	return d.update(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(d.rebind("DELETE FROM index_utxos WHERE address = ? AND spent = 0"))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, address := range addresses {
+			if _, err := stmt.Exec(address); err != nil {
+				return fmt.Errorf("failed to remove the UTXOs of %s: %w", address, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Rollback drops the UTXOs and transactions of blocks above fork and undoes
+// their spends.
+func (d *DB) Rollback(fork int32) error {
+	return d.update(func(tx *sql.Tx) error {
+		stmts := []string{
+			"DELETE FROM index_utxos WHERE height > ?",
+			`UPDATE index_utxos SET spent = 0, spending_txid = NULL, spending_input = NULL, spending_height = NULL
+				WHERE spent = 1 AND spending_height > ?`,
+			"DELETE FROM index_transactions WHERE block_height > ?",
+		}
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(d.rebind(stmt), int64(fork)); err != nil {
+				return fmt.Errorf("failed to roll back the index to %d: %w", fork, err)
+			}
+		}
+		return nil
+	})
+}
+
+// update runs fn in a transaction.
+func (d *DB) update(fn func(tx *sql.Tx) error) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// putUTXOs writes utxos in tx.
+func (d *DB) putUTXOs(tx *sql.Tx, utxos []UTXO) error {
+	if len(utxos) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare(d.rebind(`INSERT INTO index_utxos
+		(txid, vout, address, value, script_pubkey, height, spent, spending_txid, spending_input, spending_height)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (txid, vout) DO UPDATE SET
+			address = excluded.address, value = excluded.value, script_pubkey = excluded.script_pubkey,
+			height = excluded.height, spent = excluded.spent, spending_txid = excluded.spending_txid,
+			spending_input = excluded.spending_input, spending_height = excluded.spending_height`))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, utxo := range utxos {
+		spent := 0
+		var spendingTxID sql.NullString
+		var spendingInput, spendingHeight sql.NullInt64
+		if utxo.Spent {
+			spent = 1
+			spendingTxID = sql.NullString{String: utxo.SpendingTxID, Valid: true}
+			spendingInput = sql.NullInt64{Int64: int64(utxo.SpendingInput), Valid: true}
+			spendingHeight = sql.NullInt64{Int64: int64(utxo.SpendingHeight), Valid: true}
+		}
+		_, err := stmt.Exec(utxo.TxID, int64(utxo.Vout), utxo.Address, utxo.Value, utxo.ScriptPubKey, int64(utxo.Height),
+			spent, spendingTxID, spendingInput, spendingHeight)
+		if err != nil {
+			return fmt.Errorf("failed to index UTXO %s:%d: %w", utxo.TxID, utxo.Vout, err)
+		}
+	}
+	return nil
+}
+
+// putTransactions writes txs in tx.
+func (d *DB) putTransactions(tx *sql.Tx, txs []Transaction) error {
+	if len(txs) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare(d.rebind(`INSERT INTO index_transactions (txid, block_hash, block_height, block_time, hex)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (txid) DO UPDATE SET
+			block_hash = excluded.block_hash, block_height = excluded.block_height,
+			block_time = excluded.block_time, hex = excluded.hex`))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, t := range txs {
+		if _, err := stmt.Exec(t.TxID, t.BlockHash, int64(t.BlockHeight), t.BlockTime, t.Hex); err != nil {
+			return fmt.Errorf("failed to index transaction %s: %w", t.TxID, err)
+		}
+	}
+	return nil
+}
+
+// historyQuery returns the query selecting the transactions paying to or
+// spending from a set of addresses, with the amounts they moved, and its
+// arguments. A transaction moving coins between the addresses is one entry.
+func historyQuery(addresses []string) (string, []any) {
+	in := "?" + strings.Repeat(", ?", len(addresses)-1)
+	query := `SELECT entries.txid AS txid, entries.height AS height,
+		SUM(entries.received) AS received, SUM(entries.sent) AS sent
+	FROM (
+		SELECT txid, height, value AS received, 0 AS sent FROM index_utxos WHERE address IN (` + in + `)
+		UNION ALL
+		SELECT spending_txid, spending_height, 0, value FROM index_utxos
+			WHERE address IN (` + in + `) AND spent = 1 AND spending_txid IS NOT NULL AND spending_txid <> ''
+	) AS entries
+	GROUP BY entries.txid, entries.height`
+	args := make([]any, 0, 2*len(addresses))
+	for range 2 {
+		for _, address := range addresses {
+			args = append(args, address)
+		}
+	}
+	return query, args
+}
+
+// History returns up to limit transactions of address, newest first,
+// skipping the first offset.
+func (d *DB) History(address string, limit, offset int) ([]HistoryEntry, error) {
+	entries, err := d.history([]string{address}, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the history of %s: %w", address, err)
+	}
+	return entries, nil
+}
+
+// HistoryOf returns up to limit transactions of any of addresses, such as
+// those of a wallet, newest first, skipping the first offset. Received and
+// Sent are the amounts a transaction moved to and from all of them.
+func (d *DB) HistoryOf(addresses []string, limit, offset int) ([]HistoryEntry, error) {
+	entries, err := d.history(addresses, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the history of %d addresses: %w", len(addresses), err)
+	}
+	return entries, nil
+}
+
+// history returns a page of the transactions of addresses.
+func (d *DB) history(addresses []string, limit, offset int) ([]HistoryEntry, error) {
+	if len(addresses) == 0 {
+		return []HistoryEntry{}, nil
+	}
+	if limit <= 0 || limit > HistoryLimit {
+		limit = HistoryLimit
+	}
+	history, args := historyQuery(addresses)
+	query := `SELECT h.txid, h.height, h.received, h.sent, t.block_hash, t.block_time
+		FROM (` + history + `) AS h
+		LEFT JOIN index_transactions t ON t.txid = h.txid
+		ORDER BY h.height DESC, h.txid
+		LIMIT ? OFFSET ?`
+	rows, err := d.db.Query(d.rebind(query), append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []HistoryEntry{}
+	for rows.Next() {
+		var entry HistoryEntry
+		var height int64
+		var blockHash sql.NullString
+		var blockTime sql.NullInt64
+		if err := rows.Scan(&entry.TxID, &height, &entry.Received, &entry.Sent, &blockHash, &blockTime); err != nil {
+			return nil, err
+		}
+		entry.BlockHeight = int32(height)
+		entry.BlockHash = blockHash.String
+		entry.BlockTime = blockTime.Int64
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Balance returns the balance of address.
+func (d *DB) Balance(address string) (*Balance, error) {
+	return d.balance(address, math.MaxInt32)
+}
+
+// BalanceAt returns the balance of address as of the block at height,
+// replaying the outputs and spends indexed up to it. Outputs of addresses
+// that were unwatched, and dropped by RemoveUnspent, are not counted.
+func (d *DB) BalanceAt(address string, height int32) (*Balance, error) {
+	balance, err := d.balance(address, height)
+	if err != nil {
+		return nil, err
+	}
+	balance.AsOfHeight = &height
+	return balance, nil
+}
+
+// balance returns the balance of address counting the blocks up to height.
+// Every spent row has a spending height, so an output counts as unspent if
+// it was spent above height.
+func (d *DB) balance(address string, height int32) (*Balance, error) {
+	balance := &Balance{Address: address}
+	err := d.db.QueryRow(d.rebind(`SELECT
+			COALESCE(SUM(CASE WHEN spent = 0 OR spending_height > ? THEN value ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN spent = 0 OR spending_height > ? THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(value), 0),
+			COALESCE(SUM(CASE WHEN spent = 1 AND spending_height <= ? THEN value ELSE 0 END), 0)
+		FROM index_utxos WHERE address = ? AND height <= ?`), int64(height), int64(height), int64(height), address, int64(height)).
+		Scan(&balance.Confirmed, &balance.UTXOCount, &balance.Received, &balance.Sent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the balance of %s: %w", address, err)
+	}
+	history, args := historyQuery([]string{address})
+	err = d.db.QueryRow(d.rebind("SELECT COUNT(*) FROM ("+history+") AS h WHERE h.height <= ?"), append(args, int64(height))...).
+		Scan(&balance.TxCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count the transactions of %s: %w", address, err)
+	}
+	return balance, nil
+}
+
+// UTXOs returns the unspent outputs of address, oldest first.
+func (d *DB) UTXOs(address string) ([]UTXO, error) {
+	rows, err := d.db.Query(d.rebind(`SELECT txid, vout, address, value, script_pubkey, height
+		FROM index_utxos WHERE address = ? AND spent = 0 ORDER BY height, txid, vout`), address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the UTXOs of %s: %w", address, err)
+	}
+	defer rows.Close()
+
+	utxos := []UTXO{}
+	for rows.Next() {
+		var utxo UTXO
+		var vout, height int64
+		if err := rows.Scan(&utxo.TxID, &vout, &utxo.Address, &utxo.Value, &utxo.ScriptPubKey, &height); err != nil {
+			return nil, err
+		}
+		utxo.Vout, utxo.Height = uint32(vout), int32(height)
+		utxos = append(utxos, utxo)
+	}
+	return utxos, rows.Err()
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/addrindex"
+)
+
+// defaultHistoryLimit is the number of history entries returned when the
+// request sets no limit.
+const defaultHistoryLimit = 100
+
+// AddressIndex answers address queries from an external address index, see
+// addrindex.DB.
+type AddressIndex interface {
+	History(address string, limit, offset int) ([]addrindex.HistoryEntry, error)
+	HistoryOf(addresses []string, limit, offset int) ([]addrindex.HistoryEntry, error)
+	Balance(address string) (*addrindex.Balance, error)
+	BalanceAt(address string, height int32) (*addrindex.Balance, error)
+	Tip() (int32, error)
+	UTXOs(address string) ([]addrindex.UTXO, error)
+}
+
+// SetAddressIndex sets the address index the /v1/address endpoints query.
+// Without one they return 404.
+func (h *Handler) SetAddressIndex(index AddressIndex) {
+	h.index = index
+}
+
+// RegisterIndexRoutes registers the routes an API replica without a node
+// serves from the address index alone.
+func (h *Handler) RegisterIndexRoutes(r *mux.Router) {
+	r.Use(h.requestLogMiddleware, h.tracingMiddleware, h.metricsMiddleware, h.authMiddleware, h.rateLimitMiddleware, h.bodyLimitMiddleware)
+
+	r.HandleFunc("/healthz", h.handleHealthz).Methods("GET")
+	r.HandleFunc("/metrics", h.handleMetrics).Methods("GET")
+	r.HandleFunc("/v1/info", h.handleGetInfo).Methods("GET")
+	h.registerDocRoutes(r)
+	h.registerAddressRoutes(r)
+}
+
+// registerAddressRoutes registers the address index endpoints.
+func (h *Handler) registerAddressRoutes(r *mux.Router) {
+	r.HandleFunc("/v1/address/{address}/history", h.handleGetAddressHistory).Methods("GET")
+	r.HandleFunc("/v1/address/{address}/balance", h.handleGetAddressBalance).Methods("GET")
+	r.HandleFunc("/v1/address/{address}/utxos", h.handleGetAddressUTXOs).Methods("GET")
+}
+
+// requireIndex writes a 404 and returns false if no address index is
+// configured.
+func (h *Handler) requireIndex(w http.ResponseWriter) bool {
+	if h.index == nil {
+		h.errorResponse(w, http.StatusNotFound, "no address index is configured")
+		return false
+	}
+	return true
+}
+
+// Address history endpoint
+func (h *Handler) handleGetAddressHistory(w http.ResponseWriter, r *http.Request) {
+	if !h.requireIndex(w) {
+		return
+	}
+	address := mux.Vars(r)["address"]
+	limit, offset, err := pageParams(r, defaultHistoryLimit, addrindex.HistoryLimit)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	history, err := h.index.History(address, limit, offset)
+	if err != nil {
+		h.logger.Errorf("Address index query failed: %v", err)
+		h.errorResponse(w, http.StatusInternalServerError, "address index query failed")
+		return
+	}
+	h.jsonResponse(w, map[string]any{
+		"address":      address,
+		"transactions": history,
+		"limit":        limit,
+		"offset":       offset,
+	})
+}
+
+// Wallet history endpoint. It merges the address index histories of the
+// wallet's addresses, so it needs both the node and the index.
+func (h *Handler) handleGetWalletHistory(w http.ResponseWriter, r *http.Request) {
+	if !h.requireIndex(w) {
+		return
+	}
+	wallet := mux.Vars(r)["id"]
+	limit, offset, err := pageParams(r, defaultHistoryLimit, addrindex.HistoryLimit)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	addresses, err := h.node.WalletAddresses(wallet)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	history, err := h.index.HistoryOf(addresses, limit, offset)
+	if err != nil {
+		h.logger.Errorf("Address index query failed: %v", err)
+		h.errorResponse(w, http.StatusInternalServerError, "address index query failed")
+		return
+	}
+	h.jsonResponse(w, map[string]any{
+		"wallet":       wallet,
+		"transactions": history,
+		"limit":        limit,
+		"offset":       offset,
+	})
+}
+
+// Address balance endpoint. With at_height it returns the balance as of
+// that block, for accounting snapshots. Heights above the indexed tip are
+// refused, as their balance is not known yet.
+func (h *Handler) handleGetAddressBalance(w http.ResponseWriter, r *http.Request) {
+	if !h.requireIndex(w) {
+		return
+	}
+	address := mux.Vars(r)["address"]
+	var balance *addrindex.Balance
+	var err error
+	if at := r.URL.Query().Get("at_height"); at != "" {
+		height, parseErr := strconv.ParseInt(at, 10, 32)
+		if parseErr != nil || height < 0 {
+			h.errorResponse(w, http.StatusBadRequest, "invalid at_height")
+			return
+		}
+		tip, tipErr := h.index.Tip()
+		if tipErr != nil {
+			h.logger.Errorf("Address index query failed: %v", tipErr)
+			h.errorResponse(w, http.StatusInternalServerError, "address index query failed")
+			return
+		}
+		if int32(height) > tip {
+			h.errorResponse(w, http.StatusBadRequest, fmt.Sprintf("at_height %d is above the indexed tip %d", height, tip))
+			return
+		}
+		balance, err = h.index.BalanceAt(address, int32(height))
+	} else {
+		balance, err = h.index.Balance(address)
+	}
+	if err != nil {
+		h.logger.Errorf("Address index query failed: %v", err)
+		h.errorResponse(w, http.StatusInternalServerError, "address index query failed")
+		return
+	}
+	h.jsonResponse(w, balance)
+}
+
+// Address UTXOs endpoint
+func (h *Handler) handleGetAddressUTXOs(w http.ResponseWriter, r *http.Request) {
+	if !h.requireIndex(w) {
+		return
+	}
+	address := mux.Vars(r)["address"]
+	order, err := parseUTXOOrder(r)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	utxos, err := h.index.UTXOs(address)
+	if err != nil {
+		h.logger.Errorf("Address index query failed: %v", err)
+		h.errorResponse(w, http.StatusInternalServerError, "address index query failed")
+		return
+	}
+	sortUTXOs(utxos, order, func(u addrindex.UTXO) utxoSortKey {
+		return utxoSortKey{value: u.Value, height: u.Height, txid: u.TxID, vout: u.Vout}
+	})
+	h.jsonResponse(w, map[string]any{
+		"address": address,
+		"utxos":   utxos,
+	})
+}
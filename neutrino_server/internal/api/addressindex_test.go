@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+	"github.com/gorilla/mux"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/addrindex"
+)
+
+// newTestIndex opens an address index holding two transactions of addr.
+func newTestIndex(t *testing.T, addr string) *addrindex.DB {
+	t.Helper()
+	index, err := addrindex.Open("sqlite:" + filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { index.Close() })
+	if err := index.Init("regtest"); err != nil {
+		t.Fatal(err)
+	}
+	err = index.Apply([]addrindex.UTXO{
+		{TxID: "aa", Vout: 0, Address: addr, Value: 5000, ScriptPubKey: "0014aa", Height: 10},
+		{TxID: "bb", Vout: 1, Address: addr, Value: 1000, ScriptPubKey: "0014aa", Height: 12},
+	}, []addrindex.Spend{{TxID: "aa", Vout: 0, SpendingTxID: "bb", SpendingHeight: 12}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := index.SetTip(20); err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func TestAddressIndexRoutes(t *testing.T) {
+	const addr = "bcrt1qindexed"
+	handler := NewHandler(nil, btclog.Disabled)
+	handler.SetAddressIndex(newTestIndex(t, addr))
+	router := mux.NewRouter()
+	handler.RegisterIndexRoutes(router)
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{name: "history", path: "/v1/address/" + addr + "/history", wantCode: http.StatusOK, wantBody: `"txid":"bb"`},
+		{name: "history page", path: "/v1/address/" + addr + "/history?limit=1&offset=1", wantCode: http.StatusOK, wantBody: `"txid":"aa"`},
+		{name: "invalid limit", path: "/v1/address/" + addr + "/history?limit=5000", wantCode: http.StatusBadRequest, wantBody: "invalid limit"},
+		{name: "invalid offset", path: "/v1/address/" + addr + "/history?offset=-1", wantCode: http.StatusBadRequest, wantBody: "invalid offset"},
+		{name: "balance", path: "/v1/address/" + addr + "/balance", wantCode: http.StatusOK, wantBody: `"confirmed":1000`},
+		{name: "balance at height", path: "/v1/address/" + addr + "/balance?at_height=11", wantCode: http.StatusOK, wantBody: `"confirmed":5000`},
+		{name: "balance at genesis", path: "/v1/address/" + addr + "/balance?at_height=0", wantCode: http.StatusOK, wantBody: `"as_of_height":0`},
+		{name: "balance at the tip", path: "/v1/address/" + addr + "/balance?at_height=20", wantCode: http.StatusOK, wantBody: `"as_of_height":20`},
+		{name: "balance above the tip", path: "/v1/address/" + addr + "/balance?at_height=21", wantCode: http.StatusBadRequest, wantBody: "above the indexed tip 20"},
+		{name: "invalid at_height", path: "/v1/address/" + addr + "/balance?at_height=-1", wantCode: http.StatusBadRequest, wantBody: "invalid at_height"},
+		{name: "utxos", path: "/v1/address/" + addr + "/utxos", wantCode: http.StatusOK, wantBody: `"vout":1`},
+		{name: "sorted utxos", path: "/v1/address/" + addr + "/utxos?sort=value&order=desc", wantCode: http.StatusOK, wantBody: `"vout":1`},
+		{name: "invalid utxo sort", path: "/v1/address/" + addr + "/utxos?sort=age", wantCode: http.StatusBadRequest, wantBody: "invalid sort"},
+		{name: "metrics without a node", path: "/metrics", wantCode: http.StatusOK, wantBody: "http_requests_total"},
+		{name: "node routes are not served", path: "/v1/status", wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+			if rr.Code != tt.wantCode {
+				t.Fatalf("GET %s returned %d, want %d: %s", tt.path, rr.Code, tt.wantCode, rr.Body)
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Errorf("GET %s = %s, want it to contain %s", tt.path, rr.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAddressRoutesWithoutIndex(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.Disabled)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/v1/address/bcrt1qany/balance", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("GET balance returned %d, want 404", rr.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body["error"] != "no address index is configured" {
+		t.Errorf("GET balance = %s, want a missing index error", rr.Body)
+	}
+}
+
+func TestWalletHistory(t *testing.T) {
+	// The mock node's hot wallet holds bcrt1qmany
+	handler := NewHandler(&mockNode{}, btclog.Disabled)
+	handler.SetAddressIndex(newTestIndex(t, "bcrt1qmany"))
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{name: "history", path: "/v1/wallets/hot/history", wantCode: http.StatusOK, wantBody: `"txid":"bb"`},
+		{name: "history page", path: "/v1/wallets/hot/history?limit=1&offset=1", wantCode: http.StatusOK, wantBody: `"txid":"aa"`},
+		{name: "invalid limit", path: "/v1/wallets/hot/history?limit=0", wantCode: http.StatusBadRequest, wantBody: "invalid limit"},
+		{name: "unknown wallet", path: "/v1/wallets/missing/history", wantCode: http.StatusNotFound, wantBody: "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+			if rr.Code != tt.wantCode {
+				t.Fatalf("GET %s returned %d, want %d: %s", tt.path, rr.Code, tt.wantCode, rr.Body)
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Errorf("GET %s = %s, want it to contain %s", tt.path, rr.Body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,364 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/auth"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/neutrino"
+)
+
+// apiKeyHeader carries an API key for clients that cannot set a bearer
+// token.
+const apiKeyHeader = "X-API-Key"
+
+// publicRoutes are served without an API key, so orchestrator health probes
+// need no credentials and clients can fetch the API description before they
+// have a key.
+var publicRoutes = map[string]bool{
+	"/healthz":      true,
+	"/readyz":       true,
+	openAPIPath:     true,
+	"/docs":         true,
+	"/docs/{asset}": true,
+}
+
+// routeScopes are the scopes of routes that do not follow the defaults of
+// requiredScope.
+var routeScopes = map[routeKey]auth.Scope{
+	// Queries sent as POST for their request bodies
+	{"POST", "/v1/script/decode"}: auth.ScopeRead,
+	{"POST", "/v1/verifymessage"}: auth.ScopeRead,
+	{"POST", "/v1/utxos"}:         auth.ScopeRead,
+
+	// Queries scanning filters and blocks over unbounded ranges, which a
+	// read key could saturate the node with
+	{"GET", "/v1/utxo/{txid}/{vout}"}: auth.ScopeRescan,
+	{"POST", "/v1/utxos/check"}:       auth.ScopeRescan,
+	{"POST", "/v1/filters/match"}:     auth.ScopeRescan,
+	{"POST", "/v1/psbt/enrich"}:       auth.ScopeRescan,
+
+	{"POST", "/v1/tx/broadcast"}: auth.ScopeBroadcast,
+
+	// Watching starts rescans
+	{"POST", "/v1/rescan"}:                         auth.ScopeRescan,
+	{"POST", "/v1/tx/{txid}/track"}:                auth.ScopeRescan,
+	{"DELETE", "/v1/tx/{txid}/track"}:              auth.ScopeRescan,
+	{"POST", "/v1/watch/address"}:                  auth.ScopeRescan,
+	{"DELETE", "/v1/watch/address/{address}"}:      auth.ScopeRescan,
+	{"POST", "/v1/watch/outpoint"}:                 auth.ScopeRescan,
+	{"DELETE", "/v1/watch/outpoint/{txid}/{vout}"}: auth.ScopeRescan,
+	{"POST", "/v1/watch/script"}:                   auth.ScopeRescan,
+	{"POST", "/v1/watch/xpub"}:                     auth.ScopeRescan,
+	{"DELETE", "/v1/watch/xpub/{id}"}:              auth.ScopeRescan,
+	{"POST", "/v1/experimental/patterns"}:          auth.ScopeRescan,
+	{"DELETE", "/v1/experimental/patterns/{id}"}:   auth.ScopeRescan,
+
+	{"GET", "/v1/admin/keys"}:          auth.ScopeAdmin,
+	{"GET", "/v1/admin/bans"}:          auth.ScopeAdmin,
+	{"GET", "/v1/admin/backup/{name}"}: auth.ScopeAdmin,
+	{"GET", "/v1/admin/cache"}:         auth.ScopeAdmin,
+}
+
+// requiredScope returns the scope a request to route needs. Unlisted GET
+// routes are queries and need read; any other unlisted route changes state
+// and needs admin, so new endpoints are never open to narrower keys by
+// accident.
+func requiredScope(method, route string) auth.Scope {
+	if scope, ok := routeScopes[routeKey{method: method, route: route}]; ok {
+		return scope
+	}
+	if method == http.MethodGet || method == http.MethodHead {
+		return auth.ScopeRead
+	}
+	return auth.ScopeAdmin
+}
+
+// SetKeyring enables API key authentication with the keys of keyring.
+// Without one every request is allowed.
+func (h *Handler) SetKeyring(keyring *auth.Keyring) {
+	h.keys = keyring
+}
+
+// SetRequireClientCert makes requests authenticate with a TLS client
+// certificate verified against the server's client CAs, or with an API key
+// if a keyring is also set.
+func (h *Handler) SetRequireClientCert(require bool) {
+	h.clientCerts = require
+}
+
+// clientIdentity returns the identity of the verified client certificate
+// of r: its common name, or its first DNS name or email address if it has
+// none. It returns "" for requests without a verified certificate.
+func clientIdentity(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	}
+	return cert.SerialNumber.String()
+}
+
+// certificateNames returns the names the verified client certificate of r
+// is issued to, which the keyring gives scopes to: its common name, DNS
+// names and email addresses.
+func certificateNames(r *http.Request) []string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	var names []string
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	names = append(names, cert.DNSNames...)
+	return append(names, cert.EmailAddresses...)
+}
+
+// localClient reports whether r comes from a client on this host: over a
+// unix socket, or from a loopback address once trusted proxies are seen
+// through. Only those are served without authentication by auth=none
+// listeners, whatever address they are bound to, unless the listener is
+// set to serve remote clients too.
+func (h *Handler) localClient(r *http.Request, listener Listener) bool {
+	if listener.Network == "unix" || listener.Remote {
+		return true
+	}
+	ip := net.ParseIP(h.clientIP(r))
+	return ip != nil && ip.IsLoopback()
+}
+
+// clientContextKey is the context key of the authenticated client.
+type clientContextKey struct{}
+
+// withClient returns r with its context carrying client, the API key or
+// client certificate it was authenticated with.
+func withClient(r *http.Request, client string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), clientContextKey{}, client))
+}
+
+// requestClient returns the client r was authenticated as, or "" if
+// authentication is not enabled.
+func requestClient(r *http.Request) string {
+	client, _ := r.Context().Value(clientContextKey{}).(string)
+	return client
+}
+
+// walletsContextKey is the context key of the wallets the API key of a
+// request is bound to.
+type walletsContextKey struct{}
+
+// withWallets returns r with its context carrying wallets, those its API
+// key is bound to.
+func withWallets(r *http.Request, wallets []string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), walletsContextKey{}, wallets))
+}
+
+// requestWallets returns the wallets the API key of r is bound to, or nil
+// if it may address every wallet.
+func requestWallets(r *http.Request) []string {
+	wallets, _ := r.Context().Value(walletsContextKey{}).([]string)
+	return wallets
+}
+
+// allowsWallet reports whether the API key of r may address wallet, the
+// default wallet if empty.
+func allowsWallet(r *http.Request, wallet string) bool {
+	wallets := requestWallets(r)
+	return wallets == nil || slices.Contains(wallets, cmp.Or(wallet, neutrino.DefaultWallet))
+}
+
+// requireWallet answers r with 403 unless its API key may address wallet.
+func (h *Handler) requireWallet(w http.ResponseWriter, r *http.Request, wallet string) bool {
+	if !allowsWallet(r, wallet) {
+		h.errorResponse(w, http.StatusForbidden, "API key is not bound to wallet "+cmp.Or(wallet, neutrino.DefaultWallet))
+		return false
+	}
+	return true
+}
+
+// addressedWallet returns the wallet a request to route names in its path,
+// or in its wallet query parameter, and whether it names one.
+func addressedWallet(r *http.Request, route string) (string, bool) {
+	if strings.HasPrefix(route, "/v1/wallets/{id}") {
+		return mux.Vars(r)["id"], true
+	}
+	if wallet := r.URL.Query().Get("wallet"); wallet != "" {
+		return wallet, true
+	}
+	return "", false
+}
+
+// authMiddleware rejects requests without a valid API key or client
+// certificate with 401, and requests whose key lacks the route's scope or
+// whose listener does not serve it with 403. A key bound to wallets is
+// also refused the wallets it is not bound to, named in the path or the
+// wallet query parameter; handlers check those in request bodies. A
+// verified client certificate has the scopes the keyring lists for it, or
+// every scope without a keyring. Keys are taken from a bearer token or the
+// X-API-Key header.
+func (h *Handler) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+		if publicRoutes[route] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		listener := requestListener(r)
+		if scope := requiredScope(r.Method, route); !listener.serves(scope) {
+			h.errorResponse(w, http.StatusForbidden, "endpoints of the "+string(scope)+" scope are not served on this address")
+			return
+		}
+		if (h.keys == nil && !h.clientCerts) || (listener.NoAuth && h.localClient(r, listener)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if names := certificateNames(r); h.clientCerts && len(names) > 0 {
+			client := "cert:" + clientIdentity(r)
+			if h.keys == nil {
+				next.ServeHTTP(w, withClient(r, client))
+				return
+			}
+			key, ok := h.keys.AuthenticateCertificate(names)
+			if !ok {
+				h.errorResponse(w, http.StatusForbidden, "client certificate "+clientIdentity(r)+" is not listed in the API keys file")
+				return
+			}
+			if r, ok = h.authorize(w, r, route, key); ok {
+				next.ServeHTTP(w, withClient(r, client))
+			}
+			return
+		}
+		if h.keys == nil {
+			h.errorResponse(w, http.StatusUnauthorized, "client certificate required")
+			return
+		}
+
+		secret := r.Header.Get(apiKeyHeader)
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			secret = strings.TrimSpace(bearer)
+		}
+		if secret == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="neutrinod"`)
+			h.errorResponse(w, http.StatusUnauthorized, "API key required")
+			return
+		}
+		key, ok := h.keys.Authenticate(secret)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="neutrinod", error="invalid_token"`)
+			h.errorResponse(w, http.StatusUnauthorized, "invalid API key")
+			return
+		}
+
+		if r, ok = h.authorize(w, r, route, key); ok {
+			next.ServeHTTP(w, withClient(r, "key:"+key.Name))
+		}
+	})
+}
+
+// authorize answers r with 403 unless key has the scope of route and may
+// address the wallet r names. It returns r carrying the wallets key is
+// bound to.
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request, route string, key auth.KeyInfo) (*http.Request, bool) {
+	if scope := requiredScope(r.Method, route); !key.Allows(scope) {
+		h.errorResponse(w, http.StatusForbidden, "API key "+key.Name+" lacks the "+string(scope)+" scope")
+		return r, false
+	}
+	if len(key.Wallets) > 0 {
+		r = withWallets(r, key.Wallets)
+		if wallet, ok := addressedWallet(r, route); ok && !h.requireWallet(w, r, wallet) {
+			return r, false
+		}
+	}
+	return r, true
+}
+
+// createAPIKeyRequest is the body of POST /v1/admin/keys.
+type createAPIKeyRequest struct {
+	Name    string       `json:"name"`
+	Scopes  []auth.Scope `json:"scopes"`
+	Wallets []string     `json:"wallets"`
+}
+
+// Create API key endpoint
+func (h *Handler) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	if h.keys == nil {
+		h.errorResponse(w, http.StatusNotFound, "API key authentication is not enabled")
+		return
+	}
+
+	var req createAPIKeyRequest
+	if err := decodeBody(r, &req); err != nil {
+		h.bodyErrorResponse(w, err)
+		return
+	}
+
+	secret, key, err := h.keys.Create(req.Name, req.Scopes, req.Wallets)
+	switch {
+	case errors.Is(err, auth.ErrInvalidKey):
+		h.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, auth.ErrKeyExists):
+		h.errorResponse(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		h.errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.jsonResponse(w, map[string]any{
+		"name":       key.Name,
+		"scopes":     key.Scopes,
+		"wallets":    key.Wallets,
+		"created_at": key.CreatedAt,
+		"key":        secret,
+	})
+}
+
+// List API keys endpoint
+func (h *Handler) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if h.keys == nil {
+		h.errorResponse(w, http.StatusNotFound, "API key authentication is not enabled")
+		return
+	}
+
+	h.jsonResponse(w, map[string]any{
+		"keys": h.keys.List(),
+	})
+}
+
+// Delete API key endpoint
+func (h *Handler) handleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	if h.keys == nil {
+		h.errorResponse(w, http.StatusNotFound, "API key authentication is not enabled")
+		return
+	}
+
+	err := h.keys.Delete(mux.Vars(r)["name"])
+	switch {
+	case errors.Is(err, auth.ErrKeyNotFound):
+		h.errorResponse(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		h.errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.jsonResponse(w, map[string]string{
+		"status": "ok",
+	})
+}
@@ -0,0 +1,383 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+	"github.com/gorilla/mux"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/auth"
+)
+
+// newTestKeyring returns a keyring holding a read key "reader", an admin key
+// "ops", a read and rescan key "hot" bound to the wallet hot, and the read
+// certificate "indexer".
+func newTestKeyring(t *testing.T) *auth.Keyring {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	keys := `[{"name":"reader","key":"read-secret","scopes":["read"]},{"name":"ops","key":"admin-secret","scopes":["admin"]},` +
+		`{"name":"hot","key":"hot-secret","scopes":["read","rescan"],"wallets":["hot"]},` +
+		`{"name":"indexer","certificate":"indexer","scopes":["read"]}]`
+	if err := os.WriteFile(path, []byte(keys), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := auth.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.Disabled)
+	handler.SetKeyring(newTestKeyring(t))
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		header     string
+		value      string
+		wantStatus int
+	}{
+		{"no key", "GET", "/v1/status", "", "", http.StatusUnauthorized},
+		{"invalid key", "GET", "/v1/status", "Authorization", "Bearer wrong", http.StatusUnauthorized},
+		{"bearer token", "GET", "/v1/status", "Authorization", "Bearer read-secret", http.StatusOK},
+		{"key header", "GET", "/v1/status", apiKeyHeader, "read-secret", http.StatusOK},
+		{"missing scope", "POST", "/v1/rescan", apiKeyHeader, "read-secret", http.StatusForbidden},
+		{"scan for read key", "POST", "/v1/filters/match", apiKeyHeader, "read-secret", http.StatusForbidden},
+		{"admin allowed", "GET", "/v1/admin/keys", apiKeyHeader, "admin-secret", http.StatusOK},
+		{"admin route for read key", "GET", "/v1/admin/keys", apiKeyHeader, "read-secret", http.StatusForbidden},
+		{"peer management for read key", "POST", "/v1/peers/10.0.0.1:8333/ban", apiKeyHeader, "read-secret", http.StatusForbidden},
+		{"peer management for admin key", "POST", "/v1/peers/10.0.0.1:8333/ban", apiKeyHeader, "admin-secret", http.StatusOK},
+		{"public route", "GET", "/readyz", "", "", http.StatusOK},
+		{"liveness probe", "GET", "/healthz", "", "", http.StatusOK},
+		{"bound wallet", "GET", "/v1/wallets/hot/balance", apiKeyHeader, "hot-secret", http.StatusOK},
+		{"other wallet", "GET", "/v1/wallets/old/balance", apiKeyHeader, "hot-secret", http.StatusForbidden},
+		{"other wallet for unbound key", "GET", "/v1/wallets/old/balance", apiKeyHeader, "read-secret", http.StatusNotFound},
+		{"bound wallet query", "GET", "/v1/events?wallet=hot", apiKeyHeader, "hot-secret", http.StatusOK},
+		{"other wallet query", "GET", "/v1/watch/addresses?wallet=old", apiKeyHeader, "hot-secret", http.StatusForbidden},
+		{"default wallet events", "GET", "/v1/events", apiKeyHeader, "hot-secret", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader("{}"))
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if rr.Code == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestWalletBoundKeys(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.Disabled)
+	handler.SetKeyring(newTestKeyring(t))
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(apiKeyHeader, "hot-secret")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Wallets in request bodies, the default wallet if omitted
+	for body, want := range map[string]int{
+		`{"address":"12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S","wallet":"hot"}`: http.StatusOK,
+		`{"address":"12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S","wallet":"old"}`: http.StatusForbidden,
+		`{"address":"12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S"}`:                http.StatusForbidden,
+	} {
+		if rr := do("POST", "/v1/watch/address", body); rr.Code != want {
+			t.Errorf("POST /v1/watch/address %s = %d, want %d: %s", body, rr.Code, want, rr.Body)
+		}
+	}
+
+	// Requests reaching the default wallet, or the xpubs of other wallets,
+	// which the mock node watches in the default wallet
+	for _, tt := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{"DELETE", "/v1/watch/address/12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S", "", http.StatusForbidden},
+		{"DELETE", "/v1/watch/address/12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S?wallet=old", "", http.StatusForbidden},
+		{"DELETE", "/v1/watch/address/12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S?wallet=hot", "", http.StatusOK},
+		{"GET", "/v1/watch/xpub/" + mockXpubID, "", http.StatusForbidden},
+		{"DELETE", "/v1/watch/xpub/" + mockXpubID, "", http.StatusForbidden},
+		{"POST", "/v1/utxos", `{"addresses":["12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S"]}`, http.StatusForbidden},
+		{"POST", "/v1/rescan", `{"start_height":0,"addresses":["12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S"]}`, http.StatusForbidden},
+	} {
+		if rr := do(tt.method, tt.path, tt.body); rr.Code != tt.want {
+			t.Errorf("%s %s = %d, want %d: %s", tt.method, tt.path, rr.Code, tt.want, rr.Body)
+		}
+	}
+
+	// Listings leave out the other wallets
+	if rr := do("GET", "/v1/webhooks", ""); strings.Contains(rr.Body.String(), "example.com") {
+		t.Errorf("webhooks = %s, want none of the other wallets", rr.Body)
+	}
+	if rr := do("GET", "/v1/watch/addresses", ""); strings.Contains(rr.Body.String(), "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S") {
+		t.Errorf("watched addresses = %s, want none of the default wallet", rr.Body)
+	}
+	if rr := do("GET", "/v1/wallets?include_archived=true", ""); !strings.Contains(rr.Body.String(), `"hot"`) || strings.Contains(rr.Body.String(), `"old"`) {
+		t.Errorf("wallets = %s, want only hot", rr.Body)
+	}
+}
+
+func TestWalletBoundWebhooks(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.Disabled)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	// Keys bound to wallets lack the admin scope of webhook registration,
+	// so the request carries the wallets of one directly
+	for body, want := range map[string]int{
+		`{"url":"https://example.com/hook","events":["utxo_received"],"wallet":"hot"}`: http.StatusOK,
+		`{"url":"https://example.com/hook","events":["utxo_received"],"wallet":"old"}`: http.StatusForbidden,
+		`{"url":"https://example.com/hook","events":["utxo_received"]}`:                http.StatusForbidden,
+	} {
+		req := withWallets(httptest.NewRequest("POST", "/v1/webhooks", strings.NewReader(body)), []string{"hot"})
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("POST /v1/webhooks %s = %d, want %d: %s", body, rr.Code, want, rr.Body)
+		}
+	}
+
+	req := withWallets(httptest.NewRequest("DELETE", "/v1/webhooks/1", nil), []string{"hot"})
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("DELETE /v1/webhooks/1 = %d, want %d for a webhook of every wallet", rr.Code, http.StatusForbidden)
+	}
+}
+
+func TestAPIKeyEndpoints(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.Disabled)
+	handler.SetKeyring(newTestKeyring(t))
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	do := func(method, path, body, secret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+secret)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do("POST", "/v1/admin/keys", `{"name":"sender","scopes":["broadcast"]}`, "admin-secret")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("create status = %d: %s", rr.Code, rr.Body.String())
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil || created.Key == "" {
+		t.Fatalf("create response = %s", rr.Body.String())
+	}
+
+	// The new key works at once, within its scope
+	if rr := do("GET", "/v1/status", "", created.Key); rr.Code != http.StatusForbidden {
+		t.Errorf("status with a broadcast key = %d, want %d", rr.Code, http.StatusForbidden)
+	}
+
+	for _, tt := range []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"duplicate name", "POST", "/v1/admin/keys", `{"name":"sender","scopes":["read"]}`, http.StatusConflict},
+		{"unknown scope", "POST", "/v1/admin/keys", `{"name":"other","scopes":["write"]}`, http.StatusBadRequest},
+		{"bound to wallets", "POST", "/v1/admin/keys", `{"name":"shop","scopes":["read"],"wallets":["shop"]}`, http.StatusOK},
+		{"admin bound to wallets", "POST", "/v1/admin/keys", `{"name":"other","scopes":["admin"],"wallets":["shop"]}`, http.StatusBadRequest},
+		{"invalid body", "POST", "/v1/admin/keys", `{`, http.StatusBadRequest},
+		{"delete", "DELETE", "/v1/admin/keys/sender", "", http.StatusOK},
+		{"delete missing", "DELETE", "/v1/admin/keys/sender", "", http.StatusNotFound},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := do(tt.method, tt.path, tt.body, "admin-secret"); rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+		})
+	}
+
+	if rr := do("GET", "/v1/admin/keys", "", "admin-secret"); strings.Contains(rr.Body.String(), "sender") || strings.Contains(rr.Body.String(), "secret") {
+		t.Errorf("list = %s, want the deleted key gone and no secrets", rr.Body.String())
+	}
+	if rr := do("GET", "/v1/status", "", created.Key); rr.Code != http.StatusUnauthorized {
+		t.Errorf("status with a deleted key = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+
+	// Without a keyring the endpoints are not found
+	plain := mux.NewRouter()
+	NewHandler(&mockNode{}, btclog.Disabled).RegisterRoutes(plain)
+	rr = httptest.NewRecorder()
+	plain.ServeHTTP(rr, httptest.NewRequest("GET", "/v1/admin/keys", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("list without a keyring = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method string
+		route  string
+		want   auth.Scope
+	}{
+		{"GET", "/v1/status", auth.ScopeRead},
+		{"POST", "/v1/utxos", auth.ScopeRead},
+		{"POST", "/v1/script/decode", auth.ScopeRead},
+		{"GET", "/v1/utxo/{txid}/{vout}", auth.ScopeRescan},
+		{"POST", "/v1/utxos/check", auth.ScopeRescan},
+		{"POST", "/v1/filters/match", auth.ScopeRescan},
+		{"POST", "/v1/psbt/enrich", auth.ScopeRescan},
+		{"POST", "/v1/rescan", auth.ScopeRescan},
+		{"POST", "/v1/tx/broadcast", auth.ScopeBroadcast},
+		{"GET", "/v1/admin/keys", auth.ScopeAdmin},
+		{"POST", "/v1/wallets", auth.ScopeAdmin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.route, func(t *testing.T) {
+			if got := requiredScope(tt.method, tt.route); got != tt.want {
+				t.Errorf("requiredScope(%s, %s) = %s, want %s", tt.method, tt.route, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteTablesRegistered(t *testing.T) {
+	router := mux.NewRouter()
+	NewHandler(&mockNode{}, btclog.Disabled).RegisterRoutes(router)
+
+	registered := make(map[routeKey]bool)
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, _ := route.GetMethods()
+		for _, method := range methods {
+			registered[routeKey{method: method, route: template}] = true
+		}
+		return nil
+	})
+
+	for key := range routeScopes {
+		if !registered[key] {
+			t.Errorf("scope listed for unregistered route %s %s", key.method, key.route)
+		}
+	}
+	for _, key := range scanRoutes {
+		if !registered[key] {
+			t.Errorf("unregistered scan route %s %s", key.method, key.route)
+		}
+	}
+}
+
+// withClientCert returns req as received over TLS with a verified client
+// certificate named name.
+func withClientCert(req *http.Request, name string) *http.Request {
+	req.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: name}}}},
+	}
+	return req
+}
+
+func TestClientCertAuth(t *testing.T) {
+	certsOnly := NewHandler(&mockNode{}, btclog.Disabled)
+	certsOnly.SetRequireClientCert(true)
+	withKeys := NewHandler(&mockNode{}, btclog.Disabled)
+	withKeys.SetRequireClientCert(true)
+	withKeys.SetKeyring(newTestKeyring(t))
+
+	tests := []struct {
+		name       string
+		handler    *Handler
+		path       string
+		cert       string
+		key        string
+		wantStatus int
+	}{
+		{"certificate", certsOnly, "/v1/status", "indexer", "", http.StatusOK},
+		{"certificate grants every scope", certsOnly, "/v1/admin/keys", "indexer", "", http.StatusNotFound},
+		{"no certificate", certsOnly, "/v1/status", "", "", http.StatusUnauthorized},
+		{"public route", certsOnly, "/readyz", "", "", http.StatusOK},
+		{"key instead of certificate", withKeys, "/v1/status", "", "read-secret", http.StatusOK},
+		{"listed certificate", withKeys, "/v1/status", "indexer", "", http.StatusOK},
+		{"listed certificate lacking the scope", withKeys, "/v1/admin/keys", "indexer", "", http.StatusForbidden},
+		{"unlisted certificate", withKeys, "/v1/status", "stranger", "", http.StatusForbidden},
+		{"neither", withKeys, "/v1/status", "", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			tt.handler.RegisterRoutes(router)
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.cert != "" {
+				req = withClientCert(req, tt.cert)
+			}
+			if tt.key != "" {
+				req.Header.Set(apiKeyHeader, tt.key)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestClientIdentity(t *testing.T) {
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want string
+	}{
+		{"common name", &x509.Certificate{Subject: pkix.Name{CommonName: "indexer"}, DNSNames: []string{"indexer.internal"}}, "indexer"},
+		{"DNS name", &x509.Certificate{DNSNames: []string{"indexer.internal"}}, "indexer.internal"},
+		{"email", &x509.Certificate{EmailAddresses: []string{"ops@example.com"}}, "ops@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/status", nil)
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tt.cert}}}
+			if got := clientIdentity(req); got != tt.want {
+				t.Errorf("clientIdentity() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := clientIdentity(httptest.NewRequest("GET", "/v1/status", nil)); got != "" {
+		t.Errorf("clientIdentity() without TLS = %q", got)
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxBodyBytes bounds the size of request bodies, leaving room for
+// PSBTs carrying the full previous transactions of their inputs.
+const DefaultMaxBodyBytes = 4 << 20
+
+// errTrailingData is returned for bodies with more after their JSON value.
+var errTrailingData = errors.New("unexpected data after the JSON value")
+
+// SetMaxBodyBytes bounds request bodies to n bytes. Zero or less removes the
+// bound.
+func (h *Handler) SetMaxBodyBytes(n int64) {
+	h.maxBodyBytes = n
+}
+
+// bodyLimitMiddleware bounds the body of every request, so a client cannot
+// make a handler buffer an arbitrarily large one.
+func (h *Handler) bodyLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.maxBodyBytes > 0 && r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, h.maxBodyBytes)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodeBody decodes the JSON body of r into v. Unknown fields, values of the
+// wrong type and anything after the JSON value are rejected, so a misspelled
+// field fails instead of being silently ignored. An empty body is io.EOF.
+func decodeBody(r *http.Request, v any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return err
+		}
+		return errTrailingData
+	}
+	return nil
+}
+
+// bodyErrorResponse answers a request whose body decodeBody rejected with
+// 400, or 413 if the body is over the size limit. The error stays "invalid
+// request body", with why in reason and the offending field, if any, in field.
+func (h *Handler) bodyErrorResponse(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	code := http.StatusBadRequest
+	body := map[string]string{"error": "invalid request body"}
+	switch {
+	case errors.As(err, &tooLarge):
+		code = http.StatusRequestEntityTooLarge
+		body["error"] = "request body too large"
+		body["reason"] = fmt.Sprintf("the limit is %d bytes", tooLarge.Limit)
+	case errors.Is(err, io.EOF):
+		body["reason"] = "the body is empty"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		body["reason"] = "the JSON is truncated"
+	case errors.As(err, &syntaxErr):
+		body["reason"] = fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		body["reason"] = fmt.Sprintf("%s must be of type %s, not %s", typeErr.Field, typeErr.Type, typeErr.Value)
+		body["field"] = typeErr.Field
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		body["reason"] = fmt.Sprintf("unknown field %s", field)
+		body["field"] = field
+	case errors.Is(err, errTrailingData):
+		body["reason"] = err.Error()
+	}
+	if id := w.Header().Get(requestIDHeader); id != "" {
+		body["request_id"] = id
+	}
+	h.writeJSON(w, code, body)
+}
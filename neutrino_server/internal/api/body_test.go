@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+	"github.com/gorilla/mux"
+)
+
+func TestDecodeBody(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.NewBackend(os.Stdout).Logger("TEST"))
+	handler.SetMaxBodyBytes(128)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantReason string
+		wantField  string
+	}{
+		{"valid", `{"address": "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S"}`, http.StatusOK, "", ""},
+		{"trailing whitespace", `{"address": "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S"}` + "\n", http.StatusOK, "", ""},
+		{"unknown field", `{"address": "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S", "walet": "shop"}`, http.StatusBadRequest, "unknown field walet", "walet"},
+		{"wrong type", `{"address": 12}`, http.StatusBadRequest, "address must be of type string, not number", "address"},
+		{"trailing data", `{"address": "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S"} {}`, http.StatusBadRequest, "unexpected data after the JSON value", ""},
+		{"malformed", `{"address" "x"}`, http.StatusBadRequest, "malformed JSON at offset 12", ""},
+		{"truncated", `{"address": "12cb`, http.StatusBadRequest, "the JSON is truncated", ""},
+		{"empty", ``, http.StatusBadRequest, "the body is empty", ""},
+		{"too large", `{"address": "` + strings.Repeat("1", 200) + `"}`, http.StatusRequestEntityTooLarge, "the limit is 128 bytes", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/watch/address", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body)
+			}
+			if tt.wantStatus == http.StatusOK {
+				return
+			}
+			var body map[string]string
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body["reason"] != tt.wantReason || body["field"] != tt.wantField {
+				t.Errorf("reason = %q, field = %q, want %q, %q", body["reason"], body["field"], tt.wantReason, tt.wantField)
+			}
+		})
+	}
+}
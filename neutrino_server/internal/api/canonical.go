@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// canonicalJSON encodes v so that equal values always produce identical
+// bytes, which lets clients and caching proxies hash responses:
+//
+//   - object keys are sorted, including those of struct fields and embedded
+//     raw JSON such as event payloads;
+//   - there is no insignificant whitespace and no trailing newline;
+//   - strings are not HTML-escaped;
+//   - object members that are null are omitted, so a field is either present
+//     with a value or absent;
+//   - numbers keep Go's shortest round-trip formatting.
+//
+// Hex values are not rewritten; the node encodes hashes, scripts and
+// transactions in lowercase and normalizes hex it echoes back.
+func canonicalJSON(v any) ([]byte, error) {
+	var raw bytes.Buffer
+	enc := json.NewEncoder(&raw)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(&raw)
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCanonical appends the canonical encoding of a decoded JSON value.
+func writeCanonical(buf *bytes.Buffer, value any) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("null")
+
+	case bool:
+		if v {
+			buf.WriteString("true")
+		} else {
+			buf.WriteString("false")
+		}
+
+	case json.Number:
+		buf.WriteString(v.String())
+
+	case string:
+		return writeCanonicalString(buf, v)
+
+	case []any:
+		buf.WriteByte('[')
+		for i, elem := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, elem); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key, elem := range v {
+			if elem != nil {
+				keys = append(keys, key)
+			}
+		}
+		slices.Sort(keys)
+
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonicalString(buf, key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, v[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+
+	default:
+		return fmt.Errorf("unexpected JSON value of type %T", value)
+	}
+	return nil
+}
+
+// writeCanonicalString appends s as a JSON string without HTML escaping.
+func writeCanonicalString(buf *bytes.Buffer, s string) error {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+	// Drop the newline Encode appends
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
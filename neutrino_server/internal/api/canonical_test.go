@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	type inner struct {
+		Zeta  int     `json:"zeta"`
+		Alpha *string `json:"alpha"`
+	}
+	type outer struct {
+		Name   string          `json:"name"`
+		Inner  inner           `json:"inner"`
+		Raw    json.RawMessage `json:"raw"`
+		List   []int           `json:"list"`
+		Amount float64         `json:"amount"`
+	}
+
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{
+			"sorted struct fields and dropped nulls",
+			outer{Name: "a<b>&c", Inner: inner{Zeta: 1}, Raw: json.RawMessage(`{"b": 2, "a": [1, null]}`), Amount: 0.00001},
+			`{"amount":0.00001,"inner":{"zeta":1},"name":"a<b>&c","raw":{"a":[1,null],"b":2}}`,
+		},
+		{
+			"map keys",
+			map[string]any{"b": true, "a": map[string]string{"y": "1", "x": "2"}},
+			`{"a":{"x":"2","y":"1"},"b":true}`,
+		},
+		{"top-level null", nil, `null`},
+		{"array", []string{"z", "a"}, `["z","a"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := canonicalJSON(tt.value)
+			if err != nil {
+				t.Fatalf("canonicalJSON() failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("canonicalJSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := canonicalJSON(func() {}); err == nil {
+		t.Error("canonicalJSON() should fail for unencodable values")
+	}
+}
+
+func TestWriteJSONDeterministic(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.Disabled)
+
+	// Map iteration order must not leak into the body
+	data := map[string]any{}
+	for _, key := range []string{"txid", "vout", "value", "address", "height", "confirmations"} {
+		data[key] = key
+	}
+
+	var first string
+	for i := range 20 {
+		w := httptest.NewRecorder()
+		handler.jsonResponse(w, data)
+		if i == 0 {
+			first = w.Body.String()
+			continue
+		}
+		if w.Body.String() != first {
+			t.Fatalf("response %d = %s, want %s", i, w.Body.String(), first)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.errorResponse(w, http.StatusBadRequest, "invalid height")
+	if w.Code != http.StatusBadRequest || w.Body.String() != `{"error":"invalid height"}` {
+		t.Errorf("errorResponse() = %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.jsonResponse(w, func() {})
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("unencodable response code = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
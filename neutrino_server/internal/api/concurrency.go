@@ -0,0 +1,138 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// Defaults of the scan concurrency flags.
+const (
+	DefaultMaxConcurrentScans = 4
+	DefaultMaxQueuedScans     = 16
+)
+
+// queueDepthHeader reports the depth of a full scan queue on 429 responses.
+const queueDepthHeader = "X-Queue-Depth"
+
+// scanRoutes are the routes that scan blocks and filters, whose concurrent
+// execution is bounded.
+var scanRoutes = []routeKey{
+	{"GET", "/v1/utxo/{txid}/{vout}"},
+	{"POST", "/v1/utxos"},
+	{"POST", "/v1/utxos/check"},
+	{"GET", "/v1/outpoint/{txid}/{vout}"},
+	{"POST", "/v1/filters/match"},
+	{"POST", "/v1/psbt/enrich"},
+	{"POST", "/v1/rescan"},
+}
+
+// ConcurrencyConfig bounds the execution of each scan route. Up to
+// MaxConcurrent requests to a route run at once and up to MaxQueued more
+// wait for a slot; any more are rejected. A MaxConcurrent of zero disables
+// the bound.
+type ConcurrencyConfig struct {
+	MaxConcurrent int
+	MaxQueued     int
+}
+
+// scanPool bounds the requests to one route.
+type scanPool struct {
+	slots     chan struct{}
+	maxQueued int64
+	queued    atomic.Int64
+}
+
+func newScanPool(cfg ConcurrencyConfig) *scanPool {
+	return &scanPool{
+		slots:     make(chan struct{}, cfg.MaxConcurrent),
+		maxQueued: int64(cfg.MaxQueued),
+	}
+}
+
+// acquire waits for a slot until done is closed, returning false if the
+// queue is full or done was closed first.
+func (p *scanPool) acquire(done <-chan struct{}) bool {
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if p.queued.Add(1) > p.maxQueued {
+		p.queued.Add(-1)
+		return false
+	}
+	defer p.queued.Add(-1)
+
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+func (p *scanPool) release() {
+	<-p.slots
+}
+
+// SetConcurrencyLimits bounds the execution of the scan routes by cfg.
+func (h *Handler) SetConcurrencyLimits(cfg ConcurrencyConfig) {
+	if cfg.MaxConcurrent <= 0 {
+		h.scanPools = nil
+		return
+	}
+	h.scanPools = make(map[routeKey]*scanPool, len(scanRoutes))
+	for _, key := range scanRoutes {
+		h.scanPools[key] = newScanPool(cfg)
+	}
+}
+
+// concurrencyMiddleware runs requests to scan routes in their route's pool,
+// queueing them while it is busy. Requests over a full queue are answered
+// with 429, giving the current queue depth in the X-Queue-Depth header, so load
+// beyond what the node's peers can serve is shed rather than piling up
+// goroutines and memory.
+func (h *Handler) concurrencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pool, ok := h.scanPools[routeKey{method: r.Method, route: routeTemplate(r)}]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !pool.acquire(r.Context().Done()) {
+			if r.Context().Err() != nil {
+				// The client is gone, nobody reads the answer
+				return
+			}
+			w.Header().Set(queueDepthHeader, strconv.FormatInt(pool.queued.Load(), 10))
+			w.Header().Set("Retry-After", "1")
+			h.errorResponse(w, http.StatusTooManyRequests, "too many concurrent scans, try again later")
+			return
+		}
+		defer pool.release()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeScanPoolMetrics writes the running and queued requests of each scan
+// route in the Prometheus text format.
+func (h *Handler) writeScanPoolMetrics(buf *bytes.Buffer) {
+	if h.scanPools == nil {
+		return
+	}
+	writeHeader(buf, "neutrino_http_scans_running", "gauge", "Requests to scan routes running, by route and method.")
+	for _, key := range scanRoutes {
+		fmt.Fprintf(buf, "neutrino_http_scans_running{method=%s,route=%s} %d\n",
+			labelValue(key.method), labelValue(key.route), len(h.scanPools[key].slots))
+	}
+	writeHeader(buf, "neutrino_http_scans_queued", "gauge", "Requests to scan routes waiting for a slot, by route and method.")
+	for _, key := range scanRoutes {
+		fmt.Fprintf(buf, "neutrino_http_scans_queued{method=%s,route=%s} %d\n",
+			labelValue(key.method), labelValue(key.route), h.scanPools[key].queued.Load())
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btclog"
+	"github.com/gorilla/mux"
+)
+
+func TestScanPool(t *testing.T) {
+	pool := newScanPool(ConcurrencyConfig{MaxConcurrent: 1, MaxQueued: 1})
+	if !pool.acquire(nil) {
+		t.Fatal("acquire() of a free slot failed")
+	}
+
+	// One request queues, the next is rejected
+	acquired := make(chan bool)
+	go func() { acquired <- pool.acquire(nil) }()
+	for pool.queued.Load() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if pool.acquire(nil) {
+		t.Error("acquire() over a full queue succeeded")
+	}
+	pool.release()
+	if !<-acquired {
+		t.Error("queued acquire() failed")
+	}
+
+	// A queued request gives up when its client does
+	done := make(chan struct{})
+	close(done)
+	if pool.acquire(done) {
+		t.Error("acquire() after done succeeded")
+	}
+	if pool.queued.Load() != 0 {
+		t.Errorf("queued = %d after the requests left", pool.queued.Load())
+	}
+}
+
+func TestConcurrencyMiddleware(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.Disabled)
+	handler.SetConcurrencyLimits(ConcurrencyConfig{MaxConcurrent: 1, MaxQueued: 1})
+
+	started := make(chan struct{}, 2)
+	unblock := make(chan struct{})
+	router := mux.NewRouter()
+	router.Use(handler.concurrencyMiddleware)
+	router.HandleFunc("/v1/utxo/{txid}/{vout}", func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-unblock
+	}).Methods("GET")
+	router.HandleFunc("/v1/status", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr
+	}
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- serve("/v1/utxo/abc/0").Code
+		}()
+	}
+	<-started
+	pool := handler.scanPools[routeKey{"GET", "/v1/utxo/{txid}/{vout}"}]
+	for pool.queued.Load() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var metrics bytes.Buffer
+	handler.writeScanPoolMetrics(&metrics)
+	if !strings.Contains(metrics.String(), `neutrino_http_scans_running{method="GET",route="/v1/utxo/{txid}/{vout}"} 1`) ||
+		!strings.Contains(metrics.String(), `neutrino_http_scans_queued{method="GET",route="/v1/utxo/{txid}/{vout}"} 1`) {
+		t.Errorf("scan pool metrics = %s", metrics.String())
+	}
+
+	rr := serve("/v1/utxo/abc/1")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get(queueDepthHeader) != "1" || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("request over a full queue = %d, headers %v", rr.Code, rr.Header())
+	}
+	if rr := serve("/v1/status"); rr.Code != http.StatusOK {
+		t.Errorf("request to another route = %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	close(unblock)
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("running or queued request = %d, want %d", code, http.StatusOK)
+		}
+	}
+
+	// A client that disconnects while queued gets no answer
+	ready := make(chan struct{})
+	busy := make(chan struct{})
+	router2 := mux.NewRouter()
+	router2.Use(handler.concurrencyMiddleware)
+	router2.HandleFunc("/v1/utxos", func(w http.ResponseWriter, r *http.Request) {
+		close(ready)
+		<-busy
+	}).Methods("POST")
+	go router2.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/utxos", nil))
+	<-ready
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rr = httptest.NewRecorder()
+	router2.ServeHTTP(rr, httptest.NewRequest("POST", "/v1/utxos", nil).WithContext(ctx))
+	if rr.Body.Len() != 0 {
+		t.Errorf("disconnected client answered with %s", rr.Body.String())
+	}
+	close(busy)
+}
@@ -5,87 +5,327 @@ package api
 
 import (
 	"bytes"
+	"cmp"
+	"context"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
+	"io"
+	"io/fs"
+	"net"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btclog"
 	"github.com/gorilla/mux"
 
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/auth"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/buildinfo"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
 	"github.com/yourusername/neutrino-api/neutrino_server/internal/neutrino"
 )
 
 // NodeInterface defines the interface for neutrino node operations.
 type NodeInterface interface {
 	GetStatus() neutrino.Status
+	GetReadiness() neutrino.Readiness
+	Metrics() neutrino.Metrics
 	GetBlockHeader(height int32) (*wire.BlockHeader, error)
 	GetBlockHash(height int32) (*chainhash.Hash, error)
-	BroadcastTransaction(tx *wire.MsgTx) error
+	GetRawBlock(ctx context.Context, height int32, hash string) (*neutrino.RawBlock, error)
+	GetHeaders(start int32, count int) ([]wire.BlockHeader, error)
+	GetTransaction(ctx context.Context, txid string, blockHeight int32, blockHash string) (*neutrino.Transaction, error)
+	BroadcastTransaction(tx *wire.MsgTx, idempotencyKey string) (*neutrino.BroadcastResult, error)
+	BroadcastStatus(txid string) (*neutrino.BroadcastStatus, error)
+	EnrichPSBT(ctx context.Context, psbt string, hints []neutrino.PSBTInputHint) (*neutrino.PSBTEnrichment, error)
 	GetUTXOs(addresses []string) ([]neutrino.UTXO, error)
-	GetUTXO(txid string, vout uint32, address string, startHeight int32) (*neutrino.UTXOSpendReport, error)
-	WatchAddress(address string) error
-	Rescan(startHeight int32, addresses []string) error
+	UTXOConfidence(addresses []string) *neutrino.Confidence
+	GetUTXO(ctx context.Context, txid string, vout uint32, address string, startHeight int32, direction neutrino.ScanDirection) (*neutrino.UTXOSpendReport, error)
+	CheckUTXOs(ctx context.Context, checks []neutrino.UTXOCheck) ([]neutrino.UTXOCheckResult, error)
+	MatchFilters(ctx context.Context, addresses, scripts []string, startHeight, endHeight int32) (*neutrino.FilterMatchResult, error)
+	GetOutpoint(txid string, vout uint32) (*neutrino.OutpointStatus, error)
+	GetTxProof(txid string) (*neutrino.TxProof, error)
+	TrackTransaction(txid, address string, inputs []string, confirmations, startHeight int32) (*neutrino.TrackedTx, error)
+	TrackedTransaction(txid string) (*neutrino.TrackedTx, error)
+	UntrackTransaction(txid string) error
+	EstimateFee(targetBlocks int) (*neutrino.FeeEstimate, error)
+	WatchAddress(address, wallet string) error
+	WatchedAddresses() ([]neutrino.WatchedAddress, error)
+	UnwatchAddress(address string) error
+	UnwatchAddressInWallet(address, wallet string) error
+	SubscribeSpend(txid string, vout uint32, scriptPubKey string, startHeight int32) (*neutrino.SpendSubscription, error)
+	SpendSubscriptions() ([]neutrino.SpendSubscription, error)
+	UnsubscribeSpend(txid string, vout uint32) error
+	RegisterScript(scriptHex string) (*neutrino.ScriptRegistration, error)
+	DecodeScript(scriptHex string) (*neutrino.DecodedScript, error)
+	VerifyMessage(address, signature, message string) (*neutrino.MessageVerification, error)
+	WatchScriptPubKey(scriptPubKey, wallet string) (string, error)
+	DescriptorAddresses(descriptors []neutrino.DescriptorRange) ([]string, error)
+	WatchXpub(descriptor, wallet string, gapLimit int, startHeight int32) (*neutrino.WatchedXpub, error)
+	WatchedXpubs() ([]neutrino.WatchedXpub, error)
+	XpubBalance(id string) (*neutrino.XpubBalance, error)
+	UnwatchXpub(id string) error
+	StartRescan(startHeight int32, addresses []string) error
 	IsRescanInProgress() bool
+	RescanStatus() neutrino.RescanStatus
+	Events(wallet string, after uint64, limit int) ([]neutrino.Event, error)
+	Wallets(includeArchived bool) ([]neutrino.WalletInfo, error)
+	CreateWallet(wallet string) (*neutrino.WalletInfo, error)
+	WalletAddresses(wallet string) ([]string, error)
+	WalletBalance(wallet string) (*neutrino.WalletBalance, error)
+	ArchiveWallet(wallet string) (*neutrino.WalletInfo, error)
+	PurgeWallet(wallet string) error
+	RestoreWallet(wallet string) (*neutrino.WalletInfo, error)
+	RegisterWebhook(url string, events []string, wallet string) (*neutrino.Webhook, error)
+	Webhooks() ([]neutrino.Webhook, error)
+	DeleteWebhook(id uint64) error
+	Peers() ([]neutrino.PeerInfo, error)
+	PeerDiversity() (*neutrino.PeerDiversity, error)
+	ConnectPeer(addr string, permanent bool) error
+	DisconnectPeer(addr string) error
+	BanPeer(addr string) error
+	Bans() ([]neutrino.Ban, error)
+	AddBan(addr, reason string, duration time.Duration) (*neutrino.Ban, error)
+	RemoveBan(addr string) error
+	StartBackup(name string) (*neutrino.BackupJob, error)
+	BackupStatus(name string) (*neutrino.BackupJob, error)
+	CacheStats() (*neutrino.CacheReport, error)
+	AddScriptPattern(pattern neutrino.ScriptPattern) (neutrino.ScriptPattern, error)
+	ScriptPatterns() []neutrino.ScriptPattern
+	ScriptPatternMatches(id uint64) ([]neutrino.PatternMatch, error)
+	RemoveScriptPattern(id uint64) error
 }
 
 // Handler provides REST API endpoints for the neutrino node.
 type Handler struct {
-	node   NodeInterface
-	logger btclog.Logger
+	node         NodeInterface
+	logger       btclog.Logger
+	buildInfo    buildinfo.Info
+	metrics      *httpMetrics
+	keys         *auth.Keyring
+	clientCerts  bool
+	limits       atomic.Pointer[rateLimiter]
+	scanPools    map[routeKey]*scanPool
+	proxies      []*net.IPNet
+	index        AddressIndex
+	timeouts     TimeoutConfig
+	maxBodyBytes int64
+	swaggerUI    fs.FS
 }
 
 // NewHandler creates a new API handler.
 func NewHandler(node NodeInterface, logger btclog.Logger) *Handler {
 	return &Handler{
-		node:   node,
-		logger: logger,
+		node:         node,
+		logger:       logger,
+		metrics:      newHTTPMetrics(),
+		maxBodyBytes: DefaultMaxBodyBytes,
 	}
 }
 
+// SetBuildInfo sets the build information served by /v1/info.
+func (h *Handler) SetBuildInfo(info buildinfo.Info) {
+	h.buildInfo = info
+}
+
 // RegisterRoutes registers all API routes.
 func (h *Handler) RegisterRoutes(r *mux.Router) {
+	r.Use(h.requestLogMiddleware, h.tracingMiddleware, h.metricsMiddleware, h.authMiddleware, h.rateLimitMiddleware, h.bodyLimitMiddleware, h.concurrencyMiddleware)
+
 	// Status
 	r.HandleFunc("/v1/status", h.handleGetStatus).Methods("GET")
+	r.HandleFunc("/healthz", h.handleHealthz).Methods("GET")
+	r.HandleFunc("/readyz", h.handleReadyz).Methods("GET")
+	r.HandleFunc("/metrics", h.handleMetrics).Methods("GET")
+	r.HandleFunc("/v1/info", h.handleGetInfo).Methods("GET")
+	h.registerDocRoutes(r)
 
 	// Block queries
 	r.HandleFunc("/v1/block/{height}/header", h.handleGetBlockHeader).Methods("GET")
 	r.HandleFunc("/v1/block/{height}/filter_header", h.handleGetFilterHeader).Methods("GET")
+	r.HandleFunc("/v1/block/{height}/raw", h.handleGetRawBlock).Methods("GET")
+	r.HandleFunc("/v1/block/hash/{hash}/raw", h.handleGetRawBlock).Methods("GET")
+	r.HandleFunc("/v1/headers", h.handleGetHeaders).Methods("GET")
+
+	// Filter queries
+	r.HandleFunc("/v1/filters/match", h.handleMatchFilters).Methods("POST")
 
 	// Transaction operations
 	r.HandleFunc("/v1/tx/{txid}", h.handleGetTransaction).Methods("GET")
+	r.HandleFunc("/v1/tx/{txid}/proof", h.handleGetTxProof).Methods("GET")
+	r.HandleFunc("/v1/tx/{txid}/track", h.handleTrackTransaction).Methods("POST")
+	r.HandleFunc("/v1/tx/{txid}/track", h.handleGetTrackedTransaction).Methods("GET")
+	r.HandleFunc("/v1/tx/{txid}/track", h.handleUntrackTransaction).Methods("DELETE")
 	r.HandleFunc("/v1/tx/broadcast", h.handleBroadcastTransaction).Methods("POST")
+	r.HandleFunc("/v1/tx/broadcast/{txid}/status", h.handleBroadcastStatus).Methods("GET")
+
+	// Script operations
+	r.HandleFunc("/v1/script/decode", h.handleDecodeScript).Methods("POST")
+
+	// Signed messages
+	r.HandleFunc("/v1/verifymessage", h.handleVerifyMessage).Methods("POST")
+
+	// PSBT operations
+	r.HandleFunc("/v1/psbt/enrich", h.handleEnrichPSBT).Methods("POST")
 
 	// UTXO operations
 	r.HandleFunc("/v1/utxos", h.handleGetUTXOs).Methods("POST")
+	r.HandleFunc("/v1/utxos/check", h.handleCheckUTXOs).Methods("POST")
 	r.HandleFunc("/v1/utxo/{txid}/{vout}", h.handleGetUTXO).Methods("GET")
+	r.HandleFunc("/v1/outpoint/{txid}/{vout}", h.handleGetOutpoint).Methods("GET")
+
+	// Address index queries
+	h.registerAddressRoutes(r)
+
+	// Fees
+	r.HandleFunc("/v1/fees/estimate", h.handleEstimateFee).Methods("GET")
 
 	// Watch operations
 	r.HandleFunc("/v1/watch/address", h.handleWatchAddress).Methods("POST")
+	r.HandleFunc("/v1/watch/addresses", h.handleListWatchedAddresses).Methods("GET")
+	r.HandleFunc("/v1/watch/address/{address}", h.handleUnwatchAddress).Methods("DELETE")
 	r.HandleFunc("/v1/watch/outpoint", h.handleWatchOutpoint).Methods("POST")
+	r.HandleFunc("/v1/watch/outpoints", h.handleListWatchedOutpoints).Methods("GET")
+	r.HandleFunc("/v1/watch/outpoint/{txid}/{vout}", h.handleUnwatchOutpoint).Methods("DELETE")
+	r.HandleFunc("/v1/watch/script", h.handleWatchScript).Methods("POST")
+	r.HandleFunc("/v1/watch/xpub", h.handleWatchXpub).Methods("POST")
+	r.HandleFunc("/v1/watch/xpubs", h.handleListWatchedXpubs).Methods("GET")
+	r.HandleFunc("/v1/watch/xpub/{id}", h.handleGetXpubBalance).Methods("GET")
+	r.HandleFunc("/v1/watch/xpub/{id}", h.handleUnwatchXpub).Methods("DELETE")
 
 	// Rescan
 	r.HandleFunc("/v1/rescan", h.handleRescan).Methods("POST")
 	r.HandleFunc("/v1/rescan/status", h.handleGetRescanStatus).Methods("GET")
 
+	// Wallets
+	r.HandleFunc("/v1/wallets", h.handleListWallets).Methods("GET")
+	r.HandleFunc("/v1/wallets", h.handleCreateWallet).Methods("POST")
+	r.HandleFunc("/v1/wallets/{id}", h.handleDeleteWallet).Methods("DELETE")
+	r.HandleFunc("/v1/wallets/{id}/restore", h.handleRestoreWallet).Methods("POST")
+	r.HandleFunc("/v1/wallets/{id}/utxos", h.handleGetWalletUTXOs).Methods("GET")
+	r.HandleFunc("/v1/wallets/{id}/balance", h.handleGetWalletBalance).Methods("GET")
+	r.HandleFunc("/v1/wallets/{id}/history", h.handleGetWalletHistory).Methods("GET")
+
+	// Events
+	r.HandleFunc("/v1/events", h.handleGetEvents).Methods("GET")
+
+	// Webhooks
+	r.HandleFunc("/v1/webhooks", h.handleRegisterWebhook).Methods("POST")
+	r.HandleFunc("/v1/webhooks", h.handleListWebhooks).Methods("GET")
+	r.HandleFunc("/v1/webhooks/{id}", h.handleDeleteWebhook).Methods("DELETE")
+
 	// Peers
 	r.HandleFunc("/v1/peers", h.handleGetPeers).Methods("GET")
+	r.HandleFunc("/v1/peers/diversity", h.handleGetPeerDiversity).Methods("GET")
+	r.HandleFunc("/v1/peers/connect", h.handleConnectPeer).Methods("POST")
+	r.HandleFunc("/v1/peers/{addr}/disconnect", h.handleDisconnectPeer).Methods("POST")
+	r.HandleFunc("/v1/peers/{addr}/ban", h.handleBanPeer).Methods("POST")
+
+	// Experimental script patterns
+	r.HandleFunc("/v1/experimental/patterns", h.handleAddPattern).Methods("POST")
+	r.HandleFunc("/v1/experimental/patterns", h.handleListPatterns).Methods("GET")
+	r.HandleFunc("/v1/experimental/patterns/{id}", h.handleDeletePattern).Methods("DELETE")
+	r.HandleFunc("/v1/experimental/patterns/{id}/matches", h.handleGetPatternMatches).Methods("GET")
+
+	// API keys
+	r.HandleFunc("/v1/admin/keys", h.handleCreateAPIKey).Methods("POST")
+	r.HandleFunc("/v1/admin/keys", h.handleListAPIKeys).Methods("GET")
+	r.HandleFunc("/v1/admin/keys/{name}", h.handleDeleteAPIKey).Methods("DELETE")
+	r.HandleFunc("/v1/admin/bans", h.handleListBans).Methods("GET")
+	r.HandleFunc("/v1/admin/bans", h.handleAddBan).Methods("POST")
+	r.HandleFunc("/v1/admin/bans/{addr:.+}", h.handleRemoveBan).Methods("DELETE")
+	r.HandleFunc("/v1/admin/backup", h.handleCreateBackup).Methods("POST")
+	r.HandleFunc("/v1/admin/backup/{name}", h.handleBackupStatus).Methods("GET")
+	r.HandleFunc("/v1/admin/cache", h.handleCacheStats).Methods("GET")
 }
 
 // Response helpers
 
 func (h *Handler) jsonResponse(w http.ResponseWriter, data any) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(data)
+	h.writeJSON(w, http.StatusOK, data)
 }
 
+// errorResponse writes an error, with the request ID so a caller reporting
+// it can point at the server's log lines.
 func (h *Handler) errorResponse(w http.ResponseWriter, code int, message string) {
+	body := map[string]string{"error": message}
+	if id := w.Header().Get(requestIDHeader); id != "" {
+		body["request_id"] = id
+	}
+	h.writeJSON(w, code, body)
+}
+
+// writeJSON writes data as canonical JSON with the given status code.
+func (h *Handler) writeJSON(w http.ResponseWriter, code int, data any) {
+	body, err := canonicalJSON(data)
+	if err != nil {
+		h.logger.Errorf("Failed to encode response: %v", err)
+		code = http.StatusInternalServerError
+		body = []byte(`{"error":"failed to encode response"}`)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(map[string]string{"error": message})
+	w.Write(body)
+}
+
+// statusClientClosedRequest is the non-standard status nginx logs for
+// requests the client abandoned before the response.
+const statusClientClosedRequest = 499
+
+// nodeErrorResponse maps typed node errors to their HTTP status codes.
+func (h *Handler) nodeErrorResponse(w http.ResponseWriter, err error) {
+	var notFoundErr *neutrino.NotFoundError
+	var badRequestErr *neutrino.BadRequestError
+	var conflictErr *neutrino.ConflictError
+	var incompleteErr *neutrino.IncompleteScanError
+	var filtersErr *neutrino.FiltersNotSyncedError
+	var deadlineErr *neutrino.ScanDeadlineError
+	var busyErr *neutrino.BusyError
+
+	if errors.Is(err, context.Canceled) {
+		// The client disconnected and its scan was abandoned. Nobody
+		// reads the answer, but the status is what the access log records
+		h.logger.Debugf("Request abandoned by the client: %v", err)
+		h.errorResponse(w, statusClientClosedRequest, "client closed request")
+		return
+	}
+	if errors.As(err, &notFoundErr) {
+		h.errorResponse(w, http.StatusNotFound, err.Error())
+	} else if errors.As(err, &badRequestErr) {
+		h.errorResponse(w, http.StatusBadRequest, err.Error())
+	} else if errors.As(err, &conflictErr) {
+		h.errorResponse(w, http.StatusConflict, err.Error())
+	} else if errors.As(err, &incompleteErr) || errors.As(err, &filtersErr) {
+		h.errorResponse(w, http.StatusServiceUnavailable, err.Error())
+	} else if errors.As(err, &busyErr) {
+		w.Header().Set("Retry-After", "10")
+		h.errorResponse(w, http.StatusTooManyRequests, err.Error())
+	} else if errors.As(err, &deadlineErr) {
+		h.scanDeadlineResponse(w, deadlineErr)
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		h.errorResponse(w, http.StatusGatewayTimeout, "scan deadline exceeded")
+	} else {
+		h.errorResponse(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// withDescriptorAddresses appends the addresses derived from descriptors to
+// addresses.
+func (h *Handler) withDescriptorAddresses(addresses []string, descriptors []neutrino.DescriptorRange) ([]string, error) {
+	if len(descriptors) == 0 {
+		return addresses, nil
+	}
+	derived, err := h.node.DescriptorAddresses(descriptors)
+	if err != nil {
+		return nil, err
+	}
+	return append(addresses, derived...), nil
 }
 
 // Status endpoint
@@ -94,6 +334,27 @@ func (h *Handler) handleGetStatus(w http.ResponseWriter, r *http.Request) {
 	h.jsonResponse(w, status)
 }
 
+// Liveness probe endpoint. It only checks that the process serves requests,
+// so orchestrators do not restart a node that is still syncing.
+func (h *Handler) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	h.jsonResponse(w, map[string]string{"status": "ok"})
+}
+
+// Readiness probe endpoint
+func (h *Handler) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	readiness := h.node.GetReadiness()
+	if !readiness.Ready {
+		h.writeJSON(w, http.StatusServiceUnavailable, readiness)
+		return
+	}
+	h.jsonResponse(w, readiness)
+}
+
+// Build info endpoint
+func (h *Handler) handleGetInfo(w http.ResponseWriter, r *http.Request) {
+	h.jsonResponse(w, h.buildInfo)
+}
+
 // Block header endpoint
 func (h *Handler) handleGetBlockHeader(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -125,6 +386,119 @@ func (h *Handler) handleGetBlockHeader(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// Header range endpoint
+func (h *Handler) handleGetHeaders(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	start, err := strconv.ParseInt(query.Get("start"), 10, 32)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, "invalid start")
+		return
+	}
+
+	count := neutrino.MaxHeaderRange
+	if countStr := query.Get("count"); countStr != "" {
+		count, err = strconv.Atoi(countStr)
+		if err != nil {
+			h.errorResponse(w, http.StatusBadRequest, "invalid count")
+			return
+		}
+	}
+
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "hex" {
+		h.errorResponse(w, http.StatusBadRequest, "invalid format: use json or hex")
+		return
+	}
+
+	headers, err := h.node.GetHeaders(int32(start), count)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	if format == "hex" {
+		var buf bytes.Buffer
+		for i := range headers {
+			if err := headers[i].Serialize(&buf); err != nil {
+				h.errorResponse(w, http.StatusInternalServerError, "failed to serialize headers")
+				return
+			}
+		}
+		h.jsonResponse(w, map[string]any{
+			"start": start,
+			"count": len(headers),
+			"hex":   hex.EncodeToString(buf.Bytes()),
+		})
+		return
+	}
+
+	result := make([]map[string]any, len(headers))
+	for i, header := range headers {
+		result[i] = map[string]any{
+			"hash":        header.BlockHash().String(),
+			"height":      start + int64(i),
+			"timestamp":   header.Timestamp.Unix(),
+			"version":     header.Version,
+			"prev_block":  header.PrevBlock.String(),
+			"merkle_root": header.MerkleRoot.String(),
+			"bits":        header.Bits,
+			"nonce":       header.Nonce,
+		}
+	}
+	h.jsonResponse(w, map[string]any{
+		"start":   start,
+		"count":   len(headers),
+		"headers": result,
+	})
+}
+
+// Raw block endpoint
+func (h *Handler) handleGetRawBlock(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	height := int64(-1)
+	if heightStr, ok := vars["height"]; ok {
+		var err error
+		height, err = strconv.ParseInt(heightStr, 10, 32)
+		if err != nil || height < 0 {
+			h.errorResponse(w, http.StatusBadRequest, "invalid height")
+			return
+		}
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "hex" && format != "binary" {
+		h.errorResponse(w, http.StatusBadRequest, "invalid format: use hex or binary")
+		return
+	}
+
+	block, err := h.node.GetRawBlock(r.Context(), int32(height), vars["hash"])
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	if format == "binary" {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(block.Data)))
+		w.Header().Set("X-Block-Hash", block.Hash)
+		w.Header().Set("X-Block-Height", strconv.Itoa(int(block.Height)))
+		if _, err := w.Write(block.Data); err != nil {
+			logging.FromContext(r.Context(), h.logger).Debugf("Failed to write block %s: %v", logging.KV("block_hash", block.Hash), err)
+		}
+		return
+	}
+
+	h.jsonResponse(w, map[string]any{
+		"hash":   block.Hash,
+		"height": block.Height,
+		"size":   len(block.Data),
+		"cached": block.Cached,
+		"hex":    hex.EncodeToString(block.Data),
+	})
+}
+
 // Filter header endpoint
 func (h *Handler) handleGetFilterHeader(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -144,203 +518,1527 @@ func (h *Handler) handleGetFilterHeader(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// matchFiltersRequest is the body of POST /v1/filters/match.
+type matchFiltersRequest struct {
+	Addresses   []string `json:"addresses"`
+	Scripts     []string `json:"scripts"`
+	StartHeight int32    `json:"start_height"`
+	EndHeight   int32    `json:"end_height"`
+}
+
+// Filter match endpoint
+func (h *Handler) handleMatchFilters(w http.ResponseWriter, r *http.Request) {
+	var req matchFiltersRequest
+
+	if err := decodeBody(r, &req); err != nil {
+		h.bodyErrorResponse(w, err)
+		return
+	}
+
+	ctx, cancel, err := h.scanContext(w, r)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer cancel()
+
+	result, err := h.node.MatchFilters(ctx, req.Addresses, req.Scripts, req.StartHeight, req.EndHeight)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, result)
+}
+
 // Transaction endpoint
 func (h *Handler) handleGetTransaction(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	txid := vars["txid"]
 
-	// Neutrino doesn't store full transactions by default
-	// This would require fetching from a peer or having received it
-	h.errorResponse(w, http.StatusNotImplemented, "transaction lookup requires full block download")
-	_ = txid
+	// Neutrino has no transaction index, so the confirming block must be
+	// given by block_height and/or block_hash
+	blockHeight := int32(-1)
+	if bh := r.URL.Query().Get("block_height"); bh != "" {
+		parsed, err := strconv.ParseInt(bh, 10, 32)
+		if err != nil || parsed < 0 {
+			h.errorResponse(w, http.StatusBadRequest, "invalid block_height")
+			return
+		}
+		blockHeight = int32(parsed)
+	}
+	blockHash := r.URL.Query().Get("block_hash")
+
+	tx, err := h.node.GetTransaction(r.Context(), txid, blockHeight, blockHash)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, tx)
 }
 
-// Broadcast transaction endpoint
-func (h *Handler) handleBroadcastTransaction(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		TxHex string `json:"tx_hex"`
+// Transaction proof endpoint
+func (h *Handler) handleGetTxProof(w http.ResponseWriter, r *http.Request) {
+	txid := mux.Vars(r)["txid"]
+
+	proof, err := h.node.GetTxProof(txid)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.errorResponse(w, http.StatusBadRequest, "invalid request body")
+	h.jsonResponse(w, proof)
+}
+
+// trackTransactionRequest is the body of POST /v1/tx/{txid}/track.
+type trackTransactionRequest struct {
+	Confirmations int32    `json:"confirmations"`
+	Address       string   `json:"address"`
+	Inputs        []string `json:"inputs,omitempty"`
+	StartHeight   *int32   `json:"start_height"`
+}
+
+// Track transaction confirmations endpoint
+func (h *Handler) handleTrackTransaction(w http.ResponseWriter, r *http.Request) {
+	txid := mux.Vars(r)["txid"]
+
+	var req trackTransactionRequest
+
+	if err := decodeBody(r, &req); err != nil {
+		h.bodyErrorResponse(w, err)
+		return
+	}
+	if req.Address == "" {
+		h.errorResponse(w, http.StatusBadRequest, "address is required")
 		return
 	}
 
-	txBytes, err := hex.DecodeString(req.TxHex)
+	startHeight := int32(-1)
+	if req.StartHeight != nil {
+		if *req.StartHeight < 0 {
+			h.errorResponse(w, http.StatusBadRequest, "invalid start_height")
+			return
+		}
+		startHeight = *req.StartHeight
+	}
+
+	tracked, err := h.node.TrackTransaction(txid, req.Address, req.Inputs, req.Confirmations, startHeight)
 	if err != nil {
-		h.errorResponse(w, http.StatusBadRequest, "invalid transaction hex")
+		h.nodeErrorResponse(w, err)
 		return
 	}
 
-	var tx wire.MsgTx
-	if err := tx.Deserialize(bytes.NewReader(txBytes)); err != nil {
-		h.errorResponse(w, http.StatusBadRequest, "failed to deserialize transaction")
+	h.jsonResponse(w, tracked)
+}
+
+// Get tracked transaction endpoint
+func (h *Handler) handleGetTrackedTransaction(w http.ResponseWriter, r *http.Request) {
+	txid := mux.Vars(r)["txid"]
+
+	tracked, err := h.node.TrackedTransaction(txid)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
 		return
 	}
 
-	if err := h.node.BroadcastTransaction(&tx); err != nil {
-		h.errorResponse(w, http.StatusInternalServerError, err.Error())
+	h.jsonResponse(w, tracked)
+}
+
+// Untrack transaction endpoint
+func (h *Handler) handleUntrackTransaction(w http.ResponseWriter, r *http.Request) {
+	txid := mux.Vars(r)["txid"]
+
+	if err := h.node.UntrackTransaction(txid); err != nil {
+		h.nodeErrorResponse(w, err)
 		return
 	}
 
-	txid := tx.TxHash().String()
-	h.logger.Infof("Broadcast transaction: %s", txid)
-
 	h.jsonResponse(w, map[string]string{
-		"txid": txid,
+		"status": "ok",
 	})
 }
 
-// UTXOs endpoint
-func (h *Handler) handleGetUTXOs(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Addresses []string `json:"addresses"`
+// broadcastTransactionRequest is the body of POST /v1/tx/broadcast.
+type broadcastTransactionRequest struct {
+	TxHex string `json:"tx_hex"`
+}
+
+// Broadcast transaction endpoint
+func (h *Handler) handleBroadcastTransaction(w http.ResponseWriter, r *http.Request) {
+	var req broadcastTransactionRequest
+
+	if err := decodeBody(r, &req); err != nil {
+		h.bodyErrorResponse(w, err)
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.errorResponse(w, http.StatusBadRequest, "invalid request body")
+	txBytes, err := hex.DecodeString(req.TxHex)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, "invalid transaction hex")
+		return
+	}
+
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(txBytes)); err != nil {
+		h.errorResponse(w, http.StatusBadRequest, "failed to deserialize transaction")
 		return
 	}
 
-	utxos, err := h.node.GetUTXOs(req.Addresses)
+	result, err := h.node.BroadcastTransaction(&tx, r.Header.Get("Idempotency-Key"))
 	if err != nil {
-		h.errorResponse(w, http.StatusInternalServerError, err.Error())
+		h.nodeErrorResponse(w, err)
 		return
 	}
 
-	h.jsonResponse(w, map[string]any{
-		"utxos": utxos,
-	})
+	if !result.Duplicate {
+		logging.FromContext(r.Context(), h.logger).Infof("Broadcast transaction: %s", logging.KV("txid", result.TxID))
+	}
+
+	h.jsonResponse(w, result)
 }
 
-// UTXO lookup endpoint
-func (h *Handler) handleGetUTXO(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	txid := vars["txid"]
-	voutStr := vars["vout"]
+// Broadcast status endpoint
+func (h *Handler) handleBroadcastStatus(w http.ResponseWriter, r *http.Request) {
+	txid := mux.Vars(r)["txid"]
 
-	vout, err := strconv.ParseUint(voutStr, 10, 32)
+	status, err := h.node.BroadcastStatus(txid)
 	if err != nil {
-		h.errorResponse(w, http.StatusBadRequest, "invalid vout")
+		h.nodeErrorResponse(w, err)
 		return
 	}
 
-	// Required address query parameter (needed for compact block filter matching)
-	address := r.URL.Query().Get("address")
-	if address == "" {
-		h.errorResponse(w, http.StatusBadRequest, "address parameter is required")
+	h.jsonResponse(w, status)
+}
+
+// enrichPSBTRequest is the body of POST /v1/psbt/enrich.
+type enrichPSBTRequest struct {
+	PSBT  string                   `json:"psbt"`
+	Hints []neutrino.PSBTInputHint `json:"hints"`
+}
+
+// PSBT enrichment endpoint
+func (h *Handler) handleEnrichPSBT(w http.ResponseWriter, r *http.Request) {
+	var req enrichPSBTRequest
+
+	if err := decodeBody(r, &req); err != nil {
+		h.bodyErrorResponse(w, err)
 		return
 	}
 
-	// Optional start_height query parameter
-	startHeight := int32(0)
-	if sh := r.URL.Query().Get("start_height"); sh != "" {
-		if parsed, err := strconv.ParseInt(sh, 10, 32); err == nil {
-			startHeight = int32(parsed)
-		}
+	if req.PSBT == "" {
+		h.errorResponse(w, http.StatusBadRequest, "psbt is required")
+		return
 	}
 
-	report, err := h.node.GetUTXO(txid, uint32(vout), address, startHeight)
+	// Inputs without hints are looked up with a filter scan
+	ctx, cancel, err := h.scanContext(w, r)
 	if err != nil {
-		// Check for typed errors to return appropriate status codes
-		var notFoundErr *neutrino.NotFoundError
-		var badRequestErr *neutrino.BadRequestError
+		h.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer cancel()
 
-		if errors.As(err, &notFoundErr) {
-			h.errorResponse(w, http.StatusNotFound, err.Error())
-		} else if errors.As(err, &badRequestErr) {
-			h.errorResponse(w, http.StatusBadRequest, err.Error())
-		} else {
-			h.errorResponse(w, http.StatusInternalServerError, err.Error())
-		}
+	result, err := h.node.EnrichPSBT(ctx, req.PSBT, req.Hints)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
 		return
 	}
 
-	h.jsonResponse(w, report)
+	h.jsonResponse(w, result)
 }
 
-// Watch address endpoint
-func (h *Handler) handleWatchAddress(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Address string `json:"address"`
-	}
+// Page sizes of /v1/utxos, which addresses with many outputs would
+// otherwise answer with responses of megabytes.
+const (
+	defaultUTXOLimit = 1000
+	maxUTXOLimit     = 10000
+)
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.errorResponse(w, http.StatusBadRequest, "invalid request body")
-		return
+// pageParams parses the limit and offset query parameters of r, which
+// default to defaultLimit and zero.
+func pageParams(r *http.Request, defaultLimit, maxLimit int) (limit, offset int, err error) {
+	query := r.URL.Query()
+	limit = defaultLimit
+	if l := query.Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > maxLimit {
+			return 0, 0, errors.New("invalid limit: must be between 1 and " + strconv.Itoa(maxLimit))
+		}
+		limit = parsed
 	}
-
-	if err := h.node.WatchAddress(req.Address); err != nil {
-		h.errorResponse(w, http.StatusBadRequest, err.Error())
-		return
+	if o := query.Get("offset"); o != "" {
+		parsed, err := strconv.Atoi(o)
+		if err != nil || parsed < 0 {
+			return 0, 0, errors.New("invalid offset")
+		}
+		offset = parsed
 	}
+	return limit, offset, nil
+}
 
-	h.jsonResponse(w, map[string]string{
-		"status": "ok",
-	})
+// utxoFilter selects UTXOs by their confirmations and value, so coin
+// selection can ask for confirmed, non-dust outputs only. Unset bounds are
+// -1.
+type utxoFilter struct {
+	minConf  int64
+	maxConf  int64
+	minValue int64
 }
 
-// Watch outpoint endpoint
-func (h *Handler) handleWatchOutpoint(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		TxID string `json:"txid"`
-		Vout uint32 `json:"vout"`
+// parseUTXOFilter parses the min_conf, max_conf and min_value query
+// parameters of r.
+func parseUTXOFilter(r *http.Request) (utxoFilter, error) {
+	filter := utxoFilter{minConf: -1, maxConf: -1, minValue: -1}
+	query := r.URL.Query()
+	for _, param := range []struct {
+		name  string
+		value *int64
+	}{
+		{"min_conf", &filter.minConf},
+		{"max_conf", &filter.maxConf},
+		{"min_value", &filter.minValue},
+	} {
+		if v := query.Get(param.name); v != "" {
+			parsed, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || parsed < 0 {
+				return filter, errors.New("invalid " + param.name + ": must be a non-negative integer")
+			}
+			*param.value = parsed
+		}
 	}
+	if filter.maxConf >= 0 && filter.minConf > filter.maxConf {
+		return filter, errors.New("invalid max_conf: must not be below min_conf")
+	}
+	return filter, nil
+}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.errorResponse(w, http.StatusBadRequest, "invalid request body")
-		return
+// apply returns the UTXOs passing f, for a chain whose tip is at tip. An
+// output in the tip block has one confirmation.
+func (f utxoFilter) apply(utxos []neutrino.UTXO, tip int32) []neutrino.UTXO {
+	if f.minConf < 0 && f.maxConf < 0 && f.minValue < 0 {
+		return utxos
+	}
+	matched := make([]neutrino.UTXO, 0, len(utxos))
+	for _, utxo := range utxos {
+		confirmations := int64(tip) - int64(utxo.Height) + 1
+		switch {
+		case f.minConf >= 0 && confirmations < f.minConf:
+		case f.maxConf >= 0 && confirmations > f.maxConf:
+		case f.minValue >= 0 && utxo.Value < f.minValue:
+		default:
+			matched = append(matched, utxo)
+		}
 	}
+	return matched
+}
 
-	// Store outpoint for watching
-	// Full implementation would track this and notify on spend
-	h.jsonResponse(w, map[string]string{
-		"status": "ok",
-	})
+// utxoOrder is the order UTXO listings are sorted in, by the sort and order
+// query parameters, for coin selection strategies such as largest-first or
+// oldest-first. Ties are ordered by ascending height and outpoint.
+type utxoOrder struct {
+	key  string
+	desc bool
 }
 
-// Rescan endpoint
-func (h *Handler) handleRescan(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		StartHeight int32    `json:"start_height"`
-		Addresses   []string `json:"addresses"`
-		Outpoints   []struct {
-			TxID string `json:"txid"`
-			Vout uint32 `json:"vout"`
-		} `json:"outpoints"`
-	}
+// utxoSortKey holds the fields UTXOs are sorted by.
+type utxoSortKey struct {
+	value  int64
+	height int32
+	txid   string
+	vout   uint32
+}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.errorResponse(w, http.StatusBadRequest, "invalid request body")
-		return
+// parseUTXOOrder parses the sort and order query parameters of r, which
+// default to ascending height.
+func parseUTXOOrder(r *http.Request) (utxoOrder, error) {
+	query := r.URL.Query()
+	order := utxoOrder{key: "height"}
+	switch key := query.Get("sort"); key {
+	case "":
+	case "value", "height", "txid":
+		order.key = key
+	default:
+		return order, errors.New("invalid sort: use value, height or txid")
 	}
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		order.desc = true
+	default:
+		return order, errors.New("invalid order: use asc or desc")
+	}
+	return order, nil
+}
 
-	// Start rescan in background goroutine to not block HTTP response
-	go func() {
-		if err := h.node.Rescan(req.StartHeight, req.Addresses); err != nil {
-			h.logger.Errorf("Rescan failed: %v", err)
+// sortUTXOs sorts utxos, whose fields key returns, in order.
+func sortUTXOs[T any](utxos []T, order utxoOrder, key func(T) utxoSortKey) {
+	slices.SortFunc(utxos, func(a, b T) int {
+		ka, kb := key(a), key(b)
+		var c int
+		switch order.key {
+		case "value":
+			c = cmp.Compare(ka.value, kb.value)
+		case "height":
+			c = cmp.Compare(ka.height, kb.height)
+		case "txid":
+			c = cmp.Compare(ka.txid, kb.txid)
 		}
-	}()
-
-	h.jsonResponse(w, map[string]string{
-		"status": "started",
+		if order.desc {
+			c = -c
+		}
+		return cmp.Or(c, cmp.Compare(ka.height, kb.height), cmp.Compare(ka.txid, kb.txid), cmp.Compare(ka.vout, kb.vout))
 	})
 }
 
-// Rescan status endpoint
-func (h *Handler) handleGetRescanStatus(w http.ResponseWriter, r *http.Request) {
-	inProgress := h.node.IsRescanInProgress()
-	h.jsonResponse(w, map[string]bool{
-		"in_progress": inProgress,
-	})
+// getUTXOsRequest is the body of POST /v1/utxos.
+type getUTXOsRequest struct {
+	Addresses   []string                   `json:"addresses"`
+	Descriptors []neutrino.DescriptorRange `json:"descriptors"`
 }
 
-// Peers endpoint
-func (h *Handler) handleGetPeers(w http.ResponseWriter, r *http.Request) {
-	status := h.node.GetStatus()
+// UTXOs endpoint
+func (h *Handler) handleGetUTXOs(w http.ResponseWriter, r *http.Request) {
+	var req getUTXOsRequest
+
+	if err := decodeBody(r, &req); err != nil {
+		h.bodyErrorResponse(w, err)
+		return
+	}
+	// The addresses are watched in the default wallet
+	if !h.requireWallet(w, r, "") {
+		return
+	}
+	addresses, err := h.withDescriptorAddresses(req.Addresses, req.Descriptors)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+	h.utxoPageResponse(w, r, addresses)
+}
+
+// utxoPageResponse answers r with the UTXOs of addresses. The UTXOs
+// passing the filter parameters are sorted and returned a page at a time,
+// with their total count so clients know whether to fetch more.
+func (h *Handler) utxoPageResponse(w http.ResponseWriter, r *http.Request, addresses []string) {
+	limit, offset, err := pageParams(r, defaultUTXOLimit, maxUTXOLimit)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter, err := parseUTXOFilter(r)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	order, err := parseUTXOOrder(r)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utxos, err := h.node.GetUTXOs(addresses)
+	if err != nil {
+		h.errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utxos = filter.apply(utxos, h.node.GetStatus().BlockHeight)
+	sortUTXOs(utxos, order, func(u neutrino.UTXO) utxoSortKey {
+		return utxoSortKey{value: u.Value, height: u.Height, txid: u.TxID, vout: u.Vout}
+	})
+	total := len(utxos)
+	utxos = utxos[min(offset, total):min(offset+limit, total)]
+
+	h.jsonResponse(w, map[string]any{
+		"utxos":      utxos,
+		"total":      total,
+		"limit":      limit,
+		"offset":     offset,
+		"confidence": h.node.UTXOConfidence(addresses),
+	})
+}
+
+// checkUTXOsRequest is the body of POST /v1/utxos/check.
+type checkUTXOsRequest struct {
+	Checks []neutrino.UTXOCheck `json:"checks"`
+}
+
+// Batch UTXO check endpoint
+func (h *Handler) handleCheckUTXOs(w http.ResponseWriter, r *http.Request) {
+	var req checkUTXOsRequest
+
+	if err := decodeBody(r, &req); err != nil {
+		h.bodyErrorResponse(w, err)
+		return
+	}
+
+	ctx, cancel, err := h.scanContext(w, r)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer cancel()
+
+	results, err := h.node.CheckUTXOs(ctx, req.Checks)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, map[string]any{
+		"results": results,
+	})
+}
+
+// UTXO lookup endpoint
+func (h *Handler) handleGetUTXO(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	txid := vars["txid"]
+	voutStr := vars["vout"]
+
+	vout, err := strconv.ParseUint(voutStr, 10, 32)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, "invalid vout")
+		return
+	}
+
+	// Required address query parameter (needed for compact block filter matching)
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		h.errorResponse(w, http.StatusBadRequest, "address parameter is required")
+		return
+	}
+
+	// Optional start_height query parameter
+	startHeight := int32(0)
+	if sh := r.URL.Query().Get("start_height"); sh != "" {
+		if parsed, err := strconv.ParseInt(sh, 10, 32); err == nil {
+			startHeight = int32(parsed)
+		}
+	}
+
+	// Optional direction query parameter: forward (default) or backward
+	direction := neutrino.ScanDirection(r.URL.Query().Get("direction"))
+
+	ctx, cancel, err := h.scanContext(w, r)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer cancel()
+
+	report, err := h.node.GetUTXO(ctx, txid, uint32(vout), address, startHeight, direction)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, report)
+}
+
+// Outpoint lookup endpoint
+func (h *Handler) handleGetOutpoint(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	txid := vars["txid"]
+
+	vout, err := strconv.ParseUint(vars["vout"], 10, 32)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, "invalid vout")
+		return
+	}
+
+	status, err := h.node.GetOutpoint(txid, uint32(vout))
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, status)
+}
+
+// Fee estimate endpoint
+func (h *Handler) handleEstimateFee(w http.ResponseWriter, r *http.Request) {
+	targetBlocks := neutrino.DefaultFeeBlocks
+	if tb := r.URL.Query().Get("target_blocks"); tb != "" {
+		parsed, err := strconv.Atoi(tb)
+		if err != nil {
+			h.errorResponse(w, http.StatusBadRequest, "invalid target_blocks")
+			return
+		}
+		targetBlocks = parsed
+	}
+
+	estimate, err := h.node.EstimateFee(targetBlocks)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, estimate)
+}
+
+// watchAddressRequest is the body of POST /v1/watch/address.
+type watchAddressRequest struct {
+	Address     string                     `json:"address"`
+	Wallet      string                     `json:"wallet"`
+	Descriptors []neutrino.DescriptorRange `json:"descriptors"`
+}
+
+// Watch address endpoint
+func (h *Handler) handleWatchAddress(w http.ResponseWriter, r *http.Request) {
+	var req watchAddressRequest
+
+	if err := decodeBody(r, &req); err != nil {
+		h.bodyErrorResponse(w, err)
+		return
+	}
+	if !h.requireWallet(w, r, req.Wallet) {
+		return
+	}
+
+	if len(req.Descriptors) == 0 {
+		if err := h.node.WatchAddress(req.Address, req.Wallet); err != nil {
+			h.errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		h.jsonResponse(w, map[string]string{
+			"status": "ok",
+		})
+		return
+	}
+
+	var addresses []string
+	if req.Address != "" {
+		addresses = append(addresses, req.Address)
+	}
+	addresses, err := h.withDescriptorAddresses(addresses, req.Descriptors)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+	for _, address := range addresses {
+		if err := h.node.WatchAddress(address, req.Wallet); err != nil {
+			h.errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	h.jsonResponse(w, map[string]any{
+		"status":    "ok",
+		"addresses": addresses,
+	})
+}
+
+// Watched addresses endpoint
+func (h *Handler) handleListWatchedAddresses(w http.ResponseWriter, r *http.Request) {
+	addresses, err := h.node.WatchedAddresses()
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+	if wallet := r.URL.Query().Get("wallet"); wallet != "" {
+		addresses = slices.DeleteFunc(addresses, func(a neutrino.WatchedAddress) bool {
+			return !slices.Contains(a.Wallets, wallet)
+		})
+	}
+	if bound := requestWallets(r); bound != nil {
+		addresses = slices.DeleteFunc(addresses, func(a neutrino.WatchedAddress) bool {
+			return !slices.ContainsFunc(a.Wallets, func(wallet string) bool { return slices.Contains(bound, wallet) })
+		})
+	}
+
+	h.jsonResponse(w, map[string]any{
+		"addresses": addresses,
+	})
+}
+
+// Unwatch address endpoint
+func (h *Handler) handleUnwatchAddress(w http.ResponseWriter, r *http.Request) {
+	address := mux.Vars(r)["address"]
+
+	// Without a wallet the address leaves every wallet, which only keys
+	// bound to no wallet may do; bound keys address the default wallet
+	wallet := r.URL.Query().Get("wallet")
+	if wallet == "" && requestWallets(r) == nil {
+		if err := h.node.UnwatchAddress(address); err != nil {
+			h.nodeErrorResponse(w, err)
+			return
+		}
+		h.jsonResponse(w, map[string]string{
+			"status": "ok",
+		})
+		return
+	}
+	if !h.requireWallet(w, r, wallet) {
+		return
+	}
+
+	if err := h.node.UnwatchAddressInWallet(address, wallet); err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, map[string]string{
+		"status": "ok",
+	})
+}
+
+// watchOutpointRequest is the body of POST /v1/watch/outpoint.
+type watchOutpointRequest struct {
+	TxID         string `json:"txid"`
+	Vout         uint32 `json:"vout"`
+	ScriptPubKey string `json:"script_pubkey"`
+	StartHeight  *int32 `json:"start_height"`
+}
+
+// Watch outpoint endpoint
+func (h *Handler) handleWatchOutpoint(w http.ResponseWriter, r *http.Request) {
+	var req watchOutpointRequest
+
+	if err := decodeBody(r, &req); err != nil {
+		h.bodyErrorResponse(w, err)
+		return
+	}
+	if req.ScriptPubKey == "" {
+		h.errorResponse(w, http.StatusBadRequest, "script_pubkey is required")
+		return
+	}
+
+	startHeight := int32(-1)
+	if req.StartHeight != nil {
+		if *req.StartHeight < 0 {
+			h.errorResponse(w, http.StatusBadRequest, "invalid start_height")
+			return
+		}
+		startHeight = *req.StartHeight
+	}
+
+	sub, err := h.node.SubscribeSpend(req.TxID, req.Vout, req.ScriptPubKey, startHeight)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, sub)
+}
+
+// List watched outpoints endpoint
+func (h *Handler) handleListWatchedOutpoints(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.node.SpendSubscriptions()
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, map[string]any{
+		"outpoints": subs,
+	})
+}
+
+// Unwatch outpoint endpoint
+func (h *Handler) handleUnwatchOutpoint(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	txid := vars["txid"]
+
+	vout, err := strconv.ParseUint(vars["vout"], 10, 32)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, "invalid vout")
+		return
+	}
+
+	if err := h.node.UnsubscribeSpend(txid, uint32(vout)); err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, map[string]string{
+		"status": "ok",
+	})
+}
+
+// decodeScriptRequest is the body of POST /v1/script/decode.
+type decodeScriptRequest struct {
+	Script string `json:"script"`
+}
+
+// Script decode endpoint
+func (h *Handler) handleDecodeScript(w http.ResponseWriter, r *http.Request) {
+	var req decodeScriptRequest
+
+	if err := decodeBody(r, &req); err != nil {
+		h.bodyErrorResponse(w, err)
+		return
+	}
+
+	if req.Script == "" {
+		h.errorResponse(w, http.StatusBadRequest, "script is required")
+		return
+	}
+
+	decoded, err := h.node.DecodeScript(req.Script)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, decoded)
+}
+
+// verifyMessageRequest is the body of POST /v1/verifymessage.
+type verifyMessageRequest struct {
+	Address   string `json:"address"`
+	Signature string `json:"signature"`
+	Message   string `json:"message"`
+}
+
+// Message verification endpoint
+func (h *Handler) handleVerifyMessage(w http.ResponseWriter, r *http.Request) {
+	var req verifyMessageRequest
+
+	if err := decodeBody(r, &req); err != nil {
+		h.bodyErrorResponse(w, err)
+		return
+	}
+
+	if req.Address == "" || req.Signature == "" {
+		h.errorResponse(w, http.StatusBadRequest, "address and signature are required")
+		return
+	}
+
+	result, err := h.node.VerifyMessage(req.Address, req.Signature, req.Message)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, result)
+}
+
+// watchScriptRequest is the body of POST /v1/watch/script.
+type watchScriptRequest struct {
+	Script       string `json:"script"`
+	ScriptPubKey string `json:"script_pubkey"`
+	Wallet       string `json:"wallet"`
+}
+
+// Watch script endpoint
+func (h *Handler) handleWatchScript(w http.ResponseWriter, r *http.Request) {
+	var req watchScriptRequest
+
+	if err := decodeBody(r, &req); err != nil {
+		h.bodyErrorResponse(w, err)
+		return
+	}
+	if !h.requireWallet(w, r, req.Wallet) {
+		return
+	}
+
+	// A scriptPubKey is watched directly; a redeem script is registered
+	if req.ScriptPubKey != "" {
+		if req.Script != "" {
+			h.errorResponse(w, http.StatusBadRequest, "script and script_pubkey are mutually exclusive")
+			return
+		}
+		entry, err := h.node.WatchScriptPubKey(req.ScriptPubKey, req.Wallet)
+		if err != nil {
+			h.nodeErrorResponse(w, err)
+			return
+		}
+
+		h.jsonResponse(w, map[string]string{
+			"status":  "ok",
+			"address": entry,
+		})
+		return
+	}
+
+	reg, err := h.node.RegisterScript(req.Script)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, reg)
+}
+
+// watchXpubRequest is the body of POST /v1/watch/xpub.
+type watchXpubRequest struct {
+	Descriptor  string `json:"descriptor"`
+	Wallet      string `json:"wallet"`
+	GapLimit    int    `json:"gap_limit"`
+	StartHeight *int32 `json:"start_height"`
+}
+
+// Watch xpub endpoint
+func (h *Handler) handleWatchXpub(w http.ResponseWriter, r *http.Request) {
+	var req watchXpubRequest
+
+	if err := decodeBody(r, &req); err != nil {
+		h.bodyErrorResponse(w, err)
+		return
+	}
+	if !h.requireWallet(w, r, req.Wallet) {
+		return
+	}
+	if req.Descriptor == "" {
+		h.errorResponse(w, http.StatusBadRequest, "descriptor is required")
+		return
+	}
+
+	startHeight := int32(-1)
+	if req.StartHeight != nil {
+		if *req.StartHeight < 0 {
+			h.errorResponse(w, http.StatusBadRequest, "invalid start_height")
+			return
+		}
+		startHeight = *req.StartHeight
+	}
+
+	xpub, err := h.node.WatchXpub(req.Descriptor, req.Wallet, req.GapLimit, startHeight)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, xpub)
+}
+
+// List watched xpubs endpoint
+func (h *Handler) handleListWatchedXpubs(w http.ResponseWriter, r *http.Request) {
+	xpubs, err := h.node.WatchedXpubs()
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+	if wallet := r.URL.Query().Get("wallet"); wallet != "" {
+		xpubs = slices.DeleteFunc(xpubs, func(x neutrino.WatchedXpub) bool {
+			return cmp.Or(x.Wallet, neutrino.DefaultWallet) != wallet
+		})
+	}
+	xpubs = slices.DeleteFunc(xpubs, func(x neutrino.WatchedXpub) bool {
+		return !allowsWallet(r, x.Wallet)
+	})
+
+	h.jsonResponse(w, map[string]any{
+		"xpubs": xpubs,
+	})
+}
+
+// Get xpub balance endpoint
+func (h *Handler) handleGetXpubBalance(w http.ResponseWriter, r *http.Request) {
+	balance, err := h.node.XpubBalance(mux.Vars(r)["id"])
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+	if !h.requireWallet(w, r, balance.Wallet) {
+		return
+	}
+
+	h.jsonResponse(w, balance)
+}
+
+// Unwatch xpub endpoint
+func (h *Handler) handleUnwatchXpub(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	// The ID derives from the descriptor, so it is no secret: the key must
+	// be bound to the xpub's wallet
+	if requestWallets(r) != nil {
+		xpubs, err := h.node.WatchedXpubs()
+		if err != nil {
+			h.nodeErrorResponse(w, err)
+			return
+		}
+		for _, xpub := range xpubs {
+			if xpub.ID == id && !h.requireWallet(w, r, xpub.Wallet) {
+				return
+			}
+		}
+	}
+
+	if err := h.node.UnwatchXpub(id); err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, map[string]string{
+		"status": "ok",
+	})
+}
+
+// rescanRequest is the body of POST /v1/rescan.
+type rescanRequest struct {
+	StartHeight int32                      `json:"start_height"`
+	Addresses   []string                   `json:"addresses"`
+	Descriptors []neutrino.DescriptorRange `json:"descriptors"`
+	Outpoints   []struct {
+		TxID string `json:"txid"`
+		Vout uint32 `json:"vout"`
+	} `json:"outpoints"`
+}
+
+// Rescan endpoint
+func (h *Handler) handleRescan(w http.ResponseWriter, r *http.Request) {
+	var req rescanRequest
+
+	if err := decodeBody(r, &req); err != nil {
+		h.bodyErrorResponse(w, err)
+		return
+	}
+	// The addresses are watched in the default wallet
+	if !h.requireWallet(w, r, "") {
+		return
+	}
+
+	addresses, err := h.withDescriptorAddresses(req.Addresses, req.Descriptors)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	// The rescan runs in the background, so the response does not wait
+	// for it. A full job queue is refused here rather than piling up jobs.
+	if err := h.node.StartRescan(req.StartHeight, addresses); err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, map[string]string{
+		"status": "started",
+	})
+}
+
+// Rescan status endpoint
+func (h *Handler) handleGetRescanStatus(w http.ResponseWriter, r *http.Request) {
+	h.jsonResponse(w, h.node.RescanStatus())
+}
+
+// Wallet list endpoint
+func (h *Handler) handleListWallets(w http.ResponseWriter, r *http.Request) {
+	includeArchived := false
+	if ia := r.URL.Query().Get("include_archived"); ia != "" {
+		parsed, err := strconv.ParseBool(ia)
+		if err != nil {
+			h.errorResponse(w, http.StatusBadRequest, "invalid include_archived")
+			return
+		}
+		includeArchived = parsed
+	}
+
+	wallets, err := h.node.Wallets(includeArchived)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+	wallets = slices.DeleteFunc(wallets, func(info neutrino.WalletInfo) bool {
+		return !allowsWallet(r, info.Name)
+	})
+
+	h.jsonResponse(w, map[string]any{
+		"wallets": wallets,
+	})
+}
+
+// createWalletRequest is the body of POST /v1/wallets.
+type createWalletRequest struct {
+	Name string `json:"name"`
+}
+
+// Wallet create endpoint
+func (h *Handler) handleCreateWallet(w http.ResponseWriter, r *http.Request) {
+	var req createWalletRequest
+
+	if err := decodeBody(r, &req); err != nil {
+		h.bodyErrorResponse(w, err)
+		return
+	}
+
+	info, err := h.node.CreateWallet(req.Name)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, info)
+}
+
+// Wallet UTXOs endpoint. It takes the query parameters of POST /v1/utxos
+// and answers like it for the addresses of the wallet.
+func (h *Handler) handleGetWalletUTXOs(w http.ResponseWriter, r *http.Request) {
+	addresses, err := h.node.WalletAddresses(mux.Vars(r)["id"])
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+	h.utxoPageResponse(w, r, addresses)
+}
+
+// Wallet balance endpoint
+func (h *Handler) handleGetWalletBalance(w http.ResponseWriter, r *http.Request) {
+	balance, err := h.node.WalletBalance(mux.Vars(r)["id"])
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, balance)
+}
+
+// Wallet delete endpoint
+func (h *Handler) handleDeleteWallet(w http.ResponseWriter, r *http.Request) {
+	wallet := mux.Vars(r)["id"]
+
+	purge := false
+	if p := r.URL.Query().Get("purge"); p != "" {
+		parsed, err := strconv.ParseBool(p)
+		if err != nil {
+			h.errorResponse(w, http.StatusBadRequest, "invalid purge")
+			return
+		}
+		purge = parsed
+	}
+
+	if purge {
+		if err := h.node.PurgeWallet(wallet); err != nil {
+			h.nodeErrorResponse(w, err)
+			return
+		}
+		h.jsonResponse(w, map[string]string{
+			"status": "purged",
+		})
+		return
+	}
+
+	info, err := h.node.ArchiveWallet(wallet)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, info)
+}
+
+// Wallet restore endpoint
+func (h *Handler) handleRestoreWallet(w http.ResponseWriter, r *http.Request) {
+	info, err := h.node.RestoreWallet(mux.Vars(r)["id"])
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, info)
+}
+
+// Events endpoint
+func (h *Handler) handleGetEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	wallet := query.Get("wallet")
+	if wallet == "" {
+		wallet = neutrino.DefaultWallet
+	}
+	if !h.requireWallet(w, r, wallet) {
+		return
+	}
+
+	var after uint64
+	if a := query.Get("after"); a != "" {
+		parsed, err := strconv.ParseUint(a, 10, 64)
+		if err != nil {
+			h.errorResponse(w, http.StatusBadRequest, "invalid after cursor")
+			return
+		}
+		after = parsed
+	}
+
+	limit := 0
+	if l := query.Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 {
+			h.errorResponse(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = parsed
+	}
+
+	events, err := h.node.Events(wallet, after, limit)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	// The next cursor resumes after the last returned event
+	next := after
+	if len(events) > 0 {
+		next = events[len(events)-1].Seq
+	}
+
+	h.jsonResponse(w, map[string]any{
+		"wallet":      wallet,
+		"events":      events,
+		"next_cursor": next,
+	})
+}
+
+// registerWebhookRequest is the body of POST /v1/webhooks.
+type registerWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Wallet string   `json:"wallet"`
+}
+
+// Register webhook endpoint
+func (h *Handler) handleRegisterWebhook(w http.ResponseWriter, r *http.Request) {
+	var req registerWebhookRequest
+
+	if err := decodeBody(r, &req); err != nil {
+		h.bodyErrorResponse(w, err)
+		return
+	}
+	// A webhook without a wallet gets every wallet's events
+	if req.Wallet == "" && requestWallets(r) != nil {
+		h.errorResponse(w, http.StatusForbidden, "API key is bound to wallets: name one of them for the webhook")
+		return
+	}
+	if !h.requireWallet(w, r, req.Wallet) {
+		return
+	}
+
+	hook, err := h.node.RegisterWebhook(req.URL, req.Events, req.Wallet)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, hook)
+}
+
+// List webhooks endpoint
+func (h *Handler) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := h.node.Webhooks()
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+	hooks = slices.DeleteFunc(hooks, func(hook neutrino.Webhook) bool {
+		return !h.allowsWebhook(r, hook)
+	})
+
+	h.jsonResponse(w, map[string]any{
+		"webhooks": hooks,
+	})
+}
+
+// Delete webhook endpoint
+func (h *Handler) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, "invalid webhook id")
+		return
+	}
+	if requestWallets(r) != nil {
+		hooks, err := h.node.Webhooks()
+		if err != nil {
+			h.nodeErrorResponse(w, err)
+			return
+		}
+		for _, hook := range hooks {
+			if hook.ID == id && !h.allowsWebhook(r, hook) {
+				h.errorResponse(w, http.StatusForbidden, "API key is not bound to the wallet of webhook "+strconv.FormatUint(id, 10))
+				return
+			}
+		}
+	}
+
+	if err := h.node.DeleteWebhook(id); err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, map[string]string{
+		"status": "ok",
+	})
+}
+
+// allowsWebhook reports whether the API key of r may see hook. Keys bound
+// to wallets may not see webhooks without a wallet, which get every
+// wallet's events.
+func (h *Handler) allowsWebhook(r *http.Request, hook neutrino.Webhook) bool {
+	if requestWallets(r) == nil {
+		return true
+	}
+	return hook.Wallet != "" && allowsWallet(r, hook.Wallet)
+}
+
+// Peers endpoint
+func (h *Handler) handleGetPeers(w http.ResponseWriter, r *http.Request) {
+	peers, err := h.node.Peers()
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, map[string]any{
+		"peers": peers,
+		"count": len(peers),
+	})
+}
+
+// Peer diversity endpoint
+func (h *Handler) handleGetPeerDiversity(w http.ResponseWriter, r *http.Request) {
+	diversity, err := h.node.PeerDiversity()
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, diversity)
+}
+
+// connectPeerRequest is the body of POST /v1/peers/connect.
+type connectPeerRequest struct {
+	Addr      string `json:"addr"`
+	Permanent bool   `json:"permanent"`
+}
+
+// Connect peer endpoint
+func (h *Handler) handleConnectPeer(w http.ResponseWriter, r *http.Request) {
+	var req connectPeerRequest
+
+	if err := decodeBody(r, &req); err != nil {
+		h.bodyErrorResponse(w, err)
+		return
+	}
+	if req.Addr == "" {
+		h.errorResponse(w, http.StatusBadRequest, "addr is required")
+		return
+	}
+
+	if err := h.node.ConnectPeer(req.Addr, req.Permanent); err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusAccepted, map[string]any{
+		"status":    "connecting",
+		"addr":      req.Addr,
+		"permanent": req.Permanent,
+	})
+}
+
+// Disconnect peer endpoint
+func (h *Handler) handleDisconnectPeer(w http.ResponseWriter, r *http.Request) {
+	if err := h.node.DisconnectPeer(mux.Vars(r)["addr"]); err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, map[string]string{
+		"status": "ok",
+	})
+}
+
+// Ban peer endpoint
+func (h *Handler) handleBanPeer(w http.ResponseWriter, r *http.Request) {
+	if err := h.node.BanPeer(mux.Vars(r)["addr"]); err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, map[string]string{
+		"status": "ok",
+	})
+}
+
+// List bans endpoint
+func (h *Handler) handleListBans(w http.ResponseWriter, r *http.Request) {
+	bans, err := h.node.Bans()
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, map[string]any{
+		"bans": bans,
+	})
+}
+
+// Cache statistics endpoint
+func (h *Handler) handleCacheStats(w http.ResponseWriter, r *http.Request) {
+	report, err := h.node.CacheStats()
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, report)
+}
+
+// addBanRequest is the body of POST /v1/admin/bans.
+type addBanRequest struct {
+	Addr     string `json:"addr"`
+	Reason   string `json:"reason"`
+	Duration string `json:"duration"`
+}
+
+// Add ban endpoint
+func (h *Handler) handleAddBan(w http.ResponseWriter, r *http.Request) {
+	var req addBanRequest
+
+	if err := decodeBody(r, &req); err != nil {
+		h.bodyErrorResponse(w, err)
+		return
+	}
+	if req.Addr == "" {
+		h.errorResponse(w, http.StatusBadRequest, "addr is required")
+		return
+	}
+	var duration time.Duration
+	if req.Duration != "" {
+		var err error
+		if duration, err = time.ParseDuration(req.Duration); err != nil || duration <= 0 {
+			h.errorResponse(w, http.StatusBadRequest, "invalid duration: use a positive duration such as 72h")
+			return
+		}
+	}
+
+	ban, err := h.node.AddBan(req.Addr, req.Reason, duration)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, ban)
+}
+
+// Remove ban endpoint
+func (h *Handler) handleRemoveBan(w http.ResponseWriter, r *http.Request) {
+	if err := h.node.RemoveBan(mux.Vars(r)["addr"]); err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, map[string]string{
+		"status": "ok",
+	})
+}
+
+// createBackupRequest is the body of POST /v1/admin/backup.
+type createBackupRequest struct {
+	Name string `json:"name"`
+}
+
+// Create backup endpoint
+func (h *Handler) handleCreateBackup(w http.ResponseWriter, r *http.Request) {
+	var req createBackupRequest
+
+	// The body is optional
+	if err := decodeBody(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		h.bodyErrorResponse(w, err)
+		return
+	}
+
+	job, err := h.node.StartBackup(req.Name)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	// The backup can outlast the write timeout, so it is polled for
+	statusURL := "/v1/admin/backup/" + url.PathEscape(job.Name)
+	w.Header().Set("Location", statusURL)
+	h.writeJSON(w, http.StatusAccepted, backupJobResponse{BackupJob: job, StatusURL: statusURL})
+}
+
+// backupJobResponse is the JSON response of POST /v1/admin/backup.
+type backupJobResponse struct {
+	*neutrino.BackupJob
+	StatusURL string `json:"status_url"`
+}
+
+// Backup status endpoint
+func (h *Handler) handleBackupStatus(w http.ResponseWriter, r *http.Request) {
+	job, err := h.node.BackupStatus(mux.Vars(r)["name"])
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, job)
+}
+
+// addPatternRequest is the body of POST /v1/experimental/patterns.
+type addPatternRequest struct {
+	ScriptType string `json:"script_type"`
+	MinValue   int64  `json:"min_value"`
+	Template   string `json:"template"`
+}
+
+// Add script pattern endpoint
+func (h *Handler) handleAddPattern(w http.ResponseWriter, r *http.Request) {
+	var req addPatternRequest
+
+	if err := decodeBody(r, &req); err != nil {
+		h.bodyErrorResponse(w, err)
+		return
+	}
+
+	pattern, err := h.node.AddScriptPattern(neutrino.ScriptPattern{
+		ScriptType: req.ScriptType,
+		MinValue:   req.MinValue,
+		Template:   req.Template,
+	})
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, pattern)
+}
+
+// List script patterns endpoint
+func (h *Handler) handleListPatterns(w http.ResponseWriter, r *http.Request) {
+	h.jsonResponse(w, map[string]any{
+		"patterns": h.node.ScriptPatterns(),
+	})
+}
+
+// Delete script pattern endpoint
+func (h *Handler) handleDeletePattern(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, "invalid pattern id")
+		return
+	}
+
+	if err := h.node.RemoveScriptPattern(id); err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
+
+	h.jsonResponse(w, map[string]string{
+		"status": "ok",
+	})
+}
+
+// Script pattern matches endpoint
+func (h *Handler) handleGetPatternMatches(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		h.errorResponse(w, http.StatusBadRequest, "invalid pattern id")
+		return
+	}
+
+	matches, err := h.node.ScriptPatternMatches(id)
+	if err != nil {
+		h.nodeErrorResponse(w, err)
+		return
+	}
 
 	h.jsonResponse(w, map[string]any{
-		"peers": []any{}, // Would list connected peers
-		"count": status.Peers,
+		"matches": matches,
 	})
 }
@@ -2,17 +2,25 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btclog"
 	"github.com/gorilla/mux"
 
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/buildinfo"
 	"github.com/yourusername/neutrino-api/neutrino_server/internal/neutrino"
 )
 
@@ -28,6 +36,32 @@ func (m *mockNode) GetStatus() neutrino.Status {
 	}
 }
 
+func (m *mockNode) Metrics() neutrino.Metrics {
+	return neutrino.Metrics{
+		Synced:            true,
+		BlockHeight:       850000,
+		FilterHeight:      849990,
+		Peers:             8,
+		BlocksScanned:     1200,
+		FilterCacheHits:   3,
+		FilterCacheMisses: 1,
+		BlockCacheHits:    5,
+		BlockCacheMisses:  2,
+		BroadcastsSent:    2,
+		BroadcastsFailed:  1,
+		SyncStalls:        1,
+	}
+}
+
+func (m *mockNode) GetReadiness() neutrino.Readiness {
+	return neutrino.Readiness{
+		Ready: true,
+		Checks: []neutrino.ReadinessCheck{
+			{Name: "peers", OK: true, Detail: "1 connected, 1 required"},
+		},
+	}
+}
+
 func (m *mockNode) GetBlockHeader(height int32) (*wire.BlockHeader, error) {
 	return nil, nil
 }
@@ -36,15 +70,101 @@ func (m *mockNode) GetBlockHash(height int32) (*chainhash.Hash, error) {
 	return nil, nil
 }
 
-func (m *mockNode) BroadcastTransaction(tx *wire.MsgTx) error {
-	return nil
+func (m *mockNode) GetRawBlock(ctx context.Context, height int32, hash string) (*neutrino.RawBlock, error) {
+	if height > 800000 || (hash != "" && hash != "00000000000000000000000000000000000000000000000000000000000000aa") {
+		return nil, neutrino.NewNotFoundError("block", "block not found")
+	}
+	if height < 0 {
+		height = 700000
+	}
+	return &neutrino.RawBlock{Hash: "00000000000000000000000000000000000000000000000000000000000000aa", Height: height, Data: []byte{0x01, 0xab}}, nil
+}
+
+func (m *mockNode) GetHeaders(start int32, count int) ([]wire.BlockHeader, error) {
+	if count < 1 || count > neutrino.MaxHeaderRange {
+		return nil, neutrino.NewBadRequestError("count out of range")
+	}
+	if start > 10 {
+		return nil, neutrino.NewNotFoundError("block", "no block at height")
+	}
+
+	// The mock chain ends at height 10
+	count = min(count, int(10-start+1))
+	headers := make([]wire.BlockHeader, count)
+	for i := range headers {
+		headers[i] = wire.BlockHeader{Version: 1, Nonce: uint32(start) + uint32(i), Timestamp: time.Unix(1231006505, 0)}
+	}
+	return headers, nil
+}
+
+func (m *mockNode) GetTransaction(ctx context.Context, txid string, blockHeight int32, blockHash string) (*neutrino.Transaction, error) {
+	if blockHeight < 0 && blockHash == "" {
+		return nil, neutrino.NewBadRequestError("block_height or block_hash is required")
+	}
+	if txid != "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b" {
+		return nil, neutrino.NewNotFoundError("transaction", "transaction not found in block")
+	}
+	return &neutrino.Transaction{TxID: txid, BlockHeight: 0, Confirmations: 8544}, nil
+}
+
+func (m *mockNode) BroadcastTransaction(tx *wire.MsgTx, idempotencyKey string) (*neutrino.BroadcastResult, error) {
+	status := neutrino.BroadcastStatus{TxID: tx.TxHash().String(), Status: neutrino.TxStatusPending, FirstBroadcastAt: 1700000000, LastBroadcastAt: 1700000000, PeersAnnounced: 8, Attempts: 1}
+	switch idempotencyKey {
+	case "used-key":
+		return nil, neutrino.NewConflictError("idempotency key was already used for another transaction")
+	case "retry-key":
+		return &neutrino.BroadcastResult{BroadcastStatus: status, Duplicate: true}, nil
+	}
+	return &neutrino.BroadcastResult{BroadcastStatus: status}, nil
+}
+
+func (m *mockNode) EnrichPSBT(ctx context.Context, psbt string, hints []neutrino.PSBTInputHint) (*neutrino.PSBTEnrichment, error) {
+	if psbt == "not-a-psbt" {
+		return nil, neutrino.NewBadRequestError("invalid PSBT: invalid magic bytes")
+	}
+	if psbt == "slow-scan" {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	input := neutrino.PSBTInput{Index: 0, TxID: "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16", Vout: 0}
+	if len(hints) == 0 {
+		input.Error = "previous output not found: give its address in a hint to scan for it"
+		return &neutrino.PSBTEnrichment{PSBT: psbt, Inputs: []neutrino.PSBTInput{input}}, nil
+	}
+	input.Source, input.Value, input.ScriptPubKey = neutrino.PSBTSourceScan, 1000000000, "76a914fc916f213a3d7f1369313d5fa30f6168f9446a2d88ac"
+	fee := int64(1000)
+	return &neutrino.PSBTEnrichment{PSBT: psbt + "enriched", Inputs: []neutrino.PSBTInput{input}, Complete: true, Fee: &fee}, nil
+}
+
+func (m *mockNode) BroadcastStatus(txid string) (*neutrino.BroadcastStatus, error) {
+	if txid == "not-a-txid" {
+		return nil, neutrino.NewBadRequestError("invalid txid")
+	}
+	if txid != "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16" {
+		return nil, neutrino.NewNotFoundError("broadcast", "transaction was not broadcast by this node")
+	}
+	return &neutrino.BroadcastStatus{TxID: txid, Status: neutrino.TxStatusConfirmed, FirstBroadcastAt: 1700000000, LastBroadcastAt: 1700000600, PeersAnnounced: 8, Attempts: 2, Rebroadcasts: 1, BlockHash: "00000000000000000000000000000000000000000000000000000000000000aa", BlockHeight: 170, Confirmations: 3}, nil
 }
 
 func (m *mockNode) GetUTXOs(addresses []string) ([]neutrino.UTXO, error) {
+	if len(addresses) == 1 && addresses[0] == "bcrt1qmany" {
+		return []neutrino.UTXO{
+			{TxID: "aa", Vout: 0, Value: 500, Address: "bcrt1qmany", Height: 8000},
+			{TxID: "bb", Vout: 1, Value: 2000, Address: "bcrt1qmany", Height: 8540},
+			{TxID: "cc", Vout: 0, Value: 30000, Address: "bcrt1qmany", Height: 8543},
+		}, nil
+	}
 	return []neutrino.UTXO{}, nil
 }
 
-func (m *mockNode) GetUTXO(txid string, vout uint32, address string, startHeight int32) (*neutrino.UTXOSpendReport, error) {
+func (m *mockNode) UTXOConfidence(addresses []string) *neutrino.Confidence {
+	return &neutrino.Confidence{Level: neutrino.ConfidenceCached, AsOfHeight: 8543}
+}
+
+func (m *mockNode) GetUTXO(ctx context.Context, txid string, vout uint32, address string, startHeight int32, direction neutrino.ScanDirection) (*neutrino.UTXOSpendReport, error) {
+	if direction != "" && direction != neutrino.ScanForward && direction != neutrino.ScanBackward {
+		return nil, neutrino.NewBadRequestError("invalid direction")
+	}
 	// Mock response for a spent UTXO
 	if txid == "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16" && vout == 0 {
 		return &neutrino.UTXOSpendReport{
@@ -62,11 +182,420 @@ func (m *mockNode) GetUTXO(txid string, vout uint32, address string, startHeight
 	}, nil
 }
 
-func (m *mockNode) WatchAddress(address string) error {
+func (m *mockNode) Wallets(includeArchived bool) ([]neutrino.WalletInfo, error) {
+	wallets := []neutrino.WalletInfo{{Name: "hot", Addresses: 3}}
+	if includeArchived {
+		wallets = append(wallets, neutrino.WalletInfo{Name: "old", Addresses: 1, Archived: true, ArchivedAt: 1700000000})
+	}
+	return wallets, nil
+}
+
+func (m *mockNode) CreateWallet(wallet string) (*neutrino.WalletInfo, error) {
+	switch wallet {
+	case "":
+		return nil, neutrino.NewBadRequestError("wallet name is required")
+	case neutrino.DefaultWallet, "hot", "old":
+		return nil, neutrino.NewConflictError("wallet " + wallet + " already exists")
+	}
+	return &neutrino.WalletInfo{Name: wallet, CreatedAt: 1700000000}, nil
+}
+
+func (m *mockNode) WalletAddresses(wallet string) ([]string, error) {
+	if wallet != "hot" {
+		return nil, neutrino.NewNotFoundError("wallet", "wallet "+wallet+" not found")
+	}
+	return []string{"bcrt1qmany"}, nil
+}
+
+func (m *mockNode) WalletBalance(wallet string) (*neutrino.WalletBalance, error) {
+	if _, err := m.WalletAddresses(wallet); err != nil {
+		return nil, err
+	}
+	return &neutrino.WalletBalance{Wallet: wallet, Addresses: 1, Balance: 32500, UTXOCount: 3}, nil
+}
+
+func (m *mockNode) ArchiveWallet(wallet string) (*neutrino.WalletInfo, error) {
+	switch wallet {
+	case neutrino.DefaultWallet:
+		return nil, neutrino.NewBadRequestError("the default wallet cannot be deleted")
+	case "hot", "old":
+		return &neutrino.WalletInfo{Name: wallet, Addresses: 3, Archived: true, ArchivedAt: 1700000000, PurgeAt: 1702592000}, nil
+	}
+	return nil, neutrino.NewNotFoundError("wallet", "wallet "+wallet+" not found")
+}
+
+func (m *mockNode) PurgeWallet(wallet string) error {
+	_, err := m.ArchiveWallet(wallet)
+	return err
+}
+
+func (m *mockNode) RestoreWallet(wallet string) (*neutrino.WalletInfo, error) {
+	if wallet != "old" {
+		return nil, neutrino.NewNotFoundError("wallet", "wallet "+wallet+" is not archived")
+	}
+	return &neutrino.WalletInfo{Name: wallet, Addresses: 1}, nil
+}
+
+func (m *mockNode) RegisterWebhook(url string, events []string, wallet string) (*neutrino.Webhook, error) {
+	if url == "" || len(events) == 0 {
+		return nil, neutrino.NewBadRequestError("url and events are required")
+	}
+	return &neutrino.Webhook{ID: 1, URL: url, Events: events, Wallet: wallet, Secret: "s3cret", CreatedAt: 1700000000}, nil
+}
+
+func (m *mockNode) Webhooks() ([]neutrino.Webhook, error) {
+	return []neutrino.Webhook{{ID: 1, URL: "https://example.com/hook", Events: []string{"new_block"}, CreatedAt: 1700000000}}, nil
+}
+
+func (m *mockNode) DeleteWebhook(id uint64) error {
+	if id != 1 {
+		return neutrino.NewNotFoundError("webhook", "webhook not found")
+	}
+	return nil
+}
+
+func (m *mockNode) Peers() ([]neutrino.PeerInfo, error) {
+	return []neutrino.PeerInfo{{Addr: "10.0.0.1:8333", UserAgent: "/Satoshi:27.0.0/", Services: "SFNodeNetwork|SFNodeCF", Height: 850000, ConnectedAt: 1700000000}}, nil
+}
+
+func (m *mockNode) PeerDiversity() (*neutrino.PeerDiversity, error) {
+	return &neutrino.PeerDiversity{
+		Peers:            1,
+		Groups:           1,
+		MaxPeersPerGroup: 2,
+		Networks:         map[string]int{"local": 1},
+		ByGroup:          []neutrino.GroupPeers{{Group: "local", Network: "local", Peers: []string{"10.0.0.1:8333"}}},
+		Diverse:          true,
+		Warnings:         []string{},
+	}, nil
+}
+
+func (m *mockNode) ConnectPeer(addr string, permanent bool) error {
+	if addr == "10.0.0.1:8333" {
+		return neutrino.NewConflictError("peer 10.0.0.1:8333 is already connected")
+	}
+	return nil
+}
+
+func (m *mockNode) DisconnectPeer(addr string) error {
+	if addr != "10.0.0.1:8333" {
+		return neutrino.NewNotFoundError("peer", "peer not connected")
+	}
+	return nil
+}
+
+func (m *mockNode) BanPeer(addr string) error {
+	if addr == "example.onion:8333" {
+		return neutrino.NewBadRequestError("only IP addresses can be banned")
+	}
+	return nil
+}
+
+func (m *mockNode) Bans() ([]neutrino.Ban, error) {
+	return []neutrino.Ban{{Addr: "10.0.0.0/24", Reason: "stalled sync", CreatedAt: 1700000000, ExpiresAt: 1700086400}}, nil
+}
+
+func (m *mockNode) CacheStats() (*neutrino.CacheReport, error) {
+	return &neutrino.CacheReport{
+		Filters: neutrino.CacheStats{CapacityBytes: 30 << 20, SizeBytes: 12 << 20, Entries: 4000, Hits: 3, Misses: 1, HitRatio: 0.75},
+		Blocks:  neutrino.CacheStats{CapacityBytes: 40 << 20, SizeBytes: 38 << 20, Entries: 25, Hits: 2, Misses: 2, HitRatio: 0.5, Evictions: 7},
+	}, nil
+}
+
+func (m *mockNode) AddBan(addr, reason string, duration time.Duration) (*neutrino.Ban, error) {
+	if addr == "example.onion" {
+		return nil, neutrino.NewBadRequestError("only IP addresses and networks can be banned")
+	}
+	if duration == 0 {
+		duration = 24 * time.Hour
+	}
+	return &neutrino.Ban{Addr: addr, Reason: reason, CreatedAt: 1700000000, ExpiresAt: 1700000000 + int64(duration/time.Second)}, nil
+}
+
+func (m *mockNode) RemoveBan(addr string) error {
+	if addr != "10.0.0.0/24" {
+		return neutrino.NewNotFoundError("ban", addr+" is not banned")
+	}
+	return nil
+}
+
+func (m *mockNode) StartBackup(name string) (*neutrino.BackupJob, error) {
+	switch name {
+	case "":
+		name = "neutrino-mainnet-20231114T221320Z"
+	case "pre-upgrade":
+		return nil, neutrino.NewConflictError("backup pre-upgrade already exists")
+	case "../etc":
+		return nil, neutrino.NewBadRequestError("invalid backup name: use a file name without directories")
+	}
+	return &neutrino.BackupJob{Name: name, Status: neutrino.BackupRunning, StartedAt: 1700000000}, nil
+}
+
+func (m *mockNode) BackupStatus(name string) (*neutrino.BackupJob, error) {
+	switch name {
+	case "v2-upgrade":
+		return &neutrino.BackupJob{
+			Name:       name,
+			Status:     neutrino.BackupDone,
+			Backup:     &neutrino.Backup{Path: "/data/neutrino/backups/" + name, BlockHeight: 8543, BlockHash: "00000000000000000002a0b5db2a7f8d9087464c2586b546be7bce8eb53b8187", FilterHeight: 8543, Size: 4096, Created: 1700000000},
+			StartedAt:  1700000000,
+			FinishedAt: 1700000005,
+		}, nil
+	case "full-disk":
+		return &neutrino.BackupJob{Name: name, Status: neutrino.BackupFailed, Error: "failed to back up to /data/neutrino/backups/full-disk: no space left on device", StartedAt: 1700000000, FinishedAt: 1700000002}, nil
+	}
+	return nil, neutrino.NewNotFoundError("backup", "no backup "+name+" was started since the node started")
+}
+
+func (m *mockNode) MatchFilters(ctx context.Context, addresses, scripts []string, startHeight, endHeight int32) (*neutrino.FilterMatchResult, error) {
+	if len(addresses)+len(scripts) == 0 {
+		return nil, neutrino.NewBadRequestError("at least one address or script is required")
+	}
+	if endHeight == 0 {
+		endHeight = 8543
+	}
+	if endHeight > 8543 {
+		return nil, &neutrino.FiltersNotSyncedError{Height: endHeight, FilterHeight: 8543}
+	}
+	if startHeight == 8000 {
+		// A slow scan that only ends at its deadline
+		<-ctx.Done()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, &neutrino.ScanDeadlineError{ResumeHeight: 8200, Heights: []int32{8100}}
+		}
+		return nil, ctx.Err()
+	}
+	return &neutrino.FilterMatchResult{
+		StartHeight: startHeight,
+		EndHeight:   endHeight,
+		Heights:     []int32{startHeight, endHeight},
+		Confidence:  &neutrino.Confidence{Level: neutrino.ConfidenceComplete},
+	}, nil
+}
+
+func (m *mockNode) CheckUTXOs(ctx context.Context, checks []neutrino.UTXOCheck) ([]neutrino.UTXOCheckResult, error) {
+	if len(checks) == 0 {
+		return nil, neutrino.NewBadRequestError("at least one check is required")
+	}
+	results := make([]neutrino.UTXOCheckResult, 0, len(checks))
+	for _, check := range checks {
+		result := neutrino.UTXOCheckResult{TxID: check.TxID, Vout: check.Vout}
+		report, err := m.GetUTXO(ctx, check.TxID, check.Vout, check.Address, check.StartHeight, neutrino.ScanForward)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.UTXOSpendReport = report
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (m *mockNode) EstimateFee(targetBlocks int) (*neutrino.FeeEstimate, error) {
+	if targetBlocks < 1 {
+		return nil, neutrino.NewBadRequestError("target_blocks must be between 1 and 1008")
+	}
+	minRelayFee := 1.0
+	return &neutrino.FeeEstimate{TargetBlocks: targetBlocks, SatPerVByte: 12.5, Estimator: neutrino.FeeEstimatorStatic, Source: neutrino.FeeEstimatorStatic, MinRelayFee: &minRelayFee}, nil
+}
+
+func (m *mockNode) GetTxProof(txid string) (*neutrino.TxProof, error) {
+	if txid != "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16" {
+		return nil, neutrino.NewNotFoundError("block", "block is not retained")
+	}
+	return &neutrino.TxProof{TxID: txid, BlockHeight: 170, TxIndex: 1, TxCount: 2, MerkleBranch: []string{"b1fea52486ce0c62bb442b530a3f0132b826c74e473d1f2c220bfa78111c5082"}}, nil
+}
+
+func (m *mockNode) TrackTransaction(txid, address string, inputs []string, confirmations, startHeight int32) (*neutrino.TrackedTx, error) {
+	if txid != "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16" {
+		return nil, neutrino.NewBadRequestError("invalid txid")
+	}
+	if confirmations == 0 {
+		confirmations = 1
+	}
+	if startHeight < 0 {
+		startHeight = 8400
+	}
+	return &neutrino.TrackedTx{TxID: txid, Address: address, Inputs: inputs, TargetConfirmations: confirmations, Status: neutrino.TxStatusPending, ScannedHeight: startHeight - 1}, nil
+}
+
+func (m *mockNode) TrackedTransaction(txid string) (*neutrino.TrackedTx, error) {
+	if txid != "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16" {
+		return nil, neutrino.NewNotFoundError("transaction", "transaction is not tracked")
+	}
+	return &neutrino.TrackedTx{TxID: txid, Address: "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", TargetConfirmations: 6, Status: neutrino.TxStatusConfirmed, Confirmations: 6, BlockHash: "00000000000000000000000000000000000000000000000000000000000000aa", BlockHeight: 170, ScannedHeight: 170}, nil
+}
+
+func (m *mockNode) UntrackTransaction(txid string) error {
+	if txid != "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16" {
+		return neutrino.NewNotFoundError("transaction", "transaction is not tracked")
+	}
+	return nil
+}
+
+func (m *mockNode) SubscribeSpend(txid string, vout uint32, scriptPubKey string, startHeight int32) (*neutrino.SpendSubscription, error) {
+	if txid != "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16" {
+		return nil, neutrino.NewBadRequestError("invalid txid")
+	}
+	if startHeight < 0 {
+		startHeight = 8544
+	}
+	return &neutrino.SpendSubscription{TxID: txid, Vout: vout, ScriptPubKey: scriptPubKey, ScannedHeight: startHeight - 1}, nil
+}
+
+func (m *mockNode) SpendSubscriptions() ([]neutrino.SpendSubscription, error) {
+	return []neutrino.SpendSubscription{{
+		TxID:          "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16",
+		ScriptPubKey:  "0014751e76e8199196d454941c45d1b3a323f1433bd6",
+		ScannedHeight: 200,
+		Spent:         true,
+		Spend:         neutrino.Spend{SpendingTxID: "ea44e97271691990157559d0bdd9959e02790c34db6c006d779e82fa5aee708e", SpendingHeight: 200},
+	}}, nil
+}
+
+func (m *mockNode) UnsubscribeSpend(txid string, vout uint32) error {
+	if txid != "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16" || vout != 0 {
+		return neutrino.NewNotFoundError("outpoint", "outpoint has no spend subscription")
+	}
+	return nil
+}
+
+func (m *mockNode) WatchScriptPubKey(scriptPubKey, wallet string) (string, error) {
+	if _, err := hex.DecodeString(scriptPubKey); err != nil {
+		return "", neutrino.NewBadRequestError("invalid script_pubkey")
+	}
+	return scriptPubKey, nil
+}
+
+func (m *mockNode) DescriptorAddresses(descriptors []neutrino.DescriptorRange) ([]string, error) {
+	var addresses []string
+	for _, desc := range descriptors {
+		if !strings.HasPrefix(desc.Descriptor, "wpkh(") {
+			return nil, neutrino.NewBadRequestError("unsupported descriptor")
+		}
+		addresses = append(addresses, "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el")
+	}
+	return addresses, nil
+}
+
+const mockXpubID = "a1b2c3d4e5f60718"
+
+func (m *mockNode) WatchXpub(descriptor, wallet string, gapLimit int, startHeight int32) (*neutrino.WatchedXpub, error) {
+	if !strings.HasPrefix(descriptor, "wpkh(") {
+		return nil, neutrino.NewBadRequestError("unsupported descriptor")
+	}
+	if gapLimit == 0 {
+		gapLimit = neutrino.DefaultGapLimit
+	}
+	return &neutrino.WatchedXpub{
+		ID:          mockXpubID,
+		Descriptor:  descriptor,
+		Wallet:      wallet,
+		GapLimit:    gapLimit,
+		StartHeight: startHeight,
+		Chains:      []neutrino.XpubChain{{Derived: uint32(gapLimit), LastUsed: -1}, {Derived: uint32(gapLimit), LastUsed: -1}},
+	}, nil
+}
+
+func (m *mockNode) WatchedXpubs() ([]neutrino.WatchedXpub, error) {
+	return []neutrino.WatchedXpub{{ID: mockXpubID, GapLimit: neutrino.DefaultGapLimit}}, nil
+}
+
+func (m *mockNode) XpubBalance(id string) (*neutrino.XpubBalance, error) {
+	if id != mockXpubID {
+		return nil, neutrino.NewNotFoundError("xpub", "xpub is not watched")
+	}
+	return &neutrino.XpubBalance{
+		WatchedXpub: neutrino.WatchedXpub{ID: mockXpubID},
+		Balance:     150000,
+		UTXOs:       []neutrino.UTXO{{Value: 100000}, {Value: 50000}},
+	}, nil
+}
+
+func (m *mockNode) UnwatchXpub(id string) error {
+	if id != mockXpubID {
+		return neutrino.NewNotFoundError("xpub", "xpub is not watched")
+	}
+	return nil
+}
+
+func (m *mockNode) GetOutpoint(txid string, vout uint32) (*neutrino.OutpointStatus, error) {
+	if txid != "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16" || vout != 0 {
+		return nil, neutrino.NewNotFoundError("outpoint", "outpoint has not been seen")
+	}
+	return &neutrino.OutpointStatus{
+		UTXO:  neutrino.UTXO{TxID: txid, Vout: vout, Value: 1000000000, Height: 170},
+		Spent: true,
+		Spend: neutrino.Spend{SpendingTxID: "ea44e97271691990157559d0bdd9959e02790c34db6c006d779e82fa5aee708e", SpendingHeight: 91880},
+	}, nil
+}
+
+func (m *mockNode) WatchAddress(address, wallet string) error {
+	return nil
+}
+
+func (m *mockNode) WatchedAddresses() ([]neutrino.WatchedAddress, error) {
+	return []neutrino.WatchedAddress{
+		{Address: "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S", Wallets: []string{"default"}, AddedHeight: 800000, ScannedHeight: 800100},
+	}, nil
+}
+
+func (m *mockNode) UnwatchAddress(address string) error {
+	if address != "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S" {
+		return neutrino.NewNotFoundError("address", "address "+address+" is not watched")
+	}
+	return nil
+}
+
+func (m *mockNode) UnwatchAddressInWallet(address, wallet string) error {
+	if address != "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S" {
+		return neutrino.NewNotFoundError("address", "address "+address+" is not watched")
+	}
 	return nil
 }
 
-func (m *mockNode) Rescan(startHeight int32, addresses []string) error {
+func (m *mockNode) Events(wallet string, after uint64, limit int) ([]neutrino.Event, error) {
+	if err := neutrino.ValidateWalletName(wallet); err != nil {
+		return nil, err
+	}
+	events := make([]neutrino.Event, 0)
+	for seq := after + 1; seq <= 3 && (limit == 0 || len(events) < limit); seq++ {
+		events = append(events, neutrino.Event{Seq: seq, Wallet: wallet, Type: neutrino.EventUTXOReceived})
+	}
+	return events, nil
+}
+
+func (m *mockNode) DecodeScript(scriptHex string) (*neutrino.DecodedScript, error) {
+	if scriptHex == "zz" {
+		return nil, neutrino.NewBadRequestError("invalid script hex")
+	}
+	return &neutrino.DecodedScript{Hex: scriptHex, Asm: "0 751e76e8199196d454941c45d1b3a323f1433bd6", Type: "p2wpkh", Address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"}, nil
+}
+
+func (m *mockNode) VerifyMessage(address, signature, message string) (*neutrino.MessageVerification, error) {
+	if address == "bogus" {
+		return nil, neutrino.NewBadRequestError("invalid address bogus")
+	}
+	if message != "Hello World" {
+		return &neutrino.MessageVerification{Format: neutrino.MessageFormatSimple, Error: "invalid signature"}, nil
+	}
+	return &neutrino.MessageVerification{Valid: true, Format: neutrino.MessageFormatSimple}, nil
+}
+
+func (m *mockNode) RegisterScript(scriptHex string) (*neutrino.ScriptRegistration, error) {
+	if scriptHex == "" {
+		return nil, neutrino.NewBadRequestError("script must be between 1 and 10000 bytes")
+	}
+	return &neutrino.ScriptRegistration{
+		Script:    scriptHex,
+		Timelocks: neutrino.ScriptTimelocks{LockHeight: 800000},
+	}, nil
+}
+
+func (m *mockNode) StartRescan(startHeight int32, addresses []string) error {
+	if startHeight == 999999 {
+		return neutrino.NewBusyError("4 rescan jobs are running, try again later")
+	}
 	return nil
 }
 
@@ -74,6 +603,43 @@ func (m *mockNode) IsRescanInProgress() bool {
 	return false
 }
 
+func (m *mockNode) RescanStatus() neutrino.RescanStatus {
+	return neutrino.RescanStatus{
+		Jobs: []neutrino.RescanJobStatus{},
+		LastJob: &neutrino.RescanJobStatus{
+			JobID:         3,
+			Addresses:     2,
+			StartHeight:   800000,
+			EndHeight:     850000,
+			CurrentHeight: 850000,
+			Metrics: neutrino.ScanMetrics{
+				BlocksScanned:    50001,
+				BlocksPerSecond:  250,
+				FiltersMatched:   12,
+				BlocksDownloaded: 12,
+				BytesDownloaded:  1048576,
+				ElapsedSeconds:   200,
+			},
+		},
+	}
+}
+
+func (m *mockNode) AddScriptPattern(pattern neutrino.ScriptPattern) (neutrino.ScriptPattern, error) {
+	return neutrino.NewPatternMatcher().Add(pattern)
+}
+
+func (m *mockNode) ScriptPatterns() []neutrino.ScriptPattern {
+	return []neutrino.ScriptPattern{}
+}
+
+func (m *mockNode) ScriptPatternMatches(id uint64) ([]neutrino.PatternMatch, error) {
+	return neutrino.NewPatternMatcher().Matches(id)
+}
+
+func (m *mockNode) RemoveScriptPattern(id uint64) error {
+	return neutrino.NewPatternMatcher().Remove(id)
+}
+
 func TestHandleGetStatus(t *testing.T) {
 	backend := btclog.NewBackend(os.Stdout)
 	logger := backend.Logger("TEST")
@@ -117,6 +683,125 @@ func TestHandleGetStatus(t *testing.T) {
 	}
 }
 
+// notReadyNode reports a failing readiness check.
+type notReadyNode struct {
+	mockNode
+}
+
+func (m *notReadyNode) GetReadiness() neutrino.Readiness {
+	return neutrino.Readiness{
+		Ready: false,
+		Checks: []neutrino.ReadinessCheck{
+			{Name: "headers", OK: false, Detail: "header chain is syncing at height 100"},
+		},
+	}
+}
+
+func TestHandleReadyz(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	tests := []struct {
+		name       string
+		node       NodeInterface
+		wantStatus int
+		wantReady  bool
+	}{
+		{"ready", &mockNode{}, http.StatusOK, true},
+		{"not ready", &notReadyNode{}, http.StatusServiceUnavailable, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler(tt.node, logger)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/readyz", handler.handleReadyz).Methods("GET")
+
+			req, err := http.NewRequest("GET", "/readyz", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+
+			var response neutrino.Readiness
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("could not decode response: %v", err)
+			}
+
+			if response.Ready != tt.wantReady {
+				t.Errorf("expected ready=%v, got %v", tt.wantReady, response.Ready)
+			}
+
+			if len(response.Checks) != 1 {
+				t.Errorf("expected 1 check, got %d", len(response.Checks))
+			}
+		})
+	}
+}
+
+func TestHandleHealthz(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	// A node that is not ready is still alive
+	handler := NewHandler(&notReadyNode{}, logger)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if want := `{"status":"ok"}`; strings.TrimSpace(rr.Body.String()) != want {
+		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), want)
+	}
+}
+
+func TestHandleGetInfo(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+	handler.SetBuildInfo(buildinfo.Info{
+		Version:  "v1.2.3",
+		Commit:   "abc1234",
+		Platform: "linux/arm64",
+	})
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/info", handler.handleGetInfo).Methods("GET")
+
+	req, err := http.NewRequest("GET", "/v1/info", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var response buildinfo.Info
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+
+	if response.Version != "v1.2.3" || response.Commit != "abc1234" || response.Platform != "linux/arm64" {
+		t.Errorf("unexpected build info: %+v", response)
+	}
+}
+
 func TestHandleBroadcastTransaction_InvalidJSON(t *testing.T) {
 	backend := btclog.NewBackend(os.Stdout)
 	logger := backend.Logger("TEST")
@@ -182,7 +867,61 @@ func TestHandleBroadcastTransaction_InvalidHex(t *testing.T) {
 	}
 }
 
-func TestHandleGetBlockHeader_InvalidHeight(t *testing.T) {
+func TestHandleBroadcastTransaction_Idempotency(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, []byte{0x00, 0x14}))
+	var raw bytes.Buffer
+	if err := tx.Serialize(&raw); err != nil {
+		t.Fatal(err)
+	}
+	body := `{"tx_hex": "` + hex.EncodeToString(raw.Bytes()) + `"}`
+	txid := tx.TxHash().String()
+
+	tests := []struct {
+		name       string
+		key        string
+		wantStatus int
+		wantBody   string
+	}{
+		{"first broadcast", "", http.StatusOK,
+			`{"attempts":1,"confirmations":0,"duplicate":false,"first_broadcast_at":1700000000,"last_broadcast_at":1700000000,"peers_announced":8,"rebroadcasts":0,"status":"pending","txid":"` + txid + `"}`},
+		{"retried", "retry-key", http.StatusOK,
+			`{"attempts":1,"confirmations":0,"duplicate":true,"first_broadcast_at":1700000000,"last_broadcast_at":1700000000,"peers_announced":8,"rebroadcasts":0,"status":"pending","txid":"` + txid + `"}`},
+		{"key reused for another transaction", "used-key", http.StatusConflict, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/v1/tx/broadcast", bytes.NewBufferString(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.key != "" {
+				req.Header.Set("Idempotency-Key", tt.key)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandleGetBlockHeader_InvalidHeight(t *testing.T) {
 	backend := btclog.NewBackend(os.Stdout)
 	logger := backend.Logger("TEST")
 
@@ -295,6 +1034,32 @@ func TestHandleRescan_Success(t *testing.T) {
 	}
 }
 
+func TestHandleRescan_Busy(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.Disabled)
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/rescan", handler.handleRescan).Methods("POST")
+
+	req := httptest.NewRequest("POST", "/v1/rescan", bytes.NewBufferString(`{"start_height": 999999, "addresses": ["1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"]}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("status = %d, Retry-After = %q, want 429 with a Retry-After header: %s", rr.Code, rr.Header().Get("Retry-After"), rr.Body)
+	}
+}
+
+// TestNodeErrorResponse_Canceled tests that a scan abandoned by its client
+// is answered with 499 rather than an implicit 200.
+func TestNodeErrorResponse_Canceled(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.Disabled)
+	rr := httptest.NewRecorder()
+	handler.nodeErrorResponse(rr, context.Canceled)
+
+	if rr.Code != statusClientClosedRequest {
+		t.Errorf("status = %d, want %d", rr.Code, statusClientClosedRequest)
+	}
+}
+
 func TestHandleRescan_InvalidJSON(t *testing.T) {
 	backend := btclog.NewBackend(os.Stdout)
 	logger := backend.Logger("TEST")
@@ -360,6 +1125,80 @@ func TestHandleGetUTXOs_Success(t *testing.T) {
 	if _, ok := response["utxos"]; !ok {
 		t.Error("expected 'utxos' field in response")
 	}
+
+	confidence, ok := response["confidence"].(map[string]any)
+	if !ok || confidence["level"] != neutrino.ConfidenceCached {
+		t.Errorf("expected cached confidence, got %v", response["confidence"])
+	}
+}
+
+func TestHandleGetUTXOs_Query(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.Disabled)
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/utxos", handler.handleGetUTXOs).Methods("POST")
+
+	tests := []struct {
+		name      string
+		query     string
+		wantCode  int
+		wantTxIDs []string
+		wantTotal int
+		wantLimit int
+	}{
+		{name: "default page", wantCode: http.StatusOK, wantTxIDs: []string{"aa", "bb", "cc"}, wantTotal: 3, wantLimit: defaultUTXOLimit},
+		{name: "first page", query: "?limit=2", wantCode: http.StatusOK, wantTxIDs: []string{"aa", "bb"}, wantTotal: 3, wantLimit: 2},
+		{name: "last page", query: "?limit=2&offset=2", wantCode: http.StatusOK, wantTxIDs: []string{"cc"}, wantTotal: 3, wantLimit: 2},
+		{name: "past the end", query: "?offset=5", wantCode: http.StatusOK, wantTxIDs: []string{}, wantTotal: 3, wantLimit: defaultUTXOLimit},
+		{name: "limit too large", query: "?limit=10001", wantCode: http.StatusBadRequest},
+		{name: "zero limit", query: "?limit=0", wantCode: http.StatusBadRequest},
+		{name: "negative offset", query: "?offset=-1", wantCode: http.StatusBadRequest},
+
+		// The tip is at 8543, so the UTXO at 8543 has one confirmation
+		{name: "confirmed", query: "?min_conf=2", wantCode: http.StatusOK, wantTxIDs: []string{"aa", "bb"}, wantTotal: 2, wantLimit: defaultUTXOLimit},
+		{name: "recent", query: "?max_conf=4", wantCode: http.StatusOK, wantTxIDs: []string{"bb", "cc"}, wantTotal: 2, wantLimit: defaultUTXOLimit},
+		{name: "unconfirmed only", query: "?max_conf=0", wantCode: http.StatusOK, wantTxIDs: []string{}, wantTotal: 0, wantLimit: defaultUTXOLimit},
+		{name: "confirmation window", query: "?min_conf=1&max_conf=1", wantCode: http.StatusOK, wantTxIDs: []string{"cc"}, wantTotal: 1, wantLimit: defaultUTXOLimit},
+		{name: "non-dust", query: "?min_value=546", wantCode: http.StatusOK, wantTxIDs: []string{"bb", "cc"}, wantTotal: 2, wantLimit: defaultUTXOLimit},
+		{name: "filtered before paging", query: "?min_value=546&limit=1&offset=1", wantCode: http.StatusOK, wantTxIDs: []string{"cc"}, wantTotal: 2, wantLimit: 1},
+		{name: "negative min_conf", query: "?min_conf=-1", wantCode: http.StatusBadRequest},
+		{name: "invalid min_value", query: "?min_value=lots", wantCode: http.StatusBadRequest},
+		{name: "inverted window", query: "?min_conf=6&max_conf=1", wantCode: http.StatusBadRequest},
+
+		{name: "largest first", query: "?sort=value&order=desc", wantCode: http.StatusOK, wantTxIDs: []string{"cc", "bb", "aa"}, wantTotal: 3, wantLimit: defaultUTXOLimit},
+		{name: "newest first", query: "?order=desc&limit=2", wantCode: http.StatusOK, wantTxIDs: []string{"cc", "bb"}, wantTotal: 3, wantLimit: 2},
+		{name: "by txid", query: "?sort=txid", wantCode: http.StatusOK, wantTxIDs: []string{"aa", "bb", "cc"}, wantTotal: 3, wantLimit: defaultUTXOLimit},
+		{name: "sorted before paging", query: "?sort=value&order=desc&offset=1", wantCode: http.StatusOK, wantTxIDs: []string{"bb", "aa"}, wantTotal: 3, wantLimit: defaultUTXOLimit},
+		{name: "invalid sort", query: "?sort=age", wantCode: http.StatusBadRequest},
+		{name: "invalid order", query: "?order=up", wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("POST", "/v1/utxos"+tt.query, strings.NewReader(`{"addresses":["bcrt1qmany"]}`)))
+			if rr.Code != tt.wantCode {
+				t.Fatalf("POST /v1/utxos%s returned %d, want %d: %s", tt.query, rr.Code, tt.wantCode, rr.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				UTXOs []neutrino.UTXO `json:"utxos"`
+				Total int             `json:"total"`
+				Limit int             `json:"limit"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			txids := []string{}
+			for _, utxo := range response.UTXOs {
+				txids = append(txids, utxo.TxID)
+			}
+			if !reflect.DeepEqual(txids, tt.wantTxIDs) || response.Total != tt.wantTotal || response.Limit != tt.wantLimit {
+				t.Errorf("POST /v1/utxos%s = %v of %d with limit %d, want %v of %d with limit %d", tt.query, txids, response.Total, response.Limit, tt.wantTxIDs, tt.wantTotal, tt.wantLimit)
+			}
+		})
+	}
 }
 
 func TestHandleWatchAddress_Success(t *testing.T) {
@@ -470,6 +1309,44 @@ func TestHandleGetUTXO_Spent(t *testing.T) {
 	}
 }
 
+func TestHandleGetUTXO_Direction(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/utxo/{txid}/{vout}", handler.handleGetUTXO).Methods("GET")
+
+	tests := []struct {
+		name       string
+		direction  string
+		wantStatus int
+	}{
+		{"default", "", http.StatusOK},
+		{"forward", "forward", http.StatusOK},
+		{"backward", "backward", http.StatusOK},
+		{"invalid", "sideways", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := "/v1/utxo/f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16/0?address=1Q2TWHE3GMdB6BZKafqwxXtWAWgFt5Jvm3&direction=" + tt.direction
+			req, err := http.NewRequest("GET", url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
 func TestHandleGetUTXO_InvalidVout(t *testing.T) {
 	backend := btclog.NewBackend(os.Stdout)
 	logger := backend.Logger("TEST")
@@ -554,12 +1431,1403 @@ func TestHandleGetRescanStatus_NotInProgress(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
-	var response map[string]bool
+	var response struct {
+		InProgress bool              `json:"in_progress"`
+		Jobs       []json.RawMessage `json:"jobs"`
+		LastJob    map[string]any    `json:"last_job"`
+	}
 	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
 		t.Fatalf("could not decode response: %v", err)
 	}
 
-	if response["in_progress"] {
+	if response.InProgress {
 		t.Error("expected in_progress=false")
 	}
+	if response.Jobs == nil || len(response.Jobs) != 0 {
+		t.Errorf("expected an empty jobs list, got %v", response.Jobs)
+	}
+	metrics, _ := response.LastJob["metrics"].(map[string]any)
+	if response.LastJob["job_id"] != float64(3) || metrics["blocks_per_second"] != float64(250) || metrics["bytes_downloaded"] != float64(1048576) {
+		t.Errorf("unexpected last job: %v", response.LastJob)
+	}
+}
+
+func TestHandleAddPattern(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/experimental/patterns", handler.handleAddPattern).Methods("POST")
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"valid pattern", `{"script_type": "witness_v0_keyhash", "min_value": 100000}`, http.StatusOK},
+		{"empty pattern", `{}`, http.StatusBadRequest},
+		{"unknown script type", `{"script_type": "bogus"}`, http.StatusBadRequest},
+		{"invalid json", `{`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/v1/experimental/patterns", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandleGetPatternMatches_NotFound(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/experimental/patterns/{id}/matches", handler.handleGetPatternMatches).Methods("GET")
+
+	req, err := http.NewRequest("GET", "/v1/experimental/patterns/42/matches", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestHandleDecodeScript(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"p2wpkh", `{"script":"0014751e76e8199196d454941c45d1b3a323f1433bd6"}`, http.StatusOK},
+		{"missing script", `{}`, http.StatusBadRequest},
+		{"invalid hex", `{"script":"zz"}`, http.StatusBadRequest},
+		{"invalid body", `{"script":`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/v1/script/decode", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.handleDecodeScript(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var decoded neutrino.DecodedScript
+			if err := json.Unmarshal(rr.Body.Bytes(), &decoded); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if decoded.Type != "p2wpkh" || decoded.Address != "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4" {
+				t.Errorf("unexpected response: %+v", decoded)
+			}
+		})
+	}
+}
+
+func TestHandleVerifyMessage(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantValid  bool
+	}{
+		{"valid", `{"address":"bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l","signature":"AkcwRAIg","message":"Hello World"}`, http.StatusOK, true},
+		{"invalid signature", `{"address":"bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l","signature":"AkcwRAIg","message":"Hello"}`, http.StatusOK, false},
+		{"invalid address", `{"address":"bogus","signature":"AkcwRAIg","message":"Hello World"}`, http.StatusBadRequest, false},
+		{"missing signature", `{"address":"bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l","message":"Hello World"}`, http.StatusBadRequest, false},
+		{"invalid body", `{"address":`, http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/v1/verifymessage", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.handleVerifyMessage(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var result neutrino.MessageVerification
+			if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if result.Valid != tt.wantValid {
+				t.Errorf("unexpected response: %+v", result)
+			}
+		})
+	}
+}
+
+func TestHandleWatchScript(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/watch/script", handler.handleWatchScript).Methods("POST")
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"valid script", `{"script": "0300350cb175ac"}`, http.StatusOK},
+		{"bare multisig script pubkey", `{"script_pubkey": "51210279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f8179851ae", "wallet": "vault"}`, http.StatusOK},
+		{"invalid script pubkey", `{"script_pubkey": "zz"}`, http.StatusBadRequest},
+		{"script and script pubkey", `{"script": "0300350cb175ac", "script_pubkey": "51"}`, http.StatusBadRequest},
+		{"missing script", `{}`, http.StatusBadRequest},
+		{"invalid json", `{`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/v1/watch/script", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandleDescriptorInputs(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/utxos", handler.handleGetUTXOs).Methods("POST")
+	router.HandleFunc("/v1/watch/address", handler.handleWatchAddress).Methods("POST")
+	router.HandleFunc("/v1/rescan", handler.handleRescan).Methods("POST")
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"utxos", "/v1/utxos", `{"descriptors": [{"descriptor": "wpkh(xpub/<0;1>/*)", "range": [0, 0]}]}`, http.StatusOK},
+		{"utxos with unsupported descriptor", "/v1/utxos", `{"descriptors": [{"descriptor": "raw(00)"}]}`, http.StatusBadRequest},
+		{"watch", "/v1/watch/address", `{"wallet": "savings", "descriptors": [{"descriptor": "wpkh(xpub/<0;1>/*)"}]}`, http.StatusOK},
+		{"watch with unsupported descriptor", "/v1/watch/address", `{"descriptors": [{"descriptor": "raw(00)"}]}`, http.StatusBadRequest},
+		{"rescan", "/v1/rescan", `{"start_height": 800000, "descriptors": [{"descriptor": "wpkh(xpub/<0;1>/*)"}]}`, http.StatusOK},
+		{"rescan with unsupported descriptor", "/v1/rescan", `{"descriptors": [{"descriptor": "raw(00)"}]}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", tt.path, bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+		})
+	}
+
+	req, _ := http.NewRequest("POST", "/v1/watch/address", bytes.NewBufferString(`{"address": "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "descriptors": [{"descriptor": "wpkh(xpub/<0;1>/*)"}]}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var response struct {
+		Addresses []string `json:"addresses"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Addresses) != 3 || response.Addresses[0] != "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa" {
+		t.Errorf("watched addresses = %v, want the address and both derived addresses", response.Addresses)
+	}
+}
+
+func TestHandleWatchXpub(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/watch/xpub", handler.handleWatchXpub).Methods("POST")
+	router.HandleFunc("/v1/watch/xpub/{id}", handler.handleGetXpubBalance).Methods("GET")
+	router.HandleFunc("/v1/watch/xpub/{id}", handler.handleUnwatchXpub).Methods("DELETE")
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"valid descriptor", "POST", "/v1/watch/xpub", `{"descriptor": "wpkh(xpub/0/*)", "start_height": 800000}`, http.StatusOK},
+		{"unsupported descriptor", "POST", "/v1/watch/xpub", `{"descriptor": "sh(multi(xpub))"}`, http.StatusBadRequest},
+		{"missing descriptor", "POST", "/v1/watch/xpub", `{}`, http.StatusBadRequest},
+		{"negative start height", "POST", "/v1/watch/xpub", `{"descriptor": "wpkh(xpub/0/*)", "start_height": -1}`, http.StatusBadRequest},
+		{"invalid json", "POST", "/v1/watch/xpub", `{`, http.StatusBadRequest},
+		{"balance", "GET", "/v1/watch/xpub/" + mockXpubID, "", http.StatusOK},
+		{"unknown xpub balance", "GET", "/v1/watch/xpub/0000000000000000", "", http.StatusNotFound},
+		{"unwatch", "DELETE", "/v1/watch/xpub/" + mockXpubID, "", http.StatusOK},
+		{"unwatch unknown xpub", "DELETE", "/v1/watch/xpub/0000000000000000", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+		})
+	}
+
+	req, _ := http.NewRequest("GET", "/v1/watch/xpub/"+mockXpubID, nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var balance neutrino.XpubBalance
+	if err := json.Unmarshal(rr.Body.Bytes(), &balance); err != nil {
+		t.Fatal(err)
+	}
+	if balance.ID != mockXpubID || balance.Balance != 150000 || len(balance.UTXOs) != 2 {
+		t.Errorf("balance = %+v", balance)
+	}
+}
+
+func TestHandleGetEvents(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/events", handler.handleGetEvents).Methods("GET")
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantWallet string
+		wantEvents int
+		wantCursor uint64
+	}{
+		{"default wallet", "", http.StatusOK, "default", 3, 3},
+		{"named wallet with cursor", "?wallet=shop&after=1", http.StatusOK, "shop", 2, 3},
+		{"limit", "?wallet=shop&limit=1", http.StatusOK, "shop", 1, 1},
+		{"caught up keeps cursor", "?after=3", http.StatusOK, "default", 0, 3},
+		{"invalid wallet", "?wallet=bad%20name", http.StatusBadRequest, "", 0, 0},
+		{"invalid cursor", "?after=-1", http.StatusBadRequest, "", 0, 0},
+		{"invalid limit", "?limit=0", http.StatusBadRequest, "", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/v1/events"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Wallet     string           `json:"wallet"`
+				Events     []neutrino.Event `json:"events"`
+				NextCursor uint64           `json:"next_cursor"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("could not decode response: %v", err)
+			}
+
+			if response.Wallet != tt.wantWallet || len(response.Events) != tt.wantEvents || response.NextCursor != tt.wantCursor {
+				t.Errorf("unexpected response: wallet=%s events=%d next_cursor=%d",
+					response.Wallet, len(response.Events), response.NextCursor)
+			}
+		})
+	}
+}
+
+func TestHandleGetTransaction(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/tx/{txid}", handler.handleGetTransaction).Methods("GET")
+
+	genesisTx := "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+	}{
+		{"by height", "/v1/tx/" + genesisTx + "?block_height=0", http.StatusOK},
+		{"by hash", "/v1/tx/" + genesisTx + "?block_hash=000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f", http.StatusOK},
+		{"no block hint", "/v1/tx/" + genesisTx, http.StatusBadRequest},
+		{"invalid height", "/v1/tx/" + genesisTx + "?block_height=abc", http.StatusBadRequest},
+		{"not in block", "/v1/tx/0000000000000000000000000000000000000000000000000000000000000001?block_height=0", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandleGetOutpoint(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/outpoint/{txid}/{vout}", handler.handleGetOutpoint).Methods("GET")
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+	}{
+		{"seen", "/v1/outpoint/f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16/0", http.StatusOK},
+		{"unseen", "/v1/outpoint/f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16/1", http.StatusNotFound},
+		{"invalid vout", "/v1/outpoint/f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16/x", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response map[string]any
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if response["spent"] != true || response["spending_height"] != float64(91880) || response["height"] != float64(170) {
+				t.Errorf("unexpected response: %v", response)
+			}
+		})
+	}
+}
+
+func TestHandleEstimateFee(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		wantTarget float64
+	}{
+		{"default target", "/v1/fees/estimate", http.StatusOK, float64(neutrino.DefaultFeeBlocks)},
+		{"explicit target", "/v1/fees/estimate?target_blocks=2", http.StatusOK, 2},
+		{"invalid target", "/v1/fees/estimate?target_blocks=soon", http.StatusBadRequest, 0},
+		{"out of range target", "/v1/fees/estimate?target_blocks=0", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.handleEstimateFee(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response map[string]any
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if response["target_blocks"] != tt.wantTarget || response["estimator"] != neutrino.FeeEstimatorStatic || response["min_relay_fee"] != 1.0 {
+				t.Errorf("unexpected response: %v", response)
+			}
+		})
+	}
+}
+
+func TestHandleGetTxProof(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/tx/{txid}/proof", handler.handleGetTxProof).Methods("GET")
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+	}{
+		{"retained", "/v1/tx/f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16/proof", http.StatusOK},
+		{"not retained", "/v1/tx/0e3e2357e806b6cdb1f70b54c3a3a17b6714ee1f0e68bebb44a74b1efd512098/proof", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response map[string]any
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if response["tx_index"] != float64(1) || response["block_height"] != float64(170) {
+				t.Errorf("unexpected response: %v", response)
+			}
+		})
+	}
+}
+
+func TestHandleCheckUTXOs(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+
+	tests := []struct {
+		name        string
+		body        string
+		wantStatus  int
+		wantResults int
+	}{
+		{
+			"two outpoints",
+			`{"checks":[{"txid":"f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16","vout":0,"address":"1Q2TWHE3GMdB6BZKafqwxXtWAWgFt5Jvm3","start_height":170},` +
+				`{"txid":"0e3e2357e806b6cdb1f70b54c3a3a17b6714ee1f0e68bebb44a74b1efd512098","vout":0,"address":"12c6DSiU4Rq3P4ZxziKxzrPLHJVyNBSyaE","start_height":1}]}`,
+			http.StatusOK,
+			2,
+		},
+		{"no checks", `{"checks":[]}`, http.StatusBadRequest, 0},
+		{"invalid body", `{"checks":`, http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/v1/utxos/check", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.handleCheckUTXOs(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response struct {
+				Results []map[string]any `json:"results"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(response.Results) != tt.wantResults {
+				t.Fatalf("expected %d results, got %d", tt.wantResults, len(response.Results))
+			}
+			if response.Results[0]["unspent"] != false || response.Results[0]["spending_height"] != float64(91880) {
+				t.Errorf("unexpected first result: %v", response.Results[0])
+			}
+			if response.Results[1]["unspent"] != true {
+				t.Errorf("unexpected second result: %v", response.Results[1])
+			}
+		})
+	}
+}
+
+func TestHandleEnrichPSBT(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+
+	tests := []struct {
+		name         string
+		body         string
+		wantStatus   int
+		wantComplete bool
+	}{
+		{"hinted input", `{"psbt":"cHNidP8B","hints":[{"index":0,"address":"1Q2TWHE3GMdB6BZKafqwxXtWAWgFt5Jvm3","start_height":170}]}`, http.StatusOK, true},
+		{"unresolved input", `{"psbt":"cHNidP8B"}`, http.StatusOK, false},
+		{"missing psbt", `{}`, http.StatusBadRequest, false},
+		{"invalid psbt", `{"psbt":"not-a-psbt"}`, http.StatusBadRequest, false},
+		{"invalid body", `{"psbt":`, http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/v1/psbt/enrich", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.handleEnrichPSBT(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response neutrino.PSBTEnrichment
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if response.Complete != tt.wantComplete || len(response.Inputs) != 1 {
+				t.Fatalf("unexpected response: %+v", response)
+			}
+			if tt.wantComplete && (response.Fee == nil || *response.Fee != 1000 || response.Inputs[0].Source != neutrino.PSBTSourceScan) {
+				t.Errorf("unexpected enriched response: %+v", response)
+			}
+			if !tt.wantComplete && response.Inputs[0].Error == "" {
+				t.Errorf("unresolved input has no error: %+v", response.Inputs[0])
+			}
+		})
+	}
+}
+
+func TestHandleMatchFilters(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		name        string
+		body        string
+		wantStatus  int
+		wantHeights []int32
+	}{
+		{
+			"addresses to tip",
+			`{"addresses":["1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"],"start_height":100}`,
+			http.StatusOK,
+			[]int32{100, 8543},
+		},
+		{
+			"scripts in range",
+			`{"scripts":["0014751e76e8199196d454941c45d1b3a323f1433bd6"],"start_height":10,"end_height":20}`,
+			http.StatusOK,
+			[]int32{10, 20},
+		},
+		{
+			"past the filter tip",
+			`{"scripts":["0014751e76e8199196d454941c45d1b3a323f1433bd6"],"start_height":8500,"end_height":8600}`,
+			http.StatusServiceUnavailable,
+			nil,
+		},
+		{"no targets", `{"start_height":1}`, http.StatusBadRequest, nil},
+		{"invalid body", `{"addresses":`, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/v1/filters/match", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var result neutrino.FilterMatchResult
+			if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if !slices.Equal(result.Heights, tt.wantHeights) {
+				t.Errorf("heights = %v, want %v", result.Heights, tt.wantHeights)
+			}
+			if result.Confidence == nil || result.Confidence.Level != neutrino.ConfidenceComplete {
+				t.Errorf("unexpected confidence: %+v", result.Confidence)
+			}
+		})
+	}
+}
+
+func TestWalletEndpoints(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"list active", "GET", "/v1/wallets", http.StatusOK, `{"wallets":[{"addresses":3,"archived":false,"name":"hot"}]}`},
+		{"list archived", "GET", "/v1/wallets?include_archived=true", http.StatusOK,
+			`{"wallets":[{"addresses":3,"archived":false,"name":"hot"},{"addresses":1,"archived":true,"archived_at":1700000000,"name":"old"}]}`},
+		{"list invalid flag", "GET", "/v1/wallets?include_archived=maybe", http.StatusBadRequest, ""},
+		{"archive", "DELETE", "/v1/wallets/hot", http.StatusOK,
+			`{"addresses":3,"archived":true,"archived_at":1700000000,"name":"hot","purge_at":1702592000}`},
+		{"archive default", "DELETE", "/v1/wallets/default", http.StatusBadRequest, ""},
+		{"archive unknown", "DELETE", "/v1/wallets/missing", http.StatusNotFound, ""},
+		{"purge", "DELETE", "/v1/wallets/old?purge=true", http.StatusOK, `{"status":"purged"}`},
+		{"purge invalid flag", "DELETE", "/v1/wallets/old?purge=maybe", http.StatusBadRequest, ""},
+		{"restore", "POST", "/v1/wallets/old/restore", http.StatusOK, `{"addresses":1,"archived":false,"name":"old"}`},
+		{"restore active", "POST", "/v1/wallets/hot/restore", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestWalletScopedEndpoints(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.Disabled)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"create", "POST", "/v1/wallets", `{"name": "shop"}`, http.StatusOK, `{"addresses":0,"archived":false,"created_at":1700000000,"name":"shop"}`},
+		{"create existing", "POST", "/v1/wallets", `{"name": "hot"}`, http.StatusConflict, ""},
+		{"create without a name", "POST", "/v1/wallets", `{}`, http.StatusBadRequest, ""},
+		{"balance", "GET", "/v1/wallets/hot/balance", "", http.StatusOK, `{"addresses":1,"balance":32500,"utxo_count":3,"wallet":"hot"}`},
+		{"balance unknown", "GET", "/v1/wallets/missing/balance", "", http.StatusNotFound, ""},
+		{"utxos", "GET", "/v1/wallets/hot/utxos?sort=value&order=desc&limit=1", "", http.StatusOK, `"total":3`},
+		{"utxos invalid sort", "GET", "/v1/wallets/hot/utxos?sort=age", "", http.StatusBadRequest, ""},
+		{"utxos unknown", "GET", "/v1/wallets/missing/utxos", "", http.StatusNotFound, ""},
+		{"history without an index", "GET", "/v1/wallets/hot/history", "", http.StatusNotFound, ""},
+		{"watched addresses of a wallet", "GET", "/v1/watch/addresses?wallet=default", "", http.StatusOK, `"wallets":["default"]`},
+		{"watched addresses of another wallet", "GET", "/v1/watch/addresses?wallet=hot", "", http.StatusOK, `{"addresses":[]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("%s %s returned %d, want %d: %s", tt.method, tt.path, rr.Code, tt.wantStatus, rr.Body)
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Errorf("%s %s = %s, want it to contain %s", tt.method, tt.path, rr.Body, tt.wantBody)
+			}
+		})
+	}
+
+	// The wallet's UTXOs are paged and sorted like those of POST /v1/utxos
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/v1/wallets/hot/utxos?sort=value&order=desc&limit=1", nil))
+	var page struct {
+		UTXOs []neutrino.UTXO `json:"utxos"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.UTXOs) != 1 || page.UTXOs[0].TxID != "cc" {
+		t.Errorf("largest UTXO of the wallet = %+v, want cc", page.UTXOs)
+	}
+}
+func TestHandleGetRawBlock(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	hash := "00000000000000000000000000000000000000000000000000000000000000aa"
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantType   string
+		wantBody   string
+	}{
+		{"hex by height", "/v1/block/800000/raw", http.StatusOK, "application/json",
+			`{"cached":false,"hash":"` + hash + `","height":800000,"hex":"01ab","size":2}`},
+		{"hex by hash", "/v1/block/hash/" + hash + "/raw?format=hex", http.StatusOK, "application/json",
+			`{"cached":false,"hash":"` + hash + `","height":700000,"hex":"01ab","size":2}`},
+		{"binary", "/v1/block/800000/raw?format=binary", http.StatusOK, "application/octet-stream", "\x01\xab"},
+		{"invalid height", "/v1/block/abc/raw", http.StatusBadRequest, "", ""},
+		{"negative height", "/v1/block/-1/raw", http.StatusBadRequest, "", ""},
+		{"invalid format", "/v1/block/800000/raw?format=json", http.StatusBadRequest, "", ""},
+		{"unknown height", "/v1/block/900000/raw", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+			if tt.wantType != "" && rr.Header().Get("Content-Type") != tt.wantType {
+				t.Errorf("Content-Type = %s, want %s", rr.Header().Get("Content-Type"), tt.wantType)
+			}
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandleGetHeaders(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantCount  int
+	}{
+		{"json range", "start=2&count=3", http.StatusOK, 3},
+		{"default count", "start=0", http.StatusOK, 11},
+		{"cut at tip", "start=8&count=10", http.StatusOK, 3},
+		{"hex", "start=2&count=3&format=hex", http.StatusOK, 3},
+		{"missing start", "count=3", http.StatusBadRequest, 0},
+		{"invalid count", "start=0&count=abc", http.StatusBadRequest, 0},
+		{"count too large", "start=0&count=2001", http.StatusBadRequest, 0},
+		{"invalid format", "start=0&format=raw", http.StatusBadRequest, 0},
+		{"past tip", "start=11", http.StatusNotFound, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/v1/headers?"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Start   int64            `json:"start"`
+				Count   int              `json:"count"`
+				Headers []map[string]any `json:"headers"`
+				Hex     string           `json:"hex"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.Count != tt.wantCount {
+				t.Errorf("count = %d, want %d", resp.Count, tt.wantCount)
+			}
+
+			if strings.Contains(tt.query, "format=hex") {
+				if len(resp.Hex) != tt.wantCount*80*2 {
+					t.Errorf("hex length = %d, want %d", len(resp.Hex), tt.wantCount*80*2)
+				}
+				return
+			}
+			if len(resp.Headers) != tt.wantCount {
+				t.Fatalf("got %d headers, want %d", len(resp.Headers), tt.wantCount)
+			}
+			if height := resp.Headers[0]["height"].(float64); int64(height) != resp.Start {
+				t.Errorf("first header height = %v, want %d", height, resp.Start)
+			}
+		})
+	}
+}
+
+func TestWatchListEndpoints(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"list", "GET", "/v1/watch/addresses", http.StatusOK,
+			`{"addresses":[{"added_height":800000,"address":"12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S","scanned_height":800100,"wallets":["default"]}]}`},
+		{"unwatch", "DELETE", "/v1/watch/address/12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S", http.StatusOK, `{"status":"ok"}`},
+		{"unwatch unknown", "DELETE", "/v1/watch/address/1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestWebhookEndpoints(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"register", "POST", "/v1/webhooks", `{"url": "https://example.com/hook", "events": ["address_activity"], "wallet": "shop"}`, http.StatusOK,
+			`{"created_at":1700000000,"events":["address_activity"],"id":1,"secret":"s3cret","url":"https://example.com/hook","wallet":"shop"}`},
+		{"register invalid", "POST", "/v1/webhooks", `{"url": "https://example.com/hook"}`, http.StatusBadRequest, ""},
+		{"register bad body", "POST", "/v1/webhooks", `{`, http.StatusBadRequest, ""},
+		{"list", "GET", "/v1/webhooks", "", http.StatusOK,
+			`{"webhooks":[{"created_at":1700000000,"events":["new_block"],"id":1,"url":"https://example.com/hook"}]}`},
+		{"delete", "DELETE", "/v1/webhooks/1", "", http.StatusOK, `{"status":"ok"}`},
+		{"delete unknown", "DELETE", "/v1/webhooks/2", "", http.StatusNotFound, ""},
+		{"delete invalid id", "DELETE", "/v1/webhooks/abc", "", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestTrackTransactionEndpoints(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	txid := "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16"
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"track", "POST", "/v1/tx/" + txid + "/track", `{"confirmations": 3, "address": "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "start_height": 100}`, http.StatusOK,
+			`{"address":"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa","confirmations":0,"created_at":0,"scanned_height":99,"status":"pending","target_confirmations":3,"txid":"` + txid + `","updated_at":0}`},
+		{"track default start", "POST", "/v1/tx/" + txid + "/track", `{"address": "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"}`, http.StatusOK,
+			`{"address":"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa","confirmations":0,"created_at":0,"scanned_height":8399,"status":"pending","target_confirmations":1,"txid":"` + txid + `","updated_at":0}`},
+		{"track with inputs", "POST", "/v1/tx/" + txid + "/track", `{"address": "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "inputs": ["` + txid + `:0"], "start_height": 100}`, http.StatusOK,
+			`{"address":"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa","confirmations":0,"created_at":0,"inputs":["` + txid + `:0"],"scanned_height":99,"status":"pending","target_confirmations":1,"txid":"` + txid + `","updated_at":0}`},
+		{"track without address", "POST", "/v1/tx/" + txid + "/track", `{"confirmations": 3}`, http.StatusBadRequest, ""},
+		{"track negative start", "POST", "/v1/tx/" + txid + "/track", `{"address": "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "start_height": -5}`, http.StatusBadRequest, ""},
+		{"track invalid txid", "POST", "/v1/tx/abc/track", `{"address": "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"}`, http.StatusBadRequest, ""},
+		{"track bad body", "POST", "/v1/tx/" + txid + "/track", `{`, http.StatusBadRequest, ""},
+		{"status", "GET", "/v1/tx/" + txid + "/track", "", http.StatusOK,
+			`{"address":"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa","block_hash":"00000000000000000000000000000000000000000000000000000000000000aa","block_height":170,"confirmations":6,"created_at":0,"scanned_height":170,"status":"confirmed","target_confirmations":6,"txid":"` + txid + `","updated_at":0}`},
+		{"status untracked", "GET", "/v1/tx/abc/track", "", http.StatusNotFound, ""},
+		{"untrack", "DELETE", "/v1/tx/" + txid + "/track", "", http.StatusOK, `{"status":"ok"}`},
+		{"untrack unknown", "DELETE", "/v1/tx/abc/track", "", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestBroadcastStatusEndpoint(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	txid := "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16"
+	tests := []struct {
+		name       string
+		txid       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"broadcast", txid, http.StatusOK,
+			`{"attempts":2,"block_hash":"00000000000000000000000000000000000000000000000000000000000000aa","block_height":170,"confirmations":3,"first_broadcast_at":1700000000,"last_broadcast_at":1700000600,"peers_announced":8,"rebroadcasts":1,"status":"confirmed","txid":"` + txid + `"}`},
+		{"unknown", "ea44e97271691990157559d0bdd9959e02790c34db6c006d779e82fa5aee708e", http.StatusNotFound, ""},
+		{"invalid txid", "not-a-txid", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/v1/tx/broadcast/"+tt.txid+"/status", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestWatchOutpointEndpoints(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	txid := "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16"
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"subscribe", "POST", "/v1/watch/outpoint", `{"txid": "` + txid + `", "vout": 1, "script_pubkey": "0014751e76e8199196d454941c45d1b3a323f1433bd6", "start_height": 170}`, http.StatusOK,
+			`{"created_at":0,"scanned_height":169,"script_pubkey":"0014751e76e8199196d454941c45d1b3a323f1433bd6","spent":false,"txid":"` + txid + `","vout":1}`},
+		{"subscribe new blocks only", "POST", "/v1/watch/outpoint", `{"txid": "` + txid + `", "script_pubkey": "0014751e76e8199196d454941c45d1b3a323f1433bd6"}`, http.StatusOK,
+			`{"created_at":0,"scanned_height":8543,"script_pubkey":"0014751e76e8199196d454941c45d1b3a323f1433bd6","spent":false,"txid":"` + txid + `","vout":0}`},
+		{"subscribe without script", "POST", "/v1/watch/outpoint", `{"txid": "` + txid + `", "vout": 0}`, http.StatusBadRequest, ""},
+		{"subscribe negative start", "POST", "/v1/watch/outpoint", `{"txid": "` + txid + `", "script_pubkey": "00", "start_height": -1}`, http.StatusBadRequest, ""},
+		{"subscribe invalid txid", "POST", "/v1/watch/outpoint", `{"txid": "abc", "script_pubkey": "00"}`, http.StatusBadRequest, ""},
+		{"subscribe bad body", "POST", "/v1/watch/outpoint", `{`, http.StatusBadRequest, ""},
+		{"list", "GET", "/v1/watch/outpoints", "", http.StatusOK,
+			`{"outpoints":[{"created_at":0,"scanned_height":200,"script_pubkey":"0014751e76e8199196d454941c45d1b3a323f1433bd6","spending_height":200,"spending_txid":"ea44e97271691990157559d0bdd9959e02790c34db6c006d779e82fa5aee708e","spent":true,"txid":"` + txid + `","vout":0}]}`},
+		{"unsubscribe", "DELETE", "/v1/watch/outpoint/" + txid + "/0", "", http.StatusOK, `{"status":"ok"}`},
+		{"unsubscribe unknown", "DELETE", "/v1/watch/outpoint/" + txid + "/1", "", http.StatusNotFound, ""},
+		{"unsubscribe invalid vout", "DELETE", "/v1/watch/outpoint/" + txid + "/x", "", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestPeerEndpoints(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"list", "GET", "/v1/peers", "", http.StatusOK,
+			`{"count":1,"peers":[{"addr":"10.0.0.1:8333","connected_at":1700000000,"height":850000,"inbound":false,"services":"SFNodeNetwork|SFNodeCF","user_agent":"/Satoshi:27.0.0/"}]}`},
+		{"diversity", "GET", "/v1/peers/diversity", "", http.StatusOK,
+			`{"asn_mapped":false,"by_group":[{"group":"local","network":"local","peers":["10.0.0.1:8333"]}],"diverse":true,"groups":1,"max_peers_per_group":2,"mix_networks":false,"networks":{"local":1},"peers":1,"warnings":[]}`},
+		{"connect", "POST", "/v1/peers/connect", `{"addr": "10.0.0.2:8333", "permanent": true}`, http.StatusAccepted,
+			`{"addr":"10.0.0.2:8333","permanent":true,"status":"connecting"}`},
+		{"connect connected peer", "POST", "/v1/peers/connect", `{"addr": "10.0.0.1:8333"}`, http.StatusConflict, ""},
+		{"connect without address", "POST", "/v1/peers/connect", `{}`, http.StatusBadRequest, ""},
+		{"connect bad body", "POST", "/v1/peers/connect", `{`, http.StatusBadRequest, ""},
+		{"disconnect", "POST", "/v1/peers/10.0.0.1:8333/disconnect", "", http.StatusOK, `{"status":"ok"}`},
+		{"disconnect unknown", "POST", "/v1/peers/10.0.0.9:8333/disconnect", "", http.StatusNotFound, ""},
+		{"ban", "POST", "/v1/peers/10.0.0.1:8333/ban", "", http.StatusOK, `{"status":"ok"}`},
+		{"ban onion", "POST", "/v1/peers/example.onion:8333/ban", "", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("handler returned %s, want %s", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestBanEndpoints(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"list", "GET", "/v1/admin/bans", "", http.StatusOK,
+			`{"bans":[{"addr":"10.0.0.0/24","created_at":1700000000,"expires_at":1700086400,"reason":"stalled sync"}]}`},
+		{"add", "POST", "/v1/admin/bans", `{"addr": "10.0.0.5", "reason": "bad filters", "duration": "1h"}`, http.StatusOK,
+			`{"addr":"10.0.0.5","created_at":1700000000,"expires_at":1700003600,"reason":"bad filters"}`},
+		{"add with default duration", "POST", "/v1/admin/bans", `{"addr": "10.0.0.5"}`, http.StatusOK,
+			`{"addr":"10.0.0.5","created_at":1700000000,"expires_at":1700086400}`},
+		{"add invalid duration", "POST", "/v1/admin/bans", `{"addr": "10.0.0.5", "duration": "-1h"}`, http.StatusBadRequest, ""},
+		{"add onion", "POST", "/v1/admin/bans", `{"addr": "example.onion"}`, http.StatusBadRequest, ""},
+		{"add without address", "POST", "/v1/admin/bans", `{}`, http.StatusBadRequest, ""},
+		{"remove network", "DELETE", "/v1/admin/bans/10.0.0.0/24", "", http.StatusOK, `{"status":"ok"}`},
+		{"remove unknown", "DELETE", "/v1/admin/bans/10.0.0.5", "", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("handler returned %s, want %s", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHandleCacheStats(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.Disabled)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/v1/admin/cache", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	want := `{"block_cache":{"capacity_bytes":41943040,"entries":25,"evictions":7,"hit_ratio":0.5,"hits":2,"misses":2,"size_bytes":39845888},` +
+		`"filter_cache":{"capacity_bytes":31457280,"entries":4000,"evictions":0,"hit_ratio":0.75,"hits":3,"misses":1,"size_bytes":12582912}}`
+	if got := rr.Body.String(); got != want {
+		t.Errorf("handler returned %s, want %s", got, want)
+	}
+}
+
+func TestHandleCreateBackup(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"default name", "", http.StatusAccepted,
+			`{"name":"neutrino-mainnet-20231114T221320Z","started_at":1700000000,"status":"running","status_url":"/v1/admin/backup/neutrino-mainnet-20231114T221320Z"}`},
+		{"named", `{"name": "v2-upgrade"}`, http.StatusAccepted, ""},
+		{"existing name", `{"name": "pre-upgrade"}`, http.StatusConflict, ""},
+		{"path as name", `{"name": "../etc"}`, http.StatusBadRequest, ""},
+		{"invalid body", `{"name":`, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/v1/admin/backup", bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("handler returned %s, want %s", rr.Body.String(), tt.wantBody)
+			}
+			if rr.Code == http.StatusAccepted && !strings.HasPrefix(rr.Header().Get("Location"), "/v1/admin/backup/") {
+				t.Errorf("Location = %q, want the status URL", rr.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestHandleBackupStatus(t *testing.T) {
+	backend := btclog.NewBackend(os.Stdout)
+	logger := backend.Logger("TEST")
+
+	handler := NewHandler(&mockNode{}, logger)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		name       string
+		backup     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"done", "v2-upgrade", http.StatusOK,
+			`{"backup":{"block_hash":"00000000000000000002a0b5db2a7f8d9087464c2586b546be7bce8eb53b8187","block_height":8543,"created":1700000000,"filter_height":8543,"path":"/data/neutrino/backups/v2-upgrade","size":4096},"finished_at":1700000005,"name":"v2-upgrade","started_at":1700000000,"status":"done"}`},
+		{"failed", "full-disk", http.StatusOK,
+			`{"error":"failed to back up to /data/neutrino/backups/full-disk: no space left on device","finished_at":1700000002,"name":"full-disk","started_at":1700000000,"status":"failed"}`},
+		{"unknown", "never-taken", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/v1/admin/backup/"+tt.backup, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("handler returned %s, want %s", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
 }
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/auth"
+)
+
+// Listener is an address the API is served on, with its own TLS and
+// authentication settings, so the admin surface can be bound more narrowly
+// than the read-only one.
+type Listener struct {
+	// Network is "tcp" or "unix".
+	Network string
+	Address string
+
+	// TLS serves the listener over TLS. Nil leaves it to the server: TCP
+	// listeners use TLS when a certificate is configured.
+	TLS *bool
+
+	// NoAuth serves requests without an API key or client certificate,
+	// for listeners only trusted local clients can reach. Clients of other
+	// hosts still need one unless Remote is set.
+	NoAuth bool
+
+	// Remote lets NoAuth serve clients of other hosts too, for listeners
+	// reachable only over a trusted network.
+	Remote bool
+
+	// Onion marks the listener Tor forwards onion service connections to.
+	// It must be a TCP listener requiring authentication, and its clients
+	// are told apart by their API key or certificate only, since they all
+	// connect from Tor's address.
+	Onion bool
+
+	// Scopes limits the endpoints served to those of the scopes; other
+	// endpoints are answered with 403. Nil serves every endpoint.
+	Scopes []auth.Scope
+}
+
+// ParseListener parses a listen address with optional settings given as a
+// query, such as 0.0.0.0:8334?scopes=read,broadcast or
+// unix:/run/neutrinod.sock?auth=none. Settings are tls (true or false),
+// auth (required or none), remote (true or false), onion (true or false)
+// and scopes. auth=none is refused for TCP addresses other than loopback
+// ones unless remote=true, and for onion listeners.
+func ParseListener(spec string) (Listener, error) {
+	address, query, _ := strings.Cut(spec, "?")
+	l := Listener{Network: "tcp", Address: address}
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		l.Network, l.Address = "unix", path
+	}
+	if l.Address == "" {
+		return Listener{}, fmt.Errorf("invalid listen address %q: no address", spec)
+	}
+
+	settings, err := url.ParseQuery(query)
+	if err != nil {
+		return Listener{}, fmt.Errorf("invalid listen address %q: %w", spec, err)
+	}
+	for name, values := range settings {
+		value := values[len(values)-1]
+		switch name {
+		case "tls":
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return Listener{}, fmt.Errorf("invalid listen address %q: tls must be true or false", spec)
+			}
+			l.TLS = &enabled
+		case "auth":
+			switch value {
+			case "required":
+			case "none":
+				l.NoAuth = true
+			default:
+				return Listener{}, fmt.Errorf("invalid listen address %q: auth must be required or none", spec)
+			}
+		case "remote":
+			l.Remote, err = strconv.ParseBool(value)
+			if err != nil {
+				return Listener{}, fmt.Errorf("invalid listen address %q: remote must be true or false", spec)
+			}
+		case "onion":
+			l.Onion, err = strconv.ParseBool(value)
+			if err != nil {
+				return Listener{}, fmt.Errorf("invalid listen address %q: onion must be true or false", spec)
+			}
+		case "scopes":
+			l.Scopes, err = auth.ParseScopes(value)
+			if err != nil {
+				return Listener{}, fmt.Errorf("invalid listen address %q: %w", spec, err)
+			}
+		default:
+			return Listener{}, fmt.Errorf("invalid listen address %q: unknown setting %s", spec, name)
+		}
+	}
+	if l.Remote && !l.NoAuth {
+		return Listener{}, fmt.Errorf("invalid listen address %q: remote only applies to auth=none", spec)
+	}
+	if l.Onion && (l.NoAuth || l.Network != "tcp") {
+		return Listener{}, fmt.Errorf("invalid listen address %q: an onion listener must be a TCP address requiring authentication", spec)
+	}
+	if l.NoAuth && !l.Remote && !l.loopback() {
+		return Listener{}, fmt.Errorf("invalid listen address %q: auth=none serves only unix sockets and loopback addresses; add remote=true to serve other hosts without authentication", spec)
+	}
+	return l, nil
+}
+
+// loopback reports whether l is a unix socket or bound to a loopback
+// address, so only clients on this host can reach it.
+func (l Listener) loopback() bool {
+	if l.Network == "unix" {
+		return true
+	}
+	host, _, err := net.SplitHostPort(l.Address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// String returns the listener's address as it is logged.
+func (l Listener) String() string {
+	if l.Network == "unix" {
+		return "unix:" + l.Address
+	}
+	return l.Address
+}
+
+// listenerContextKey is the context key of the listener of a request.
+type listenerContextKey struct{}
+
+// ServeListener returns next serving requests received on l, so the API's
+// middleware applies l's settings to them.
+func ServeListener(l Listener, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), listenerContextKey{}, l)))
+	})
+}
+
+// requestListener returns the listener r was received on. Requests served
+// without ServeListener get the zero Listener, which restricts nothing.
+func requestListener(r *http.Request) Listener {
+	l, _ := r.Context().Value(listenerContextKey{}).(Listener)
+	return l
+}
+
+// serves reports whether the listener serves endpoints needing scope.
+func (l Listener) serves(scope auth.Scope) bool {
+	return l.Scopes == nil || auth.Allows(l.Scopes, scope)
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+	"github.com/gorilla/mux"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/auth"
+)
+
+func TestParseListener(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		spec    string
+		want    Listener
+		wantErr bool
+	}{
+		{"0.0.0.0:8334", Listener{Network: "tcp", Address: "0.0.0.0:8334"}, false},
+		{"unix:/run/neutrinod.sock?auth=none", Listener{Network: "unix", Address: "/run/neutrinod.sock", NoAuth: true}, false},
+		{"0.0.0.0:8334?tls=true&scopes=read,broadcast", Listener{Network: "tcp", Address: "0.0.0.0:8334", TLS: &enabled, Scopes: []auth.Scope{auth.ScopeRead, auth.ScopeBroadcast}}, false},
+		{"127.0.0.1:8335?tls=false&auth=required", Listener{Network: "tcp", Address: "127.0.0.1:8335", TLS: &disabled}, false},
+		{"", Listener{}, true},
+		{"unix:", Listener{}, true},
+		{"0.0.0.0:8334?tls=maybe", Listener{}, true},
+		{"0.0.0.0:8334?auth=optional", Listener{}, true},
+		{"0.0.0.0:8334?scopes=write", Listener{}, true},
+		{"0.0.0.0:8334?port=1", Listener{}, true},
+		{"127.0.0.1:8335?auth=none", Listener{Network: "tcp", Address: "127.0.0.1:8335", NoAuth: true}, false},
+		{"[::1]:8335?auth=none", Listener{Network: "tcp", Address: "[::1]:8335", NoAuth: true}, false},
+		{"localhost:8335?auth=none", Listener{Network: "tcp", Address: "localhost:8335", NoAuth: true}, false},
+		{"0.0.0.0:8335?auth=none", Listener{}, true},
+		{":8335?auth=none", Listener{}, true},
+		{"10.0.0.5:8335?auth=none", Listener{}, true},
+		{"10.0.0.5:8335?auth=none&remote=true", Listener{Network: "tcp", Address: "10.0.0.5:8335", NoAuth: true, Remote: true}, false},
+		{"10.0.0.5:8335?remote=true", Listener{}, true},
+		{"10.0.0.5:8335?auth=none&remote=maybe", Listener{}, true},
+		{"127.0.0.1:8336?onion=true", Listener{Network: "tcp", Address: "127.0.0.1:8336", Onion: true}, false},
+		{"127.0.0.1:8336?onion=true&auth=none", Listener{}, true},
+		{"unix:/run/onion.sock?onion=true", Listener{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseListener(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseListener() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Network != tt.want.Network || got.Address != tt.want.Address || got.NoAuth != tt.want.NoAuth || got.Remote != tt.want.Remote || got.Onion != tt.want.Onion ||
+				(got.TLS == nil) != (tt.want.TLS == nil) || (got.TLS != nil && *got.TLS != *tt.want.TLS) ||
+				!slices.Equal(got.Scopes, tt.want.Scopes) {
+				t.Errorf("ParseListener() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeListener(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.Disabled)
+	handler.SetKeyring(newTestKeyring(t))
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	public := ServeListener(Listener{Network: "tcp", Address: "0.0.0.0:8334", Scopes: []auth.Scope{auth.ScopeRead}}, router)
+	local := ServeListener(Listener{Network: "unix", Address: "/run/neutrinod.sock", NoAuth: true}, router)
+	loopback := ServeListener(Listener{Network: "tcp", Address: "0.0.0.0:8335", NoAuth: true}, router)
+	trusted := ServeListener(Listener{Network: "tcp", Address: "10.0.0.5:8335", NoAuth: true, Remote: true}, router)
+
+	tests := []struct {
+		name       string
+		listener   http.Handler
+		method     string
+		path       string
+		key        string
+		remote     string
+		wantStatus int
+	}{
+		{"read on public", public, "GET", "/v1/status", "read-secret", "", http.StatusOK},
+		{"admin key on public", public, "GET", "/v1/admin/keys", "admin-secret", "", http.StatusForbidden},
+		{"rescan on public", public, "POST", "/v1/rescan", "admin-secret", "", http.StatusForbidden},
+		{"probe on public", public, "GET", "/readyz", "", "", http.StatusOK},
+		{"no key on public", public, "GET", "/v1/status", "", "", http.StatusUnauthorized},
+		{"admin on local without a key", local, "GET", "/v1/admin/keys", "", "", http.StatusOK},
+		{"loopback client without a key", loopback, "GET", "/v1/status", "", "127.0.0.1:50000", http.StatusOK},
+		{"remote client without a key", loopback, "GET", "/v1/status", "", "", http.StatusUnauthorized},
+		{"remote client with a key", loopback, "GET", "/v1/status", "read-secret", "", http.StatusOK},
+		{"remote client on a remote listener", trusted, "GET", "/v1/status", "", "", http.StatusOK},
+		{"no key on the router itself", router, "GET", "/v1/status", "", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.key != "" {
+				req.Header.Set(apiKeyHeader, tt.key)
+			}
+			if tt.remote != "" {
+				req.RemoteAddr = tt.remote
+			}
+			rr := httptest.NewRecorder()
+			tt.listener.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+		})
+	}
+}
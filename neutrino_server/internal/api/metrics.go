@@ -0,0 +1,236 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/neutrino"
+)
+
+// latencyBuckets are the upper bounds in seconds of the request latency
+// histogram. They run past the usual web latencies since UTXO lookups and
+// filter matches scan ranges of blocks.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// routeKey identifies a route by method and path template, so requests for
+// different txids or addresses share a series.
+type routeKey struct {
+	method string
+	route  string
+}
+
+// routeStats are the requests served by one route.
+type routeStats struct {
+	codes   map[int]uint64
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// httpMetrics counts requests and their latencies per route.
+type httpMetrics struct {
+	mu     sync.Mutex
+	routes map[routeKey]*routeStats
+}
+
+func newHTTPMetrics() *httpMetrics {
+	return &httpMetrics{routes: make(map[routeKey]*routeStats)}
+}
+
+// observe records a request to key answered with code after elapsed.
+func (m *httpMetrics) observe(key routeKey, code int, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats, ok := m.routes[key]
+	if !ok {
+		stats = &routeStats{codes: make(map[int]uint64), buckets: make([]uint64, len(latencyBuckets))}
+		m.routes[key] = stats
+	}
+	seconds := elapsed.Seconds()
+	stats.codes[code]++
+	stats.count++
+	stats.sum += seconds
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			stats.buckets[i]++
+		}
+	}
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap returns the wrapped writer, so handlers can move its deadlines.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// routeTemplate returns the path template of the route matching r, so
+// requests for different txids or addresses are reported together.
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return r.URL.Path
+}
+
+// metricsMiddleware records the status and latency of every request to a
+// registered route.
+func (h *Handler) metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+
+		started := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		h.metrics.observe(routeKey{method: r.Method, route: route}, recorder.code, time.Since(started))
+	})
+}
+
+// Prometheus metrics endpoint
+func (h *Handler) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	// API replicas serving the address index have no node
+	if h.node != nil {
+		writeNodeMetrics(&buf, h.node.Metrics())
+	}
+	h.metrics.write(&buf)
+	h.writeScanPoolMetrics(&buf)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// writeNodeMetrics writes the node's metrics in the Prometheus text format.
+func writeNodeMetrics(buf *bytes.Buffer, m neutrino.Metrics) {
+	synced := 0
+	if m.Synced {
+		synced = 1
+	}
+	writeMetric(buf, "neutrino_synced", "gauge", "Whether the header chain is current (1) or still syncing (0).", float64(synced))
+	writeMetric(buf, "neutrino_block_height", "gauge", "Height of the best block header.", float64(m.BlockHeight))
+	writeMetric(buf, "neutrino_filter_height", "gauge", "Height of the best compact filter header.", float64(m.FilterHeight))
+	writeMetric(buf, "neutrino_peers", "gauge", "Number of connected peers.", float64(m.Peers))
+	writeMetric(buf, "neutrino_rescan_jobs", "gauge", "Number of running rescan jobs.", float64(m.RescanJobs))
+	writeMetric(buf, "neutrino_rescan_blocks_per_second", "gauge", "Combined scan rate of the running rescan jobs.", m.RescanBlocksPerSecond)
+	writeMetric(buf, "neutrino_scanned_blocks_total", "counter", "Blocks checked by rescans.", float64(m.BlocksScanned))
+	writeMetric(buf, "neutrino_filter_cache_hits_total", "counter", "Filters scans found in the filter cache.", float64(m.FilterCacheHits))
+	writeMetric(buf, "neutrino_filter_cache_misses_total", "counter", "Filters scans fetched from disk or peers.", float64(m.FilterCacheMisses))
+
+	ratio := 0.0
+	if lookups := m.FilterCacheHits + m.FilterCacheMisses; lookups > 0 {
+		ratio = float64(m.FilterCacheHits) / float64(lookups)
+	}
+	writeMetric(buf, "neutrino_filter_cache_hit_ratio", "gauge", "Share of filter lookups served by the filter cache.", ratio)
+	writeMetric(buf, "neutrino_block_cache_hits_total", "counter", "Blocks scans found in the in-memory block cache.", float64(m.BlockCacheHits))
+	writeMetric(buf, "neutrino_block_cache_misses_total", "counter", "Blocks scans downloaded from peers.", float64(m.BlockCacheMisses))
+	writeMetric(buf, "neutrino_scan_cache_hits_total", "counter", "Filter matches of a script in a segment found in the scan cache.", float64(m.ScanCacheHits))
+	writeMetric(buf, "neutrino_scan_cache_misses_total", "counter", "Filter matches of a script in a segment scanned for.", float64(m.ScanCacheMisses))
+	writeMetric(buf, "neutrino_scan_memo_hits_total", "counter", "Filter checks skipped because an earlier scan found no match.", float64(m.ScanMemoHits))
+	writeMetric(buf, "neutrino_scan_shared_fetches_total", "counter", "Filter batches, filters and blocks a scan shared with a concurrent scan fetching them.", float64(m.SharedFetches))
+
+	writeHeader(buf, "neutrino_broadcasts_total", "counter", "Transaction sends to peers by result.")
+	for _, result := range []struct {
+		name  string
+		value uint64
+	}{
+		{"sent", m.BroadcastsSent},
+		{"rebroadcast", m.Rebroadcasts},
+		{"failed", m.BroadcastsFailed},
+		{"rejected", m.BroadcastsRejected},
+	} {
+		fmt.Fprintf(buf, "neutrino_broadcasts_total{result=%s} %d\n", labelValue(result.name), result.value)
+	}
+	writeMetric(buf, "neutrino_pending_broadcasts", "gauge", "Broadcast transactions not yet confirmed.", float64(m.PendingBroadcasts))
+
+	stalled := 0
+	if m.SyncStalled {
+		stalled = 1
+	}
+	writeMetric(buf, "neutrino_sync_stalled", "gauge", "Whether sync is stalled (1) with peers ahead.", float64(stalled))
+	writeMetric(buf, "neutrino_sync_stalls_total", "counter", "Sync stalls detected.", float64(m.SyncStalls))
+}
+
+// write writes the request counts and latency histograms in the
+// Prometheus text format, in a stable order.
+func (m *httpMetrics) write(buf *bytes.Buffer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]routeKey, 0, len(m.routes))
+	for key := range m.routes {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b routeKey) int {
+		if c := strings.Compare(a.route, b.route); c != 0 {
+			return c
+		}
+		return strings.Compare(a.method, b.method)
+	})
+
+	writeHeader(buf, "neutrino_http_requests_total", "counter", "HTTP requests by route, method and status code.")
+	for _, key := range keys {
+		stats := m.routes[key]
+		codes := make([]int, 0, len(stats.codes))
+		for code := range stats.codes {
+			codes = append(codes, code)
+		}
+		slices.Sort(codes)
+		for _, code := range codes {
+			fmt.Fprintf(buf, "neutrino_http_requests_total{method=%s,route=%s,code=\"%d\"} %d\n",
+				labelValue(key.method), labelValue(key.route), code, stats.codes[code])
+		}
+	}
+
+	writeHeader(buf, "neutrino_http_request_duration_seconds", "histogram", "HTTP request latencies by route and method.")
+	for _, key := range keys {
+		stats := m.routes[key]
+		labels := fmt.Sprintf("method=%s,route=%s", labelValue(key.method), labelValue(key.route))
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(buf, "neutrino_http_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				labels, strconv.FormatFloat(bound, 'g', -1, 64), stats.buckets[i])
+		}
+		fmt.Fprintf(buf, "neutrino_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, stats.count)
+		fmt.Fprintf(buf, "neutrino_http_request_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(stats.sum, 'g', -1, 64))
+		fmt.Fprintf(buf, "neutrino_http_request_duration_seconds_count{%s} %d\n", labels, stats.count)
+	}
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric.
+func writeHeader(buf *bytes.Buffer, name, kind, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeMetric writes a metric with a single unlabelled sample.
+func writeMetric(buf *bytes.Buffer, name, kind, help string, value float64) {
+	writeHeader(buf, name, kind, help)
+	fmt.Fprintf(buf, "%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// labelValue quotes a label value, escaping backslashes, quotes and
+// newlines as the text format requires.
+func labelValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	return `"` + value + `"`
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+	"github.com/gorilla/mux"
+)
+
+func TestHandleMetrics(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.Disabled)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	for _, path := range []string{"/v1/status", "/v1/status", "/v1/block/notanumber/header"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if contentType := rr.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+
+	body := rr.Body.String()
+	for _, want := range []string{
+		"# TYPE neutrino_block_height gauge\nneutrino_block_height 850000\n",
+		"neutrino_filter_height 849990\n",
+		"neutrino_peers 8\n",
+		"neutrino_synced 1\n",
+		"neutrino_scanned_blocks_total 1200\n",
+		"neutrino_filter_cache_hit_ratio 0.75\n",
+		"neutrino_block_cache_hits_total 5\n",
+		"neutrino_block_cache_misses_total 2\n",
+		`neutrino_broadcasts_total{result="sent"} 2` + "\n",
+		`neutrino_broadcasts_total{result="failed"} 1` + "\n",
+		"neutrino_sync_stalled 0\n",
+		"neutrino_sync_stalls_total 1\n",
+		`neutrino_http_requests_total{method="GET",route="/v1/status",code="200"} 2` + "\n",
+		`neutrino_http_requests_total{method="GET",route="/v1/block/{height}/header",code="400"} 1` + "\n",
+		`neutrino_http_request_duration_seconds_bucket{method="GET",route="/v1/status",le="+Inf"} 2` + "\n",
+		`neutrino_http_request_duration_seconds_count{method="GET",route="/v1/status"} 2` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestLabelValue(t *testing.T) {
+	if got := labelValue("a\"b\\c\nd"); got != `"a\"b\\c\nd"` {
+		t.Errorf("labelValue() = %s", got)
+	}
+}
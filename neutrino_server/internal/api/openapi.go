@@ -0,0 +1,923 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gorilla/mux"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/addrindex"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/auth"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/buildinfo"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/neutrino"
+)
+
+// openAPIPath is where the OpenAPI document is served.
+const openAPIPath = "/v1/openapi.json"
+
+// routeDoc describes a route in the OpenAPI document. Request and response
+// are values of the Go types encoded as the request and response bodies, from
+// which their schemas are derived.
+type routeDoc struct {
+	summary  string
+	tag      string
+	params   []paramDoc
+	request  any
+	response any
+
+	// status is the status of a successful response, 200 if zero
+	status int
+
+	// raw is the media type of a response that is not JSON, served instead
+	// of or, if response is set, besides the JSON one
+	raw string
+
+	// optionalBody marks routes that accept requests without a body
+	optionalBody bool
+
+	// scan marks routes that scan filters and blocks, which queue for a
+	// scan slot and take a timeout parameter
+	scan bool
+}
+
+// paramDoc describes a query parameter or, with path set, a path parameter.
+// Path parameters without a paramDoc are documented as strings.
+type paramDoc struct {
+	name        string
+	kind        string
+	description string
+	enum        []string
+	path        bool
+}
+
+// oneOf is a response with several shapes, such as a route answering
+// differently depending on its parameters.
+type oneOf []any
+
+// statusResponse is the response of routes that only acknowledge a change.
+type statusResponse struct {
+	Status string `json:"status"`
+}
+
+// blockHeaderResponse is a block header as the header endpoints return it.
+type blockHeaderResponse struct {
+	Hash       string `json:"hash"`
+	Height     int64  `json:"height"`
+	Timestamp  int64  `json:"timestamp"`
+	Version    int32  `json:"version"`
+	PrevBlock  string `json:"prev_block"`
+	MerkleRoot string `json:"merkle_root"`
+	Bits       uint32 `json:"bits"`
+	Nonce      uint32 `json:"nonce"`
+}
+
+// utxoPage is a page of UTXOs as the UTXO listings return it.
+type utxoPage struct {
+	UTXOs      []neutrino.UTXO      `json:"utxos"`
+	Total      int                  `json:"total"`
+	Limit      int                  `json:"limit"`
+	Offset     int                  `json:"offset"`
+	Confidence *neutrino.Confidence `json:"confidence"`
+}
+
+// errorBody is the body of every error response. Body errors also give a
+// reason and the offending field.
+type errorBody struct {
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Field     string `json:"field,omitempty"`
+}
+
+// scanDeadlineBody is the body of scans stopped at their deadline.
+type scanDeadlineBody struct {
+	Error        string  `json:"error"`
+	RequestID    string  `json:"request_id,omitempty"`
+	ResumeHeight int32   `json:"resume_height"`
+	Heights      []int32 `json:"heights,omitempty"`
+}
+
+func query(name, kind, description string, enum ...string) paramDoc {
+	return paramDoc{name: name, kind: kind, description: description, enum: enum}
+}
+
+func pathParam(name, kind, description string) paramDoc {
+	return paramDoc{name: name, kind: kind, description: description, path: true}
+}
+
+var (
+	startHeightParam = query("start_height", "integer", "Height to start scanning from, at or before the block creating the output")
+	walletParam      = query("wallet", "string", "Wallet to return events of, the default wallet if omitted")
+	heightParam      = pathParam("height", "integer", "Block height")
+	voutParam        = pathParam("vout", "integer", "Output index")
+	numericIDParam   = pathParam("id", "integer", "ID returned when the resource was created")
+	utxoSortParam    = query("sort", "string", "Field UTXOs are sorted by, height by default", "value", "height", "txid")
+	utxoOrderParam   = query("order", "string", "Sort ascending (default) or descending", "asc", "desc")
+	walletIDParam    = pathParam("id", "string", "Wallet name")
+	walletScopeParam = query("wallet", "string", "Only list those of this wallet")
+)
+
+// utxoPageParams are the query parameters of the UTXO listings that page,
+// filter and sort them.
+var utxoPageParams = []paramDoc{
+	query("limit", "integer", "Maximum number of UTXOs, 1000 by default and at most 10000"),
+	query("offset", "integer", "Number of UTXOs to skip"),
+	query("min_conf", "integer", "Only UTXOs with at least this many confirmations"),
+	query("max_conf", "integer", "Only UTXOs with at most this many confirmations"),
+	query("min_value", "integer", "Only UTXOs worth at least this many satoshis"),
+	utxoSortParam,
+	utxoOrderParam,
+}
+
+// routeDocs documents every route of RegisterRoutes and RegisterIndexRoutes.
+var routeDocs = map[routeKey]routeDoc{
+	{"GET", "/v1/status"}: {summary: "Node and sync status", tag: "Status", response: neutrino.Status{}},
+	{"GET", "/healthz"}:   {summary: "Liveness probe", tag: "Status", response: statusResponse{}},
+	{"GET", "/readyz"}:    {summary: "Readiness probe, answered with 503 while not ready", tag: "Status", response: neutrino.Readiness{}},
+	{"GET", "/metrics"}:   {summary: "Prometheus metrics", tag: "Status", raw: "text/plain"},
+	{"GET", "/v1/info"}:   {summary: "Build information", tag: "Status", response: buildinfo.Info{}},
+	{"GET", openAPIPath}:  {summary: "This OpenAPI document", tag: "Status", response: map[string]any{}},
+	{"GET", "/docs"}:      {summary: "Swagger UI for this document, when enabled", tag: "Status", raw: "text/html"},
+	{"GET", "/docs/{asset}"}: {
+		summary: "Script or stylesheet of the Swagger UI page",
+		tag:     "Status",
+		params:  []paramDoc{pathParam("asset", "string", "swagger-ui.css or swagger-ui-bundle.js")},
+		raw:     "text/plain",
+	},
+
+	{"GET", "/v1/block/{height}/header"}: {
+		summary: "Block header at a height", tag: "Blocks",
+		params:   []paramDoc{heightParam},
+		response: blockHeaderResponse{},
+	},
+	{"GET", "/v1/block/{height}/filter_header"}: {
+		summary: "Compact filter header at a height", tag: "Blocks",
+		params: []paramDoc{heightParam},
+		response: struct {
+			Height       int64  `json:"height"`
+			FilterHeader string `json:"filter_header"`
+		}{},
+	},
+	{"GET", "/v1/block/{height}/raw"}: {
+		summary: "Raw block at a height", tag: "Blocks",
+		params:   []paramDoc{heightParam, query("format", "string", "hex (default) for JSON, or binary for the serialized block", "hex", "binary")},
+		response: rawBlockResponse{},
+		raw:      "application/octet-stream",
+	},
+	{"GET", "/v1/block/hash/{hash}/raw"}: {
+		summary: "Raw block by hash", tag: "Blocks",
+		params:   []paramDoc{pathParam("hash", "string", "Block hash"), query("format", "string", "hex (default) for JSON, or binary for the serialized block", "hex", "binary")},
+		response: rawBlockResponse{},
+		raw:      "application/octet-stream",
+	},
+	{"GET", "/v1/headers"}: {
+		summary: "Range of block headers", tag: "Blocks",
+		params: []paramDoc{
+			query("start", "integer", "Height of the first header"),
+			query("count", "integer", "Number of headers"),
+			query("format", "string", "json (default) for decoded headers, or hex for the concatenated serialized headers", "json", "hex"),
+		},
+		response: oneOf{
+			struct {
+				Start   int64                 `json:"start"`
+				Count   int                   `json:"count"`
+				Headers []blockHeaderResponse `json:"headers"`
+			}{},
+			struct {
+				Start int64  `json:"start"`
+				Count int    `json:"count"`
+				Hex   string `json:"hex"`
+			}{},
+		},
+	},
+
+	{"POST", "/v1/filters/match"}: {
+		summary: "Heights whose compact filters match addresses or scripts", tag: "Filters",
+		request: matchFiltersRequest{}, response: neutrino.FilterMatchResult{}, scan: true,
+	},
+
+	{"GET", "/v1/tx/{txid}"}: {
+		summary: "Transaction in a known block", tag: "Transactions",
+		params: []paramDoc{
+			pathParam("txid", "string", "Transaction ID"),
+			query("block_height", "integer", "Height of the block containing the transaction"),
+			query("block_hash", "string", "Hash of the block containing the transaction"),
+		},
+		response: neutrino.Transaction{},
+	},
+	{"GET", "/v1/tx/{txid}/proof"}:  {summary: "Merkle proof of a transaction", tag: "Transactions", response: neutrino.TxProof{}},
+	{"POST", "/v1/tx/{txid}/track"}: {summary: "Track the confirmations of a transaction", tag: "Transactions", request: trackTransactionRequest{}, response: neutrino.TrackedTx{}},
+	{"GET", "/v1/tx/{txid}/track"}:  {summary: "Confirmations of a tracked transaction", tag: "Transactions", response: neutrino.TrackedTx{}},
+	{"DELETE", "/v1/tx/{txid}/track"}: {
+		summary: "Stop tracking a transaction", tag: "Transactions", response: statusResponse{},
+	},
+	{"POST", "/v1/tx/broadcast"}: {
+		summary: "Broadcast a transaction", tag: "Transactions",
+		request: broadcastTransactionRequest{}, response: neutrino.BroadcastResult{},
+	},
+	{"GET", "/v1/tx/broadcast/{txid}/status"}: {
+		summary: "Status of a broadcast transaction", tag: "Transactions", response: neutrino.BroadcastStatus{},
+	},
+
+	{"POST", "/v1/script/decode"}: {summary: "Decode a script", tag: "Scripts", request: decodeScriptRequest{}, response: neutrino.DecodedScript{}},
+	{"POST", "/v1/verifymessage"}: {summary: "Verify a signed message", tag: "Scripts", request: verifyMessageRequest{}, response: neutrino.MessageVerification{}},
+	{"POST", "/v1/psbt/enrich"}: {
+		summary: "Fill in the previous outputs of PSBT inputs", tag: "PSBT",
+		request: enrichPSBTRequest{}, response: neutrino.PSBTEnrichment{},
+		scan: true,
+	},
+
+	{"POST", "/v1/utxos"}: {
+		summary: "UTXOs of watched addresses, a page at a time", tag: "UTXOs",
+		params:  utxoPageParams,
+		request: getUTXOsRequest{}, response: utxoPage{},
+	},
+	{"POST", "/v1/utxos/check"}: {
+		summary: "Check the spend status of a batch of outpoints", tag: "UTXOs",
+		request: checkUTXOsRequest{},
+		response: struct {
+			Results []neutrino.UTXOCheckResult `json:"results"`
+		}{},
+		scan: true,
+	},
+	{"GET", "/v1/utxo/{txid}/{vout}"}: {
+		summary: "Check the spend status of an outpoint", tag: "UTXOs",
+		params: []paramDoc{
+			voutParam,
+			query("address", "string", "Address the outpoint pays, required to match compact filters"),
+			startHeightParam,
+			query("direction", "string", "Scan forward from start_height (default) or backward from the tip", "forward", "backward"),
+		},
+		response: neutrino.UTXOSpendReport{}, scan: true,
+	},
+	{"GET", "/v1/outpoint/{txid}/{vout}"}: {
+		summary: "Status of a watched outpoint", tag: "UTXOs",
+		params: []paramDoc{voutParam}, response: neutrino.OutpointStatus{},
+	},
+
+	{"GET", "/v1/address/{address}/history"}: {
+		summary: "Transaction history of an address from the address index", tag: "Addresses",
+		params: []paramDoc{
+			query("limit", "integer", "Maximum number of transactions"),
+			query("offset", "integer", "Number of transactions to skip"),
+		},
+		response: struct {
+			Address      string                   `json:"address"`
+			Transactions []addrindex.HistoryEntry `json:"transactions"`
+			Limit        int                      `json:"limit"`
+			Offset       int                      `json:"offset"`
+		}{},
+	},
+	{"GET", "/v1/address/{address}/balance"}: {
+		summary: "Balance of an address from the address index", tag: "Addresses",
+		params:   []paramDoc{query("at_height", "integer", "Height of the block to return the balance as of, at most the indexed tip; the tip if omitted")},
+		response: addrindex.Balance{},
+	},
+	{"GET", "/v1/address/{address}/utxos"}: {
+		summary: "UTXOs of an address from the address index", tag: "Addresses",
+		params: []paramDoc{utxoSortParam, utxoOrderParam},
+		response: struct {
+			Address string           `json:"address"`
+			UTXOs   []addrindex.UTXO `json:"utxos"`
+		}{},
+	},
+
+	{"GET", "/v1/fees/estimate"}: {
+		summary: "Fee rate estimate", tag: "Fees",
+		params:   []paramDoc{query("target_blocks", "integer", "Number of blocks to confirm within")},
+		response: neutrino.FeeEstimate{},
+	},
+
+	{"POST", "/v1/watch/address"}: {
+		summary: "Watch an address, or the addresses of descriptors", tag: "Watch",
+		request: watchAddressRequest{},
+		response: struct {
+			Status    string   `json:"status"`
+			Addresses []string `json:"addresses,omitempty"`
+		}{},
+	},
+	{"GET", "/v1/watch/addresses"}: {
+		summary: "Watched addresses", tag: "Watch",
+		params: []paramDoc{walletScopeParam},
+		response: struct {
+			Addresses []neutrino.WatchedAddress `json:"addresses"`
+		}{},
+	},
+	{"DELETE", "/v1/watch/address/{address}"}: {summary: "Stop watching an address", tag: "Watch", response: statusResponse{}},
+	{"POST", "/v1/watch/outpoint"}: {
+		summary: "Subscribe to the spend of an outpoint", tag: "Watch",
+		request: watchOutpointRequest{}, response: neutrino.SpendSubscription{},
+	},
+	{"GET", "/v1/watch/outpoints"}: {
+		summary: "Spend subscriptions", tag: "Watch",
+		response: struct {
+			Outpoints []neutrino.SpendSubscription `json:"outpoints"`
+		}{},
+	},
+	{"DELETE", "/v1/watch/outpoint/{txid}/{vout}"}: {
+		summary: "Cancel a spend subscription", tag: "Watch", params: []paramDoc{voutParam}, response: statusResponse{},
+	},
+	{"POST", "/v1/watch/script"}: {
+		summary: "Watch a script, by its template or its script_pubkey", tag: "Watch",
+		request: watchScriptRequest{},
+		response: oneOf{
+			neutrino.ScriptRegistration{},
+			struct {
+				Status  string `json:"status"`
+				Address string `json:"address"`
+			}{},
+		},
+	},
+	{"POST", "/v1/watch/xpub"}: {summary: "Watch the addresses of an xpub descriptor", tag: "Watch", request: watchXpubRequest{}, response: neutrino.WatchedXpub{}},
+	{"GET", "/v1/watch/xpubs"}: {
+		summary: "Watched xpubs", tag: "Watch",
+		params: []paramDoc{walletScopeParam},
+		response: struct {
+			Xpubs []neutrino.WatchedXpub `json:"xpubs"`
+		}{},
+	},
+	{"GET", "/v1/watch/xpub/{id}"}:    {summary: "Balance of a watched xpub", tag: "Watch", response: neutrino.XpubBalance{}},
+	{"DELETE", "/v1/watch/xpub/{id}"}: {summary: "Stop watching an xpub", tag: "Watch", response: statusResponse{}},
+
+	{"POST", "/v1/rescan"}:       {summary: "Start a rescan job", tag: "Rescan", request: rescanRequest{}, response: statusResponse{}},
+	{"GET", "/v1/rescan/status"}: {summary: "Status of the rescan jobs", tag: "Rescan", response: neutrino.RescanStatus{}},
+
+	{"GET", "/v1/wallets"}: {
+		summary: "Wallets", tag: "Wallets",
+		params: []paramDoc{query("include_archived", "boolean", "Also list archived wallets")},
+		response: struct {
+			Wallets []neutrino.WalletInfo `json:"wallets"`
+		}{},
+	},
+	{"POST", "/v1/wallets"}: {summary: "Create an empty wallet", tag: "Wallets", request: createWalletRequest{}, response: neutrino.WalletInfo{}},
+	{"DELETE", "/v1/wallets/{id}"}: {
+		summary: "Archive a wallet, or purge its data", tag: "Wallets",
+		params:   []paramDoc{walletIDParam, query("purge", "boolean", "Delete the wallet's data instead of archiving it")},
+		response: oneOf{neutrino.WalletInfo{}, statusResponse{}},
+	},
+	{"POST", "/v1/wallets/{id}/restore"}: {
+		summary: "Restore an archived wallet", tag: "Wallets",
+		params: []paramDoc{walletIDParam}, response: neutrino.WalletInfo{},
+	},
+	{"GET", "/v1/wallets/{id}/utxos"}: {
+		summary: "UTXOs of the addresses of a wallet, a page at a time", tag: "Wallets",
+		params: append([]paramDoc{walletIDParam}, utxoPageParams...), response: utxoPage{},
+	},
+	{"GET", "/v1/wallets/{id}/balance"}: {
+		summary: "Balance of the addresses of a wallet", tag: "Wallets",
+		params: []paramDoc{walletIDParam}, response: neutrino.WalletBalance{},
+	},
+	{"GET", "/v1/wallets/{id}/history"}: {
+		summary: "Transaction history of a wallet from the address index", tag: "Wallets",
+		params: []paramDoc{
+			walletIDParam,
+			query("limit", "integer", "Maximum number of transactions"),
+			query("offset", "integer", "Number of transactions to skip"),
+		},
+		response: struct {
+			Wallet       string                   `json:"wallet"`
+			Transactions []addrindex.HistoryEntry `json:"transactions"`
+			Limit        int                      `json:"limit"`
+			Offset       int                      `json:"offset"`
+		}{},
+	},
+
+	{"GET", "/v1/events"}: {
+		summary: "Events of a wallet after a cursor", tag: "Events",
+		params: []paramDoc{
+			walletParam,
+			query("after", "integer", "Cursor of the last event already seen"),
+			query("limit", "integer", "Maximum number of events"),
+		},
+		response: struct {
+			Wallet     string           `json:"wallet"`
+			Events     []neutrino.Event `json:"events"`
+			NextCursor uint64           `json:"next_cursor"`
+		}{},
+	},
+
+	{"POST", "/v1/webhooks"}: {summary: "Register a webhook", tag: "Webhooks", request: registerWebhookRequest{}, response: neutrino.Webhook{}},
+	{"GET", "/v1/webhooks"}: {
+		summary: "Registered webhooks", tag: "Webhooks",
+		response: struct {
+			Webhooks []neutrino.Webhook `json:"webhooks"`
+		}{},
+	},
+	{"DELETE", "/v1/webhooks/{id}"}: {summary: "Delete a webhook", tag: "Webhooks", params: []paramDoc{numericIDParam}, response: statusResponse{}},
+
+	{"GET", "/v1/peers"}: {
+		summary: "Connected peers", tag: "Peers",
+		response: struct {
+			Peers []neutrino.PeerInfo `json:"peers"`
+			Count int                 `json:"count"`
+		}{},
+	},
+	{"GET", "/v1/peers/diversity"}: {summary: "Network groups of the connected peers", tag: "Peers", response: neutrino.PeerDiversity{}},
+	{"POST", "/v1/peers/connect"}: {
+		summary: "Connect to a peer", tag: "Peers",
+		request: connectPeerRequest{}, status: http.StatusAccepted,
+		response: struct {
+			Status    string `json:"status"`
+			Addr      string `json:"addr"`
+			Permanent bool   `json:"permanent"`
+		}{},
+	},
+	{"POST", "/v1/peers/{addr}/disconnect"}: {summary: "Disconnect a peer", tag: "Peers", response: statusResponse{}},
+	{"POST", "/v1/peers/{addr}/ban"}:        {summary: "Ban a peer", tag: "Peers", response: statusResponse{}},
+
+	{"POST", "/v1/experimental/patterns"}: {
+		summary: "Register a script pattern", tag: "Patterns",
+		request: addPatternRequest{}, response: neutrino.ScriptPattern{},
+	},
+	{"GET", "/v1/experimental/patterns"}: {
+		summary: "Registered script patterns", tag: "Patterns",
+		response: struct {
+			Patterns []neutrino.ScriptPattern `json:"patterns"`
+		}{},
+	},
+	{"DELETE", "/v1/experimental/patterns/{id}"}: {
+		summary: "Delete a script pattern", tag: "Patterns", params: []paramDoc{numericIDParam}, response: statusResponse{},
+	},
+	{"GET", "/v1/experimental/patterns/{id}/matches"}: {
+		summary: "Matches of a script pattern", tag: "Patterns", params: []paramDoc{numericIDParam},
+		response: struct {
+			Matches []neutrino.PatternMatch `json:"matches"`
+		}{},
+	},
+
+	{"POST", "/v1/admin/keys"}: {
+		summary: "Create an API key", tag: "Admin",
+		request: createAPIKeyRequest{},
+		response: struct {
+			Name      string       `json:"name"`
+			Scopes    []auth.Scope `json:"scopes"`
+			CreatedAt int64        `json:"created_at"`
+			Key       string       `json:"key"`
+		}{},
+	},
+	{"GET", "/v1/admin/keys"}: {
+		summary: "API keys, without their secrets", tag: "Admin",
+		response: struct {
+			Keys []auth.KeyInfo `json:"keys"`
+		}{},
+	},
+	{"DELETE", "/v1/admin/keys/{name}"}: {summary: "Delete an API key", tag: "Admin", response: statusResponse{}},
+	{"GET", "/v1/admin/bans"}: {
+		summary: "Banned peers and networks", tag: "Admin",
+		response: struct {
+			Bans []neutrino.Ban `json:"bans"`
+		}{},
+	},
+	{"POST", "/v1/admin/bans"}:             {summary: "Ban a peer or network", tag: "Admin", request: addBanRequest{}, response: neutrino.Ban{}},
+	{"DELETE", "/v1/admin/bans/{addr:.+}"}: {summary: "Lift a ban", tag: "Admin", response: statusResponse{}},
+	{"POST", "/v1/admin/backup"}: {
+		summary: "Start backing up the database", tag: "Admin",
+		request: createBackupRequest{}, optionalBody: true, status: http.StatusAccepted, response: backupJobResponse{},
+	},
+	{"GET", "/v1/admin/backup/{name}"}: {summary: "Status of a backup", tag: "Admin", response: neutrino.BackupJob{}},
+	{"GET", "/v1/admin/cache"}:         {summary: "Filter and block cache statistics", tag: "Admin", response: neutrino.CacheReport{}},
+}
+
+// rawBlockResponse is the JSON response of the raw block endpoints.
+type rawBlockResponse struct {
+	Hash   string `json:"hash"`
+	Height int32  `json:"height"`
+	Size   int    `json:"size"`
+	Cached bool   `json:"cached"`
+	Hex    string `json:"hex"`
+}
+
+// pathVariable matches the variables of a route template, with their
+// optional pattern.
+var pathVariable = regexp.MustCompile(`\{([^}:]+)(:[^}]+)?\}`)
+
+// openAPIDocument builds the OpenAPI 3.0 document of the routes in docs,
+// describing the API served at serverURL.
+func openAPIDocument(docs map[routeKey]routeDoc, info buildinfo.Info, serverURL string) map[string]any {
+	schemas := newSchemaSet()
+	errorSchema := schemas.of(reflect.TypeOf(errorBody{}))
+	errorResponse := func(description string) map[string]any {
+		return map[string]any{
+			"description": description,
+			"content":     map[string]any{"application/json": map[string]any{"schema": errorSchema}},
+		}
+	}
+
+	paths := map[string]any{}
+	for key, doc := range docs {
+		path := pathVariable.ReplaceAllString(key.route, "{$1}")
+		operation := map[string]any{
+			"summary":     doc.summary,
+			"tags":        []string{doc.tag},
+			"operationId": operationID(key),
+		}
+
+		params := documentedParams(key.route, doc)
+		if doc.scan {
+			params = append(params, map[string]any{
+				"name": "timeout", "in": "query",
+				"description": "How long the scan may run, such as 30s or 5m, up to the server's maximum",
+				"schema":      map[string]any{"type": "string"},
+			})
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+
+		if doc.request != nil {
+			operation["requestBody"] = map[string]any{
+				"required": !doc.optionalBody,
+				"content": map[string]any{"application/json": map[string]any{
+					"schema": schemas.of(reflect.TypeOf(doc.request)),
+				}},
+			}
+		}
+
+		content := map[string]any{}
+		if doc.response != nil {
+			content["application/json"] = map[string]any{"schema": schemas.response(doc.response)}
+		}
+		if doc.raw != "" {
+			content[doc.raw] = map[string]any{"schema": map[string]any{"type": "string"}}
+		}
+		status := doc.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		responses := map[string]any{
+			itoa(status): map[string]any{"description": http.StatusText(status), "content": content},
+			"default":    errorResponse("Error"),
+		}
+		if doc.request != nil {
+			responses["400"] = errorResponse("Invalid request or request body")
+			responses["413"] = errorResponse("Request body too large")
+		}
+		if publicRoutes[key.route] {
+			operation["security"] = []any{}
+		} else {
+			operation["x-required-scope"] = requiredScope(key.method, key.route)
+			responses["401"] = errorResponse("API key or client certificate required")
+			responses["403"] = errorResponse("The key lacks the required scope, or the listener does not serve it")
+		}
+		if _, ok := scanRouteSet[key]; ok {
+			responses["429"] = errorResponse("Too many concurrent scans")
+		}
+		if doc.scan {
+			responses["504"] = map[string]any{
+				"description": "Scan deadline exceeded",
+				"content": map[string]any{"application/json": map[string]any{
+					"schema": schemas.of(reflect.TypeOf(scanDeadlineBody{})),
+				}},
+			}
+		}
+		operation["responses"] = responses
+
+		item, _ := paths[path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[path] = item
+		}
+		item[strings.ToLower(key.method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "neutrinod API",
+			"version":     info.Version,
+			"description": "REST API of a neutrino Bitcoin light client, answering UTXO, transaction and filter queries with BIP157/158 compact block filters.",
+		},
+		"servers": []any{map[string]any{"url": serverURL}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": schemas.components,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+				"apiKey": map[string]any{"type": "apiKey", "in": "header", "name": apiKeyHeader},
+			},
+		},
+		// Routes need a key only when the node has API keys configured
+		"security": []any{map[string]any{"bearer": []string{}}, map[string]any{"apiKey": []string{}}},
+	}
+}
+
+// scanRouteSet holds the routes of scanRoutes.
+var scanRouteSet = func() map[routeKey]struct{} {
+	set := make(map[routeKey]struct{}, len(scanRoutes))
+	for _, key := range scanRoutes {
+		set[key] = struct{}{}
+	}
+	return set
+}()
+
+// documentedParams returns the parameters of the route, documenting the path
+// variables doc does not describe as strings.
+func documentedParams(route string, doc routeDoc) []any {
+	described := map[string]paramDoc{}
+	for _, param := range doc.params {
+		if param.path {
+			described[param.name] = param
+		}
+	}
+
+	var params []any
+	for _, match := range pathVariable.FindAllStringSubmatch(route, -1) {
+		param, ok := described[match[1]]
+		if !ok {
+			param = pathParam(match[1], "string", "")
+		}
+		params = append(params, paramSpec(param, "path"))
+	}
+	for _, param := range doc.params {
+		if !param.path {
+			params = append(params, paramSpec(param, "query"))
+		}
+	}
+	return params
+}
+
+func paramSpec(param paramDoc, in string) map[string]any {
+	schema := map[string]any{"type": param.kind}
+	if len(param.enum) > 0 {
+		schema["enum"] = param.enum
+	}
+	spec := map[string]any{"name": param.name, "in": in, "schema": schema}
+	if in == "path" {
+		spec["required"] = true
+	}
+	if param.description != "" {
+		spec["description"] = param.description
+	}
+	return spec
+}
+
+// operationID names the operation of key for generated clients, such as
+// get_v1_utxo_txid_vout.
+func operationID(key routeKey) string {
+	route := pathVariable.ReplaceAllString(key.route, "$1")
+	name := strings.ToLower(key.method)
+	for _, part := range strings.FieldsFunc(route, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		name += "_" + part
+	}
+	return name
+}
+
+func itoa(n int) string {
+	b, _ := json.Marshal(n)
+	return string(b)
+}
+
+// schemaSet derives JSON schemas from Go types by their json tags, collecting
+// named struct types as components.
+type schemaSet struct {
+	components map[string]any
+	names      map[reflect.Type]string
+}
+
+func newSchemaSet() *schemaSet {
+	return &schemaSet{components: map[string]any{}, names: map[reflect.Type]string{}}
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// response returns the schema of a response, listing the shapes of a oneOf.
+func (s *schemaSet) response(response any) map[string]any {
+	shapes, ok := response.(oneOf)
+	if !ok {
+		return s.of(reflect.TypeOf(response))
+	}
+	var schemas []any
+	for _, shape := range shapes {
+		schemas = append(schemas, s.of(reflect.TypeOf(shape)))
+	}
+	return map[string]any{"oneOf": schemas}
+}
+
+// of returns the schema of t, a reference for named structs.
+func (s *schemaSet) of(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return map[string]any{"description": "Any JSON value"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + s.component(t)}
+	}
+	return map[string]any{}
+}
+
+// component returns the component name of the named struct t, adding its
+// schema the first time. Types of the same name in different packages are
+// told apart by their package.
+func (s *schemaSet) component(t reflect.Type) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+	name := exportedName(t.Name())
+	if _, taken := s.components[name]; taken {
+		parts := strings.Split(t.PkgPath(), "/")
+		name = exportedName(parts[len(parts)-1]) + name
+	}
+	s.names[t] = name
+	s.components[name] = map[string]any{}
+	s.components[name] = s.object(t)
+	return name
+}
+
+// object returns the object schema of the struct t, with the fields of its
+// embedded structs inlined as encoding/json does.
+func (s *schemaSet) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	s.addFields(t, properties)
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+func (s *schemaSet) addFields(t reflect.Type, properties map[string]any) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.addFields(embedded, properties)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.of(field.Type)
+	}
+}
+
+// exportedName returns name with its first letter upper-cased.
+func exportedName(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// swaggerUIAssets are the files of a swagger-ui-dist release the Swagger UI
+// page loads, served under /docs/.
+var swaggerUIAssets = []string{"swagger-ui.css", "swagger-ui-bundle.js"}
+
+// SwaggerUIAssets returns the Swagger UI assets in dir, the unpacked package
+// of a swagger-ui-dist release, failing if any the page loads is missing.
+func SwaggerUIAssets(dir string) (fs.FS, error) {
+	assets := os.DirFS(dir)
+	for _, name := range swaggerUIAssets {
+		if _, err := fs.Stat(assets, name); err != nil {
+			return nil, fmt.Errorf("%s is not a swagger-ui-dist package: %w", dir, err)
+		}
+	}
+	return assets, nil
+}
+
+// SetSwaggerUI enables the Swagger UI page at /docs, loading its scripts and
+// styles from assets rather than a CDN. Nil disables the page.
+func (h *Handler) SetSwaggerUI(assets fs.FS) {
+	h.swaggerUI = assets
+}
+
+// registerDocRoutes registers the OpenAPI document of the routes of r and,
+// if enabled, the Swagger UI page. The document lists the routes r serves
+// once every route is registered, so API replicas without a node only
+// describe the address index.
+func (h *Handler) registerDocRoutes(r *mux.Router) {
+	served := sync.OnceValue(func() map[routeKey]routeDoc {
+		docs := map[routeKey]routeDoc{}
+		r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+			template, err := route.GetPathTemplate()
+			if err != nil {
+				return nil
+			}
+			methods, _ := route.GetMethods()
+			for _, method := range methods {
+				key := routeKey{method, template}
+				if doc, ok := routeDocs[key]; ok {
+					docs[key] = doc
+				}
+			}
+			return nil
+		})
+		return docs
+	})
+
+	r.HandleFunc(openAPIPath, func(w http.ResponseWriter, r *http.Request) {
+		h.handleOpenAPI(w, r, served())
+	}).Methods("GET")
+	if h.swaggerUI != nil {
+		r.HandleFunc("/docs", h.handleSwaggerUI).Methods("GET")
+		r.HandleFunc("/docs/{asset}", h.handleSwaggerUIAsset).Methods("GET")
+	}
+}
+
+// handleOpenAPI serves the OpenAPI document of docs. Its server URL is the
+// path the request was made under, so clients reaching the API through
+// --base-path call it there.
+func (h *Handler) handleOpenAPI(w http.ResponseWriter, r *http.Request, docs map[routeKey]routeDoc) {
+	serverURL := "/"
+	if requested, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		if prefix, ok := strings.CutSuffix(requested.Path, openAPIPath); ok && prefix != "" {
+			serverURL = prefix
+		}
+	}
+	h.jsonResponse(w, openAPIDocument(docs, h.buildInfo, serverURL))
+}
+
+// swaggerUIPage loads Swagger UI from the assets served under /docs/ and
+// points it at the document, both relative to the page so it works under
+// --base-path.
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>neutrinod API</title>
+  <link rel="stylesheet" href="docs/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="docs/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({
+      url: "v1/openapi.json",
+      dom_id: "#swagger-ui",
+      persistAuthorization: true
+    });
+  </script>
+</body>
+</html>
+`
+
+// handleSwaggerUI serves the Swagger UI page.
+func (h *Handler) handleSwaggerUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, swaggerUIPage)
+}
+
+// handleSwaggerUIAsset serves an asset of the Swagger UI page, and no other
+// file of the directory it is in.
+func (h *Handler) handleSwaggerUIAsset(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["asset"]
+	for _, asset := range swaggerUIAssets {
+		if name == asset {
+			http.ServeFileFS(w, r, h.swaggerUI, name)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
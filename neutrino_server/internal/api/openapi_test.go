@@ -0,0 +1,205 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/btcsuite/btclog"
+	"github.com/gorilla/mux"
+)
+
+func TestRouteDocsCoverRoutes(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.Disabled)
+	handler.SetSwaggerUI(fstest.MapFS{})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	registered := map[routeKey]bool{}
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, _ := route.GetPathTemplate()
+		methods, _ := route.GetMethods()
+		for _, method := range methods {
+			registered[routeKey{method, template}] = true
+		}
+		return nil
+	})
+
+	for key := range registered {
+		if _, ok := routeDocs[key]; !ok {
+			t.Errorf("%s %s has no routeDocs entry", key.method, key.route)
+		}
+	}
+	for key := range routeDocs {
+		if !registered[key] {
+			t.Errorf("routeDocs documents %s %s, which is not registered", key.method, key.route)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	tests := []struct {
+		name       string
+		register   func(h *Handler, r *mux.Router)
+		basePath   string
+		wantPaths  []string
+		wantAbsent []string
+	}{
+		{
+			name:       "node",
+			register:   (*Handler).RegisterRoutes,
+			wantPaths:  []string{"/v1/status", "/v1/utxo/{txid}/{vout}", "/v1/admin/bans/{addr}", "/v1/address/{address}/history"},
+			wantAbsent: []string{"/docs"},
+		},
+		{
+			name:       "address index replica",
+			register:   (*Handler).RegisterIndexRoutes,
+			wantPaths:  []string{"/v1/address/{address}/utxos", "/v1/info"},
+			wantAbsent: []string{"/v1/status", "/v1/utxos"},
+		},
+		{
+			name:      "under a base path",
+			register:  (*Handler).RegisterRoutes,
+			basePath:  "/neutrino",
+			wantPaths: []string{"/v1/status"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler(&mockNode{}, btclog.Disabled)
+			handler.SetAddressIndex(newTestIndex(t, "bcrt1qindexed"))
+			router := mux.NewRouter()
+			tt.register(handler, router)
+			mounted, err := MountAt(tt.basePath, router)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			mounted.ServeHTTP(rr, httptest.NewRequest("GET", tt.basePath+openAPIPath, nil))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("GET %s returned %d: %s", openAPIPath, rr.Code, rr.Body)
+			}
+			var doc struct {
+				OpenAPI string                     `json:"openapi"`
+				Servers []struct{ URL string }     `json:"servers"`
+				Paths   map[string]json.RawMessage `json:"paths"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+				t.Fatalf("decoding the document: %v", err)
+			}
+			if doc.OpenAPI != "3.0.3" {
+				t.Errorf("openapi = %q, want 3.0.3", doc.OpenAPI)
+			}
+			wantServer := tt.basePath
+			if wantServer == "" {
+				wantServer = "/"
+			}
+			if len(doc.Servers) != 1 || doc.Servers[0].URL != wantServer {
+				t.Errorf("servers = %+v, want %s", doc.Servers, wantServer)
+			}
+			for _, path := range tt.wantPaths {
+				if _, ok := doc.Paths[path]; !ok {
+					t.Errorf("the document lacks %s", path)
+				}
+			}
+			for _, path := range tt.wantAbsent {
+				if _, ok := doc.Paths[path]; ok {
+					t.Errorf("the document describes %s, which is not served", path)
+				}
+			}
+
+			// Every reference resolves to a component
+			body := rr.Body.String()
+			for _, ref := range strings.Split(body, `"$ref":"#/components/schemas/`)[1:] {
+				name, _, _ := strings.Cut(ref, `"`)
+				if !strings.Contains(body, `"`+name+`":{"properties"`) {
+					t.Errorf("reference to %s has no component", name)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	schemas := newSchemaSet()
+	schema := schemas.of(reflect.TypeOf(rescanRequest{}))
+	if schema["$ref"] != "#/components/schemas/RescanRequest" {
+		t.Fatalf("schema of rescanRequest = %v, want a reference", schema)
+	}
+	encoded, _ := json.Marshal(schemas.components["RescanRequest"])
+	for _, want := range []string{`"outpoints":{"items"`, `"start_height":{"format":"int32","type":"integer"}`} {
+		if !strings.Contains(string(encoded), want) {
+			t.Errorf("RescanRequest = %s, want it to contain %s", encoded, want)
+		}
+	}
+
+	// The UTXO types of the node and of the address index keep their own
+	// components
+	schemas.response(oneOf{routeDocs[routeKey{"POST", "/v1/utxos"}].response, routeDocs[routeKey{"GET", "/v1/address/{address}/utxos"}].response})
+	if _, ok := schemas.components["UTXO"]; !ok {
+		t.Error("no UTXO component")
+	}
+	if _, ok := schemas.components["AddrindexUTXO"]; !ok {
+		t.Errorf("no AddrindexUTXO component, have %v", schemas.components)
+	}
+}
+
+// testSwaggerUIAssets is a swagger-ui-dist package, with a file the page
+// does not load.
+var testSwaggerUIAssets = fstest.MapFS{
+	"swagger-ui.css":       {Data: []byte("body {}")},
+	"swagger-ui-bundle.js": {Data: []byte("function SwaggerUIBundle() {}")},
+	"package.json":         {Data: []byte("{}")},
+}
+
+func TestSwaggerUI(t *testing.T) {
+	for _, assets := range []fstest.MapFS{nil, testSwaggerUIAssets} {
+		enabled := assets != nil
+		handler := NewHandler(&mockNode{}, btclog.Disabled)
+		if enabled {
+			handler.SetSwaggerUI(assets)
+		}
+		router := mux.NewRouter()
+		handler.RegisterRoutes(router)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/docs", nil))
+		if got := rr.Code == http.StatusOK && strings.Contains(rr.Body.String(), `url: "v1/openapi.json"`); got != enabled {
+			t.Errorf("with the Swagger UI enabled %v, GET /docs returned %d: %s", enabled, rr.Code, rr.Body)
+		}
+		if enabled && strings.Contains(rr.Body.String(), "https://") {
+			t.Errorf("GET /docs loads assets from another origin: %s", rr.Body)
+		}
+
+		for name, file := range testSwaggerUIAssets {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/docs/"+name, nil))
+			want := enabled && name != "package.json"
+			if got := rr.Code == http.StatusOK && rr.Body.String() == string(file.Data); got != want {
+				t.Errorf("with the Swagger UI enabled %v, GET /docs/%s returned %d: %s", enabled, name, rr.Code, rr.Body)
+			}
+		}
+	}
+}
+
+func TestSwaggerUIAssets(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := SwaggerUIAssets(dir); err == nil {
+		t.Fatal("SwaggerUIAssets() of an empty directory succeeded")
+	}
+	for _, name := range swaggerUIAssets {
+		if err := os.WriteFile(filepath.Join(dir, name), testSwaggerUIAssets[name].Data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := SwaggerUIAssets(dir); err != nil {
+		t.Fatalf("SwaggerUIAssets() error = %v", err)
+	}
+}
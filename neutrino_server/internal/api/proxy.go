@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseTrustedProxies parses a comma-separated list of IP addresses and
+// CIDR ranges of reverse proxies.
+func ParseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: not an IP address or CIDR range", entry)
+			}
+			bits := 8 * len(ip.To16())
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// SetTrustedProxies makes requests from proxies be attributed to the
+// client address they forward, for logging and rate limiting.
+func (h *Handler) SetTrustedProxies(proxies []*net.IPNet) {
+	h.proxies = proxies
+}
+
+// trusted reports whether ip is the address of a trusted proxy.
+func (h *Handler) trusted(ip net.IP) bool {
+	for _, proxy := range h.proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client of r. For requests from a
+// trusted proxy it is the last address in X-Forwarded-For not of a trusted
+// proxy, or else X-Real-IP. Addresses added by untrusted hops are
+// ignored, since any client can send the headers. Requests on an onion
+// listener all come from Tor, so their address is "onion" whatever headers
+// the onion client sent.
+func (h *Handler) clientIP(r *http.Request) string {
+	if requestListener(r).Onion {
+		return "onion"
+	}
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if ip := net.ParseIP(remote); ip == nil || !h.trusted(ip) {
+		return remote
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		if !h.trusted(ip) {
+			return ip.String()
+		}
+	}
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return remote
+}
+
+// MountAt serves next under basePath, such as /neutrino, for deployments
+// behind a reverse proxy that forwards a path prefix. Requests outside
+// basePath are not found. An empty or "/" base path serves next as is.
+func MountAt(basePath string, next http.Handler) (http.Handler, error) {
+	basePath = strings.TrimRight(basePath, "/")
+	if basePath == "" {
+		return next, nil
+	}
+	if !strings.HasPrefix(basePath, "/") || strings.ContainsAny(basePath, "?#{}") {
+		return nil, fmt.Errorf("invalid base path %q: must be an absolute path such as /neutrino", basePath)
+	}
+	return http.StripPrefix(basePath, next), nil
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+	"github.com/gorilla/mux"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    int
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"127.0.0.1", 1, false},
+		{"10.0.0.0/8, ::1", 2, false},
+		{"10.0.0.0/33", 0, true},
+		{"proxy.internal", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			proxies, err := ParseTrustedProxies(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTrustedProxies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(proxies) != tt.want {
+				t.Errorf("ParseTrustedProxies() = %v, want %d entries", proxies, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8,192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewHandler(&mockNode{}, btclog.Disabled)
+	handler.SetTrustedProxies(proxies)
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		realIP    string
+		want      string
+	}{
+		{"direct", "198.51.100.7:4000", nil, "", "198.51.100.7"},
+		{"untrusted sender", "198.51.100.7:4000", []string{"203.0.113.9"}, "203.0.113.9", "198.51.100.7"},
+		{"trusted proxy", "10.0.0.2:4000", []string{"203.0.113.9"}, "", "203.0.113.9"},
+		{"chain of proxies", "10.0.0.2:4000", []string{"203.0.113.9, 192.0.2.1"}, "", "203.0.113.9"},
+		{"spoofed first hop", "10.0.0.2:4000", []string{"1.1.1.1, 203.0.113.9"}, "", "203.0.113.9"},
+		{"repeated header", "10.0.0.2:4000", []string{"1.1.1.1", "203.0.113.9"}, "", "203.0.113.9"},
+		{"real IP", "10.0.0.2:4000", nil, "203.0.113.9", "203.0.113.9"},
+		{"only proxies", "10.0.0.2:4000", []string{"10.0.0.3"}, "", "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/status", nil)
+			req.RemoteAddr = tt.remote
+			for _, header := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", header)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := handler.clientIP(req); got != tt.want {
+				t.Errorf("clientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// Onion clients all come from Tor, whatever they forward
+	req := httptest.NewRequest("GET", "/v1/status", nil)
+	req.RemoteAddr = "10.0.0.2:4000"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	req = req.WithContext(context.WithValue(req.Context(), listenerContextKey{}, Listener{Network: "tcp", Address: "127.0.0.1:8336", Onion: true}))
+	if got := handler.clientIP(req); got != "onion" {
+		t.Errorf("clientIP() on the onion listener = %s, want onion", got)
+	}
+
+	if got := NewHandler(&mockNode{}, btclog.Disabled).clientIP(func() *http.Request {
+		req := httptest.NewRequest("GET", "/v1/status", nil)
+		req.RemoteAddr = "10.0.0.2:4000"
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		return req
+	}()); got != "10.0.0.2" {
+		t.Errorf("clientIP() without trusted proxies = %s, want the remote address", got)
+	}
+}
+
+func TestMountAt(t *testing.T) {
+	router := mux.NewRouter()
+	NewHandler(&mockNode{}, btclog.Disabled).RegisterRoutes(router)
+
+	for _, base := range []string{"/neutrino", "/neutrino/"} {
+		mounted, err := MountAt(base, router)
+		if err != nil {
+			t.Fatalf("MountAt(%q) error = %v", base, err)
+		}
+		for path, want := range map[string]int{
+			"/neutrino/v1/status": http.StatusOK,
+			"/neutrino/readyz":    http.StatusOK,
+			"/v1/status":          http.StatusNotFound,
+		} {
+			rr := httptest.NewRecorder()
+			mounted.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+			if rr.Code != want {
+				t.Errorf("GET %s under %q = %d, want %d", path, base, rr.Code, want)
+			}
+		}
+	}
+
+	if mounted, err := MountAt("/", router); err != nil || mounted != http.Handler(router) {
+		t.Errorf("MountAt(/) = %v, %v, want the router itself", mounted, err)
+	}
+	if _, err := MountAt("neutrino", router); err == nil {
+		t.Error("MountAt() of a relative path succeeded")
+	}
+}
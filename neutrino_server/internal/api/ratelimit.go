@@ -0,0 +1,158 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Idle client limiters are swept every clientSweepInterval once unused for
+// clientIdleTimeout, so the map does not grow with every address seen.
+const (
+	clientSweepInterval = time.Minute
+	clientIdleTimeout   = 10 * time.Minute
+)
+
+// RateLimitConfig configures request rate limits. Rates are in requests
+// per second, and zero disables a limit. Bursts default to the rate,
+// rounded up.
+type RateLimitConfig struct {
+	// Global limits all requests together, so the node's peers are not
+	// saturated by many clients at once.
+	Global      float64
+	GlobalBurst int
+
+	// PerClient limits each API key, client certificate or, without
+	// authentication, remote IP address.
+	PerClient      float64
+	PerClientBurst int
+}
+
+// clientLimiter is the limiter of one client.
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter enforces a RateLimitConfig.
+type rateLimiter struct {
+	global *rate.Limiter
+
+	mu        sync.Mutex
+	perClient rate.Limit
+	burst     int
+	clients   map[string]*clientLimiter
+	lastSweep time.Time
+}
+
+// newRateLimiter returns the limiter of cfg, or nil if cfg sets no limit.
+func newRateLimiter(cfg RateLimitConfig) *rateLimiter {
+	if cfg.Global <= 0 && cfg.PerClient <= 0 {
+		return nil
+	}
+
+	l := &rateLimiter{clients: make(map[string]*clientLimiter)}
+	if cfg.Global > 0 {
+		l.global = rate.NewLimiter(rate.Limit(cfg.Global), burst(cfg.Global, cfg.GlobalBurst))
+	}
+	if cfg.PerClient > 0 {
+		l.perClient = rate.Limit(cfg.PerClient)
+		l.burst = burst(cfg.PerClient, cfg.PerClientBurst)
+	}
+	return l
+}
+
+// burst returns configured, or the rate rounded up if it is not set.
+func burst(limit float64, configured int) int {
+	if configured > 0 {
+		return configured
+	}
+	return int(math.Ceil(limit))
+}
+
+// allow reports whether a request from client at now is within the limits,
+// and if not how long until it would be.
+func (l *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	var reservations []*rate.Reservation
+	if l.perClient > 0 {
+		reservations = append(reservations, l.client(client, now).ReserveN(now, 1))
+	}
+	if l.global != nil {
+		reservations = append(reservations, l.global.ReserveN(now, 1))
+	}
+
+	var wait time.Duration
+	for _, r := range reservations {
+		wait = max(wait, r.DelayFrom(now))
+	}
+	if wait == 0 {
+		return true, 0
+	}
+	// A rejected request uses up neither limit
+	for _, r := range reservations {
+		r.CancelAt(now)
+	}
+	return false, wait
+}
+
+// client returns the limiter of client, creating it if needed, and sweeps
+// idle limiters when due.
+func (l *rateLimiter) client(client string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= clientSweepInterval {
+		for key, c := range l.clients {
+			if now.Sub(c.lastSeen) >= clientIdleTimeout {
+				delete(l.clients, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	c, ok := l.clients[client]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(l.perClient, l.burst)}
+		l.clients[client] = c
+	}
+	c.lastSeen = now
+	return c.limiter
+}
+
+// SetRateLimits enables the request rate limits of cfg. It may be called
+// while requests are served, replacing the limits and their clients'
+// buckets.
+func (h *Handler) SetRateLimits(cfg RateLimitConfig) {
+	h.limits.Store(newRateLimiter(cfg))
+}
+
+// rateLimitMiddleware answers requests over the rate limits with 429 and a
+// Retry-After header. It runs after authentication, so clients with an
+// API key or certificate are limited by it rather than by address, and
+// clients behind a trusted proxy by their forwarded address.
+// Probes and scrapers are never limited.
+func (h *Handler) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+		limits := h.limits.Load()
+		if limits == nil || publicRoutes[route] || quietRoutes[route] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client := requestClient(r)
+		if client == "" {
+			client = "ip:" + h.clientIP(r)
+		}
+		if ok, wait := limits.allow(client, time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			h.errorResponse(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
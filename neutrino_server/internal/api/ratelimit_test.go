@@ -0,0 +1,104 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btclog"
+	"github.com/gorilla/mux"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	t.Run("per client", func(t *testing.T) {
+		limits := newRateLimiter(RateLimitConfig{PerClient: 1, PerClientBurst: 2})
+		for i := 0; i < 2; i++ {
+			if ok, _ := limits.allow("ip:a", now); !ok {
+				t.Fatalf("request %d within the burst was limited", i)
+			}
+		}
+		ok, wait := limits.allow("ip:a", now)
+		if ok || wait != time.Second {
+			t.Errorf("allow() over the burst = %v, %v, want limited for 1s", ok, wait)
+		}
+		if ok, _ := limits.allow("ip:b", now); !ok {
+			t.Error("another client was limited")
+		}
+		if ok, _ := limits.allow("ip:a", now.Add(time.Second)); !ok {
+			t.Error("client still limited after the wait")
+		}
+	})
+
+	t.Run("global", func(t *testing.T) {
+		limits := newRateLimiter(RateLimitConfig{Global: 2, PerClient: 10})
+		limits.allow("ip:a", now)
+		limits.allow("ip:b", now)
+		ok, wait := limits.allow("ip:c", now)
+		if ok || wait != 500*time.Millisecond {
+			t.Errorf("allow() over the global limit = %v, %v, want limited for 500ms", ok, wait)
+		}
+	})
+
+	t.Run("rejected requests are not counted", func(t *testing.T) {
+		limits := newRateLimiter(RateLimitConfig{Global: 1, PerClient: 1})
+		limits.allow("ip:a", now)
+		for i := 0; i < 5; i++ {
+			limits.allow("ip:a", now)
+		}
+		if ok, _ := limits.allow("ip:a", now.Add(time.Second)); !ok {
+			t.Error("rejected requests delayed the client")
+		}
+	})
+
+	t.Run("idle clients swept", func(t *testing.T) {
+		limits := newRateLimiter(RateLimitConfig{PerClient: 1})
+		limits.allow("ip:a", now)
+		limits.allow("ip:b", now.Add(clientIdleTimeout))
+		if _, ok := limits.clients["ip:a"]; ok {
+			t.Error("idle client limiter kept")
+		}
+	})
+
+	if newRateLimiter(RateLimitConfig{}) != nil {
+		t.Error("newRateLimiter() without limits is not nil")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.Disabled)
+	handler.SetKeyring(newTestKeyring(t))
+	handler.SetRateLimits(RateLimitConfig{PerClient: 0.5, PerClientBurst: 1})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	do := func(path, key, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remote
+		if key != "" {
+			req.Header.Set(apiKeyHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do("/v1/status", "read-secret", "192.0.2.1:1000"); rr.Code != http.StatusOK {
+		t.Fatalf("first request status = %d", rr.Code)
+	}
+	// The key is limited wherever it is used from
+	rr := do("/v1/status", "read-secret", "192.0.2.2:1000")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "2" {
+		t.Errorf("second request = %d, Retry-After %q, want 429 after 2s", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if rr := do("/v1/status", "admin-secret", "192.0.2.1:1000"); rr.Code != http.StatusOK {
+		t.Errorf("another key from the same address = %d, want %d", rr.Code, http.StatusOK)
+	}
+	for i := 0; i < 3; i++ {
+		if rr := do("/readyz", "", "192.0.2.1:1000"); rr.Code == http.StatusTooManyRequests {
+			t.Fatal("probe was rate limited")
+		}
+	}
+}
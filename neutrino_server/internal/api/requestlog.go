@@ -0,0 +1,81 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// requestIDHeader carries the request ID, both from a caller or proxy that
+// already assigned one and back on every response.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the request IDs accepted from callers.
+const maxRequestIDLength = 128
+
+// quietRoutes are polled by probes and scrapers, so their requests are only
+// logged at debug level.
+var quietRoutes = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// requestLogMiddleware assigns every request an ID, returns it in the
+// X-Request-ID header and logs the request once it completes, with its
+// client's address and the identity of its client certificate if it has
+// one. The ID is carried by the request's context, so handler and node log
+// lines and error responses can be matched with the request.
+func (h *Handler) requestLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		started := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(logging.WithRequestID(r.Context(), id)))
+		elapsed := time.Since(started).Round(time.Microsecond)
+
+		logf := h.logger.Infof
+		if quietRoutes[routeTemplate(r)] {
+			logf = h.logger.Debugf
+		}
+		params := []any{logging.KV("request_id", id), logging.KV("method", r.Method), logging.KV("path", r.URL.Path),
+			logging.KV("status", recorder.code), logging.KV("duration", elapsed), logging.KV("remote_ip", h.clientIP(r))}
+		if client := clientIdentity(r); client != "" {
+			logf("request=%s method=%s path=%s status=%d duration=%s remote=%s client=%s", append(params, logging.KV("client", client))...)
+		} else {
+			logf("request=%s method=%s path=%s status=%d duration=%s remote=%s", params...)
+		}
+	})
+}
+
+// validRequestID reports whether a caller's request ID is safe to log and
+// echo: non-empty, bounded and made of letters, digits and -_.:
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 16 character hex request ID.
+func newRequestID() string {
+	var id [8]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+func TestRequestLogMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	handler := NewHandler(&mockNode{}, logging.NewJSONBackend(&logs).Logger("API"))
+
+	var handlerID string
+	router := mux.NewRouter()
+	router.Use(handler.requestLogMiddleware)
+	router.HandleFunc("/v1/tx/{txid}", func(w http.ResponseWriter, r *http.Request) {
+		handlerID = logging.RequestID(r.Context())
+		handler.errorResponse(w, http.StatusNotFound, "transaction not found")
+	}).Methods("GET")
+	router.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+
+	tests := []struct {
+		name     string
+		path     string
+		incoming string
+		wantID   string
+		wantLog  bool
+		cert     string
+	}{
+		{"assigned ID", "/v1/tx/abc", "", "", true, ""},
+		{"caller ID kept", "/v1/tx/abc", "lb-1234.5", "lb-1234.5", true, ""},
+		{"invalid caller ID replaced", "/v1/tx/abc", "bad id\n", "", true, ""},
+		{"overlong caller ID replaced", "/v1/tx/abc", strings.Repeat("a", maxRequestIDLength+1), "", true, ""},
+		{"probe logged at debug", "/readyz", "", "", false, ""},
+		{"client certificate logged", "/v1/tx/abc", "", "", true, "indexer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			handlerID = ""
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.incoming != "" {
+				req.Header.Set(requestIDHeader, tt.incoming)
+			}
+			if tt.cert != "" {
+				req = withClientCert(req, tt.cert)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			id := rr.Header().Get(requestIDHeader)
+			if !validRequestID(id) || (tt.wantID != "" && id != tt.wantID) {
+				t.Fatalf("%s = %q, want %q", requestIDHeader, id, tt.wantID)
+			}
+
+			if !tt.wantLog {
+				if logs.Len() != 0 {
+					t.Errorf("request logged at info level: %s", logs.String())
+				}
+				return
+			}
+			if handlerID != id {
+				t.Errorf("handler context request ID = %q, want %q", handlerID, id)
+			}
+
+			var body map[string]string
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body["request_id"] != id {
+				t.Errorf("error response = %s, want request_id %s", rr.Body.String(), id)
+			}
+
+			var entry map[string]any
+			if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+				t.Fatalf("request log line is not JSON: %v: %s", err, logs.String())
+			}
+			if entry["request_id"] != id || entry["method"] != "GET" || entry["path"] != tt.path ||
+				entry["status"] != float64(http.StatusNotFound) || entry["duration"] == nil || (tt.cert != "" && entry["client"] != tt.cert) {
+				t.Errorf("request log line = %v", entry)
+			}
+		})
+	}
+}
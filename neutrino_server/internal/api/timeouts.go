@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/neutrino"
+)
+
+// Defaults of the HTTP timeout flags.
+const (
+	DefaultReadTimeout    = 30 * time.Second
+	DefaultWriteTimeout   = 30 * time.Second
+	DefaultIdleTimeout    = 60 * time.Second
+	DefaultMaxScanTimeout = 10 * time.Minute
+)
+
+// scanResponseMargin is the time a scan stopped at its deadline leaves to
+// write its answer before the write timeout.
+const scanResponseMargin = 2 * time.Second
+
+// TimeoutConfig holds the timeouts of the API servers. Read bounds reading a
+// request, Write answering it and Idle how long a kept-alive connection waits
+// for the next request. Scans without a timeout parameter stop in time to
+// answer within Write, and MaxScan bounds the timeout parameter. Zero
+// disables a timeout.
+type TimeoutConfig struct {
+	Read    time.Duration
+	Write   time.Duration
+	Idle    time.Duration
+	MaxScan time.Duration
+}
+
+// DefaultTimeouts returns the timeouts the API servers use by default.
+func DefaultTimeouts() TimeoutConfig {
+	return TimeoutConfig{
+		Read:    DefaultReadTimeout,
+		Write:   DefaultWriteTimeout,
+		Idle:    DefaultIdleTimeout,
+		MaxScan: DefaultMaxScanTimeout,
+	}
+}
+
+// Server returns an HTTP server for handler with the timeouts of cfg.
+func (cfg TimeoutConfig) Server(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:      handler,
+		ReadTimeout:  cfg.Read,
+		WriteTimeout: cfg.Write,
+		IdleTimeout:  cfg.Idle,
+	}
+}
+
+// SetTimeouts sets the timeouts the scan routes derive their deadlines from.
+func (h *Handler) SetTimeouts(cfg TimeoutConfig) {
+	h.timeouts = cfg
+}
+
+// scanContext returns the context of the scan answering r, which ends at the
+// deadline the timeout query parameter asks for or, without one, in time to
+// answer within the write timeout. The write deadline of the response is
+// moved past the scan's deadline, so a scan that stops at it answers with a
+// ScanDeadlineError instead of having its connection dropped, and the time
+// requests spend queued for a scan slot does not count against it.
+func (h *Handler) scanContext(w http.ResponseWriter, r *http.Request) (context.Context, context.CancelFunc, error) {
+	timeout := h.timeouts.Write - scanResponseMargin
+	if param := r.URL.Query().Get("timeout"); param != "" {
+		parsed, err := time.ParseDuration(param)
+		if err != nil || parsed <= 0 {
+			return nil, nil, fmt.Errorf("invalid timeout %q: use a duration such as 30s or 5m", param)
+		}
+		if h.timeouts.MaxScan > 0 && parsed > h.timeouts.MaxScan {
+			return nil, nil, fmt.Errorf("timeout %s exceeds the maximum of %s", parsed, h.timeouts.MaxScan)
+		}
+		timeout = parsed
+	} else if h.timeouts.Write <= scanResponseMargin {
+		// Without a write timeout nothing cuts the answer short
+		ctx, cancel := context.WithCancel(r.Context())
+		return ctx, cancel, nil
+	}
+
+	if h.timeouts.Write > 0 {
+		// Writers that cannot move the deadline keep the server's
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + scanResponseMargin))
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	return ctx, cancel, nil
+}
+
+// scanDeadlineResponse answers a scan stopped at its deadline with the height
+// to resume it from, and the matches found before it for filter matches.
+func (h *Handler) scanDeadlineResponse(w http.ResponseWriter, err *neutrino.ScanDeadlineError) {
+	body := map[string]any{
+		"error":         err.Error(),
+		"resume_height": err.ResumeHeight,
+	}
+	if err.Heights != nil {
+		body["heights"] = err.Heights
+	}
+	if id := w.Header().Get(requestIDHeader); id != "" {
+		body["request_id"] = id
+	}
+	h.writeJSON(w, http.StatusGatewayTimeout, body)
+}
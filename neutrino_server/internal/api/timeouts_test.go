@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btclog"
+	"github.com/gorilla/mux"
+)
+
+func TestScanTimeout(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.NewBackend(os.Stdout).Logger("TEST"))
+	handler.SetTimeouts(TimeoutConfig{Write: 30 * time.Second, MaxScan: time.Minute})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	slowScan := `{"addresses":["1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"],"start_height":8000}`
+	tests := []struct {
+		name       string
+		query      string
+		body       string
+		wantStatus int
+	}{
+		{"deadline exceeded", "?timeout=50ms", slowScan, http.StatusGatewayTimeout},
+		{"within the deadline", "?timeout=5s", `{"addresses":["1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"],"start_height":100}`, http.StatusOK},
+		{"invalid timeout", "?timeout=soon", slowScan, http.StatusBadRequest},
+		{"negative timeout", "?timeout=-1s", slowScan, http.StatusBadRequest},
+		{"over the maximum", "?timeout=2m", slowScan, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/filters/match"+tt.query, bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body)
+			}
+			if tt.wantStatus != http.StatusGatewayTimeout {
+				return
+			}
+			var body struct {
+				Error        string  `json:"error"`
+				ResumeHeight int32   `json:"resume_height"`
+				Heights      []int32 `json:"heights"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.ResumeHeight != 8200 || !reflect.DeepEqual(body.Heights, []int32{8100}) {
+				t.Errorf("body = %+v, want resume_height 8200 and heights [8100]", body)
+			}
+			if body.Error != "scan deadline exceeded, resume from height 8200" {
+				t.Errorf("error = %q", body.Error)
+			}
+		})
+	}
+}
+
+func TestEnrichPSBTScanTimeout(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.Disabled)
+	handler.SetTimeouts(TimeoutConfig{Write: 30 * time.Second, MaxScan: time.Minute})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	req := httptest.NewRequest("POST", "/v1/psbt/enrich?timeout=50ms", bytes.NewBufferString(`{"psbt":"slow-scan"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d: %s", rr.Code, http.StatusGatewayTimeout, rr.Body)
+	}
+}
+
+func TestScanTimeoutDefault(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.NewBackend(os.Stdout).Logger("TEST"))
+
+	// Scans without a timeout parameter end before the write timeout
+	handler.SetTimeouts(TimeoutConfig{Write: 2*time.Second + 100*time.Millisecond})
+	req := httptest.NewRequest("POST", "/v1/filters/match", nil)
+	ctx, cancel, err := handler.scanContext(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > 100*time.Millisecond {
+		t.Errorf("deadline = %v, %v, want within 100ms", deadline, ok)
+	}
+
+	// and without a write timeout they have no deadline
+	handler.SetTimeouts(TimeoutConfig{})
+	ctx, cancel, err = handler.scanContext(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("scan without a write timeout has a deadline")
+	}
+}
+
+func TestScanTimeoutExtendsWriteDeadline(t *testing.T) {
+	handler := NewHandler(&mockNode{}, btclog.NewBackend(os.Stdout).Logger("TEST"))
+	cfg := TimeoutConfig{Write: 200 * time.Millisecond, MaxScan: time.Minute}
+	handler.SetTimeouts(cfg)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	// The scan outlives the server's write timeout but still answers
+	server := httptest.NewUnstartedServer(nil)
+	server.Config = cfg.Server(router)
+	server.Start()
+	defer server.Close()
+
+	body := `{"addresses":["1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"],"start_height":8000}`
+	resp, err := http.Post(server.URL+"/v1/filters/match?timeout=500ms", "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusGatewayTimeout)
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanRecorder records the spans of the package tracer. The global provider
+// is installed once, since the package tracer stays bound to the first.
+var spanRecorder = func() *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return recorder
+}()
+
+func TestTracingMiddleware(t *testing.T) {
+	logger := btclog.NewBackend(os.Stdout).Logger("TEST")
+	handler := NewHandler(&mockNode{}, logger)
+
+	var handlerSpan trace.SpanContext
+	router := mux.NewRouter()
+	router.Use(handler.tracingMiddleware)
+	router.HandleFunc("/v1/tx/{txid}", func(w http.ResponseWriter, r *http.Request) {
+		handlerSpan = trace.SpanContextFromContext(r.Context())
+		if mux.Vars(r)["txid"] == "bad" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}).Methods("GET")
+
+	tests := []struct {
+		name        string
+		path        string
+		traceparent string
+		wantStatus  codes.Code
+	}{
+		{"new trace", "/v1/tx/abc", "", codes.Unset},
+		{"propagated trace", "/v1/tx/def", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", codes.Unset},
+		{"server error", "/v1/tx/bad", "", codes.Error},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := spanRecorder.Ended()
+			span := spans[len(spans)-1]
+			if span.Name() != "GET /v1/tx/{txid}" {
+				t.Errorf("span name = %q, want the route template", span.Name())
+			}
+			if span.SpanContext().SpanID() != handlerSpan.SpanID() {
+				t.Error("handler did not run in the request span")
+			}
+			if span.Status().Code != tt.wantStatus {
+				t.Errorf("span status = %v, want %v", span.Status().Code, tt.wantStatus)
+			}
+			if tt.traceparent != "" && span.SpanContext().TraceID().String() != "0af7651916cd43dd8448eb211c80319c" {
+				t.Errorf("span trace ID = %s, want the propagated trace", span.SpanContext().TraceID())
+			}
+		})
+	}
+}
@@ -0,0 +1,348 @@
+/*
+Package auth manages the API keys of neutrinod and the scopes that limit what
+each key may do.
+
+Keys live in a JSON file, so an operator can provision them without the API.
+Keys created through the admin API are added to the same file. Only SHA-256
+hashes of generated keys are stored. The file also gives the scopes of TLS
+client certificates, by the names they are issued to.
+*/
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope is a permission granted to an API key.
+type Scope string
+
+// Scopes of API keys. Each covers a class of endpoints; admin covers all of
+// them.
+const (
+	// ScopeRead allows queries answered without scanning the chain.
+	ScopeRead Scope = "read"
+	// ScopeBroadcast allows sending transactions to peers.
+	ScopeBroadcast Scope = "broadcast"
+	// ScopeRescan allows watching addresses, outpoints and transactions,
+	// starting the rescans that follow, and queries scanning the chain's
+	// filters and blocks.
+	ScopeRescan Scope = "rescan"
+	// ScopeAdmin allows everything, including managing API keys, wallets
+	// and webhooks.
+	ScopeAdmin Scope = "admin"
+)
+
+// scopes lists the valid scopes in order.
+var scopes = []Scope{ScopeRead, ScopeBroadcast, ScopeRescan, ScopeAdmin}
+
+// keyPrefix marks generated keys, so leaked keys are easy to search for.
+const keyPrefix = "nk_"
+
+var (
+	// ErrKeyExists is returned when creating a key with a name in use.
+	ErrKeyExists = errors.New("API key name already in use")
+	// ErrKeyNotFound is returned when deleting a key that does not exist.
+	ErrKeyNotFound = errors.New("API key not found")
+	// ErrInvalidKey is returned for a key without a name, secret or valid
+	// scopes.
+	ErrInvalidKey = errors.New("invalid API key")
+)
+
+// Key is an API key as stored in the keys file. An operator may give the
+// key itself, or only its SHA-256 hash in hex. A key with a certificate
+// instead gives the scopes of the client certificates issued to that name,
+// their subject's common name or one of their DNS names or email
+// addresses. A key with wallets is bound to them: it may only address those
+// wallets.
+type Key struct {
+	Name        string   `json:"name"`
+	Key         string   `json:"key,omitempty"`
+	KeyHash     string   `json:"key_hash,omitempty"`
+	Certificate string   `json:"certificate,omitempty"`
+	Scopes      []Scope  `json:"scopes"`
+	Wallets     []string `json:"wallets,omitempty"`
+	CreatedAt   int64    `json:"created_at,omitempty"`
+}
+
+// KeyInfo describes an API key without its secret.
+type KeyInfo struct {
+	Name        string   `json:"name"`
+	Certificate string   `json:"certificate,omitempty"`
+	Scopes      []Scope  `json:"scopes"`
+	Wallets     []string `json:"wallets,omitempty"`
+	CreatedAt   int64    `json:"created_at,omitempty"`
+}
+
+// Allows reports whether the key has scope, or admin.
+func (k KeyInfo) Allows(scope Scope) bool {
+	return Allows(k.Scopes, scope)
+}
+
+// AllowsWallet reports whether the key may address wallet: it is bound to
+// no wallets, or to wallet.
+func (k KeyInfo) AllowsWallet(wallet string) bool {
+	return len(k.Wallets) == 0 || slices.Contains(k.Wallets, wallet)
+}
+
+// Allows reports whether granted includes scope, or admin.
+func Allows(granted []Scope, scope Scope) bool {
+	return slices.Contains(granted, scope) || slices.Contains(granted, ScopeAdmin)
+}
+
+// ParseScopes parses a comma-separated list of scopes.
+func ParseScopes(list string) ([]Scope, error) {
+	var parsed []Scope
+	for _, scope := range strings.Split(list, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			parsed = append(parsed, Scope(scope))
+		}
+	}
+	if err := validateScopes(parsed); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// Keyring holds the API keys of a keys file.
+type Keyring struct {
+	mu   sync.RWMutex
+	path string
+	keys []Key
+	hash [][sha256.Size]byte // hash of each key, by index; zero for certificates
+}
+
+// Load reads the keys file at path.
+func Load(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys file: %w", err)
+	}
+
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode API keys file: %w", err)
+	}
+
+	k := &Keyring{path: path}
+	for i, key := range keys {
+		if err := k.add(key); err != nil {
+			return nil, fmt.Errorf("API key %d: %w", i, err)
+		}
+	}
+	return k, nil
+}
+
+// add validates key and adds it to the keyring.
+func (k *Keyring) add(key Key) error {
+	if key.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidKey)
+	}
+	if slices.ContainsFunc(k.keys, func(existing Key) bool { return existing.Name == key.Name }) {
+		return fmt.Errorf("%w: %s", ErrKeyExists, key.Name)
+	}
+	if err := validateScopes(key.Scopes); err != nil {
+		return err
+	}
+	if err := validateWallets(key); err != nil {
+		return err
+	}
+
+	var hash [sha256.Size]byte
+	switch {
+	case key.Certificate != "" && (key.Key != "" || key.KeyHash != ""):
+		return fmt.Errorf("%w: give either a certificate or a key, not both", ErrInvalidKey)
+	case key.Certificate != "":
+		if k.certificate(key.Certificate) >= 0 {
+			return fmt.Errorf("%w: certificate %s is already listed", ErrInvalidKey, key.Certificate)
+		}
+	case key.Key != "" && key.KeyHash != "":
+		return fmt.Errorf("%w: give either key or key_hash, not both", ErrInvalidKey)
+	case key.Key != "":
+		hash = sha256.Sum256([]byte(key.Key))
+	case key.KeyHash != "":
+		decoded, err := hex.DecodeString(key.KeyHash)
+		if err != nil || len(decoded) != sha256.Size {
+			return fmt.Errorf("%w: key_hash must be a hex SHA-256 hash", ErrInvalidKey)
+		}
+		copy(hash[:], decoded)
+	default:
+		return fmt.Errorf("%w: key, key_hash or certificate is required", ErrInvalidKey)
+	}
+
+	k.keys = append(k.keys, key)
+	k.hash = append(k.hash, hash)
+	return nil
+}
+
+// validateScopes checks that scopes is a non-empty list of known scopes.
+func validateScopes(list []Scope) error {
+	if len(list) == 0 {
+		return fmt.Errorf("%w: at least one scope is required", ErrInvalidKey)
+	}
+	for _, scope := range list {
+		if !slices.Contains(scopes, scope) {
+			return fmt.Errorf("%w: unknown scope %q: use read, broadcast, rescan or admin", ErrInvalidKey, scope)
+		}
+	}
+	return nil
+}
+
+// validateWallets checks the wallets key is bound to. A bound key cannot be
+// admin, which could create keys bound to no wallet.
+func validateWallets(key Key) error {
+	if len(key.Wallets) == 0 {
+		return nil
+	}
+	if slices.Contains(key.Wallets, "") {
+		return fmt.Errorf("%w: wallet names cannot be empty", ErrInvalidKey)
+	}
+	if slices.Contains(key.Scopes, ScopeAdmin) {
+		return fmt.Errorf("%w: a key bound to wallets cannot have the admin scope", ErrInvalidKey)
+	}
+	return nil
+}
+
+// Authenticate returns the key matching secret. Every key is compared in
+// constant time, so timing does not reveal how close a guess was.
+func (k *Keyring) Authenticate(secret string) (KeyInfo, bool) {
+	hash := sha256.Sum256([]byte(secret))
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	match := -1
+	for i := range k.hash {
+		if subtle.ConstantTimeCompare(hash[:], k.hash[i][:]) == 1 && k.keys[i].Certificate == "" {
+			match = i
+		}
+	}
+	if match < 0 {
+		return KeyInfo{}, false
+	}
+	return info(k.keys[match]), true
+}
+
+// AuthenticateCertificate returns the key of the first of names, those a
+// verified client certificate is issued to, that the keyring lists.
+func (k *Keyring) AuthenticateCertificate(names []string) (KeyInfo, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, name := range names {
+		if i := k.certificate(name); i >= 0 {
+			return info(k.keys[i]), true
+		}
+	}
+	return KeyInfo{}, false
+}
+
+// certificate returns the index of the key of the certificate name, or -1.
+func (k *Keyring) certificate(name string) int {
+	return slices.IndexFunc(k.keys, func(key Key) bool { return key.Certificate != "" && key.Certificate == name })
+}
+
+// List returns the keys, without their secrets, in file order.
+func (k *Keyring) List() []KeyInfo {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	list := make([]KeyInfo, len(k.keys))
+	for i, key := range k.keys {
+		list[i] = info(key)
+	}
+	return list
+}
+
+// Create generates a key named name with scopes, bound to wallets if any,
+// and saves it. The returned secret is not stored and cannot be recovered
+// later.
+func (k *Keyring) Create(name string, keyScopes []Scope, wallets []string) (string, KeyInfo, error) {
+	var raw [32]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return "", KeyInfo{}, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	secret := keyPrefix + hex.EncodeToString(raw[:])
+	hash := sha256.Sum256([]byte(secret))
+
+	key := Key{
+		Name:      name,
+		KeyHash:   hex.EncodeToString(hash[:]),
+		Scopes:    slices.Clone(keyScopes),
+		Wallets:   slices.Clone(wallets),
+		CreatedAt: time.Now().Unix(),
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if err := k.add(key); err != nil {
+		return "", KeyInfo{}, err
+	}
+	if err := k.save(); err != nil {
+		k.keys = k.keys[:len(k.keys)-1]
+		k.hash = k.hash[:len(k.hash)-1]
+		return "", KeyInfo{}, err
+	}
+	return secret, info(key), nil
+}
+
+// Delete removes the key named name and saves the keyring.
+func (k *Keyring) Delete(name string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	i := slices.IndexFunc(k.keys, func(key Key) bool { return key.Name == name })
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+	}
+	keys, hashes := k.keys, k.hash
+	k.keys = slices.Delete(slices.Clone(keys), i, i+1)
+	k.hash = slices.Delete(slices.Clone(hashes), i, i+1)
+	if err := k.save(); err != nil {
+		k.keys, k.hash = keys, hashes
+		return err
+	}
+	return nil
+}
+
+// save atomically rewrites the keys file. Keys given in plain text are
+// written as their hash.
+func (k *Keyring) save() error {
+	keys := make([]Key, len(k.keys))
+	for i, key := range k.keys {
+		key.Key = ""
+		if key.Certificate == "" {
+			key.KeyHash = hex.EncodeToString(k.hash[i][:])
+		}
+		keys[i] = key
+	}
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode API keys file: %w", err)
+	}
+
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write API keys file: %w", err)
+	}
+	if err := os.Rename(tmp, k.path); err != nil {
+		return fmt.Errorf("failed to replace API keys file: %w", err)
+	}
+	return nil
+}
+
+// info returns the description of key.
+func info(key Key) KeyInfo {
+	return KeyInfo{Name: key.Name, Certificate: key.Certificate, Scopes: key.Scopes, Wallets: key.Wallets, CreatedAt: key.CreatedAt}
+}
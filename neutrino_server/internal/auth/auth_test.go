@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeKeys writes a keys file to a temporary directory.
+func writeKeys(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	hash := sha256.Sum256([]byte("hashed-secret"))
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr error
+	}{
+		{"plain and hashed keys", `[{"name":"dash","key":"s1","scopes":["read"]},{"name":"ops","key_hash":"` + hex.EncodeToString(hash[:]) + `","scopes":["admin"]}]`, nil},
+		{"empty", `[]`, nil},
+		{"missing name", `[{"key":"s1","scopes":["read"]}]`, ErrInvalidKey},
+		{"missing secret", `[{"name":"dash","scopes":["read"]}]`, ErrInvalidKey},
+		{"both secrets", `[{"name":"dash","key":"s1","key_hash":"` + hex.EncodeToString(hash[:]) + `","scopes":["read"]}]`, ErrInvalidKey},
+		{"bad hash", `[{"name":"dash","key_hash":"abcd","scopes":["read"]}]`, ErrInvalidKey},
+		{"no scopes", `[{"name":"dash","key":"s1"}]`, ErrInvalidKey},
+		{"unknown scope", `[{"name":"dash","key":"s1","scopes":["write"]}]`, ErrInvalidKey},
+		{"duplicate name", `[{"name":"dash","key":"s1","scopes":["read"]},{"name":"dash","key":"s2","scopes":["read"]}]`, ErrKeyExists},
+		{"bound to wallets", `[{"name":"shop","key":"s1","scopes":["read","rescan"],"wallets":["shop"]}]`, nil},
+		{"empty wallet name", `[{"name":"shop","key":"s1","scopes":["read"],"wallets":[""]}]`, ErrInvalidKey},
+		{"admin bound to wallets", `[{"name":"shop","key":"s1","scopes":["admin"],"wallets":["shop"]}]`, ErrInvalidKey},
+		{"certificate", `[{"name":"indexer","certificate":"indexer.internal","scopes":["read"]}]`, nil},
+		{"certificate and key", `[{"name":"indexer","certificate":"indexer.internal","key":"s1","scopes":["read"]}]`, ErrInvalidKey},
+		{"duplicate certificate", `[{"name":"a","certificate":"indexer.internal","scopes":["read"]},{"name":"b","certificate":"indexer.internal","scopes":["admin"]}]`, ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeKeys(t, tt.content))
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Load() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Load() of a missing file succeeded")
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	hash := sha256.Sum256([]byte("hashed-secret"))
+	path := writeKeys(t, `[{"name":"dash","key":"plain-secret","scopes":["read"]},{"name":"ops","key_hash":"`+hex.EncodeToString(hash[:])+`","scopes":["admin"]}]`)
+	keys, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for secret, want := range map[string]string{"plain-secret": "dash", "hashed-secret": "ops"} {
+		key, ok := keys.Authenticate(secret)
+		if !ok || key.Name != want {
+			t.Errorf("Authenticate(%q) = %+v, %v, want %s", secret, key, ok, want)
+		}
+	}
+	if _, ok := keys.Authenticate("wrong"); ok {
+		t.Error("Authenticate() accepted an unknown key")
+	}
+
+	secret, created, err := keys.Create("broadcaster", []Scope{ScopeBroadcast}, nil)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if !strings.HasPrefix(secret, keyPrefix) || created.CreatedAt == 0 {
+		t.Errorf("Create() = %q, %+v", secret, created)
+	}
+	if _, _, err := keys.Create("dash", []Scope{ScopeRead}, nil); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("Create() of a taken name error = %v, want ErrKeyExists", err)
+	}
+	if _, _, err := keys.Create("bad", nil, nil); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Create() without scopes error = %v, want ErrInvalidKey", err)
+	}
+	if err := keys.Delete("ops"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := keys.Delete("ops"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Delete() of a deleted key error = %v, want ErrKeyNotFound", err)
+	}
+
+	// The saved file holds only hashes and reloads to the same keys
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "plain-secret") || strings.Contains(string(data), secret) {
+		t.Errorf("keys file stores a secret: %s", data)
+	}
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() of the saved file error = %v", err)
+	}
+	if names := reloaded.List(); len(names) != 2 || names[0].Name != "dash" || names[1].Name != "broadcaster" {
+		t.Errorf("reloaded keys = %+v", names)
+	}
+	for _, secret := range []string{"plain-secret", secret} {
+		if _, ok := reloaded.Authenticate(secret); !ok {
+			t.Errorf("reloaded keys reject %q", secret)
+		}
+	}
+}
+
+func TestAuthenticateCertificate(t *testing.T) {
+	path := writeKeys(t, `[{"name":"dash","key":"plain-secret","scopes":["read"]},{"name":"indexer","certificate":"indexer.internal","scopes":["rescan"]}]`)
+	keys, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key, ok := keys.AuthenticateCertificate([]string{"indexer", "indexer.internal"}); !ok || key.Name != "indexer" || !key.Allows(ScopeRescan) {
+		t.Errorf("AuthenticateCertificate() = %+v, %v, want indexer", key, ok)
+	}
+	if _, ok := keys.AuthenticateCertificate([]string{"dash", "other.internal"}); ok {
+		t.Error("AuthenticateCertificate() accepted an unlisted certificate")
+	}
+	if _, ok := keys.Authenticate(""); ok {
+		t.Error("Authenticate() matched a certificate entry")
+	}
+
+	// Saving keeps the certificate without giving it a key hash
+	if _, _, err := keys.Create("sender", []Scope{ScopeBroadcast}, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved []Key
+	if err := json.Unmarshal(data, &saved); err != nil || len(saved) != 3 || saved[1].Certificate != "indexer.internal" || saved[1].KeyHash != "" {
+		t.Errorf("saved keys = %s", data)
+	}
+	if _, err := Load(path); err != nil {
+		t.Errorf("Load() of the saved file error = %v", err)
+	}
+}
+
+func TestKeyInfoAllows(t *testing.T) {
+	tests := []struct {
+		scopes []Scope
+		scope  Scope
+		want   bool
+	}{
+		{[]Scope{ScopeRead}, ScopeRead, true},
+		{[]Scope{ScopeRead}, ScopeRescan, false},
+		{[]Scope{ScopeRead, ScopeBroadcast}, ScopeBroadcast, true},
+		{[]Scope{ScopeAdmin}, ScopeRescan, true},
+	}
+
+	for _, tt := range tests {
+		if got := (KeyInfo{Scopes: tt.scopes}).Allows(tt.scope); got != tt.want {
+			t.Errorf("Allows(%s) with %v = %v, want %v", tt.scope, tt.scopes, got, tt.want)
+		}
+	}
+}
+
+func TestKeyInfoAllowsWallet(t *testing.T) {
+	tests := []struct {
+		wallets []string
+		wallet  string
+		want    bool
+	}{
+		{nil, "shop", true},
+		{[]string{"shop"}, "shop", true},
+		{[]string{"shop"}, "default", false},
+		{[]string{"shop", "payroll"}, "payroll", true},
+	}
+
+	for _, tt := range tests {
+		if got := (KeyInfo{Wallets: tt.wallets}).AllowsWallet(tt.wallet); got != tt.want {
+			t.Errorf("AllowsWallet(%s) with %v = %v, want %v", tt.wallet, tt.wallets, got, tt.want)
+		}
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    int
+		wantErr bool
+	}{
+		{"read", 1, false},
+		{"read, broadcast", 2, false},
+		{"", 0, true},
+		{"read,write", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			got, err := ParseScopes(tt.list)
+			if (err != nil) != tt.wantErr || len(got) != tt.want {
+				t.Errorf("ParseScopes() = %v, %v, want %d scopes, wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Package buildinfo reports build provenance for neutrinod binaries.
+
+Version, commit, and build time are injected through ldflags on the main
+package; everything else is read from the Go runtime and the build settings
+embedded by the toolchain, so cross-compiled binaries describe themselves
+accurately without extra build steps.
+*/
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Info describes how and for which platform a binary was built.
+type Info struct {
+	Version     string `json:"version"`
+	Commit      string `json:"commit"`
+	BuildTime   string `json:"build_time"`
+	GoVersion   string `json:"go_version"`
+	CGOEnabled  bool   `json:"cgo_enabled"`
+	OS          string `json:"os"`
+	Arch        string `json:"arch"`
+	ArchVariant string `json:"arch_variant,omitempty"`
+	Platform    string `json:"platform"`
+}
+
+// New returns build information for the running binary. Empty commit and
+// buildTime values fall back to the VCS metadata stamped by the Go toolchain.
+func New(version, commit, buildTime string) Info {
+	info := Info{
+		Version:   version,
+		Commit:    commit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		applySettings(&info, bi.Settings)
+	}
+
+	return info
+}
+
+// applySettings fills in fields from the toolchain's embedded build settings.
+func applySettings(info *Info, settings []debug.BuildSetting) {
+	for _, setting := range settings {
+		switch setting.Key {
+		case "CGO_ENABLED":
+			info.CGOEnabled = setting.Value == "1"
+		case "GOARM", "GOARM64", "GOAMD64", "GO386", "GOMIPS", "GOPPC64", "GORISCV64":
+			info.ArchVariant = setting.Value
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		case "vcs.time":
+			if info.BuildTime == "" {
+				info.BuildTime = setting.Value
+			}
+		}
+	}
+}
+
+// String returns a single-line human-readable summary.
+func (i Info) String() string {
+	cgo := "disabled"
+	if i.CGOEnabled {
+		cgo = "enabled"
+	}
+
+	platform := i.Platform
+	if i.ArchVariant != "" {
+		platform = fmt.Sprintf("%s (%s)", platform, i.ArchVariant)
+	}
+
+	commit := i.Commit
+	if commit == "" {
+		commit = "unknown"
+	}
+	buildTime := i.BuildTime
+	if buildTime == "" {
+		buildTime = "unknown"
+	}
+
+	return fmt.Sprintf("neutrinod %s (commit %s, built %s, %s %s, cgo %s)",
+		i.Version, commit, buildTime, i.GoVersion, platform, cgo)
+}
@@ -0,0 +1,101 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	info := New("v1.2.3", "abc1234", "2026-01-01T00:00:00Z")
+
+	if info.Version != "v1.2.3" {
+		t.Errorf("Version = %q, want v1.2.3", info.Version)
+	}
+
+	if info.Commit != "abc1234" {
+		t.Errorf("Commit = %q, want abc1234", info.Commit)
+	}
+
+	if info.GoVersion != runtime.Version() {
+		t.Errorf("GoVersion = %q, want %q", info.GoVersion, runtime.Version())
+	}
+
+	if want := runtime.GOOS + "/" + runtime.GOARCH; info.Platform != want {
+		t.Errorf("Platform = %q, want %q", info.Platform, want)
+	}
+}
+
+func TestApplySettings(t *testing.T) {
+	tests := []struct {
+		name          string
+		info          Info
+		settings      []debug.BuildSetting
+		wantCGO       bool
+		wantVariant   string
+		wantCommit    string
+		wantBuildTime string
+	}{
+		{
+			name: "cgo disabled arm with vcs fallback",
+			settings: []debug.BuildSetting{
+				{Key: "CGO_ENABLED", Value: "0"},
+				{Key: "GOARM", Value: "7"},
+				{Key: "vcs.revision", Value: "deadbeef"},
+				{Key: "vcs.time", Value: "2026-02-02T00:00:00Z"},
+			},
+			wantVariant:   "7",
+			wantCommit:    "deadbeef",
+			wantBuildTime: "2026-02-02T00:00:00Z",
+		},
+		{
+			name: "ldflags values take precedence over vcs",
+			info: Info{Commit: "abc1234", BuildTime: "2026-01-01"},
+			settings: []debug.BuildSetting{
+				{Key: "CGO_ENABLED", Value: "1"},
+				{Key: "vcs.revision", Value: "deadbeef"},
+				{Key: "vcs.time", Value: "2026-02-02T00:00:00Z"},
+			},
+			wantCGO:       true,
+			wantCommit:    "abc1234",
+			wantBuildTime: "2026-01-01",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := tt.info
+			applySettings(&info, tt.settings)
+
+			if info.CGOEnabled != tt.wantCGO {
+				t.Errorf("CGOEnabled = %v, want %v", info.CGOEnabled, tt.wantCGO)
+			}
+			if info.ArchVariant != tt.wantVariant {
+				t.Errorf("ArchVariant = %q, want %q", info.ArchVariant, tt.wantVariant)
+			}
+			if info.Commit != tt.wantCommit {
+				t.Errorf("Commit = %q, want %q", info.Commit, tt.wantCommit)
+			}
+			if info.BuildTime != tt.wantBuildTime {
+				t.Errorf("BuildTime = %q, want %q", info.BuildTime, tt.wantBuildTime)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	info := Info{
+		Version:     "v1.2.3",
+		GoVersion:   "go1.25.0",
+		Platform:    "linux/arm",
+		ArchVariant: "7",
+	}
+
+	got := info.String()
+	for _, want := range []string{"v1.2.3", "commit unknown", "linux/arm (7)", "cgo disabled"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("String() = %q, missing %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+/*
+Package config reads neutrinod's configuration files.
+
+A configuration file is YAML or TOML and sets the same options as the
+environment variables, named like them in any case and with dashes or
+underscores: tor_proxy, TOR_PROXY and tor-proxy all set TOR_PROXY. Tables
+prefix the options they hold, so a rate_limit option in a client table is
+CLIENT_RATE_LIMIT. Lists set options taking several values.
+*/
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"go.yaml.in/yaml/v3"
+)
+
+// Values are the options set by a configuration file, keyed by the name of
+// their environment variable.
+type Values struct {
+	path   string
+	values map[string][]string
+	used   map[string]bool
+}
+
+// Load reads the configuration file at path, in YAML for the .yaml and .yml
+// extensions and in TOML for .toml.
+func Load(path string) (*Values, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		if err := decoder.Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	case ".toml":
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown format of config file %s: use a .yaml, .yml or .toml extension", path)
+	}
+
+	v := &Values{path: path, values: make(map[string][]string), used: make(map[string]bool)}
+	if err := v.flatten("", doc); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return v, nil
+}
+
+// flatten adds the options of table, prefixing their names with prefix.
+func (v *Values) flatten(prefix string, table map[string]any) error {
+	for name, value := range table {
+		key := prefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		if value == nil {
+			continue
+		}
+		if nested, ok := value.(map[string]any); ok {
+			if err := v.flatten(key+"_", nested); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := v.values[key]; ok {
+			return fmt.Errorf("%s is set more than once", key)
+		}
+
+		var items []any
+		if list, ok := value.([]any); ok {
+			items = list
+		} else {
+			items = []any{value}
+		}
+		values := make([]string, 0, len(items))
+		for _, item := range items {
+			s, err := scalar(item)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			values = append(values, s)
+		}
+		v.values[key] = values
+	}
+	return nil
+}
+
+// scalar formats a single option value.
+func scalar(value any) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case int:
+		return strconv.Itoa(value), nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case uint64:
+		return strconv.FormatUint(value, 10), nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	case time.Time:
+		return value.Format(time.RFC3339), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", value)
+	}
+}
+
+// Path returns the path the values were loaded from.
+func (v *Values) Path() string {
+	return v.path
+}
+
+// Lookup returns the value of the option named key, with the values of a
+// list joined by commas. Options looked up are marked as known, see
+// Unknown. Lookup on nil Values finds nothing.
+func (v *Values) Lookup(key string) (string, bool) {
+	values, ok := v.List(key)
+	return strings.Join(values, ","), ok
+}
+
+// List returns the values of the option named key, marking it as known.
+func (v *Values) List(key string) ([]string, bool) {
+	if v == nil {
+		return nil, false
+	}
+	v.used[key] = true
+	values, ok := v.values[key]
+	return values, ok
+}
+
+// Unknown returns the sorted names of the options in the file that were
+// never looked up, which are misspelt or not options at all.
+func (v *Values) Unknown() []string {
+	if v == nil {
+		return nil
+	}
+	var unknown []string
+	for key := range v.values {
+		if !v.used[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	slices.Sort(unknown)
+	return unknown
+}
+
+// Known returns the sorted names of every option looked up so far, whether
+// set in the file or not.
+func (v *Values) Known() []string {
+	if v == nil {
+		return nil
+	}
+	known := make([]string, 0, len(v.used))
+	for key := range v.used {
+		known = append(known, key)
+	}
+	slices.Sort(known)
+	return known
+}
+
+// Changed returns the sorted names of the options whose values differ
+// between v and other, including those set in only one of them.
+func (v *Values) Changed(other *Values) []string {
+	var a, b map[string][]string
+	if v != nil {
+		a = v.values
+	}
+	if other != nil {
+		b = other.values
+	}
+
+	var changed []string
+	for key, values := range a {
+		if !slices.Equal(values, b[key]) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
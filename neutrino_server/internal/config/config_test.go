@@ -0,0 +1,171 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	const yamlConfig = `
+network: signet
+data-dir: /srv/neutrino
+listen_addr:
+  - 127.0.0.1:8334
+  - unix:/run/neutrinod.sock?auth=none
+scan_workers: 8
+scan_mode: strict
+fee_fallback: false
+trace_sample_ratio: 0.25
+client:
+  rate_limit: 5
+  rate_limit_burst: 10
+unset:
+`
+	const tomlConfig = `
+network = "signet"
+DATA_DIR = "/srv/neutrino"
+listen_addr = ["127.0.0.1:8334", "unix:/run/neutrinod.sock?auth=none"]
+scan_workers = 8
+scan_mode = "strict"
+fee_fallback = false
+trace_sample_ratio = 0.25
+
+[client]
+rate_limit = 5
+rate-limit-burst = 10
+`
+
+	want := map[string][]string{
+		"NETWORK":                 {"signet"},
+		"DATA_DIR":                {"/srv/neutrino"},
+		"LISTEN_ADDR":             {"127.0.0.1:8334", "unix:/run/neutrinod.sock?auth=none"},
+		"SCAN_WORKERS":            {"8"},
+		"SCAN_MODE":               {"strict"},
+		"FEE_FALLBACK":            {"false"},
+		"TRACE_SAMPLE_RATIO":      {"0.25"},
+		"CLIENT_RATE_LIMIT":       {"5"},
+		"CLIENT_RATE_LIMIT_BURST": {"10"},
+	}
+
+	for _, tt := range []struct {
+		name    string
+		content string
+	}{
+		{"neutrinod.yaml", yamlConfig},
+		{"neutrinod.toml", tomlConfig},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := Load(writeConfig(t, tt.name, tt.content))
+			if err != nil {
+				t.Fatalf("Load() failed: %v", err)
+			}
+			for key, wantValues := range want {
+				got, ok := values.List(key)
+				if !ok || !slices.Equal(got, wantValues) {
+					t.Errorf("List(%s) = %q, %v; want %q", key, got, ok, wantValues)
+				}
+			}
+			if got, _ := values.Lookup("LISTEN_ADDR"); got != "127.0.0.1:8334,unix:/run/neutrinod.sock?auth=none" {
+				t.Errorf("Lookup(LISTEN_ADDR) = %q, want the values joined by commas", got)
+			}
+			if _, ok := values.Lookup("UNSET"); ok {
+				t.Error("Lookup() of an empty option should find nothing")
+			}
+			if unknown := values.Unknown(); len(unknown) != 0 {
+				t.Errorf("Unknown() = %v after looking up every option", unknown)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"unknown format", "neutrinod.json", `{"network": "signet"}`},
+		{"invalid YAML", "neutrinod.yaml", "network: [signet"},
+		{"invalid TOML", "neutrinod.toml", "network = "},
+		{"set twice", "neutrinod.yaml", "client_rate_limit: 5\nclient:\n  rate_limit: 10\n"},
+		{"nested list", "neutrinod.yaml", "listen_addr:\n  - [127.0.0.1:8334]\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(writeConfig(t, tt.file, tt.content)); err == nil {
+				t.Error("Load() should fail")
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Load() of a missing file should fail")
+	}
+}
+
+func TestUnknown(t *testing.T) {
+	values, err := Load(writeConfig(t, "neutrinod.yaml", "network: signet\nnetwrok: mainnet\nscan_workers: 2\n"))
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	values.Lookup("NETWORK")
+	values.Lookup("SCAN_WORKERS")
+	if got := values.Unknown(); !slices.Equal(got, []string{"NETWROK"}) {
+		t.Errorf("Unknown() = %v, want [NETWROK]", got)
+	}
+	values.Lookup("TOR_PROXY")
+	if got := values.Known(); !slices.Equal(got, []string{"NETWORK", "SCAN_WORKERS", "TOR_PROXY"}) {
+		t.Errorf("Known() = %v, want the options looked up", got)
+	}
+
+	var empty *Values
+	if _, ok := empty.Lookup("NETWORK"); ok || empty.Unknown() != nil {
+		t.Error("nil Values should find nothing")
+	}
+}
+
+func TestEmptyFile(t *testing.T) {
+	values, err := Load(writeConfig(t, "neutrinod.yml", "# nothing set yet\n"))
+	if err != nil {
+		t.Fatalf("Load() of an empty file failed: %v", err)
+	}
+	if _, ok := values.Lookup("NETWORK"); ok {
+		t.Error("empty file should set nothing")
+	}
+}
+
+func TestChanged(t *testing.T) {
+	before, err := Load(writeConfig(t, "before.yaml", "network: signet\nlog_level: info\nadd_peers: [a, b]\nscan_workers: 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := Load(writeConfig(t, "after.yaml", "network: signet\nlog_level: debug\nadd_peers: [a, c]\nscan_mode: strict\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"ADD_PEERS", "LOG_LEVEL", "SCAN_MODE", "SCAN_WORKERS"}
+	if got := before.Changed(after); !slices.Equal(got, want) {
+		t.Errorf("Changed() = %v, want %v", got, want)
+	}
+	if got := after.Changed(after); len(got) != 0 {
+		t.Errorf("Changed() of the same values = %v, want none", got)
+	}
+	var none *Values
+	if got := none.Changed(after); len(got) != 4 {
+		t.Errorf("Changed() from no file = %v, want every option", got)
+	}
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"context"
+	"strings"
+
+	"github.com/btcsuite/btclog"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the ID of the API request it
+// serves.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// FromContext returns logger, tagging its lines with the request ID of ctx
+// if it carries one. The ID leads each message as request=<id>, and is the
+// request_id field of the JSON format.
+func FromContext(ctx context.Context, logger btclog.Logger) btclog.Logger {
+	id := RequestID(ctx)
+	if id == "" {
+		return logger
+	}
+	return &requestLogger{Logger: logger, id: id}
+}
+
+// requestLogger prefixes the lines of a logger with a request ID.
+type requestLogger struct {
+	btclog.Logger
+	id string
+}
+
+func (l *requestLogger) params(params []any) []any {
+	return append([]any{KV("request_id", l.id)}, params...)
+}
+
+// lineFormat returns the format of a line of the values v, spaced as Sprintln
+// spaces them, so its values keep their fields.
+func lineFormat(v []any) string {
+	return "request=%s" + strings.Repeat(" %v", len(v))
+}
+
+func (l *requestLogger) Tracef(format string, params ...any) {
+	l.Logger.Tracef("request=%s "+format, l.params(params)...)
+}
+
+func (l *requestLogger) Debugf(format string, params ...any) {
+	l.Logger.Debugf("request=%s "+format, l.params(params)...)
+}
+
+func (l *requestLogger) Infof(format string, params ...any) {
+	l.Logger.Infof("request=%s "+format, l.params(params)...)
+}
+
+func (l *requestLogger) Warnf(format string, params ...any) {
+	l.Logger.Warnf("request=%s "+format, l.params(params)...)
+}
+
+func (l *requestLogger) Errorf(format string, params ...any) {
+	l.Logger.Errorf("request=%s "+format, l.params(params)...)
+}
+
+func (l *requestLogger) Criticalf(format string, params ...any) {
+	l.Logger.Criticalf("request=%s "+format, l.params(params)...)
+}
+
+func (l *requestLogger) Trace(v ...any)    { l.Logger.Tracef(lineFormat(v), l.params(v)...) }
+func (l *requestLogger) Debug(v ...any)    { l.Logger.Debugf(lineFormat(v), l.params(v)...) }
+func (l *requestLogger) Info(v ...any)     { l.Logger.Infof(lineFormat(v), l.params(v)...) }
+func (l *requestLogger) Warn(v ...any)     { l.Logger.Warnf(lineFormat(v), l.params(v)...) }
+func (l *requestLogger) Error(v ...any)    { l.Logger.Errorf(lineFormat(v), l.params(v)...) }
+func (l *requestLogger) Critical(v ...any) { l.Logger.Criticalf(lineFormat(v), l.params(v)...) }
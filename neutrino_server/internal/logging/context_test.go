@@ -0,0 +1,43 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewJSONBackend(&buf).Logger("NTRN")
+
+	if got := FromContext(context.Background(), logger); got != logger {
+		t.Errorf("FromContext() without a request ID = %v, want the logger itself", got)
+	}
+
+	requestLogger := FromContext(WithRequestID(context.Background(), "abc123"), logger)
+	requestLogger.Infof("Found UTXO creation at height %d", KV("height", 7))
+	requestLogger.Info("done at height", KV("height", 8))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2", len(lines))
+	}
+	want := []string{"request=abc123 Found UTXO creation at height 7", "request=abc123 done at height 8"}
+	for i, line := range lines {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry["msg"] != want[i] {
+			t.Errorf("line %d msg = %v, want %q", i, entry["msg"], want[i])
+		}
+	}
+	if !strings.Contains(lines[0], `"request_id":"abc123","height":7`) {
+		t.Errorf("formatted line lacks request_id and height fields: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"request_id":"abc123","height":8`) {
+		t.Errorf("line lacks request_id and height fields: %s", lines[1])
+	}
+}
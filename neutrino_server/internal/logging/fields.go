@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"fmt"
+)
+
+// Field is a value of a log line given with the name the JSON format logs
+// it as. A Field formats as its value, so the text format and the message
+// of JSON lines are unchanged:
+//
+//	log.Infof("Found UTXO spend at height %d in tx %s",
+//		logging.KV("height", height), logging.KV("txid", txid))
+type Field struct {
+	Key   string
+	Value any
+}
+
+// KV returns the field key of value.
+func KV(key string, value any) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Format formats the value of the field with the verb and flags it is
+// printed with.
+func (f Field) Format(state fmt.State, verb rune) {
+	fmt.Fprintf(state, fmt.FormatString(state, verb), f.Value)
+}
+
+// field is a member of a JSON log line after the standard ones.
+type field struct {
+	key   string
+	value any
+}
+
+// formatFields returns the fields of a log line formatted from params: the
+// values given as a Field, and errors, logged as the error field. The first
+// value of each field wins.
+func formatFields(params []any) []field {
+	var fields []field
+	seen := make(map[string]bool)
+	add := func(key string, value any) {
+		if !seen[key] {
+			seen[key] = true
+			fields = append(fields, field{key: key, value: value})
+		}
+	}
+
+	for _, param := range params {
+		switch value := param.(type) {
+		case Field:
+			add(value.Key, fieldValue(value.Value))
+		case error:
+			add("error", value.Error())
+		}
+	}
+	return fields
+}
+
+// isInteger reports whether value is of an integer type.
+func isInteger(value any) bool {
+	switch value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return true
+	}
+	return false
+}
+
+// fieldValue keeps numbers, booleans and strings as they are and logs
+// anything else, such as hashes and addresses, in its printed form.
+func fieldValue(value any) any {
+	switch value.(type) {
+	case string, bool, float32, float64:
+		return value
+	}
+	if isInteger(value) {
+		return value
+	}
+	return fmt.Sprint(value)
+}
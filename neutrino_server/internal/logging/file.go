@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Defaults of the log file rotation flags.
+const (
+	DefaultFileMaxSizeMB  = 100
+	DefaultFileMaxAge     = 7 * 24 * time.Hour
+	DefaultFileMaxBackups = 10
+)
+
+// FileConfig configures a rotated log file.
+type FileConfig struct {
+	Path string
+
+	// MaxSizeMB is the size in MiB at which the file is rotated.
+	MaxSizeMB int
+
+	// Rotated files are removed once older than MaxAge or beyond the
+	// MaxBackups most recent. Zero keeps them regardless. Rotated files
+	// are compressed.
+	MaxAge     time.Duration
+	MaxBackups int
+}
+
+// OpenFile opens the log file of cfg for appending, creating its directory
+// if needed, and returns a writer that rotates it.
+func OpenFile(cfg FileConfig) (io.WriteCloser, error) {
+	if cfg.MaxSizeMB <= 0 {
+		return nil, fmt.Errorf("invalid log file size limit %d MiB: must be positive", cfg.MaxSizeMB)
+	}
+	if cfg.MaxAge < 0 || cfg.MaxBackups < 0 {
+		return nil, errors.New("log file age and backup limits cannot be negative")
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	// Age limits are whole days; a partial day rounds up so a limit is
+	// never enforced early
+	maxAgeDays := int((cfg.MaxAge + 24*time.Hour - 1) / (24 * time.Hour))
+
+	file := &lumberjack.Logger{
+		Filename:   cfg.Path,
+		MaxSize:    cfg.MaxSizeMB,
+		MaxAge:     maxAgeDays,
+		MaxBackups: cfg.MaxBackups,
+		LocalTime:  true,
+		Compress:   true,
+	}
+	// Open the file now so a bad path fails startup rather than every
+	// later log line
+	if _, err := file.Write(nil); err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	return file, nil
+}
@@ -0,0 +1,46 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "neutrinod.log")
+
+	file, err := OpenFile(FileConfig{Path: path, MaxSizeMB: 1, MaxAge: 36 * time.Hour, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("log file not created on open: %v", err)
+	}
+
+	backend := NewJSONBackend(file)
+	backend.Logger("MAIN").Infof("Starting at height %d", KV("height", 1))
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `"height":1`) {
+		t.Errorf("log file content = %q", content)
+	}
+
+	invalid := []FileConfig{
+		{Path: path, MaxSizeMB: 0},
+		{Path: path, MaxSizeMB: 1, MaxAge: -time.Hour},
+		{Path: path, MaxSizeMB: 1, MaxBackups: -1},
+	}
+	for _, cfg := range invalid {
+		if _, err := OpenFile(cfg); err == nil {
+			t.Errorf("OpenFile(%+v) succeeded, want an error", cfg)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+/*
+Package logging provides the log backends of neutrinod: btclog's text format
+and a structured JSON format for log collectors such as Loki or ELK.
+*/
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btclog"
+)
+
+// Log formats accepted by NewBackend.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Backend creates the loggers of each subsystem. *btclog.Backend is a
+// Backend writing btclog's text format.
+type Backend interface {
+	Logger(subsystem string) btclog.Logger
+}
+
+// NewBackend returns a backend writing logs to w in format.
+func NewBackend(w io.Writer, format string) (Backend, error) {
+	switch format {
+	case "", FormatText:
+		return btclog.NewBackend(w), nil
+	case FormatJSON:
+		return NewJSONBackend(w), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q: use %s or %s", format, FormatText, FormatJSON)
+	}
+}
+
+// levelNames are the level values of JSON log lines.
+var levelNames = map[btclog.Level]string{
+	btclog.LevelTrace:    "trace",
+	btclog.LevelDebug:    "debug",
+	btclog.LevelInfo:     "info",
+	btclog.LevelWarn:     "warn",
+	btclog.LevelError:    "error",
+	btclog.LevelCritical: "critical",
+}
+
+// JSONBackend writes one JSON object per log line, with the time, level,
+// subsystem and message, plus the fields such as height, txid and peer the
+// line's values are given as with KV.
+type JSONBackend struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONBackend returns a backend writing JSON log lines to w.
+func NewJSONBackend(w io.Writer) *JSONBackend {
+	return &JSONBackend{w: w}
+}
+
+// Logger returns a logger for subsystem, logging at info level and above.
+func (b *JSONBackend) Logger(subsystem string) btclog.Logger {
+	l := &jsonLogger{backend: b, subsystem: subsystem}
+	l.level.Store(uint32(btclog.LevelInfo))
+	return l
+}
+
+// write writes one log line. Values that cannot be encoded are logged as
+// their string form rather than dropping the line.
+func (b *JSONBackend) write(level btclog.Level, subsystem, msg string, fields []field) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	writeField(&buf, "time", time.Now().Format("2006-01-02T15:04:05.000Z07:00"))
+	buf.WriteByte(',')
+	writeField(&buf, "level", levelNames[level])
+	buf.WriteByte(',')
+	writeField(&buf, "subsystem", subsystem)
+	buf.WriteByte(',')
+	writeField(&buf, "msg", msg)
+	for _, f := range fields {
+		buf.WriteByte(',')
+		writeField(&buf, f.key, f.value)
+	}
+	buf.WriteString("}\n")
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.w.Write(buf.Bytes())
+}
+
+// writeField writes a JSON object member.
+func writeField(buf *bytes.Buffer, key string, value any) {
+	encodedKey, _ := json.Marshal(key)
+	buf.Write(encodedKey)
+	buf.WriteByte(':')
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(encoded)
+}
+
+// jsonLogger is the logger of one subsystem of a JSONBackend.
+type jsonLogger struct {
+	backend   *JSONBackend
+	subsystem string
+	level     atomic.Uint32
+}
+
+func (l *jsonLogger) logf(level btclog.Level, format string, params []any) {
+	if level < l.Level() {
+		return
+	}
+	l.backend.write(level, l.subsystem, fmt.Sprintf(format, params...), formatFields(params))
+}
+
+func (l *jsonLogger) log(level btclog.Level, v []any) {
+	if level < l.Level() {
+		return
+	}
+	l.backend.write(level, l.subsystem, strings.TrimSuffix(fmt.Sprintln(v...), "\n"), formatFields(v))
+}
+
+func (l *jsonLogger) Tracef(format string, params ...any) {
+	l.logf(btclog.LevelTrace, format, params)
+}
+
+func (l *jsonLogger) Debugf(format string, params ...any) {
+	l.logf(btclog.LevelDebug, format, params)
+}
+
+func (l *jsonLogger) Infof(format string, params ...any) {
+	l.logf(btclog.LevelInfo, format, params)
+}
+
+func (l *jsonLogger) Warnf(format string, params ...any) {
+	l.logf(btclog.LevelWarn, format, params)
+}
+
+func (l *jsonLogger) Errorf(format string, params ...any) {
+	l.logf(btclog.LevelError, format, params)
+}
+
+func (l *jsonLogger) Criticalf(format string, params ...any) {
+	l.logf(btclog.LevelCritical, format, params)
+}
+
+func (l *jsonLogger) Trace(v ...any)    { l.log(btclog.LevelTrace, v) }
+func (l *jsonLogger) Debug(v ...any)    { l.log(btclog.LevelDebug, v) }
+func (l *jsonLogger) Info(v ...any)     { l.log(btclog.LevelInfo, v) }
+func (l *jsonLogger) Warn(v ...any)     { l.log(btclog.LevelWarn, v) }
+func (l *jsonLogger) Error(v ...any)    { l.log(btclog.LevelError, v) }
+func (l *jsonLogger) Critical(v ...any) { l.log(btclog.LevelCritical, v) }
+
+func (l *jsonLogger) Level() btclog.Level {
+	return btclog.Level(l.level.Load())
+}
+
+func (l *jsonLogger) SetLevel(level btclog.Level) {
+	l.level.Store(uint32(level))
+}
+
+// SharedLevel is a Backend whose loggers share one level, so SetLevel
+// changes the level of every subsystem at once while the node runs.
+type SharedLevel struct {
+	backend Backend
+
+	mu      sync.Mutex
+	level   btclog.Level
+	loggers []btclog.Logger
+}
+
+// NewSharedLevel returns a backend creating loggers of backend at level.
+func NewSharedLevel(backend Backend, level btclog.Level) *SharedLevel {
+	return &SharedLevel{backend: backend, level: level}
+}
+
+// Logger returns a logger for subsystem at the shared level.
+func (s *SharedLevel) Logger(subsystem string) btclog.Logger {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l := s.backend.Logger(subsystem)
+	l.SetLevel(s.level)
+	s.loggers = append(s.loggers, l)
+	return l
+}
+
+// SetLevel sets the level of every logger created so far and those created
+// later.
+func (s *SharedLevel) SetLevel(level btclog.Level) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.level = level
+	for _, l := range s.loggers {
+		l.SetLevel(level)
+	}
+}
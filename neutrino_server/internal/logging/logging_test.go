@@ -0,0 +1,133 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btclog"
+)
+
+func TestNewBackend(t *testing.T) {
+	tests := []struct {
+		format  string
+		want    any
+		wantErr bool
+	}{
+		{"", &btclog.Backend{}, false},
+		{FormatText, &btclog.Backend{}, false},
+		{FormatJSON, &JSONBackend{}, false},
+		{"xml", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			backend, err := NewBackend(&bytes.Buffer{}, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewBackend() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && reflect.TypeOf(backend) != reflect.TypeOf(tt.want) {
+				t.Errorf("NewBackend() = %T, want %T", backend, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONBackend(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewJSONBackend(&buf).Logger("NTRN")
+
+	logger.Debugf("Block %d filter matched", 100)
+	logger.Infof("Found UTXO spend at height %d in tx %s", KV("height", 800000), KV("txid", "ab12"))
+	logger.Warn("peer", "dropped")
+	logger.SetLevel(btclog.LevelDebug)
+	logger.Debugf("Block %d filter matched", 101)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d log lines, want 3 with debug suppressed at info level:\n%s", len(lines), buf.String())
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("log line is not JSON: %v", err)
+	}
+	if entry["level"] != "info" || entry["subsystem"] != "NTRN" ||
+		entry["msg"] != "Found UTXO spend at height 800000 in tx ab12" ||
+		entry["height"] != float64(800000) || entry["txid"] != "ab12" || entry["time"] == "" {
+		t.Errorf("log line = %v", entry)
+	}
+	if !strings.HasPrefix(lines[0], `{"time":`) {
+		t.Errorf("log line %s does not start with the time", lines[0])
+	}
+
+	entry = nil
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("log line is not JSON: %v", err)
+	}
+	if entry["level"] != "warn" || entry["msg"] != "peer dropped" {
+		t.Errorf("log line = %v", entry)
+	}
+}
+
+func TestSharedLevel(t *testing.T) {
+	var buf bytes.Buffer
+	shared := NewSharedLevel(btclog.NewBackend(&buf), btclog.LevelWarn)
+	main := shared.Logger("MAIN")
+
+	main.Info("hidden")
+	shared.SetLevel(btclog.LevelDebug)
+	node := shared.Logger("NTRN")
+	main.Debug("main debug")
+	node.Debug("node debug")
+	shared.SetLevel(btclog.LevelError)
+	node.Warn("hidden")
+
+	out := buf.String()
+	if strings.Contains(out, "hidden") || !strings.Contains(out, "main debug") || !strings.Contains(out, "node debug") {
+		t.Errorf("log output = %q, want only the debug lines logged after lowering the level", out)
+	}
+	if node.Level() != btclog.LevelError {
+		t.Errorf("logger level = %v, want %v", node.Level(), btclog.LevelError)
+	}
+}
+
+func TestFormatFields(t *testing.T) {
+	hash := chainhash.Hash{1}
+
+	tests := []struct {
+		name   string
+		params []any
+		want   []field
+	}{
+		{"height and txid", []any{KV("height", int32(5)), KV("txid", "ab")},
+			[]field{{"height", int32(5)}, {"txid", "ab"}}},
+		{"error", []any{KV("height", 7), errors.New("timeout")},
+			[]field{{"height", 7}, {"error", "timeout"}}},
+		{"printed form", []any{KV("block_hash", &hash)},
+			[]field{{"block_hash", hash.String()}}},
+		{"first value wins", []any{KV("height", 1), KV("height", 2)},
+			[]field{{"height", 1}}},
+		{"unnamed values", []any{1, "ab"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatFields(tt.params); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("formatFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldFormat(t *testing.T) {
+	hash := chainhash.Hash{1}
+	if got := fmt.Sprintf("at height %05d in block %s (%v)", KV("height", 9), KV("block_hash", &hash), KV("ok", true)); got != "at height 00009 in block "+hash.String()+" (true)" {
+		t.Errorf("Sprintf() of fields = %q", got)
+	}
+}
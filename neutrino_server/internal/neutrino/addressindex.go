@@ -0,0 +1,371 @@
+package neutrino
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btclog"
+	"github.com/btcsuite/btcwallet/walletdb"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/addrindex"
+)
+
+const (
+	// addressIndexResyncInterval is how often an address index a copy
+	// failed to update is resynced by copying the whole store into it.
+	addressIndexResyncInterval = time.Minute
+
+	// maxIndexBacklog bounds the copies waiting for the address index.
+	// Beyond it they are dropped and the index is resynced instead, so an
+	// unreachable index does not keep a long rescan's changes in memory.
+	maxIndexBacklog = 10000
+)
+
+// indexMirror copies the UTXOs and indexed transactions written to the
+// store into the external address index, see Config.IndexDB. Copies are
+// queued as the store writes commit and made in order by run, so store
+// writes never wait on the index. A failed copy marks the index dirty, and
+// copies are skipped until a resync has copied the whole store again.
+type indexMirror struct {
+	db     *addrindex.DB
+	store  *Store
+	logger btclog.Logger
+
+	// mu orders the queued copies as their store writes commit, and
+	// resyncs snapshot the store under it
+	mu      sync.Mutex
+	backlog []func(db *addrindex.DB) error
+	dirty   bool
+
+	// wake tells run that copies were queued.
+	wake chan struct{}
+}
+
+func newIndexMirror(db *addrindex.DB, store *Store, logger btclog.Logger) *indexMirror {
+	return &indexMirror{db: db, store: store, logger: logger, wake: make(chan struct{}, 1)}
+}
+
+// mirror runs write, which commits a change to the store, then queues copy
+// to copy the change into the index.
+func (m *indexMirror) mirror(write func() error, copy func(db *addrindex.DB) error) error {
+	if m == nil {
+		return write()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := write(); err != nil {
+		return err
+	}
+	m.queue(copy)
+	return nil
+}
+
+// queue adds copy to the backlog, unless the index is dirty. Callers hold
+// mu.
+func (m *indexMirror) queue(copy func(db *addrindex.DB) error) {
+	if m.dirty {
+		return
+	}
+	if len(m.backlog) >= maxIndexBacklog {
+		m.logger.Warnf("%d address index updates are pending, resyncing the index instead", len(m.backlog))
+		m.backlog = nil
+		m.dirty = true
+		return
+	}
+	m.backlog = append(m.backlog, copy)
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// flush makes the queued copies in order. A failed copy drops the rest and
+// marks the index dirty.
+func (m *indexMirror) flush() {
+	for {
+		m.mu.Lock()
+		batch := m.backlog
+		m.backlog = nil
+		m.mu.Unlock()
+		if len(batch) == 0 {
+			return
+		}
+
+		for _, copy := range batch {
+			if err := copy(m.db); err != nil {
+				m.logger.Warnf("Failed to update the address index, resyncing it: %v", err)
+				m.mu.Lock()
+				m.dirty = true
+				m.backlog = nil
+				m.mu.Unlock()
+				return
+			}
+		}
+	}
+}
+
+// resync replaces the contents of the index with a copy of the store.
+// Changes written after the store is read are queued, and flush copies them
+// once the index holds the copy.
+func (m *indexMirror) resync() error {
+	m.mu.Lock()
+	utxos, txs, err := m.store.indexSnapshot()
+	if err == nil {
+		m.backlog = nil
+		m.dirty = false
+	}
+	m.mu.Unlock()
+
+	if err == nil {
+		err = m.db.Replace(utxos, txs)
+	}
+	if err != nil {
+		m.mu.Lock()
+		m.dirty = true
+		m.backlog = nil
+		m.mu.Unlock()
+		return fmt.Errorf("failed to resync the address index: %w", err)
+	}
+	return nil
+}
+
+// recordTip queues recording height as the chain tip the index is current
+// to, unless a failed copy left it behind the store.
+func (m *indexMirror) recordTip(height int32) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queue(func(db *addrindex.DB) error {
+		return db.SetTip(height)
+	})
+}
+
+// needsResync reports whether a copy into the index failed since the last
+// resync.
+func (m *indexMirror) needsResync() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.dirty
+}
+
+// run makes the copies as they are queued, and resyncs the index every
+// addressIndexResyncInterval after a failed copy, until ctx is canceled.
+func (m *indexMirror) run(ctx context.Context) {
+	ticker := time.NewTicker(addressIndexResyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.wake:
+			m.flush()
+		case <-ticker.C:
+			if !m.needsResync() {
+				continue
+			}
+			if err := m.resync(); err != nil {
+				m.logger.Warnf("%v", err)
+				continue
+			}
+			m.flush()
+			m.logger.Info("Address index resynced")
+		}
+	}
+}
+
+// current reports whether the index holds a copy of the store, which is
+// the case if both hold the sync token close saved.
+func (m *indexMirror) current() (bool, error) {
+	stored, err := m.store.indexSyncToken()
+	if err != nil {
+		return false, err
+	}
+	indexed, err := m.db.SyncToken()
+	if err != nil {
+		return false, err
+	}
+	return stored != "" && stored == indexed, nil
+}
+
+// clearSyncToken removes the sync token from the index and the store, as
+// their contents are about to change.
+func (m *indexMirror) clearSyncToken() error {
+	if err := m.db.SetSyncToken(""); err != nil {
+		return err
+	}
+	return m.store.putIndexSyncToken("")
+}
+
+// close makes the copies still queued and closes the index. An index that
+// holds a copy of the store then gets a new sync token, shared with the
+// store, so that the next start need not resync it.
+func (m *indexMirror) close() error {
+	m.flush()
+	if !m.needsResync() {
+		token := make([]byte, 16)
+		_, err := rand.Read(token)
+		if err == nil {
+			err = m.db.SetSyncToken(hex.EncodeToString(token))
+		}
+		if err == nil {
+			err = m.store.putIndexSyncToken(hex.EncodeToString(token))
+		}
+		if err != nil {
+			m.logger.Warnf("Failed to record the address index as current, it is resynced at the next start: %v", err)
+		}
+	}
+	return m.db.Close()
+}
+
+// openAddressIndex opens the configured address index, claims it for the
+// node's network and, unless it is current, brings it up to date with the
+// store.
+func (n *Node) openAddressIndex() error {
+	db, err := addrindex.Open(n.config.IndexDB)
+	if err != nil {
+		return err
+	}
+	if err := db.Init(n.chainParams.Name); err != nil {
+		db.Close()
+		return err
+	}
+
+	mirror := newIndexMirror(db, n.store, n.logger)
+	current, err := mirror.current()
+	if err == nil {
+		// A node that stops without recording the index as current
+		// leaves it to be resynced at the next start
+		err = mirror.clearSyncToken()
+	}
+	if err != nil {
+		db.Close()
+		return err
+	}
+	if current {
+		n.logger.Info("Address index is current")
+	} else {
+		start := time.Now()
+		if err := mirror.resync(); err != nil {
+			db.Close()
+			return err
+		}
+		n.logger.Infof("Address index synced in %s", time.Since(start).Round(time.Millisecond))
+	}
+	n.store.index = mirror
+	return nil
+}
+
+// AddressIndex returns the external address index, nil if none is
+// configured.
+func (n *Node) AddressIndex() *addrindex.DB {
+	if n.store == nil || n.store.index == nil {
+		return nil
+	}
+	return n.store.index.db
+}
+
+// indexSnapshot reads every UTXO, spent UTXO and indexed transaction in one
+// transaction, as the address index stores them.
+func (s *Store) indexSnapshot() ([]addrindex.UTXO, []addrindex.Transaction, error) {
+	var utxos []addrindex.UTXO
+	var txs []addrindex.Transaction
+	err := walletdb.View(s.db, func(tx walletdb.ReadTx) error {
+		root := tx.ReadBucket(rootBucket)
+		err := root.NestedReadBucket(utxoBucket).ForEach(func(k, v []byte) error {
+			var utxo UTXO
+			if err := json.Unmarshal(v, &utxo); err != nil {
+				return fmt.Errorf("failed to decode UTXO %s: %w", k, err)
+			}
+			utxos = append(utxos, indexUTXO(utxo))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = root.NestedReadBucket(spentBucket).ForEach(func(k, v []byte) error {
+			var status OutpointStatus
+			if err := json.Unmarshal(v, &status); err != nil {
+				return fmt.Errorf("failed to decode spent UTXO %s: %w", k, err)
+			}
+			utxo := indexUTXO(status.UTXO)
+			utxo.Spent = true
+			utxo.SpendingTxID = status.SpendingTxID
+			utxo.SpendingInput = status.SpendingInput
+			utxo.SpendingHeight = status.SpendingHeight
+			utxos = append(utxos, utxo)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return root.NestedReadBucket(txIndexBucket).ForEach(func(k, v []byte) error {
+			var indexed IndexedTx
+			if err := json.Unmarshal(v, &indexed); err != nil {
+				return fmt.Errorf("failed to decode indexed transaction %s: %w", k, err)
+			}
+			txs = append(txs, indexTransaction(string(k), indexed))
+			return nil
+		})
+	})
+	return utxos, txs, err
+}
+
+// indexUTXO converts utxo to its address index row.
+func indexUTXO(utxo UTXO) addrindex.UTXO {
+	return addrindex.UTXO{
+		TxID:         utxo.TxID,
+		Vout:         utxo.Vout,
+		Address:      utxo.Address,
+		Value:        utxo.Value,
+		ScriptPubKey: utxo.ScriptPubKey,
+		Height:       utxo.Height,
+	}
+}
+
+// indexTransaction converts the indexed transaction txid to its address
+// index row.
+func indexTransaction(txid string, tx IndexedTx) addrindex.Transaction {
+	return addrindex.Transaction{
+		TxID:        txid,
+		BlockHash:   tx.BlockHash,
+		BlockHeight: tx.BlockHeight,
+		BlockTime:   tx.BlockTime,
+		Hex:         tx.Hex,
+	}
+}
+
+// indexUTXOChanges converts the changes of ApplyUTXOChanges to address index
+// rows. Spends of outpoints the index does not hold change nothing.
+func indexUTXOChanges(added map[string]UTXO, spent map[string]Spend) ([]addrindex.UTXO, []addrindex.Spend, error) {
+	utxos := make([]addrindex.UTXO, 0, len(added))
+	for _, utxo := range added {
+		utxos = append(utxos, indexUTXO(utxo))
+	}
+	spends := make([]addrindex.Spend, 0, len(spent))
+	for key, spend := range spent {
+		txid, voutStr, ok := strings.Cut(key, ":")
+		vout, err := strconv.ParseUint(voutStr, 10, 32)
+		if !ok || err != nil {
+			return nil, nil, fmt.Errorf("invalid outpoint %q", key)
+		}
+		spends = append(spends, addrindex.Spend{
+			TxID:           txid,
+			Vout:           uint32(vout),
+			SpendingTxID:   spend.SpendingTxID,
+			SpendingInput:  spend.SpendingInput,
+			SpendingHeight: spend.SpendingHeight,
+		})
+	}
+	return utxos, spends, nil
+}
@@ -0,0 +1,160 @@
+package neutrino
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/addrindex"
+)
+
+// newTestIndexMirror attaches a new SQLite address index to store.
+func newTestIndexMirror(t *testing.T, store *Store, path string) *indexMirror {
+	t.Helper()
+	db, err := addrindex.Open("sqlite:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Init("regtest"); err != nil {
+		t.Fatal(err)
+	}
+	mirror := newIndexMirror(db, store, btclog.Disabled)
+	store.index = mirror
+	return mirror
+}
+
+func TestIndexMirror(t *testing.T) {
+	const addr = "bcrt1qwatched"
+	store := newTestStore(t)
+
+	// Data stored before the index is configured reaches it by resync
+	err := store.ApplyUTXOChanges(map[string]UTXO{
+		"aa:0": {TxID: "aa", Vout: 0, Address: addr, Value: 5000, Height: 10},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirror := newTestIndexMirror(t, store, filepath.Join(t.TempDir(), "index.db"))
+	if err := mirror.resync(); err != nil {
+		t.Fatalf("resync() failed: %v", err)
+	}
+
+	// Later changes are copied as they are written
+	err = store.ApplyUTXOChanges(map[string]UTXO{
+		"bb:1": {TxID: "bb", Vout: 1, Address: addr, Value: 1000, Height: 12},
+	}, map[string]Spend{"aa:0": {SpendingTxID: "bb", SpendingHeight: 12}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.PutTransactions(map[string]IndexedTx{"bb": {BlockHash: "h12", BlockHeight: 12, BlockTime: 1200, Hex: "02"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirror.flush()
+
+	balance, err := mirror.db.Balance(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Confirmed != 1000 || balance.Sent != 5000 || balance.TxCount != 2 {
+		t.Errorf("Balance() = %+v, want 1000 confirmed, 5000 sent in 2 transactions", balance)
+	}
+	history, err := mirror.db.History(addr, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].TxID != "bb" || history[0].BlockHash != "h12" {
+		t.Errorf("History() = %+v, want bb in block h12 first", history)
+	}
+
+	if err := store.UnwatchAddress(addr); err != nil {
+		t.Fatal(err)
+	}
+	mirror.flush()
+	if utxos, err := mirror.db.UTXOs(addr); err != nil || len(utxos) != 0 {
+		t.Errorf("UTXOs() after unwatching = %+v, %v, want none", utxos, err)
+	}
+
+	// A failed copy leaves the store written and the index due a resync
+	mirror.db.Close()
+	err = store.ApplyUTXOChanges(map[string]UTXO{"cc:0": {TxID: "cc", Address: addr, Value: 7, Height: 13}}, nil)
+	if err != nil {
+		t.Fatalf("ApplyUTXOChanges() with a broken index = %v, want nil", err)
+	}
+	mirror.flush()
+	if !mirror.needsResync() {
+		t.Fatal("needsResync() = false after a failed copy")
+	}
+	if status, found, err := store.Outpoint("cc:0"); err != nil || !found || status.Value != 7 {
+		t.Errorf("Outpoint() = %+v, %t, %v, want the stored UTXO", status, found, err)
+	}
+
+	mirror = newTestIndexMirror(t, store, filepath.Join(t.TempDir(), "index.db"))
+	if err := mirror.resync(); err != nil {
+		t.Fatalf("resync() failed: %v", err)
+	}
+	if utxos, err := mirror.db.UTXOs(addr); err != nil || len(utxos) != 1 || utxos[0].TxID != "cc" {
+		t.Errorf("UTXOs() after resync = %+v, %v, want cc:0", utxos, err)
+	}
+	if mirror.needsResync() {
+		t.Error("needsResync() = true after a resync")
+	}
+}
+
+// TestIndexMirrorBacklog tests that copies queue without touching the index
+// until flushed, and that an overflowing backlog falls back to a resync.
+func TestIndexMirrorBacklog(t *testing.T) {
+	const addr = "bcrt1qwatched"
+	store := newTestStore(t)
+	mirror := newTestIndexMirror(t, store, filepath.Join(t.TempDir(), "index.db"))
+
+	err := store.ApplyUTXOChanges(map[string]UTXO{"aa:0": {TxID: "aa", Address: addr, Value: 5, Height: 10}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if utxos, err := mirror.db.UTXOs(addr); err != nil || len(utxos) != 0 {
+		t.Errorf("UTXOs() before a flush = %+v, %v, want none", utxos, err)
+	}
+	mirror.flush()
+	if utxos, err := mirror.db.UTXOs(addr); err != nil || len(utxos) != 1 {
+		t.Errorf("UTXOs() after a flush = %+v, %v, want aa:0", utxos, err)
+	}
+
+	for range maxIndexBacklog + 1 {
+		mirror.recordTip(11)
+	}
+	if !mirror.needsResync() {
+		t.Error("needsResync() = false after the backlog overflowed")
+	}
+}
+
+// TestIndexMirrorSyncToken tests that an index closed with every copy made
+// is current at the next start, and is not once the store changes without
+// it.
+func TestIndexMirrorSyncToken(t *testing.T) {
+	store := newTestStore(t)
+	path := filepath.Join(t.TempDir(), "index.db")
+	mirror := newTestIndexMirror(t, store, path)
+
+	if current, err := mirror.current(); err != nil || current {
+		t.Fatalf("current() of a new index = %t, %v, want false", current, err)
+	}
+	if err := mirror.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mirror = newTestIndexMirror(t, store, path)
+	if current, err := mirror.current(); err != nil || !current {
+		t.Fatalf("current() after a clean close = %t, %v, want true", current, err)
+	}
+
+	// A run without the index clears the store's token
+	if err := store.putIndexSyncToken(""); err != nil {
+		t.Fatal(err)
+	}
+	if current, err := mirror.current(); err != nil || current {
+		t.Errorf("current() after the store changed without the index = %t, %v, want false", current, err)
+	}
+}
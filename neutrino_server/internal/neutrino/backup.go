@@ -0,0 +1,271 @@
+package neutrino
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lightninglabs/neutrino/headerfs"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// backupFiles returns the files of the data directory a backup copies: the
+// database, holding neutrinod's state, neutrino's filters and the header
+// indexes, and the flat files of the header chains.
+func (n *Node) backupFiles() []string {
+	return append([]string{dbFiles[n.config.DBBackend]}, headerFiles...)
+}
+
+const (
+	// backupAttempts is how many times a backup is taken before giving up
+	// when a reorg rewrites the header files while they are copied.
+	backupAttempts = 3
+
+	// maxBackupJobs bounds the backup jobs kept for their status.
+	maxBackupJobs = 100
+)
+
+// Statuses of a backup job.
+const (
+	BackupRunning = "running"
+	BackupDone    = "done"
+	BackupFailed  = "failed"
+)
+
+// Backup describes a copy of the node's database and header chains.
+type Backup struct {
+	Path         string `json:"path"`
+	BlockHeight  int32  `json:"block_height"`
+	BlockHash    string `json:"block_hash"`
+	FilterHeight int32  `json:"filter_height"`
+	Size         int64  `json:"size"`
+	Created      int64  `json:"created"`
+}
+
+// BackupJob is a backup taken in the background. Backup is set once it is
+// done, and Error if it failed.
+type BackupJob struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	Backup     *Backup `json:"backup,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	StartedAt  int64   `json:"started_at"`
+	FinishedAt int64   `json:"finished_at,omitempty"`
+}
+
+// backupDir returns the directory backups are written to.
+func (c *Config) backupDir() string {
+	if c.BackupDir != "" {
+		return c.BackupDir
+	}
+	return filepath.Join(c.DataDir, "backups")
+}
+
+// StartBackup starts copying the database and header chains, while the node
+// runs, to a new directory called name in the backup directory, or named
+// after the network and the time if name is empty. It returns the job at
+// once; BackupStatus reports its progress. One backup runs at a time. The
+// copy can replace the files of the same name in a stopped node's data
+// directory.
+//
+// The database is copied in one read transaction. The header files are
+// append-only, so copied after it they hold at least the headers it indexes;
+// the excess is dropped as neutrino does on start. A copy whose headers
+// differ from the node's because a reorg rewrote them meanwhile is taken
+// again.
+func (n *Node) StartBackup(name string) (*BackupJob, error) {
+	if n.chainService == nil {
+		return nil, errors.New("node not started")
+	}
+	now := time.Now()
+	if name == "" {
+		name = fmt.Sprintf("neutrino-%s-%s", n.config.Network, now.UTC().Format("20060102T150405Z"))
+	}
+	if name != filepath.Base(name) || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, NewBadRequestError("invalid backup name: use a file name without directories")
+	}
+
+	n.backupMu.Lock()
+	defer n.backupMu.Unlock()
+
+	if slices.ContainsFunc(n.backupJobs, func(job *BackupJob) bool { return job.Status == BackupRunning }) {
+		return nil, NewConflictError("a backup is already running")
+	}
+	dir := filepath.Join(n.config.backupDir(), name)
+	if err := os.MkdirAll(filepath.Dir(dir), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, NewConflictError(fmt.Sprintf("backup %s already exists", name))
+		}
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	job := &BackupJob{Name: name, Status: BackupRunning, StartedAt: now.Unix()}
+	// Only the new job runs, so the oldest ones are finished
+	n.backupJobs = append(n.backupJobs, job)
+	if len(n.backupJobs) > maxBackupJobs {
+		n.backupJobs = slices.Delete(n.backupJobs, 0, len(n.backupJobs)-maxBackupJobs)
+	}
+	n.wg.Go(func() { n.runBackup(job, dir, now) })
+
+	report := *job
+	return &report, nil
+}
+
+// BackupStatus returns the latest backup job called name since the node
+// started.
+func (n *Node) BackupStatus(name string) (*BackupJob, error) {
+	n.backupMu.Lock()
+	defer n.backupMu.Unlock()
+
+	for _, job := range slices.Backward(n.backupJobs) {
+		if job.Name == name {
+			report := *job
+			return &report, nil
+		}
+	}
+	return nil, NewNotFoundError("backup", fmt.Sprintf("no backup %s was started since the node started", name))
+}
+
+// runBackup takes the backup of job created at now into dir and records
+// how it ended.
+func (n *Node) runBackup(job *BackupJob, dir string, now time.Time) {
+	var backup *Backup
+	var err error
+	for attempt := 1; attempt <= backupAttempts; attempt++ {
+		if backup, err = n.copyDataFiles(dir); err == nil {
+			break
+		}
+		n.logger.Warnf("Backup attempt %d of %d failed: %v", attempt, backupAttempts, err)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		n.logger.Errorf("Failed to back up to %s: %v", dir, err)
+	} else {
+		backup.Created = now.Unix()
+		n.logger.Infof("Backed up to %s: block headers to height %d, filter headers to height %d, %d bytes",
+			backup.Path, logging.KV("height", backup.BlockHeight), backup.FilterHeight, backup.Size)
+	}
+
+	n.backupMu.Lock()
+	defer n.backupMu.Unlock()
+	job.FinishedAt = time.Now().Unix()
+	if err != nil {
+		job.Status = BackupFailed
+		job.Error = fmt.Sprintf("failed to back up to %s: %v", dir, err)
+		return
+	}
+	job.Status = BackupDone
+	job.Backup = backup
+}
+
+// copyDataFiles copies the backed up files to dir and checks that the copy
+// agrees with the node's header chains.
+func (n *Node) copyDataFiles(dir string) (*Backup, error) {
+	files := n.backupFiles()
+	db, err := os.OpenFile(filepath.Join(dir, files[0]), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	err = n.db.Copy(db)
+	if err == nil {
+		err = db.Sync()
+	}
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy the database: %w", err)
+	}
+	for _, file := range files[1:] {
+		if err := copyFile(filepath.Join(n.config.DataDir, file), filepath.Join(dir, file)); err != nil {
+			return nil, fmt.Errorf("failed to copy %s: %w", file, err)
+		}
+	}
+
+	// Opening the stores truncates the header files to the copied indexes
+	copyDB, blocks, filters, err := openHeaderStores(dir, n.chainParams)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		copyDB.Close()
+		// A SQLite database leaves its lock file behind, which the backup
+		// does not need
+		os.Remove(filepath.Join(dir, files[0]+".lock"))
+	}()
+	backup, err := checkBackupHeaders(blocks, filters, chainHeaders{blocks: n.chainService.BlockHeaders, filters: n.chainService.RegFilterHeaders})
+	if err != nil {
+		return nil, err
+	}
+
+	backup.Path = dir
+	for _, file := range files {
+		info, err := os.Stat(filepath.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+		backup.Size += info.Size()
+	}
+	return backup, nil
+}
+
+// checkBackupHeaders checks that the tips of the copied header chains are
+// indexed and match the node's headers at their heights.
+func checkBackupHeaders(blocks headerfs.BlockHeaderStore, filters *headerfs.FilterHeaderStore, node headerFetcher) (*Backup, error) {
+	tip, blockHeight, err := blocks.ChainTip()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the copied block header tip: %w", err)
+	}
+	tipHash := tip.BlockHash()
+	if indexed, err := blocks.HeightFromHash(&tipHash); err != nil || indexed != blockHeight {
+		return nil, fmt.Errorf("copied block header %d is not the indexed tip", blockHeight)
+	}
+	if hash, err := node.blockHash(int32(blockHeight)); err != nil || hash != tipHash {
+		return nil, fmt.Errorf("copied block header %d differs from the node's", blockHeight)
+	}
+
+	filterTip, filterHeight, err := filters.ChainTip()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the copied filter header tip: %w", err)
+	}
+	if header, err := node.filterHeader(int32(filterHeight)); err != nil || header != *filterTip {
+		return nil, fmt.Errorf("copied filter header %d differs from the node's", filterHeight)
+	}
+
+	return &Backup{
+		BlockHeight:  int32(blockHeight),
+		BlockHash:    tipHash.String(),
+		FilterHeight: int32(filterHeight),
+	}, nil
+}
+
+// copyFile copies src to dst, replacing it, and syncs it.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
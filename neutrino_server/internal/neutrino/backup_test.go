@@ -0,0 +1,132 @@
+package neutrino
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// sliceHeaders serves header chains from the genesis block held in slices.
+type sliceHeaders struct {
+	blocks  []wire.BlockHeader
+	filters []chainhash.Hash
+}
+
+func (s sliceHeaders) blockHash(height int32) (chainhash.Hash, error) {
+	if int(height) >= len(s.blocks) {
+		return chainhash.Hash{}, errors.New("no such block")
+	}
+	return s.blocks[height].BlockHash(), nil
+}
+
+func (s sliceHeaders) filterHeader(height int32) (chainhash.Hash, error) {
+	if int(height) >= len(s.filters) {
+		return chainhash.Hash{}, errors.New("no such filter header")
+	}
+	return s.filters[height], nil
+}
+
+func TestCheckBackupHeaders(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	genesisFilter, err := genesisFilterHeader(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := mineHeaders(t, params.GenesisBlock.Header, 4, 1)
+	filters := []chainhash.Hash{{1}, {2}}
+
+	dir := t.TempDir()
+	writeHeaderChains(t, dir, blocks, filters)
+
+	// Headers appended to the file but not indexed yet when the database
+	// was copied
+	unindexed := mineHeaders(t, blocks[3], 1, 1)[0]
+	var raw bytes.Buffer
+	if err := unindexed.Serialize(&raw); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(filepath.Join(dir, "block_headers.bin"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write(raw.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	node := sliceHeaders{
+		blocks:  append([]wire.BlockHeader{params.GenesisBlock.Header}, append(blocks, unindexed)...),
+		filters: append([]chainhash.Hash{genesisFilter}, filters...),
+	}
+	forked := node
+	forked.blocks = append([]wire.BlockHeader{params.GenesisBlock.Header}, mineHeaders(t, params.GenesisBlock.Header, 5, 2)...)
+	refiltered := node
+	refiltered.filters = []chainhash.Hash{genesisFilter, {1}, {3}}
+
+	tests := []struct {
+		name    string
+		node    headerFetcher
+		wantErr string
+	}{
+		{"agrees with the node", node, ""},
+		{"reorged blocks", forked, "copied block header 4 differs"},
+		{"reorged filters", refiltered, "copied filter header 2 differs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, blockStore, filterStore, err := openHeaderStores(dir, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			backup, err := checkBackupHeaders(blockStore, filterStore, tt.node)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("checkBackupHeaders() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkBackupHeaders() failed: %v", err)
+			}
+			if backup.BlockHeight != 4 || backup.BlockHash != blocks[3].BlockHash().String() || backup.FilterHeight != 2 {
+				t.Errorf("checkBackupHeaders() = %+v, want the indexed tips at 4 and 2", backup)
+			}
+		})
+	}
+}
+
+func TestBackupStatus(t *testing.T) {
+	n := &Node{backupJobs: []*BackupJob{
+		{Name: "nightly", Status: BackupFailed, Error: "no space left on device"},
+		{Name: "pre-upgrade", Status: BackupDone, Backup: &Backup{BlockHeight: 8543}},
+		{Name: "nightly", Status: BackupRunning},
+	}}
+
+	job, err := n.BackupStatus("nightly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != BackupRunning {
+		t.Errorf("status = %s, want the latest job's %s", job.Status, BackupRunning)
+	}
+	// The report is a copy the running backup does not change
+	job.Status = BackupDone
+	if n.backupJobs[2].Status != BackupRunning {
+		t.Error("changing the report changed the job")
+	}
+
+	var notFound *NotFoundError
+	if _, err := n.BackupStatus("weekly"); !errors.As(err, &notFound) {
+		t.Errorf("status of an unknown backup: %v, want a not found error", err)
+	}
+}
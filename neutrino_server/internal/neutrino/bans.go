@@ -0,0 +1,312 @@
+package neutrino
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+const (
+	// maxBans bounds the ban list.
+	maxBans = 10000
+
+	// banPruneInterval is how often expired bans are deleted.
+	banPruneInterval = time.Hour
+)
+
+// errPeerBanned is returned when dialing a banned peer.
+var errPeerBanned = errors.New("peer is banned")
+
+// Ban is an IP address or network peers are not connected to until the ban
+// expires.
+type Ban struct {
+	// Addr is an IP address, or a network in CIDR notation.
+	Addr      string `json:"addr"`
+	Reason    string `json:"reason,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// expired reports whether the ban is over at now.
+func (b Ban) expired(now time.Time) bool {
+	return now.Unix() >= b.ExpiresAt
+}
+
+// parseBanAddr parses an IP address, with an optional port, or a CIDR
+// network, returning the network and its canonical form: the bare IP
+// address for a single address.
+func parseBanAddr(addr string) (*net.IPNet, string, error) {
+	if strings.Contains(addr, "/") {
+		_, ipNet, err := net.ParseCIDR(addr)
+		if err != nil {
+			return nil, "", NewBadRequestError(fmt.Sprintf("invalid network %q", addr))
+		}
+		if ones, bits := ipNet.Mask.Size(); ones == bits {
+			return ipNet, ipNet.IP.String(), nil
+		}
+		return ipNet, ipNet.String(), nil
+	}
+
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, "", NewBadRequestError(fmt.Sprintf("cannot ban %s: only IP addresses and networks can be banned", addr))
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, ip.String(), nil
+}
+
+// banList holds the bans, persisted in the store so they survive restarts.
+type banList struct {
+	store *Store
+
+	mu   sync.RWMutex
+	bans map[string]Ban
+	nets map[string]*net.IPNet
+}
+
+// newBanList loads the bans of store, dropping those that expired.
+func newBanList(store *Store) (*banList, error) {
+	stored, err := store.Bans()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &banList{store: store, bans: make(map[string]Ban), nets: make(map[string]*net.IPNet)}
+	for _, ban := range stored {
+		ipNet, addr, err := parseBanAddr(ban.Addr)
+		if err != nil {
+			if err := store.DeleteBan(ban.Addr); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		l.bans[addr] = ban
+		l.nets[addr] = ipNet
+	}
+	if _, err := l.prune(time.Now()); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// prune deletes the bans expired at now and returns how many were deleted.
+func (l *banList) prune(now time.Time) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.pruneLocked(now)
+}
+
+// pruneLocked is prune for callers holding mu.
+func (l *banList) pruneLocked(now time.Time) (int, error) {
+	pruned := 0
+	for addr, ban := range l.bans {
+		if !ban.expired(now) {
+			continue
+		}
+		if err := l.store.DeleteBan(addr); err != nil {
+			return pruned, err
+		}
+		delete(l.bans, addr)
+		delete(l.nets, addr)
+		pruned++
+	}
+	return pruned, nil
+}
+
+// add bans addr for duration, replacing an existing ban of the same
+// address or network.
+func (l *banList) add(addr, reason string, duration time.Duration) (Ban, *net.IPNet, error) {
+	if duration <= 0 {
+		return Ban{}, nil, NewBadRequestError("ban duration must be positive")
+	}
+	ipNet, canonical, err := parseBanAddr(addr)
+	if err != nil {
+		return Ban{}, nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if _, ok := l.bans[canonical]; !ok && len(l.bans) >= maxBans {
+		// Expired bans make room
+		if _, err := l.pruneLocked(now); err != nil {
+			return Ban{}, nil, err
+		}
+		if len(l.bans) >= maxBans {
+			return Ban{}, nil, NewBadRequestError(fmt.Sprintf("too many bans (max %d)", maxBans))
+		}
+	}
+	ban := Ban{
+		Addr:      canonical,
+		Reason:    reason,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(duration).Unix(),
+	}
+	if err := l.store.PutBan(ban); err != nil {
+		return Ban{}, nil, err
+	}
+	l.bans[canonical] = ban
+	l.nets[canonical] = ipNet
+	return ban, ipNet, nil
+}
+
+// remove lifts the ban of addr.
+func (l *banList) remove(addr string) error {
+	_, canonical, err := parseBanAddr(addr)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.bans[canonical]; !ok {
+		return NewNotFoundError("ban", fmt.Sprintf("%s is not banned", canonical))
+	}
+	if err := l.store.DeleteBan(canonical); err != nil {
+		return err
+	}
+	delete(l.bans, canonical)
+	delete(l.nets, canonical)
+	return nil
+}
+
+// list returns the bans in effect ordered by address.
+func (l *banList) list() []Ban {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	now := time.Now()
+	bans := []Ban{}
+	for _, ban := range l.bans {
+		if !ban.expired(now) {
+			bans = append(bans, ban)
+		}
+	}
+	slices.SortFunc(bans, func(a, b Ban) int { return strings.Compare(a.Addr, b.Addr) })
+	return bans
+}
+
+// banned reports whether ip is in a ban in effect.
+func (l *banList) banned(ip net.IP) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	now := time.Now()
+	for addr, ipNet := range l.nets {
+		if ipNet.Contains(ip) && !l.bans[addr].expired(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// dialer wraps dial to refuse banned peers.
+func (l *banList) dialer(dial func(net.Addr) (net.Conn, error)) func(net.Addr) (net.Conn, error) {
+	return func(addr net.Addr) (net.Conn, error) {
+		// Onion addresses are encoded as IPs longer than 16 bytes and
+		// cannot be banned
+		if tcpAddr, ok := addr.(*net.TCPAddr); ok && len(tcpAddr.IP) <= net.IPv6len && l.banned(tcpAddr.IP) {
+			return nil, fmt.Errorf("not connecting to %s: %w", addr, errPeerBanned)
+		}
+		return dial(addr)
+	}
+}
+
+// peerIP returns the IP address of a peer address, or nil for host names
+// and onion addresses.
+func peerIP(addr string) net.IP {
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	return net.ParseIP(host)
+}
+
+// Bans returns the bans in effect.
+func (n *Node) Bans() ([]Ban, error) {
+	if n.bans == nil {
+		return nil, errors.New("node not started")
+	}
+	return n.bans.list(), nil
+}
+
+// AddBan bans addr, an IP address or a CIDR network, for duration or, if
+// zero, the configured ban duration. Connected peers in the ban are
+// disconnected.
+func (n *Node) AddBan(addr, reason string, duration time.Duration) (*Ban, error) {
+	if n.bans == nil {
+		return nil, errors.New("node not started")
+	}
+	if duration == 0 {
+		duration = n.banDuration()
+	}
+
+	ban, ipNet, err := n.bans.add(addr, reason, duration)
+	if err != nil {
+		return nil, err
+	}
+	n.logger.Warnf("Banned %s until %s: %s", ban.Addr, time.Unix(ban.ExpiresAt, 0).UTC().Format(time.RFC3339), reason)
+
+	for _, peer := range n.chainService.Peers() {
+		if ip := peerIP(peer.Addr()); ip != nil && ipNet.Contains(ip) {
+			if err := n.DisconnectPeer(peer.Addr()); err != nil {
+				n.logger.Warnf("Failed to disconnect banned peer %s: %v", logging.KV("peer", peer.Addr()), err)
+			}
+		}
+	}
+	return &ban, nil
+}
+
+// RemoveBan lifts the ban of addr, as listed by Bans.
+func (n *Node) RemoveBan(addr string) error {
+	if n.bans == nil {
+		return errors.New("node not started")
+	}
+	if err := n.bans.remove(addr); err != nil {
+		return err
+	}
+	n.logger.Infof("Lifted ban of %s", addr)
+	return nil
+}
+
+// pruneBans periodically deletes expired bans.
+func (n *Node) pruneBans() {
+	ticker := time.NewTicker(banPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.lifetime.Done():
+			return
+		case <-ticker.C:
+		}
+		if pruned, err := n.bans.prune(time.Now()); err != nil {
+			n.logger.Warnf("Failed to prune expired bans: %v", err)
+		} else if pruned > 0 {
+			n.logger.Infof("Pruned %d expired peer bans", pruned)
+		}
+	}
+}
+
+// banDuration returns the configured ban duration.
+func (n *Node) banDuration() time.Duration {
+	if n.config.BanDuration > 0 {
+		return n.config.BanDuration
+	}
+	return DefaultBanDuration
+}
@@ -0,0 +1,136 @@
+package neutrino
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseBanAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{"10.0.0.5", "10.0.0.5", false},
+		{"10.0.0.5:8333", "10.0.0.5", false},
+		{"[2001:db8::1]:8333", "2001:db8::1", false},
+		{"10.0.0.7/24", "10.0.0.0/24", false},
+		{"10.0.0.5/32", "10.0.0.5", false},
+		{"2001:db8::/32", "2001:db8::/32", false},
+		{"node.example.com:8333", "", true},
+		{"example.onion", "", true},
+		{"10.0.0.0/33", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			_, got, err := parseBanAddr(tt.addr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseBanAddr() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseBanAddr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBanList(t *testing.T) {
+	store := newTestStore(t)
+	bans, err := newBanList(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := bans.add("10.0.0.0/24", "stalled sync", time.Hour); err != nil {
+		t.Fatalf("add() failed: %v", err)
+	}
+	if _, _, err := bans.add("192.168.1.5:8333", "bad filters", time.Hour); err != nil {
+		t.Fatalf("add() failed: %v", err)
+	}
+	if _, _, err := bans.add("192.168.1.6", "", 0); err == nil {
+		t.Error("add() should refuse a ban without duration")
+	}
+
+	for ip, want := range map[string]bool{"10.0.0.77": true, "192.168.1.5": true, "192.168.1.6": false, "10.0.1.1": false} {
+		if got := bans.banned(net.ParseIP(ip)); got != want {
+			t.Errorf("banned(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	// Dialing a banned peer fails before reaching the network
+	dial := bans.dialer(func(net.Addr) (net.Conn, error) { return nil, errors.New("dialed") })
+	if _, err := dial(&net.TCPAddr{IP: net.ParseIP("10.0.0.77"), Port: 8333}); !errors.Is(err, errPeerBanned) {
+		t.Errorf("dialing a banned peer error = %v, want errPeerBanned", err)
+	}
+	if _, err := dial(&net.TCPAddr{IP: net.ParseIP("10.0.1.1"), Port: 8333}); errors.Is(err, errPeerBanned) {
+		t.Error("dialing a peer that is not banned was refused")
+	}
+
+	// Bans survive restarts, expired ones are dropped
+	if err := store.PutBan(Ban{Addr: "172.16.0.1", CreatedAt: 1, ExpiresAt: 2}); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := newBanList(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := restored.list()
+	if len(list) != 2 || list[0].Addr != "10.0.0.0/24" || list[0].Reason != "stalled sync" || list[1].Addr != "192.168.1.5" {
+		t.Fatalf("list() after restore = %+v", list)
+	}
+	if stored, _ := store.Bans(); len(stored) != 2 {
+		t.Errorf("expired ban should be deleted from the store, have %+v", stored)
+	}
+
+	if err := restored.remove("10.0.0.7/24"); err != nil {
+		t.Fatalf("remove() failed: %v", err)
+	}
+	var notFoundErr *NotFoundError
+	if err := restored.remove("10.0.0.0/24"); !errors.As(err, &notFoundErr) {
+		t.Errorf("second remove() error = %v, want NotFoundError", err)
+	}
+	if restored.banned(net.ParseIP("10.0.0.77")) {
+		t.Error("removed ban still applies")
+	}
+}
+
+func TestBanListPrune(t *testing.T) {
+	store := newTestStore(t)
+	bans, err := newBanList(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := bans.add("10.0.0.5", "", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := bans.add("10.0.0.6", "", 3*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	pruned, err := bans.prune(time.Now().Add(2 * time.Hour))
+	if err != nil || pruned != 1 {
+		t.Fatalf("prune() = %d, %v, want 1", pruned, err)
+	}
+	if _, ok := bans.bans["10.0.0.5"]; ok || len(bans.nets) != 1 {
+		t.Errorf("expired ban is still listed: %+v", bans.bans)
+	}
+	if stored, _ := store.Bans(); len(stored) != 1 || stored[0].Addr != "10.0.0.6" {
+		t.Errorf("stored bans after prune() = %+v, want only 10.0.0.6", stored)
+	}
+
+	// A full list makes room by pruning expired bans
+	for i := range maxBans - 1 {
+		ip := net.IPv4(10, 1, byte(i>>8), byte(i)).String()
+		bans.bans[ip] = Ban{Addr: ip, ExpiresAt: 1}
+	}
+	if _, _, err := bans.add("10.0.0.7", "", time.Hour); err != nil {
+		t.Fatalf("add() to a list full of expired bans failed: %v", err)
+	}
+	if len(bans.bans) != 2 {
+		t.Errorf("%d bans after add(), want 2", len(bans.bans))
+	}
+}
@@ -0,0 +1,669 @@
+package neutrino
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightninglabs/neutrino/pushtx"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+const (
+	// maxBroadcasts bounds the broadcasts kept. Once reached, the oldest
+	// broadcast that is no longer pending makes room for a new one, or the
+	// oldest pending one if all are.
+	maxBroadcasts = 1000
+
+	// broadcastExpiry is how long a pending broadcast is rebroadcast before
+	// it expires, matching how long Bitcoin Core keeps a transaction in its
+	// mempool by default.
+	broadcastExpiry = 14 * 24 * time.Hour
+
+	// broadcastCheckInterval is how often queued broadcasts are checked for
+	// confirmation and for newly connected peers.
+	broadcastCheckInterval = 30 * time.Second
+
+	// rebroadcastInterval is how long a pending transaction waits between
+	// scheduled rebroadcasts.
+	rebroadcastInterval = 10 * time.Minute
+
+	// idempotencyKeyTTL is how long an idempotency key maps to the
+	// transaction first broadcast with it.
+	idempotencyKeyTTL = 24 * time.Hour
+
+	// maxIdempotencyKeyLength bounds the length of an idempotency key.
+	maxIdempotencyKeyLength = 255
+)
+
+// BroadcastTx is a transaction rebroadcast until it is seen in a block.
+type BroadcastTx struct {
+	TxID  string `json:"txid"`
+	RawTx string `json:"raw_tx"`
+
+	// ScriptPubKey is the output script whose filter matches are searched
+	// for the confirming block.
+	ScriptPubKey string `json:"script_pubkey,omitempty"`
+
+	// Status is pending until the transaction is found in a block, then
+	// confirmed, or conflicted if a block spends one of its inputs with
+	// another transaction. A reorg of the confirming or conflicting block
+	// makes it pending again. A broadcast pending for broadcastExpiry is
+	// expired until it is broadcast again.
+	Status string `json:"status"`
+
+	// Attempts counts the sends to peers, and LastError holds the error of
+	// the last one, if it failed.
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+
+	// AnnouncedPeers lists the addresses of the peers connected during a
+	// successful send.
+	AnnouncedPeers []string `json:"announced_peers,omitempty"`
+
+	// FirstBroadcastAt is the time of the first successful send, and
+	// LastBroadcastAt that of the last attempt.
+	FirstBroadcastAt int64 `json:"first_broadcast_at,omitempty"`
+	LastBroadcastAt  int64 `json:"last_broadcast_at,omitempty"`
+
+	BlockHash   string `json:"block_hash,omitempty"`
+	BlockHeight int32  `json:"block_height,omitempty"`
+
+	// ConflictingTxID is the transaction that spent an input of a
+	// conflicted broadcast, in the block with ConflictBlockHash at
+	// ConflictHeight.
+	ConflictingTxID   string `json:"conflicting_txid,omitempty"`
+	ConflictBlockHash string `json:"conflict_block_hash,omitempty"`
+	ConflictHeight    int32  `json:"conflict_height,omitempty"`
+
+	// ScannedHeight is the height through which blocks have been searched
+	// for the transaction.
+	ScannedHeight int32 `json:"scanned_height"`
+
+	CreatedAt int64 `json:"created_at"`
+	UpdatedAt int64 `json:"updated_at"`
+
+	// revision counts the updates of the queued broadcast, so a check
+	// that ran without holding the queue lock can tell whether it was
+	// updated meanwhile.
+	revision uint64
+}
+
+// recordAttempt records a send at now to peers that failed with err, or
+// succeeded if err is nil.
+func (b *BroadcastTx) recordAttempt(now int64, peers []string, err error) {
+	b.Attempts++
+	b.LastBroadcastAt = now
+	b.LastError = ""
+	if err != nil {
+		b.LastError = err.Error()
+		return
+	}
+	if b.FirstBroadcastAt == 0 {
+		b.FirstBroadcastAt = now
+	}
+	for _, peer := range peers {
+		if !slices.Contains(b.AnnouncedPeers, peer) {
+			b.AnnouncedPeers = append(b.AnnouncedPeers, peer)
+		}
+	}
+}
+
+// BroadcastStatus reports how far a broadcast transaction got.
+type BroadcastStatus struct {
+	TxID   string `json:"txid"`
+	Status string `json:"status"`
+
+	FirstBroadcastAt int64 `json:"first_broadcast_at,omitempty"`
+	LastBroadcastAt  int64 `json:"last_broadcast_at,omitempty"`
+
+	// PeersAnnounced is the number of distinct peers the transaction was
+	// sent to.
+	PeersAnnounced int `json:"peers_announced"`
+
+	// Attempts counts every send, and Rebroadcasts those after the first.
+	Attempts     int    `json:"attempts"`
+	Rebroadcasts int    `json:"rebroadcasts"`
+	LastError    string `json:"last_error,omitempty"`
+
+	BlockHash     string `json:"block_hash,omitempty"`
+	BlockHeight   int32  `json:"block_height,omitempty"`
+	Confirmations int32  `json:"confirmations"`
+
+	ConflictingTxID string `json:"conflicting_txid,omitempty"`
+	ConflictHeight  int32  `json:"conflict_height,omitempty"`
+}
+
+// BroadcastResult answers a broadcast request. Duplicate is set when the
+// transaction, or the idempotency key, was already broadcast, in which case
+// nothing was sent and the status is that of the earlier broadcast.
+type BroadcastResult struct {
+	BroadcastStatus
+	Duplicate bool `json:"duplicate"`
+}
+
+// IdempotencyKey maps a client-chosen key to the transaction first broadcast
+// with it.
+type IdempotencyKey struct {
+	TxID      string `json:"txid"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// expired reports whether k no longer applies at now.
+func (k IdempotencyKey) expired(now int64) bool {
+	return now-k.CreatedAt >= int64(idempotencyKeyTTL/time.Second)
+}
+
+// status reports b for a chain whose tip is at tip.
+func (b *BroadcastTx) status(tip int32) BroadcastStatus {
+	status := BroadcastStatus{
+		TxID:             b.TxID,
+		Status:           b.Status,
+		FirstBroadcastAt: b.FirstBroadcastAt,
+		LastBroadcastAt:  b.LastBroadcastAt,
+		PeersAnnounced:   len(b.AnnouncedPeers),
+		Attempts:         b.Attempts,
+		Rebroadcasts:     max(0, b.Attempts-1),
+		LastError:        b.LastError,
+		BlockHash:        b.BlockHash,
+		BlockHeight:      b.BlockHeight,
+		ConflictingTxID:  b.ConflictingTxID,
+		ConflictHeight:   b.ConflictHeight,
+	}
+	if b.BlockHash != "" && tip >= b.BlockHeight {
+		status.Confirmations = tip - b.BlockHeight + 1
+	}
+	return status
+}
+
+// expired reports whether a pending broadcast has been rebroadcast for
+// broadcastExpiry at now.
+func (b *BroadcastTx) expired(now int64) bool {
+	return b.Status == TxStatusPending && now-b.CreatedAt >= int64(broadcastExpiry/time.Second)
+}
+
+// dueForRebroadcast reports whether a pending broadcast should be sent again
+// at now.
+func (b *BroadcastTx) dueForRebroadcast(now int64) bool {
+	return b.Status == TxStatusPending && now-b.LastBroadcastAt >= int64(rebroadcastInterval/time.Second)
+}
+
+// broadcastQueue holds the broadcasts kept by the node.
+type broadcastQueue struct {
+	mu   sync.Mutex
+	txs  map[string]BroadcastTx
+	keys map[string]IdempotencyKey
+
+	// inputs maps the outpoints spent by queued broadcasts to their txids.
+	inputs map[string][]string
+
+	// sending holds the txids of broadcasts being sent for the first time,
+	// which are queued once the send returns.
+	sending map[string]bool
+
+	// checkMu serializes the updates of queued broadcasts with their
+	// persistence, so the store ends up with the last update. It is not
+	// held while sending or searching blocks.
+	checkMu sync.Mutex
+}
+
+// put stores an update of broadcast, which was read at its current revision.
+// Callers must hold mu.
+func (q *broadcastQueue) put(broadcast BroadcastTx) BroadcastTx {
+	broadcast.revision++
+	q.txs[broadcast.TxID] = broadcast
+	return broadcast
+}
+
+// restoreBroadcasts loads queued broadcasts from the store.
+func (n *Node) restoreBroadcasts() error {
+	n.broadcasts = &broadcastQueue{
+		txs:     make(map[string]BroadcastTx),
+		keys:    make(map[string]IdempotencyKey),
+		inputs:  make(map[string][]string),
+		sending: make(map[string]bool),
+	}
+	if n.store == nil {
+		return nil
+	}
+
+	broadcasts, err := n.store.Broadcasts()
+	if err != nil {
+		return fmt.Errorf("failed to load broadcasts: %w", err)
+	}
+	keys, err := n.store.IdempotencyKeys()
+	if err != nil {
+		return fmt.Errorf("failed to load idempotency keys: %w", err)
+	}
+	n.broadcasts.txs = broadcasts
+	n.broadcasts.keys = keys
+	for txid, broadcast := range broadcasts {
+		tx, err := decodeRawTx(broadcast.RawTx)
+		if err != nil {
+			n.logger.Warnf("Invalid raw transaction queued for %s: %v", txid, err)
+			continue
+		}
+		n.broadcasts.indexInputs(txid, tx)
+	}
+	return nil
+}
+
+// isRejection reports whether err means peers refused tx for good, rather
+// than it failing to reach them.
+func isRejection(err error) bool {
+	return pushtx.IsBroadcastError(err, pushtx.Invalid, pushtx.InsufficientFee)
+}
+
+// BroadcastTransaction broadcasts a transaction to the network and queues it
+// for rebroadcast until it is seen in a block. A transaction peers reject as
+// invalid or underpaying is not queued and its rejection is returned. Any
+// other failure to reach peers leaves the transaction queued for a retry.
+//
+// A transaction already queued is not sent again: the result is its status,
+// marked duplicate. So is a request reusing a non-empty idempotencyKey of the
+// last 24 hours, which must name the same transaction.
+func (n *Node) BroadcastTransaction(tx *wire.MsgTx, idempotencyKey string) (*BroadcastResult, error) {
+	if n.chainService == nil || n.broadcasts == nil {
+		return nil, errors.New("chain service not initialized")
+	}
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		return nil, NewBadRequestError(fmt.Sprintf("idempotency key too long (max %d characters)", maxIdempotencyKeyLength))
+	}
+
+	var raw bytes.Buffer
+	if err := tx.Serialize(&raw); err != nil {
+		return nil, fmt.Errorf("failed to serialize transaction: %w", err)
+	}
+
+	bestBlock, err := n.chainService.BestBlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get best block: %w", err)
+	}
+
+	txid := tx.TxHash().String()
+	if result, err := n.reserveBroadcast(txid, idempotencyKey, bestBlock.Height); result != nil || err != nil {
+		return result, err
+	}
+
+	peers := n.peerAddrs()
+	sendErr := n.chainService.SendTransaction(tx)
+	if isRejection(sendErr) {
+		n.broadcasts.release(txid, idempotencyKey)
+		n.metrics.rejected()
+		return nil, sendErr
+	}
+
+	n.broadcasts.checkMu.Lock()
+	defer n.broadcasts.checkMu.Unlock()
+
+	now := time.Now().Unix()
+	n.broadcasts.mu.Lock()
+	delete(n.broadcasts.sending, txid)
+	broadcast, exists := n.broadcasts.txs[txid]
+	if !exists {
+		evicted := n.broadcasts.makeRoom()
+		if evicted.Status == TxStatusPending {
+			n.logger.Warnf("Broadcast queue full, no longer rebroadcasting the oldest pending transaction %s", logging.KV("txid", evicted.TxID))
+		}
+		if evicted.TxID != "" && n.store != nil {
+			if err := n.store.DeleteBroadcast(evicted.TxID); err != nil {
+				n.logger.Warnf("Failed to delete evicted broadcast %s: %v", evicted.TxID, err)
+			}
+		}
+		broadcast = BroadcastTx{
+			TxID:          txid,
+			RawTx:         hex.EncodeToString(raw.Bytes()),
+			ScriptPubKey:  searchScript(tx),
+			Status:        TxStatusPending,
+			ScannedHeight: bestBlock.Height,
+			CreatedAt:     now,
+		}
+		n.broadcasts.indexInputs(txid, tx)
+	}
+	if broadcast.Status == TxStatusExpired {
+		broadcast.Status = TxStatusPending
+		broadcast.CreatedAt = now
+	}
+	// A transaction peers know as confirmed may be in a recent block
+	if pushtx.IsBroadcastError(sendErr, pushtx.Confirmed) && broadcast.BlockHash == "" {
+		broadcast.ScannedHeight = min(broadcast.ScannedHeight, max(0, bestBlock.Height-defaultTrackLookback))
+		sendErr = nil
+	}
+	broadcast.recordAttempt(now, peers, sendErr)
+	n.metrics.broadcast(false, sendErr)
+	broadcast.UpdatedAt = now
+	broadcast = n.broadcasts.put(broadcast)
+	key := IdempotencyKey{TxID: txid, CreatedAt: now}
+	if idempotencyKey != "" {
+		n.broadcasts.keys[idempotencyKey] = key
+	}
+	n.broadcasts.mu.Unlock()
+
+	if sendErr != nil {
+		n.logger.Warnf("Broadcast of %s failed, will retry: %v", txid, sendErr)
+	}
+	if n.store != nil {
+		if err := n.store.PutBroadcast(broadcast); err != nil {
+			return nil, fmt.Errorf("failed to persist broadcast: %w", err)
+		}
+		if idempotencyKey != "" {
+			if err := n.store.PutIdempotencyKey(idempotencyKey, key); err != nil {
+				return nil, fmt.Errorf("failed to persist idempotency key: %w", err)
+			}
+		}
+	}
+	return &BroadcastResult{BroadcastStatus: broadcast.status(bestBlock.Height)}, nil
+}
+
+// reserveBroadcast returns the result for a request to broadcast txid with
+// idempotencyKey that repeats an earlier one, including one still being
+// sent. Otherwise it returns nil and reserves txid and idempotencyKey for the
+// request, so a concurrent repeat of it is answered as a duplicate.
+func (n *Node) reserveBroadcast(txid, idempotencyKey string, tip int32) (*BroadcastResult, error) {
+	n.broadcasts.mu.Lock()
+	defer n.broadcasts.mu.Unlock()
+
+	now := time.Now().Unix()
+	if idempotencyKey != "" {
+		key, ok := n.broadcasts.keys[idempotencyKey]
+		if ok && !key.expired(now) && key.TxID != txid {
+			return nil, NewConflictError(fmt.Sprintf("idempotency key was already used for transaction %s", key.TxID))
+		}
+	}
+
+	if broadcast, ok := n.broadcasts.txs[txid]; ok && broadcast.Status != TxStatusExpired {
+		n.logger.Infof("Transaction %s was already broadcast, not sending it again", logging.KV("txid", txid))
+		return &BroadcastResult{BroadcastStatus: broadcast.status(tip), Duplicate: true}, nil
+	}
+	if n.broadcasts.sending[txid] {
+		n.logger.Infof("Transaction %s is already being broadcast, not sending it again", logging.KV("txid", txid))
+		return &BroadcastResult{BroadcastStatus: BroadcastStatus{TxID: txid, Status: TxStatusPending}, Duplicate: true}, nil
+	}
+
+	n.broadcasts.sending[txid] = true
+	if idempotencyKey != "" {
+		n.broadcasts.keys[idempotencyKey] = IdempotencyKey{TxID: txid, CreatedAt: now}
+	}
+	return nil, nil
+}
+
+// release drops the reservation of txid and idempotencyKey made by
+// reserveBroadcast for a transaction that peers rejected.
+func (q *broadcastQueue) release(txid, idempotencyKey string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.sending, txid)
+	if key, ok := q.keys[idempotencyKey]; ok && key.TxID == txid {
+		delete(q.keys, idempotencyKey)
+	}
+}
+
+// pruneIdempotencyKeys forgets the idempotency keys older than
+// idempotencyKeyTTL.
+func (n *Node) pruneIdempotencyKeys() {
+	now := time.Now().Unix()
+	n.broadcasts.mu.Lock()
+	var expired []string
+	for key, entry := range n.broadcasts.keys {
+		if entry.expired(now) {
+			expired = append(expired, key)
+		}
+	}
+	for _, key := range expired {
+		delete(n.broadcasts.keys, key)
+	}
+	n.broadcasts.mu.Unlock()
+
+	if n.store == nil {
+		return
+	}
+	for _, key := range expired {
+		if err := n.store.DeleteIdempotencyKey(key); err != nil {
+			n.logger.Warnf("Failed to delete expired idempotency key: %v", err)
+		}
+	}
+}
+
+// BroadcastStatus returns the broadcast state of txid.
+func (n *Node) BroadcastStatus(txid string) (*BroadcastStatus, error) {
+	if n.chainService == nil || n.broadcasts == nil {
+		return nil, errors.New("chain service not initialized")
+	}
+
+	hash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		return nil, NewBadRequestError(fmt.Sprintf("invalid txid: %v", err))
+	}
+
+	n.broadcasts.mu.Lock()
+	broadcast, ok := n.broadcasts.txs[hash.String()]
+	n.broadcasts.mu.Unlock()
+	if !ok {
+		return nil, NewNotFoundError("broadcast", fmt.Sprintf("transaction %s was not broadcast by this node", txid))
+	}
+
+	bestBlock, err := n.chainService.BestBlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get best block: %w", err)
+	}
+	status := broadcast.status(bestBlock.Height)
+	return &status, nil
+}
+
+// peerAddrs returns the addresses of the connected peers.
+func (n *Node) peerAddrs() []string {
+	var addrs []string
+	for _, peer := range n.chainService.Peers() {
+		addrs = append(addrs, peer.Addr())
+	}
+	return addrs
+}
+
+// makeRoom evicts a broadcast if the queue is full, and returns the evicted
+// broadcast, if any. The oldest broadcast that is no longer pending goes
+// first, then the oldest pending one. Callers must hold mu.
+func (q *broadcastQueue) makeRoom() BroadcastTx {
+	if len(q.txs) < maxBroadcasts {
+		return BroadcastTx{}
+	}
+
+	var oldest BroadcastTx
+	for _, broadcast := range q.txs {
+		settled := broadcast.Status != TxStatusPending
+		switch oldestSettled := oldest.Status != TxStatusPending; {
+		case oldest.TxID == "", settled && !oldestSettled:
+			oldest = broadcast
+		case settled == oldestSettled && broadcast.CreatedAt < oldest.CreatedAt:
+			oldest = broadcast
+		}
+	}
+	delete(q.txs, oldest.TxID)
+	q.unindexInputs(oldest.TxID)
+	return oldest
+}
+
+// searchScript returns the hex of the first output script of tx that can
+// appear in compact block filters, or "" if there is none.
+func searchScript(tx *wire.MsgTx) string {
+	for _, out := range tx.TxOut {
+		if len(out.PkScript) > 0 && !txscript.IsNullData(out.PkScript) {
+			return hex.EncodeToString(out.PkScript)
+		}
+	}
+	return ""
+}
+
+// watchBroadcasts periodically checks queued broadcasts for confirmation and
+// rebroadcasts pending ones on schedule, or right away when new peers
+// connect.
+func (n *Node) watchBroadcasts() {
+	ticker := time.NewTicker(broadcastCheckInterval)
+	defer ticker.Stop()
+
+	var knownPeers []string
+	for {
+		select {
+		case <-n.lifetime.Done():
+			return
+		case <-ticker.C:
+		}
+
+		peers := n.peerAddrs()
+		newPeers := slices.ContainsFunc(peers, func(peer string) bool { return !slices.Contains(knownPeers, peer) })
+		knownPeers = peers
+
+		bestBlock, err := n.chainService.BestBlock()
+		if err != nil {
+			n.logger.Warnf("Failed to get best block for broadcasts: %v", err)
+			continue
+		}
+
+		// Confirmations and conflicts deeper than the reorg window are final
+		n.broadcasts.mu.Lock()
+		var txids []string
+		for txid, broadcast := range n.broadcasts.txs {
+			settled := max(broadcast.BlockHeight, broadcast.ConflictHeight)
+			if broadcast.Status == TxStatusPending || bestBlock.Height-settled < reorgWindow {
+				txids = append(txids, txid)
+			}
+		}
+		n.broadcasts.mu.Unlock()
+
+		for _, txid := range txids {
+			n.checkBroadcast(txid, newPeers)
+		}
+		n.pruneIdempotencyKeys()
+	}
+}
+
+// checkBroadcast updates the confirmation of a queued broadcast and
+// rebroadcasts it if it is still pending and due, or if newPeers is set. A
+// pending broadcast older than broadcastExpiry expires instead. An update
+// made to the broadcast while it was being checked wins over the check,
+// which the next one repeats.
+func (n *Node) checkBroadcast(txid string, newPeers bool) {
+	n.broadcasts.mu.Lock()
+	broadcast, ok := n.broadcasts.txs[txid]
+	n.broadcasts.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	bestBlock, err := n.chainService.BestBlock()
+	if err != nil {
+		n.logger.Warnf("Failed to get best block for broadcasts: %v", err)
+		return
+	}
+
+	changed := n.refreshBroadcast(&broadcast, bestBlock.Height)
+
+	now := time.Now().Unix()
+	switch {
+	case broadcast.expired(now):
+		n.logger.Infof("Broadcast transaction %s expired unconfirmed after %s, no longer rebroadcasting", logging.KV("txid", txid), broadcastExpiry)
+		broadcast.Status = TxStatusExpired
+		changed = true
+	case broadcast.Status == TxStatusPending && (newPeers || broadcast.dueForRebroadcast(now)):
+		n.rebroadcast(&broadcast, now)
+		changed = true
+	}
+
+	if !changed {
+		return
+	}
+	broadcast.UpdatedAt = now
+
+	n.broadcasts.checkMu.Lock()
+	defer n.broadcasts.checkMu.Unlock()
+
+	n.broadcasts.mu.Lock()
+	current, ok := n.broadcasts.txs[txid]
+	if !ok || current.revision != broadcast.revision {
+		// Evicted, or updated by a send or a double spend meanwhile
+		n.broadcasts.mu.Unlock()
+		return
+	}
+	broadcast = n.broadcasts.put(broadcast)
+	n.broadcasts.mu.Unlock()
+
+	if n.store != nil {
+		if err := n.store.PutBroadcast(broadcast); err != nil {
+			n.logger.Warnf("Failed to persist broadcast %s: %v", txid, err)
+		}
+	}
+}
+
+// refreshBroadcast checks that the confirming or conflicting block of
+// broadcast is still in the best chain ending at tip, or searches for a
+// confirming one if there is none. It reports whether broadcast changed.
+func (n *Node) refreshBroadcast(broadcast *BroadcastTx, tip int32) bool {
+	if broadcast.Status == TxStatusConflicted {
+		return n.refreshConflict(broadcast, tip)
+	}
+
+	changed := false
+	if broadcast.BlockHash != "" {
+		hash, err := n.blockHashAt(broadcast.BlockHeight)
+		if err != nil && broadcast.BlockHeight <= tip {
+			n.logger.Debugf("Failed to check the block of broadcast %s: %v", broadcast.TxID, err)
+			return false
+		}
+		if hash == broadcast.BlockHash {
+			return false
+		}
+		n.logger.Warnf("Broadcast transaction %s left the best chain in a reorg, rebroadcasting", logging.KV("txid", broadcast.TxID))
+		broadcast.ScannedHeight = min(broadcast.ScannedHeight, broadcast.BlockHeight-1)
+		broadcast.BlockHash = ""
+		broadcast.BlockHeight = 0
+		broadcast.Status = TxStatusPending
+		broadcast.LastBroadcastAt = 0
+		changed = true
+	}
+
+	script, err := hex.DecodeString(broadcast.ScriptPubKey)
+	if err != nil || len(script) == 0 {
+		return changed
+	}
+	scanned := broadcast.ScannedHeight
+	blockHash, height, err := n.findTx(n.lifetime, broadcast.TxID, script, &broadcast.ScannedHeight, tip, nil)
+	if err != nil {
+		n.logger.Debugf("Failed to search for broadcast transaction %s: %v", logging.KV("txid", broadcast.TxID), err)
+	}
+	if blockHash != "" {
+		broadcast.BlockHash = blockHash
+		broadcast.BlockHeight = height
+		broadcast.Status = TxStatusConfirmed
+		n.logger.Infof("Broadcast transaction %s confirmed at height %d", logging.KV("txid", broadcast.TxID), logging.KV("height", height))
+	}
+	return changed || broadcast.ScannedHeight != scanned
+}
+
+// rebroadcast sends broadcast to the connected peers again.
+func (n *Node) rebroadcast(broadcast *BroadcastTx, now int64) {
+	tx, err := decodeRawTx(broadcast.RawTx)
+	if err != nil {
+		n.logger.Errorf("Invalid raw transaction queued for %s: %v", broadcast.TxID, err)
+		return
+	}
+
+	peers := n.peerAddrs()
+	err = n.chainService.SendTransaction(tx)
+	if pushtx.IsBroadcastError(err, pushtx.Confirmed) {
+		// Found by a later check against our own view of the chain
+		err = nil
+	}
+	broadcast.recordAttempt(now, peers, err)
+	n.metrics.broadcast(true, err)
+	if err != nil {
+		n.logger.Debugf("Rebroadcast of %s failed: %v", broadcast.TxID, err)
+	}
+}
@@ -0,0 +1,241 @@
+package neutrino
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+)
+
+func TestBroadcastAttempts(t *testing.T) {
+	broadcast := BroadcastTx{TxID: "tx1", Status: TxStatusPending}
+
+	broadcast.recordAttempt(100, []string{"peer1"}, errors.New("no peers"))
+	if broadcast.Attempts != 1 || broadcast.LastError != "no peers" || broadcast.FirstBroadcastAt != 0 || len(broadcast.AnnouncedPeers) != 0 {
+		t.Errorf("after a failed attempt: %+v", broadcast)
+	}
+
+	broadcast.recordAttempt(200, []string{"peer1", "peer2"}, nil)
+	if broadcast.Attempts != 2 || broadcast.LastError != "" || broadcast.FirstBroadcastAt != 200 {
+		t.Errorf("after a successful attempt: %+v", broadcast)
+	}
+
+	broadcast.recordAttempt(300, []string{"peer2", "peer3"}, nil)
+	if broadcast.FirstBroadcastAt != 200 || broadcast.LastBroadcastAt != 300 {
+		t.Errorf("after a later attempt: %+v", broadcast)
+	}
+	if want := []string{"peer1", "peer2", "peer3"}; !slices.Equal(broadcast.AnnouncedPeers, want) {
+		t.Errorf("announced peers = %v, want %v", broadcast.AnnouncedPeers, want)
+	}
+
+	status := broadcast.status(100)
+	if status.PeersAnnounced != 3 || status.Rebroadcasts != 2 || status.Confirmations != 0 {
+		t.Errorf("status() of a pending broadcast = %+v", status)
+	}
+	confirmed := broadcast
+	confirmed.BlockHash, confirmed.BlockHeight, confirmed.Status = "aa", 98, TxStatusConfirmed
+	if status := confirmed.status(100); status.Confirmations != 3 || status.BlockHeight != 98 {
+		t.Errorf("status() of a confirmed broadcast = %+v", status)
+	}
+
+	interval := int64(rebroadcastInterval.Seconds())
+	tests := []struct {
+		name   string
+		status string
+		now    int64
+		want   bool
+	}{
+		{"pending before the interval", TxStatusPending, 300 + interval - 1, false},
+		{"pending after the interval", TxStatusPending, 300 + interval, true},
+		{"confirmed", TxStatusConfirmed, 300 + interval, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := broadcast
+			b.Status = tt.status
+			if got := b.dueForRebroadcast(tt.now); got != tt.want {
+				t.Errorf("dueForRebroadcast() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBroadcastQueueMakeRoom(t *testing.T) {
+	q := &broadcastQueue{txs: make(map[string]BroadcastTx), inputs: make(map[string][]string)}
+	for i := range maxBroadcasts {
+		txid := fmt.Sprintf("tx%d", i)
+		q.txs[txid] = BroadcastTx{TxID: txid, Status: TxStatusPending, CreatedAt: int64(i)}
+	}
+	q.txs["tx7"] = BroadcastTx{TxID: "tx7", Status: TxStatusConfirmed, CreatedAt: 7}
+	q.txs["tx5"] = BroadcastTx{TxID: "tx5", Status: TxStatusExpired, CreatedAt: 5}
+
+	for _, want := range []string{"tx5", "tx7", "tx0"} {
+		if evicted := q.makeRoom(); evicted.TxID != want {
+			t.Fatalf("makeRoom() evicted %q, want %q", evicted.TxID, want)
+		}
+		if _, ok := q.txs[want]; ok {
+			t.Errorf("evicted broadcast %s is still queued", want)
+		}
+		q.txs["new"+want] = BroadcastTx{TxID: "new" + want, Status: TxStatusPending, CreatedAt: maxBroadcasts}
+	}
+
+	delete(q.txs, "newtx0")
+	if evicted := q.makeRoom(); evicted.TxID != "" {
+		t.Errorf("makeRoom() evicted %q from a queue with room", evicted.TxID)
+	}
+}
+
+func TestBroadcastTxExpired(t *testing.T) {
+	expiry := int64(broadcastExpiry / time.Second)
+	tests := []struct {
+		name   string
+		status string
+		now    int64
+		want   bool
+	}{
+		{"pending within the expiry", TxStatusPending, 1000 + expiry - 1, false},
+		{"pending past the expiry", TxStatusPending, 1000 + expiry, true},
+		{"confirmed past the expiry", TxStatusConfirmed, 1000 + expiry, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := BroadcastTx{Status: tt.status, CreatedAt: 1000}
+			if got := b.expired(tt.now); got != tt.want {
+				t.Errorf("expired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchScript(t *testing.T) {
+	nullData := []byte{0x6a, 0x04, 0xde, 0xad, 0xbe, 0xef}
+	p2wpkh, _ := hex.DecodeString("001481f291ca5498ec941b014fff4719201ba68939d5")
+
+	tx := wire.NewMsgTx(2)
+	tx.AddTxOut(wire.NewTxOut(0, nullData))
+	if got := searchScript(tx); got != "" {
+		t.Errorf("searchScript() = %q for a transaction with only null data", got)
+	}
+
+	tx.AddTxOut(wire.NewTxOut(1000, p2wpkh))
+	if got := searchScript(tx); got != hex.EncodeToString(p2wpkh) {
+		t.Errorf("searchScript() = %q, want the P2WPKH output", got)
+	}
+}
+
+func TestStoreBroadcasts(t *testing.T) {
+	store := newTestStore(t)
+
+	broadcast := BroadcastTx{TxID: "tx1", RawTx: "0100", Status: TxStatusPending, Attempts: 2, AnnouncedPeers: []string{"peer1"}}
+	if err := store.PutBroadcast(broadcast); err != nil {
+		t.Fatalf("PutBroadcast() failed: %v", err)
+	}
+
+	broadcasts, err := store.Broadcasts()
+	if err != nil {
+		t.Fatalf("Broadcasts() failed: %v", err)
+	}
+	if got := broadcasts["tx1"]; !reflect.DeepEqual(got, broadcast) {
+		t.Errorf("Broadcasts() = %+v, want %+v", got, broadcast)
+	}
+
+	if err := store.DeleteBroadcast("tx1"); err != nil {
+		t.Fatalf("DeleteBroadcast() failed: %v", err)
+	}
+	if broadcasts, _ := store.Broadcasts(); len(broadcasts) != 0 {
+		t.Errorf("Broadcasts() after delete = %v", broadcasts)
+	}
+}
+
+func TestReserveBroadcast(t *testing.T) {
+	now := time.Now().Unix()
+	newNode := func() *Node {
+		return &Node{
+			logger: btclog.Disabled,
+			broadcasts: &broadcastQueue{
+				txs: map[string]BroadcastTx{
+					"tx1": {TxID: "tx1", Status: TxStatusPending, Attempts: 1},
+					"tx3": {TxID: "tx3", Status: TxStatusExpired, Attempts: 1},
+				},
+				keys: map[string]IdempotencyKey{
+					"key1":    {TxID: "tx1", CreatedAt: now},
+					"key4":    {TxID: "tx4", CreatedAt: now},
+					"expired": {TxID: "tx1", CreatedAt: now - int64(idempotencyKeyTTL.Seconds())},
+				},
+				sending: map[string]bool{"tx4": true},
+			},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		txid          string
+		key           string
+		wantDuplicate bool
+		wantConflict  bool
+	}{
+		{"new transaction", "tx2", "", false, false},
+		{"new transaction with a new key", "tx2", "key2", false, false},
+		{"queued transaction", "tx1", "", true, false},
+		{"retry with the same key", "tx1", "key1", true, false},
+		{"key reused for another transaction", "tx2", "key1", false, true},
+		{"expired key reused", "tx2", "expired", false, false},
+		{"expired transaction sent again", "tx3", "", false, false},
+		{"transaction being sent", "tx4", "", true, false},
+		{"retry of a request being sent", "tx4", "key4", true, false},
+		{"key of a request being sent reused", "tx2", "key4", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newNode()
+			result, err := n.reserveBroadcast(tt.txid, tt.key, 100)
+			var conflict *ConflictError
+			if got := errors.As(err, &conflict); got != tt.wantConflict {
+				t.Fatalf("reserveBroadcast() error = %v, want conflict %v", err, tt.wantConflict)
+			}
+			if got := result != nil && result.Duplicate; got != tt.wantDuplicate {
+				t.Errorf("reserveBroadcast() = %+v, want duplicate %v", result, tt.wantDuplicate)
+			}
+			if result != nil || err != nil {
+				return
+			}
+
+			// A repeat while the first request is sending is a duplicate
+			if again, _ := n.reserveBroadcast(tt.txid, tt.key, 100); again == nil || !again.Duplicate {
+				t.Errorf("repeated reserveBroadcast() = %+v, want duplicate", again)
+			}
+			n.broadcasts.release(tt.txid, tt.key)
+			if again, err := n.reserveBroadcast(tt.txid, tt.key, 100); again != nil || err != nil {
+				t.Errorf("reserveBroadcast() after release() = %+v, %v; want a reservation", again, err)
+			}
+		})
+	}
+}
+
+func TestPruneIdempotencyKeys(t *testing.T) {
+	now := time.Now().Unix()
+	n := &Node{
+		logger: btclog.Disabled,
+		broadcasts: &broadcastQueue{
+			keys: map[string]IdempotencyKey{
+				"key1":    {TxID: "tx1", CreatedAt: now},
+				"expired": {TxID: "tx1", CreatedAt: now - int64(idempotencyKeyTTL.Seconds())},
+			},
+		},
+	}
+
+	n.pruneIdempotencyKeys()
+	if _, ok := n.broadcasts.keys["expired"]; ok {
+		t.Error("pruneIdempotencyKeys() kept an expired key")
+	}
+	if _, ok := n.broadcasts.keys["key1"]; !ok {
+		t.Error("pruneIdempotencyKeys() dropped a live key")
+	}
+}
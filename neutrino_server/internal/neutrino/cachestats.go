@@ -0,0 +1,78 @@
+package neutrino
+
+import (
+	"errors"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightninglabs/neutrino"
+)
+
+// CacheStats describes one of the node's in-memory caches. Hits and misses
+// are of the lookups scans made since the node started, and Evictions counts
+// the entries their fetches displaced.
+type CacheStats struct {
+	CapacityBytes uint64  `json:"capacity_bytes"`
+	SizeBytes     uint64  `json:"size_bytes"`
+	Entries       int     `json:"entries"`
+	Hits          uint64  `json:"hits"`
+	Misses        uint64  `json:"misses"`
+	HitRatio      float64 `json:"hit_ratio"`
+	Evictions     uint64  `json:"evictions"`
+}
+
+// CacheReport describes the compact filter and block caches, so operators
+// can size them with --filter-cache-mb and --block-memory-cache-mb.
+type CacheReport struct {
+	Filters CacheStats `json:"filter_cache"`
+	Blocks  CacheStats `json:"block_cache"`
+}
+
+// CacheStats reports the size, hit rate and evictions of the filter and block
+// caches. A cache evicting entries while its hit ratio stays low is evicting
+// entries scans need again.
+func (n *Node) CacheStats() (*CacheReport, error) {
+	if n.chainService == nil {
+		return nil, errors.New("chain service not initialized")
+	}
+
+	report := &CacheReport{
+		Filters: CacheStats{
+			CapacityBytes: neutrino.DefaultFilterCacheSize,
+			Entries:       n.chainService.FilterCache.Len(),
+			Hits:          n.metrics.filterCacheHits.Load(),
+			Misses:        n.metrics.filterCacheMisses.Load(),
+			Evictions:     n.metrics.filterEvictions.Load(),
+		},
+		Blocks: CacheStats{
+			CapacityBytes: neutrino.DefaultBlockCacheSize,
+			Entries:       n.chainService.BlockCache.Len(),
+			Hits:          n.metrics.blockCacheHits.Load(),
+			Misses:        n.metrics.blockCacheMisses.Load(),
+			Evictions:     n.metrics.blockEvictions.Load(),
+		},
+	}
+	if n.config.FilterCacheSize > 0 {
+		report.Filters.CapacityBytes = uint64(n.config.FilterCacheSize)
+	}
+	if n.config.BlockMemoryCacheSize > 0 {
+		report.Blocks.CapacityBytes = uint64(n.config.BlockMemoryCacheSize)
+	}
+
+	n.chainService.FilterCache.Range(func(_ neutrino.FilterCacheKey, filter *neutrino.CacheableFilter) bool {
+		size, _ := filter.Size()
+		report.Filters.SizeBytes += size
+		return true
+	})
+	n.chainService.BlockCache.Range(func(_ wire.InvVect, block *neutrino.CacheableBlock) bool {
+		size, _ := block.Size()
+		report.Blocks.SizeBytes += size
+		return true
+	})
+
+	for _, stats := range []*CacheStats{&report.Filters, &report.Blocks} {
+		if lookups := stats.Hits + stats.Misses; lookups > 0 {
+			stats.HitRatio = float64(stats.Hits) / float64(lookups)
+		}
+	}
+	return report, nil
+}
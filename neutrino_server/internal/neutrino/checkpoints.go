@@ -0,0 +1,214 @@
+package neutrino
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/lightninglabs/neutrino/headerfs"
+)
+
+// Checkpoint is a known-good block of the best chain, optionally with its
+// filter header.
+type Checkpoint struct {
+	Height       int32
+	BlockHash    chainhash.Hash
+	FilterHeader *chainhash.Hash
+}
+
+// ParseCheckpoints parses a comma-separated list of checkpoints, each
+// height:block_hash or height:block_hash:filter_header.
+func ParseCheckpoints(list string) ([]Checkpoint, error) {
+	var checkpoints []Checkpoint
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		fields := strings.Split(entry, ":")
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("invalid checkpoint %q: use height:block_hash[:filter_header]", entry)
+		}
+		height, err := strconv.ParseInt(fields[0], 10, 32)
+		if err != nil || height <= 0 {
+			return nil, fmt.Errorf("invalid checkpoint %q: height must be a positive number", entry)
+		}
+		hash, err := chainhash.NewHashFromStr(fields[1])
+		if err != nil || len(fields[1]) != 2*chainhash.HashSize {
+			return nil, fmt.Errorf("invalid checkpoint %q: invalid block hash", entry)
+		}
+		checkpoint := Checkpoint{Height: int32(height), BlockHash: *hash}
+		if len(fields) == 3 {
+			filterHeader, err := chainhash.NewHashFromStr(fields[2])
+			if err != nil || len(fields[2]) != 2*chainhash.HashSize {
+				return nil, fmt.Errorf("invalid checkpoint %q: invalid filter header", entry)
+			}
+			checkpoint.FilterHeader = filterHeader
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	return checkpoints, nil
+}
+
+// withCheckpoints returns a copy of params whose block checkpoints include
+// checkpoints. neutrino syncs headers from one checkpoint to the next and
+// disconnects peers serving a chain that contradicts them.
+func withCheckpoints(params *chaincfg.Params, checkpoints []Checkpoint) (*chaincfg.Params, error) {
+	if len(checkpoints) == 0 {
+		return params, nil
+	}
+
+	merged := make(map[int32]chaincfg.Checkpoint, len(params.Checkpoints)+len(checkpoints))
+	for _, checkpoint := range params.Checkpoints {
+		merged[checkpoint.Height] = checkpoint
+	}
+	for _, checkpoint := range checkpoints {
+		if existing, ok := merged[checkpoint.Height]; ok && *existing.Hash != checkpoint.BlockHash {
+			return nil, fmt.Errorf("checkpoint at height %d is %s, but %s is already checkpointed there", checkpoint.Height, checkpoint.BlockHash, existing.Hash)
+		}
+		merged[checkpoint.Height] = chaincfg.Checkpoint{Height: checkpoint.Height, Hash: &checkpoint.BlockHash}
+	}
+
+	withCheckpoints := *params
+	withCheckpoints.Checkpoints = make([]chaincfg.Checkpoint, 0, len(merged))
+	for _, checkpoint := range merged {
+		withCheckpoints.Checkpoints = append(withCheckpoints.Checkpoints, checkpoint)
+	}
+	slices.SortFunc(withCheckpoints.Checkpoints, func(a, b chaincfg.Checkpoint) int {
+		return cmp.Compare(a.Height, b.Height)
+	})
+	return &withCheckpoints, nil
+}
+
+// filterHeaderAssertion returns the highest checkpoint with a filter header
+// as a neutrino filter header assertion, which discards stored filter
+// headers contradicting it on start, or nil if there is none.
+func filterHeaderAssertion(checkpoints []Checkpoint) *headerfs.FilterHeader {
+	var assertion *headerfs.FilterHeader
+	for _, checkpoint := range checkpoints {
+		if checkpoint.FilterHeader == nil || (assertion != nil && int32(assertion.Height) > checkpoint.Height) {
+			continue
+		}
+		assertion = &headerfs.FilterHeader{
+			HeaderHash: checkpoint.BlockHash,
+			FilterHash: *checkpoint.FilterHeader,
+			Height:     uint32(checkpoint.Height),
+		}
+	}
+	return assertion
+}
+
+// headerFetcher reads the stored header chains, as neutrino's header stores
+// do.
+type headerFetcher interface {
+	blockHash(height int32) (chainhash.Hash, error)
+	filterHeader(height int32) (chainhash.Hash, error)
+}
+
+// checkpointVerifier checks the stored header chains against the configured
+// checkpoints as sync passes them.
+type checkpointVerifier struct {
+	checkpoints []Checkpoint
+
+	mu       sync.Mutex
+	blocks   int32
+	filters  int32
+	conflict error
+}
+
+func newCheckpointVerifier(checkpoints []Checkpoint) *checkpointVerifier {
+	sorted := slices.SortedFunc(slices.Values(checkpoints), func(a, b Checkpoint) int {
+		return cmp.Compare(a.Height, b.Height)
+	})
+	return &checkpointVerifier{checkpoints: sorted, blocks: -1, filters: -1}
+}
+
+// verify checks the stored headers at the checkpoints up to blockHeight and
+// filterHeight not verified yet. A contradiction is kept, see err; the
+// returned error is a failure to read the headers.
+func (v *checkpointVerifier) verify(headers headerFetcher, blockHeight, filterHeight int32) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.conflict != nil {
+		return nil
+	}
+
+	for _, checkpoint := range v.checkpoints {
+		if checkpoint.Height > v.blocks && checkpoint.Height <= blockHeight {
+			hash, err := headers.blockHash(checkpoint.Height)
+			if err != nil {
+				return err
+			}
+			if hash != checkpoint.BlockHash {
+				v.conflict = fmt.Errorf("block %d is %s, but the checkpoint is %s", checkpoint.Height, hash, checkpoint.BlockHash)
+				return nil
+			}
+		}
+		if checkpoint.FilterHeader != nil && checkpoint.Height > v.filters && checkpoint.Height <= filterHeight {
+			header, err := headers.filterHeader(checkpoint.Height)
+			if err != nil {
+				return err
+			}
+			if header != *checkpoint.FilterHeader {
+				v.conflict = fmt.Errorf("filter header %d is %s, but the checkpoint is %s", checkpoint.Height, header, checkpoint.FilterHeader)
+				return nil
+			}
+		}
+	}
+	v.blocks = max(v.blocks, blockHeight)
+	v.filters = max(v.filters, filterHeight)
+	return nil
+}
+
+// err returns the contradiction found, or nil.
+func (v *checkpointVerifier) err() error {
+	if v == nil {
+		return nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.conflict
+}
+
+// chainHeaders reads the header chains of a chain service.
+type chainHeaders struct {
+	blocks  headerfs.BlockHeaderStore
+	filters *headerfs.FilterHeaderStore
+}
+
+func (c chainHeaders) blockHash(height int32) (chainhash.Hash, error) {
+	header, err := c.blocks.FetchHeaderByHeight(uint32(height))
+	if err != nil {
+		return chainhash.Hash{}, fmt.Errorf("failed to read block header %d: %w", height, err)
+	}
+	return header.BlockHash(), nil
+}
+
+func (c chainHeaders) filterHeader(height int32) (chainhash.Hash, error) {
+	header, err := c.filters.FetchHeaderByHeight(uint32(height))
+	if err != nil {
+		return chainhash.Hash{}, fmt.Errorf("failed to read filter header %d: %w", height, err)
+	}
+	return *header, nil
+}
+
+// verifyCheckpoints checks the header chains synced so far against the
+// configured checkpoints. A contradiction is logged once and makes the node
+// not ready, see GetReadiness.
+func (n *Node) verifyCheckpoints(blockHeight, filterHeight int32) {
+	if n.checkpoints == nil || n.checkpoints.err() != nil {
+		return
+	}
+	headers := chainHeaders{blocks: n.chainService.BlockHeaders, filters: n.chainService.RegFilterHeaders}
+	if err := n.checkpoints.verify(headers, blockHeight, filterHeight); err != nil {
+		n.logger.Warnf("Failed to check the header chains against the checkpoints: %v", err)
+	}
+	if err := n.checkpoints.err(); err != nil {
+		n.logger.Errorf("Header chain contradicts the configured checkpoints: %v", err)
+	}
+}
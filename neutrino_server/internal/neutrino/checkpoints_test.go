@@ -0,0 +1,143 @@
+package neutrino
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+const (
+	testBlockHash    = "00000000000000000002a7c4c1e48d76c5a37902165a270156b7a8d72728a054"
+	testFilterHeader = "a5ae8bd7b7ad2d3d762e2bbbd55ce9a0aaef2b6e2da7bb0d31e9c46c3b8e8f1d"
+)
+
+func TestParseCheckpoints(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    int
+		filters int
+		wantErr string
+	}{
+		{"empty", "", 0, 0, ""},
+		{"block checkpoint", "800000:" + testBlockHash, 1, 0, ""},
+		{"with filter header", "800000:" + testBlockHash + ":" + testFilterHeader + ", 700000:" + testBlockHash, 2, 1, ""},
+		{"no hash", "800000", 0, 0, "use height:block_hash"},
+		{"negative height", "-1:" + testBlockHash, 0, 0, "positive number"},
+		{"short hash", "800000:abcd", 0, 0, "invalid block hash"},
+		{"invalid filter header", "800000:" + testBlockHash + ":xyz", 0, 0, "invalid filter header"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkpoints, err := ParseCheckpoints(tt.list)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseCheckpoints() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCheckpoints() failed: %v", err)
+			}
+			filters := 0
+			for _, checkpoint := range checkpoints {
+				if checkpoint.FilterHeader != nil {
+					filters++
+				}
+			}
+			if len(checkpoints) != tt.want || filters != tt.filters {
+				t.Errorf("ParseCheckpoints() = %d checkpoints with %d filter headers, want %d with %d", len(checkpoints), filters, tt.want, tt.filters)
+			}
+		})
+	}
+}
+
+func TestWithCheckpoints(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	builtIn := len(params.Checkpoints)
+	last := params.Checkpoints[builtIn-1]
+
+	hash, _ := chainhash.NewHashFromStr(testBlockHash)
+	merged, err := withCheckpoints(params, []Checkpoint{
+		{Height: last.Height + 1000, BlockHash: *hash},
+		{Height: last.Height, BlockHash: *last.Hash},
+	})
+	if err != nil {
+		t.Fatalf("withCheckpoints() failed: %v", err)
+	}
+	if len(merged.Checkpoints) != builtIn+1 || merged.Checkpoints[builtIn].Height != last.Height+1000 {
+		t.Errorf("withCheckpoints() has %d checkpoints, want the new one last of %d", len(merged.Checkpoints), builtIn+1)
+	}
+	if len(params.Checkpoints) != builtIn {
+		t.Error("withCheckpoints() modified the network's parameters")
+	}
+
+	if _, err := withCheckpoints(params, []Checkpoint{{Height: last.Height, BlockHash: *hash}}); err == nil {
+		t.Error("withCheckpoints() accepted a checkpoint contradicting a built-in one")
+	}
+}
+
+func TestFilterHeaderAssertion(t *testing.T) {
+	filterHeader, _ := chainhash.NewHashFromStr(testFilterHeader)
+	checkpoints := []Checkpoint{
+		{Height: 900, FilterHeader: filterHeader},
+		{Height: 1000},
+		{Height: 800, FilterHeader: filterHeader},
+	}
+	if assertion := filterHeaderAssertion(checkpoints); assertion == nil || assertion.Height != 900 {
+		t.Errorf("filterHeaderAssertion() = %+v, want the checkpoint at 900", assertion)
+	}
+	if assertion := filterHeaderAssertion(checkpoints[1:2]); assertion != nil {
+		t.Errorf("filterHeaderAssertion() without filter headers = %+v, want nil", assertion)
+	}
+}
+
+// fakeHeaders serves header chains in which every block hash is
+// chainhash.Hash{1} and every filter header chainhash.Hash{2}.
+type fakeHeaders struct {
+	reads int
+}
+
+func (f *fakeHeaders) blockHash(height int32) (chainhash.Hash, error) {
+	f.reads++
+	return chainhash.Hash{1}, nil
+}
+
+func (f *fakeHeaders) filterHeader(height int32) (chainhash.Hash, error) {
+	f.reads++
+	return chainhash.Hash{2}, nil
+}
+
+func TestCheckpointVerifier(t *testing.T) {
+	good := chainhash.Hash{2}
+	bad := chainhash.Hash{3}
+	verifier := newCheckpointVerifier([]Checkpoint{
+		{Height: 200, BlockHash: chainhash.Hash{1}, FilterHeader: &bad},
+		{Height: 100, BlockHash: chainhash.Hash{1}, FilterHeader: &good},
+	})
+	headers := &fakeHeaders{}
+
+	if err := verifier.verify(headers, 150, 50); err != nil || verifier.err() != nil {
+		t.Fatalf("verify() = %v, %v, want no contradiction", err, verifier.err())
+	}
+	if headers.reads != 1 {
+		t.Errorf("verify() read %d headers, want the block at 100", headers.reads)
+	}
+
+	if err := verifier.verify(headers, 250, 150); err != nil || verifier.err() != nil {
+		t.Fatalf("verify() = %v, %v, want no contradiction", err, verifier.err())
+	}
+	if headers.reads != 3 {
+		t.Errorf("verify() read %d headers, want the filter at 100 and the block at 200 too", headers.reads)
+	}
+
+	if err := verifier.verify(headers, 250, 250); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.err(); err == nil || !strings.Contains(err.Error(), "filter header 200") {
+		t.Errorf("err() = %v, want the filter header at 200 contradicting", err)
+	}
+}
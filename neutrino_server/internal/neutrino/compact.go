@@ -0,0 +1,191 @@
+package neutrino
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/btcsuite/btcwallet/walletdb"
+)
+
+// compactTxMaxSize is how many bytes of keys and values a compaction writes
+// per transaction, bounding its memory use.
+const compactTxMaxSize = 64 << 20
+
+// Compaction describes a compacted database.
+type Compaction struct {
+	Path       string `json:"path"`
+	SizeBefore int64  `json:"size_before"`
+	SizeAfter  int64  `json:"size_after"`
+}
+
+// CompactDatabase rewrites the database in dataDir into a fresh file holding
+// only its live data and replaces the original with it. Neither bbolt nor
+// SQLite returns the pages freed by deletes to the file system, so the
+// database otherwise keeps the size of its largest state. neutrinod must not
+// be running on dataDir; the original is left untouched if compaction fails.
+func CompactDatabase(dataDir string) (*Compaction, error) {
+	backend := detectDBBackend(dataDir)
+	dbPath := filepath.Join(dataDir, dbFiles[backend])
+	before, err := os.Stat(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("no database in %s: %w", dataDir, err)
+	}
+	src, err := openDB(backend, dbPath, false, "", headerDBTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database at %s (is neutrinod running?): %w", dbPath, err)
+	}
+	defer src.Close()
+
+	// A SQLite copy is written in rollback journal mode, so that it is
+	// complete in a single file once closed; the node switches it back to
+	// its journal mode when it opens it
+	tmpPath := dbPath + ".compact"
+	removeDBFiles(tmpPath)
+	dst, err := openDB(backend, tmpPath, true, SQLiteJournalDelete, headerDBTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", tmpPath, err)
+	}
+	err = compactDB(src, dst, compactTxMaxSize)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		removeDBFiles(tmpPath)
+		return nil, fmt.Errorf("failed to compact database: %w", err)
+	}
+
+	// The original stays open, and locked, until replaced, so no node
+	// starts on it meanwhile
+	err = os.Rename(tmpPath, dbPath)
+	removeDBFiles(tmpPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to replace database: %w", err)
+	}
+	after, err := os.Stat(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Compaction{Path: dbPath, SizeBefore: before.Size(), SizeAfter: after.Size()}, nil
+}
+
+// compactDB copies every bucket, key and bucket sequence of src to the empty
+// dst, committing after every txMaxSize bytes written.
+func compactDB(src, dst walletdb.DB, txMaxSize int64) error {
+	w := &compactWriter{db: dst, txMaxSize: txMaxSize}
+	err := walletdb.View(src, func(tx walletdb.ReadTx) error {
+		return tx.ForEachBucket(func(name []byte) error {
+			return w.copyBucket([][]byte{name}, tx.ReadBucket(name))
+		})
+	})
+	if err != nil {
+		if w.tx != nil {
+			w.tx.Rollback()
+		}
+		return err
+	}
+	return w.commit()
+}
+
+// compactWriter writes the buckets and keys of a compaction to a database
+// in transactions of bounded size.
+type compactWriter struct {
+	db        walletdb.DB
+	txMaxSize int64
+
+	tx   walletdb.ReadWriteTx
+	size int64
+}
+
+// copyBucket creates the bucket at path and copies src into it.
+func (w *compactWriter) copyBucket(path [][]byte, src walletdb.ReadBucket) error {
+	var sequence uint64
+	if s, ok := src.(interface{ Sequence() uint64 }); ok {
+		sequence = s.Sequence()
+	}
+	if err := w.createBucket(path, sequence); err != nil {
+		return err
+	}
+
+	return src.ForEach(func(k, v []byte) error {
+		if v == nil {
+			if nested := src.NestedReadBucket(k); nested != nil {
+				return w.copyBucket(append(path[:len(path):len(path)], k), nested)
+			}
+		}
+		return w.put(path, k, v)
+	})
+}
+
+// createBucket creates the bucket at path with sequence.
+func (w *compactWriter) createBucket(path [][]byte, sequence uint64) error {
+	tx, err := w.begin(int64(len(path[len(path)-1])))
+	if err != nil {
+		return err
+	}
+	var bucket walletdb.ReadWriteBucket
+	if len(path) == 1 {
+		bucket, err = tx.CreateTopLevelBucket(path[0])
+	} else {
+		bucket, err = w.bucket(path[:len(path)-1]).CreateBucket(path[len(path)-1])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create bucket %x: %w", path, err)
+	}
+	if sequence == 0 {
+		return nil
+	}
+	return bucket.SetSequence(sequence)
+}
+
+// put writes the key k with value v to the bucket at path.
+func (w *compactWriter) put(path [][]byte, k, v []byte) error {
+	if _, err := w.begin(int64(len(k) + len(v))); err != nil {
+		return err
+	}
+	if v == nil {
+		v = []byte{}
+	}
+	return w.bucket(path).Put(k, v)
+}
+
+// begin returns the transaction to write size more bytes in, committing the
+// current one first if it is full.
+func (w *compactWriter) begin(size int64) (walletdb.ReadWriteTx, error) {
+	if w.tx != nil && w.size+size > w.txMaxSize {
+		if err := w.commit(); err != nil {
+			return nil, err
+		}
+	}
+	if w.tx == nil {
+		tx, err := w.db.BeginReadWriteTx()
+		if err != nil {
+			return nil, err
+		}
+		w.tx, w.size = tx, 0
+	}
+	w.size += size
+	return w.tx, nil
+}
+
+// bucket returns the bucket at path in the current transaction.
+func (w *compactWriter) bucket(path [][]byte) walletdb.ReadWriteBucket {
+	bucket := w.tx.ReadWriteBucket(path[0])
+	for _, name := range path[1:] {
+		bucket = bucket.NestedReadWriteBucket(name)
+	}
+	return bucket
+}
+
+// commit commits the current transaction, if any.
+func (w *compactWriter) commit() error {
+	if w.tx == nil {
+		return nil
+	}
+	tx := w.tx
+	w.tx = nil
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit compacted data: %w", err)
+	}
+	return nil
+}
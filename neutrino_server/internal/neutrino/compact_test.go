@@ -0,0 +1,151 @@
+package neutrino
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcwallet/walletdb"
+)
+
+// dumpDB returns every bucket, sequence, key and value of db, one per line.
+func dumpDB(t *testing.T, db walletdb.DB) string {
+	t.Helper()
+	var dump bytes.Buffer
+	var walk func(prefix string, bucket walletdb.ReadBucket) error
+	walk = func(prefix string, bucket walletdb.ReadBucket) error {
+		fmt.Fprintf(&dump, "%s seq=%d\n", prefix, bucket.(interface{ Sequence() uint64 }).Sequence())
+		return bucket.ForEach(func(k, v []byte) error {
+			if nested := bucket.NestedReadBucket(k); nested != nil {
+				return walk(prefix+"/"+string(k), nested)
+			}
+			fmt.Fprintf(&dump, "%s %s=%x\n", prefix, k, v)
+			return nil
+		})
+	}
+	err := walletdb.View(db, func(tx walletdb.ReadTx) error {
+		return tx.ForEachBucket(func(name []byte) error {
+			return walk(string(name), tx.ReadBucket(name))
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dump.String()
+}
+
+func TestCompactDB(t *testing.T) {
+	dir := t.TempDir()
+	src, err := walletdb.Create("bdb", filepath.Join(dir, "src.db"), true, headerDBTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	err = walletdb.Update(src, func(tx walletdb.ReadWriteTx) error {
+		root, err := tx.CreateTopLevelBucket([]byte("root"))
+		if err != nil {
+			return err
+		}
+		if err := root.SetSequence(42); err != nil {
+			return err
+		}
+		events, err := root.CreateBucket([]byte("events"))
+		if err != nil {
+			return err
+		}
+		wallet, err := events.CreateBucket([]byte("wallet"))
+		if err != nil {
+			return err
+		}
+		for i := range 100 {
+			if err := wallet.Put([]byte(fmt.Sprintf("%03d", i)), bytes.Repeat([]byte{byte(i)}, 1000)); err != nil {
+				return err
+			}
+		}
+		if err := root.Put([]byte("empty"), []byte{}); err != nil {
+			return err
+		}
+		if _, err := tx.CreateTopLevelBucket([]byte("unused")); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A tiny transaction size makes the copy span many transactions
+	dst, err := walletdb.Create("bdb", filepath.Join(dir, "dst.db"), true, headerDBTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	if err := compactDB(src, dst, 2500); err != nil {
+		t.Fatalf("compactDB() failed: %v", err)
+	}
+
+	if got, want := dumpDB(t, dst), dumpDB(t, src); got != want {
+		t.Errorf("compacted database differs:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCompactDatabase(t *testing.T) {
+	for _, backend := range []string{DBBackendBolt, DBBackendSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := openDB(backend, filepath.Join(dir, dbFiles[backend]), true, SQLiteJournalWAL, headerDBTimeout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Fill the database, then delete most of it
+			for i := range 20 {
+				err := walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+					bucket, err := tx.CreateTopLevelBucket([]byte(fmt.Sprintf("bucket-%d", i)))
+					if err != nil {
+						return err
+					}
+					return bucket.Put([]byte("data"), bytes.Repeat([]byte{1}, 200_000))
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+				for i := 1; i < 20; i++ {
+					if err := tx.DeleteTopLevelBucket([]byte(fmt.Sprintf("bucket-%d", i))); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := dumpDB(t, db)
+
+			if _, err := CompactDatabase(dir); err == nil {
+				t.Error("CompactDatabase() of an open database succeeded")
+			}
+			db.Close()
+
+			compaction, err := CompactDatabase(dir)
+			if err != nil {
+				t.Fatalf("CompactDatabase() failed: %v", err)
+			}
+			if compaction.SizeAfter >= compaction.SizeBefore/4 {
+				t.Errorf("CompactDatabase() = %+v, want the database shrunk", compaction)
+			}
+
+			db, err = openDB(backend, filepath.Join(dir, dbFiles[backend]), false, "", headerDBTimeout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if got := dumpDB(t, db); got != want {
+				t.Errorf("compacted database holds:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package neutrino
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Confidence levels of scan-derived results.
+const (
+	// ConfidenceComplete means every block in the scanned range was checked.
+	ConfidenceComplete = "complete"
+
+	// ConfidencePartial means some blocks could not be checked and were
+	// skipped by a lenient scan; they are listed in SkippedRanges.
+	ConfidencePartial = "partial"
+
+	// ConfidenceCached means the result was served from earlier scans
+	// without checking blocks above AsOfHeight.
+	ConfidenceCached = "cached"
+)
+
+// HeightRange is an inclusive range of block heights.
+type HeightRange struct {
+	Start int32 `json:"start"`
+	End   int32 `json:"end"`
+}
+
+// Confidence tells API consumers how far a scan-derived result can be
+// trusted, so they can decide whether to retry it.
+type Confidence struct {
+	Level         string        `json:"level"`
+	SkippedRanges []HeightRange `json:"skipped_ranges,omitempty"`
+	AsOfHeight    int32         `json:"as_of_height,omitempty"`
+}
+
+// scanConfidence returns the confidence of a scan that skipped the given
+// ranges.
+func scanConfidence(skipped []HeightRange) *Confidence {
+	if len(skipped) > 0 {
+		return &Confidence{Level: ConfidencePartial, SkippedRanges: skipped}
+	}
+	return &Confidence{Level: ConfidenceComplete}
+}
+
+// skipTracker records the heights a concurrent scan could not check.
+type skipTracker struct {
+	mu      sync.Mutex
+	heights []int32
+}
+
+// add records that height could not be checked.
+func (s *skipTracker) add(height int32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.heights = append(s.heights, height)
+}
+
+// ranges returns the skipped heights from through to as merged ranges.
+func (s *skipTracker) ranges(from, to int32) []HeightRange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ranges []HeightRange
+	for _, height := range s.heights {
+		if height >= from && height <= to {
+			ranges = append(ranges, HeightRange{Start: height, End: height})
+		}
+	}
+	return mergeRanges(ranges)
+}
+
+// mergeRanges sorts ranges and merges overlapping and adjacent ones.
+func mergeRanges(ranges []HeightRange) []HeightRange {
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	sorted := slices.Clone(ranges)
+	slices.SortFunc(sorted, func(a, b HeightRange) int { return int(a.Start) - int(b.Start) })
+
+	merged := []HeightRange{sorted[0]}
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start <= last.End+1 {
+			last.End = max(last.End, r.End)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// subtractRange removes the heights in cut from ranges.
+func subtractRange(ranges []HeightRange, cut HeightRange) []HeightRange {
+	var result []HeightRange
+	for _, r := range ranges {
+		if r.End < cut.Start || r.Start > cut.End {
+			result = append(result, r)
+			continue
+		}
+		if r.Start < cut.Start {
+			result = append(result, HeightRange{Start: r.Start, End: cut.Start - 1})
+		}
+		if r.End > cut.End {
+			result = append(result, HeightRange{Start: cut.End + 1, End: r.End})
+		}
+	}
+	return result
+}
+
+// formatRanges renders ranges as "a-b, c".
+func formatRanges(ranges []HeightRange) string {
+	parts := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		if r.Start == r.End {
+			parts = append(parts, fmt.Sprintf("%d", r.Start))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", r.Start, r.End))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
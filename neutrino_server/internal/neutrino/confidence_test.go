@@ -0,0 +1,95 @@
+package neutrino
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btclog"
+)
+
+func TestHeightRanges(t *testing.T) {
+	var skips skipTracker
+	for _, height := range []int32{7, 3, 4, 5, 10, 20} {
+		skips.add(height)
+	}
+
+	if got, want := skips.ranges(4, 10), []HeightRange{{4, 5}, {7, 7}, {10, 10}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ranges() = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name   string
+		ranges []HeightRange
+		cut    HeightRange
+		want   []HeightRange
+	}{
+		{"disjoint", []HeightRange{{1, 5}}, HeightRange{6, 9}, []HeightRange{{1, 5}}},
+		{"covered", []HeightRange{{3, 4}}, HeightRange{1, 9}, nil},
+		{"split", []HeightRange{{1, 10}}, HeightRange{4, 6}, []HeightRange{{1, 3}, {7, 10}}},
+		{"trim end", []HeightRange{{1, 5}, {8, 9}}, HeightRange{5, 8}, []HeightRange{{1, 4}, {9, 9}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := subtractRange(tt.ranges, tt.cut); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("subtractRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := formatRanges([]HeightRange{{1, 3}, {7, 7}}); got != "1-3, 7" {
+		t.Errorf("formatRanges() = %q", got)
+	}
+}
+
+func TestUTXOConfidence(t *testing.T) {
+	store := newTestStore(t)
+	mgr := &RescanManager{
+		chainParams:    &chaincfg.MainNetParams,
+		store:          store,
+		logger:         btclog.Disabled,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
+	}
+
+	complete := "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	gappy := "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S"
+	for _, address := range []string{complete, gappy} {
+		if err := mgr.WatchAddress(address); err != nil {
+			t.Fatalf("WatchAddress() failed: %v", err)
+		}
+	}
+
+	if err := store.SetScannedHeight([]string{complete}, 2000); err != nil {
+		t.Fatalf("SetScannedHeight() failed: %v", err)
+	}
+	if err := store.SetScannedHeight([]string{gappy}, 1500); err != nil {
+		t.Fatalf("SetScannedHeight() failed: %v", err)
+	}
+	if err := store.UpdateSkippedRanges([]string{gappy}, HeightRange{0, 1500}, []HeightRange{{100, 110}, {900, 900}}); err != nil {
+		t.Fatalf("UpdateSkippedRanges() failed: %v", err)
+	}
+
+	// A later rescan that checks a skipped height clears it
+	if err := store.UpdateSkippedRanges([]string{gappy}, HeightRange{850, 1000}, nil); err != nil {
+		t.Fatalf("UpdateSkippedRanges() failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		addresses []string
+		want      Confidence
+	}{
+		{"complete", []string{complete}, Confidence{Level: ConfidenceCached, AsOfHeight: 2000}},
+		{"partial", []string{complete, gappy}, Confidence{Level: ConfidencePartial, AsOfHeight: 1500, SkippedRanges: []HeightRange{{100, 110}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mgr.UTXOConfidence(tt.addresses); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("UTXOConfidence() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,568 @@
+package neutrino
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// Statuses of a transaction tracked for confirmations.
+const (
+	// TxStatusPending means the transaction has not been found in a block
+	// yet, or has fewer confirmations than requested.
+	TxStatusPending = "pending"
+
+	// TxStatusConfirmed means the transaction has at least the requested
+	// number of confirmations.
+	TxStatusConfirmed = "confirmed"
+
+	// TxStatusReorged means the block that confirmed the transaction left the
+	// best chain. The transaction is searched for again from that height.
+	TxStatusReorged = "reorged"
+)
+
+const (
+	// maxTrackedTxs bounds the transactions tracked at once.
+	maxTrackedTxs = 1000
+
+	// maxTrackConfirmations bounds the requested confirmation count.
+	maxTrackConfirmations = 1000
+
+	// maxTrackInputs bounds the inputs given for a tracked transaction.
+	maxTrackInputs = 1000
+
+	// defaultTrackLookback is how many blocks below the tip the search for a
+	// tracked transaction starts when no start height is given.
+	defaultTrackLookback = 144
+
+	// trackCheckInterval is how often tracked transactions are updated.
+	trackCheckInterval = 15 * time.Second
+
+	// searchCheckpointInterval is how many heights a long search for a
+	// transaction or spend scans between persisting its progress.
+	searchCheckpointInterval = 1000
+)
+
+// TrackedTx is a transaction tracked until it reaches a number of
+// confirmations.
+type TrackedTx struct {
+	TxID string `json:"txid"`
+
+	// Address is the hint used to find the transaction: it must be paid by
+	// one of the transaction's outputs.
+	Address string `json:"address"`
+
+	// Inputs lists the "txid:vout" outpoints the transaction spends, if
+	// they were given. A subscribed outpoint among them that is spent by
+	// another transaction is reported as a double spend.
+	Inputs []string `json:"inputs,omitempty"`
+
+	TargetConfirmations int32  `json:"target_confirmations"`
+	Status              string `json:"status"`
+	Confirmations       int32  `json:"confirmations"`
+
+	// BlockHash and BlockHeight identify the confirming block once found.
+	BlockHash   string `json:"block_hash,omitempty"`
+	BlockHeight int32  `json:"block_height,omitempty"`
+
+	// ScannedHeight is the height through which blocks have been searched
+	// for the transaction.
+	ScannedHeight int32 `json:"scanned_height"`
+
+	CreatedAt int64 `json:"created_at"`
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+// updatedSince reports whether a check changed t from before.
+func (t *TrackedTx) updatedSince(before TrackedTx) bool {
+	return t.Status != before.Status || t.Confirmations != before.Confirmations ||
+		t.BlockHash != before.BlockHash || t.BlockHeight != before.BlockHeight ||
+		t.ScannedHeight != before.ScannedHeight
+}
+
+// confirm records that the transaction was found in the block with hash at
+// height.
+func (t *TrackedTx) confirm(hash string, height int32) {
+	t.BlockHash = hash
+	t.BlockHeight = height
+	t.ScannedHeight = height
+}
+
+// refresh updates the confirmations and status of t for a chain whose tip is
+// at tip, where hashAt returns the best chain hash at a height. It reports
+// whether the status changed.
+func (t *TrackedTx) refresh(tip int32, hashAt func(height int32) (string, error)) (bool, error) {
+	previous := t.Status
+
+	if t.BlockHash != "" {
+		if t.BlockHeight > tip {
+			t.reorg()
+		} else {
+			hash, err := hashAt(t.BlockHeight)
+			if err != nil {
+				return false, err
+			}
+			if hash != t.BlockHash {
+				t.reorg()
+			}
+		}
+	}
+
+	if t.BlockHash != "" {
+		t.Confirmations = tip - t.BlockHeight + 1
+		t.Status = TxStatusPending
+		if t.Confirmations >= t.TargetConfirmations {
+			t.Status = TxStatusConfirmed
+		}
+	}
+
+	return t.Status != previous, nil
+}
+
+// reorg forgets the confirming block and rewinds the search to just below
+// it.
+func (t *TrackedTx) reorg() {
+	t.ScannedHeight = min(t.ScannedHeight, t.BlockHeight-1)
+	t.BlockHash = ""
+	t.BlockHeight = 0
+	t.Confirmations = 0
+	t.Status = TxStatusReorged
+}
+
+// confirmationTracker holds the transactions tracked for confirmations.
+type confirmationTracker struct {
+	mu  sync.Mutex
+	txs map[string]TrackedTx
+
+	// checking holds the transactions being updated, which happens from
+	// the tracking loop and right after a transaction is tracked, so each
+	// is updated by one check at a time.
+	checking map[string]bool
+}
+
+// claim marks txid as being checked, reporting false if another check of it
+// is already running.
+func (c *confirmationTracker) claim(txid string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.checking[txid] {
+		return false
+	}
+	c.checking[txid] = true
+	return true
+}
+
+// release ends the check of txid.
+func (c *confirmationTracker) release(txid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.checking, txid)
+}
+
+// restoreTrackedTxs loads tracked transactions from the store.
+func (n *Node) restoreTrackedTxs() error {
+	n.tracker = &confirmationTracker{
+		txs:      make(map[string]TrackedTx),
+		checking: make(map[string]bool),
+	}
+	if n.store == nil {
+		return nil
+	}
+
+	tracked, err := n.store.TrackedTxs()
+	if err != nil {
+		return fmt.Errorf("failed to load tracked transactions: %w", err)
+	}
+	n.tracker.txs = tracked
+	return nil
+}
+
+// TrackTransaction starts tracking txid until it has confirmations
+// confirmations (1 if zero). The transaction is searched for from
+// startHeight, or defaultTrackLookback blocks below the tip if negative, in
+// the blocks whose filters match address. inputs optionally lists the
+// "txid:vout" outpoints the transaction spends, for double spends of them to
+// be reported. Tracking a tracked transaction again updates its target, and
+// its inputs if given.
+func (n *Node) TrackTransaction(txid, address string, inputs []string, confirmations, startHeight int32) (*TrackedTx, error) {
+	if n.chainService == nil || n.tracker == nil {
+		return nil, errors.New("chain service not initialized")
+	}
+
+	hash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		return nil, NewBadRequestError(fmt.Sprintf("invalid txid: %v", err))
+	}
+	if _, err := btcutil.DecodeAddress(address, n.chainParams); err != nil {
+		return nil, NewBadRequestError(fmt.Sprintf("invalid address %s: %v", address, err))
+	}
+	if confirmations == 0 {
+		confirmations = 1
+	}
+	if confirmations < 0 || confirmations > maxTrackConfirmations {
+		return nil, NewBadRequestError(fmt.Sprintf("confirmations must be between 1 and %d", maxTrackConfirmations))
+	}
+	if len(inputs) > maxTrackInputs {
+		return nil, NewBadRequestError(fmt.Sprintf("too many inputs (max %d)", maxTrackInputs))
+	}
+	outpoints := make([]string, 0, len(inputs))
+	for _, input := range inputs {
+		outpoint, err := wire.NewOutPointFromString(input)
+		if err != nil {
+			return nil, NewBadRequestError(fmt.Sprintf("invalid input %q: %v", input, err))
+		}
+		outpoints = append(outpoints, outpoint.String())
+	}
+
+	bestBlock, err := n.chainService.BestBlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get best block: %w", err)
+	}
+	if startHeight < 0 {
+		startHeight = max(0, bestBlock.Height-defaultTrackLookback)
+	}
+	if startHeight > bestBlock.Height+1 {
+		return nil, NewBadRequestError(fmt.Sprintf("start_height %d is above the tip %d", startHeight, bestBlock.Height))
+	}
+
+	now := time.Now().Unix()
+	n.tracker.mu.Lock()
+	tracked, exists := n.tracker.txs[hash.String()]
+	if !exists {
+		if len(n.tracker.txs) >= maxTrackedTxs {
+			n.tracker.mu.Unlock()
+			return nil, NewBadRequestError(fmt.Sprintf("too many tracked transactions (max %d)", maxTrackedTxs))
+		}
+		tracked = TrackedTx{
+			TxID:          hash.String(),
+			Address:       address,
+			Status:        TxStatusPending,
+			ScannedHeight: startHeight - 1,
+			CreatedAt:     now,
+		}
+	}
+	tracked.TargetConfirmations = confirmations
+	if len(outpoints) > 0 {
+		tracked.Inputs = outpoints
+	}
+	tracked.UpdatedAt = now
+	n.tracker.txs[tracked.TxID] = tracked
+	n.tracker.mu.Unlock()
+
+	if n.store != nil {
+		if err := n.store.PutTrackedTx(tracked); err != nil {
+			return nil, fmt.Errorf("failed to persist tracked transaction: %w", err)
+		}
+	}
+
+	go n.checkTrackedTx(n.lifetime, tracked.TxID)
+	return &tracked, nil
+}
+
+// TrackedTransaction returns the tracking state of txid.
+func (n *Node) TrackedTransaction(txid string) (*TrackedTx, error) {
+	if n.tracker == nil {
+		return nil, errors.New("chain service not initialized")
+	}
+
+	hash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		return nil, NewBadRequestError(fmt.Sprintf("invalid txid: %v", err))
+	}
+
+	n.tracker.mu.Lock()
+	defer n.tracker.mu.Unlock()
+	tracked, ok := n.tracker.txs[hash.String()]
+	if !ok {
+		return nil, NewNotFoundError("transaction", fmt.Sprintf("transaction %s is not tracked", txid))
+	}
+	return &tracked, nil
+}
+
+// UntrackTransaction stops tracking txid.
+func (n *Node) UntrackTransaction(txid string) error {
+	if n.tracker == nil {
+		return errors.New("chain service not initialized")
+	}
+
+	hash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		return NewBadRequestError(fmt.Sprintf("invalid txid: %v", err))
+	}
+
+	n.tracker.mu.Lock()
+	defer n.tracker.mu.Unlock()
+	if _, ok := n.tracker.txs[hash.String()]; !ok {
+		return NewNotFoundError("transaction", fmt.Sprintf("transaction %s is not tracked", txid))
+	}
+	if n.store != nil {
+		if err := n.store.DeleteTrackedTx(hash.String()); err != nil {
+			return fmt.Errorf("failed to delete tracked transaction: %w", err)
+		}
+	}
+	delete(n.tracker.txs, hash.String())
+	return nil
+}
+
+// trackConfirmations periodically updates every tracked transaction.
+func (n *Node) trackConfirmations() {
+	ticker := time.NewTicker(trackCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		n.tracker.mu.Lock()
+		txids := make([]string, 0, len(n.tracker.txs))
+		for txid := range n.tracker.txs {
+			txids = append(txids, txid)
+		}
+		n.tracker.mu.Unlock()
+
+		for _, txid := range txids {
+			n.checkTrackedTx(n.lifetime, txid)
+		}
+
+		select {
+		case <-n.lifetime.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkTrackedTx searches for txid until ctx is done if it has not been
+// found, updates its confirmations and persists it. A status change is
+// delivered to tx_status webhooks.
+func (n *Node) checkTrackedTx(ctx context.Context, txid string) {
+	if !n.tracker.claim(txid) {
+		return
+	}
+	defer n.tracker.release(txid)
+
+	n.tracker.mu.Lock()
+	tracked, ok := n.tracker.txs[txid]
+	n.tracker.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	blockHeight, filterHeight, err := n.scanTip()
+	if err != nil {
+		n.logger.Warnf("Failed to get the chain tip for tracked transactions: %v", err)
+		return
+	}
+
+	before := tracked
+	statusChanged, err := tracked.refresh(blockHeight, n.blockHashAt)
+	if err != nil {
+		n.logger.Debugf("Failed to refresh tracked transaction %s: %v", logging.KV("txid", txid), err)
+		return
+	}
+	if tracked.Status == TxStatusReorged {
+		n.logger.Warnf("Tracked transaction %s left the best chain in a reorg", logging.KV("txid", txid))
+	}
+
+	if tracked.BlockHash == "" {
+		endHeight, err := scanEnd(tracked.ScannedHeight+1, 0, blockHeight, filterHeight)
+		if err == nil {
+			err = n.findTrackedTx(ctx, &tracked, endHeight)
+		}
+		if err != nil {
+			n.logger.Debugf("Failed to search for tracked transaction %s: %v", logging.KV("txid", txid), err)
+		}
+		if tracked.BlockHash != "" {
+			changed, err := tracked.refresh(blockHeight, n.blockHashAt)
+			if err != nil {
+				n.logger.Debugf("Failed to refresh tracked transaction %s: %v", logging.KV("txid", txid), err)
+				return
+			}
+			statusChanged = statusChanged || changed
+		}
+	}
+
+	if !tracked.updatedSince(before) {
+		return
+	}
+	tracked.UpdatedAt = time.Now().Unix()
+
+	n.tracker.mu.Lock()
+	if _, ok := n.tracker.txs[txid]; !ok {
+		// Untracked while it was being checked
+		n.tracker.mu.Unlock()
+		return
+	}
+	n.tracker.txs[txid] = tracked
+	n.tracker.mu.Unlock()
+
+	if n.store != nil {
+		if err := n.store.PutTrackedTx(tracked); err != nil {
+			n.logger.Warnf("Failed to persist tracked transaction %s: %v", logging.KV("txid", txid), err)
+		}
+	}
+	if statusChanged {
+		n.logger.Infof("Tracked transaction %s is %s with %d confirmations", logging.KV("txid", txid), tracked.Status, tracked.Confirmations)
+		if n.webhooks != nil {
+			n.webhooks.Dispatch(WebhookTxStatus, "", tracked)
+		}
+	}
+}
+
+// findTrackedTx searches the blocks above tracked.ScannedHeight through tip
+// whose filters match the address hint, until ctx is done. The search stops
+// at the first block whose filter or block cannot be fetched, so it is
+// retried on the next check.
+func (n *Node) findTrackedTx(ctx context.Context, tracked *TrackedTx, tip int32) error {
+	addr, err := btcutil.DecodeAddress(tracked.Address, n.chainParams)
+	if err != nil {
+		return err
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return err
+	}
+
+	checkpoint := func() { n.saveTrackedProgress(tracked.TxID, tracked.ScannedHeight) }
+	blockHash, height, err := n.findTx(ctx, tracked.TxID, pkScript, &tracked.ScannedHeight, tip, checkpoint)
+	if blockHash != "" {
+		tracked.confirm(blockHash, height)
+	}
+	return err
+}
+
+// findTx searches the blocks above *scanned through tip whose filters match
+// pkScript for txid, advancing *scanned past each block checked, and returns
+// the hash and height of the block containing it. The hash is empty if the
+// transaction was not found. checkpoint, if not nil, is called as *scanned
+// advances so long searches can persist their progress.
+func (n *Node) findTx(ctx context.Context, txid string, pkScript []byte, scanned *int32, tip int32, checkpoint func()) (string, int32, error) {
+	// The index already knows transactions touching watched addresses
+	if n.store != nil {
+		indexed, found, err := n.store.Transaction(txid)
+		if err == nil && found && indexed.BlockHeight > *scanned {
+			hash, err := n.blockHashAt(indexed.BlockHeight)
+			if err == nil && hash == indexed.BlockHash {
+				*scanned = indexed.BlockHeight
+				return indexed.BlockHash, indexed.BlockHeight, nil
+			}
+		}
+	}
+
+	txHash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var blockHash string
+	var height int32
+	found := func(h int32, block *btcutil.Block) bool {
+		for _, tx := range block.Transactions() {
+			if tx.Hash().IsEqual(txHash) {
+				blockHash, height = block.Hash().String(), h
+				return true
+			}
+		}
+		return false
+	}
+	err = searchBlocks(ctx, scanned, tip, n.config.ScanWorkers, n.blockMatching([][]byte{pkScript}), found, checkpoint)
+	return blockHash, height, err
+}
+
+// blockMatcher returns the block at height if its filter matches the
+// scripts searched for, nil if it does not, or an error if the filter or the
+// block cannot be fetched.
+type blockMatcher func(ctx context.Context, height int32) (*btcutil.Block, error)
+
+// blockMatching returns a blockMatcher for the blocks whose filters match
+// any of scripts.
+func (n *Node) blockMatching(scripts [][]byte) blockMatcher {
+	return func(ctx context.Context, height int32) (*btcutil.Block, error) {
+		var skips skipTracker
+		blockHash, matched := n.matchFilter(ctx, height, scripts, &skips)
+		if len(skips.ranges(height, height)) > 0 {
+			return nil, fmt.Errorf("filter at height %d unavailable", height)
+		}
+		if !matched {
+			return nil, nil
+		}
+
+		block, err := fetchBlock(ctx, n.rescanMgr.blocks, *blockHash, height)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get block %s: %w", blockHash, err)
+		}
+		return block, nil
+	}
+}
+
+// searchBlocks scans the blocks above *scanned through tip with workers
+// concurrent fetches, passing each matching block to found in height order
+// until found reports a hit. *scanned advances past each block checked, and
+// checkpoint, if not nil, is called every searchCheckpointInterval heights.
+// The search stops at the first block that cannot be checked and returns its
+// error, so it resumes from that block.
+func searchBlocks(ctx context.Context, scanned *int32, tip int32, workers int, match blockMatcher, found func(height int32, block *btcutil.Block) bool, checkpoint func()) error {
+	// Each height is written by exactly one worker and read once applied
+	var failures sync.Map
+	fetch := func(height int32) *btcutil.Block {
+		block, err := match(ctx, height)
+		if err != nil {
+			failures.Store(height, err)
+			return nil
+		}
+		return block
+	}
+
+	lastCheckpoint := *scanned
+	apply := func(height int32, block *btcutil.Block) error {
+		if err, failed := failures.LoadAndDelete(height); failed {
+			return err.(error)
+		}
+		*scanned = height
+		if block != nil && found(height, block) {
+			return errStopScan
+		}
+		if checkpoint != nil && height-lastCheckpoint >= searchCheckpointInterval {
+			checkpoint()
+			lastCheckpoint = height
+		}
+		return nil
+	}
+	return scanRange(ctx, *scanned+1, tip, workers, fetch, apply)
+}
+
+// saveTrackedProgress persists that the search for the tracked transaction
+// txid has scanned through scanned, unless it has been untracked or found
+// meanwhile.
+func (n *Node) saveTrackedProgress(txid string, scanned int32) {
+	n.tracker.mu.Lock()
+	tracked, ok := n.tracker.txs[txid]
+	if !ok || tracked.BlockHash != "" || tracked.ScannedHeight >= scanned {
+		n.tracker.mu.Unlock()
+		return
+	}
+	tracked.ScannedHeight = scanned
+	n.tracker.txs[txid] = tracked
+	n.tracker.mu.Unlock()
+
+	if n.store != nil {
+		if err := n.store.PutTrackedTx(tracked); err != nil {
+			n.logger.Warnf("Failed to persist tracked transaction %s: %v", logging.KV("txid", txid), err)
+		}
+	}
+}
+
+// blockHashAt returns the best chain block hash at height.
+func (n *Node) blockHashAt(height int32) (string, error) {
+	hash, err := n.chainService.GetBlockHash(int64(height))
+	if err != nil {
+		return "", err
+	}
+	return hash.String(), nil
+}
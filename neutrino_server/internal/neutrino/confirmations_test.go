@@ -0,0 +1,214 @@
+package neutrino
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+func TestTrackedTxRefresh(t *testing.T) {
+	chain := map[int32]string{100: "aa", 101: "bb", 102: "cc"}
+	hashAt := func(height int32) (string, error) {
+		hash, ok := chain[height]
+		if !ok {
+			return "", errors.New("height not in chain")
+		}
+		return hash, nil
+	}
+
+	tests := []struct {
+		name              string
+		tracked           TrackedTx
+		tip               int32
+		wantStatus        string
+		wantConfirmations int32
+		wantScanned       int32
+		wantChanged       bool
+	}{
+		{
+			name:       "not found yet",
+			tracked:    TrackedTx{TargetConfirmations: 1, Status: TxStatusPending, ScannedHeight: 102},
+			tip:        102,
+			wantStatus: TxStatusPending, wantScanned: 102,
+		},
+		{
+			name:       "fewer confirmations than requested",
+			tracked:    TrackedTx{TargetConfirmations: 6, Status: TxStatusPending, BlockHash: "aa", BlockHeight: 100, ScannedHeight: 100},
+			tip:        102,
+			wantStatus: TxStatusPending, wantConfirmations: 3, wantScanned: 100,
+		},
+		{
+			name:       "confirmed",
+			tracked:    TrackedTx{TargetConfirmations: 3, Status: TxStatusPending, BlockHash: "aa", BlockHeight: 100, ScannedHeight: 100},
+			tip:        102,
+			wantStatus: TxStatusConfirmed, wantConfirmations: 3, wantScanned: 100, wantChanged: true,
+		},
+		{
+			name:       "confirming block replaced",
+			tracked:    TrackedTx{TargetConfirmations: 1, Status: TxStatusConfirmed, BlockHash: "b2", BlockHeight: 101, ScannedHeight: 101},
+			tip:        102,
+			wantStatus: TxStatusReorged, wantScanned: 100, wantChanged: true,
+		},
+		{
+			name:       "confirming block above the tip",
+			tracked:    TrackedTx{TargetConfirmations: 1, Status: TxStatusConfirmed, BlockHash: "dd", BlockHeight: 103, ScannedHeight: 103},
+			tip:        102,
+			wantStatus: TxStatusReorged, wantScanned: 102, wantChanged: true,
+		},
+		{
+			name:       "found again after a reorg",
+			tracked:    TrackedTx{TargetConfirmations: 1, Status: TxStatusReorged, BlockHash: "cc", BlockHeight: 102, ScannedHeight: 102},
+			tip:        102,
+			wantStatus: TxStatusConfirmed, wantConfirmations: 1, wantScanned: 102, wantChanged: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracked := tt.tracked
+			changed, err := tracked.refresh(tt.tip, hashAt)
+			if err != nil {
+				t.Fatalf("refresh() failed: %v", err)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("refresh() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if tracked.Status != tt.wantStatus || tracked.Confirmations != tt.wantConfirmations || tracked.ScannedHeight != tt.wantScanned {
+				t.Errorf("refresh() = %s with %d confirmations scanned to %d, want %s with %d scanned to %d",
+					tracked.Status, tracked.Confirmations, tracked.ScannedHeight,
+					tt.wantStatus, tt.wantConfirmations, tt.wantScanned)
+			}
+			if tracked.Status == TxStatusReorged && (tracked.BlockHash != "" || tracked.BlockHeight != 0) {
+				t.Errorf("reorged transaction kept block %s at %d", tracked.BlockHash, tracked.BlockHeight)
+			}
+		})
+	}
+}
+
+func TestStoreTrackedTxs(t *testing.T) {
+	store := newTestStore(t)
+
+	first := TrackedTx{TxID: "aa", Address: "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", TargetConfirmations: 6, Status: TxStatusPending, ScannedHeight: 99}
+	second := TrackedTx{TxID: "bb", Address: "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S", Inputs: []string{"dd:0"}, TargetConfirmations: 1, Status: TxStatusConfirmed, Confirmations: 2, BlockHash: "cc", BlockHeight: 100}
+	for _, tracked := range []TrackedTx{first, second} {
+		if err := store.PutTrackedTx(tracked); err != nil {
+			t.Fatalf("PutTrackedTx() failed: %v", err)
+		}
+	}
+	if err := store.DeleteTrackedTx("aa"); err != nil {
+		t.Fatalf("DeleteTrackedTx() failed: %v", err)
+	}
+
+	tracked, err := store.TrackedTxs()
+	if err != nil {
+		t.Fatalf("TrackedTxs() failed: %v", err)
+	}
+	if len(tracked) != 1 || !reflect.DeepEqual(tracked["bb"], second) {
+		t.Errorf("TrackedTxs() = %+v, want only %+v", tracked, second)
+	}
+}
+
+func TestSearchBlocks(t *testing.T) {
+	errFilter := errors.New("filter unavailable")
+
+	tests := []struct {
+		name        string
+		scanned     int32
+		tip         int32
+		matches     []int32
+		hit         int32
+		failAt      int32
+		wantFound   int32
+		wantScanned int32
+		wantErr     error
+		wantSaved   []int32
+	}{
+		{
+			name:    "found after a false positive",
+			scanned: 99, tip: 120, matches: []int32{105, 110, 115}, hit: 110,
+			wantFound: 110, wantScanned: 110,
+		},
+		{
+			name:    "not found through the tip",
+			scanned: 99, tip: 120, matches: []int32{105},
+			wantScanned: 120,
+		},
+		{
+			name:    "stops at a block that cannot be checked",
+			scanned: 99, tip: 120, matches: []int32{110}, hit: 110, failAt: 107,
+			wantScanned: 106, wantErr: errFilter,
+		},
+		{
+			name:    "nothing above the scanned height",
+			scanned: 120, tip: 120,
+			wantScanned: 120,
+		},
+		{
+			name:    "long search checkpoints its progress",
+			scanned: 0, tip: 2500,
+			wantScanned: 2500, wantSaved: []int32{1000, 2000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match := func(_ context.Context, height int32) (*btcutil.Block, error) {
+				if height == tt.failAt {
+					return nil, errFilter
+				}
+				if slices.Contains(tt.matches, height) {
+					return testBlock(height), nil
+				}
+				return nil, nil
+			}
+			var foundAt int32
+			found := func(height int32, block *btcutil.Block) bool {
+				if int32(block.MsgBlock().Header.Nonce) != height {
+					t.Errorf("found() got the block of height %d at %d", block.MsgBlock().Header.Nonce, height)
+				}
+				if height == tt.hit {
+					foundAt = height
+					return true
+				}
+				return false
+			}
+
+			scanned := tt.scanned
+			var saved []int32
+			checkpoint := func() { saved = append(saved, scanned) }
+
+			err := searchBlocks(context.Background(), &scanned, tt.tip, 4, match, found, checkpoint)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("searchBlocks() error = %v, want %v", err, tt.wantErr)
+			}
+			if foundAt != tt.wantFound || scanned != tt.wantScanned {
+				t.Errorf("searchBlocks() found at %d scanned to %d, want %d scanned to %d", foundAt, scanned, tt.wantFound, tt.wantScanned)
+			}
+			if !slices.Equal(saved, tt.wantSaved) {
+				t.Errorf("searchBlocks() checkpointed at %v, want %v", saved, tt.wantSaved)
+			}
+		})
+	}
+}
+
+func TestConfirmationTrackerClaim(t *testing.T) {
+	tracker := &confirmationTracker{txs: make(map[string]TrackedTx), checking: make(map[string]bool)}
+
+	if !tracker.claim("aa") {
+		t.Fatal("claim() of an idle transaction = false, want true")
+	}
+	if tracker.claim("aa") {
+		t.Error("claim() of a transaction being checked = true, want false")
+	}
+	if !tracker.claim("bb") {
+		t.Error("claim() of another transaction = false, want true")
+	}
+	tracker.release("aa")
+	if !tracker.claim("aa") {
+		t.Error("claim() after release() = false, want true")
+	}
+}
@@ -0,0 +1,271 @@
+package neutrino
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/wire"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// TxStatusConflicted means a block spent an input of a broadcast transaction
+// with another transaction, so the broadcast can no longer confirm unless
+// that block leaves the best chain.
+const TxStatusConflicted = "conflicted"
+
+// TxStatusExpired means a broadcast transaction stayed unconfirmed for
+// broadcastExpiry, so it is no longer rebroadcast or searched for.
+const TxStatusExpired = "expired"
+
+// DoubleSpend reports a transaction broadcast or tracked by the node whose
+// input was spent in a block by a different transaction.
+type DoubleSpend struct {
+	// Outpoint is the "txid:vout" key of the contested output.
+	Outpoint string `json:"outpoint"`
+
+	// TxID is the broadcast or tracked transaction that lost the outpoint.
+	TxID string `json:"txid"`
+
+	ConflictingTxID  string `json:"conflicting_txid"`
+	ConflictingInput uint32 `json:"conflicting_input"`
+	BlockHash        string `json:"block_hash"`
+	BlockHeight      int32  `json:"block_height"`
+
+	Time int64 `json:"time"`
+}
+
+// indexInputs records the outpoints spent by the broadcast txid. Callers must
+// hold mu.
+func (q *broadcastQueue) indexInputs(txid string, tx *wire.MsgTx) {
+	for _, txIn := range tx.TxIn {
+		key := txIn.PreviousOutPoint.String()
+		q.inputs[key] = append(q.inputs[key], txid)
+	}
+}
+
+// unindexInputs forgets the outpoints spent by the broadcast txid. Callers
+// must hold mu.
+func (q *broadcastQueue) unindexInputs(txid string) {
+	for key, txids := range q.inputs {
+		kept := txids[:0]
+		for _, spender := range txids {
+			if spender != txid {
+				kept = append(kept, spender)
+			}
+		}
+		if len(kept) == 0 {
+			delete(q.inputs, key)
+		} else {
+			q.inputs[key] = kept
+		}
+	}
+}
+
+// findDoubleSpends returns the queued broadcasts that lose an input to
+// another transaction spending the outpoint with key at input of
+// spendingTxID.
+func (q *broadcastQueue) findDoubleSpends(key, spendingTxID string, input uint32) []DoubleSpend {
+	var found []DoubleSpend
+	for _, txid := range q.inputs[key] {
+		if txid == spendingTxID {
+			continue
+		}
+		broadcast, ok := q.txs[txid]
+		if !ok || broadcast.ConflictingTxID == spendingTxID {
+			continue
+		}
+		found = append(found, DoubleSpend{
+			Outpoint:         key,
+			TxID:             txid,
+			ConflictingTxID:  spendingTxID,
+			ConflictingInput: input,
+		})
+	}
+	return found
+}
+
+// ObserveDoubleSpends checks the inputs of a block that has already been
+// fetched against the outpoints spent by queued broadcasts.
+func (n *Node) ObserveDoubleSpends(height int32, block *btcutil.Block) {
+	n.broadcasts.mu.Lock()
+	if len(n.broadcasts.inputs) == 0 {
+		n.broadcasts.mu.Unlock()
+		return
+	}
+	var found []DoubleSpend
+	for _, tx := range block.Transactions() {
+		txHash := tx.Hash().String()
+		for inputIdx, txIn := range tx.MsgTx().TxIn {
+			found = append(found, n.broadcasts.findDoubleSpends(txIn.PreviousOutPoint.String(), txHash, uint32(inputIdx))...)
+		}
+	}
+	n.broadcasts.mu.Unlock()
+	if len(found) == 0 {
+		return
+	}
+
+	blockHash := block.Hash().String()
+	for i := range found {
+		found[i].BlockHash = blockHash
+		found[i].BlockHeight = height
+	}
+	// Observers must not block, and recording persists the broadcasts
+	go n.recordDoubleSpends(found)
+}
+
+// checkSpendConflict checks the spend found for a subscribed outpoint
+// against the outpoints spent by queued broadcasts and tracked transactions.
+func (n *Node) checkSpendConflict(sub SpendSubscription) {
+	var found, tracked []DoubleSpend
+	if n.broadcasts != nil {
+		n.broadcasts.mu.Lock()
+		found = n.broadcasts.findDoubleSpends(sub.Outpoint(), sub.SpendingTxID, sub.SpendingInput)
+		n.broadcasts.mu.Unlock()
+	}
+	if n.tracker != nil {
+		n.tracker.mu.Lock()
+		tracked = n.tracker.findDoubleSpends(sub.Outpoint(), sub.SpendingTxID, sub.SpendingInput)
+		n.tracker.mu.Unlock()
+	}
+	if len(found) == 0 && len(tracked) == 0 {
+		return
+	}
+
+	blockHash := sub.SpendingBlockHash
+	if blockHash == "" {
+		var err error
+		if blockHash, err = n.blockHashAt(sub.SpendingHeight); err != nil {
+			n.logger.Warnf("Failed to get block %d of the spend of %s: %v", logging.KV("height", sub.SpendingHeight), sub.Outpoint(), err)
+			return
+		}
+	}
+	for _, doubleSpends := range [][]DoubleSpend{found, tracked} {
+		for i := range doubleSpends {
+			doubleSpends[i].BlockHash = blockHash
+			doubleSpends[i].BlockHeight = sub.SpendingHeight
+		}
+	}
+	if len(found) > 0 {
+		go n.recordDoubleSpends(found)
+	}
+	now := time.Now().Unix()
+	for _, doubleSpend := range tracked {
+		n.reportDoubleSpend(doubleSpend, now)
+	}
+}
+
+// findDoubleSpends returns the tracked transactions that lose an input to
+// another transaction spending the outpoint with key at input of
+// spendingTxID. Callers must hold mu.
+func (c *confirmationTracker) findDoubleSpends(key, spendingTxID string, input uint32) []DoubleSpend {
+	var found []DoubleSpend
+	for txid, tracked := range c.txs {
+		if txid == spendingTxID || !slices.Contains(tracked.Inputs, key) {
+			continue
+		}
+		found = append(found, DoubleSpend{
+			Outpoint:         key,
+			TxID:             txid,
+			ConflictingTxID:  spendingTxID,
+			ConflictingInput: input,
+		})
+	}
+	return found
+}
+
+// recordDoubleSpends marks the broadcasts that lost an input as conflicted,
+// which stops their rebroadcasts, and reports each double spend to every
+// wallet's event stream and to double spend webhooks.
+func (n *Node) recordDoubleSpends(found []DoubleSpend) {
+	now := time.Now().Unix()
+	for _, doubleSpend := range found {
+		n.broadcasts.checkMu.Lock()
+		n.broadcasts.mu.Lock()
+		broadcast, ok := n.broadcasts.txs[doubleSpend.TxID]
+		if !ok || broadcast.ConflictingTxID == doubleSpend.ConflictingTxID {
+			n.broadcasts.mu.Unlock()
+			n.broadcasts.checkMu.Unlock()
+			continue
+		}
+		broadcast.conflict(doubleSpend)
+		broadcast.UpdatedAt = now
+		broadcast = n.broadcasts.put(broadcast)
+		n.broadcasts.mu.Unlock()
+
+		if n.store != nil {
+			if err := n.store.PutBroadcast(broadcast); err != nil {
+				n.logger.Warnf("Failed to persist broadcast %s: %v", doubleSpend.TxID, err)
+			}
+		}
+		n.broadcasts.checkMu.Unlock()
+
+		n.reportDoubleSpend(doubleSpend, now)
+	}
+}
+
+// reportDoubleSpend reports doubleSpend, found at now, to every wallet's
+// event stream and to double spend webhooks.
+func (n *Node) reportDoubleSpend(doubleSpend DoubleSpend, now int64) {
+	n.logger.Warnf("Double spend: input %s of transaction %s spent by %s at height %d",
+		doubleSpend.Outpoint, logging.KV("txid", doubleSpend.TxID), doubleSpend.ConflictingTxID, logging.KV("height", doubleSpend.BlockHeight))
+	doubleSpend.Time = now
+	if n.rescanMgr != nil {
+		n.rescanMgr.emitToAllWallets(EventDoubleSpend, doubleSpend)
+	}
+	if n.webhooks != nil {
+		n.webhooks.Dispatch(WebhookDoubleSpend, "", doubleSpend)
+	}
+}
+
+// conflict records that doubleSpend took an input of b.
+func (b *BroadcastTx) conflict(doubleSpend DoubleSpend) {
+	b.Status = TxStatusConflicted
+	b.BlockHash = ""
+	b.BlockHeight = 0
+	b.ConflictingTxID = doubleSpend.ConflictingTxID
+	b.ConflictBlockHash = doubleSpend.BlockHash
+	b.ConflictHeight = doubleSpend.BlockHeight
+}
+
+// refreshConflict checks that the block holding the conflicting transaction
+// of a conflicted broadcast is still in the best chain ending at tip. If it
+// is not, the broadcast is pending again and rebroadcast right away. It
+// reports whether broadcast changed.
+func (n *Node) refreshConflict(broadcast *BroadcastTx, tip int32) bool {
+	hash, err := n.blockHashAt(broadcast.ConflictHeight)
+	if err != nil && broadcast.ConflictHeight <= tip {
+		n.logger.Debugf("Failed to check the conflict of broadcast %s: %v", broadcast.TxID, err)
+		return false
+	}
+	if hash == broadcast.ConflictBlockHash {
+		return false
+	}
+
+	n.logger.Warnf("Transaction %s conflicting with broadcast %s left the best chain in a reorg, rebroadcasting",
+		logging.KV("txid", broadcast.ConflictingTxID), broadcast.TxID)
+	broadcast.ScannedHeight = min(broadcast.ScannedHeight, broadcast.ConflictHeight-1)
+	broadcast.Status = TxStatusPending
+	broadcast.ConflictingTxID = ""
+	broadcast.ConflictBlockHash = ""
+	broadcast.ConflictHeight = 0
+	broadcast.LastBroadcastAt = 0
+	return true
+}
+
+// decodeRawTx decodes a hex serialized transaction.
+func decodeRawTx(rawTx string) (*wire.MsgTx, error) {
+	raw, err := hex.DecodeString(rawTx)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction hex: %w", err)
+	}
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("failed to decode transaction: %w", err)
+	}
+	return &tx, nil
+}
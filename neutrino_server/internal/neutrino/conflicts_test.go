@@ -0,0 +1,115 @@
+package neutrino
+
+import (
+	"bytes"
+	"encoding/hex"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+)
+
+func TestDoubleSpends(t *testing.T) {
+	contested := wire.OutPoint{Hash: chainhash.Hash{1}, Index: 0}
+	other := wire.OutPoint{Hash: chainhash.Hash{2}, Index: 1}
+
+	ours := wire.NewMsgTx(2)
+	ours.AddTxIn(wire.NewTxIn(&contested, nil, nil))
+	ours.AddTxOut(wire.NewTxOut(1000, []byte{0x51}))
+	var raw bytes.Buffer
+	if err := ours.Serialize(&raw); err != nil {
+		t.Fatal(err)
+	}
+	txid := ours.TxHash().String()
+
+	n := &Node{
+		logger: btclog.Disabled,
+		broadcasts: &broadcastQueue{
+			txs: map[string]BroadcastTx{
+				txid: {TxID: txid, RawTx: hex.EncodeToString(raw.Bytes()), Status: TxStatusPending},
+			},
+			inputs: make(map[string][]string),
+		},
+	}
+	n.broadcasts.indexInputs(txid, ours)
+
+	// A block confirming our own transaction is not a double spend
+	if found := n.broadcasts.findDoubleSpends(contested.String(), txid, 0); len(found) != 0 {
+		t.Errorf("findDoubleSpends() for our own spend = %+v", found)
+	}
+
+	theirs := wire.NewMsgTx(2)
+	theirs.AddTxIn(wire.NewTxIn(&other, nil, nil))
+	theirs.AddTxIn(wire.NewTxIn(&contested, nil, nil))
+	theirs.AddTxOut(wire.NewTxOut(900, []byte{0x52}))
+	block := btcutil.NewBlock(&wire.MsgBlock{Transactions: []*wire.MsgTx{theirs}})
+
+	found := n.broadcasts.findDoubleSpends(contested.String(), theirs.TxHash().String(), 1)
+	if len(found) != 1 {
+		t.Fatalf("findDoubleSpends() = %+v, want one double spend", found)
+	}
+	if found[0].TxID != txid || found[0].ConflictingTxID != theirs.TxHash().String() || found[0].ConflictingInput != 1 {
+		t.Errorf("findDoubleSpends() = %+v", found[0])
+	}
+
+	found[0].BlockHash, found[0].BlockHeight = block.Hash().String(), 100
+	n.recordDoubleSpends(found)
+	broadcast := n.broadcasts.txs[txid]
+	if broadcast.Status != TxStatusConflicted || broadcast.ConflictingTxID != theirs.TxHash().String() || broadcast.ConflictHeight != 100 {
+		t.Errorf("broadcast after a double spend = %+v", broadcast)
+	}
+	if broadcast.dueForRebroadcast(time.Now().Unix() + int64(rebroadcastInterval.Seconds())) {
+		t.Error("conflicted broadcast is still due for rebroadcast")
+	}
+	if status := broadcast.status(100); status.Status != TxStatusConflicted || status.ConflictingTxID != theirs.TxHash().String() {
+		t.Errorf("status() = %+v", status)
+	}
+
+	// The same conflict is reported once
+	if found := n.broadcasts.findDoubleSpends(contested.String(), theirs.TxHash().String(), 1); len(found) != 0 {
+		t.Errorf("findDoubleSpends() after recording = %+v", found)
+	}
+
+	// An evicted broadcast no longer has its inputs watched
+	n.broadcasts.unindexInputs(txid)
+	if len(n.broadcasts.inputs) != 0 {
+		t.Errorf("inputs after unindexing = %v", n.broadcasts.inputs)
+	}
+}
+
+func TestTrackedDoubleSpends(t *testing.T) {
+	contested := wire.OutPoint{Hash: chainhash.Hash{1}, Index: 0}
+	tracker := &confirmationTracker{txs: map[string]TrackedTx{
+		"aa": {TxID: "aa", Inputs: []string{contested.String()}},
+		"bb": {TxID: "bb"},
+	}}
+
+	tests := []struct {
+		name         string
+		key          string
+		spendingTxID string
+		want         []string
+	}{
+		{"spent by the tracked transaction", contested.String(), "aa", nil},
+		{"spent by another transaction", contested.String(), "cc", []string{"aa"}},
+		{"outpoint no tracked transaction spends", wire.OutPoint{Hash: chainhash.Hash{2}}.String(), "cc", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, doubleSpend := range tracker.findDoubleSpends(tt.key, tt.spendingTxID, 1) {
+				if doubleSpend.Outpoint != tt.key || doubleSpend.ConflictingTxID != tt.spendingTxID || doubleSpend.ConflictingInput != 1 {
+					t.Errorf("findDoubleSpends() = %+v", doubleSpend)
+				}
+				got = append(got, doubleSpend.TxID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("findDoubleSpends() lost transactions %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
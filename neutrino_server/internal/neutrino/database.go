@@ -0,0 +1,209 @@
+package neutrino
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/btcsuite/btcwallet/walletdb"
+	_ "github.com/btcsuite/btcwallet/walletdb/bdb" // Import bbolt driver
+
+	_ "github.com/yourusername/neutrino-api/neutrino_server/internal/sqlitedb" // Import SQLite driver
+)
+
+// Database backends, see Config.DBBackend. DBBackendMemory keeps a bbolt
+// database and the header files in a temporary directory in memory, see
+// useMemoryDataDir.
+const (
+	DBBackendBolt   = "bdb"
+	DBBackendSQLite = "sqlite"
+	DBBackendMemory = "memory"
+)
+
+// SQLite journal modes, see Config.SQLiteJournalMode. The write-ahead log
+// lets reads run alongside writes, but needs memory shared through a file
+// next to the database, which network file systems cannot map reliably; the
+// rollback journal works everywhere, but a write waits for reads to finish.
+const (
+	SQLiteJournalWAL    = "wal"
+	SQLiteJournalDelete = "delete"
+)
+
+// dbFiles are the database files of the backends in the data directory.
+var dbFiles = map[string]string{
+	DBBackendBolt:   "neutrino.db",
+	DBBackendSQLite: "neutrino.sqlite",
+	DBBackendMemory: "neutrino.db",
+}
+
+// memoryFS is the memory-backed file system the memory backend keeps its
+// data directory in, where there is one.
+const memoryFS = "/dev/shm"
+
+// migratedSuffix is appended to the bbolt database once it is migrated to
+// SQLite. The file is kept, so that a migration can be undone by hand.
+const migratedSuffix = ".migrated"
+
+// detectDBBackend returns the backend of the database in dataDir, bbolt if
+// there is none yet. The subcommands working on the data directory of a
+// stopped node use it, so that they need not be told the backend.
+func detectDBBackend(dataDir string) string {
+	if _, err := os.Stat(filepath.Join(dataDir, dbFiles[DBBackendSQLite])); err == nil {
+		return DBBackendSQLite
+	}
+	return DBBackendBolt
+}
+
+// openDB opens the database of backend at path, creating it first unless it
+// must exist, and waits up to timeout for another process to release it. A
+// SQLite database is switched to journalMode unless it is empty.
+func openDB(backend, path string, create bool, journalMode string, timeout time.Duration) (walletdb.DB, error) {
+	open := walletdb.Open
+	if create {
+		open = walletdb.Create
+	}
+	switch backend {
+	case DBBackendSQLite:
+		return open(backend, path, timeout, journalMode)
+	case DBBackendMemory:
+		backend = DBBackendBolt
+	}
+	return open(backend, path, true, timeout)
+}
+
+// removeDBFiles removes the database at path along with the lock and journal
+// files SQLite keeps next to it.
+func removeDBFiles(path string) {
+	for _, suffix := range []string{"", ".lock", "-wal", "-shm", "-journal"} {
+		os.Remove(path + suffix)
+	}
+}
+
+// staleMemoryDirAge is how old a memory data directory without a database
+// must be to be removed as stale, so the directory of a node still starting
+// is left alone.
+const staleMemoryDirAge = time.Minute
+
+// useMemoryDataDir moves the node's data to a new temporary directory in
+// memory, or in the system's temporary directory where there is no memory
+// file system, which Stop removes. The directories of nodes that exited
+// without stopping are removed first. Backups still default to the
+// configured data directory.
+func (n *Node) useMemoryDataDir() error {
+	parent := memoryFS
+	if info, err := os.Stat(parent); err != nil || !info.IsDir() {
+		parent = os.TempDir()
+		n.logger.Warnf("No memory file system at %s, the memory database is kept on disk in %s", memoryFS, parent)
+	}
+	prefix := "neutrinod-" + n.config.Network + "-"
+	n.removeStaleMemoryDirs(parent, prefix)
+	dir, err := os.MkdirTemp(parent, prefix)
+	if err != nil {
+		return fmt.Errorf("failed to create the memory data directory: %w", err)
+	}
+	n.config.BackupDir = n.config.backupDir()
+	n.config.DataDir = dir
+	n.memoryDir = dir
+	n.logger.Infof("Keeping all data in %s, which is removed on stop", dir)
+	return nil
+}
+
+// removeStaleMemoryDirs removes the memory data directories in parent left
+// behind by nodes that exited without stopping: those whose database no
+// process holds open, or without a database once they are older than
+// staleMemoryDirAge.
+func (n *Node) removeStaleMemoryDirs(parent, prefix string) {
+	dirs, err := filepath.Glob(filepath.Join(parent, prefix+"*"))
+	if err != nil {
+		return
+	}
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		dbPath := filepath.Join(dir, dbFiles[DBBackendMemory])
+		if _, err := os.Stat(dbPath); err == nil {
+			// A running node holds its database's lock
+			db, err := openDB(DBBackendMemory, dbPath, false, "", 10*time.Millisecond)
+			if err != nil {
+				continue
+			}
+			db.Close()
+		} else if time.Since(info.ModTime()) < staleMemoryDirAge {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			n.logger.Warnf("Failed to remove stale memory data directory %s: %v", dir, err)
+			continue
+		}
+		n.logger.Infof("Removed stale memory data directory %s", dir)
+	}
+}
+
+// prepareDatabase readies the database of the configured backend before
+// Start opens it: it migrates a bbolt database to SQLite the first time the
+// node starts with the SQLite backend, and refuses to start a fresh bbolt
+// database next to a SQLite one.
+func (n *Node) prepareDatabase() error {
+	dataDir := n.config.DataDir
+	boltPath := filepath.Join(dataDir, dbFiles[DBBackendBolt])
+	sqlitePath := filepath.Join(dataDir, dbFiles[DBBackendSQLite])
+	_, boltErr := os.Stat(boltPath)
+	_, sqliteErr := os.Stat(sqlitePath)
+
+	switch {
+	case n.config.DBBackend == DBBackendBolt && errors.Is(boltErr, os.ErrNotExist) && sqliteErr == nil:
+		return fmt.Errorf("%s holds a SQLite database, select the sqlite database backend to use it", dataDir)
+	case n.config.DBBackend != DBBackendSQLite || sqliteErr == nil || boltErr != nil:
+		return nil
+	}
+
+	n.logger.Infof("Migrating database at %s to SQLite", boltPath)
+	start := time.Now()
+	if err := migrateToSQLite(dataDir); err != nil {
+		return err
+	}
+	n.logger.Infof("Migrated database to %s in %s, the bbolt database is kept as %s",
+		sqlitePath, time.Since(start).Round(time.Millisecond), boltPath+migratedSuffix)
+	return nil
+}
+
+// migrateToSQLite copies the bbolt database in dataDir into a new SQLite
+// database, then renames the bbolt database so that it is not migrated
+// again. The bbolt database is left untouched if the migration fails.
+func migrateToSQLite(dataDir string) error {
+	boltPath := filepath.Join(dataDir, dbFiles[DBBackendBolt])
+	sqlitePath := filepath.Join(dataDir, dbFiles[DBBackendSQLite])
+	src, err := openDB(DBBackendBolt, boltPath, false, "", headerDBTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to open database at %s (is neutrinod running?): %w", boltPath, err)
+	}
+	defer src.Close()
+
+	// The copy is written in rollback journal mode, so that it is complete
+	// in a single file once closed
+	tmpPath := sqlitePath + ".migrate"
+	removeDBFiles(tmpPath)
+	dst, err := openDB(DBBackendSQLite, tmpPath, true, SQLiteJournalDelete, headerDBTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmpPath, err)
+	}
+	err = compactDB(src, dst, compactTxMaxSize)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, sqlitePath)
+	}
+	removeDBFiles(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to migrate database to SQLite: %w", err)
+	}
+	if err := os.Rename(boltPath, boltPath+migratedSuffix); err != nil {
+		return fmt.Errorf("failed to rename the migrated database: %w", err)
+	}
+	return nil
+}
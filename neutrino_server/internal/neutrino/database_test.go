@@ -0,0 +1,199 @@
+package neutrino
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btclog"
+	"github.com/btcsuite/btcwallet/walletdb"
+)
+
+func TestPrepareDatabase(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	blocks := mineHeaders(t, params.GenesisBlock.Header, 5, 1)
+	filters := []chainhash.Hash{{1}, {2}, {3}}
+
+	tests := []struct {
+		name    string
+		backend string
+		files   []string // database files in the data directory
+		want    []string // database files after prepareDatabase
+		wantErr bool
+	}{
+		{name: "bbolt", backend: DBBackendBolt, files: []string{"neutrino.db"}, want: []string{"neutrino.db"}},
+		{name: "fresh sqlite", backend: DBBackendSQLite, want: nil},
+		{name: "migration", backend: DBBackendSQLite, files: []string{"neutrino.db"}, want: []string{"neutrino.db.migrated", "neutrino.sqlite"}},
+		{name: "migrated before", backend: DBBackendSQLite, files: []string{"neutrino.db", "neutrino.sqlite"}, want: []string{"neutrino.db", "neutrino.sqlite"}},
+		{name: "bbolt after migration", backend: DBBackendBolt, files: []string{"neutrino.sqlite"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for i, file := range tt.files {
+				backend := DBBackendBolt
+				if file == "neutrino.sqlite" {
+					backend = DBBackendSQLite
+				}
+				db, err := openDB(backend, filepath.Join(dir, file), true, "", headerDBTimeout)
+				if err != nil {
+					t.Fatal(err)
+				}
+				db.Close()
+				if i == 0 {
+					writeHeaderChains(t, dir, blocks, filters)
+				}
+			}
+			var want string
+			if len(tt.files) > 0 && tt.files[0] == "neutrino.db" {
+				db, err := openDB(DBBackendBolt, filepath.Join(dir, tt.files[0]), true, "", headerDBTimeout)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want = dumpDB(t, db)
+				db.Close()
+			}
+
+			n := &Node{config: &Config{DataDir: dir, DBBackend: tt.backend}, logger: btclog.Disabled}
+			err := n.prepareDatabase()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("prepareDatabase() succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("prepareDatabase() failed: %v", err)
+			}
+
+			var got []string
+			for _, pattern := range []string{"neutrino.db*", "neutrino.sqlite*"} {
+				matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+				for _, match := range matches {
+					if filepath.Ext(match) != ".lock" {
+						got = append(got, filepath.Base(match))
+					}
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("database files = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("database files = %v, want %v", got, tt.want)
+				}
+			}
+			if tt.name != "migration" {
+				return
+			}
+
+			// The migrated database holds the same data, and header chains
+			db, err := openDB(DBBackendSQLite, filepath.Join(dir, "neutrino.sqlite"), false, "", headerDBTimeout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := dumpDB(t, db); got != want {
+				t.Errorf("migrated database holds:\n%s\nwant:\n%s", got, want)
+			}
+			db.Close()
+			if _, err := os.Stat(filepath.Join(dir, "neutrino.sqlite.migrate")); !os.IsNotExist(err) {
+				t.Errorf("migration left its temporary database behind: %v", err)
+			}
+
+			db, blockStore, filterStore, err := openHeaderStores(dir, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if _, height, err := blockStore.ChainTip(); err != nil || height != 5 {
+				t.Errorf("migrated block header tip = %d, %v, want 5", height, err)
+			}
+			if tip, height, err := filterStore.ChainTip(); err != nil || height != 3 || *tip != filters[2] {
+				t.Errorf("migrated filter header tip = %d, %v, want 3", height, err)
+			}
+		})
+	}
+}
+
+func TestMemoryDatabase(t *testing.T) {
+	dataDir := t.TempDir()
+	node, err := NewNode(&Config{
+		Network:   "regtest",
+		DataDir:   dataDir,
+		DBBackend: DBBackendMemory,
+		Logger:    btclog.NewBackend(os.Stdout),
+		LogLevel:  "error",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := node.Start(); err != nil {
+		t.Fatalf("Start() failed: %v", err)
+	}
+	memoryDir := node.config.DataDir
+	if memoryDir == dataDir {
+		t.Fatal("the memory database is kept in the data directory")
+	}
+	if _, err := os.Stat(filepath.Join(memoryDir, "neutrino.db")); err != nil {
+		t.Errorf("no database in the memory data directory: %v", err)
+	}
+	if got, want := node.config.backupDir(), filepath.Join(dataDir, "backups"); got != want {
+		t.Errorf("backups are written to %s, want %s", got, want)
+	}
+
+	if err := node.Stop(); err != nil {
+		t.Fatalf("Stop() failed: %v", err)
+	}
+	if _, err := os.Stat(memoryDir); !os.IsNotExist(err) {
+		t.Errorf("Stop() left the memory data directory behind: %v", err)
+	}
+	if entries, _ := os.ReadDir(dataDir); len(entries) > 0 {
+		t.Errorf("the data directory holds %d files", len(entries))
+	}
+}
+
+func TestRemoveStaleMemoryDirs(t *testing.T) {
+	parent := t.TempDir()
+	prefix := "neutrinod-regtest-"
+	mkdir := func(name string) string {
+		dir := filepath.Join(parent, name)
+		if err := os.Mkdir(dir, 0o700); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	createDB := func(dir string) walletdb.DB {
+		db, err := openDB(DBBackendMemory, filepath.Join(dir, "neutrino.db"), true, "", time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+
+	stale := mkdir(prefix + "stale")
+	createDB(stale).Close()
+	running := mkdir(prefix + "running")
+	db := createDB(running)
+	defer db.Close()
+	starting := mkdir(prefix + "starting")
+	abandoned := mkdir(prefix + "abandoned")
+	old := time.Now().Add(-2 * staleMemoryDirAge)
+	if err := os.Chtimes(abandoned, old, old); err != nil {
+		t.Fatal(err)
+	}
+	other := mkdir("neutrinod-mainnet-stale")
+	createDB(other).Close()
+
+	node := &Node{logger: btclog.Disabled}
+	node.removeStaleMemoryDirs(parent, prefix)
+
+	for dir, kept := range map[string]bool{stale: false, running: true, starting: true, abandoned: false, other: true} {
+		if _, err := os.Stat(dir); (err == nil) != kept {
+			t.Errorf("%s kept = %v, want %v", filepath.Base(dir), err == nil, kept)
+		}
+	}
+}
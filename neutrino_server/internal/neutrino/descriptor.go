@@ -0,0 +1,654 @@
+package neutrino
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// Script types of the descriptors that can be watched. The sh, wsh and
+// sh(wsh) types wrap a multi() or sortedmulti() script.
+const (
+	scriptTypePKH    = "pkh"
+	scriptTypeSHWPKH = "sh(wpkh)"
+	scriptTypeWPKH   = "wpkh"
+	scriptTypeTR     = "tr"
+	scriptTypeSH     = "sh"
+	scriptTypeWSH    = "wsh"
+	scriptTypeSHWSH  = "sh(wsh)"
+)
+
+const (
+	// descriptorChecksumLength is the number of characters of a descriptor
+	// checksum.
+	descriptorChecksumLength = 8
+
+	// maxMultisigKeys is the most keys of a multisig descriptor. P2SH redeem
+	// scripts only fit maxP2SHMultisigKeys compressed keys.
+	maxMultisigKeys     = 20
+	maxP2SHMultisigKeys = 15
+)
+
+// extendedKeyFormat describes the script type implied by the version bytes of
+// an SLIP-132 extended public key, and the network it belongs to.
+type extendedKeyFormat struct {
+	scriptType string
+	mainnet    bool
+}
+
+// extendedKeyVersions maps the version bytes of the supported extended public
+// keys to their format. Private keys are rejected: watching never needs them.
+var extendedKeyVersions = map[[4]byte]extendedKeyFormat{
+	{0x04, 0x88, 0xb2, 0x1e}: {scriptTypePKH, true},     // xpub
+	{0x04, 0x9d, 0x7c, 0xb2}: {scriptTypeSHWPKH, true},  // ypub
+	{0x04, 0xb2, 0x47, 0x46}: {scriptTypeWPKH, true},    // zpub
+	{0x04, 0x35, 0x87, 0xcf}: {scriptTypePKH, false},    // tpub
+	{0x04, 0x4a, 0x52, 0x62}: {scriptTypeSHWPKH, false}, // upub
+	{0x04, 0x5f, 0x1c, 0xf6}: {scriptTypeWPKH, false},   // vpub
+}
+
+// descriptor is a parsed output descriptor, such as
+// wpkh([d34db33f/84'/0'/0']xpub.../<0;1>/*) or
+// wsh(sortedmulti(2,xpub1.../0/*,xpub2.../0/*)).
+type descriptor struct {
+	scriptType string
+	keys       []*descriptorKey
+
+	// threshold and sorted describe the multi() or sortedmulti() script of
+	// the multisig script types.
+	threshold int
+	sorted    bool
+}
+
+// descriptorKey is a key expression of a descriptor: either a fixed public
+// key or an extended public key with a derivation path.
+type descriptorKey struct {
+	origin string
+	pubKey []byte
+	ext    *hdkeychain.ExtendedKey
+
+	// paths holds the unhardened steps below ext, one path per chain: a
+	// multipath step such as <0;1> yields one per branch. ranged keys are
+	// derived once more at the index of the address.
+	paths  [][]uint32
+	ranged bool
+
+	// chainKeys holds the key derived along every path.
+	chainKeys []*hdkeychain.ExtendedKey
+}
+
+// parseDescriptor parses an output descriptor or a bare extended public key
+// for params. A bare key watches its receive (/0/*) and change (/1/*) chains
+// with the script type its version implies. A descriptor checksum, if
+// present, must match.
+func parseDescriptor(input string, params *chaincfg.Params) (*descriptor, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, NewBadRequestError("descriptor is required")
+	}
+
+	if !strings.Contains(input, "(") {
+		key, format, err := parseExtendedKey(input, params)
+		if err != nil {
+			return nil, err
+		}
+		desc := &descriptor{
+			scriptType: format.scriptType,
+			keys:       []*descriptorKey{{ext: key, paths: [][]uint32{{0}, {1}}, ranged: true}},
+		}
+		return desc, desc.deriveChainKeys()
+	}
+
+	body, checksum, found := strings.Cut(input, "#")
+	if found && checksum != descriptorChecksum(body) {
+		return nil, NewBadRequestError("invalid descriptor checksum")
+	}
+
+	desc := &descriptor{}
+	var inner string
+	for _, wrapper := range []struct{ scriptType, prefix, suffix string }{
+		{scriptTypeSHWPKH, "sh(wpkh(", "))"},
+		{scriptTypeSHWSH, "sh(wsh(", "))"},
+		{scriptTypeSH, "sh(", ")"},
+		{scriptTypeWSH, "wsh(", ")"},
+		{scriptTypeWPKH, "wpkh(", ")"},
+		{scriptTypePKH, "pkh(", ")"},
+		{scriptTypeTR, "tr(", ")"},
+	} {
+		if strings.HasPrefix(body, wrapper.prefix) && strings.HasSuffix(body, wrapper.suffix) {
+			desc.scriptType = wrapper.scriptType
+			inner = body[len(wrapper.prefix) : len(body)-len(wrapper.suffix)]
+			break
+		}
+	}
+	switch {
+	case desc.scriptType == "" && (strings.HasPrefix(body, "multi(") || strings.HasPrefix(body, "sortedmulti(")):
+		return nil, NewBadRequestError("bare multisig has no address: wrap it in sh(), wsh() or sh(wsh())")
+	case desc.scriptType == "":
+		return nil, NewBadRequestError("unsupported descriptor: use pkh(), wpkh(), sh(wpkh()), tr(), sh(), wsh() or sh(wsh())")
+	case desc.isMultisig():
+		if err := desc.parseMultisig(inner, params); err != nil {
+			return nil, err
+		}
+	default:
+		key, err := parseDescriptorKey(inner, desc.scriptType == scriptTypeTR, params)
+		if err != nil {
+			return nil, err
+		}
+		desc.keys = []*descriptorKey{key}
+	}
+
+	// Keys with a multipath step must agree on the number of chains
+	chains := 1
+	for _, key := range desc.keys {
+		if len(key.paths) <= 1 {
+			continue
+		}
+		if chains > 1 && len(key.paths) != chains {
+			return nil, NewBadRequestError("multipath steps of a descriptor must have the same number of branches")
+		}
+		chains = len(key.paths)
+	}
+	return desc, desc.deriveChainKeys()
+}
+
+// isMultisig reports whether d wraps a multi() or sortedmulti() script.
+func (d *descriptor) isMultisig() bool {
+	return d.scriptType == scriptTypeSH || d.scriptType == scriptTypeWSH || d.scriptType == scriptTypeSHWSH
+}
+
+// parseMultisig parses the multi(k,key1,...) or sortedmulti(k,key1,...)
+// script wrapped by d.
+func (d *descriptor) parseMultisig(script string, params *chaincfg.Params) error {
+	switch {
+	case strings.HasPrefix(script, "sortedmulti(") && strings.HasSuffix(script, ")"):
+		d.sorted, script = true, script[len("sortedmulti("):len(script)-1]
+	case strings.HasPrefix(script, "multi(") && strings.HasSuffix(script, ")"):
+		script = script[len("multi(") : len(script)-1]
+	default:
+		return NewBadRequestError(fmt.Sprintf("%s() descriptors must wrap multi() or sortedmulti()", d.scriptType))
+	}
+
+	args := strings.Split(script, ",")
+	maxKeys := maxMultisigKeys
+	if d.scriptType == scriptTypeSH {
+		maxKeys = maxP2SHMultisigKeys
+	}
+	if len(args) < 2 || len(args)-1 > maxKeys {
+		return NewBadRequestError(fmt.Sprintf("multisig descriptors need between 1 and %d keys", maxKeys))
+	}
+	threshold, err := strconv.Atoi(args[0])
+	if err != nil || threshold < 1 || threshold > len(args)-1 {
+		return NewBadRequestError(fmt.Sprintf("invalid multisig threshold %q for %d keys", args[0], len(args)-1))
+	}
+	d.threshold = threshold
+
+	for _, arg := range args[1:] {
+		key, err := parseDescriptorKey(arg, false, params)
+		if err != nil {
+			return err
+		}
+		d.keys = append(d.keys, key)
+	}
+	return nil
+}
+
+// parseDescriptorKey parses a key expression: an optional [origin] followed
+// by a hex public key, or by an extended public key with an optional
+// unhardened path, ending in /* if ranged. xOnly also accepts the 32-byte
+// keys of taproot.
+func parseDescriptorKey(expr string, xOnly bool, params *chaincfg.Params) (*descriptorKey, error) {
+	key := &descriptorKey{}
+	if strings.HasPrefix(expr, "[") {
+		end := strings.Index(expr, "]")
+		if end < 0 {
+			return nil, NewBadRequestError("unterminated key origin in descriptor")
+		}
+		key.origin = expr[1:end]
+		if fingerprint, _, _ := strings.Cut(key.origin, "/"); len(fingerprint) != 8 || !isHex(fingerprint) {
+			return nil, NewBadRequestError("key origin must start with a 4-byte hex fingerprint")
+		}
+		expr = expr[end+1:]
+	}
+
+	steps := strings.Split(expr, "/")
+	if isHex(steps[0]) {
+		if len(steps) > 1 {
+			return nil, NewBadRequestError("a hex public key cannot be derived")
+		}
+		pubKey, _ := hex.DecodeString(steps[0])
+		var err error
+		switch {
+		case xOnly && len(pubKey) == schnorr.PubKeyBytesLen:
+			_, err = schnorr.ParsePubKey(pubKey)
+		case len(pubKey) == btcec.PubKeyBytesLenCompressed:
+			_, err = btcec.ParsePubKey(pubKey)
+		default:
+			err = fmt.Errorf("unsupported length of %d bytes", len(pubKey))
+		}
+		if err != nil {
+			return nil, NewBadRequestError(fmt.Sprintf("invalid public key %s: %v", steps[0], err))
+		}
+		key.pubKey = pubKey
+		return key, nil
+	}
+
+	ext, _, err := parseExtendedKey(steps[0], params)
+	if err != nil {
+		return nil, err
+	}
+	key.ext = ext
+
+	steps = steps[1:]
+	if len(steps) > 0 && steps[len(steps)-1] == "*" {
+		key.ranged = true
+		steps = steps[:len(steps)-1]
+	}
+	key.paths = [][]uint32{nil}
+	for _, step := range steps {
+		if strings.HasPrefix(step, "<") && strings.HasSuffix(step, ">") {
+			if len(key.paths) > 1 {
+				return nil, NewBadRequestError("descriptor keys may have at most one multipath step")
+			}
+			branches := strings.Split(step[1:len(step)-1], ";")
+			if len(branches) < 2 {
+				return nil, NewBadRequestError(fmt.Sprintf("invalid multipath step %q", step))
+			}
+			paths := make([][]uint32, 0, len(branches))
+			for _, branch := range branches {
+				index, err := parsePathStep(branch)
+				if err != nil {
+					return nil, err
+				}
+				paths = append(paths, append(slices.Clone(key.paths[0]), index))
+			}
+			key.paths = paths
+			continue
+		}
+
+		index, err := parsePathStep(step)
+		if err != nil {
+			return nil, err
+		}
+		for i := range key.paths {
+			key.paths[i] = append(key.paths[i], index)
+		}
+	}
+	return key, nil
+}
+
+// parseExtendedKey decodes an extended public key for params, accepting the
+// SLIP-132 ypub, zpub, upub and vpub versions.
+func parseExtendedKey(encoded string, params *chaincfg.Params) (*hdkeychain.ExtendedKey, extendedKeyFormat, error) {
+	key, err := hdkeychain.NewKeyFromString(encoded)
+	if err != nil {
+		return nil, extendedKeyFormat{}, NewBadRequestError(fmt.Sprintf("invalid extended key: %v", err))
+	}
+	if key.IsPrivate() {
+		return nil, extendedKeyFormat{}, NewBadRequestError("extended private keys are not accepted: use the extended public key")
+	}
+
+	format, ok := extendedKeyVersions[[4]byte(key.Version())]
+	if !ok {
+		return nil, extendedKeyFormat{}, NewBadRequestError("unsupported extended key version")
+	}
+	if format.mainnet != (params.Net == chaincfg.MainNetParams.Net) {
+		return nil, extendedKeyFormat{}, NewBadRequestError(fmt.Sprintf("extended key is not for %s", params.Name))
+	}
+
+	// Normalize the version, so the key prints as an xpub or tpub
+	key, err = key.CloneWithVersion(params.HDPublicKeyID[:])
+	if err != nil {
+		return nil, extendedKeyFormat{}, NewBadRequestError(fmt.Sprintf("invalid extended key: %v", err))
+	}
+	return key, format, nil
+}
+
+// parsePathStep parses an unhardened derivation step.
+func parsePathStep(step string) (uint32, error) {
+	if strings.HasSuffix(step, "'") || strings.HasSuffix(step, "h") || strings.HasSuffix(step, "H") {
+		return 0, NewBadRequestError(fmt.Sprintf("hardened step %q cannot be derived from a public key", step))
+	}
+	index, err := strconv.ParseUint(step, 10, 32)
+	if err != nil || index >= hdkeychain.HardenedKeyStart {
+		return 0, NewBadRequestError(fmt.Sprintf("invalid derivation step %q", step))
+	}
+	return uint32(index), nil
+}
+
+// deriveChainKeys derives the key of every chain of every extended key of d.
+func (d *descriptor) deriveChainKeys() error {
+	for _, key := range d.keys {
+		if key.ext == nil {
+			continue
+		}
+		key.chainKeys = make([]*hdkeychain.ExtendedKey, len(key.paths))
+		for chain, path := range key.paths {
+			chainKey := key.ext
+			for _, step := range path {
+				child, err := chainKey.Derive(step)
+				if err != nil {
+					return fmt.Errorf("failed to derive step %d: %w", step, err)
+				}
+				chainKey = child
+			}
+			key.chainKeys[chain] = chainKey
+		}
+	}
+	return nil
+}
+
+// chains returns the number of chains of d: the branches of its multipath
+// step, or one.
+func (d *descriptor) chains() int {
+	chains := 1
+	for _, key := range d.keys {
+		chains = max(chains, len(key.paths))
+	}
+	return chains
+}
+
+// ranged reports whether the addresses of d depend on an index.
+func (d *descriptor) ranged() bool {
+	return slices.ContainsFunc(d.keys, func(key *descriptorKey) bool { return key.ranged })
+}
+
+// String returns the normalized descriptor with its checksum. Every chain is
+// included, with a multipath step if there are several.
+func (d *descriptor) String() string {
+	keys := make([]string, len(d.keys))
+	for i, key := range d.keys {
+		keys[i] = key.String()
+	}
+
+	var body string
+	switch {
+	case d.isMultisig():
+		script := "multi("
+		if d.sorted {
+			script = "sortedmulti("
+		}
+		script += strconv.Itoa(d.threshold) + "," + strings.Join(keys, ",") + ")"
+		if d.scriptType == scriptTypeSHWSH {
+			body = "sh(wsh(" + script + "))"
+		} else {
+			body = d.scriptType + "(" + script + ")"
+		}
+	case d.scriptType == scriptTypeSHWPKH:
+		body = "sh(wpkh(" + keys[0] + "))"
+	default:
+		body = d.scriptType + "(" + keys[0] + ")"
+	}
+	return body + "#" + descriptorChecksum(body)
+}
+
+// String returns the normalized key expression.
+func (k *descriptorKey) String() string {
+	var expr strings.Builder
+	if k.origin != "" {
+		expr.WriteString("[" + k.origin + "]")
+	}
+	if k.ext == nil {
+		expr.WriteString(hex.EncodeToString(k.pubKey))
+		return expr.String()
+	}
+
+	expr.WriteString(k.ext.String())
+	for i := range k.paths[0] {
+		if len(k.paths) == 1 {
+			fmt.Fprintf(&expr, "/%d", k.paths[0][i])
+			continue
+		}
+		// Chains differ only in the multipath step
+		branches := make([]string, len(k.paths))
+		for j, path := range k.paths {
+			branches[j] = strconv.FormatUint(uint64(path[i]), 10)
+		}
+		if slices.Equal(branches[1:], branches[:len(branches)-1]) {
+			expr.WriteString("/" + branches[0])
+		} else {
+			expr.WriteString("/<" + strings.Join(branches, ";") + ">")
+		}
+	}
+	if k.ranged {
+		expr.WriteString("/*")
+	}
+	return expr.String()
+}
+
+// publicKey returns the serialized key of k on chain at index. Fixed keys
+// are the same on every chain and index.
+func (k *descriptorKey) publicKey(chain int, index uint32) ([]byte, error) {
+	if k.ext == nil {
+		return k.pubKey, nil
+	}
+
+	key := k.chainKeys[min(chain, len(k.chainKeys)-1)]
+	if k.ranged {
+		child, err := key.Derive(index)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive index %d: %w", index, err)
+		}
+		key = child
+	}
+	pubKey, err := key.ECPubKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive index %d: %w", index, err)
+	}
+	return pubKey.SerializeCompressed(), nil
+}
+
+// deriveAddress returns the address of d at index of chain.
+func (d *descriptor) deriveAddress(chain int, index uint32, params *chaincfg.Params) (btcutil.Address, error) {
+	if d.isMultisig() {
+		script, err := d.multisigScript(chain, index)
+		if err != nil {
+			return nil, err
+		}
+		if d.scriptType == scriptTypeSH {
+			return btcutil.NewAddressScriptHash(script, params)
+		}
+		scriptHash := sha256.Sum256(script)
+		witness, err := btcutil.NewAddressWitnessScriptHash(scriptHash[:], params)
+		if err != nil || d.scriptType == scriptTypeWSH {
+			return witness, err
+		}
+		return nestedScriptHash(witness, params)
+	}
+
+	pubKey, err := d.keys[0].publicKey(chain, index)
+	if err != nil {
+		return nil, err
+	}
+	switch d.scriptType {
+	case scriptTypePKH:
+		return btcutil.NewAddressPubKeyHash(btcutil.Hash160(pubKey), params)
+	case scriptTypeWPKH:
+		return btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(pubKey), params)
+	case scriptTypeSHWPKH:
+		witness, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(pubKey), params)
+		if err != nil {
+			return nil, err
+		}
+		return nestedScriptHash(witness, params)
+	case scriptTypeTR:
+		var internalKey *btcec.PublicKey
+		if len(pubKey) == schnorr.PubKeyBytesLen {
+			internalKey, err = schnorr.ParsePubKey(pubKey)
+		} else {
+			internalKey, err = btcec.ParsePubKey(pubKey)
+		}
+		if err != nil {
+			return nil, err
+		}
+		outputKey := txscript.ComputeTaprootKeyNoScript(internalKey)
+		return btcutil.NewAddressTaproot(schnorr.SerializePubKey(outputKey), params)
+	default:
+		return nil, fmt.Errorf("unknown script type %q", d.scriptType)
+	}
+}
+
+// multisigScript returns the multi() or sortedmulti() script of d at index of
+// chain.
+func (d *descriptor) multisigScript(chain int, index uint32) ([]byte, error) {
+	pubKeys := make([][]byte, len(d.keys))
+	for i, key := range d.keys {
+		pubKey, err := key.publicKey(chain, index)
+		if err != nil {
+			return nil, err
+		}
+		pubKeys[i] = pubKey
+	}
+	if d.sorted {
+		slices.SortFunc(pubKeys, bytes.Compare)
+	}
+
+	builder := txscript.NewScriptBuilder().AddInt64(int64(d.threshold))
+	for _, pubKey := range pubKeys {
+		builder.AddData(pubKey)
+	}
+	return builder.AddInt64(int64(len(pubKeys))).AddOp(txscript.OP_CHECKMULTISIG).Script()
+}
+
+// nestedScriptHash returns the P2SH address wrapping the segwit address
+// witness.
+func nestedScriptHash(witness btcutil.Address, params *chaincfg.Params) (btcutil.Address, error) {
+	script, err := txscript.PayToAddrScript(witness)
+	if err != nil {
+		return nil, err
+	}
+	return btcutil.NewAddressScriptHash(script, params)
+}
+
+// descriptorChecksum returns the BIP-380 checksum of a descriptor without
+// one.
+func descriptorChecksum(desc string) string {
+	const (
+		inputCharset    = "0123456789()[],'/*abcdefgh@:$%{}IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+		checksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	)
+	generator := [5]uint64{0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd}
+
+	c := uint64(1)
+	polymod := func(value uint64) {
+		top := c >> 35
+		c = (c&0x7ffffffff)<<5 ^ value
+		for i, g := range generator {
+			if (top>>i)&1 == 1 {
+				c ^= g
+			}
+		}
+	}
+
+	var groups []uint64
+	for _, ch := range desc {
+		pos := strings.IndexRune(inputCharset, ch)
+		if pos < 0 {
+			return ""
+		}
+		polymod(uint64(pos) & 31)
+		groups = append(groups, uint64(pos)>>5)
+		if len(groups) == 3 {
+			polymod(groups[0]*9 + groups[1]*3 + groups[2])
+			groups = groups[:0]
+		}
+	}
+	switch len(groups) {
+	case 1:
+		polymod(groups[0])
+	case 2:
+		polymod(groups[0]*3 + groups[1])
+	}
+	for range descriptorChecksumLength {
+		polymod(0)
+	}
+	c ^= 1
+
+	checksum := make([]byte, descriptorChecksumLength)
+	for i := range checksum {
+		checksum[i] = checksumCharset[(c>>(5*(7-i)))&31]
+	}
+	return string(checksum)
+}
+
+// isHex reports whether s is a non-empty hex string.
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return s != "" && err == nil
+}
+
+const (
+	// DefaultDescriptorRange is the number of indexes derived from a ranged
+	// descriptor given without a range.
+	DefaultDescriptorRange = 1000
+
+	// maxDescriptorAddresses bounds the addresses derived from the
+	// descriptors of one request.
+	maxDescriptorAddresses = 10000
+)
+
+// DescriptorRange selects the addresses of an output descriptor.
+type DescriptorRange struct {
+	Descriptor string `json:"descriptor"`
+
+	// Range holds the first and last index derived from a ranged
+	// descriptor, [0, DefaultDescriptorRange-1] if empty.
+	Range []uint32 `json:"range,omitempty"`
+}
+
+// DescriptorAddresses returns the addresses derived from descriptors on every
+// chain, so their scripts can be matched against block filters like those of
+// any watched address.
+func (n *Node) DescriptorAddresses(descriptors []DescriptorRange) ([]string, error) {
+	return descriptorAddresses(descriptors, n.chainParams)
+}
+
+// descriptorAddresses returns the addresses derived from descriptors on
+// every chain for params.
+func descriptorAddresses(descriptors []DescriptorRange, params *chaincfg.Params) ([]string, error) {
+	var addresses []string
+	for _, selection := range descriptors {
+		desc, err := parseDescriptor(selection.Descriptor, params)
+		if err != nil {
+			return nil, err
+		}
+
+		first, last := uint32(0), uint32(DefaultDescriptorRange-1)
+		switch {
+		case !desc.ranged():
+			if len(selection.Range) > 0 {
+				return nil, NewBadRequestError("range is only valid for ranged descriptors")
+			}
+			last = 0
+		case len(selection.Range) == 2 && selection.Range[0] <= selection.Range[1]:
+			first, last = selection.Range[0], selection.Range[1]
+		case len(selection.Range) != 0:
+			return nil, NewBadRequestError("range must be [first, last] with first <= last")
+		}
+		if uint64(len(addresses))+uint64(last-first+1)*uint64(desc.chains()) > maxDescriptorAddresses {
+			return nil, NewBadRequestError(fmt.Sprintf("descriptors derive more than %d addresses", maxDescriptorAddresses))
+		}
+
+		for chain := range desc.chains() {
+			for index := uint64(first); index <= uint64(last); index++ {
+				addr, err := desc.deriveAddress(chain, uint32(index), params)
+				if err != nil {
+					return nil, NewBadRequestError(fmt.Sprintf("failed to derive %s at %d: %v", selection.Descriptor, index, err))
+				}
+				addresses = append(addresses, addr.EncodeAddress())
+			}
+		}
+	}
+	return addresses, nil
+}
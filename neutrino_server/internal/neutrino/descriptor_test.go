@@ -0,0 +1,164 @@
+package neutrino
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+const (
+	// Account keys of the "abandon ... about" mnemonic from the BIP 44, 49,
+	// 84 and 86 test vectors
+	bip44Xpub = "xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj"
+	bip49Ypub = "ypub6Ww3ibxVfGzLrAH1PNcjyAWenMTbbAosGNB6VvmSEgytSER9azLDWCxoJwW7Ke7icmizBMXrzBx9979FfaHxHcrArf3zbeJJJUZPf663zsP"
+	bip84Zpub = "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+	bip86Xpub = "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ"
+)
+
+func TestParseDescriptor(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		// want holds the first address of every chain
+		want []string
+	}{
+		{"bare xpub", bip44Xpub, []string{"1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA", ""}},
+		{"bare ypub", bip49Ypub, []string{"37VucYSaXLCAsxYyAPfbSi9eh4iEcbShgf", ""}},
+		{"bare zpub", bip84Zpub, []string{"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el"}},
+		{"taproot descriptor", "tr(" + bip86Xpub + "/0/*)", []string{"bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"}},
+		{"hex key", "wpkh(02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9)", []string{"bc1q0ht9tyks4vh7p5p904t340cr9nvahy7u3re7zg"}},
+		// BIP 67 test vector 1: the keys are sorted before building the script
+		{"sortedmulti", "sh(sortedmulti(2,02ff12471208c14bd580709cb2358d98975247d8765f92bc25eab3b2763ed605f8,02fe6f0a5a297eb38c391581c4413e084773ea23954d93f7753db7dc0adc188b2f))", []string{"39bgKC7RFbpoCRbtD5KEdkYKtNyhpsNa3Z"}},
+		{"multipath descriptor with origin", "wpkh([73c5da0a/84'/0'/0']" + bip84Zpub + "/<0;1>/*)", []string{"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desc, err := parseDescriptor(tt.input, &chaincfg.MainNetParams)
+			if err != nil {
+				t.Fatalf("parseDescriptor() failed: %v", err)
+			}
+			if desc.chains() != len(tt.want) {
+				t.Fatalf("parseDescriptor() has %d chains, want %d", desc.chains(), len(tt.want))
+			}
+			for chain, want := range tt.want {
+				if want == "" {
+					continue
+				}
+				addr, err := desc.deriveAddress(chain, 0, &chaincfg.MainNetParams)
+				if err != nil {
+					t.Fatalf("deriveAddress() failed: %v", err)
+				}
+				if addr.EncodeAddress() != want {
+					t.Errorf("chain %d address 0 = %s, want %s", chain, addr.EncodeAddress(), want)
+				}
+			}
+
+			// The normalized form parses back to the same descriptor
+			normalized := desc.String()
+			reparsed, err := parseDescriptor(normalized, &chaincfg.MainNetParams)
+			if err != nil {
+				t.Fatalf("parseDescriptor(%q) failed: %v", normalized, err)
+			}
+			if reparsed.String() != normalized {
+				t.Errorf("String() = %q after reparsing %q", reparsed.String(), normalized)
+			}
+		})
+	}
+}
+
+func TestParseDescriptorErrors(t *testing.T) {
+	valid := "wpkh(" + bip84Zpub + "/0/*)"
+	checksum := descriptorChecksum(valid)
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"garbage", "not a key"},
+		{"private key", "wpkh(xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi/0/*)"},
+		{"unsupported script", "sh(pkh(" + bip44Xpub + "/0/*))"},
+		{"bare multisig", "multi(1," + bip44Xpub + "/0/*)"},
+		{"threshold above keys", "wsh(multi(3," + bip44Xpub + "/0/*," + bip84Zpub + "/0/*))"},
+		{"derived hex key", "wpkh(02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9/0)"},
+		{"mismatched multipath steps", "wsh(multi(1," + bip44Xpub + "/<0;1>/*," + bip84Zpub + "/<0;1;2>/*))"},
+		{"hardened step", "wpkh(" + bip84Zpub + "/0'/*)"},
+		{"bad checksum", valid + "#" + strings.Repeat("q", descriptorChecksumLength)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseDescriptor(tt.input, &chaincfg.MainNetParams)
+			var badRequest *BadRequestError
+			if !errors.As(err, &badRequest) {
+				t.Errorf("parseDescriptor(%q) error = %v, want a BadRequestError", tt.input, err)
+			}
+		})
+	}
+
+	var badRequest *BadRequestError
+	if _, err := parseDescriptor(valid, &chaincfg.TestNet3Params); !errors.As(err, &badRequest) {
+		t.Errorf("parseDescriptor() of a mainnet key on testnet error = %v, want a BadRequestError", err)
+	}
+	if _, err := parseDescriptor(valid+"#"+checksum, &chaincfg.MainNetParams); err != nil {
+		t.Errorf("parseDescriptor() with its checksum failed: %v", err)
+	}
+}
+
+func TestDescriptorChecksum(t *testing.T) {
+	// From the BIP 380 and Bitcoin Core descriptor tests
+	desc := "pkh(02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5)"
+	if got := descriptorChecksum(desc); got != "8fhd9pwu" {
+		t.Errorf("descriptorChecksum() = %s, want 8fhd9pwu", got)
+	}
+}
+
+func TestDescriptorAddresses(t *testing.T) {
+	n := &Node{chainParams: &chaincfg.MainNetParams}
+	hexKey := "wpkh(02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9)"
+
+	tests := []struct {
+		name        string
+		descriptors []DescriptorRange
+		want        int
+		wantErr     bool
+	}{
+		{"default range on both chains", []DescriptorRange{{Descriptor: bip84Zpub}}, 2 * DefaultDescriptorRange, false},
+		{"range", []DescriptorRange{{Descriptor: "wpkh(" + bip84Zpub + "/0/*)", Range: []uint32{5, 9}}}, 5, false},
+		{"fixed key", []DescriptorRange{{Descriptor: hexKey}}, 1, false},
+		{"several descriptors", []DescriptorRange{{Descriptor: hexKey}, {Descriptor: bip84Zpub, Range: []uint32{0, 0}}}, 3, false},
+		{"range of a fixed key", []DescriptorRange{{Descriptor: hexKey, Range: []uint32{0, 1}}}, 0, true},
+		{"inverted range", []DescriptorRange{{Descriptor: bip84Zpub, Range: []uint32{9, 5}}}, 0, true},
+		{"too many addresses", []DescriptorRange{{Descriptor: bip84Zpub, Range: []uint32{0, maxDescriptorAddresses}}}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addresses, err := n.DescriptorAddresses(tt.descriptors)
+			if tt.wantErr {
+				var badRequest *BadRequestError
+				if !errors.As(err, &badRequest) {
+					t.Errorf("DescriptorAddresses() error = %v, want a BadRequestError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DescriptorAddresses() failed: %v", err)
+			}
+			if len(addresses) != tt.want {
+				t.Errorf("DescriptorAddresses() returned %d addresses, want %d", len(addresses), tt.want)
+			}
+		})
+	}
+
+	addresses, err := n.DescriptorAddresses([]DescriptorRange{{Descriptor: bip84Zpub, Range: []uint32{0, 0}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addresses[0] != "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu" || addresses[1] != "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el" {
+		t.Errorf("DescriptorAddresses() = %v", addresses)
+	}
+}
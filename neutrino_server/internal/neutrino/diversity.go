@@ -0,0 +1,532 @@
+package neutrino
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightninglabs/neutrino"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// DefaultMaxPeersPerGroup is the number of peers found through discovery
+// the node connects to in the same network group.
+const DefaultMaxPeersPerGroup = 2
+
+const (
+	// diversityInterval is how often peer diversity is enforced.
+	diversityInterval = 2 * time.Minute
+
+	// maxAnnouncedAddrs bounds the addresses announced by peers that are
+	// kept per network to mix onion and clearnet peers.
+	maxAnnouncedAddrs = 1000
+)
+
+// Networks of peers, see PeerDiversity.
+const (
+	networkIPv4  = "ipv4"
+	networkIPv6  = "ipv6"
+	networkOnion = "onion"
+	networkLocal = "local"
+	networkOther = "other"
+
+	// networkClearnet covers IPv4 and IPv6 when mixing networks.
+	networkClearnet = "clearnet"
+)
+
+// refusedConn is the connection dialing a discovered peer in a network group
+// that already has its share of peers returns. It is closed, so the peer is
+// dropped when its handshake fails. A dial error would instead count as a
+// failed attempt, and the connection manager backs off after 25 in a row,
+// which refusals alone reach when most known addresses are in full groups.
+type refusedConn struct {
+	net.Conn
+}
+
+// newRefusedConn returns a closed refusedConn.
+func newRefusedConn() refusedConn {
+	conn, peer := net.Pipe()
+	conn.Close()
+	peer.Close()
+	return refusedConn{conn}
+}
+
+// asnMap maps IP networks to the autonomous systems announcing them.
+type asnMap struct {
+	// nets maps networks in CIDR notation to their AS number. lengths are
+	// the prefix lengths in use by address size, longest first.
+	nets    map[string]uint32
+	lengths map[int][]int
+}
+
+// loadASNFile reads an AS map: a network in CIDR notation and the number of
+// the autonomous system announcing it per line, as in
+// "203.0.113.0/24 AS64496". Lines starting with # are comments. Peers are
+// grouped by AS rather than by address prefix for the networks it covers.
+func loadASNFile(path string) (*asnMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ASN file: %w", err)
+	}
+	defer f.Close()
+
+	m := &asnMap{nets: make(map[string]uint32), lengths: make(map[int][]int)}
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("ASN file %s line %d: want a network and an AS number", path, lineNo)
+		}
+		_, ipNet, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("ASN file %s line %d: invalid network %q", path, lineNo, fields[0])
+		}
+		asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(fields[1]), "AS"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("ASN file %s line %d: invalid AS number %q", path, lineNo, fields[1])
+		}
+
+		ones, bits := ipNet.Mask.Size()
+		if !slices.Contains(m.lengths[bits], ones) {
+			m.lengths[bits] = append(m.lengths[bits], ones)
+		}
+		m.nets[ipNet.String()] = uint32(asn)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ASN file %s: %w", path, err)
+	}
+	for _, lengths := range m.lengths {
+		slices.Sort(lengths)
+		slices.Reverse(lengths)
+	}
+	return m, nil
+}
+
+// lookup returns the AS announcing the longest network containing ip.
+func (m *asnMap) lookup(ip net.IP) (uint32, bool) {
+	if m == nil {
+		return 0, false
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+	for _, ones := range m.lengths[bits] {
+		mask := net.CIDRMask(ones, bits)
+		if asn, ok := m.nets[(&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()]; ok {
+			return asn, true
+		}
+	}
+	return 0, false
+}
+
+// peerGroup returns the network group and network of the peer at addr.
+// Clearnet peers are grouped by AS if asns covers them, or else by /16 for
+// IPv4 and /32 for IPv6, like Bitcoin Core. Onion peers share one group, as
+// their location is hidden, and so do local peers.
+func peerGroup(addr string, asns *asnMap) (group, network string) {
+	if isOnionHost(addr) {
+		return networkOnion, networkOnion
+	}
+	ip := peerIP(addr)
+	if ip == nil {
+		return hostOf(addr), networkOther
+	}
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+		return networkLocal, networkLocal
+	}
+
+	network = networkIPv6
+	bits, ones := 8*net.IPv6len, 32
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, network = ip4, networkIPv4
+		bits, ones = 8*net.IPv4len, 16
+	}
+	if asn, ok := asns.lookup(ip); ok {
+		return fmt.Sprintf("AS%d", asn), network
+	}
+	mask := net.CIDRMask(ones, bits)
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String(), network
+}
+
+// limited reports whether group is subject to the per-group limit. Onion
+// and local peers cannot be told apart by location, so they are not.
+func limited(group string) bool {
+	return group != networkOnion && group != networkLocal
+}
+
+// GroupPeers are the connected peers of a network group.
+type GroupPeers struct {
+	Group   string   `json:"group"`
+	Network string   `json:"network"`
+	Peers   []string `json:"peers"`
+}
+
+// PeerDiversity reports how the connected peers spread over networks and
+// network groups. A node whose peers all share a group may be eclipsed by
+// whoever controls it.
+type PeerDiversity struct {
+	Peers            int            `json:"peers"`
+	Groups           int            `json:"groups"`
+	MaxPeersPerGroup int            `json:"max_peers_per_group"`
+	ASNMapped        bool           `json:"asn_mapped"`
+	MixNetworks      bool           `json:"mix_networks"`
+	Networks         map[string]int `json:"networks"`
+	ByGroup          []GroupPeers   `json:"by_group"`
+	Diverse          bool           `json:"diverse"`
+	Warnings         []string       `json:"warnings"`
+}
+
+// diversity enforces peer diversity: at most maxPerGroup peers found through
+// discovery per network group and, if mix is set, at least one onion and one
+// clearnet peer when addresses of both are known. Peers configured or
+// connected through the API are exempt.
+type diversity struct {
+	maxPerGroup int
+	asns        *asnMap
+	mix         bool
+
+	mu sync.Mutex
+	// manualHosts are the hosts of exempt peers and manualIPs the addresses
+	// they resolved to.
+	manualHosts map[string]bool
+	manualIPs   map[string]bool
+	// announced are addresses peers announced, by network, to connect to
+	// when no peer of that network is connected.
+	announced map[string]map[string]bool
+}
+
+func newDiversity(maxPerGroup int, asns *asnMap, mix bool) *diversity {
+	return &diversity{
+		maxPerGroup: maxPerGroup,
+		asns:        asns,
+		mix:         mix,
+		manualHosts: make(map[string]bool),
+		manualIPs:   make(map[string]bool),
+		announced:   map[string]map[string]bool{networkOnion: {}, networkClearnet: {}},
+	}
+}
+
+// hostOf returns the host of addr, lowercased and without its port.
+func hostOf(addr string) string {
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		addr = h
+	}
+	return strings.ToLower(addr)
+}
+
+// addManual exempts the peer at addr from the per-group limit.
+func (d *diversity) addManual(addr string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	host := hostOf(addr)
+	d.manualHosts[host] = true
+	if ip := net.ParseIP(host); ip != nil {
+		d.manualIPs[ip.String()] = true
+	}
+}
+
+// manual reports whether the peer at addr is exempt.
+func (d *diversity) manual(addr string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if ip := peerIP(addr); ip != nil {
+		return d.manualIPs[ip.String()]
+	}
+	return d.manualHosts[hostOf(addr)]
+}
+
+// resolver wraps resolve to remember the addresses of exempt peers given by
+// host name, which are dialed by address.
+func (d *diversity) resolver(resolve func(string) ([]net.IP, error)) func(string) ([]net.IP, error) {
+	return func(host string) ([]net.IP, error) {
+		ips, err := resolve(host)
+		if err != nil {
+			return nil, err
+		}
+		d.mu.Lock()
+		if d.manualHosts[strings.ToLower(host)] {
+			for _, ip := range ips {
+				d.manualIPs[ip.String()] = true
+			}
+		}
+		d.mu.Unlock()
+		return ips, nil
+	}
+}
+
+// dialer wraps dial to refuse discovered peers in a network group that
+// already has maxPerGroup discovered peers among the addresses peers returns,
+// answering them with a refusedConn.
+func (d *diversity) dialer(dial func(net.Addr) (net.Conn, error), peers func() []string) func(net.Addr) (net.Conn, error) {
+	return func(addr net.Addr) (net.Conn, error) {
+		// Onion addresses are encoded as IPs longer than 16 bytes
+		tcpAddr, ok := addr.(*net.TCPAddr)
+		if !ok || len(tcpAddr.IP) > net.IPv6len || d.manual(addr.String()) {
+			return dial(addr)
+		}
+		group, _ := peerGroup(addr.String(), d.asns)
+		if !limited(group) {
+			return dial(addr)
+		}
+		count := 0
+		for _, peer := range peers() {
+			if peerGroup, _ := peerGroup(peer, d.asns); peerGroup == group && !d.manual(peer) {
+				count++
+			}
+		}
+		if count >= d.maxPerGroup {
+			return newRefusedConn(), nil
+		}
+		return dial(addr)
+	}
+}
+
+// announce records the addresses in an addr or addrv2 message, for mixing
+// networks.
+func (d *diversity) announce(msg wire.Message) {
+	if !d.mix {
+		return
+	}
+	var addrs []string
+	switch msg := msg.(type) {
+	case *wire.MsgAddr:
+		for _, na := range msg.AddrList {
+			if na.Services&neutrino.RequiredServices == neutrino.RequiredServices {
+				addrs = append(addrs, net.JoinHostPort(na.IP.String(), strconv.Itoa(int(na.Port))))
+			}
+		}
+	case *wire.MsgAddrV2:
+		for _, na := range msg.AddrList {
+			if na.Services&neutrino.RequiredServices == neutrino.RequiredServices {
+				addrs = append(addrs, net.JoinHostPort(na.Addr.String(), strconv.Itoa(int(na.Port))))
+			}
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, addr := range addrs {
+		network := mixNetwork(addr)
+		if network == "" {
+			continue
+		}
+		if len(d.announced[network]) < maxAnnouncedAddrs {
+			d.announced[network][addr] = true
+		}
+	}
+}
+
+// mixNetwork returns whether addr is an onion or a clearnet peer, or "" for
+// local peers and host names.
+func mixNetwork(addr string) string {
+	switch _, network := peerGroup(addr, nil); network {
+	case networkOnion:
+		return networkOnion
+	case networkIPv4, networkIPv6:
+		return networkClearnet
+	}
+	return ""
+}
+
+// takeAnnounced removes and returns an announced address of network, the
+// onion or clearnet one, or "" if none is known.
+func (d *diversity) takeAnnounced(network string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for addr := range d.announced[network] {
+		delete(d.announced[network], addr)
+		return addr
+	}
+	return ""
+}
+
+// report summarises the diversity of the peers at addrs.
+func (d *diversity) report(addrs []string) PeerDiversity {
+	report := PeerDiversity{
+		Peers:            len(addrs),
+		MaxPeersPerGroup: d.maxPerGroup,
+		ASNMapped:        d.asns != nil,
+		MixNetworks:      d.mix,
+		Networks:         make(map[string]int),
+		ByGroup:          []GroupPeers{},
+		Warnings:         []string{},
+	}
+
+	groups := make(map[string]*GroupPeers)
+	for _, addr := range addrs {
+		group, network := peerGroup(addr, d.asns)
+		report.Networks[network]++
+		if groups[group] == nil {
+			groups[group] = &GroupPeers{Group: group, Network: network}
+		}
+		groups[group].Peers = append(groups[group].Peers, addr)
+	}
+	for _, group := range groups {
+		slices.Sort(group.Peers)
+		report.ByGroup = append(report.ByGroup, *group)
+	}
+	slices.SortFunc(report.ByGroup, func(a, b GroupPeers) int {
+		if len(a.Peers) != len(b.Peers) {
+			return len(b.Peers) - len(a.Peers)
+		}
+		return strings.Compare(a.Group, b.Group)
+	})
+	report.Groups = len(report.ByGroup)
+
+	switch {
+	case len(addrs) == 0:
+		report.Warnings = append(report.Warnings, "no peers connected")
+	case report.Groups == 1 && len(addrs) > 1:
+		report.Warnings = append(report.Warnings, fmt.Sprintf("all peers are in network group %s", report.ByGroup[0].Group))
+	}
+	for _, group := range report.ByGroup {
+		if limited(group.Group) && len(group.Peers) > d.maxPerGroup {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%d peers in network group %s", len(group.Peers), group.Group))
+		}
+	}
+	if d.mix && len(addrs) > 0 {
+		clearnet := report.Networks[networkIPv4] + report.Networks[networkIPv6]
+		if report.Networks[networkOnion] == 0 {
+			report.Warnings = append(report.Warnings, "no onion peer connected")
+		}
+		if clearnet == 0 {
+			report.Warnings = append(report.Warnings, "no clearnet peer connected")
+		}
+	}
+	report.Diverse = len(report.Warnings) == 0
+	return report
+}
+
+// PeerDiversity reports how the connected peers spread over networks and
+// network groups.
+func (n *Node) PeerDiversity() (*PeerDiversity, error) {
+	if n.chainService == nil {
+		return nil, errors.New("node not started")
+	}
+	report := n.diversity.report(n.connectedPeers())
+	return &report, nil
+}
+
+// connectedPeers returns the addresses of the connected peers.
+func (n *Node) connectedPeers() []string {
+	var addrs []string
+	for _, peer := range n.chainService.Peers() {
+		if peer.Connected() {
+			addrs = append(addrs, peer.Addr())
+		}
+	}
+	return addrs
+}
+
+// enforceDiversity periodically disconnects discovered peers beyond the
+// per-group limit, newest first, and connects to an onion or clearnet peer
+// when there is none of a network to mix, until the node stops.
+func (n *Node) enforceDiversity() {
+	ticker := time.NewTicker(diversityInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.lifetime.Done():
+			return
+		case <-ticker.C:
+		}
+		peers := n.chainService.Peers()
+		slices.SortFunc(peers, func(a, b *neutrino.ServerPeer) int {
+			return b.TimeConnected().Compare(a.TimeConnected())
+		})
+
+		counts := make(map[string]int)
+		for _, peer := range peers {
+			if n.diversity.manual(peer.Addr()) {
+				continue
+			}
+			group, _ := peerGroup(peer.Addr(), n.diversity.asns)
+			counts[group]++
+		}
+		for _, peer := range peers {
+			group, _ := peerGroup(peer.Addr(), n.diversity.asns)
+			if !limited(group) || counts[group] <= n.diversity.maxPerGroup || n.diversity.manual(peer.Addr()) {
+				continue
+			}
+			if err := n.chainService.DisconnectNodeByAddr(peer.Addr()); err != nil {
+				continue
+			}
+			counts[group]--
+			n.logger.Infof("Disconnected peer %s: too many peers in network group %s", logging.KV("peer", peer.Addr()), group)
+		}
+
+		if n.diversity.mix {
+			n.mixNetworks(peers)
+		}
+	}
+}
+
+// mixNetworks connects to an announced onion or clearnet peer if none of
+// that network is connected, making room by disconnecting the newest
+// discovered peer of the other network if the node is at max peers.
+func (n *Node) mixNetworks(peers []*neutrino.ServerPeer) {
+	byNetwork := make(map[string][]*neutrino.ServerPeer)
+	for _, peer := range peers {
+		if network := mixNetwork(peer.Addr()); network != "" {
+			byNetwork[network] = append(byNetwork[network], peer)
+		}
+	}
+
+	for network, other := range map[string]string{networkOnion: networkClearnet, networkClearnet: networkOnion} {
+		if len(byNetwork[network]) > 0 || len(byNetwork[other]) == 0 {
+			continue
+		}
+		addr := n.diversity.takeAnnounced(network)
+		if addr == "" {
+			continue
+		}
+
+		if len(peers) >= neutrino.MaxPeers {
+			evicted := false
+			for _, peer := range byNetwork[other] {
+				if n.diversity.manual(peer.Addr()) {
+					continue
+				}
+				if err := n.chainService.DisconnectNodeByAddr(peer.Addr()); err == nil {
+					n.logger.Infof("Disconnected peer %s to make room for a peer of another network", logging.KV("peer", peer.Addr()))
+					evicted = true
+					break
+				}
+			}
+			if !evicted {
+				continue
+			}
+		}
+		if err := n.chainService.ConnectNode(addr, false); err != nil {
+			n.logger.Debugf("Failed to connect to %s to mix networks: %v", addr, err)
+			continue
+		}
+		n.logger.Infof("Connecting to %s, as no peer of its network is connected", addr)
+	}
+}
+
+// maxPeersPerGroup returns the configured number of discovered peers per
+// network group.
+func (c *Config) maxPeersPerGroup() int {
+	if c.MaxPeersPerGroup > 0 {
+		return c.MaxPeersPerGroup
+	}
+	return DefaultMaxPeersPerGroup
+}
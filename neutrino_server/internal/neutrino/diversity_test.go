@@ -0,0 +1,160 @@
+package neutrino
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+func writeASNFile(t *testing.T, content string) *asnMap {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "asn.txt")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	asns, err := loadASNFile(path)
+	if err != nil {
+		t.Fatalf("loadASNFile() failed: %v", err)
+	}
+	return asns
+}
+
+func TestLoadASNFile(t *testing.T) {
+	asns := writeASNFile(t, "# test map\n203.0.113.0/24 AS64496\n203.0.0.0/16 64497\n2001:db8::/32 AS64498\n")
+
+	tests := []struct {
+		ip   string
+		want uint32
+		ok   bool
+	}{
+		{"203.0.113.7", 64496, true},
+		{"203.0.7.1", 64497, true},
+		{"2001:db8::1", 64498, true},
+		{"198.51.100.1", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := asns.lookup(net.ParseIP(tt.ip)); got != tt.want || ok != tt.ok {
+			t.Errorf("lookup(%s) = %d, %v; want %d, %v", tt.ip, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	for _, content := range []string{"203.0.113.0/24\n", "203.0.113.0 AS1\n", "203.0.113.0/24 ASX\n"} {
+		path := filepath.Join(t.TempDir(), "asn.txt")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadASNFile(path); err == nil {
+			t.Errorf("loadASNFile() of %q should fail", content)
+		}
+	}
+}
+
+func TestPeerGroup(t *testing.T) {
+	asns := writeASNFile(t, "198.51.100.0/24 AS64500\n")
+
+	tests := []struct {
+		addr        string
+		wantGroup   string
+		wantNetwork string
+	}{
+		{"203.0.113.7:8333", "203.0.0.0/16", networkIPv4},
+		{"198.51.100.1:8333", "AS64500", networkIPv4},
+		{"[2001:db8:1::1]:8333", "2001:db8::/32", networkIPv6},
+		{"192.168.1.10:8333", networkLocal, networkLocal},
+		{"127.0.0.1:18444", networkLocal, networkLocal},
+		{"abcdefghijklmnop.onion:8333", networkOnion, networkOnion},
+		{"Node.Example.com:8333", "node.example.com", networkOther},
+	}
+	for _, tt := range tests {
+		group, network := peerGroup(tt.addr, asns)
+		if group != tt.wantGroup || network != tt.wantNetwork {
+			t.Errorf("peerGroup(%s) = %s, %s; want %s, %s", tt.addr, group, network, tt.wantGroup, tt.wantNetwork)
+		}
+	}
+}
+
+func TestDiversityDialer(t *testing.T) {
+	d := newDiversity(2, nil, false)
+	d.addManual("203.0.113.9:8333")
+	d.addManual("node.example.com:8333")
+	resolve := d.resolver(func(string) ([]net.IP, error) { return []net.IP{net.ParseIP("203.0.113.10")}, nil })
+	if _, err := resolve("node.example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	connected := []string{"203.0.113.1:8333", "203.0.113.2:8333", "203.0.113.9:8333", "192.168.1.1:8333"}
+	dial := d.dialer(func(net.Addr) (net.Conn, error) { return nil, nil }, func() []string { return connected })
+
+	tests := []struct {
+		name string
+		addr string
+		full bool
+	}{
+		{"group at the limit", "203.0.113.3:8333", true},
+		{"other group", "198.51.100.1:8333", false},
+		{"configured peer", "203.0.113.9:8333", false},
+		{"configured host name", "203.0.113.10:8333", false},
+		{"local peer", "192.168.1.2:8333", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := net.ResolveTCPAddr("tcp", tt.addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn, err := dial(addr)
+			if err != nil {
+				t.Fatalf("dial(%s) = %v", tt.addr, err)
+			}
+			if _, full := conn.(refusedConn); full != tt.full {
+				t.Errorf("dial(%s) refused: %v, want %v", tt.addr, full, tt.full)
+			}
+		})
+	}
+}
+
+func TestDiversityReport(t *testing.T) {
+	d := newDiversity(2, nil, true)
+
+	report := d.report([]string{"203.0.113.1:8333", "203.0.113.2:8333", "203.0.113.3:8333"})
+	if report.Groups != 1 || report.Networks[networkIPv4] != 3 || report.Diverse {
+		t.Errorf("report() = %+v, want a single IPv4 group", report)
+	}
+	want := []string{"all peers are in network group 203.0.0.0/16", "3 peers in network group 203.0.0.0/16", "no onion peer connected"}
+	if !slices.Equal(report.Warnings, want) {
+		t.Errorf("report() warnings = %q, want %q", report.Warnings, want)
+	}
+
+	report = d.report([]string{"203.0.113.1:8333", "198.51.100.1:8333", "abcdefghijklmnop.onion:8333"})
+	if report.Groups != 3 || !report.Diverse || len(report.Warnings) != 0 {
+		t.Errorf("report() of diverse peers = %+v", report)
+	}
+
+	if report := d.report(nil); report.Diverse || !slices.Equal(report.Warnings, []string{"no peers connected"}) {
+		t.Errorf("report() without peers = %+v", report)
+	}
+}
+
+func TestAnnouncedAddrs(t *testing.T) {
+	d := newDiversity(2, nil, true)
+	msg := wire.NewMsgAddr()
+	_ = msg.AddAddress(wire.NewNetAddressIPPort(net.ParseIP("203.0.113.1"), 8333, wire.SFNodeNetwork|wire.SFNodeWitness|wire.SFNodeCF))
+	_ = msg.AddAddress(wire.NewNetAddressIPPort(net.ParseIP("203.0.113.2"), 8333, wire.SFNodeNetwork))
+	_ = msg.AddAddress(wire.NewNetAddressIPPort(net.ParseIP("192.168.1.1"), 8333, wire.SFNodeNetwork|wire.SFNodeWitness|wire.SFNodeCF))
+	d.announce(msg)
+
+	if got := d.takeAnnounced(networkClearnet); got != "203.0.113.1:8333" {
+		t.Errorf("takeAnnounced() = %q, want the filter-serving public peer", got)
+	}
+	if got := d.takeAnnounced(networkClearnet); got != "" {
+		t.Errorf("takeAnnounced() = %q once taken, want none", got)
+	}
+	if got := d.takeAnnounced(networkOnion); got != "" {
+		t.Errorf("takeAnnounced(onion) = %q, want none", got)
+	}
+}
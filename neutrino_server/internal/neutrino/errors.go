@@ -1,6 +1,9 @@
 package neutrino
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // NotFoundError represents an error when a requested resource is not found.
 // This should result in HTTP 404 responses.
@@ -38,3 +41,77 @@ func (e *BadRequestError) Error() string {
 func NewBadRequestError(message string) *BadRequestError {
 	return &BadRequestError{Message: message}
 }
+
+// ConflictError represents a request that conflicts with the current state
+// of a resource. This should result in HTTP 409 responses.
+type ConflictError struct {
+	Message string
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+// NewConflictError creates a new ConflictError.
+func NewConflictError(message string) *ConflictError {
+	return &ConflictError{Message: message}
+}
+
+// BusyError is returned when a request cannot be taken on until running
+// work finishes. This should result in HTTP 429 responses.
+type BusyError struct {
+	Message string
+}
+
+func (e *BusyError) Error() string {
+	return e.Message
+}
+
+// NewBusyError creates a new BusyError.
+func NewBusyError(message string) *BusyError {
+	return &BusyError{Message: message}
+}
+
+// IncompleteScanError is returned by strict scans when some blocks could not
+// be checked. The scan can be retried once peers serve the missing data.
+// This should result in HTTP 503 responses.
+type IncompleteScanError struct {
+	Skipped []HeightRange
+}
+
+func (e *IncompleteScanError) Error() string {
+	return fmt.Sprintf("scan incomplete: could not check blocks %s", formatRanges(e.Skipped))
+}
+
+// FiltersNotSyncedError is returned by scans asked to check blocks whose
+// filter headers are not synced yet. The scan can be retried once filter
+// sync catches up. This should result in HTTP 503 responses.
+type FiltersNotSyncedError struct {
+	Height       int32
+	FilterHeight int32
+}
+
+func (e *FiltersNotSyncedError) Error() string {
+	return fmt.Sprintf("filters are synced to height %d, not yet to %d", e.FilterHeight, e.Height)
+}
+
+// ScanDeadlineError is returned by scans that reached the deadline of their
+// request before finishing. Blocks below ResumeHeight were checked, so the
+// scan can be continued with a start height of ResumeHeight. This should
+// result in HTTP 504 responses.
+type ScanDeadlineError struct {
+	ResumeHeight int32
+
+	// Heights are the heights below ResumeHeight whose filters matched, for
+	// filter matches.
+	Heights []int32
+}
+
+func (e *ScanDeadlineError) Error() string {
+	return fmt.Sprintf("scan deadline exceeded, resume from height %d", e.ResumeHeight)
+}
+
+// Unwrap lets callers match the error with context.DeadlineExceeded.
+func (e *ScanDeadlineError) Unwrap() error {
+	return context.DeadlineExceeded
+}
@@ -0,0 +1,230 @@
+package neutrino
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// DefaultWallet is the wallet that addresses watched without an explicit
+// wallet belong to.
+const DefaultWallet = "default"
+
+// Event types recorded in wallet event streams.
+const (
+	// EventUTXOReceived is emitted when a scan finds an output paying a
+	// watched address. Data is the UTXO.
+	EventUTXOReceived = "utxo_received"
+
+	// EventUTXOSpent is emitted when a scan finds a known UTXO spent. Data
+	// is the spent UTXO.
+	EventUTXOSpent = "utxo_spent"
+
+	// EventRescanFinished is emitted when a rescan job covering one of the
+	// wallet's addresses ends. Data is a RescanFinished.
+	EventRescanFinished = "rescan_finished"
+
+	// EventUncleanShutdown is emitted to every wallet when the node starts
+	// after a crash. Data is a CrashReport.
+	EventUncleanShutdown = "unclean_shutdown"
+
+	// EventReorg is emitted to every wallet when blocks seen by the node are
+	// replaced by a reorg. Data is a Reorg.
+	EventReorg = "reorg"
+
+	// EventDoubleSpend is emitted to every wallet when a block spends an
+	// input of a transaction broadcast by the node with another
+	// transaction. Data is a DoubleSpend.
+	EventDoubleSpend = "double_spend"
+)
+
+const (
+	// maxEventsPerWallet is the number of most recent events retained per
+	// wallet; older events are pruned as new ones are appended.
+	maxEventsPerWallet = 10000
+
+	// maxEventsPage is the largest number of events returned by one query.
+	maxEventsPage = 1000
+)
+
+// walletNamePattern restricts wallet names to URL and bucket safe strings.
+var walletNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Event is an entry in a wallet's event stream. Seq is assigned per wallet, so
+// each wallet's stream has its own independent cursor.
+type Event struct {
+	Seq    uint64          `json:"seq"`
+	Wallet string          `json:"wallet"`
+	Type   string          `json:"type"`
+	Time   int64           `json:"time"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// RescanFinished is the payload of an EventRescanFinished event.
+type RescanFinished struct {
+	JobID       uint64   `json:"job_id"`
+	Addresses   []string `json:"addresses"`
+	StartHeight int32    `json:"start_height"`
+	EndHeight   int32    `json:"end_height"`
+	Error       string   `json:"error,omitempty"`
+
+	// Metrics describes the throughput of the run that finished the job. It
+	// is omitted if the job could not be started.
+	Metrics *ScanMetrics `json:"metrics,omitempty"`
+}
+
+// ValidateWalletName returns a BadRequestError if name is not a valid wallet
+// name.
+func ValidateWalletName(name string) error {
+	if !walletNamePattern.MatchString(name) {
+		return NewBadRequestError(fmt.Sprintf("invalid wallet name %q: use 1-64 letters, digits, '_' or '-'", name))
+	}
+	return nil
+}
+
+// newEvent creates an event of the given type for wallet.
+func newEvent(wallet, eventType string, data any) (Event, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+	return Event{
+		Wallet: wallet,
+		Type:   eventType,
+		Time:   time.Now().Unix(),
+		Data:   payload,
+	}, nil
+}
+
+// walletsFor returns the wallets the address belongs to. Callers must hold mu.
+func (r *RescanManager) walletsFor(address string) []string {
+	if wallets := r.addrWallets[address]; len(wallets) > 0 {
+		return wallets
+	}
+	return []string{DefaultWallet}
+}
+
+// addressEvents creates an event for every wallet containing address.
+// Callers must hold mu.
+func (r *RescanManager) addressEvents(address, eventType string, data any) []Event {
+	var events []Event
+	for _, wallet := range r.walletsFor(address) {
+		event, err := newEvent(wallet, eventType, data)
+		if err != nil {
+			r.logger.Warnf("Failed to create %s event: %v", eventType, err)
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// EventObserver is called with every event emitted to a wallet stream.
+type EventObserver func(event Event)
+
+// emit appends events to their wallets' streams and passes them to event
+// observers. Events are only recorded when a store is configured; failures
+// are logged rather than failing scans.
+func (r *RescanManager) emit(events []Event) {
+	if r.store != nil {
+		for i := range events {
+			if err := r.store.AppendEvent(&events[i]); err != nil {
+				r.logger.Warnf("Failed to record %s event for wallet %s: %v", events[i].Type, logging.KV("wallet", events[i].Wallet), err)
+			}
+		}
+	}
+
+	r.observersMu.RLock()
+	defer r.observersMu.RUnlock()
+	for _, event := range events {
+		for _, fn := range r.eventObservers {
+			fn(event)
+		}
+	}
+}
+
+// emitRescanFinished records the outcome of job in the stream of every wallet
+// containing one of its addresses.
+func (r *RescanManager) emitRescanFinished(job *RescanJob, jobErr error, metrics *ScanMetrics) {
+	finished := RescanFinished{
+		JobID:       job.ID,
+		Addresses:   job.Addresses,
+		StartHeight: job.StartHeight,
+		EndHeight:   job.EndHeight,
+		Metrics:     metrics,
+	}
+	if jobErr != nil {
+		finished.Error = jobErr.Error()
+	}
+
+	r.mu.RLock()
+	var wallets []string
+	for _, address := range job.Addresses {
+		for _, wallet := range r.walletsFor(address) {
+			if !slices.Contains(wallets, wallet) {
+				wallets = append(wallets, wallet)
+			}
+		}
+	}
+	r.mu.RUnlock()
+
+	var events []Event
+	for _, wallet := range wallets {
+		event, err := newEvent(wallet, EventRescanFinished, finished)
+		if err != nil {
+			r.logger.Warnf("Failed to create %s event: %v", EventRescanFinished, err)
+			continue
+		}
+		events = append(events, event)
+	}
+	r.emit(events)
+}
+
+// emitToAllWallets records an event of the given type in the stream of every
+// wallet, including DefaultWallet.
+func (r *RescanManager) emitToAllWallets(eventType string, data any) {
+	r.mu.RLock()
+	wallets := []string{DefaultWallet}
+	for _, addrWallets := range r.addrWallets {
+		for _, wallet := range addrWallets {
+			if !slices.Contains(wallets, wallet) {
+				wallets = append(wallets, wallet)
+			}
+		}
+	}
+	r.mu.RUnlock()
+
+	var events []Event
+	for _, wallet := range wallets {
+		event, err := newEvent(wallet, eventType, data)
+		if err != nil {
+			r.logger.Warnf("Failed to create %s event: %v", eventType, err)
+			continue
+		}
+		events = append(events, event)
+	}
+	r.emit(events)
+}
+
+// Events returns up to limit events from wallet's stream with a sequence
+// number greater than after.
+func (r *RescanManager) Events(wallet string, after uint64, limit int) ([]Event, error) {
+	if err := ValidateWalletName(wallet); err != nil {
+		return nil, err
+	}
+
+	if r.store == nil {
+		return nil, errors.New("event streams require a store")
+	}
+
+	if limit <= 0 || limit > maxEventsPage {
+		limit = maxEventsPage
+	}
+
+	return r.store.Events(wallet, after, limit)
+}
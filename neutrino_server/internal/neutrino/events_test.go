@@ -0,0 +1,144 @@
+package neutrino
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btclog"
+)
+
+func TestWalletEventStreams(t *testing.T) {
+	store := newTestStore(t)
+	mgr := &RescanManager{
+		chainParams:    &chaincfg.MainNetParams,
+		store:          store,
+		logger:         btclog.Disabled,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
+	}
+
+	shared := "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	shopOnly := "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S"
+	unassigned := "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"
+
+	for _, watch := range []struct{ address, wallet string }{
+		{shared, "shop"},
+		{shared, "exchange"},
+		{shopOnly, "shop"},
+		{unassigned, ""},
+	} {
+		if err := mgr.WatchAddressInWallet(watch.address, watch.wallet); err != nil {
+			t.Fatalf("WatchAddressInWallet(%s, %s) failed: %v", watch.address, watch.wallet, err)
+		}
+	}
+
+	// Auto-watching an assigned address must not add it to the default wallet
+	if err := mgr.WatchAddress(shared); err != nil {
+		t.Fatalf("WatchAddress() failed: %v", err)
+	}
+
+	job := &RescanJob{Addresses: []string{shared, shopOnly, unassigned}, CheckpointHeight: -1}
+	found := map[string]UTXO{
+		"tx1:0": {TxID: "tx1", Vout: 0, Value: 1000, Address: shared, Height: 10},
+		"tx2:0": {TxID: "tx2", Vout: 0, Value: 2000, Address: shopOnly, Height: 11},
+		"tx3:0": {TxID: "tx3", Vout: 0, Value: 3000, Address: unassigned, Height: 12},
+	}
+	if err := mgr.commitScanProgress(job, 999, job.Addresses, found, map[string]Spend{}); err != nil {
+		t.Fatalf("commitScanProgress() failed: %v", err)
+	}
+	if err := mgr.commitScanProgress(job, 1999, job.Addresses, map[string]UTXO{}, map[string]Spend{"tx2:0": {}}); err != nil {
+		t.Fatalf("commitScanProgress() failed: %v", err)
+	}
+	mgr.emitRescanFinished(job, nil, &ScanMetrics{BlocksScanned: 2000})
+
+	tests := []struct {
+		wallet    string
+		wantTypes []string
+	}{
+		// Map iteration order is random, so only the per-wallet counts by
+		// type are compared
+		{"shop", []string{EventUTXOReceived, EventUTXOReceived, EventUTXOSpent, EventRescanFinished}},
+		{"exchange", []string{EventUTXOReceived, EventRescanFinished}},
+		{DefaultWallet, []string{EventUTXOReceived, EventRescanFinished}},
+		{"unknown", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wallet, func(t *testing.T) {
+			events, err := mgr.Events(tt.wallet, 0, 0)
+			if err != nil {
+				t.Fatalf("Events() failed: %v", err)
+			}
+
+			if len(events) != len(tt.wantTypes) {
+				t.Fatalf("expected %d events, got %d: %+v", len(tt.wantTypes), len(events), events)
+			}
+
+			counts := make(map[string]int)
+			for i, event := range events {
+				// Each wallet has its own sequence starting at 1
+				if event.Seq != uint64(i+1) {
+					t.Errorf("event %d has seq %d, want %d", i, event.Seq, i+1)
+				}
+				if event.Wallet != tt.wallet {
+					t.Errorf("event %d has wallet %s, want %s", i, event.Wallet, tt.wallet)
+				}
+				counts[event.Type]++
+			}
+			for _, eventType := range tt.wantTypes {
+				counts[eventType]--
+			}
+			for eventType, n := range counts {
+				if n != 0 {
+					t.Errorf("unexpected number of %s events (off by %d)", eventType, n)
+				}
+			}
+		})
+	}
+
+	// Replaying from a cursor only returns later events
+	events, err := mgr.Events("shop", 2, 1)
+	if err != nil {
+		t.Fatalf("Events() failed: %v", err)
+	}
+	if len(events) != 1 || events[0].Seq != 3 || events[0].Type != EventUTXOSpent {
+		t.Fatalf("expected the spend as event 3, got %+v", events)
+	}
+
+	var spent UTXO
+	if err := json.Unmarshal(events[0].Data, &spent); err != nil || spent.TxID != "tx2" {
+		t.Errorf("expected tx2 in spend payload, got %s (%v)", events[0].Data, err)
+	}
+
+	// Wallet membership survives a restart
+	restored := &RescanManager{
+		chainParams:    &chaincfg.MainNetParams,
+		store:          store,
+		logger:         btclog.Disabled,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
+	}
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+	if got := restored.walletsFor(shared); len(got) != 2 {
+		t.Errorf("expected 2 wallets for shared address after restore, got %v", got)
+	}
+}
+
+func TestWatchAddressInvalidWallet(t *testing.T) {
+	mgr := &RescanManager{
+		chainParams:    &chaincfg.MainNetParams,
+		logger:         btclog.Disabled,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
+	}
+
+	var badRequestErr *BadRequestError
+	err := mgr.WatchAddressInWallet("1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "no/slashes")
+	if !errors.As(err, &badRequestErr) {
+		t.Errorf("expected BadRequestError, got %v", err)
+	}
+}
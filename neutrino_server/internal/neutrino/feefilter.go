@@ -0,0 +1,114 @@
+package neutrino
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightninglabs/neutrino/query"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// peerFeeFilters holds the minimum fee rates connected peers advertised in
+// feefilter messages, in sat/kvB by peer address.
+type peerFeeFilters struct {
+	mu    sync.Mutex
+	rates map[string]int64
+}
+
+func newPeerFeeFilters() *peerFeeFilters {
+	return &peerFeeFilters{rates: make(map[string]int64)}
+}
+
+// set records the feefilter of the peer at addr.
+func (f *peerFeeFilters) set(addr string, satPerKVByte int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rates[addr] = satPerKVByte
+}
+
+// remove forgets the feefilter of a disconnected peer.
+func (f *peerFeeFilters) remove(addr string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.rates, addr)
+}
+
+// minRelayFee returns the lowest rate in sat/vB that at least half of the
+// peers with a feefilter relay, or nil if no peer sent one. Half rather than
+// all, since a peer still in its initial sync filters out everything.
+func (f *peerFeeFilters) minRelayFee() *float64 {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	rates := make([]int64, 0, len(f.rates))
+	for _, rate := range f.rates {
+		rates = append(rates, rate)
+	}
+	f.mu.Unlock()
+	if len(rates) == 0 {
+		return nil
+	}
+
+	slices.Sort(rates)
+	rate := float64(rates[(len(rates)-1)/2]) / 1000
+	return &rate
+}
+
+// watchPeers records the feefilter messages, the filters served and the
+// addresses announced of every peer as it connects, until the node stops.
+func (n *Node) watchPeers() {
+	peers, cancel, err := n.chainService.ConnectedPeers()
+	if err != nil {
+		n.logger.Warnf("Failed to subscribe to peer connections: %v", err)
+		return
+	}
+	defer cancel()
+
+	for {
+		select {
+		case <-n.lifetime.Done():
+			return
+		case peer := <-peers:
+			n.wg.Go(func() { n.watchPeer(peer) })
+		}
+	}
+}
+
+// watchPeer records the feefilter messages, the filters served and the
+// addresses announced of peer until it disconnects or the node stops, then
+// forgets its score.
+func (n *Node) watchPeer(peer query.Peer) {
+	msgs, cancel := peer.SubscribeRecvMsg()
+	defer cancel()
+	defer n.feeFilters.remove(peer.Addr())
+	defer n.peerScores.remove(peer.Addr())
+
+	for {
+		select {
+		case msg := <-msgs:
+			switch msg := msg.(type) {
+			case *wire.MsgFeeFilter:
+				if msg.MinFee < 0 || msg.MinFee > btcutil.MaxSatoshi {
+					continue
+				}
+				n.logger.Debugf("Peer %s relays transactions paying at least %d sat/kvB", logging.KV("peer", peer.Addr()), msg.MinFee)
+				n.feeFilters.set(peer.Addr(), msg.MinFee)
+
+			case *wire.MsgCFilter:
+				n.peerScores.recordFilter(peer.Addr())
+
+			case *wire.MsgAddr, *wire.MsgAddrV2:
+				n.diversity.announce(msg)
+			}
+
+		case <-peer.OnDisconnect():
+			return
+		case <-n.lifetime.Done():
+			return
+		}
+	}
+}
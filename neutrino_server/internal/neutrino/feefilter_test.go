@@ -0,0 +1,93 @@
+package neutrino
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+)
+
+// fakePeer is a connected peer whose received messages are sent on msgs.
+type fakePeer struct {
+	addr         string
+	msgs         chan wire.Message
+	disconnected chan struct{}
+}
+
+func (p *fakePeer) QueueMessageWithEncoding(wire.Message, chan<- struct{}, wire.MessageEncoding) {}
+func (p *fakePeer) SubscribeRecvMsg() (<-chan wire.Message, func())                              { return p.msgs, func() {} }
+func (p *fakePeer) Addr() string                                                                 { return p.addr }
+func (p *fakePeer) OnDisconnect() <-chan struct{}                                                { return p.disconnected }
+
+func TestMinRelayFee(t *testing.T) {
+	tests := []struct {
+		name  string
+		rates map[string]int64
+		want  float64
+		none  bool
+	}{
+		{"no feefilter", map[string]int64{}, 0, true},
+		{"one peer", map[string]int64{"a": 1000}, 1, false},
+		{"half the peers", map[string]int64{"a": 1000, "b": 2500, "c": 5000, "d": 100000}, 2.5, false},
+		{"peer in initial sync", map[string]int64{"a": 1000, "b": 1000, "c": 2100000000000000}, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := newPeerFeeFilters()
+			for addr, rate := range tt.rates {
+				filters.set(addr, rate)
+			}
+			got := filters.minRelayFee()
+			if tt.none {
+				if got != nil {
+					t.Errorf("minRelayFee() = %v, want nil", *got)
+				}
+				return
+			}
+			if got == nil || *got != tt.want {
+				t.Errorf("minRelayFee() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	filters := newPeerFeeFilters()
+	filters.set("a", 1000)
+	filters.remove("a")
+	if got := filters.minRelayFee(); got != nil {
+		t.Errorf("minRelayFee() after the peer disconnected = %v, want nil", *got)
+	}
+}
+
+// TestWatchPeerStops tests that watching a peer ends when the node stops,
+// forgetting the peer's feefilter.
+func TestWatchPeerStops(t *testing.T) {
+	lifetime, stop := context.WithCancel(context.Background())
+	n := &Node{
+		lifetime:   lifetime,
+		stop:       stop,
+		logger:     btclog.Disabled,
+		feeFilters: newPeerFeeFilters(),
+		peerScores: newPeerScores(),
+	}
+	peer := &fakePeer{addr: "peer:8333", msgs: make(chan wire.Message), disconnected: make(chan struct{})}
+
+	done := make(chan struct{})
+	go func() {
+		n.watchPeer(peer)
+		close(done)
+	}()
+	peer.msgs <- &wire.MsgFeeFilter{MinFee: 1000}
+	stop()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watchPeer() did not return when the node stopped")
+	}
+	if got := n.feeFilters.minRelayFee(); got != nil {
+		t.Errorf("minRelayFee() = %v after the peer was forgotten, want nil", *got)
+	}
+}
@@ -0,0 +1,486 @@
+package neutrino
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightninglabs/neutrino"
+	"github.com/lightninglabs/neutrino/headerfs"
+)
+
+// Fee estimator names accepted by FeeConfig.Estimator.
+const (
+	FeeEstimatorStatic          = "static"
+	FeeEstimatorBlockPercentile = "block-percentile"
+	FeeEstimatorMempoolSpace    = "mempool-space"
+	FeeEstimatorBitcoind        = "bitcoind"
+)
+
+const (
+	// DefaultStaticFeeRate is the rate returned by the static estimator, in
+	// sat/vB.
+	DefaultStaticFeeRate = 1.0
+
+	// DefaultFeeBlocks is the number of recent blocks sampled by the
+	// block-percentile estimator.
+	DefaultFeeBlocks = 6
+
+	// DefaultMempoolSpaceURL is the mempool.space instance queried by default.
+	DefaultMempoolSpaceURL = "https://mempool.space"
+
+	// DefaultFeeCacheTTL is how long an external estimator's rates are
+	// reused before it is queried again.
+	DefaultFeeCacheTTL = time.Minute
+
+	// maxFeeTarget is the largest confirmation target accepted, matching
+	// bitcoind's estimatesmartfee.
+	maxFeeTarget = 1008
+
+	// feeRequestTimeout bounds a single estimate, including provider calls.
+	feeRequestTimeout = 10 * time.Second
+
+	// feeRefreshTimeout bounds a background refresh of the estimates after
+	// new blocks.
+	feeRefreshTimeout = time.Minute
+)
+
+// FeeConfig selects and configures the fee estimator.
+type FeeConfig struct {
+	// Estimator is one of the FeeEstimator* names. Empty selects
+	// block-percentile.
+	Estimator string
+
+	// StaticRate is the rate returned by the static estimator, in sat/vB.
+	StaticRate float64
+
+	// Blocks is the number of recent blocks sampled by block-percentile.
+	Blocks int
+
+	// MempoolURL is the base URL of a mempool.space compatible API.
+	MempoolURL string
+
+	// BitcoindURL, BitcoindUser and BitcoindPassword address the bitcoind
+	// JSON-RPC server used by the bitcoind estimator.
+	BitcoindURL      string
+	BitcoindUser     string
+	BitcoindPassword string
+
+	// CacheTTL is how long the rates of an external estimator are reused.
+	// Zero disables the cache.
+	CacheTTL time.Duration
+
+	// Fallback answers with the block-percentile estimator when an
+	// external estimator fails.
+	Fallback bool
+}
+
+// FeeEstimator estimates the fee rate needed to confirm within a number of
+// blocks.
+type FeeEstimator interface {
+	// Name identifies the estimator in API responses.
+	Name() string
+
+	// EstimateFee returns a fee rate in sat/vB for confirmation within
+	// targetBlocks blocks.
+	EstimateFee(ctx context.Context, targetBlocks int) (float64, error)
+}
+
+// FeeEstimate is a fee rate estimate and the estimator that produced it.
+type FeeEstimate struct {
+	TargetBlocks int     `json:"target_blocks"`
+	SatPerVByte  float64 `json:"sat_per_vbyte"`
+	Estimator    string  `json:"estimator"`
+
+	// Source is the estimator that produced the rate: Estimator, or the
+	// fallback if Estimator failed.
+	Source string `json:"source"`
+
+	// MinRelayFee is the lowest rate in sat/vB relayed by at least half of
+	// the peers that sent a feefilter. It is omitted if none did.
+	MinRelayFee *float64 `json:"min_relay_fee,omitempty"`
+}
+
+// EstimateFee returns a fee rate for confirmation within targetBlocks blocks
+// from the configured estimator.
+func (n *Node) EstimateFee(targetBlocks int) (*FeeEstimate, error) {
+	if n.feeEstimator == nil {
+		return nil, errors.New("fee estimator not initialized")
+	}
+
+	if targetBlocks < 1 || targetBlocks > maxFeeTarget {
+		return nil, NewBadRequestError(fmt.Sprintf("target_blocks must be between 1 and %d", maxFeeTarget))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), feeRequestTimeout)
+	defer cancel()
+
+	source := n.feeEstimator
+	rate, err := source.EstimateFee(ctx, targetBlocks)
+	if err != nil && n.feeFallback != nil {
+		n.logger.Warnf("%s fee estimator failed, falling back to %s: %v", source.Name(), n.feeFallback.Name(), err)
+		source = n.feeFallback
+
+		// The failed attempt may have used up the request's deadline
+		fallbackCtx, fallbackCancel := context.WithTimeout(context.Background(), feeRequestTimeout)
+		defer fallbackCancel()
+		rate, err = source.EstimateFee(fallbackCtx, targetBlocks)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s fee estimator failed: %w", source.Name(), err)
+	}
+
+	return &FeeEstimate{
+		TargetBlocks: targetBlocks,
+		SatPerVByte:  rate,
+		Estimator:    n.feeEstimator.Name(),
+		Source:       source.Name(),
+		MinRelayFee:  n.feeFilters.minRelayFee(),
+	}, nil
+}
+
+// newFeeEstimator builds the estimator selected by config, and the estimator
+// falling back for it if any. Public fee providers are reached through
+// torProxies when it is set. External estimators have their rates cached
+// for config.CacheTTL.
+func newFeeEstimator(config FeeConfig, source feeBlockSource, params *chaincfg.Params, torProxies *torProxyPool) (FeeEstimator, FeeEstimator, error) {
+	estimator, err := newBaseFeeEstimator(config, source, params, torProxies)
+	if err != nil {
+		return nil, nil, err
+	}
+	if estimator.Name() != FeeEstimatorMempoolSpace && estimator.Name() != FeeEstimatorBitcoind {
+		return estimator, nil, nil
+	}
+
+	if config.CacheTTL > 0 {
+		estimator = newCachedFeeEstimator(estimator, config.CacheTTL)
+	}
+	if !config.Fallback {
+		return estimator, nil, nil
+	}
+	fallback, err := newBaseFeeEstimator(FeeConfig{Estimator: FeeEstimatorBlockPercentile, Blocks: config.Blocks}, source, params, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return estimator, fallback, nil
+}
+
+// newBaseFeeEstimator builds the estimator selected by config, without a
+// cache.
+func newBaseFeeEstimator(config FeeConfig, source feeBlockSource, params *chaincfg.Params, torProxies *torProxyPool) (FeeEstimator, error) {
+	switch config.Estimator {
+	case FeeEstimatorStatic:
+		rate := config.StaticRate
+		if rate <= 0 {
+			rate = DefaultStaticFeeRate
+		}
+		return staticFeeEstimator(rate), nil
+
+	case "", FeeEstimatorBlockPercentile:
+		blocks := config.Blocks
+		if blocks <= 0 {
+			blocks = DefaultFeeBlocks
+		}
+		return &percentileFeeEstimator{source: source, params: params, blocks: blocks}, nil
+
+	case FeeEstimatorMempoolSpace:
+		baseURL := config.MempoolURL
+		if baseURL == "" {
+			baseURL = DefaultMempoolSpaceURL
+		}
+		client := &http.Client{Timeout: feeRequestTimeout}
+		if torProxies != nil {
+			client.Transport = &http.Transport{DialContext: torProxies.DialContext}
+		}
+		return &mempoolSpaceEstimator{baseURL: baseURL, client: client}, nil
+
+	case FeeEstimatorBitcoind:
+		if config.BitcoindURL == "" {
+			return nil, errors.New("the bitcoind fee estimator requires an RPC URL")
+		}
+		return &bitcoindFeeEstimator{
+			url:      config.BitcoindURL,
+			user:     config.BitcoindUser,
+			password: config.BitcoindPassword,
+			// The RPC server is usually local, where Tor cannot reach it
+			client: &http.Client{Timeout: feeRequestTimeout},
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown fee estimator %q: use %s, %s, %s or %s", config.Estimator,
+			FeeEstimatorStatic, FeeEstimatorBlockPercentile, FeeEstimatorMempoolSpace, FeeEstimatorBitcoind)
+	}
+}
+
+// feeRefresher is implemented by estimators that compute their estimates
+// from new blocks ahead of requests.
+type feeRefresher interface {
+	refresh(ctx context.Context) error
+}
+
+// refreshFeeEstimates lets the fee estimator catch up with new blocks in the
+// background.
+func (n *Node) refreshFeeEstimates() {
+	refresher, ok := n.feeEstimator.(feeRefresher)
+	if !ok {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), feeRefreshTimeout)
+		defer cancel()
+		if err := refresher.refresh(ctx); err != nil {
+			n.logger.Debugf("Failed to refresh fee estimates: %v", err)
+		}
+	}()
+}
+
+// staticFeeEstimator always returns the same rate.
+type staticFeeEstimator float64
+
+// Name implements FeeEstimator.
+func (s staticFeeEstimator) Name() string {
+	return FeeEstimatorStatic
+}
+
+// EstimateFee implements FeeEstimator.
+func (s staticFeeEstimator) EstimateFee(context.Context, int) (float64, error) {
+	return float64(s), nil
+}
+
+// feeBlockSource provides the recent blocks sampled by the block-percentile
+// estimator. It is satisfied by *neutrino.ChainService.
+type feeBlockSource interface {
+	BestBlock() (*headerfs.BlockStamp, error)
+	GetBlockHash(height int64) (*chainhash.Hash, error)
+	GetBlock(hash chainhash.Hash, options ...neutrino.QueryOption) (*btcutil.Block, error)
+}
+
+// percentileFeeEstimator derives fee rates from the transactions of recent
+// blocks. A light client cannot see prevout values in general, so a
+// transaction is priced exactly only when every output it spends was created
+// in the sampled blocks. The rest of each block's fees, taken from its
+// coinbase as the reward minus the subsidy, is spread evenly over its
+// unpriced transactions. Shorter targets use higher percentiles of those
+// rates, weighted by vsize.
+type percentileFeeEstimator struct {
+	source feeBlockSource
+	params *chaincfg.Params
+	blocks int
+
+	// cache holds the analyzed blocks of the sampled window by height, and
+	// samples their rates at tipHeight sorted by rate.
+	mu        sync.Mutex
+	cache     map[int32]*feeBlock
+	tipHeight int32
+	samples   []feeSample
+}
+
+// feeSample is a fee rate in sat/vB paid by weight units of block space.
+type feeSample struct {
+	rate   float64
+	weight int64
+}
+
+// feeBlock is a sampled block: the fee rates its transactions paid and the
+// values of the outputs it created, which price spends in later blocks.
+type feeBlock struct {
+	hash    chainhash.Hash
+	samples []feeSample
+	outputs map[wire.OutPoint]int64
+}
+
+// Name implements FeeEstimator.
+func (p *percentileFeeEstimator) Name() string {
+	return FeeEstimatorBlockPercentile
+}
+
+// EstimateFee implements FeeEstimator.
+func (p *percentileFeeEstimator) EstimateFee(ctx context.Context, targetBlocks int) (float64, error) {
+	samples, err := p.feeSamples(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(samples) == 0 {
+		return 0, errors.New("no recent blocks to sample")
+	}
+
+	return weightedPercentile(samples, feeTargetPercentile(targetBlocks)), nil
+}
+
+// refresh analyzes the blocks connected since the last estimate, so the next
+// one is answered from the cache.
+func (p *percentileFeeEstimator) refresh(ctx context.Context) error {
+	_, err := p.feeSamples(ctx)
+	return err
+}
+
+// feeSamples returns the sorted fee samples of the most recent blocks. Blocks
+// are fetched and analyzed once; when the tip changes only the new blocks, or
+// those replaced by a reorg, are fetched.
+func (p *percentileFeeEstimator) feeSamples(ctx context.Context) ([]feeSample, error) {
+	best, err := p.source.BestBlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get best block: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.samples != nil && p.tipHeight == best.Height {
+		return p.samples, nil
+	}
+	if p.cache == nil {
+		p.cache = make(map[int32]*feeBlock)
+	}
+
+	from := max(1, best.Height-int32(p.blocks)+1)
+	for height := range p.cache {
+		if height < from || height > best.Height {
+			delete(p.cache, height)
+		}
+	}
+
+	// Blocks are analyzed oldest first, so spends of outputs created in the
+	// window are priced. A replaced block invalidates the ones above it.
+	stale := false
+	for height := from; height <= best.Height; height++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		hash, err := p.source.GetBlockHash(int64(height))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get block hash %d: %w", height, err)
+		}
+		if cached, ok := p.cache[height]; ok && !stale && cached.hash == *hash {
+			continue
+		}
+		stale = true
+
+		block, err := p.source.GetBlock(*hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get block %d: %w", height, err)
+		}
+		analyzed := p.analyzeBlock(block, height)
+		analyzed.hash = *hash
+		p.cache[height] = analyzed
+	}
+
+	var samples []feeSample
+	for _, cached := range p.cache {
+		samples = append(samples, cached.samples...)
+	}
+	slices.SortFunc(samples, func(a, b feeSample) int {
+		return cmp.Compare(a.rate, b.rate)
+	})
+	p.tipHeight = best.Height
+	p.samples = samples
+	return samples, nil
+}
+
+// analyzeBlock computes the fee samples of block at height, pricing its
+// transactions from the outputs of the cached blocks below it and of the
+// block itself. Callers must hold mu.
+func (p *percentileFeeEstimator) analyzeBlock(block *btcutil.Block, height int32) *feeBlock {
+	analyzed := &feeBlock{outputs: make(map[wire.OutPoint]int64)}
+	txs := block.Transactions()
+	for _, tx := range txs {
+		for vout, txOut := range tx.MsgTx().TxOut {
+			analyzed.outputs[wire.OutPoint{Hash: *tx.Hash(), Index: uint32(vout)}] = txOut.Value
+		}
+	}
+	if len(txs) < 2 {
+		return analyzed
+	}
+
+	var reward int64
+	for _, txOut := range txs[0].MsgTx().TxOut {
+		reward += txOut.Value
+	}
+	unpricedFees := reward - blockchain.CalcBlockSubsidy(height, p.params)
+
+	var unpricedWeight int64
+	for _, tx := range txs[1:] {
+		weight := blockchain.GetTransactionWeight(tx)
+		fee, ok := p.txFee(tx, height, analyzed)
+		if !ok {
+			unpricedWeight += weight
+			continue
+		}
+		analyzed.samples = append(analyzed.samples, feeSample{rate: feeRate(fee, weight), weight: weight})
+		unpricedFees -= fee
+	}
+
+	if unpricedWeight > 0 && unpricedFees > 0 {
+		analyzed.samples = append(analyzed.samples, feeSample{rate: feeRate(unpricedFees, unpricedWeight), weight: unpricedWeight})
+	}
+	return analyzed
+}
+
+// txFee returns the fee paid by tx in the block at height being analyzed, if
+// every output it spends is known. Callers must hold mu.
+func (p *percentileFeeEstimator) txFee(tx *btcutil.Tx, height int32, analyzed *feeBlock) (int64, bool) {
+	var in int64
+	for _, txIn := range tx.MsgTx().TxIn {
+		value, ok := analyzed.outputs[txIn.PreviousOutPoint]
+		for h := height - 1; !ok && h >= height-int32(p.blocks); h-- {
+			if cached, found := p.cache[h]; found {
+				value, ok = cached.outputs[txIn.PreviousOutPoint]
+			}
+		}
+		if !ok {
+			return 0, false
+		}
+		in += value
+	}
+
+	var out int64
+	for _, txOut := range tx.MsgTx().TxOut {
+		out += txOut.Value
+	}
+	if in < out {
+		return 0, false
+	}
+	return in - out, true
+}
+
+// feeRate returns the rate in sat/vB of fee paid for weight units.
+func feeRate(fee, weight int64) float64 {
+	return float64(fee) / (float64(weight) / blockchain.WitnessScaleFactor)
+}
+
+// feeTargetPercentile maps a confirmation target to the percentile of recent
+// fee rates used: 90 for the next block, 10 lower per extra block, and no
+// lower than 10.
+func feeTargetPercentile(targetBlocks int) float64 {
+	return float64(max(10, 100-10*targetBlocks))
+}
+
+// weightedPercentile returns the p-th percentile of sorted, weighting each
+// sample by its weight: the lowest rate such that at least p percent of the
+// sampled block space paid it or less.
+func weightedPercentile(sorted []feeSample, p float64) float64 {
+	var total int64
+	for _, sample := range sorted {
+		total += sample.weight
+	}
+
+	var cumulative int64
+	for _, sample := range sorted {
+		cumulative += sample.weight
+		if float64(cumulative)*100 >= p*float64(total) {
+			return sample.rate
+		}
+	}
+	return sorted[len(sorted)-1].rate
+}
@@ -0,0 +1,173 @@
+package neutrino
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mempoolSpaceEstimator queries the recommended fees of a mempool.space
+// compatible API.
+type mempoolSpaceEstimator struct {
+	baseURL string
+	client  *http.Client
+}
+
+// Name implements FeeEstimator.
+func (m *mempoolSpaceEstimator) Name() string {
+	return FeeEstimatorMempoolSpace
+}
+
+// EstimateFee implements FeeEstimator. mempool.space only recommends rates
+// for a few horizons, so targets are mapped to the nearest one at or below.
+func (m *mempoolSpaceEstimator) EstimateFee(ctx context.Context, targetBlocks int) (float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(m.baseURL, "/")+"/api/v1/fees/recommended", nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var fees struct {
+		FastestFee  float64 `json:"fastestFee"`
+		HalfHourFee float64 `json:"halfHourFee"`
+		HourFee     float64 `json:"hourFee"`
+		EconomyFee  float64 `json:"economyFee"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&fees); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	switch {
+	case targetBlocks <= 1:
+		return fees.FastestFee, nil
+	case targetBlocks <= 3:
+		return fees.HalfHourFee, nil
+	case targetBlocks <= 6:
+		return fees.HourFee, nil
+	default:
+		return fees.EconomyFee, nil
+	}
+}
+
+// bitcoindFeeEstimator calls estimatesmartfee on a bitcoind JSON-RPC server.
+type bitcoindFeeEstimator struct {
+	url      string
+	user     string
+	password string
+	client   *http.Client
+}
+
+// Name implements FeeEstimator.
+func (b *bitcoindFeeEstimator) Name() string {
+	return FeeEstimatorBitcoind
+}
+
+// EstimateFee implements FeeEstimator.
+func (b *bitcoindFeeEstimator) EstimateFee(ctx context.Context, targetBlocks int) (float64, error) {
+	body, err := json.Marshal(map[string]any{
+		"jsonrpc": "1.0",
+		"id":      "neutrinod",
+		"method":  "estimatesmartfee",
+		"params":  []any{targetBlocks},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.user != "" || b.password != "" {
+		req.SetBasicAuth(b.user, b.password)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// bitcoind reports RPC errors with a 500 status and a JSON body
+	var reply struct {
+		Result *struct {
+			FeeRate float64  `json:"feerate"`
+			Errors  []string `json:"errors"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return 0, fmt.Errorf("failed to decode response (status %s): %w", resp.Status, err)
+	}
+
+	if reply.Error != nil {
+		return 0, fmt.Errorf("estimatesmartfee: %s", reply.Error.Message)
+	}
+	if reply.Result == nil || reply.Result.FeeRate <= 0 {
+		if reply.Result != nil && len(reply.Result.Errors) > 0 {
+			return 0, fmt.Errorf("estimatesmartfee: %s", strings.Join(reply.Result.Errors, "; "))
+		}
+		return 0, errors.New("estimatesmartfee returned no fee rate")
+	}
+
+	// feerate is in BTC/kvB
+	return reply.Result.FeeRate * 1e8 / 1000, nil
+}
+
+// cachedFeeEstimator reuses the rates of an external estimator for ttl, so
+// requests within it do not reach the provider again.
+type cachedFeeEstimator struct {
+	FeeEstimator
+	ttl time.Duration
+
+	mu    sync.Mutex
+	rates map[int]cachedFeeRate
+}
+
+// cachedFeeRate is a rate for a target and when it was fetched.
+type cachedFeeRate struct {
+	rate      float64
+	fetchedAt time.Time
+}
+
+func newCachedFeeEstimator(estimator FeeEstimator, ttl time.Duration) *cachedFeeEstimator {
+	return &cachedFeeEstimator{FeeEstimator: estimator, ttl: ttl, rates: make(map[int]cachedFeeRate)}
+}
+
+// EstimateFee implements FeeEstimator. Failures are not cached.
+func (c *cachedFeeEstimator) EstimateFee(ctx context.Context, targetBlocks int) (float64, error) {
+	c.mu.Lock()
+	cached, ok := c.rates[targetBlocks]
+	c.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < c.ttl {
+		return cached.rate, nil
+	}
+
+	rate, err := c.FeeEstimator.EstimateFee(ctx, targetBlocks)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	c.rates[targetBlocks] = cachedFeeRate{rate: rate, fetchedAt: time.Now()}
+	c.mu.Unlock()
+	return rate, nil
+}
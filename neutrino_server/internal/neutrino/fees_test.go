@@ -0,0 +1,358 @@
+package neutrino
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+	"github.com/lightninglabs/neutrino"
+	"github.com/lightninglabs/neutrino/headerfs"
+)
+
+// fakeFeeBlockSource serves blocks by height, keyed by a hash derived from
+// the height.
+type fakeFeeBlockSource struct {
+	tip     int32
+	blocks  map[int32]*btcutil.Block
+	fetches int
+}
+
+func (f *fakeFeeBlockSource) BestBlock() (*headerfs.BlockStamp, error) {
+	return &headerfs.BlockStamp{Height: f.tip}, nil
+}
+
+func (f *fakeFeeBlockSource) GetBlockHash(height int64) (*chainhash.Hash, error) {
+	return &chainhash.Hash{byte(height)}, nil
+}
+
+func (f *fakeFeeBlockSource) GetBlock(hash chainhash.Hash, _ ...neutrino.QueryOption) (*btcutil.Block, error) {
+	f.fetches++
+	block, ok := f.blocks[int32(hash[0])]
+	if !ok {
+		return nil, fmt.Errorf("no block %s", hash)
+	}
+	return block, nil
+}
+
+// feeTestBlock builds a block at height whose single non-coinbase transaction
+// pays fees satoshis.
+func feeTestBlock(height int32, fees int64, params *chaincfg.Params) *btcutil.Block {
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: wire.MaxPrevOutIndex}, []byte{0x51, 0x51}, nil))
+	coinbase.AddTxOut(wire.NewTxOut(blockchain.CalcBlockSubsidy(height, params)+fees, []byte{0x51}))
+
+	spend := wire.NewMsgTx(wire.TxVersion)
+	spend.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+	spend.AddTxOut(wire.NewTxOut(1000, []byte{0x51}))
+
+	msgBlock := wire.NewMsgBlock(&wire.BlockHeader{})
+	msgBlock.AddTransaction(coinbase)
+	msgBlock.AddTransaction(spend)
+	return btcutil.NewBlock(msgBlock)
+}
+
+func TestNewFeeEstimator(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       FeeConfig
+		wantName     string
+		wantFallback string
+		wantErr      bool
+	}{
+		{"default", FeeConfig{}, FeeEstimatorBlockPercentile, "", false},
+		{"static", FeeConfig{Estimator: FeeEstimatorStatic, Fallback: true}, FeeEstimatorStatic, "", false},
+		{"block percentile", FeeConfig{Estimator: FeeEstimatorBlockPercentile}, FeeEstimatorBlockPercentile, "", false},
+		{"mempool space", FeeConfig{Estimator: FeeEstimatorMempoolSpace}, FeeEstimatorMempoolSpace, "", false},
+		{"mempool space with fallback", FeeConfig{Estimator: FeeEstimatorMempoolSpace, Fallback: true, CacheTTL: time.Minute}, FeeEstimatorMempoolSpace, FeeEstimatorBlockPercentile, false},
+		{"bitcoind", FeeConfig{Estimator: FeeEstimatorBitcoind, BitcoindURL: "http://127.0.0.1:8332"}, FeeEstimatorBitcoind, "", false},
+		{"bitcoind without url", FeeConfig{Estimator: FeeEstimatorBitcoind}, "", "", true},
+		{"unknown", FeeConfig{Estimator: "oracle"}, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			estimator, fallback, err := newFeeEstimator(tt.config, nil, nil, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newFeeEstimator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if estimator.Name() != tt.wantName {
+				t.Errorf("Name() = %q, want %q", estimator.Name(), tt.wantName)
+			}
+			gotFallback := ""
+			if fallback != nil {
+				gotFallback = fallback.Name()
+			}
+			if gotFallback != tt.wantFallback {
+				t.Errorf("fallback = %q, want %q", gotFallback, tt.wantFallback)
+			}
+		})
+	}
+}
+
+func TestStaticFeeEstimator(t *testing.T) {
+	estimator, _, err := newFeeEstimator(FeeConfig{Estimator: FeeEstimatorStatic, StaticRate: 3.5}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rate, err := estimator.EstimateFee(context.Background(), 1)
+	if err != nil || rate != 3.5 {
+		t.Errorf("EstimateFee() = %v, %v; want 3.5, nil", rate, err)
+	}
+}
+
+func TestPercentileFeeEstimator(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+
+	// Each test block's spending transaction has the same vsize, so fees
+	// order the block rates
+	source := &fakeFeeBlockSource{tip: 10, blocks: map[int32]*btcutil.Block{}}
+	for height := int32(1); height <= 10; height++ {
+		source.blocks[height] = feeTestBlock(height, int64(height)*1000, params)
+	}
+	vsize := float64(blockchain.GetTransactionWeight(source.blocks[1].Transactions()[1])) / blockchain.WitnessScaleFactor
+
+	estimator := &percentileFeeEstimator{source: source, params: params, blocks: 5}
+
+	tests := []struct {
+		target int
+		want   float64
+	}{
+		// Blocks 6-10 are sampled: the 90th percentile is block 10, the 40th
+		// block 7 and the 10th block 6
+		{1, 10000 / vsize},
+		{6, 7000 / vsize},
+		{100, 6000 / vsize},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("target %d", tt.target), func(t *testing.T) {
+			rate, err := estimator.EstimateFee(context.Background(), tt.target)
+			if err != nil {
+				t.Fatalf("EstimateFee() failed: %v", err)
+			}
+			if rate != tt.want {
+				t.Errorf("EstimateFee() = %v, want %v", rate, tt.want)
+			}
+		})
+	}
+
+	if source.fetches != 5 {
+		t.Errorf("expected block rates to be cached at the same tip, got %d fetches", source.fetches)
+	}
+
+	// A new block is the only one fetched
+	source.tip = 11
+	source.blocks[11] = feeTestBlock(11, 11000, params)
+	if err := estimator.refresh(context.Background()); err != nil {
+		t.Fatalf("refresh() failed: %v", err)
+	}
+	if source.fetches != 6 {
+		t.Errorf("expected only the new block to be fetched, got %d fetches", source.fetches)
+	}
+	if rate, err := estimator.EstimateFee(context.Background(), 100); err != nil || rate != 7000/vsize {
+		t.Errorf("EstimateFee() after a new block = %v, %v; want %v", rate, err, 7000/vsize)
+	}
+}
+
+func TestPercentileFeeEstimatorPricesSpends(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+
+	// Block 2 spends an output created in block 1 with a 2000 sat fee,
+	// while another transaction pays the remaining 8000 sat of the block's
+	// fees from an unknown prevout
+	source := &fakeFeeBlockSource{tip: 2, blocks: map[int32]*btcutil.Block{
+		1: feeTestBlock(1, 0, params),
+	}}
+	funding := source.blocks[1].Transactions()[1]
+
+	block := feeTestBlock(2, 10000, params)
+	priced := wire.NewMsgTx(wire.TxVersion)
+	priced.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: *funding.Hash()}, nil, nil))
+	priced.AddTxOut(wire.NewTxOut(funding.MsgTx().TxOut[0].Value-2000, []byte{0x51}))
+	block.MsgBlock().AddTransaction(priced)
+	source.blocks[2] = btcutil.NewBlock(block.MsgBlock())
+
+	estimator := &percentileFeeEstimator{source: source, params: params, blocks: 2}
+	samples, err := estimator.feeSamples(context.Background())
+	if err != nil {
+		t.Fatalf("feeSamples() failed: %v", err)
+	}
+
+	weight := blockchain.GetTransactionWeight(btcutil.NewTx(priced))
+	want := []feeSample{
+		{rate: feeRate(2000, weight), weight: weight},
+		{rate: feeRate(8000, weight), weight: weight},
+	}
+	if !slices.Equal(samples, want) {
+		t.Errorf("feeSamples() = %v, want %v", samples, want)
+	}
+}
+
+func TestMempoolSpaceEstimator(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/fees/recommended" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"fastestFee":20,"halfHourFee":15,"hourFee":10,"economyFee":5,"minimumFee":1}`))
+	}))
+	defer server.Close()
+
+	estimator := &mempoolSpaceEstimator{baseURL: server.URL + "/", client: server.Client()}
+
+	tests := []struct {
+		target int
+		want   float64
+	}{
+		{1, 20},
+		{3, 15},
+		{6, 10},
+		{144, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("target %d", tt.target), func(t *testing.T) {
+			rate, err := estimator.EstimateFee(context.Background(), tt.target)
+			if err != nil || rate != tt.want {
+				t.Errorf("EstimateFee() = %v, %v; want %v, nil", rate, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCachedFeeEstimator(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"fastestFee":20,"halfHourFee":15,"hourFee":10,"economyFee":5,"minimumFee":1}`))
+	}))
+	defer server.Close()
+
+	estimator := newCachedFeeEstimator(&mempoolSpaceEstimator{baseURL: server.URL, client: server.Client()}, time.Minute)
+	for range 3 {
+		if rate, err := estimator.EstimateFee(context.Background(), 1); err != nil || rate != 20 {
+			t.Fatalf("EstimateFee() = %v, %v; want 20, nil", rate, err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("provider queried %d times, want once within the TTL", requests)
+	}
+
+	estimator.rates[1] = cachedFeeRate{rate: 20, fetchedAt: time.Now().Add(-time.Minute)}
+	if _, err := estimator.EstimateFee(context.Background(), 1); err != nil || requests != 2 {
+		t.Errorf("expired rate not refetched: %v, %d requests", err, requests)
+	}
+}
+
+func TestEstimateFeeFallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	n := &Node{
+		logger:       btclog.Disabled,
+		feeEstimator: &mempoolSpaceEstimator{baseURL: server.URL, client: server.Client()},
+	}
+	if _, err := n.EstimateFee(2); err == nil {
+		t.Error("expected an error without a fallback")
+	}
+
+	n.feeFallback = staticFeeEstimator(4)
+	estimate, err := n.EstimateFee(2)
+	if err != nil {
+		t.Fatalf("EstimateFee() failed: %v", err)
+	}
+	if estimate.SatPerVByte != 4 || estimate.Estimator != FeeEstimatorMempoolSpace || estimate.Source != FeeEstimatorStatic {
+		t.Errorf("EstimateFee() = %+v, want the fallback's rate", estimate)
+	}
+}
+
+func TestBitcoindFeeEstimator(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "rpc" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			Method string `json:"method"`
+			Params []int  `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Method != "estimatesmartfee" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if req.Params[0] > 100 {
+			w.Write([]byte(`{"result":{"errors":["Insufficient data or no feerate found"],"blocks":2},"error":null,"id":"neutrinod"}`))
+			return
+		}
+		w.Write([]byte(`{"result":{"feerate":0.00012,"blocks":2},"error":null,"id":"neutrinod"}`))
+	}))
+	defer server.Close()
+
+	estimator := &bitcoindFeeEstimator{url: server.URL, user: "rpc", password: "secret", client: server.Client()}
+
+	rate, err := estimator.EstimateFee(context.Background(), 2)
+	if err != nil || rate != 12 {
+		t.Errorf("EstimateFee() = %v, %v; want 12, nil", rate, err)
+	}
+
+	if _, err := estimator.EstimateFee(context.Background(), 500); err == nil {
+		t.Error("expected error when bitcoind has no estimate")
+	}
+
+	estimator.password = "wrong"
+	if _, err := estimator.EstimateFee(context.Background(), 2); err == nil {
+		t.Error("expected error for rejected credentials")
+	}
+}
+
+func TestFeeEstimatorTorProxies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/fees/recommended" {
+			w.Write([]byte(`{"fastestFee":20,"halfHourFee":15,"hourFee":10,"economyFee":5,"minimumFee":1}`))
+			return
+		}
+		w.Write([]byte(`{"result":{"feerate":0.00012,"blocks":2},"error":null,"id":"neutrinod"}`))
+	}))
+	defer server.Close()
+
+	// A proxy that is down fails every connection made through it
+	pool, err := newTorProxyPool(closedAddr(t), false, btclog.Disabled)
+	if err != nil {
+		t.Fatalf("newTorProxyPool() failed: %v", err)
+	}
+
+	bitcoind, err := newBaseFeeEstimator(FeeConfig{Estimator: FeeEstimatorBitcoind, BitcoindURL: server.URL}, nil, nil, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate, err := bitcoind.EstimateFee(context.Background(), 2); err != nil || rate != 12 {
+		t.Errorf("bitcoind EstimateFee() = %v, %v; want 12, nil dialed directly", rate, err)
+	}
+
+	mempool, err := newBaseFeeEstimator(FeeConfig{Estimator: FeeEstimatorMempoolSpace, MempoolURL: server.URL + "/"}, nil, nil, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mempool.EstimateFee(context.Background(), 6); err == nil {
+		t.Error("mempool.space estimator reached the provider without the Tor proxy")
+	}
+}
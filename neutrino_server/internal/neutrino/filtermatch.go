@@ -0,0 +1,181 @@
+package neutrino
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+const (
+	// maxFilterMatchTargets bounds the addresses and scripts of one
+	// MatchFilters call.
+	maxFilterMatchTargets = 1000
+
+	// maxFilterMatchBlocks bounds the height range of one MatchFilters call.
+	maxFilterMatchBlocks = 100000
+)
+
+// FilterMatchResult lists the heights in a range whose compact filters
+// matched at least one of the requested scripts. A filter match may be a
+// false positive, so the blocks still have to be checked.
+type FilterMatchResult struct {
+	StartHeight int32       `json:"start_height"`
+	EndHeight   int32       `json:"end_height"`
+	Heights     []int32     `json:"heights"`
+	Confidence  *Confidence `json:"confidence"`
+}
+
+// filterMatchScripts returns the output scripts to match for addresses and
+// hex-encoded scripts.
+func (n *Node) filterMatchScripts(addresses, scripts []string) ([][]byte, error) {
+	total := len(addresses) + len(scripts)
+	if total == 0 {
+		return nil, NewBadRequestError("at least one address or script is required")
+	}
+	if total > maxFilterMatchTargets {
+		return nil, NewBadRequestError(fmt.Sprintf("too many addresses and scripts: %d (max %d)", total, maxFilterMatchTargets))
+	}
+
+	pkScripts := make([][]byte, 0, total)
+	for _, address := range addresses {
+		addr, err := btcutil.DecodeAddress(address, n.chainParams)
+		if err != nil {
+			return nil, NewBadRequestError(fmt.Sprintf("invalid address %s: %v", address, err))
+		}
+		pkScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create script for address %s: %w", address, err)
+		}
+		pkScripts = append(pkScripts, pkScript)
+	}
+	for _, scriptHex := range scripts {
+		script, err := hex.DecodeString(scriptHex)
+		if err != nil || len(script) == 0 {
+			return nil, NewBadRequestError(fmt.Sprintf("invalid script hex %q", scriptHex))
+		}
+		pkScripts = append(pkScripts, script)
+	}
+	return pkScripts, nil
+}
+
+// MatchFilters returns the heights from startHeight through endHeight whose
+// compact filters match any of addresses or hex-encoded scripts. Only filters
+// are fetched, never blocks, so clients can use it as a cheap first pass and
+// download the matching blocks themselves. An endHeight of 0 means the tip.
+func (n *Node) MatchFilters(ctx context.Context, addresses, scripts []string, startHeight, endHeight int32) (result *FilterMatchResult, err error) {
+	ctx, span := tracer.Start(ctx, "MatchFilters")
+	defer func() { endSpan(span, err) }()
+
+	if n.chainService == nil {
+		return nil, errors.New("chain service not initialized")
+	}
+
+	pkScripts, err := n.filterMatchScripts(addresses, scripts)
+	if err != nil {
+		return nil, err
+	}
+
+	blockHeight, filterHeight, err := n.scanTip()
+	if err != nil {
+		return nil, err
+	}
+	endHeight, err = scanEnd(startHeight, endHeight, blockHeight, filterHeight)
+	if err != nil {
+		return nil, err
+	}
+	if startHeight < 0 || startHeight > endHeight {
+		return nil, NewBadRequestError(fmt.Sprintf("invalid height range %d-%d: start_height must be between 0 and end_height", startHeight, endHeight))
+	}
+	if endHeight-startHeight+1 > maxFilterMatchBlocks {
+		return nil, NewBadRequestError(fmt.Sprintf("height range too large: %d blocks (max %d)", endHeight-startHeight+1, maxFilterMatchBlocks))
+	}
+
+	logging.FromContext(ctx, n.logger).Infof("Matching filters for %d scripts from height %d to %d", len(pkScripts), logging.KV("height", startHeight), endHeight)
+	span.SetAttributes(attrStartHeight.Int(int(startHeight)), attrEndHeight.Int(int(endHeight)))
+
+	// Segments of the range covered by the scan cache are only scanned for
+	// the scripts it has no matches of, matched one by one to be cached
+	plan := n.scans.newPlan(n.chainService, pkScripts, startHeight, endHeight)
+
+	// Without the scan cache, heights earlier scans found none of the
+	// scripts in are skipped, and the misses of this scan are remembered
+	var memoized []HeightRange
+	var generation uint64
+	if plan == nil {
+		memoized, generation = n.scanMemo.lookup(pkScripts, startHeight, endHeight)
+	}
+
+	// Each height is written by exactly one worker
+	matched := make([]bool, endHeight-startHeight+1)
+	var skips skipTracker
+	prefetch := newFilterPrefetcher(ctx, n.chainService, startHeight, endHeight, n.config.FilterBatchSize, n.logger)
+	prefetch.flights = n.flights
+	prefetch.fill = n.metrics.filterFill(n.chainService)
+	fetch := func(height int32) *btcutil.Block {
+		i := height - startHeight
+		switch segment := plan.segment(ctx, height); {
+		case rangesContain(memoized, height):
+			n.metrics.scanMemoHit()
+		case segment == nil:
+			prefetch.wait(height)
+			_, matched[i] = n.matchFilter(ctx, height, pkScripts, &skips)
+		default:
+			matched[i] = len(plan.match(segment, height, func(scripts [][]byte) []int {
+				prefetch.wait(height)
+				return n.matchFilterEach(ctx, height, scripts, &skips)
+			})) > 0
+		}
+		return nil
+	}
+	next := startHeight
+	apply := func(height int32, _ *btcutil.Block) error {
+		next = height + 1
+		return nil
+	}
+
+	if err := scanRange(ctx, startHeight, endHeight, n.config.ScanWorkers, fetch, apply); err != nil {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			return nil, err
+		}
+		// The matches below next are final, so they are returned with
+		// the height to resume from
+		deadlineErr := &ScanDeadlineError{ResumeHeight: next, Heights: []int32{}}
+		for i, ok := range matched[:next-startHeight] {
+			if ok {
+				deadlineErr.Heights = append(deadlineErr.Heights, startHeight+int32(i))
+			}
+		}
+		if plan == nil && next > startHeight {
+			n.scanMemo.record(generation, pkScripts, startHeight, next-1, deadlineErr.Heights, skips.ranges(startHeight, next-1))
+		}
+		return nil, deadlineErr
+	}
+
+	skipped := skips.ranges(startHeight, endHeight)
+	plan.store(ctx, startHeight, endHeight, skipped)
+	if len(skipped) > 0 && n.config.ScanMode == ScanStrict {
+		return nil, &IncompleteScanError{Skipped: skipped}
+	}
+
+	result = &FilterMatchResult{
+		StartHeight: startHeight,
+		EndHeight:   endHeight,
+		Heights:     []int32{},
+		Confidence:  scanConfidence(skipped),
+	}
+	for i, ok := range matched {
+		if ok {
+			result.Heights = append(result.Heights, startHeight+int32(i))
+		}
+	}
+	if plan == nil {
+		n.scanMemo.record(generation, pkScripts, startHeight, endHeight, result.Heights, skipped)
+	}
+	return result, nil
+}
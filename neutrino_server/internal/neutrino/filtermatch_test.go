@@ -0,0 +1,52 @@
+package neutrino
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+func TestFilterMatchScripts(t *testing.T) {
+	node := &Node{chainParams: &chaincfg.MainNetParams}
+
+	tooMany := make([]string, maxFilterMatchTargets+1)
+	for i := range tooMany {
+		tooMany[i] = "51"
+	}
+
+	tests := []struct {
+		name      string
+		addresses []string
+		scripts   []string
+		want      int
+		wantErr   bool
+	}{
+		{"address", []string{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"}, nil, 1, false},
+		{"address and script", []string{"bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq"}, []string{"0014751e76e8199196d454941c45d1b3a323f1433bd6"}, 2, false},
+		{"nothing to match", nil, nil, 0, true},
+		{"invalid address", []string{"not-an-address"}, nil, 0, true},
+		{"invalid script", nil, []string{"zz"}, 0, true},
+		{"empty script", nil, []string{""}, 0, true},
+		{"too many", nil, tooMany, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scripts, err := node.filterMatchScripts(tt.addresses, tt.scripts)
+			if tt.wantErr {
+				var badRequest *BadRequestError
+				if !errors.As(err, &badRequest) {
+					t.Fatalf("filterMatchScripts() error = %v, want BadRequestError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("filterMatchScripts() failed: %v", err)
+			}
+			if len(scripts) != tt.want {
+				t.Errorf("filterMatchScripts() returned %d scripts, want %d", len(scripts), tt.want)
+			}
+		})
+	}
+}
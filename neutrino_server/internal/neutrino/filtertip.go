@@ -0,0 +1,52 @@
+package neutrino
+
+import (
+	"fmt"
+
+	"github.com/lightninglabs/neutrino"
+)
+
+// scanTip returns the best block height and the height filter headers are
+// synced to. Scans stop at the filter tip, since the filters above it cannot
+// be checked against their headers yet.
+func (n *Node) scanTip() (blockHeight, filterHeight int32, err error) {
+	return chainScanTip(n.chainService)
+}
+
+// scanEnd resolves the end of a rescan job from startHeight, the filter tip.
+func (r *RescanManager) scanEnd(startHeight int32) (int32, error) {
+	blockHeight, filterHeight, err := chainScanTip(r.chainService)
+	if err != nil {
+		return 0, err
+	}
+	return scanEnd(startHeight, 0, blockHeight, filterHeight)
+}
+
+// chainScanTip is scanTip for cs.
+func chainScanTip(cs *neutrino.ChainService) (blockHeight, filterHeight int32, err error) {
+	bestBlock, err := cs.BestBlock()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get best block: %w", err)
+	}
+	_, tip, err := cs.RegFilterHeaders.ChainTip()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get filter header tip: %w", err)
+	}
+	return bestBlock.Height, int32(tip), nil
+}
+
+// scanEnd resolves the end of a scan from startHeight to endHeight, where
+// zero or a height above the chain tip ends the scan at the filter tip. A
+// range reaching blocks whose filters are not synced yet is refused.
+func scanEnd(startHeight, endHeight, blockHeight, filterHeight int32) (int32, error) {
+	if endHeight == 0 || endHeight > blockHeight {
+		endHeight = filterHeight
+	}
+	if endHeight > filterHeight {
+		return 0, &FiltersNotSyncedError{Height: endHeight, FilterHeight: filterHeight}
+	}
+	if startHeight > filterHeight && startHeight <= blockHeight {
+		return 0, &FiltersNotSyncedError{Height: startHeight, FilterHeight: filterHeight}
+	}
+	return endHeight, nil
+}
@@ -0,0 +1,36 @@
+package neutrino
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestScanEnd(t *testing.T) {
+	tests := []struct {
+		name        string
+		start, end  int32
+		want        int32
+		wantSyncing bool
+	}{
+		{"default end at the filter tip", 100, 0, 900, false},
+		{"end above the chain tip", 100, 5000, 900, false},
+		{"end below the filter tip", 100, 500, 500, false},
+		{"end past the filter tip", 100, 950, 0, true},
+		{"start past the filter tip", 950, 0, 0, true},
+		{"start above the chain tip", 2000, 0, 900, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scanEnd(tt.start, tt.end, 1000, 900)
+
+			var syncing *FiltersNotSyncedError
+			if errors.As(err, &syncing) != tt.wantSyncing {
+				t.Fatalf("scanEnd() error = %v, want filters not synced: %v", err, tt.wantSyncing)
+			}
+			if !tt.wantSyncing && got != tt.want {
+				t.Errorf("scanEnd() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
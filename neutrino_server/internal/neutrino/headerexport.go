@@ -0,0 +1,429 @@
+package neutrino
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil/gcs/builder"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcwallet/walletdb"
+	"github.com/lightninglabs/neutrino/headerfs"
+)
+
+// headerExportMagic starts every header export file, followed by its
+// version.
+var headerExportMagic = [4]byte{'N', 'H', 'D', 'R'}
+
+const headerExportVersion = 1
+
+const (
+	blockHeaderSize  = 80
+	filterHeaderSize = chainhash.HashSize
+
+	// headerBatchSize is how many headers are read or written at once.
+	headerBatchSize = 2000
+
+	// headerDBTimeout is how long to wait for the database lock, which a
+	// running neutrinod holds.
+	headerDBTimeout = 2 * time.Second
+)
+
+// HeaderExport describes the header chains in an export file.
+type HeaderExport struct {
+	Network      string `json:"network"`
+	BlockHeight  int32  `json:"block_height"`
+	BlockHash    string `json:"block_hash"`
+	FilterHeight int32  `json:"filter_height"`
+
+	// Imported is the number of block headers an import added to the data
+	// directory.
+	Imported int32 `json:"imported,omitempty"`
+}
+
+// headerChains are the block and filter header chains from the genesis block
+// on, as stored in an export file.
+type headerChains struct {
+	blocks  []wire.BlockHeader
+	filters []chainhash.Hash
+}
+
+// ExportHeaders writes the block and filter header chains of the network in
+// dataDir to w. neutrinod must not be running on dataDir.
+//
+// The file holds a magic number, its version, the network magic and the
+// lengths of both chains, followed by the block headers, the filter headers
+// and a SHA-256 checksum of everything before it.
+func ExportHeaders(dataDir, network string, w io.Writer) (*HeaderExport, error) {
+	params, err := getChainParams(network)
+	if err != nil {
+		return nil, err
+	}
+	dbPath := filepath.Join(dataDir, dbFiles[detectDBBackend(dataDir)])
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("no header chains in %s: %w", dataDir, err)
+	}
+	db, blocks, filters, err := openHeaderStores(dataDir, params)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tip, blockHeight, err := blocks.ChainTip()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block header tip: %w", err)
+	}
+	_, filterHeight, err := filters.ChainTip()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get filter header tip: %w", err)
+	}
+
+	checksum := sha256.New()
+	out := bufio.NewWriter(io.MultiWriter(w, checksum))
+	fields := []any{headerExportMagic, uint32(headerExportVersion), uint32(params.Net), blockHeight + 1, filterHeight + 1}
+	for _, field := range fields {
+		if err := binary.Write(out, binary.LittleEndian, field); err != nil {
+			return nil, err
+		}
+	}
+
+	for start := uint32(0); start <= blockHeight; start += headerBatchSize {
+		end := min(start+headerBatchSize-1, blockHeight)
+		stop, err := blocks.FetchHeaderByHeight(end)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read block header %d: %w", end, err)
+		}
+		stopHash := stop.BlockHash()
+		headers, _, err := blocks.FetchHeaderAncestors(end-start, &stopHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read block headers %d-%d: %w", start, end, err)
+		}
+		for i := range headers {
+			if err := headers[i].Serialize(out); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for start := uint32(0); start <= filterHeight; start += headerBatchSize {
+		end := min(start+headerBatchSize-1, filterHeight)
+		stop, err := blocks.FetchHeaderByHeight(end)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read block header %d: %w", end, err)
+		}
+		stopHash := stop.BlockHash()
+		headers, _, err := filters.FetchHeaderAncestors(end-start, &stopHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read filter headers %d-%d: %w", start, end, err)
+		}
+		for i := range headers {
+			if _, err := out.Write(headers[i][:]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := out.Flush(); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(checksum.Sum(nil)); err != nil {
+		return nil, err
+	}
+
+	return &HeaderExport{
+		Network:      network,
+		BlockHeight:  int32(blockHeight),
+		BlockHash:    tip.BlockHash().String(),
+		FilterHeight: int32(filterHeight),
+	}, nil
+}
+
+// ImportHeaders loads header chains exported by ExportHeaders from r into
+// dataDir, so that sync continues from their tip. The file is verified
+// before anything is written: its checksum, that the headers link up from
+// the genesis block with valid proof of work and pass the network's
+// checkpoints and checkpoints, and that they agree with any headers already
+// in dataDir. Filter headers cannot be checked without their filters beyond
+// the filter headers of checkpoints, so the file must come from a trusted
+// source. neutrinod must not be running on dataDir.
+func ImportHeaders(dataDir, network string, checkpoints []Checkpoint, r io.Reader) (*HeaderExport, error) {
+	params, err := getChainParams(network)
+	if err != nil {
+		return nil, err
+	}
+	if params, err = withCheckpoints(params, checkpoints); err != nil {
+		return nil, err
+	}
+	chains, err := readHeaderChains(r, params)
+	if err != nil {
+		return nil, err
+	}
+	for _, checkpoint := range checkpoints {
+		if checkpoint.FilterHeader != nil && int(checkpoint.Height) < len(chains.filters) && chains.filters[checkpoint.Height] != *checkpoint.FilterHeader {
+			return nil, fmt.Errorf("invalid header export: filter header %d is %s, but the checkpoint is %s",
+				checkpoint.Height, chains.filters[checkpoint.Height], checkpoint.FilterHeader)
+		}
+	}
+
+	if err := os.MkdirAll(dataDir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	db, blocks, filters, err := openHeaderStores(dataDir, params)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	blockHeight, err := importBlockHeaders(blocks, chains.blocks)
+	if err != nil {
+		return nil, err
+	}
+	if err := importFilterHeaders(filters, chains); err != nil {
+		return nil, err
+	}
+
+	tip := &chains.blocks[len(chains.blocks)-1]
+	return &HeaderExport{
+		Network:      network,
+		BlockHeight:  int32(len(chains.blocks) - 1),
+		BlockHash:    tip.BlockHash().String(),
+		FilterHeight: int32(len(chains.filters) - 1),
+		Imported:     max(int32(len(chains.blocks)-1)-blockHeight, 0),
+	}, nil
+}
+
+// openHeaderStores opens the database and header stores in dataDir as
+// neutrino does, creating them if they do not exist.
+func openHeaderStores(dataDir string, params *chaincfg.Params) (walletdb.DB, headerfs.BlockHeaderStore, *headerfs.FilterHeaderStore, error) {
+	backend := detectDBBackend(dataDir)
+	dbPath := filepath.Join(dataDir, dbFiles[backend])
+	db, err := openDB(backend, dbPath, true, "", headerDBTimeout)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to open database at %s (is neutrinod running?): %w", dbPath, err)
+	}
+	blocks, err := headerfs.NewBlockHeaderStore(dataDir, db, params)
+	if err != nil {
+		db.Close()
+		return nil, nil, nil, fmt.Errorf("failed to open block headers: %w", err)
+	}
+	filters, err := headerfs.NewFilterHeaderStore(dataDir, db, headerfs.RegularFilter, params, nil)
+	if err != nil {
+		db.Close()
+		return nil, nil, nil, fmt.Errorf("failed to open filter headers: %w", err)
+	}
+	return db, blocks, filters, nil
+}
+
+// errHeaderExportLength is returned for an export file shorter or longer
+// than its header counts give.
+var errHeaderExportLength = errors.New("invalid header export: length does not match its header counts")
+
+// readHeaderChains reads and verifies an export file for params. The file is
+// decoded as it is read, so only the decoded headers are held in memory.
+func readHeaderChains(r io.Reader, params *chaincfg.Params) (*headerChains, error) {
+	in := bufio.NewReader(r)
+	checksum := sha256.New()
+	body := io.TeeReader(in, checksum)
+
+	var prefix [20]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil || !bytes.Equal(prefix[:4], headerExportMagic[:]) {
+		return nil, errors.New("not a header export file")
+	}
+	version := binary.LittleEndian.Uint32(prefix[4:])
+	blockCount := binary.LittleEndian.Uint32(prefix[12:])
+	filterCount := binary.LittleEndian.Uint32(prefix[16:])
+
+	// Headers are appended as they are read, so a corrupt count cannot
+	// allocate more than the file holds
+	chains := &headerChains{
+		blocks:  make([]wire.BlockHeader, 0, min(blockCount, headerBatchSize)),
+		filters: make([]chainhash.Hash, 0, min(filterCount, headerBatchSize)),
+	}
+	for range blockCount {
+		var header wire.BlockHeader
+		if err := header.Deserialize(body); err != nil {
+			return nil, headerExportReadError(err)
+		}
+		chains.blocks = append(chains.blocks, header)
+	}
+	for range filterCount {
+		var hash chainhash.Hash
+		if _, err := io.ReadFull(body, hash[:]); err != nil {
+			return nil, headerExportReadError(err)
+		}
+		chains.filters = append(chains.filters, hash)
+	}
+	var sum [sha256.Size]byte
+	if _, err := io.ReadFull(in, sum[:]); err != nil {
+		return nil, headerExportReadError(err)
+	}
+	if _, err := in.ReadByte(); !errors.Is(err, io.EOF) {
+		return nil, headerExportReadError(err)
+	}
+	if !bytes.Equal(checksum.Sum(nil), sum[:]) {
+		return nil, errors.New("header export file is corrupt: checksum mismatch")
+	}
+
+	if version != headerExportVersion {
+		return nil, fmt.Errorf("unsupported header export version %d", version)
+	}
+	if net := wire.BitcoinNet(binary.LittleEndian.Uint32(prefix[8:])); net != params.Net {
+		return nil, fmt.Errorf("header export is for another network (magic %#08x), not %s", uint32(net), params.Name)
+	}
+	if blockCount == 0 || filterCount == 0 || filterCount > blockCount {
+		return nil, fmt.Errorf("invalid header export: %d block and %d filter headers", blockCount, filterCount)
+	}
+
+	if err := checkHeaderChain(chains.blocks, params); err != nil {
+		return nil, err
+	}
+	genesis, err := genesisFilterHeader(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute the genesis filter header: %w", err)
+	}
+	if chains.filters[0] != genesis {
+		return nil, errors.New("invalid header export: filter header chain does not start at the genesis block")
+	}
+	return chains, nil
+}
+
+// headerExportReadError returns the error of reading an export file: an
+// early end means the file does not match its header counts, and trailing
+// data (a nil error) that it is longer.
+func headerExportReadError(err error) error {
+	if err == nil || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return errHeaderExportLength
+	}
+	return fmt.Errorf("failed to read header export: %w", err)
+}
+
+// checkHeaderChain checks that headers link up from the genesis block of
+// params with valid proof of work and pass its checkpoints. Difficulty
+// adjustments are not checked.
+func checkHeaderChain(headers []wire.BlockHeader, params *chaincfg.Params) error {
+	if _, err := headerChainPrefix(headers, params); err != nil {
+		return fmt.Errorf("invalid header export: %w", err)
+	}
+	return nil
+}
+
+// headerChainPrefix returns how many of headers link up from the genesis
+// block of params with valid proof of work and pass its checkpoints, and
+// what is wrong with the next one.
+func headerChainPrefix(headers []wire.BlockHeader, params *chaincfg.Params) (int, error) {
+	if len(headers) == 0 {
+		return 0, errors.New("no block headers are stored")
+	}
+	if headers[0].BlockHash() != *params.GenesisHash {
+		return 0, errors.New("block header chain does not start at the genesis block")
+	}
+
+	checkpoints := make(map[int32]*chainhash.Hash, len(params.Checkpoints))
+	for _, checkpoint := range params.Checkpoints {
+		checkpoints[checkpoint.Height] = checkpoint.Hash
+	}
+
+	prevHash := headers[0].BlockHash()
+	for i := 1; i < len(headers); i++ {
+		header := &headers[i]
+		hash := header.BlockHash()
+		if header.PrevBlock != prevHash {
+			return i, fmt.Errorf("block header %d does not connect to the previous one", i)
+		}
+		target := blockchain.CompactToBig(header.Bits)
+		if target.Sign() <= 0 || target.Cmp(params.PowLimit) > 0 || blockchain.HashToBig(&hash).Cmp(target) > 0 {
+			return i, fmt.Errorf("block header %d has invalid proof of work", i)
+		}
+		if checkpoint, ok := checkpoints[int32(i)]; ok && *checkpoint != hash {
+			return i, fmt.Errorf("block %d is %s, but the checkpoint is %s", i, hash, checkpoint)
+		}
+		prevHash = hash
+	}
+	return len(headers), nil
+}
+
+// genesisFilterHeader returns the filter header of the genesis block of
+// params, as neutrino computes it.
+func genesisFilterHeader(params *chaincfg.Params) (chainhash.Hash, error) {
+	filter, err := builder.BuildBasicFilter(params.GenesisBlock, nil)
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	return builder.MakeHeaderForFilter(filter, params.GenesisBlock.Header.PrevBlock)
+}
+
+// importBlockHeaders appends the headers above the tip of store, after
+// checking that the headers below agree with it. It returns the height of
+// the tip before the import.
+func importBlockHeaders(store headerfs.BlockHeaderStore, headers []wire.BlockHeader) (int32, error) {
+	_, tipHeight, err := store.ChainTip()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get block header tip: %w", err)
+	}
+
+	overlap := min(int(tipHeight), len(headers)-1)
+	existing, err := store.FetchHeaderByHeight(uint32(overlap))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read block header %d: %w", overlap, err)
+	}
+	if existing.BlockHash() != headers[overlap].BlockHash() {
+		return 0, fmt.Errorf("header export contradicts the block headers in the data directory at height %d", overlap)
+	}
+
+	for start := int(tipHeight) + 1; start < len(headers); start += headerBatchSize {
+		end := min(start+headerBatchSize, len(headers))
+		batch := make([]headerfs.BlockHeader, 0, end-start)
+		for height := start; height < end; height++ {
+			batch = append(batch, headerfs.BlockHeader{BlockHeader: &headers[height], Height: uint32(height)})
+		}
+		if err := store.WriteHeaders(batch...); err != nil {
+			return 0, fmt.Errorf("failed to write block headers %d-%d: %w", start, end-1, err)
+		}
+	}
+	return int32(tipHeight), nil
+}
+
+// importFilterHeaders appends the filter headers above the tip of store,
+// after checking that the headers below agree with it. The block headers
+// must have been imported first.
+func importFilterHeaders(store *headerfs.FilterHeaderStore, chains *headerChains) error {
+	_, tipHeight, err := store.ChainTip()
+	if err != nil {
+		return fmt.Errorf("failed to get filter header tip: %w", err)
+	}
+
+	overlap := min(int(tipHeight), len(chains.filters)-1)
+	existing, err := store.FetchHeaderByHeight(uint32(overlap))
+	if err != nil {
+		return fmt.Errorf("failed to read filter header %d: %w", overlap, err)
+	}
+	if *existing != chains.filters[overlap] {
+		return fmt.Errorf("header export contradicts the filter headers in the data directory at height %d", overlap)
+	}
+
+	for start := int(tipHeight) + 1; start < len(chains.filters); start += headerBatchSize {
+		end := min(start+headerBatchSize, len(chains.filters))
+		batch := make([]headerfs.FilterHeader, 0, end-start)
+		for height := start; height < end; height++ {
+			batch = append(batch, headerfs.FilterHeader{
+				HeaderHash: chains.blocks[height].BlockHash(),
+				FilterHash: chains.filters[height],
+				Height:     uint32(height),
+			})
+		}
+		if err := store.WriteHeaders(batch...); err != nil {
+			return fmt.Errorf("failed to write filter headers %d-%d: %w", start, end-1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package neutrino
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightninglabs/neutrino/headerfs"
+)
+
+// mineHeaders returns count regtest block headers on top of prev.
+func mineHeaders(t *testing.T, prev wire.BlockHeader, count int, salt byte) []wire.BlockHeader {
+	t.Helper()
+	params := &chaincfg.RegressionNetParams
+	target := blockchain.CompactToBig(params.PowLimitBits)
+
+	headers := make([]wire.BlockHeader, 0, count)
+	for range count {
+		header := wire.BlockHeader{
+			Version:    4,
+			PrevBlock:  prev.BlockHash(),
+			MerkleRoot: chainhash.Hash{salt},
+			Timestamp:  prev.Timestamp.Add(600e9),
+			Bits:       params.PowLimitBits,
+		}
+		for {
+			hash := header.BlockHash()
+			if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+				break
+			}
+			header.Nonce++
+		}
+		headers = append(headers, header)
+		prev = header
+	}
+	return headers
+}
+
+// writeHeaderChains writes blocks and filters above the genesis block to the
+// stores in dataDir.
+func writeHeaderChains(t *testing.T, dataDir string, blocks []wire.BlockHeader, filters []chainhash.Hash) {
+	t.Helper()
+	db, blockStore, filterStore, err := openHeaderStores(dataDir, &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := range blocks {
+		if err := blockStore.WriteHeaders(headerfs.BlockHeader{BlockHeader: &blocks[i], Height: uint32(i + 1)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range filters {
+		header := headerfs.FilterHeader{HeaderHash: blocks[i].BlockHash(), FilterHash: filters[i], Height: uint32(i + 1)}
+		if err := filterStore.WriteHeaders(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHeaderExportImport(t *testing.T) {
+	genesis := chaincfg.RegressionNetParams.GenesisBlock.Header
+	blocks := mineHeaders(t, genesis, 5, 1)
+	filters := []chainhash.Hash{{1}, {2}, {3}}
+
+	source := t.TempDir()
+	writeHeaderChains(t, source, blocks, filters)
+
+	var file bytes.Buffer
+	exported, err := ExportHeaders(source, "regtest", &file)
+	if err != nil {
+		t.Fatalf("ExportHeaders() failed: %v", err)
+	}
+	if exported.BlockHeight != 5 || exported.FilterHeight != 3 || exported.BlockHash != blocks[4].BlockHash().String() {
+		t.Errorf("ExportHeaders() = %+v, want block 5 and filter 3", exported)
+	}
+
+	target := t.TempDir()
+	imported, err := ImportHeaders(target, "regtest", nil, bytes.NewReader(file.Bytes()))
+	if err != nil {
+		t.Fatalf("ImportHeaders() failed: %v", err)
+	}
+	if imported.BlockHeight != 5 || imported.FilterHeight != 3 || imported.Imported != 5 {
+		t.Errorf("ImportHeaders() = %+v, want 5 imported block headers", imported)
+	}
+
+	var reexported bytes.Buffer
+	if _, err := ExportHeaders(target, "regtest", &reexported); err != nil {
+		t.Fatalf("ExportHeaders() of the imported chains failed: %v", err)
+	}
+	if !bytes.Equal(reexported.Bytes(), file.Bytes()) {
+		t.Error("imported chains differ from the exported ones")
+	}
+
+	again, err := ImportHeaders(target, "regtest", nil, bytes.NewReader(file.Bytes()))
+	if err != nil || again.Imported != 0 {
+		t.Errorf("ImportHeaders() again = %+v, %v, want nothing imported", again, err)
+	}
+}
+
+func TestImportHeadersRejects(t *testing.T) {
+	genesis := chaincfg.RegressionNetParams.GenesisBlock.Header
+	blocks := mineHeaders(t, genesis, 3, 1)
+
+	source := t.TempDir()
+	writeHeaderChains(t, source, blocks, []chainhash.Hash{{1}})
+	var file bytes.Buffer
+	if _, err := ExportHeaders(source, "regtest", &file); err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := bytes.Clone(file.Bytes())
+	corrupt[30] ^= 1
+
+	// A header with a broken link, with a valid checksum
+	broken := bytes.Clone(file.Bytes())
+	broken[20+2*blockHeaderSize+4] ^= 1
+	body := broken[:len(broken)-sha256.Size]
+	sum := sha256.Sum256(body)
+	copy(broken[len(body):], sum[:])
+
+	forked := t.TempDir()
+	writeHeaderChains(t, forked, mineHeaders(t, genesis, 2, 2), nil)
+
+	tests := []struct {
+		name        string
+		dataDir     string
+		network     string
+		checkpoints []Checkpoint
+		data        []byte
+		wantErr     string
+	}{
+		{"not an export", t.TempDir(), "regtest", nil, []byte("headers"), "not a header export file"},
+		{"corrupt", t.TempDir(), "regtest", nil, corrupt, "checksum mismatch"},
+		{"truncated", t.TempDir(), "regtest", nil, file.Bytes()[:file.Len()-10], "length does not match"},
+		{"trailing data", t.TempDir(), "regtest", nil, append(bytes.Clone(file.Bytes()), 0), "length does not match"},
+		{"other network", t.TempDir(), "signet", nil, file.Bytes(), "header export is for another network"},
+		{"broken chain", t.TempDir(), "regtest", nil, broken, "does not connect"},
+		{"contradicts the data directory", forked, "regtest", nil, file.Bytes(), "contradicts the block headers"},
+		{"contradicts a checkpoint", t.TempDir(), "regtest", []Checkpoint{{Height: 2, BlockHash: chainhash.Hash{1}}}, file.Bytes(), "but the checkpoint is"},
+		{"contradicts a filter checkpoint", t.TempDir(), "regtest", []Checkpoint{{Height: 1, BlockHash: blocks[0].BlockHash(), FilterHeader: &chainhash.Hash{2}}}, file.Bytes(), "filter header 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ImportHeaders(tt.dataDir, tt.network, tt.checkpoints, bytes.NewReader(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ImportHeaders() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
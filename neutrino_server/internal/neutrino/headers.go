@@ -0,0 +1,51 @@
+package neutrino
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// MaxHeaderRange is the most headers one GetHeaders call returns.
+const MaxHeaderRange = 2000
+
+// GetHeaders returns up to count consecutive block headers starting at
+// height start. The range is cut short at the chain tip, so fewer headers
+// than requested are returned near the tip.
+func (n *Node) GetHeaders(start int32, count int) ([]wire.BlockHeader, error) {
+	if n.chainService == nil {
+		return nil, errors.New("chain service not initialized")
+	}
+	if start < 0 {
+		return nil, NewBadRequestError("start must not be negative")
+	}
+	if count < 1 || count > MaxHeaderRange {
+		return nil, NewBadRequestError(fmt.Sprintf("count must be between 1 and %d", MaxHeaderRange))
+	}
+
+	bestBlock, err := n.chainService.BestBlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get best block: %w", err)
+	}
+	if start > bestBlock.Height {
+		return nil, NewNotFoundError("block", fmt.Sprintf("no block at height %d (tip is %d)", start, bestBlock.Height))
+	}
+
+	end := start + int32(count) - 1
+	if end > bestBlock.Height {
+		end = bestBlock.Height
+	}
+
+	stopHash, err := n.chainService.GetBlockHash(int64(end))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block hash at height %d: %w", end, err)
+	}
+
+	// Ancestors are read in one pass from the header file, ending at stopHash
+	headers, _, err := n.chainService.BlockHeaders.FetchHeaderAncestors(uint32(end-start), stopHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch headers %d-%d: %w", start, end, err)
+	}
+	return headers, nil
+}
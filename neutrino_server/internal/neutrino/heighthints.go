@@ -0,0 +1,99 @@
+package neutrino
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// HeightHint records what earlier lookups established about an outpoint for
+// a given script: where it was created and how far it is known to be unspent.
+// Like lnd's height hint cache, it lets repeated lookups skip ranges that are
+// already known not to contain a spend.
+type HeightHint struct {
+	// Created is true once the creating transaction has been found.
+	Created        bool   `json:"created"`
+	CreationHeight int32  `json:"creation_height,omitempty"`
+	Value          int64  `json:"value,omitempty"`
+	ScriptPubKey   string `json:"scriptpubkey,omitempty"`
+
+	// ScannedHeight is the highest height scanned without finding a spend.
+	ScannedHeight int32 `json:"scanned_height,omitempty"`
+
+	// Spending fields are set once a spend has been found.
+	SpendingTxID   string `json:"spending_txid,omitempty"`
+	SpendingInput  uint32 `json:"spending_input,omitempty"`
+	SpendingHeight int32  `json:"spending_height,omitempty"`
+}
+
+// Spent reports whether the spend of the outpoint has been found.
+func (h *HeightHint) Spent() bool {
+	return h.SpendingTxID != ""
+}
+
+// recordCreation records the output created at height.
+func (h *HeightHint) recordCreation(height int32, txOut *wire.TxOut) {
+	h.Created = true
+	h.CreationHeight = height
+	h.Value = txOut.Value
+	h.ScriptPubKey = hex.EncodeToString(txOut.PkScript)
+}
+
+// recordSpend records the input spending the outpoint.
+func (h *HeightHint) recordSpend(txid string, input uint32, height int32) {
+	h.SpendingTxID = txid
+	h.SpendingInput = input
+	h.SpendingHeight = height
+}
+
+// report converts the hint to a spend report.
+func (h *HeightHint) report() *UTXOSpendReport {
+	if h.Spent() {
+		return &UTXOSpendReport{
+			Unspent:        false,
+			SpendingTxID:   h.SpendingTxID,
+			SpendingInput:  h.SpendingInput,
+			SpendingHeight: uint32(h.SpendingHeight),
+		}
+	}
+
+	return &UTXOSpendReport{
+		Unspent:      true,
+		Value:        h.Value,
+		ScriptPubKey: h.ScriptPubKey,
+		BlockHeight:  uint32(h.CreationHeight),
+	}
+}
+
+// heightHintKey identifies a hint by outpoint and the script used to match
+// filters, since a scan only proves a range empty for the script it used.
+func heightHintKey(txid string, vout uint32, pkScript []byte) string {
+	return fmt.Sprintf("%s:%d:%x", txid, vout, pkScript)
+}
+
+// heightHint returns the stored hint for key, or an empty hint.
+func (n *Node) heightHint(key string) HeightHint {
+	if n.store == nil {
+		return HeightHint{}
+	}
+
+	hint, _, err := n.store.HeightHint(key)
+	if err != nil {
+		n.logger.Warnf("Failed to load height hint %s: %v", key, err)
+		return HeightHint{}
+	}
+	return hint
+}
+
+// putHeightHint stores hint under key, logging rather than failing the lookup
+// on error.
+func (n *Node) putHeightHint(key string, hint HeightHint) {
+	if n.store == nil {
+		return
+	}
+
+	if err := n.store.PutHeightHint(key, hint); err != nil {
+		n.logger.Warnf("Failed to store height hint %s: %v", key, err)
+	}
+}
@@ -0,0 +1,57 @@
+package neutrino
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestHeightHints(t *testing.T) {
+	store := newTestStore(t)
+	key := heightHintKey("aa", 1, []byte{0x00, 0x14})
+
+	if _, found, err := store.HeightHint(key); err != nil || found {
+		t.Fatalf("expected no hint, got found=%v err=%v", found, err)
+	}
+
+	var hint HeightHint
+	hint.recordCreation(100, &wire.TxOut{Value: 5000, PkScript: []byte{0x00, 0x14}})
+	hint.ScannedHeight = 200
+	if err := store.PutHeightHint(key, hint); err != nil {
+		t.Fatalf("PutHeightHint() failed: %v", err)
+	}
+
+	got, found, err := store.HeightHint(key)
+	if err != nil || !found {
+		t.Fatalf("HeightHint() found=%v err=%v", found, err)
+	}
+	if got != hint {
+		t.Errorf("HeightHint() = %+v, want %+v", got, hint)
+	}
+
+	// The same outpoint matched through a different script has its own hint
+	if _, found, _ := store.HeightHint(heightHintKey("aa", 1, []byte{0x51})); found {
+		t.Error("expected hints to be keyed by script")
+	}
+
+	tests := []struct {
+		name string
+		hint HeightHint
+		want UTXOSpendReport
+	}{
+		{"unspent", got, UTXOSpendReport{Unspent: true, Value: 5000, ScriptPubKey: "0014", BlockHeight: 100}},
+		{
+			"spent",
+			HeightHint{Created: true, CreationHeight: 100, SpendingTxID: "bb", SpendingInput: 2, SpendingHeight: 150},
+			UTXOSpendReport{SpendingTxID: "bb", SpendingInput: 2, SpendingHeight: 150},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if report := tt.hint.report(); *report != tt.want {
+				t.Errorf("report() = %+v, want %+v", *report, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package neutrino
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcwallet/walletdb"
+	"github.com/lightninglabs/neutrino/headerfs"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// The layout of neutrino's header index: a bucket mapping block hashes to
+// their heights, in nested buckets named after the first two bytes of the
+// hash, and holding the tip hash of each header chain. See headerfs.
+var (
+	headerIndexBucket = []byte("header-index")
+	blockTipKey       = []byte("bitcoin")
+	filterTipKey      = []byte("regular")
+)
+
+// headerFiles are the flat files of the block and filter header chains.
+var headerFiles = []string{"block_headers.bin", "reg_filter_headers.bin"}
+
+// HeaderRepair describes header chains the startup integrity check found
+// corrupt and truncated to their last consistent heights.
+type HeaderRepair struct {
+	Reason       string `json:"reason"`
+	BlockHeight  int32  `json:"block_height"`
+	FilterHeight int32  `json:"filter_height"`
+}
+
+// storedHeaders are the header chains in the flat files of a data directory
+// and the tips their index records.
+type storedHeaders struct {
+	blocks  []wire.BlockHeader
+	filters []chainhash.Hash
+
+	// blockTip and filterTip are the indexed tip heights, -1 if the index
+	// has none or it is unreadable.
+	blockTip, filterTip         int32
+	blockTipHash, filterTipHash chainhash.Hash
+}
+
+// checkHeaderIntegrity checks the header chains stored in dataDir and db,
+// and truncates them to their last consistent heights if they are corrupt,
+// so that neutrino syncs again from there. It returns nil if the chains are
+// consistent or not stored yet.
+//
+// The block headers must link up from the genesis block with valid proof of
+// work, up to the indexed tip. The filter headers must start at the genesis
+// filter header, hold no zeroed headers and end at the indexed filter tip,
+// which must be a block of the block header chain. Filter headers cannot be
+// checked further without their filters.
+func checkHeaderIntegrity(dataDir string, db walletdb.DB, params *chaincfg.Params) (*HeaderRepair, error) {
+	stored, err := readStoredHeaders(dataDir, db)
+	if err != nil || stored == nil {
+		return nil, err
+	}
+	genesisFilter, err := genesisFilterHeader(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute the genesis filter header: %w", err)
+	}
+
+	blocks, filters, reason := consistentHeaders(stored, params, genesisFilter)
+	if reason == "" {
+		return nil, nil
+	}
+	blockHeaders := stored.blocks[:blocks]
+	if blocks == 0 {
+		// A file of another network's headers is left alone
+		if len(stored.blocks) > 0 {
+			return nil, fmt.Errorf("header chains in %s are corrupt (%s), remove them to sync anew", dataDir, reason)
+		}
+		blockHeaders, blocks = []wire.BlockHeader{params.GenesisBlock.Header}, 1
+	}
+	filterHeaders := []chainhash.Hash{genesisFilter}
+	if filters > 1 {
+		filterHeaders = append(filterHeaders, stored.filters[1:filters]...)
+	}
+	if err := rewriteHeaders(dataDir, db, params, blockHeaders, filterHeaders); err != nil {
+		return nil, fmt.Errorf("failed to repair the header chains (%s): %w", reason, err)
+	}
+	return &HeaderRepair{Reason: reason, BlockHeight: int32(blocks - 1), FilterHeight: int32(filters - 1)}, nil
+}
+
+// consistentHeaders returns how many stored block and filter headers are
+// consistent, and what is wrong if not all that are indexed are.
+func consistentHeaders(stored *storedHeaders, params *chaincfg.Params, genesisFilter chainhash.Hash) (blocks, filters int, reason string) {
+	blocks, chainErr := headerChainPrefix(stored.blocks, params)
+	switch {
+	case stored.blockTip < 0:
+		reason = "the block header index has no tip"
+	case int(stored.blockTip) >= blocks && chainErr != nil:
+		reason = chainErr.Error()
+	case int(stored.blockTip) >= blocks:
+		reason = fmt.Sprintf("the block header file ends at height %d, below the indexed tip %d", blocks-1, stored.blockTip)
+	case stored.blocks[stored.blockTip].BlockHash() != stored.blockTipHash:
+		reason = fmt.Sprintf("block header %d is not the indexed tip", stored.blockTip)
+		blocks = int(stored.blockTip)
+	default:
+		// Headers above the indexed tip were written without being indexed,
+		// and neutrino drops them
+		blocks = int(stored.blockTip) + 1
+	}
+
+	filters = min(len(stored.filters), blocks)
+	for height, header := range stored.filters[:filters] {
+		if height == 0 && header != genesisFilter {
+			filters = 1
+			if reason == "" {
+				reason = "the filter header chain does not start at the genesis filter header"
+			}
+			break
+		}
+		if header == (chainhash.Hash{}) {
+			filters = height
+			if reason == "" && int32(height) <= stored.filterTip {
+				reason = fmt.Sprintf("filter header %d is zeroed", height)
+			}
+			break
+		}
+	}
+
+	switch {
+	case reason != "":
+	case stored.filterTip < 0:
+		reason = "the filter header index has no tip"
+	case int(stored.filterTip) >= filters:
+		reason = fmt.Sprintf("the filter header file ends at height %d, below the indexed tip %d", filters-1, stored.filterTip)
+	case stored.blocks[stored.filterTip].BlockHash() != stored.filterTipHash:
+		reason = fmt.Sprintf("the filter header tip %d is not linked to block %d", stored.filterTip, stored.filterTip)
+		filters = int(stored.filterTip)
+	default:
+		filters = int(stored.filterTip) + 1
+	}
+	return blocks, max(filters, 1), reason
+}
+
+// readStoredHeaders reads the header files in dataDir and the tips indexed
+// in db, or returns nil if no headers are stored yet.
+func readStoredHeaders(dataDir string, db walletdb.DB) (*storedHeaders, error) {
+	rawBlocks, err := os.ReadFile(filepath.Join(dataDir, headerFiles[0]))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block headers: %w", err)
+	}
+	rawFilters, err := os.ReadFile(filepath.Join(dataDir, headerFiles[1]))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read filter headers: %w", err)
+	}
+
+	stored := &storedHeaders{
+		blocks:    make([]wire.BlockHeader, len(rawBlocks)/blockHeaderSize),
+		filters:   make([]chainhash.Hash, len(rawFilters)/filterHeaderSize),
+		blockTip:  -1,
+		filterTip: -1,
+	}
+	for i := range stored.blocks {
+		if err := stored.blocks[i].Deserialize(bytes.NewReader(rawBlocks[i*blockHeaderSize:])); err != nil {
+			return nil, fmt.Errorf("failed to decode block header %d: %w", i, err)
+		}
+	}
+	for i := range stored.filters {
+		copy(stored.filters[i][:], rawFilters[i*filterHeaderSize:])
+	}
+
+	err = walletdb.View(db, func(tx walletdb.ReadTx) error {
+		index := tx.ReadBucket(headerIndexBucket)
+		if index == nil {
+			return nil
+		}
+		stored.blockTipHash, stored.blockTip = indexedTip(index, blockTipKey)
+		stored.filterTipHash, stored.filterTip = indexedTip(index, filterTipKey)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the header index: %w", err)
+	}
+	if len(stored.blocks) == 0 && stored.blockTip < 0 {
+		return nil, nil
+	}
+	return stored, nil
+}
+
+// indexedTip returns the tip the header index records under key and its
+// height, or -1 if there is none.
+func indexedTip(index walletdb.ReadBucket, key []byte) (chainhash.Hash, int32) {
+	tip := index.Get(key)
+	if len(tip) != chainhash.HashSize {
+		return chainhash.Hash{}, -1
+	}
+	height := index.Get(tip)
+	if sub := index.NestedReadBucket(tip[:2]); sub != nil && sub.Get(tip) != nil {
+		height = sub.Get(tip)
+	}
+	if len(height) != 4 {
+		return chainhash.Hash{}, -1
+	}
+	hash, _ := chainhash.NewHash(tip)
+	return *hash, int32(binary.BigEndian.Uint32(height))
+}
+
+// rewriteHeaders replaces the header chains in dataDir and db with blocks
+// and filters, which start at the genesis block.
+func rewriteHeaders(dataDir string, db walletdb.DB, params *chaincfg.Params, blocks []wire.BlockHeader, filters []chainhash.Hash) error {
+	err := walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		err := tx.DeleteTopLevelBucket(headerIndexBucket)
+		if errors.Is(err, walletdb.ErrBucketNotFound) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clear the header index: %w", err)
+	}
+	for _, file := range headerFiles {
+		if err := os.Remove(filepath.Join(dataDir, file)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	// The stores write the genesis headers anew
+	blockStore, err := headerfs.NewBlockHeaderStore(dataDir, db, params)
+	if err != nil {
+		return fmt.Errorf("failed to open block headers: %w", err)
+	}
+	filterStore, err := headerfs.NewFilterHeaderStore(dataDir, db, headerfs.RegularFilter, params, nil)
+	if err != nil {
+		return fmt.Errorf("failed to open filter headers: %w", err)
+	}
+	if _, err := importBlockHeaders(blockStore, blocks); err != nil {
+		return err
+	}
+	return importFilterHeaders(filterStore, &headerChains{blocks: blocks, filters: filters})
+}
+
+// repairHeaders checks the stored header chains and repairs them if they are
+// corrupt, see checkHeaderIntegrity, returning the repair if there was one.
+// It must run before the chain service opens them.
+func (n *Node) repairHeaders() (*HeaderRepair, error) {
+	// Headers contradicting a checkpoint are not corrupt, and refused once
+	// the chain service has started
+	params := *n.chainParams
+	params.Checkpoints = nil
+
+	start := time.Now()
+	repair, err := checkHeaderIntegrity(n.config.DataDir, n.db, &params)
+	if err != nil {
+		return nil, err
+	}
+	if repair == nil {
+		n.logger.Debugf("Header chains checked in %s", time.Since(start).Round(time.Millisecond))
+		return nil, nil
+	}
+	n.logger.Warnf("Header chains were corrupt (%s): truncated block headers to height %d and filter headers to height %d, syncing again from there",
+		repair.Reason, logging.KV("height", repair.BlockHeight), repair.FilterHeight)
+	return repair, nil
+}
+
+// rollbackRepairedHeaders rolls the store back to the height the block
+// headers were truncated to, as for a reorg, since the blocks above it are
+// no longer in the chain the node follows. Interrupted rescan jobs past it
+// resume from there, and the addresses scanned past it get a rescan job
+// from there, which resumes once filters are synced again.
+func (n *Node) rollbackRepairedHeaders(repair *HeaderRepair) error {
+	rollback, err := n.store.RollbackBlocks(repair.BlockHeight)
+	if err != nil {
+		return fmt.Errorf("failed to roll back the store to the repaired header chain: %w", err)
+	}
+	jobs, err := n.store.RescanJobs()
+	if err != nil {
+		return fmt.Errorf("failed to load rescan jobs: %w", err)
+	}
+	for i := range jobs {
+		if jobs[i].CheckpointHeight <= repair.BlockHeight {
+			continue
+		}
+		jobs[i].CheckpointHeight = max(repair.BlockHeight, jobs[i].StartHeight-1)
+		if err := n.store.PutRescanJob(&jobs[i]); err != nil {
+			return fmt.Errorf("failed to rewind rescan job %d: %w", jobs[i].ID, err)
+		}
+	}
+	n.logger.Infof("Rolled back the store to height %d: removed %d UTXOs, restored %d",
+		logging.KV("height", repair.BlockHeight), len(rollback.Removed), len(rollback.Restored))
+	if len(rollback.Addresses) == 0 {
+		return nil
+	}
+	job := &RescanJob{
+		Addresses:        rollback.Addresses,
+		StartHeight:      repair.BlockHeight + 1,
+		EndHeight:        repair.BlockHeight + 1,
+		CheckpointHeight: repair.BlockHeight,
+		CreatedAt:        time.Now().Unix(),
+	}
+	if err := n.store.PutRescanJob(job); err != nil {
+		return fmt.Errorf("failed to schedule the rescan after the header repair: %w", err)
+	}
+	n.logger.Infof("Scheduled rescan job %d of %d addresses from height %d",
+		logging.KV("job_id", job.ID), len(job.Addresses), logging.KV("height", job.StartHeight))
+	return nil
+}
@@ -0,0 +1,228 @@
+package neutrino
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btclog"
+	"github.com/btcsuite/btcwallet/walletdb"
+)
+
+// corruptFile applies corrupt to the contents of a file in dir.
+func corruptFile(t *testing.T, dir, name string, corrupt func([]byte) []byte) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, corrupt(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckHeaderIntegrity(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	blocks := mineHeaders(t, params.GenesisBlock.Header, 6, 1)
+	filters := []chainhash.Hash{{1}, {2}, {3}, {4}}
+
+	tests := []struct {
+		name        string
+		corrupt     func(dir string)
+		wantReason  string
+		wantBlocks  int32
+		wantFilters int32
+		wantErr     string
+	}{
+		{
+			name:        "consistent",
+			corrupt:     func(string) {},
+			wantBlocks:  6,
+			wantFilters: 4,
+		},
+		{
+			name: "unindexed headers after the tip",
+			corrupt: func(dir string) {
+				corruptFile(t, dir, "block_headers.bin", func(data []byte) []byte {
+					return append(data, make([]byte, 2*blockHeaderSize+7)...)
+				})
+			},
+			wantBlocks:  6,
+			wantFilters: 4,
+		},
+		{
+			name: "block header file cut short",
+			corrupt: func(dir string) {
+				corruptFile(t, dir, "block_headers.bin", func(data []byte) []byte {
+					return data[:5*blockHeaderSize+30]
+				})
+			},
+			wantReason:  "the block header file ends at height 4, below the indexed tip 6",
+			wantBlocks:  4,
+			wantFilters: 4,
+		},
+		{
+			name: "broken block header",
+			corrupt: func(dir string) {
+				corruptFile(t, dir, "block_headers.bin", func(data []byte) []byte {
+					data[3*blockHeaderSize+4] ^= 1
+					return data
+				})
+			},
+			wantReason:  "block header 3 does not connect",
+			wantBlocks:  2,
+			wantFilters: 2,
+		},
+		{
+			name: "zeroed filter headers",
+			corrupt: func(dir string) {
+				corruptFile(t, dir, "reg_filter_headers.bin", func(data []byte) []byte {
+					clear(data[3*filterHeaderSize:])
+					return data
+				})
+			},
+			wantReason:  "filter header 3 is zeroed",
+			wantBlocks:  6,
+			wantFilters: 2,
+		},
+		{
+			name: "filter header file cut short",
+			corrupt: func(dir string) {
+				corruptFile(t, dir, "reg_filter_headers.bin", func(data []byte) []byte {
+					return data[:2*filterHeaderSize]
+				})
+			},
+			wantReason:  "the filter header file ends at height 1, below the indexed tip 4",
+			wantBlocks:  6,
+			wantFilters: 1,
+		},
+		{
+			name: "empty block header file",
+			corrupt: func(dir string) {
+				corruptFile(t, dir, "block_headers.bin", func([]byte) []byte { return nil })
+			},
+			wantReason:  "no block headers are stored",
+			wantBlocks:  0,
+			wantFilters: 0,
+		},
+		{
+			name: "headers of another network",
+			corrupt: func(dir string) {
+				corruptFile(t, dir, "block_headers.bin", func(data []byte) []byte {
+					data[0] ^= 1
+					return data
+				})
+			},
+			wantErr: "remove them to sync anew",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeHeaderChains(t, dir, blocks, filters)
+			tt.corrupt(dir)
+
+			db, err := walletdb.Create("bdb", filepath.Join(dir, "neutrino.db"), true, headerDBTimeout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			repair, err := checkHeaderIntegrity(dir, db, params)
+			db.Close()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("checkHeaderIntegrity() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkHeaderIntegrity() failed: %v", err)
+			}
+			switch {
+			case tt.wantReason == "" && repair != nil:
+				t.Errorf("checkHeaderIntegrity() = %+v, want no repair", repair)
+			case tt.wantReason != "" && (repair == nil || !strings.Contains(repair.Reason, tt.wantReason)):
+				t.Errorf("checkHeaderIntegrity() = %+v, want a repair because %q", repair, tt.wantReason)
+			case repair != nil && (repair.BlockHeight != tt.wantBlocks || repair.FilterHeight != tt.wantFilters):
+				t.Errorf("checkHeaderIntegrity() = %+v, want headers to %d and filters to %d", repair, tt.wantBlocks, tt.wantFilters)
+			}
+
+			// The stores open as neutrino opens them, at the repaired tips
+			db, blockStore, filterStore, err := openHeaderStores(dir, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			tip, blockHeight, err := blockStore.ChainTip()
+			if err != nil || int32(blockHeight) != tt.wantBlocks {
+				t.Fatalf("block header tip = %d, %v, want %d", blockHeight, err, tt.wantBlocks)
+			}
+			if tt.wantBlocks > 0 && tip.BlockHash() != blocks[tt.wantBlocks-1].BlockHash() {
+				t.Errorf("block header tip is %s, want block %d", tip.BlockHash(), tt.wantBlocks)
+			}
+			filterTip, filterHeight, err := filterStore.ChainTip()
+			if err != nil || int32(filterHeight) != tt.wantFilters {
+				t.Fatalf("filter header tip = %d, %v, want %d", filterHeight, err, tt.wantFilters)
+			}
+			if tt.wantFilters > 0 && *filterTip != filters[tt.wantFilters-1] {
+				t.Errorf("filter header tip is %s, want %s", filterTip, filters[tt.wantFilters-1])
+			}
+		})
+	}
+}
+
+func TestRollbackRepairedHeaders(t *testing.T) {
+	store := newTestStore(t)
+	mgr := &RescanManager{
+		chainParams:    &chaincfg.MainNetParams,
+		store:          store,
+		logger:         btclog.Disabled,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
+	}
+	addr := "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	if err := mgr.WatchAddress(addr); err != nil {
+		t.Fatal(err)
+	}
+	job := &RescanJob{Addresses: []string{addr}, CheckpointHeight: -1}
+	utxos := map[string]UTXO{
+		"tx1:0": {TxID: "tx1", Vout: 0, Value: 1000, Address: addr, Height: 10},
+		"tx2:0": {TxID: "tx2", Vout: 0, Value: 2000, Address: addr, Height: 150},
+	}
+	if err := mgr.commitScanProgress(job, 160, job.Addresses, utxos, map[string]Spend{}); err != nil {
+		t.Fatal(err)
+	}
+
+	node := &Node{store: store, logger: btclog.Disabled}
+	if err := node.rollbackRepairedHeaders(&HeaderRepair{Reason: "test", BlockHeight: 100, FilterHeight: 100}); err != nil {
+		t.Fatalf("rollbackRepairedHeaders() failed: %v", err)
+	}
+
+	stored, err := store.UTXOs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stored["tx2:0"]; ok || len(stored) != 1 {
+		t.Errorf("UTXOs after the rollback = %v, want only tx1:0", stored)
+	}
+	watched, err := store.WatchedAddresses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := watched[addr].ScannedHeight; got != 100 {
+		t.Errorf("scanned height = %d, want 100", got)
+	}
+	jobs, err := store.RescanJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The interrupted job resumes from the repaired height too
+	if len(jobs) != 2 || jobs[0].CheckpointHeight != 100 || jobs[1].CheckpointHeight != 100 || !slices.Equal(jobs[1].Addresses, []string{addr}) {
+		t.Errorf("rescan jobs = %+v, want both at height 100 and the second of %s", jobs, addr)
+	}
+}
@@ -0,0 +1,250 @@
+package neutrino
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/gcs"
+	"github.com/btcsuite/btcd/btcutil/gcs/builder"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightninglabs/neutrino"
+	"github.com/lightninglabs/neutrino/headerfs"
+)
+
+// emptyFilter matches nothing. It is served to neutrino's Rescan for blocks
+// that are known not to match, so it neither fetches their filter again nor
+// their block.
+var emptyFilter, _ = gcs.FromNBytes(builder.DefaultP, builder.DefaultM, []byte{0})
+
+// matchFetcher returns the full block at height and its filter if the filter
+// matches the scan, or nils if it does not or could not be fetched.
+type matchFetcher func(height int32) (*btcutil.Block, *gcs.Filter)
+
+// fetchedBlock is the block fetched ahead for a height, nil if it did not
+// match.
+type fetchedBlock struct {
+	height int32
+	block  *btcutil.Block
+}
+
+// jobSource is the chain source of the neutrino Rescan that drives a rescan
+// job. The scan workers fetch filters and matching blocks ahead, in height
+// order, and the source serves them to the Rescan as it walks the chain: a
+// matching block with its filter, which the Rescan verifies against the block
+// before extracting the relevant transactions, and emptyFilter for every
+// other block. Only the blocks the Rescan fetched, and so verified, are
+// applied. Everything else comes from the chain service.
+//
+// The Rescan calls the source and its notification handlers from one
+// goroutine, so only the pipeline feeding fetched blocks is concurrent.
+type jobSource struct {
+	neutrino.ChainSource
+
+	ctx     context.Context
+	fetched chan fetchedBlock
+	filters sync.Map
+
+	// pipelineErr is set before fetched is closed.
+	pipelineErr error
+
+	// current is the block served for the height the Rescan is at, served
+	// whether the Rescan fetched it, and err the first error ending the
+	// scan.
+	current fetchedBlock
+	served  bool
+	err     error
+}
+
+// newJobSource returns a source serving chain data from chain and fetched
+// blocks once queued.
+func newJobSource(ctx context.Context, chain neutrino.ChainSource) *jobSource {
+	return &jobSource{
+		ChainSource: chain,
+		ctx:         ctx,
+		fetched:     make(chan fetchedBlock),
+	}
+}
+
+// fetch returns a blockFetcher for the pipeline, which keeps the filters of
+// the matching blocks fetch returns for the Rescan.
+func (s *jobSource) fetch(fetch matchFetcher) blockFetcher {
+	return func(height int32) *btcutil.Block {
+		block, filter := fetch(height)
+		if block != nil {
+			s.filters.Store(height, filter)
+		}
+		return block
+	}
+}
+
+// queue hands the block fetched for height to the Rescan, waiting for it to
+// reach height.
+func (s *jobSource) queue(height int32, block *btcutil.Block) error {
+	select {
+	case s.fetched <- fetchedBlock{height: height, block: block}:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+// finish ends the pipeline with err, the error scanRange returned.
+func (s *jobSource) finish(err error) {
+	s.pipelineErr = err
+	close(s.fetched)
+}
+
+// fail records err as the error ending the scan, unless one already did.
+// The source fails every call once it has, which ends the Rescan.
+func (s *jobSource) fail(err error) error {
+	if s.err == nil {
+		s.err = err
+	}
+	return s.err
+}
+
+// GetBlockHeaderByHeight returns the header at height, as the Rescan walks
+// to it.
+func (s *jobSource) GetBlockHeaderByHeight(height uint32) (*wire.BlockHeader, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if err := s.ctx.Err(); err != nil {
+		return nil, s.fail(err)
+	}
+	return s.ChainSource.GetBlockHeaderByHeight(height)
+}
+
+// GetCFilter returns the filter of the block with hash, the next one the
+// pipeline fetched, or emptyFilter if it did not match.
+func (s *jobSource) GetCFilter(hash chainhash.Hash, _ wire.FilterType, _ ...neutrino.QueryOption) (*gcs.Filter, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	var next fetchedBlock
+	var ok bool
+	select {
+	case next, ok = <-s.fetched:
+	case <-s.ctx.Done():
+		return nil, s.fail(s.ctx.Err())
+	}
+	if !ok {
+		if s.pipelineErr != nil {
+			return nil, s.fail(s.pipelineErr)
+		}
+		return nil, s.fail(errors.New("rescan ran past the blocks fetched for it"))
+	}
+
+	s.current, s.served = next, false
+	if next.block == nil {
+		return emptyFilter, nil
+	}
+	if *next.block.Hash() != hash {
+		return nil, s.fail(fmt.Errorf("block %s fetched for height %d, but rescan is at %s", next.block.Hash(), next.height, hash))
+	}
+	filter, _ := s.filters.LoadAndDelete(next.height)
+	return filter.(*gcs.Filter), nil
+}
+
+// GetBlock returns the matching block fetched for the height the Rescan is
+// at.
+func (s *jobSource) GetBlock(hash chainhash.Hash, _ ...neutrino.QueryOption) (*btcutil.Block, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.current.block == nil || *s.current.block.Hash() != hash {
+		return nil, s.fail(fmt.Errorf("block %s was not fetched for the rescan", hash))
+	}
+	s.served = true
+	return s.current.block, nil
+}
+
+// connected applies the block the Rescan connected at height.
+func (s *jobSource) connected(height int32, apply blockApplier) {
+	if s.err != nil {
+		return
+	}
+	var block *btcutil.Block
+	if s.current.height == height && s.served {
+		block = s.current.block
+	}
+	if err := apply(height, block); err != nil {
+		s.fail(err)
+	}
+}
+
+// rescanRange scans startHeight through endHeight of chain for scripts with
+// neutrino's Rescan. The scan workers fetch the blocks ahead with fetch, and
+// apply is called from the Rescan's block connected notifications, once per
+// height in ascending order, with the matching block or nil. Canceling ctx or
+// an apply error ends the scan and is returned.
+func rescanRange(ctx context.Context, chain neutrino.ChainSource, startHeight, endHeight int32, workers int,
+	scripts [][]byte, fetch matchFetcher, apply blockApplier) error {
+
+	if endHeight < startHeight {
+		return nil
+	}
+
+	// The Rescan notifies the blocks after its start block, so the genesis
+	// block, whose output cannot be spent, is passed over
+	if startHeight == 0 {
+		if err := apply(0, nil); err != nil {
+			return err
+		}
+		if startHeight++; endHeight < startHeight {
+			return nil
+		}
+	}
+
+	start, err := chain.GetBlockHeaderByHeight(uint32(startHeight - 1))
+	if err != nil {
+		return fmt.Errorf("failed to get block header for height %d: %w", startHeight-1, err)
+	}
+	end, err := chain.GetBlockHeaderByHeight(uint32(endHeight))
+	if err != nil {
+		return fmt.Errorf("failed to get block header for height %d: %w", endHeight, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	source := newJobSource(ctx, chain)
+
+	var pipeline sync.WaitGroup
+	pipeline.Go(func() {
+		source.finish(scanRange(ctx, startHeight, endHeight, workers, source.fetch(fetch), source.queue))
+	})
+
+	inputs := make([]neutrino.InputWithScript, 0, len(scripts))
+	for _, script := range scripts {
+		inputs = append(inputs, scriptInput(script))
+	}
+	quit := make(chan struct{})
+	rescan := neutrino.NewRescan(
+		source,
+		neutrino.StartBlock(&headerfs.BlockStamp{Height: startHeight - 1, Hash: start.BlockHash()}),
+		neutrino.EndBlock(&headerfs.BlockStamp{Height: endHeight, Hash: end.BlockHash()}),
+		neutrino.WatchInputs(inputs...),
+		neutrino.NotificationHandlers(rpcclient.NotificationHandlers{
+			OnFilteredBlockConnected: func(height int32, _ *wire.BlockHeader, _ []*btcutil.Tx) {
+				source.connected(height, apply)
+			},
+		}),
+		neutrino.QuitChan(quit),
+	)
+	err = <-rescan.Start()
+	close(quit)
+	rescan.WaitForShutdown()
+	cancel()
+	pipeline.Wait()
+
+	if source.err != nil {
+		return source.err
+	}
+	return err
+}
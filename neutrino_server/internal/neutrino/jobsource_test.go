@@ -0,0 +1,186 @@
+package neutrino
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/gcs"
+	"github.com/btcsuite/btcd/btcutil/gcs/builder"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightninglabs/neutrino"
+	"github.com/lightninglabs/neutrino/blockntfns"
+	"github.com/lightninglabs/neutrino/headerfs"
+)
+
+// rescanTestChain is a chain source of tip+1 distinct headers for the Rescan.
+type rescanTestChain struct {
+	tip int32
+}
+
+func (c *rescanTestChain) header(height int32) wire.BlockHeader {
+	return wire.BlockHeader{Nonce: uint32(height), Timestamp: time.Unix(1231006505+int64(height)*600, 0)}
+}
+
+func (c *rescanTestChain) ChainParams() chaincfg.Params { return chaincfg.RegressionNetParams }
+
+func (c *rescanTestChain) BestBlock() (*headerfs.BlockStamp, error) {
+	header := c.header(c.tip)
+	return &headerfs.BlockStamp{Height: c.tip, Hash: header.BlockHash()}, nil
+}
+
+func (c *rescanTestChain) GetBlockHeaderByHeight(height uint32) (*wire.BlockHeader, error) {
+	if int32(height) > c.tip {
+		return nil, errors.New("unknown height")
+	}
+	header := c.header(int32(height))
+	return &header, nil
+}
+
+func (c *rescanTestChain) GetBlockHeader(hash *chainhash.Hash) (*wire.BlockHeader, uint32, error) {
+	for height := int32(0); height <= c.tip; height++ {
+		if header := c.header(height); header.BlockHash() == *hash {
+			return &header, uint32(height), nil
+		}
+	}
+	return nil, 0, errors.New("unknown hash")
+}
+
+func (c *rescanTestChain) GetBlock(chainhash.Hash, ...neutrino.QueryOption) (*btcutil.Block, error) {
+	return nil, errors.New("blocks are served by the job source")
+}
+
+func (c *rescanTestChain) GetFilterHeaderByHeight(uint32) (*chainhash.Hash, error) {
+	return &chainhash.Hash{}, nil
+}
+
+func (c *rescanTestChain) GetCFilter(chainhash.Hash, wire.FilterType, ...neutrino.QueryOption) (*gcs.Filter, error) {
+	return nil, errors.New("filters are served by the job source")
+}
+
+func (c *rescanTestChain) Subscribe(uint32) (*blockntfns.Subscription, error) {
+	return nil, errors.New("the rescan ends before the tip")
+}
+
+func (c *rescanTestChain) IsCurrent() bool { return true }
+
+// testMatchingBlock returns the block at height of chain, with a transaction
+// paying scripts, and its filter.
+func testMatchingBlock(t *testing.T, chain *rescanTestChain, height int32, scripts ...[]byte) (*btcutil.Block, *gcs.Filter) {
+	t.Helper()
+	msg := &wire.MsgBlock{Header: chain.header(height)}
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex}})
+	payment := wire.NewMsgTx(wire.TxVersion)
+	payment.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}})
+	for _, script := range scripts {
+		payment.AddTxOut(wire.NewTxOut(1000, script))
+	}
+	msg.AddTransaction(coinbase)
+	msg.AddTransaction(payment)
+
+	filter, err := builder.BuildBasicFilter(msg, nil)
+	if err != nil {
+		t.Fatalf("BuildBasicFilter() error = %v", err)
+	}
+	return btcutil.NewBlock(msg), filter
+}
+
+func TestEmptyFilterMatchesNothing(t *testing.T) {
+	if emptyFilter == nil || emptyFilter.N() != 0 {
+		t.Fatalf("emptyFilter = %v, want a filter of no elements", emptyFilter)
+	}
+}
+
+func TestRescanRange(t *testing.T) {
+	script := []byte{0x00, 0x14, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a,
+		0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11, 0x12, 0x13, 0x14}
+	chain := &rescanTestChain{tip: 100}
+	matching := map[int32]bool{3: true, 40: true, 41: true, 80: true}
+
+	tests := []struct {
+		name        string
+		start, end  int32
+		invalid     int32
+		unmatched   int32
+		failAt      int32 // 0 for none
+		wantHeights int
+		wantErr     bool
+	}{
+		{name: "from genesis", start: 0, end: 90, wantHeights: 91},
+		{name: "mid range", start: 20, end: 60, wantHeights: 41},
+		{name: "single block", start: 40, end: 40, wantHeights: 1},
+		{name: "empty range", start: 60, end: 59},
+		{name: "filter not matching its block", start: 1, end: 90, invalid: 40, wantErr: true},
+		{name: "filter not matching the scripts", start: 1, end: 90, unmatched: 41, wantHeights: 90},
+		{name: "apply error", start: 1, end: 90, failAt: 50, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetch := func(height int32) (*btcutil.Block, *gcs.Filter) {
+				if !matching[height] {
+					return nil, nil
+				}
+				block, filter := testMatchingBlock(t, chain, height, script)
+				if height == tt.invalid {
+					// The filter matches, but misses an output of the block
+					block, _ = testMatchingBlock(t, chain, height, script, []byte{0x51})
+				}
+				if height == tt.unmatched {
+					// The Rescan matches the filter itself
+					block, filter = testMatchingBlock(t, chain, height, []byte{0x52})
+				}
+				return block, filter
+			}
+
+			next := tt.start
+			applyErr := errors.New("apply failed")
+			apply := func(height int32, block *btcutil.Block) error {
+				if height != next {
+					t.Fatalf("applied height %d, want %d", height, next)
+				}
+				next++
+				if want := matching[height] && height != tt.unmatched; want != (block != nil) {
+					t.Errorf("height %d applied block %v, want one: %v", height, block != nil, want)
+				}
+				if tt.failAt != 0 && height == tt.failAt {
+					return applyErr
+				}
+				return nil
+			}
+
+			err := rescanRange(context.Background(), chain, tt.start, tt.end, 4, [][]byte{script}, fetch, apply)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("rescanRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.failAt != 0 && !errors.Is(err, applyErr) {
+				t.Fatalf("rescanRange() error = %v, want %v", err, applyErr)
+			}
+			if !tt.wantErr && next-tt.start != int32(tt.wantHeights) {
+				t.Errorf("applied %d heights, want %d", next-tt.start, tt.wantHeights)
+			}
+		})
+	}
+}
+
+func TestRescanRangeCanceled(t *testing.T) {
+	chain := &rescanTestChain{tip: 100}
+	ctx, cancel := context.WithCancel(context.Background())
+	apply := func(height int32, _ *btcutil.Block) error {
+		if height == 10 {
+			cancel()
+		}
+		return nil
+	}
+	fetch := func(int32) (*btcutil.Block, *gcs.Filter) { return nil, nil }
+
+	err := rescanRange(ctx, chain, 1, 90, 4, [][]byte{{0x51}}, fetch, apply)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("rescanRange() error = %v, want %v", err, context.Canceled)
+	}
+}
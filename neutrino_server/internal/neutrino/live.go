@@ -0,0 +1,296 @@
+package neutrino
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/gcs/builder"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightninglabs/neutrino"
+	"github.com/lightninglabs/neutrino/headerfs"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// StartLive starts following the chain tip with neutrino's Rescan. Every
+// block connected from the current tip on is matched against the watched
+// addresses and applied like a scanned block, and a disconnected block is
+// unwound with its undo data. Rescan jobs still cover the blocks below the
+// tip.
+func (r *RescanManager) StartLive() error {
+	if r.chainService == nil {
+		return errors.New("chain service not initialized")
+	}
+
+	// mu is held throughout, so no address is added between the snapshot
+	// below and the follower becoming visible to watchLiveAddress. It is
+	// always taken before liveMu.
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.liveMu.Lock()
+	defer r.liveMu.Unlock()
+	if r.live != nil {
+		return nil
+	}
+	// Stop cancels ctx before it takes liveMu, so a follower is never
+	// started after it
+	if r.ctx != nil && r.ctx.Err() != nil {
+		return r.ctx.Err()
+	}
+
+	bestBlock, err := r.chainService.BestBlock()
+	if err != nil {
+		return fmt.Errorf("failed to get best block: %w", err)
+	}
+
+	addrs := make([]btcutil.Address, 0, len(r.watchedScripts))
+	inputs := make([]neutrino.InputWithScript, 0, len(r.watchedScripts))
+	for entry, script := range r.watchedScripts {
+		if addr, ok := r.entryAddress(entry, script); ok {
+			addrs = append(addrs, addr)
+		}
+		inputs = append(inputs, scriptInput(script))
+	}
+	for _, utxo := range r.utxoSet {
+		if input, ok := utxoInput(utxo); ok {
+			inputs = append(inputs, input)
+		}
+	}
+
+	quit := make(chan struct{})
+	live := neutrino.NewRescan(
+		&neutrino.RescanChainSource{ChainService: r.chainService},
+		neutrino.StartBlock(&headerfs.BlockStamp{Height: bestBlock.Height, Hash: bestBlock.Hash}),
+		neutrino.WatchAddrs(addrs...),
+		neutrino.WatchInputs(inputs...),
+		neutrino.NotificationHandlers(rpcclient.NotificationHandlers{
+			OnFilteredBlockConnected:    r.onLiveBlockConnected,
+			OnFilteredBlockDisconnected: r.onLiveBlockDisconnected,
+		}),
+		neutrino.QuitChan(quit),
+	)
+	errChan := live.Start()
+	go func() {
+		if err := <-errChan; err != nil && !errors.Is(err, neutrino.ErrRescanExit) {
+			r.logger.Errorf("Following the chain tip stopped: %v", err)
+		}
+	}()
+
+	r.live = live
+	r.liveQuit = quit
+	r.liveFrom = bestBlock.Height
+	r.logger.Infof("Following the chain tip from height %d for %d addresses", logging.KV("height", bestBlock.Height), len(addrs))
+	return nil
+}
+
+// StopLive stops following the chain tip.
+func (r *RescanManager) StopLive() {
+	r.liveMu.Lock()
+	defer r.liveMu.Unlock()
+	if r.live == nil {
+		return
+	}
+
+	close(r.liveQuit)
+	r.live.WaitForShutdown()
+	r.live = nil
+	r.liveQuit = nil
+}
+
+// isLive reports whether the chain tip is being followed.
+func (r *RescanManager) isLive() bool {
+	r.liveMu.Lock()
+	defer r.liveMu.Unlock()
+	return r.live != nil
+}
+
+// updateLive sends an update to the live follower, if running. The update is
+// sent from its own goroutine, since the follower may be waiting on mu in a
+// notification handler.
+func (r *RescanManager) updateLive(options ...neutrino.UpdateOption) {
+	r.liveMu.Lock()
+	live := r.live
+	r.liveMu.Unlock()
+	if live == nil {
+		return
+	}
+
+	go func() {
+		if err := live.Update(options...); err != nil {
+			r.logger.Warnf("Failed to update the chain tip follower: %v", err)
+		}
+	}()
+}
+
+// watchLiveScript adds the watch entry paid by script to the live follower,
+// which rewinds to fromHeight so no block connected since the entry was added
+// is missed.
+func (r *RescanManager) watchLiveScript(entry string, script []byte, fromHeight int32) {
+	options := []neutrino.UpdateOption{neutrino.AddInputs(scriptInput(script))}
+	if addr, ok := r.entryAddress(entry, script); ok {
+		options = append(options, neutrino.AddAddrs(addr))
+	}
+	if fromHeight > 0 {
+		options = append(options, neutrino.Rewind(uint32(fromHeight)), neutrino.DisableDisconnectedNtfns(true))
+	}
+	r.updateLive(options...)
+}
+
+// watchLiveInputs adds UTXOs found by a rescan to the live follower, so
+// their spends are reported.
+func (r *RescanManager) watchLiveInputs(utxos map[string]UTXO) {
+	var inputs []neutrino.InputWithScript
+	for _, utxo := range utxos {
+		if input, ok := utxoInput(utxo); ok {
+			inputs = append(inputs, input)
+		}
+	}
+	if len(inputs) > 0 {
+		r.updateLive(neutrino.AddInputs(inputs...))
+	}
+}
+
+// onLiveBlockConnected applies a block connected at the followed tip. txs
+// are the block's transactions relevant to the watched addresses.
+func (r *RescanManager) onLiveBlockConnected(height int32, header *wire.BlockHeader, txs []*btcutil.Tx) {
+	r.mu.RLock()
+	watched := make([]string, 0, len(r.watchedScripts))
+	for address := range r.watchedScripts {
+		watched = append(watched, address)
+	}
+	r.mu.RUnlock()
+	active := r.activeAddresses(watched)
+	r.liveMu.Lock()
+	from := r.liveFrom
+	r.liveMu.Unlock()
+
+	scriptEntries := make(map[string]string, len(active))
+	var addressless [][]byte
+	r.mu.RLock()
+	for _, entry := range active {
+		script := r.watchedScripts[entry]
+		scriptEntries[hex.EncodeToString(script)] = entry
+		if _, ok := r.entryAddress(entry, script); !ok {
+			addressless = append(addressless, script)
+		}
+	}
+	r.mu.RUnlock()
+
+	foundUTXOs := make(map[string]UTXO)
+	spentOutputs := make(map[string]Spend)
+	foundTxs := make(map[string]IndexedTx)
+	// neutrino only reports transactions paying an address, so the filter
+	// is checked for the scripts without one
+	ctx := r.context()
+	if len(txs) > 0 || r.filterMatches(ctx, header.BlockHash(), addressless) {
+		block, err := fetchBlock(ctx, r.blocks, header.BlockHash(), height)
+		if err != nil {
+			r.logger.Warnf("Failed to get block %d at the chain tip: %v", logging.KV("height", height), err)
+			r.rescanLiveGap(height, active)
+			return
+		}
+		r.processBlock(height, block, scriptEntries, foundUTXOs, spentOutputs, foundTxs)
+	}
+
+	r.mu.RLock()
+	undo := r.blockUndo(foundUTXOs, spentOutputs)
+	r.mu.RUnlock()
+
+	if r.store != nil {
+		err := r.persistUTXOChanges(undo, foundUTXOs, spentOutputs)
+		if err == nil {
+			err = r.store.PutTransactions(foundTxs)
+		}
+		if err == nil {
+			err = r.store.AdvanceScannedHeight(active, from, height)
+		}
+		if err != nil {
+			r.logger.Errorf("Failed to apply block %d at the chain tip: %v", logging.KV("height", height), err)
+			r.rescanLiveGap(height, active)
+			return
+		}
+	}
+
+	r.applyUTXOChanges(foundUTXOs, spentOutputs)
+}
+
+// onLiveBlockDisconnected unwinds a block disconnected from the followed
+// tip.
+func (r *RescanManager) onLiveBlockDisconnected(height int32, header *wire.BlockHeader) {
+	r.logger.Infof("Block %d (%s) disconnected from the chain tip", logging.KV("height", height), header.BlockHash())
+	if _, err := r.RollbackBlocks(height - 1); err != nil {
+		r.logger.Errorf("Failed to unwind disconnected block %d: %v", logging.KV("height", height), err)
+	}
+}
+
+// rescanLiveGap schedules a rescan of addresses from height after the live
+// follower failed to apply that block. Their scanned heights stop advancing
+// until the rescan fills the gap.
+func (r *RescanManager) rescanLiveGap(height int32, addresses []string) {
+	if len(addresses) == 0 {
+		return
+	}
+	r.background(func(ctx context.Context) {
+		if err := r.Rescan(ctx, height, addresses); err != nil && !errors.Is(err, context.Canceled) {
+			r.logger.Errorf("Rescan of block %d missed at the chain tip failed: %v", logging.KV("height", height), err)
+		}
+	})
+}
+
+// filterMatches reports whether the basic filter of the block with hash
+// matches any of scripts. A filter that cannot be fetched counts as a match.
+func (r *RescanManager) filterMatches(ctx context.Context, hash chainhash.Hash, scripts [][]byte) bool {
+	if len(scripts) == 0 {
+		return false
+	}
+	filter, err := r.metrics.getCFilter(ctx, r.chainService, hash)
+	if err != nil || filter == nil {
+		return true
+	}
+	matched, err := filter.MatchAny(builder.DeriveKey(&hash), scripts)
+	return err != nil || matched
+}
+
+// entryAddress returns the address of a watch entry, unless its script has
+// no address form.
+func (r *RescanManager) entryAddress(entry string, script []byte) (btcutil.Address, bool) {
+	addr, err := btcutil.DecodeAddress(entry, r.chainParams)
+	if err != nil {
+		return nil, false
+	}
+	addrScript, err := txscript.PayToAddrScript(addr)
+	if err != nil || !bytes.Equal(addrScript, script) {
+		return nil, false
+	}
+	return addr, true
+}
+
+// scriptInput matches any input spending an output paying script: neutrino
+// treats a zero outpoint as a wildcard on the spent script. Its script also
+// joins the filters neutrino matches blocks against.
+func scriptInput(script []byte) neutrino.InputWithScript {
+	return neutrino.InputWithScript{PkScript: script}
+}
+
+// utxoInput matches the input spending utxo.
+func utxoInput(utxo UTXO) (neutrino.InputWithScript, bool) {
+	hash, err := chainhash.NewHashFromStr(utxo.TxID)
+	if err != nil {
+		return neutrino.InputWithScript{}, false
+	}
+	script, err := hex.DecodeString(utxo.ScriptPubKey)
+	if err != nil || len(script) == 0 {
+		return neutrino.InputWithScript{}, false
+	}
+	return neutrino.InputWithScript{
+		OutPoint: wire.OutPoint{Hash: *hash, Index: utxo.Vout},
+		PkScript: script,
+	}, true
+}
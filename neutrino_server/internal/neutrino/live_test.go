@@ -0,0 +1,100 @@
+package neutrino
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+)
+
+func TestAdvanceScannedHeight(t *testing.T) {
+	store := newTestStore(t)
+
+	heights := map[string]int32{
+		"caught-up": 99,
+		"behind":    80,
+		"ahead":     120,
+		"never":     -1,
+	}
+	for address, height := range heights {
+		if err := store.AddWatchedAddress(address, nil, 0); err != nil {
+			t.Fatal(err)
+		}
+		if height >= 0 {
+			if err := store.SetScannedHeight([]string{address}, height); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	addresses := []string{"caught-up", "behind", "ahead", "never", "unknown"}
+	if err := store.AdvanceScannedHeight(addresses, 90, 101); err != nil {
+		t.Fatalf("AdvanceScannedHeight() failed: %v", err)
+	}
+
+	watched, err := store.WatchedAddresses()
+	if err != nil {
+		t.Fatalf("WatchedAddresses() failed: %v", err)
+	}
+	want := map[string]int32{"caught-up": 101, "behind": 80, "ahead": 120, "never": -1}
+	for address, height := range want {
+		if got := watched[address].ScannedHeight; got != height {
+			t.Errorf("scanned height of %s = %d, want %d", address, got, height)
+		}
+	}
+	if _, ok := watched["unknown"]; ok {
+		t.Error("AdvanceScannedHeight() added an unwatched address")
+	}
+}
+
+func TestLiveBlocks(t *testing.T) {
+	store := newTestStore(t)
+	mgr := &RescanManager{
+		chainParams:    &chaincfg.MainNetParams,
+		store:          store,
+		logger:         btclog.Disabled,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
+		liveFrom:       100,
+	}
+
+	addr := "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	if err := mgr.WatchAddress(addr); err != nil {
+		t.Fatal(err)
+	}
+	job := &RescanJob{Addresses: []string{addr}, CheckpointHeight: -1}
+	found := map[string]UTXO{
+		"tx1:0": {TxID: "tx1", Vout: 0, Value: 1000, Address: addr, Height: 102},
+	}
+	if err := mgr.commitScanProgress(job, 102, job.Addresses, found, map[string]Spend{}); err != nil {
+		t.Fatalf("commitScanProgress() failed: %v", err)
+	}
+
+	// A block without relevant transactions only advances the scanned height
+	mgr.onLiveBlockConnected(103, &wire.BlockHeader{}, nil)
+	watched, err := store.WatchedAddresses()
+	if err != nil {
+		t.Fatalf("WatchedAddresses() failed: %v", err)
+	}
+	if got := watched[addr].ScannedHeight; got != 103 {
+		t.Errorf("scanned height after connect = %d, want 103", got)
+	}
+
+	// Disconnecting the block that created the UTXO unwinds it
+	mgr.onLiveBlockDisconnected(103, &wire.BlockHeader{})
+	if _, ok := mgr.utxoSet["tx1:0"]; !ok {
+		t.Error("UTXO below the disconnected block was removed")
+	}
+	mgr.onLiveBlockDisconnected(102, &wire.BlockHeader{})
+	if _, ok := mgr.utxoSet["tx1:0"]; ok {
+		t.Error("UTXO of the disconnected block is still in the set")
+	}
+	watched, err = store.WatchedAddresses()
+	if err != nil {
+		t.Fatalf("WatchedAddresses() failed: %v", err)
+	}
+	if got := watched[addr].ScannedHeight; got != 101 {
+		t.Errorf("scanned height after disconnect = %d, want 101", got)
+	}
+}
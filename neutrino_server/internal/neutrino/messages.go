@@ -0,0 +1,253 @@
+package neutrino
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Signed message formats recognised by VerifyMessage.
+const (
+	// MessageFormatLegacy is a signmessage compact signature, including the
+	// BIP137 headers for segwit addresses.
+	MessageFormatLegacy = "legacy"
+	// MessageFormatSimple is a BIP322 signature carrying only the witness
+	// of the to_sign transaction.
+	MessageFormatSimple = "simple"
+	// MessageFormatFull is a BIP322 signature carrying the whole to_sign
+	// transaction.
+	MessageFormatFull = "full"
+)
+
+// legacyMessageMagic prefixes messages signed with signmessage.
+const legacyMessageMagic = "Bitcoin Signed Message:\n"
+
+// bip322Tag is the tag of the BIP340 tagged hash of a BIP322 message.
+var bip322Tag = []byte("BIP0322-signed-message")
+
+// MessageVerification is the result of verifying a signed message. Error
+// says why a well-formed signature did not verify.
+type MessageVerification struct {
+	Valid  bool   `json:"valid"`
+	Format string `json:"format"`
+	Error  string `json:"error,omitempty"`
+}
+
+// VerifyMessage verifies that signature, base64 encoded, signs message for
+// address. Legacy signmessage signatures and BIP322 simple and full
+// signatures are accepted; BIP322 proofs of funds, which spend further
+// inputs, are not. A signature in none of these formats is a bad request.
+func (n *Node) VerifyMessage(address, signature, message string) (*MessageVerification, error) {
+	addr, err := btcutil.DecodeAddress(address, n.chainParams)
+	if err != nil {
+		return nil, NewBadRequestError(fmt.Sprintf("invalid address %s: %v", address, err))
+	}
+	if !addr.IsForNet(n.chainParams) {
+		return nil, NewBadRequestError(fmt.Sprintf("address %s is not for %s", address, n.chainParams.Name))
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, NewBadRequestError(fmt.Sprintf("unsupported address %s: %v", address, err))
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, NewBadRequestError(fmt.Sprintf("invalid signature encoding: %v", err))
+	}
+
+	result := &MessageVerification{}
+	if len(raw) == 65 && raw[0] >= 27 && raw[0] <= 42 {
+		result.Format = MessageFormatLegacy
+		err = verifyLegacyMessage(addr, raw, message, n.chainParams)
+	} else if witness, ok := parseWitnessStack(raw); ok {
+		result.Format = MessageFormatSimple
+		toSign := bip322ToSign(pkScript, message)
+		toSign.TxIn[0].Witness = witness
+		if _, nested := addr.(*btcutil.AddressScriptHash); nested {
+			toSign.TxIn[0].SignatureScript = nestedWitnessScriptSig(witness)
+		}
+		err = verifyBIP322(pkScript, toSign)
+	} else if toSign, ok := parseTransaction(raw); ok {
+		result.Format = MessageFormatFull
+		err = checkBIP322ToSign(toSign, pkScript, message)
+		if err == nil {
+			err = verifyBIP322(pkScript, toSign)
+		}
+	} else {
+		return nil, NewBadRequestError("signature is neither a legacy nor a BIP322 simple or full signature")
+	}
+
+	result.Valid = err == nil
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result, nil
+}
+
+// verifyLegacyMessage checks a signmessage signature by recovering its
+// public key and comparing the address it makes with addr. Segwit
+// addresses are checked against the compressed key, whatever the header.
+func verifyLegacyMessage(addr btcutil.Address, sig []byte, message string, params *chaincfg.Params) error {
+	var buf bytes.Buffer
+	if err := wire.WriteVarString(&buf, 0, legacyMessageMagic); err != nil {
+		return err
+	}
+	if err := wire.WriteVarString(&buf, 0, message); err != nil {
+		return err
+	}
+
+	// BIP137 headers 35-42 mark segwit signatures, which always use a
+	// compressed key
+	sig = bytes.Clone(sig)
+	if sig[0] >= 35 {
+		sig[0] = 31 + (sig[0]-35)%4
+	}
+	pubKey, compressed, err := ecdsa.RecoverCompact(sig, chainhash.DoubleHashB(buf.Bytes()))
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+
+	serialized := pubKey.SerializeUncompressed()
+	if compressed {
+		serialized = pubKey.SerializeCompressed()
+	}
+	keyHash := btcutil.Hash160(serialized)
+
+	var signer btcutil.Address
+	switch addr.(type) {
+	case *btcutil.AddressPubKeyHash:
+		signer, err = btcutil.NewAddressPubKeyHash(keyHash, params)
+	case *btcutil.AddressWitnessPubKeyHash:
+		if !compressed {
+			return errors.New("segwit signatures need a compressed key")
+		}
+		signer, err = btcutil.NewAddressWitnessPubKeyHash(keyHash, params)
+	case *btcutil.AddressScriptHash:
+		if !compressed {
+			return errors.New("segwit signatures need a compressed key")
+		}
+		signer, err = btcutil.NewAddressScriptHash(append([]byte{txscript.OP_0, txscript.OP_DATA_20}, keyHash...), params)
+	default:
+		return errors.New("legacy signatures only sign for P2PKH, P2WPKH and P2SH-P2WPKH addresses")
+	}
+	if err != nil {
+		return err
+	}
+	if signer.EncodeAddress() != addr.EncodeAddress() {
+		return errors.New("signature is not by the key of the address")
+	}
+	return nil
+}
+
+// bip322ToSpend returns the virtual transaction whose only output the
+// to_sign transaction of message spends.
+func bip322ToSpend(pkScript []byte, message string) *wire.MsgTx {
+	messageHash := chainhash.TaggedHash(bip322Tag, []byte(message))
+	scriptSig := append([]byte{txscript.OP_0, txscript.OP_DATA_32}, messageHash[:]...)
+
+	toSpend := wire.NewMsgTx(0)
+	toSpend.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		SignatureScript:  scriptSig,
+		Sequence:         0,
+	})
+	toSpend.AddTxOut(wire.NewTxOut(0, pkScript))
+	return toSpend
+}
+
+// bip322ToSign returns the unsigned to_sign transaction of a BIP322 simple
+// signature of message.
+func bip322ToSign(pkScript []byte, message string) *wire.MsgTx {
+	toSpendHash := bip322ToSpend(pkScript, message).TxHash()
+
+	toSign := wire.NewMsgTx(0)
+	toSign.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: toSpendHash, Index: 0},
+		Sequence:         0,
+	})
+	toSign.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN}))
+	return toSign
+}
+
+// checkBIP322ToSign checks that the to_sign transaction of a full signature
+// spends the to_spend transaction of message, and nothing else.
+func checkBIP322ToSign(toSign *wire.MsgTx, pkScript []byte, message string) error {
+	toSpendHash := bip322ToSpend(pkScript, message).TxHash()
+	if len(toSign.TxIn) == 0 || toSign.TxIn[0].PreviousOutPoint != (wire.OutPoint{Hash: toSpendHash, Index: 0}) {
+		return errors.New("to_sign does not spend the to_spend transaction of the message")
+	}
+	if len(toSign.TxIn) > 1 {
+		return errors.New("proofs of funds are not supported")
+	}
+	if len(toSign.TxOut) != 1 || toSign.TxOut[0].Value != 0 || !bytes.Equal(toSign.TxOut[0].PkScript, []byte{txscript.OP_RETURN}) {
+		return errors.New("to_sign must have a single empty OP_RETURN output")
+	}
+	return nil
+}
+
+// verifyBIP322 runs the script of the first input of toSign against
+// pkScript, the script of the to_spend output it spends.
+func verifyBIP322(pkScript []byte, toSign *wire.MsgTx) error {
+	prevOutputs := txscript.NewCannedPrevOutputFetcher(pkScript, 0)
+	engine, err := txscript.NewEngine(pkScript, toSign, 0, txscript.StandardVerifyFlags,
+		nil, txscript.NewTxSigHashes(toSign, prevOutputs), 0, prevOutputs)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	if err := engine.Execute(); err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	return nil
+}
+
+// nestedWitnessScriptSig returns the scriptSig of a P2SH-P2WPKH input with
+// witness, which a simple signature leaves out.
+func nestedWitnessScriptSig(witness wire.TxWitness) []byte {
+	if len(witness) != 2 {
+		return nil
+	}
+	program := append([]byte{txscript.OP_0, txscript.OP_DATA_20}, btcutil.Hash160(witness[1])...)
+	scriptSig, err := txscript.NewScriptBuilder().AddData(program).Script()
+	if err != nil {
+		return nil
+	}
+	return scriptSig
+}
+
+// parseWitnessStack parses a serialized witness stack, which must be the
+// whole of raw.
+func parseWitnessStack(raw []byte) (wire.TxWitness, bool) {
+	r := bytes.NewReader(raw)
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil || count == 0 || count > uint64(r.Len()) {
+		return nil, false
+	}
+
+	witness := make(wire.TxWitness, count)
+	for i := range witness {
+		witness[i], err = wire.ReadVarBytes(r, 0, wire.MaxBlockPayload, "witness item")
+		if err != nil {
+			return nil, false
+		}
+	}
+	return witness, r.Len() == 0
+}
+
+// parseTransaction parses a serialized transaction, which must be the whole
+// of raw.
+func parseTransaction(raw []byte) (*wire.MsgTx, bool) {
+	r := bytes.NewReader(raw)
+	var tx wire.MsgTx
+	if err := tx.Deserialize(r); err != nil {
+		return nil, false
+	}
+	return &tx, r.Len() == 0
+}
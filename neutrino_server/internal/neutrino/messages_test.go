@@ -0,0 +1,138 @@
+package neutrino
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestBIP322MessageHash(t *testing.T) {
+	// BIP322 test vectors
+	tests := map[string]string{
+		"":            "c90c269c4f8fcbe6880f72a721ddfbf1914268a794cbb21cfafee13770ae19f1",
+		"Hello World": "f0eb03b1a75ac6d9847f55c624a99169b5dccba2a31f5b23bea77ba270de0a7a",
+	}
+	for message, want := range tests {
+		if got := chainhash.TaggedHash(bip322Tag, []byte(message)); hex.EncodeToString(got[:]) != want {
+			t.Errorf("message hash of %q = %x, want %s", message, got[:], want)
+		}
+	}
+}
+
+func TestVerifyMessage(t *testing.T) {
+	n := &Node{chainParams: &chaincfg.MainNetParams}
+
+	// Legacy signatures are made with a throwaway key
+	privKey, _ := btcec.NewPrivateKey()
+	keyHash := btcutil.Hash160(privKey.PubKey().SerializeCompressed())
+	p2pkh, _ := btcutil.NewAddressPubKeyHash(keyHash, &chaincfg.MainNetParams)
+	p2wpkh, _ := btcutil.NewAddressWitnessPubKeyHash(keyHash, &chaincfg.MainNetParams)
+	legacySign := func(message string, segwit bool) string {
+		var buf bytes.Buffer
+		wire.WriteVarString(&buf, 0, legacyMessageMagic)
+		wire.WriteVarString(&buf, 0, message)
+		sig, err := ecdsa.SignCompact(privKey, chainhash.DoubleHashB(buf.Bytes()), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if segwit {
+			// BIP137 P2WPKH header
+			sig[0] += 8
+		}
+		return base64.StdEncoding.EncodeToString(sig)
+	}
+
+	tests := []struct {
+		name       string
+		address    string
+		signature  string
+		message    string
+		wantFormat string
+		wantValid  bool
+	}{
+		// BIP322 test vectors
+		{"simple p2wpkh empty message", "bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l",
+			"AkcwRAIgM2gBAQqvZX15ZiysmKmQpDrG83avLIT492QBzLnQIxYCIBaTpOaD20qRlEylyxFSeEA2ba9YOixpX8z46TSDtS40ASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+			"", MessageFormatSimple, true},
+		{"simple p2wpkh", "bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l",
+			"AkcwRAIgZRfIY3p7/DoVTty6YZbWS71bc5Vct9p9Fia83eRmw2QCICK/ENGfwLtptFluMGs2KsqoNSk89pO7F29zJLUx9a/sASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+			"Hello World", MessageFormatSimple, true},
+		{"simple p2wpkh wrong message", "bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l",
+			"AkcwRAIgZRfIY3p7/DoVTty6YZbWS71bc5Vct9p9Fia83eRmw2QCICK/ENGfwLtptFluMGs2KsqoNSk89pO7F29zJLUx9a/sASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+			"Hello World!", MessageFormatSimple, false},
+		{"simple p2tr", "bc1ppv609nr0vr25u07u95waq5lucwfm6tde4nydujnu8npg4q75mr5sxq8lt3",
+			"AUHd69PrJQEv+oKTfZ8l+WROBHuy9HKrbFCJu7U1iK2iiEy1vMU5EfMtjc+VSHM7aU0SDbak5IUZRVno2P5mjSafAQ==",
+			"Hello World", MessageFormatSimple, true},
+		{"simple p2tr wrong address", "bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l",
+			"AUHd69PrJQEv+oKTfZ8l+WROBHuy9HKrbFCJu7U1iK2iiEy1vMU5EfMtjc+VSHM7aU0SDbak5IUZRVno2P5mjSafAQ==",
+			"Hello World", MessageFormatSimple, false},
+		{"legacy p2pkh", p2pkh.EncodeAddress(), legacySign("Hello World", false), "Hello World", MessageFormatLegacy, true},
+		{"legacy p2pkh wrong message", p2pkh.EncodeAddress(), legacySign("Hello World", false), "Hello", MessageFormatLegacy, false},
+		{"legacy bip137 p2wpkh", p2wpkh.EncodeAddress(), legacySign("Hello World", true), "Hello World", MessageFormatLegacy, true},
+		{"legacy other key", "bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l", legacySign("Hello World", true), "Hello World", MessageFormatLegacy, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := n.VerifyMessage(tt.address, tt.signature, tt.message)
+			if err != nil {
+				t.Fatalf("VerifyMessage() failed: %v", err)
+			}
+			if result.Format != tt.wantFormat || result.Valid != tt.wantValid {
+				t.Errorf("VerifyMessage() = %+v, want valid=%v format %s", result, tt.wantValid, tt.wantFormat)
+			}
+			if !result.Valid && result.Error == "" {
+				t.Error("invalid signature has no error")
+			}
+		})
+	}
+
+	// The simple signature of the p2wpkh vector, as a full to_sign
+	// transaction
+	simple, _ := base64.StdEncoding.DecodeString(tests[1].signature)
+	witness, _ := parseWitnessStack(simple)
+	script, _ := hex.DecodeString("00142b05d564e6a7a33c087f16e0f730d1440123799d")
+	toSign := bip322ToSign(script, "Hello World")
+	toSign.TxIn[0].Witness = witness
+	var full bytes.Buffer
+	if err := toSign.Serialize(&full); err != nil {
+		t.Fatal(err)
+	}
+	result, err := n.VerifyMessage("bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l", base64.StdEncoding.EncodeToString(full.Bytes()), "Hello World")
+	if err != nil || !result.Valid || result.Format != MessageFormatFull {
+		t.Errorf("VerifyMessage() of a full signature = %+v, %v", result, err)
+	}
+	// A full signature of another message
+	result, err = n.VerifyMessage("bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l", base64.StdEncoding.EncodeToString(full.Bytes()), "")
+	if err != nil || result.Valid {
+		t.Errorf("VerifyMessage() of a full signature of another message = %+v, %v", result, err)
+	}
+
+	badRequests := []struct {
+		name      string
+		address   string
+		signature string
+	}{
+		{"invalid address", "bogus", tests[0].signature},
+		{"testnet address", "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", tests[0].signature},
+		{"invalid base64", tests[0].address, "not base64!"},
+		{"unrecognised signature", tests[0].address, base64.StdEncoding.EncodeToString([]byte{0xff, 0x01})},
+	}
+	for _, tt := range badRequests {
+		t.Run(tt.name, func(t *testing.T) {
+			var badRequest *BadRequestError
+			if _, err := n.VerifyMessage(tt.address, tt.signature, "Hello World"); !errors.As(err, &badRequest) {
+				t.Errorf("VerifyMessage() error = %v, want a bad request", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package neutrino
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/btcsuite/btcd/btcutil/gcs"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightninglabs/neutrino"
+	"github.com/lightninglabs/neutrino/filterdb"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Metrics is a snapshot of the node's state and of the totals it has
+// counted since it started, for monitoring.
+type Metrics struct {
+	Synced       bool
+	BlockHeight  int32
+	FilterHeight int32
+	Peers        int
+
+	// RescanJobs is the number of running rescan jobs, scanning
+	// RescanBlocksPerSecond blocks per second between them.
+	RescanJobs            int
+	RescanBlocksPerSecond float64
+
+	// BlocksScanned counts the blocks checked by rescans.
+	BlocksScanned uint64
+
+	// Filter cache lookups count the filters scans found in neutrino's
+	// filter cache, which batch prefetching fills, and those it had to
+	// fetch from disk or peers.
+	FilterCacheHits   uint64
+	FilterCacheMisses uint64
+
+	// Scan cache lookups count the filter matches of a script in a
+	// segment that filter match requests found in the scan cache, and
+	// those they had to scan for.
+	ScanCacheHits   uint64
+	ScanCacheMisses uint64
+
+	// BlockCacheHits and BlockCacheMisses count the blocks scans found in
+	// the in-memory block cache, and those they had to download.
+	BlockCacheHits   uint64
+	BlockCacheMisses uint64
+
+	// SharedFetches counts the filter batches, filters and blocks a scan
+	// got from a concurrent scan fetching them rather than from peers.
+	SharedFetches uint64
+
+	// ScanMemoHits counts the filter checks scans skipped because an
+	// earlier scan of the same scripts found no match there.
+	ScanMemoHits uint64
+
+	// Broadcast counts are of sends to peers: first broadcasts and
+	// rebroadcasts that were sent or failed, and transactions peers
+	// rejected. PendingBroadcasts is the number still unconfirmed.
+	BroadcastsSent     uint64
+	BroadcastsFailed   uint64
+	BroadcastsRejected uint64
+	Rebroadcasts       uint64
+	PendingBroadcasts  int
+
+	// SyncStalled is set while sync is stalled, and SyncStalls counts the
+	// stalls detected.
+	SyncStalled bool
+	SyncStalls  uint64
+}
+
+// counters are the totals reported by Metrics. Their methods are safe to
+// call on a nil *counters, so components built without one count nothing.
+type counters struct {
+	blocksScanned      atomic.Uint64
+	filterCacheHits    atomic.Uint64
+	filterCacheMisses  atomic.Uint64
+	scanCacheHits      atomic.Uint64
+	scanCacheMisses    atomic.Uint64
+	scanMemoHits       atomic.Uint64
+	sharedFetches      atomic.Uint64
+	blockCacheHits     atomic.Uint64
+	blockCacheMisses   atomic.Uint64
+	filterEvictions    atomic.Uint64
+	blockEvictions     atomic.Uint64
+	broadcastsSent     atomic.Uint64
+	broadcastsFailed   atomic.Uint64
+	broadcastsRejected atomic.Uint64
+	rebroadcasts       atomic.Uint64
+}
+
+// scannedBlock counts a block checked by a rescan.
+func (c *counters) scannedBlock() {
+	if c != nil {
+		c.blocksScanned.Add(1)
+	}
+}
+
+// blockCacheLookup counts a lookup in the in-memory block cache.
+func (c *counters) blockCacheLookup(hit bool) {
+	switch {
+	case c == nil:
+	case hit:
+		c.blockCacheHits.Add(1)
+	default:
+		c.blockCacheMisses.Add(1)
+	}
+}
+
+// cacheLen is a cache of neutrino's that reports its number of entries.
+type cacheLen interface {
+	Len() int
+}
+
+// cacheFill counts the entries that fetches inserting into cache displace.
+// Neutrino's caches do not report their evictions, so they are counted from
+// the change in the cache's entries around each fetch. Fills running at the
+// same time into a full cache can count an eviction more than once. A nil
+// *cacheFill counts nothing.
+type cacheFill struct {
+	cache   cacheLen
+	evicted *atomic.Uint64
+}
+
+// filterFill and blockFill count the evictions fetches cause in the filter
+// and block caches of cs.
+func (c *counters) filterFill(cs *neutrino.ChainService) *cacheFill {
+	if c == nil || cs == nil || cs.FilterCache == nil {
+		return nil
+	}
+	return &cacheFill{cache: cs.FilterCache, evicted: &c.filterEvictions}
+}
+
+func (c *counters) blockFill(cs *neutrino.ChainService) *cacheFill {
+	if c == nil || cs == nil || cs.BlockCache == nil {
+		return nil
+	}
+	return &cacheFill{cache: cs.BlockCache, evicted: &c.blockEvictions}
+}
+
+// run runs fetch, which inserts up to inserted new entries into the cache
+// when it succeeds, and counts the entries the cache lost to make room.
+func (f *cacheFill) run(inserted int, fetch func() error) error {
+	if f == nil {
+		return fetch()
+	}
+	before := f.cache.Len()
+	err := fetch()
+	if err == nil {
+		f.displaced(before, inserted)
+	}
+	return err
+}
+
+// displaced counts the entries the cache lost to make room for inserted
+// new ones, since it held before entries.
+func (f *cacheFill) displaced(before, inserted int) {
+	if lost := before + inserted - f.cache.Len(); lost > 0 {
+		f.evicted.Add(uint64(lost))
+	}
+}
+
+// scanMemoHit counts a filter check skipped by the scan memo.
+func (c *counters) scanMemoHit() {
+	if c != nil {
+		c.scanMemoHits.Add(1)
+	}
+}
+
+// sharedFetch counts a fetch shared with a concurrent scan.
+func (c *counters) sharedFetch() {
+	if c != nil {
+		c.sharedFetches.Add(1)
+	}
+}
+
+// broadcast counts a send of a transaction to peers that failed with err.
+func (c *counters) broadcast(rebroadcast bool, err error) {
+	if c == nil {
+		return
+	}
+	switch {
+	case err != nil:
+		c.broadcastsFailed.Add(1)
+	case rebroadcast:
+		c.rebroadcasts.Add(1)
+	default:
+		c.broadcastsSent.Add(1)
+	}
+}
+
+// scanCacheLookup counts a lookup in the scan cache.
+func (c *counters) scanCacheLookup(hit bool) {
+	switch {
+	case c == nil:
+	case hit:
+		c.scanCacheHits.Add(1)
+	default:
+		c.scanCacheMisses.Add(1)
+	}
+}
+
+// rejected counts a transaction peers rejected.
+func (c *counters) rejected() {
+	if c != nil {
+		c.broadcastsRejected.Add(1)
+	}
+}
+
+// getCFilter fetches the basic filter of the block with hash from cs,
+// counting whether neutrino's filter cache already held it. Filters missing
+// from the cache are fetched in a span, as they may need a round trip to a
+// peer.
+func (c *counters) getCFilter(ctx context.Context, cs *neutrino.ChainService, hash chainhash.Hash) (*gcs.Filter, error) {
+	if cs.FilterCache != nil {
+		_, err := cs.FilterCache.Get(neutrino.FilterCacheKey{BlockHash: hash, FilterType: filterdb.RegularFilter})
+		if err == nil {
+			if c != nil {
+				c.filterCacheHits.Add(1)
+			}
+			return cs.GetCFilter(hash, wire.GCSFilterRegular)
+		}
+		if c != nil {
+			c.filterCacheMisses.Add(1)
+		}
+	}
+
+	_, span := tracer.Start(ctx, "filter.fetch", trace.WithAttributes(attrBlockHash.String(hash.String())))
+	var filter *gcs.Filter
+	err := c.filterFill(cs).run(1, func() (err error) {
+		filter, err = cs.GetCFilter(hash, wire.GCSFilterRegular)
+		return err
+	})
+	endSpan(span, err)
+	return filter, err
+}
+
+// Metrics returns a snapshot of the node's state and counters.
+func (n *Node) Metrics() Metrics {
+	status := n.GetStatus()
+	metrics := Metrics{
+		Synced:       status.Synced,
+		BlockHeight:  status.BlockHeight,
+		FilterHeight: status.FilterHeight,
+		Peers:        status.Peers,
+		SyncStalled:  status.SyncStall != nil,
+		SyncStalls:   n.stalls.count(),
+	}
+
+	if n.rescanMgr != nil {
+		for _, job := range n.rescanMgr.RescanStatus().Jobs {
+			metrics.RescanJobs++
+			metrics.RescanBlocksPerSecond += job.Metrics.BlocksPerSecond
+		}
+	}
+
+	if n.broadcasts != nil {
+		n.broadcasts.mu.Lock()
+		for _, broadcast := range n.broadcasts.txs {
+			if broadcast.Status == TxStatusPending {
+				metrics.PendingBroadcasts++
+			}
+		}
+		n.broadcasts.mu.Unlock()
+	}
+
+	if c := n.metrics; c != nil {
+		metrics.BlocksScanned = c.blocksScanned.Load()
+		metrics.FilterCacheHits = c.filterCacheHits.Load()
+		metrics.FilterCacheMisses = c.filterCacheMisses.Load()
+		metrics.ScanCacheHits = c.scanCacheHits.Load()
+		metrics.ScanCacheMisses = c.scanCacheMisses.Load()
+		metrics.ScanMemoHits = c.scanMemoHits.Load()
+		metrics.SharedFetches = c.sharedFetches.Load()
+		metrics.BlockCacheHits = c.blockCacheHits.Load()
+		metrics.BlockCacheMisses = c.blockCacheMisses.Load()
+		metrics.BroadcastsSent = c.broadcastsSent.Load()
+		metrics.BroadcastsFailed = c.broadcastsFailed.Load()
+		metrics.BroadcastsRejected = c.broadcastsRejected.Load()
+		metrics.Rebroadcasts = c.rebroadcasts.Load()
+	}
+	return metrics
+}
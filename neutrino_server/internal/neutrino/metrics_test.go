@@ -0,0 +1,100 @@
+package neutrino
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+)
+
+func TestMetrics(t *testing.T) {
+	// Components built without counters count nothing
+	var none *counters
+	none.scannedBlock()
+	none.broadcast(false, nil)
+	none.rejected()
+
+	n := &Node{
+		logger:       btclog.Disabled,
+		metrics:      &counters{},
+		blockHeight:  850000,
+		filterHeight: 849990,
+		broadcasts: &broadcastQueue{
+			txs: map[string]BroadcastTx{
+				"a": {TxID: "a", Status: TxStatusPending},
+				"b": {TxID: "b", Status: TxStatusConfirmed},
+			},
+		},
+	}
+	n.metrics.scannedBlock()
+	n.metrics.scannedBlock()
+	n.metrics.broadcast(false, nil)
+	n.metrics.broadcast(true, nil)
+	n.metrics.broadcast(true, errors.New("no peers"))
+	n.metrics.rejected()
+
+	metrics := n.Metrics()
+	want := Metrics{
+		BlockHeight:        850000,
+		FilterHeight:       849990,
+		BlocksScanned:      2,
+		BroadcastsSent:     1,
+		BroadcastsFailed:   1,
+		BroadcastsRejected: 1,
+		Rebroadcasts:       1,
+		PendingBroadcasts:  1,
+	}
+	if metrics != want {
+		t.Errorf("Metrics() = %+v, want %+v", metrics, want)
+	}
+}
+
+// fakeCache is a cache whose entries a test sets.
+type fakeCache struct {
+	entries int
+}
+
+func (c *fakeCache) Len() int { return c.entries }
+
+func TestCacheFill(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after int
+		inserted      int
+		err           error
+		want          uint64
+	}{
+		{name: "room left", before: 10, after: 11, inserted: 1},
+		{name: "one displaced", before: 10, after: 10, inserted: 1, want: 1},
+		{name: "large entry displaced several", before: 10, after: 8, inserted: 1, want: 3},
+		{name: "batch displaced part", before: 90, after: 100, inserted: 20, want: 10},
+		{name: "failed fetch", before: 10, after: 10, inserted: 1, err: errors.New("no peers")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := &counters{}
+			cache := &fakeCache{entries: tt.before}
+			fill := &cacheFill{cache: cache, evicted: &metrics.blockEvictions}
+			err := fill.run(tt.inserted, func() error {
+				cache.entries = tt.after
+				return tt.err
+			})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("run() error = %v, want %v", err, tt.err)
+			}
+			if got := metrics.blockEvictions.Load(); got != tt.want {
+				t.Errorf("evictions = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// Without counters or a cache, fetches run uncounted
+	var none *counters
+	if fill := none.filterFill(nil); fill != nil {
+		t.Fatalf("filterFill() without counters = %v, want none", fill)
+	}
+	ran := false
+	if err := (*cacheFill)(nil).run(1, func() error { ran = true; return nil }); err != nil || !ran {
+		t.Errorf("run() without a fill = %v, ran %t, want the fetch run", err, ran)
+	}
+}
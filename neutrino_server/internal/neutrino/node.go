@@ -7,26 +7,39 @@ BIP157/BIP158 compact block filters for privacy-preserving blockchain access.
 package neutrino
 
 import (
+	"cmp"
+	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
+	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/btcsuite/btcd/btcutil"
-	"github.com/btcsuite/btcd/btcutil/gcs/builder"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
-	"github.com/btcsuite/btcd/connmgr"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btclog"
 	"github.com/btcsuite/btcwallet/walletdb"
-	_ "github.com/btcsuite/btcwallet/walletdb/bdb" // Import bbolt driver
 	"github.com/lightninglabs/neutrino"
-	"golang.org/x/net/proxy"
+	"github.com/lightninglabs/neutrino/headerfs"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+const (
+	// DefaultMaxPeers is the number of peers the node connects to.
+	DefaultMaxPeers = 8
+
+	// DefaultBanDuration is how long misbehaving peers are banned for.
+	DefaultBanDuration = 24 * time.Hour
 )
 
 // Config holds configuration for the neutrino node.
@@ -34,27 +47,175 @@ type Config struct {
 	Network         string
 	DataDir         string
 	TorProxy        string
+	TorIsolation    bool
 	ConnectPeers    string
-	MaxPeers        int
-	BanDuration     time.Duration
-	FilterCacheSize int
-	Logger          *btclog.Backend
+	ScanWorkers     int
+	FilterBatchSize int
+	ScanMode        ScanMode
+	Logger          logging.Backend
 	LogLevel        string
+	Readiness       ReadinessConfig
+	Fees            FeeConfig
+	Retention       RetentionConfig
+	WatchFile       string
+
+	// MaxPeers is the number of peers connected to, DefaultMaxPeers if
+	// zero. BanDuration is how long peers are banned for misbehaving,
+	// DefaultBanDuration if zero.
+	MaxPeers    int
+	BanDuration time.Duration
+
+	// FilterCacheSize is the size in bytes of the compact filters kept in
+	// memory, neutrino's default of about 30 MB if zero.
+	FilterCacheSize int
+
+	// BlockMemoryCacheSize is the size in bytes of the recently fetched
+	// blocks kept in memory, so scans matching the same blocks do not
+	// download them again. Neutrino's default of about 40 MB if zero.
+	BlockMemoryCacheSize int
+
+	// WebhooksFile names a JSON file of webhooks to deliver events to, in
+	// addition to those registered through the API, see LoadWebhookFile.
+	WebhooksFile string
+
+	// AddPeers are peers to connect to in addition to those found through
+	// DNS seeds and the addresses peers announce, as a comma-separated
+	// list. Unlike ConnectPeers they don't stop peer discovery.
+	AddPeers string
+
+	// DNSSeeds replace the network's built-in DNS seeds, as a
+	// comma-separated list; "none" disables DNS seeding. PeersFile names a
+	// file of further static peers and DNS seeds, see LoadPeerFile.
+	DNSSeeds  string
+	PeersFile string
+
+	// OnlyNet restricts peer connections to one network. NetOnion allows
+	// only onion peers, reached through TorProxy: DNS seeds, which only
+	// list clearnet peers, are skipped and clearnet addresses are never
+	// dialed. Peers are discovered from ConnectPeers or AddPeers, which
+	// must be onion addresses, and the onion addresses they announce.
+	OnlyNet string
+
+	// WalletRetention is how long archived wallets are kept before being
+	// purged. Zero keeps them until they are purged explicitly.
+	WalletRetention time.Duration
+
+	// SpentRetention is how many blocks deep spent watched UTXOs are kept
+	// for outpoint lookups before being pruned. Zero keeps them forever.
+	SpentRetention int32
+
+	// MaxPeersPerGroup is the number of peers found through discovery
+	// connected to in the same network group, DefaultMaxPeersPerGroup if
+	// zero. ASNFile names an AS map grouping clearnet peers by the
+	// autonomous system announcing them, see loadASNFile.
+	MaxPeersPerGroup int
+	ASNFile          string
+
+	// StallTimeout is how long sync may not advance while peers are ahead
+	// before it counts as stalled, DefaultStallTimeout if zero.
+	// StallRecovery is what the node does about a stall, one of the
+	// StallRecovery constants; StallRecoveryNone if empty.
+	StallTimeout  time.Duration
+	StallRecovery string
+
+	// Checkpoints are known-good blocks added to the network's built-in
+	// checkpoints. Header sync refuses chains contradicting them, and the
+	// node is not ready while its header chains do.
+	Checkpoints []Checkpoint
+
+	// CheckHeadersOnStart checks the stored header chains before the
+	// chain service opens them, truncating corrupt chains to their last
+	// consistent heights and rolling the store back to match, see
+	// checkHeaderIntegrity.
+	CheckHeadersOnStart bool
+
+	// CompactDBOnStart compacts the database before Start opens it, see
+	// CompactDatabase.
+	CompactDBOnStart bool
+
+	// DBBackend is the database backend, one of the DBBackend constants;
+	// DBBackendBolt if empty. Starting with DBBackendSQLite on a data
+	// directory holding a bbolt database migrates it once, and
+	// DBBackendMemory ignores the data directory. SQLiteJournalMode
+	// is the journal mode of a SQLite database, one of the SQLiteJournal
+	// constants; SQLiteJournalWAL if empty.
+	DBBackend         string
+	SQLiteJournalMode string
+
+	// BackupDir is the directory StartBackup writes backups to, the
+	// data directory's backups directory if empty.
+	BackupDir string
+
+	// BlockCacheMaxBytes bounds the persistent cache of blocks returned by
+	// GetRawBlock. Zero disables the cache.
+	BlockCacheMaxBytes int64
+
+	// IndexDB is the external address index database the node copies the
+	// UTXOs and transactions of watched addresses into, see addrindex.Open.
+	// Empty disables the index.
+	IndexDB string
+
+	// ScanCache, if set, shares the filter matches of scans with other
+	// nodes using the same cache: filter matching, UTXO lookups and rescan
+	// jobs.
+	ScanCache ScanCache
+
+	// MaxRescanJobs is the number of rescan jobs started by StartRescan
+	// running at once, DefaultMaxRescanJobs if zero.
+	MaxRescanJobs int
+
+	// ScanMemoTTL is how long rescans and filter matches remember the
+	// ranges in which scripts matched no filters. Zero disables the memo.
+	ScanMemoTTL time.Duration
 }
 
 // Node wraps a neutrino ChainService with additional functionality.
 type Node struct {
 	config       *Config
+	peerConfig   *PeerConfig
 	chainParams  *chaincfg.Params
 	chainService *neutrino.ChainService
 	rescanMgr    *RescanManager
+	store        *Store
+	patterns     *PatternMatcher
+	feeEstimator FeeEstimator
+	feeFallback  FeeEstimator
+	torProxies   *torProxyPool
+	webhooks     *WebhookDispatcher
+	bans         *banList
+	tracker      *confirmationTracker
+	spends       *spendSubscriptions
+	broadcasts   *broadcastQueue
+	recentBlocks *recentBlocks
+	feeFilters   *peerFeeFilters
+	peerScores   *peerScores
+	diversity    *diversity
+	stalls       *stallWatchdog
+	checkpoints  *checkpointVerifier
+	restart      chan struct{}
+	restartOnce  sync.Once
+	backupMu     sync.Mutex
+	backupJobs   []*BackupJob
+	memoryDir    string
+	xpubs        *xpubWatcher
+	scanMemo     *scanMemo
+	scans        *sharedScans
+	flights      *scanFlights
+	metrics      *counters
 	logger       btclog.Logger
 	db           walletdb.DB
 
+	// lifetime is canceled by Stop, ending the scans the node runs on its
+	// own behalf and its background loops, which Stop waits for through wg.
+	lifetime context.Context
+	stop     context.CancelFunc
+	wg       sync.WaitGroup
+
 	mu           sync.RWMutex
 	synced       bool
 	blockHeight  int32
 	filterHeight int32
+	startedAt    int64
 }
 
 // UTXO represents an unspent transaction output.
@@ -65,14 +226,10 @@ type UTXO struct {
 	Address      string `json:"address"`
 	ScriptPubKey string `json:"scriptpubkey"`
 	Height       int32  `json:"height"`
-}
 
-// Transaction represents a blockchain transaction.
-type Transaction struct {
-	TxID        string `json:"txid"`
-	Hex         string `json:"hex"`
-	BlockHeight int32  `json:"block_height,omitempty"`
-	BlockTime   int64  `json:"block_time,omitempty"`
+	// Timelock is set for outputs paying to a registered script with
+	// CLTV/CSV locks. It is computed per request and never persisted.
+	Timelock *Timelock `json:"timelock,omitempty"`
 }
 
 // Status represents the current node status.
@@ -81,6 +238,12 @@ type Status struct {
 	BlockHeight  int32 `json:"block_height"`
 	FilterHeight int32 `json:"filter_height"`
 	Peers        int   `json:"peers"`
+
+	// LastReorg is the most recent reorg seen since the node started.
+	LastReorg *Reorg `json:"last_reorg,omitempty"`
+
+	// SyncStall is set while sync is stalled.
+	SyncStall *SyncStall `json:"sync_stall,omitempty"`
 }
 
 // NewNode creates a new neutrino node.
@@ -93,6 +256,110 @@ func NewNode(config *Config) (*Node, error) {
 	if err != nil {
 		return nil, fmt.Errorf("invalid network %s: %w", config.Network, err)
 	}
+	chainParams, err = withCheckpoints(chainParams, config.Checkpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.ScanMode {
+	case "":
+		config.ScanMode = ScanLenient
+	case ScanLenient, ScanStrict:
+	default:
+		return nil, fmt.Errorf("invalid scan mode %q: use lenient or strict", config.ScanMode)
+	}
+
+	switch config.DBBackend {
+	case "":
+		config.DBBackend = DBBackendBolt
+	case DBBackendBolt, DBBackendSQLite, DBBackendMemory:
+	default:
+		return nil, fmt.Errorf("invalid database backend %q: use bdb, sqlite or memory", config.DBBackend)
+	}
+	switch config.SQLiteJournalMode {
+	case "":
+		config.SQLiteJournalMode = SQLiteJournalWAL
+	case SQLiteJournalWAL, SQLiteJournalDelete:
+	default:
+		return nil, fmt.Errorf("invalid SQLite journal mode %q: use wal or delete", config.SQLiteJournalMode)
+	}
+
+	if config.WalletRetention < 0 {
+		return nil, fmt.Errorf("invalid wallet retention %s: must not be negative", config.WalletRetention)
+	}
+
+	if config.SpentRetention < 0 {
+		return nil, fmt.Errorf("invalid spent retention %d: must not be negative", config.SpentRetention)
+	}
+
+	if config.MaxPeers < 0 {
+		return nil, fmt.Errorf("invalid max peers %d: must not be negative", config.MaxPeers)
+	}
+
+	if config.MaxPeersPerGroup < 0 {
+		return nil, fmt.Errorf("invalid max peers per group %d: must not be negative", config.MaxPeersPerGroup)
+	}
+
+	if config.StallTimeout < 0 {
+		return nil, fmt.Errorf("invalid stall timeout %s: must not be negative", config.StallTimeout)
+	}
+	if err := checkStallRecovery(config.StallRecovery); err != nil {
+		return nil, err
+	}
+
+	if config.BanDuration < 0 {
+		return nil, fmt.Errorf("invalid ban duration %s: must not be negative", config.BanDuration)
+	}
+
+	if config.FilterCacheSize < 0 {
+		return nil, fmt.Errorf("invalid filter cache size %d: must not be negative", config.FilterCacheSize)
+	}
+
+	if config.BlockMemoryCacheSize < 0 {
+		return nil, fmt.Errorf("invalid block memory cache size %d: must not be negative", config.BlockMemoryCacheSize)
+	}
+
+	if config.MaxRescanJobs < 0 {
+		return nil, fmt.Errorf("invalid max rescan jobs %d: must not be negative", config.MaxRescanJobs)
+	}
+
+	if config.BlockCacheMaxBytes < 0 {
+		return nil, fmt.Errorf("invalid block cache size %d: must not be negative", config.BlockCacheMaxBytes)
+	}
+
+	if config.TorProxy != "" {
+		if _, err := newTorProxyPool(config.TorProxy, config.TorIsolation, btclog.Disabled); err != nil {
+			return nil, err
+		}
+	} else if config.TorIsolation {
+		return nil, errors.New("Tor circuit isolation needs a Tor proxy: set --torproxy")
+	}
+
+	if config.WebhooksFile != "" {
+		if _, err := LoadWebhookFile(config.WebhooksFile); err != nil {
+			return nil, err
+		}
+	}
+
+	peerConfig, err := loadPeerConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOnlyNet(config, peerConfig); err != nil {
+		return nil, err
+	}
+
+	var asns *asnMap
+	if config.ASNFile != "" {
+		if asns, err = loadASNFile(config.ASNFile); err != nil {
+			return nil, err
+		}
+	}
+
+	// Catch fee estimator misconfiguration before starting the chain service
+	if _, _, err := newFeeEstimator(config.Fees, nil, nil, nil); err != nil {
+		return nil, err
+	}
 
 	logger := config.Logger.Logger("NTRN")
 	// Use the configured log level
@@ -109,11 +376,44 @@ func NewNode(config *Config) (*Node, error) {
 	if config.ConnectPeers != "" {
 		logger.Infof("Connect peers: %s", config.ConnectPeers)
 	}
+	if config.OnlyNet != "" {
+		logger.Infof("Only connecting to %s peers", config.OnlyNet)
+	}
 
+	lifetime, stop := context.WithCancel(context.Background())
 	node := &Node{
-		config:      config,
-		chainParams: chainParams,
-		logger:      logger,
+		lifetime:     lifetime,
+		stop:         stop,
+		config:       config,
+		peerConfig:   peerConfig,
+		chainParams:  chainParams,
+		patterns:     NewPatternMatcher(),
+		recentBlocks: newRecentBlocks(),
+		feeFilters:   newPeerFeeFilters(),
+		peerScores:   newPeerScores(),
+		stalls:       &stallWatchdog{timeout: config.stallTimeout()},
+		restart:      make(chan struct{}),
+		scanMemo:     newScanMemo(config.ScanMemoTTL),
+		metrics:      &counters{},
+		logger:       logger,
+	}
+
+	node.flights = newScanFlights(node.metrics)
+	if config.ScanCache != nil {
+		node.scans = &sharedScans{cache: config.ScanCache, metrics: node.metrics, logger: logger}
+	}
+
+	if len(config.Checkpoints) > 0 {
+		node.checkpoints = newCheckpointVerifier(config.Checkpoints)
+		logger.Infof("Checkpoints: %d configured, up to height %d", len(config.Checkpoints), logging.KV("height", node.checkpoints.checkpoints[len(config.Checkpoints)-1].Height))
+	}
+
+	// Onion and clearnet peers are mixed when both can be reached and the
+	// node discovers its peers
+	mix := config.TorProxy != "" && config.OnlyNet == "" && config.ConnectPeers == ""
+	node.diversity = newDiversity(config.maxPeersPerGroup(), asns, mix)
+	for _, peer := range append(splitPeers(config.ConnectPeers), peerConfig.Peers...) {
+		node.diversity.addManual(peer)
 	}
 
 	return node, nil
@@ -124,14 +424,73 @@ func (n *Node) Start() error {
 	n.logger.Info("Starting neutrino node...")
 
 	// Open the database for neutrino
-	dbPath := filepath.Join(n.config.DataDir, "neutrino.db")
+	if n.config.DBBackend == DBBackendMemory {
+		if err := n.useMemoryDataDir(); err != nil {
+			return err
+		}
+	}
+	if err := n.prepareDatabase(); err != nil {
+		return err
+	}
+	dbPath := filepath.Join(n.config.DataDir, dbFiles[n.config.DBBackend])
+	if _, err := os.Stat(dbPath); err == nil && n.config.CompactDBOnStart {
+		n.logger.Infof("Compacting database at: %s", dbPath)
+		compaction, err := CompactDatabase(n.config.DataDir)
+		if err != nil {
+			return err
+		}
+		n.logger.Infof("Compacted database from %d to %d bytes", compaction.SizeBefore, compaction.SizeAfter)
+	}
 	n.logger.Infof("Opening database at: %s", dbPath)
-	db, err := walletdb.Create("bdb", dbPath, true, 60*time.Second)
+	db, err := openDB(n.config.DBBackend, dbPath, true, n.config.SQLiteJournalMode, 60*time.Second)
 	if err != nil {
 		return fmt.Errorf("failed to create database at %s: %w", dbPath, err)
 	}
 	n.db = db
 
+	var repair *HeaderRepair
+	if n.config.CheckHeadersOnStart {
+		repair, err = n.repairHeaders()
+		if err != nil {
+			n.db.Close()
+			return err
+		}
+	}
+
+	// The store is opened before the chain service, which is not to
+	// connect to peers banned in it
+	store, err := NewStore(n.db)
+	if err != nil {
+		n.db.Close()
+		return err
+	}
+	n.store = store
+	if repair != nil {
+		if err := n.rollbackRepairedHeaders(repair); err != nil {
+			n.db.Close()
+			return err
+		}
+	}
+	bans, err := newBanList(store)
+	if err != nil {
+		n.db.Close()
+		return fmt.Errorf("failed to load bans: %w", err)
+	}
+	n.bans = bans
+	if count := len(bans.list()); count > 0 {
+		n.logger.Infof("Loaded %d peer bans", count)
+	}
+	if n.config.IndexDB != "" {
+		if err := n.openAddressIndex(); err != nil {
+			n.db.Close()
+			return err
+		}
+	} else if err := store.putIndexSyncToken(""); err != nil {
+		// An index used again later misses the changes of this run
+		n.db.Close()
+		return err
+	}
+
 	// Configure logging for the neutrino library itself
 	logLevel := n.config.LogLevel
 	if logLevel == "" {
@@ -144,12 +503,32 @@ func (n *Node) Start() error {
 	neutrinoLogger.SetLevel(level)
 	neutrino.UseLogger(neutrinoLogger)
 
+	// Peer limits are package settings of neutrino, read when the chain
+	// service is created. Outbound connections are its only ones, so the
+	// target is the maximum.
+	maxPeers := n.config.MaxPeers
+	if maxPeers == 0 {
+		maxPeers = DefaultMaxPeers
+	}
+	neutrino.MaxPeers = maxPeers
+	neutrino.TargetOutbound = maxPeers
+	neutrino.BanDuration = n.config.BanDuration
+	if neutrino.BanDuration == 0 {
+		neutrino.BanDuration = DefaultBanDuration
+	}
+	n.logger.Infof("Max peers: %d, ban duration: %s", maxPeers, neutrino.BanDuration)
+
 	// Create neutrino config
 	neutrinoConfig := neutrino.Config{
 		DataDir:         n.config.DataDir,
 		Database:        db,
 		ChainParams:     *n.chainParams,
 		FilterCacheSize: uint64(n.config.FilterCacheSize),
+		BlockCacheSize:  uint64(n.config.BlockMemoryCacheSize),
+
+		// Stored filter headers contradicting the highest filter
+		// checkpoint are discarded and synced anew
+		AssertFilterHeader: filterHeaderAssertion(n.config.Checkpoints),
 	}
 
 	// Add peers if specified
@@ -158,33 +537,47 @@ func (n *Node) Start() error {
 		for _, peer := range peers {
 			peer = strings.TrimSpace(peer)
 			if peer != "" {
-				n.logger.Infof("Adding connect peer: %s", peer)
+				n.logger.Infof("Adding connect peer: %s", logging.KV("peer", peer))
 				neutrinoConfig.ConnectPeers = append(neutrinoConfig.ConnectPeers, peer)
 			}
 		}
 		n.logger.Infof("Total connect peers configured: %d", len(neutrinoConfig.ConnectPeers))
 	}
 
-	// Add DNS seeds if no connect peers specified
-	if len(neutrinoConfig.ConnectPeers) == 0 {
-		seeds := getDNSSeeds(n.config.Network)
+	// Add DNS seeds if no connect peers specified. Onion-only nodes skip
+	// them, as they only list clearnet peers
+	onionOnly := n.config.OnlyNet == NetOnion
+	noSeeds := onionOnly || n.peerConfig.NoDNSSeeds
+	neutrino.DisableDNSSeed = noSeeds
+	if len(n.peerConfig.DNSSeeds) > 0 {
+		neutrinoConfig.ChainParams.DNSSeeds = n.peerConfig.chainDNSSeeds()
+	}
+	if len(neutrinoConfig.ConnectPeers) == 0 && !noSeeds {
+		seeds := n.peerConfig.dnsSeeds(n.config.Network)
 		neutrinoConfig.AddPeers = seeds
 		n.logger.Infof("No connect peers specified, using %d DNS seeds", len(seeds))
+	} else if n.peerConfig.NoDNSSeeds {
+		n.logger.Info("DNS seeding disabled")
+	}
+	for _, peer := range n.peerConfig.Peers {
+		n.logger.Infof("Adding peer: %s", logging.KV("peer", peer))
+		neutrinoConfig.AddPeers = append(neutrinoConfig.AddPeers, peer)
 	}
 
-	// Configure Tor proxy if specified
+	// Configure Tor proxies if specified
 	if n.config.TorProxy != "" {
-		n.logger.Infof("Configuring Tor SOCKS5 proxy: %s", n.config.TorProxy)
+		n.logger.Infof("Configuring Tor SOCKS5 proxies: %s", RedactTorProxy(n.config.TorProxy))
 
-		// Create a SOCKS5 dialer
-		torDialer, err := proxy.SOCKS5("tcp", n.config.TorProxy, nil, proxy.Direct)
+		// Connections fail over between proxies, so one Tor daemon
+		// restarting doesn't drop connectivity
+		torProxies, err := newTorProxyPool(n.config.TorProxy, n.config.TorIsolation, n.logger)
 		if err != nil {
 			n.db.Close()
-			return fmt.Errorf("failed to create Tor SOCKS5 dialer: %w", err)
+			return err
 		}
+		n.torProxies = torProxies
 
 		// Set up DNS resolution through Tor to prevent DNS leaks
-		// Use btcd's connmgr.TorLookupIP for actual DNS resolution via Tor
 		neutrinoConfig.NameResolver = func(host string) ([]net.IP, error) {
 			// If already an IP, return it directly
 			if ip := net.ParseIP(host); ip != nil {
@@ -197,10 +590,13 @@ func (n *Node) Start() error {
 			if strings.HasSuffix(host, ".onion") {
 				return []net.IP{net.IP([]byte(host))}, nil
 			}
+			if onionOnly {
+				return nil, fmt.Errorf("not resolving %s: %w", host, errClearnetRefused)
+			}
 
 			// For regular DNS names, resolve through Tor
 			// This performs actual DNS resolution via Tor's SOCKS proxy
-			ips, err := connmgr.TorLookupIP(host, n.config.TorProxy)
+			ips, err := torProxies.LookupIP(host)
 			if err != nil {
 				n.logger.Warnf("Tor DNS lookup failed for %s: %v", host, err)
 				return nil, err
@@ -219,14 +615,35 @@ func (n *Node) Start() error {
 				hostname := string(tcpAddr.IP)
 				targetAddr = net.JoinHostPort(hostname, fmt.Sprintf("%d", tcpAddr.Port))
 			}
+			if onionOnly && !isOnionHost(targetAddr) {
+				n.logger.Debugf("Refusing clearnet peer %s", logging.KV("peer", targetAddr))
+				return nil, fmt.Errorf("not connecting to %s: %w", targetAddr, errClearnetRefused)
+			}
 
 			// Dial through Tor - it will handle .onion addresses
-			// For regular IPs, they've already been resolved via TorLookupIP
-			return torDialer.Dial("tcp", targetAddr)
+			// For regular IPs, they've already been resolved via Tor
+			return torProxies.Dial("tcp", targetAddr)
+		}
+
+		n.logger.Infof("Tor configured with %d proxies (DNS resolution via Tor)", len(torProxies.proxies))
+	}
+
+	// Refuse banned peers however they are reached
+	dial := neutrinoConfig.Dialer
+	if dial == nil {
+		dial = func(addr net.Addr) (net.Conn, error) {
+			return net.Dial(addr.Network(), addr.String())
 		}
+	}
+	neutrinoConfig.Dialer = n.bans.dialer(n.diversity.dialer(dial, n.connectedPeers))
 
-		n.logger.Info("Tor proxy configured successfully (DNS resolution via Tor)")
+	// Peers configured by host name are exempt from the diversity limits
+	// at the addresses they resolve to
+	resolve := neutrinoConfig.NameResolver
+	if resolve == nil {
+		resolve = net.LookupIP
 	}
+	neutrinoConfig.NameResolver = n.diversity.resolver(resolve)
 
 	n.logger.Infof("Creating chain service for network: %s", n.chainParams.Name)
 
@@ -240,6 +657,34 @@ func (n *Node) Start() error {
 	n.chainService = chainService
 	n.logger.Info("Chain service created successfully")
 
+	// Headers synced before the checkpoints were configured may contradict
+	// them, and are refused rather than served
+	if n.checkpoints != nil {
+		blockHeight, filterHeight, err := n.scanTip()
+		if err != nil {
+			n.db.Close()
+			return err
+		}
+		n.verifyCheckpoints(blockHeight, filterHeight)
+		if err := n.checkpoints.err(); err != nil {
+			n.db.Close()
+			return fmt.Errorf("header chains in %s contradict the checkpoints, remove them to sync anew: %w", n.config.DataDir, err)
+		}
+	}
+
+	feeEstimator, feeFallback, err := newFeeEstimator(n.config.Fees, chainService, n.chainParams, n.torProxies)
+	if err != nil {
+		n.db.Close()
+		return err
+	}
+	n.feeEstimator = feeEstimator
+	n.feeFallback = feeFallback
+	if feeFallback != nil {
+		n.logger.Infof("Using %s fee estimator, falling back to %s", feeEstimator.Name(), feeFallback.Name())
+	} else {
+		n.logger.Infof("Using %s fee estimator", feeEstimator.Name())
+	}
+
 	// Start the chain service
 	n.logger.Info("Starting chain service...")
 	if err := n.chainService.Start(); err != nil {
@@ -248,25 +693,151 @@ func (n *Node) Start() error {
 	}
 	n.logger.Info("Chain service started successfully")
 
-	// Create rescan manager
-	n.rescanMgr = NewRescanManager(n.chainService, n.logger)
+	// Create rescan manager backed by the persistent store
+	n.rescanMgr = NewRescanManager(n.chainService, store, n.scanOptions(), n.logger)
+	if err := n.rescanMgr.Restore(); err != nil {
+		n.chainService.Stop()
+		n.db.Close()
+		return fmt.Errorf("failed to restore rescan state: %w", err)
+	}
+	n.rescanMgr.AddBlockObserver(n.patterns.ObserveBlock)
+
+	n.webhooks = NewWebhookDispatcher(store, n.logger)
+	if err := n.webhooks.Restore(); err != nil {
+		n.chainService.Stop()
+		n.db.Close()
+		return err
+	}
+	if err := n.ReloadWebhooks(n.config.WebhooksFile); err != nil {
+		n.chainService.Stop()
+		n.db.Close()
+		return err
+	}
+	n.rescanMgr.AddEventObserver(n.webhooks.ObserveEvent)
+
+	if err := n.restoreTrackedTxs(); err != nil {
+		n.chainService.Stop()
+		n.db.Close()
+		return err
+	}
+	if err := n.restoreSpendSubscriptions(); err != nil {
+		n.chainService.Stop()
+		n.db.Close()
+		return err
+	}
+	if err := n.restoreBroadcasts(); err != nil {
+		n.chainService.Stop()
+		n.db.Close()
+		return err
+	}
+	n.rescanMgr.AddBlockObserver(n.ObserveDoubleSpends)
+	if err := n.restoreXpubs(); err != nil {
+		n.chainService.Stop()
+		n.db.Close()
+		return err
+	}
+	n.rescanMgr.AddEventObserver(n.ObserveXpubUsage)
+
+	n.rescanMgr.retainBlocks = n.config.Retention.Enabled
+	n.rescanMgr.walletRetention = n.config.WalletRetention
+	n.rescanMgr.metrics = n.metrics
+	n.rescanMgr.memo = n.scanMemo
+	n.rescanMgr.flights = n.flights
+	n.rescanMgr.scans = n.scans
+	n.rescanMgr.jobSlots = make(chan struct{}, cmp.Or(n.config.MaxRescanJobs, DefaultMaxRescanJobs))
+	n.rescanMgr.blocks = &scoredBlockSource{cs: n.chainService, scores: n.peerScores, metrics: n.metrics, logger: n.logger}
+
+	// Report a crash of the previous process before resuming its jobs
+	n.recoverState()
+
+	// Jobs scheduled for a watch file run with the resumed ones below
+	if n.config.WatchFile != "" {
+		if err := n.importWatchFile(); err != nil {
+			n.chainService.Stop()
+			n.db.Close()
+			return err
+		}
+	}
 
 	// Start sync monitoring goroutine
-	go n.monitorSync()
+	n.wg.Go(n.monitorSync)
+	n.wg.Go(n.trackConfirmations)
+	n.wg.Go(n.watchSpends)
+	n.wg.Go(n.watchBroadcasts)
+	n.wg.Go(n.watchPeers)
+	n.wg.Go(n.evictSlowPeers)
+	n.wg.Go(n.enforceDiversity)
+	n.wg.Go(n.watchSyncStalls)
+	if n.torProxies != nil {
+		n.wg.Go(func() { n.torProxies.monitor(n.lifetime) })
+	}
+
+	if n.config.WalletRetention > 0 {
+		n.wg.Go(n.purgeExpiredWallets)
+	}
+	if n.config.Retention.Enabled {
+		n.wg.Go(n.pruneRetainedBlocks)
+	}
+	if n.config.SpentRetention > 0 {
+		n.wg.Go(n.pruneSpentUTXOs)
+	}
+	n.wg.Go(n.pruneBans)
+	n.wg.Go(n.extendXpubs)
+	if n.store.index != nil {
+		n.wg.Go(func() { n.store.index.run(n.lifetime) })
+	}
+
+	// Resume rescans interrupted by a previous shutdown once we are synced
+	n.wg.Go(n.resumeRescans)
 
 	n.logger.Info("Neutrino node started")
 	return nil
 }
 
+// scanOptions returns the scan tuning derived from the node config.
+func (n *Node) scanOptions() ScanOptions {
+	return ScanOptions{
+		Workers:         n.config.ScanWorkers,
+		FilterBatchSize: n.config.FilterBatchSize,
+		Mode:            n.config.ScanMode,
+	}
+}
+
 // Stop gracefully stops the neutrino node.
 func (n *Node) Stop() error {
 	n.logger.Info("Stopping neutrino node...")
 
+	if n.store != nil {
+		n.saveCleanShutdown()
+	}
+
+	// Scans are interrupted before the chain service stops, so they do
+	// not record the blocks it no longer serves as skipped
+	n.stop()
+	if n.rescanMgr != nil {
+		n.rescanMgr.Stop()
+	}
+
 	if n.chainService != nil {
 		if err := n.chainService.Stop(); err != nil {
 			return fmt.Errorf("failed to stop chain service: %w", err)
 		}
 	}
+	if n.rescanMgr != nil {
+		n.rescanMgr.Wait()
+	}
+	n.wg.Wait()
+	if n.webhooks != nil {
+		n.webhooks.Stop()
+	}
+
+	// The index is closed first, as it records in the store whether it
+	// holds a copy of it
+	if n.store != nil && n.store.index != nil {
+		if err := n.store.index.close(); err != nil {
+			return fmt.Errorf("failed to close the address index: %w", err)
+		}
+	}
 
 	if n.db != nil {
 		if err := n.db.Close(); err != nil {
@@ -274,6 +845,12 @@ func (n *Node) Stop() error {
 		}
 	}
 
+	if n.memoryDir != "" {
+		if err := os.RemoveAll(n.memoryDir); err != nil {
+			return fmt.Errorf("failed to remove the memory data directory: %w", err)
+		}
+	}
+
 	n.logger.Info("Neutrino node stopped")
 	return nil
 }
@@ -288,11 +865,18 @@ func (n *Node) GetStatus() Status {
 		peers = len(n.chainService.Peers())
 	}
 
+	var lastReorg *Reorg
+	if n.recentBlocks != nil {
+		lastReorg = n.recentBlocks.lastReorg()
+	}
+
 	return Status{
 		Synced:       n.synced,
 		BlockHeight:  n.blockHeight,
 		FilterHeight: n.filterHeight,
 		Peers:        peers,
+		LastReorg:    lastReorg,
+		SyncStall:    n.stalls.current(),
 	}
 }
 
@@ -331,14 +915,13 @@ func (n *Node) GetBlockHash(height int32) (*chainhash.Hash, error) {
 	return n.chainService.GetBlockHash(int64(height))
 }
 
-// BroadcastTransaction broadcasts a transaction to the network.
-func (n *Node) BroadcastTransaction(tx *wire.MsgTx) error {
-	if n.chainService == nil {
-		return errors.New("chain service not initialized")
+// UTXOConfidence describes how complete the scans behind GetUTXOs are for
+// addresses.
+func (n *Node) UTXOConfidence(addresses []string) *Confidence {
+	if n.rescanMgr == nil {
+		return &Confidence{Level: ConfidenceCached}
 	}
-
-	// Use the pushtx package to broadcast
-	return n.chainService.SendTransaction(tx)
+	return n.rescanMgr.UTXOConfidence(addresses)
 }
 
 // GetUTXOs scans for UTXOs belonging to the given addresses.
@@ -350,22 +933,94 @@ func (n *Node) GetUTXOs(addresses []string) ([]UTXO, error) {
 	return n.rescanMgr.GetUTXOs(addresses)
 }
 
-// WatchAddress adds an address to the watch list.
-func (n *Node) WatchAddress(address string) error {
+// WatchAddress adds an address to the watch list of wallet. An empty wallet
+// adds a new address to DefaultWallet.
+func (n *Node) WatchAddress(address, wallet string) error {
+	if n.rescanMgr == nil {
+		return errors.New("rescan manager not initialized")
+	}
+
+	return n.rescanMgr.WatchAddressInWallet(address, wallet)
+}
+
+// WatchScriptPubKey watches the outputs paying scriptPubKey, a hex script, as
+// part of wallet. It returns the watch entry: the script's address, or the
+// script hex if it has no address form, such as bare multisig.
+func (n *Node) WatchScriptPubKey(scriptPubKey, wallet string) (string, error) {
+	if n.rescanMgr == nil {
+		return "", errors.New("rescan manager not initialized")
+	}
+
+	script, err := hex.DecodeString(scriptPubKey)
+	if err != nil || len(script) == 0 || len(script) > txscript.MaxScriptSize {
+		return "", NewBadRequestError(fmt.Sprintf("script_pubkey must be between 1 and %d hex-encoded bytes", txscript.MaxScriptSize))
+	}
+	entry, _, err := parseWatchEntry(hex.EncodeToString(script), n.chainParams)
+	if err != nil {
+		return "", NewBadRequestError(err.Error())
+	}
+	if err := n.rescanMgr.WatchAddressInWallet(entry, wallet); err != nil {
+		return "", err
+	}
+	return entry, nil
+}
+
+// WatchedAddresses returns the watch list.
+func (n *Node) WatchedAddresses() ([]WatchedAddress, error) {
+	if n.rescanMgr == nil {
+		return nil, errors.New("rescan manager not initialized")
+	}
+
+	return n.rescanMgr.WatchedAddresses()
+}
+
+// UnwatchAddress stops watching an address and deletes its UTXOs.
+func (n *Node) UnwatchAddress(address string) error {
+	if n.rescanMgr == nil {
+		return errors.New("rescan manager not initialized")
+	}
+
+	return n.rescanMgr.UnwatchAddress(address)
+}
+
+// UnwatchAddressInWallet removes an address from wallet, and stops
+// watching it once no wallet contains it.
+func (n *Node) UnwatchAddressInWallet(address, wallet string) error {
+	if n.rescanMgr == nil {
+		return errors.New("rescan manager not initialized")
+	}
+
+	return n.rescanMgr.UnwatchAddressInWallet(address, cmp.Or(wallet, DefaultWallet))
+}
+
+// Events returns up to limit events from wallet's event stream after the
+// given sequence number.
+func (n *Node) Events(wallet string, after uint64, limit int) ([]Event, error) {
+	if n.rescanMgr == nil {
+		return nil, errors.New("rescan manager not initialized")
+	}
+
+	return n.rescanMgr.Events(wallet, after, limit)
+}
+
+// Rescan runs a rescan from the given height, until it completes or ctx is
+// canceled.
+func (n *Node) Rescan(ctx context.Context, startHeight int32, addresses []string) error {
 	if n.rescanMgr == nil {
 		return errors.New("rescan manager not initialized")
 	}
 
-	return n.rescanMgr.WatchAddress(address)
+	return n.rescanMgr.Rescan(ctx, startHeight, addresses)
 }
 
-// Rescan triggers a rescan from the given height.
-func (n *Node) Rescan(startHeight int32, addresses []string) error {
+// StartRescan starts a rescan from the given height in the background,
+// failing with a BusyError while MaxRescanJobs are running.
+func (n *Node) StartRescan(startHeight int32, addresses []string) error {
 	if n.rescanMgr == nil {
 		return errors.New("rescan manager not initialized")
 	}
 
-	return n.rescanMgr.Rescan(startHeight, addresses)
+	return n.rescanMgr.StartRescan(startHeight, addresses)
 }
 
 // IsRescanInProgress returns true if a rescan is currently running.
@@ -376,6 +1031,50 @@ func (n *Node) IsRescanInProgress() bool {
 	return n.rescanMgr.IsRescanInProgress()
 }
 
+// RescanStatus returns the progress and throughput of running rescan jobs
+// and the most recently finished one.
+func (n *Node) RescanStatus() RescanStatus {
+	if n.rescanMgr == nil {
+		return RescanStatus{Jobs: []RescanJobStatus{}}
+	}
+	return n.rescanMgr.RescanStatus()
+}
+
+// RegisterScript registers a hex-encoded redeem/witness script so that UTXOs
+// paying to it report their time locks.
+func (n *Node) RegisterScript(scriptHex string) (*ScriptRegistration, error) {
+	if n.rescanMgr == nil {
+		return nil, errors.New("rescan manager not initialized")
+	}
+
+	script, err := hex.DecodeString(scriptHex)
+	if err != nil {
+		return nil, NewBadRequestError(fmt.Sprintf("invalid script hex: %v", err))
+	}
+
+	return n.rescanMgr.RegisterScript(script)
+}
+
+// AddScriptPattern registers an experimental script pattern.
+func (n *Node) AddScriptPattern(pattern ScriptPattern) (ScriptPattern, error) {
+	return n.patterns.Add(pattern)
+}
+
+// ScriptPatterns returns all registered script patterns.
+func (n *Node) ScriptPatterns() []ScriptPattern {
+	return n.patterns.Patterns()
+}
+
+// ScriptPatternMatches returns the retained matches for a script pattern.
+func (n *Node) ScriptPatternMatches(id uint64) ([]PatternMatch, error) {
+	return n.patterns.Matches(id)
+}
+
+// RemoveScriptPattern unregisters a script pattern.
+func (n *Node) RemoveScriptPattern(id uint64) error {
+	return n.patterns.Remove(id)
+}
+
 // UTXOSpendReport represents information about a UTXO.
 type UTXOSpendReport struct {
 	// If the output is unspent, these fields are populated
@@ -388,11 +1087,15 @@ type UTXOSpendReport struct {
 	SpendingTxID   string `json:"spending_txid,omitempty"`
 	SpendingInput  uint32 `json:"spending_input,omitempty"`
 	SpendingHeight uint32 `json:"spending_height,omitempty"`
+
+	// Confidence describes how complete the scan behind the report was.
+	Confidence *Confidence `json:"confidence,omitempty"`
 }
 
 // GetUTXO checks if a UTXO exists and whether it has been spent.
-// It scans from startHeight forward to the chain tip, looking for the UTXO creation
-// and any subsequent spend.
+// Scanning forward, it locates the block creating the UTXO from startHeight on
+// and hands the search for its spend to neutrino's UTXO scanner. Scanning
+// backward, it walks down from the chain tip to the creation.
 //
 // IMPORTANT: address is REQUIRED because neutrino uses compact block filters (BIP158)
 // which match on scriptPubKeys, not outpoints. Without the address/script, we cannot
@@ -400,150 +1103,214 @@ type UTXOSpendReport struct {
 //
 // startHeight should be set to the block height where the UTXO was created (or slightly before).
 // This is critical for performance - scanning from genesis is very slow.
-func (n *Node) GetUTXO(txid string, vout uint32, address string, startHeight int32) (*UTXOSpendReport, error) {
+func (n *Node) GetUTXO(ctx context.Context, txid string, vout uint32, address string, startHeight int32, direction ScanDirection) (report *UTXOSpendReport, err error) {
+	ctx, span := tracer.Start(ctx, "GetUTXO", trace.WithAttributes(
+		attribute.String("neutrino.txid", txid),
+		attribute.Int64("neutrino.vout", int64(vout)),
+		attribute.String("neutrino.direction", string(direction)),
+	))
+	defer func() { endSpan(span, err) }()
+
 	if n.chainService == nil {
 		return nil, errors.New("chain service not initialized")
 	}
 
-	if address == "" {
-		return nil, NewBadRequestError("address is required: neutrino uses compact block filters which match on scripts, not outpoints")
+	if direction == "" {
+		direction = ScanForward
 	}
-
-	// Parse the address to get the pkScript
-	addr, err := btcutil.DecodeAddress(address, n.chainParams)
-	if err != nil {
-		return nil, NewBadRequestError(fmt.Sprintf("invalid address %s: %v", address, err))
+	if direction != ScanForward && direction != ScanBackward {
+		return nil, NewBadRequestError(fmt.Sprintf("invalid direction %q: use forward or backward", direction))
 	}
 
-	pkScript, err := txscript.PayToAddrScript(addr)
+	lookup, err := n.newOutpointLookup(ctx, txid, vout, address, startHeight)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create script for address %s: %w", address, err)
+		return nil, err
 	}
 
-	// Parse txid
-	targetHash, err := chainhash.NewHashFromStr(txid)
+	lookup.logger.Infof("Looking up UTXO %s:%d for address %s from height %d (%s)", txid, vout, logging.KV("address", address), logging.KV("height", startHeight), direction)
+
+	// Scan up to the filter tip, as blocks above it cannot be checked
+	blockHeight, filterHeight, err := n.scanTip()
 	if err != nil {
-		return nil, NewBadRequestError(fmt.Sprintf("invalid txid: %v", err))
+		return nil, err
 	}
-
-	n.logger.Infof("Looking up UTXO %s:%d for address %s starting from height %d", txid, vout, address, startHeight)
-
-	// Get current best block
-	bestBlock, err := n.chainService.BestBlock()
+	endHeight, err := scanEnd(startHeight, 0, blockHeight, filterHeight)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get best block: %w", err)
+		return nil, err
 	}
 
-	endHeight := bestBlock.Height
-	n.logger.Debugf("Scanning from height %d to %d", startHeight, endHeight)
+	if report := lookup.cachedReport(); report != nil {
+		lookup.logger.Infof("UTXO %s:%d spent at height %d (from height hint)", txid, vout, logging.KV("height", lookup.hint.SpendingHeight))
+		span.SetAttributes(attribute.Bool("neutrino.cached", true))
+		return report, nil
+	}
+	startHeight = lookup.startHeight
+	span.SetAttributes(attrStartHeight.Int(int(startHeight)), attrEndHeight.Int(int(endHeight)))
 
-	// Scan blocks to find the transaction and any spend
-	var foundTx *wire.MsgTx
-	var foundHeight int32
-	var spendingTxHash string
-	var spendingInputIdx uint32
-	var spendingHeight int32
+	lookup.logger.Debugf("Scanning from height %d to %d", logging.KV("height", startHeight), endHeight)
 
-	for height := startHeight; height <= endHeight; height++ {
-		// Get block hash
-		blockHash, err := n.chainService.GetBlockHash(int64(height))
-		if err != nil {
-			n.logger.Debugf("Failed to get block hash for height %d: %v", height, err)
-			continue
+	// Filters and matched blocks are fetched concurrently, but blocks are
+	// applied in height order
+	prefetch := newFilterPrefetcher(ctx, n.chainService, startHeight, endHeight, n.config.FilterBatchSize, n.logger)
+	if direction == ScanBackward {
+		prefetch = newReverseFilterPrefetcher(ctx, n.chainService, startHeight, endHeight, n.config.FilterBatchSize, n.logger)
+	}
+	prefetch.flights = n.flights
+	prefetch.fill = n.metrics.filterFill(n.chainService)
+	// Blocks that cannot be checked are recorded so the result can be
+	// labelled partial, or rejected in strict mode
+	var skips skipTracker
+	scripts := [][]byte{lookup.pkScript}
+	plan := n.scans.newPlan(n.chainService, scripts, startHeight, endHeight)
+	fetch := func(height int32) *btcutil.Block {
+		prefetch.wait(height)
+		if segment := plan.segment(ctx, height); segment != nil {
+			return n.fetchPlannedBlock(ctx, plan, segment, height, nil, &skips)
 		}
+		return n.fetchMatchingBlock(ctx, height, scripts, &skips)
+	}
 
-		// Get compact block filter
-		filter, err := n.chainService.GetCFilter(*blockHash, wire.GCSFilterRegular)
-		if err != nil {
-			n.logger.Debugf("Failed to get filter for block %d: %v", height, err)
-			continue
-		}
+	if direction == ScanBackward {
+		// Scanning down from the tip, the first spend found is the only
+		// one, and reaching the creation block without a spend means it
+		// is unspent. A spend can be below any height not yet reached, so
+		// a backward scan cut short resumes from its start.
+		low := endHeight + 1
+		applyBackward := func(height int32, block *btcutil.Block) error {
+			low = height
+			if block == nil {
+				return nil
+			}
 
-		if filter == nil {
-			continue
-		}
+			n.notifyBlock(height, block)
+			n.observeOutpoint(lookup, height, block, direction)
 
-		// Check if the filter matches our pkScript
-		key := builder.DeriveKey(blockHash)
-		matched, err := filter.Match(key, pkScript)
-		if err != nil {
-			n.logger.Debugf("Filter match error for block %d: %v", height, err)
-			continue
+			if lookup.hint.Spent() || (lookup.hint.Created && lookup.hint.CreationHeight == height) {
+				return errStopScan
+			}
+			return nil
 		}
-
-		if !matched {
-			continue
+		if err := scanRangeBackward(ctx, startHeight, endHeight, n.config.ScanWorkers, fetch, applyBackward); err != nil {
+			return nil, deadlineError(err, startHeight)
 		}
+		plan.store(ctx, low, endHeight, skips.ranges(low, endHeight))
+		return n.finishLookup(lookup, &skips, endHeight)
+	}
 
-		n.logger.Debugf("Block %d filter matched, fetching full block", height)
+	if !lookup.hint.Created {
+		next := startHeight
+		applyCreation := func(height int32, block *btcutil.Block) error {
+			next = height + 1
+			if block == nil {
+				return nil
+			}
 
-		// Filter matched - fetch the full block
-		block, err := n.chainService.GetBlock(*blockHash)
-		if err != nil {
-			n.logger.Warnf("Failed to get block %d: %v", height, err)
-			continue
+			n.notifyBlock(height, block)
+			n.observeOutpoint(lookup, height, block, direction)
+
+			if lookup.hint.Created {
+				return errStopScan
+			}
+			return nil
+		}
+		if err := scanRange(ctx, startHeight, endHeight, n.config.ScanWorkers, fetch, applyCreation); err != nil {
+			return nil, deadlineError(err, next)
+		}
+		plan.store(ctx, startHeight, next-1, skips.ranges(startHeight, next-1))
+		if !lookup.hint.Created {
+			return n.finishLookup(lookup, &skips, endHeight)
 		}
+	}
 
-		// Scan all transactions in the block
-		for _, tx := range block.Transactions() {
-			txHash := tx.Hash()
+	// The UTXO scanner fails rather than skipping blocks, so a report it
+	// returns covers every block after the creation
+	if err := n.findUTXOSpend(ctx, lookup, endHeight); err != nil {
+		// The creation is kept, so the lookup resumes with the spend
+		// search whichever start height it is repeated with
+		n.saveLookupProgress(lookup, &skipTracker{}, lookup.hint.CreationHeight+1)
+		return nil, deadlineError(err, lookup.hint.CreationHeight)
+	}
+	return n.finishLookup(lookup, &skipTracker{}, endHeight)
+}
 
-			// Check if this is the transaction we're looking for
-			if foundTx == nil && txHash.IsEqual(targetHash) {
-				// Found the transaction creating the UTXO
-				if int(vout) < len(tx.MsgTx().TxOut) {
-					foundTx = tx.MsgTx()
-					foundHeight = height
-					n.logger.Infof("Found UTXO creation at height %d", height)
-				}
-			}
+// findUTXOSpend searches the blocks after the creation of the looked-up
+// outpoint through endHeight for its spend with neutrino's UTXO scanner.
+// The scanner looks for the output in its start block and reports an output
+// it does not find there as unfound. The scan starts after the creation, so
+// an unspent outpoint is reported unfound, and only a report of a spend or
+// of no spend at all ends the search.
+func (n *Node) findUTXOSpend(ctx context.Context, l *outpointLookup, endHeight int32) (err error) {
+	from := max(l.startHeight, l.hint.CreationHeight+1)
+	if from > endHeight {
+		// Created in the tip block, so nothing can spend it yet
+		return nil
+	}
 
-			// Check if this transaction spends our UTXO
-			if foundTx != nil {
-				for inputIdx, txIn := range tx.MsgTx().TxIn {
-					prevOut := txIn.PreviousOutPoint
-					if prevOut.Hash.IsEqual(targetHash) && prevOut.Index == vout {
-						// Found the spending transaction
-						spendingTxHash = txHash.String()
-						spendingInputIdx = uint32(inputIdx)
-						spendingHeight = height
-						n.logger.Infof("Found UTXO spend at height %d in tx %s", height, spendingTxHash)
-						break
-					}
-				}
-			}
-		}
+	_, span := tracer.Start(ctx, "spend.scan", trace.WithAttributes(
+		attrStartHeight.Int(int(from)),
+		attrEndHeight.Int(int(endHeight)),
+	))
+	defer func() { endSpan(span, err) }()
 
-		// If we found both creation and spend, we can stop
-		if foundTx != nil && spendingTxHash != "" {
-			break
-		}
+	start, err := n.chainService.BlockHeaders.FetchHeaderByHeight(uint32(from))
+	if err != nil {
+		return fmt.Errorf("failed to get block header for height %d: %w", from, err)
+	}
+	report, err := n.chainService.GetUtxo(
+		neutrino.WatchInputs(neutrino.InputWithScript{
+			OutPoint: wire.OutPoint{Hash: *l.txid, Index: l.vout},
+			PkScript: l.pkScript,
+		}),
+		neutrino.StartBlock(&headerfs.BlockStamp{Height: from, Hash: start.BlockHash(), Timestamp: start.Timestamp}),
+		neutrino.QuitChan(ctx.Done()),
+	)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to scan for spends of %s:%d: %w", l.txid, l.vout, err)
 	}
 
-	// Build response
-	if foundTx == nil {
-		return nil, NewNotFoundError("UTXO", "UTXO not found: ensure start_height is at or before the block containing the transaction")
+	switch {
+	case report == nil:
+		// Unfound in the start block and not spent after it
+		return nil
+	case report.SpendingTx != nil:
+		l.hint.recordSpend(report.SpendingTx.TxHash().String(), report.SpendingInputIndex, int32(report.SpendingTxHeight))
+		l.logger.Infof("Found UTXO spend at height %d in tx %s", logging.KV("height", report.SpendingTxHeight), logging.KV("txid", l.hint.SpendingTxID))
+		return nil
+	case report.Output != nil:
+		// Found unspent in the start block, which can only be the
+		// creation's if a transaction ID was reused
+		if int32(report.BlockHeight) != l.hint.CreationHeight {
+			return fmt.Errorf("spend scan found %s:%d created at height %d, not %d", l.txid, l.vout, report.BlockHeight, l.hint.CreationHeight)
+		}
+		return nil
+	default:
+		return fmt.Errorf("spend scan of %s:%d reported neither a spend nor the output", l.txid, l.vout)
 	}
+}
 
-	report := &UTXOSpendReport{}
+// resumeRescans waits for the chain service to become current and then
+// resumes any rescan jobs left unfinished by a previous run.
+func (n *Node) resumeRescans() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
 
-	if spendingTxHash == "" {
-		// UTXO is unspent
-		report.Unspent = true
-		txOut := foundTx.TxOut[vout]
-		report.Value = txOut.Value
-		report.ScriptPubKey = fmt.Sprintf("%x", txOut.PkScript)
-		report.BlockHeight = uint32(foundHeight)
-	} else {
-		// UTXO has been spent
-		report.Unspent = false
-		report.SpendingTxID = spendingTxHash
-		report.SpendingInput = spendingInputIdx
-		report.SpendingHeight = uint32(spendingHeight)
+	for !n.chainService.IsCurrent() {
+		select {
+		case <-n.lifetime.Done():
+			return
+		case <-ticker.C:
+		}
 	}
 
-	n.logger.Infof("UTXO %s:%d found at height %d, unspent=%v", txid, vout, foundHeight, report.Unspent)
-	return report, nil
+	if err := n.rescanMgr.StartLive(); err != nil && !errors.Is(err, context.Canceled) {
+		n.logger.Errorf("Failed to follow the chain tip: %v", err)
+	}
+	if err := n.rescanMgr.ResumeJobs(n.lifetime); err != nil && !errors.Is(err, context.Canceled) {
+		n.logger.Errorf("Failed to resume rescan jobs: %v", err)
+	}
 }
 
 // monitorSync monitors the sync status and updates internal state.
@@ -553,8 +1320,14 @@ func (n *Node) monitorSync() {
 
 	lastPeerCount := -1
 	lastHeight := int32(-1)
+	lastFilterHeight := int32(-1)
 
-	for range ticker.C {
+	for {
+		select {
+		case <-n.lifetime.Done():
+			return
+		case <-ticker.C:
+		}
 		if n.chainService == nil {
 			continue
 		}
@@ -570,7 +1343,7 @@ func (n *Node) monitorSync() {
 			} else {
 				n.logger.Infof("Peer count changed: %d -> %d", lastPeerCount, peerCount)
 				for i, peer := range peers {
-					n.logger.Debugf("  Peer %d: %s", i, peer.Addr())
+					n.logger.Debugf("  Peer %d: %s", i, logging.KV("peer", peer.Addr()))
 				}
 			}
 			lastPeerCount = peerCount
@@ -582,10 +1355,18 @@ func (n *Node) monitorSync() {
 			n.logger.Warnf("Failed to get best block: %v", err)
 			continue
 		}
+		_, filterHeight, err := n.chainService.RegFilterHeaders.ChainTip()
+		if err != nil {
+			n.logger.Warnf("Failed to get filter header tip: %v", err)
+			continue
+		}
+
+		n.verifyCheckpoints(bestBlock.Height, int32(filterHeight))
 
 		// Log height changes
+		prevHeight := lastHeight
 		if bestBlock.Height != lastHeight {
-			n.logger.Infof("Block height: %d (was %d)", bestBlock.Height, lastHeight)
+			n.logger.Infof("Block height: %d (was %d)", logging.KV("height", bestBlock.Height), lastHeight)
 			lastHeight = bestBlock.Height
 		}
 
@@ -593,18 +1374,42 @@ func (n *Node) monitorSync() {
 		// The neutrino library tracks filter sync internally
 		isCurrent := n.chainService.IsCurrent()
 
+		// Blocks replacing a reorged chain are announced from the fork
+		newFrom := prevHeight + 1
+		if reorg := n.detectReorg(bestBlock.Height, bestBlock.Hash); reorg != nil {
+			newFrom = min(newFrom, reorg.ForkHeight+1)
+		}
+
+		// Blocks connected during the initial sync are not announced
+		if isCurrent && prevHeight >= 0 && bestBlock.Height >= newFrom {
+			n.notifyNewBlocks(newFrom, bestBlock.Height)
+		}
+		if isCurrent && bestBlock.Height >= newFrom {
+			n.refreshFeeEstimates()
+		}
+		if bestBlock.Height >= newFrom {
+			n.wakeSpendWatcher()
+			n.rescanMgr.PruneBlockUndo(bestBlock.Height - reorgWindow)
+		}
+
+		// The address index answers balance queries up to the filter tip
+		if int32(filterHeight) != lastFilterHeight {
+			n.store.index.recordTip(int32(filterHeight))
+			lastFilterHeight = int32(filterHeight)
+		}
+
 		n.mu.Lock()
 		wasSynced := n.synced
 		n.blockHeight = bestBlock.Height
-		n.filterHeight = bestBlock.Height // Assume filters are synced when blocks are synced
+		n.filterHeight = int32(filterHeight)
 		n.synced = isCurrent
 		n.mu.Unlock()
 
 		// Log sync status changes
 		if isCurrent && !wasSynced {
-			n.logger.Infof("Sync complete! Block height: %d, Peers: %d", bestBlock.Height, peerCount)
+			n.logger.Infof("Sync complete! Block height: %d, Peers: %d", logging.KV("height", bestBlock.Height), peerCount)
 		} else if !isCurrent {
-			n.logger.Debugf("Syncing... blocks: %d, peers: %d, isCurrent: %v", bestBlock.Height, peerCount, isCurrent)
+			n.logger.Debugf("Syncing... blocks: %d, filters: %d, peers: %d, isCurrent: %v", bestBlock.Height, filterHeight, peerCount, isCurrent)
 		}
 	}
 }
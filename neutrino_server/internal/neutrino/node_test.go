@@ -98,6 +98,94 @@ func TestNewNode(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid config with several Tor proxies",
+			config: &Config{
+				Network:         "mainnet",
+				DataDir:         "/tmp/test",
+				TorProxy:        "127.0.0.1:9050,127.0.0.1:9150",
+				MaxPeers:        8,
+				BanDuration:     24 * time.Hour,
+				FilterCacheSize: 4096,
+				Logger:          backend,
+				LogLevel:        "info",
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative max peers",
+			config: &Config{
+				Network:  "mainnet",
+				DataDir:  "/tmp/test",
+				MaxPeers: -1,
+				Logger:   backend,
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative ban duration",
+			config: &Config{
+				Network:     "mainnet",
+				DataDir:     "/tmp/test",
+				BanDuration: -time.Hour,
+				Logger:      backend,
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative filter cache size",
+			config: &Config{
+				Network:         "mainnet",
+				DataDir:         "/tmp/test",
+				FilterCacheSize: -1,
+				Logger:          backend,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid database backend",
+			config: &Config{
+				Network:   "mainnet",
+				DataDir:   "/tmp/test",
+				DBBackend: "leveldb",
+				Logger:    backend,
+			},
+			wantErr: true,
+		},
+		{
+			name: "memory database",
+			config: &Config{
+				Network:   "regtest",
+				DataDir:   "/tmp/test",
+				DBBackend: DBBackendMemory,
+				Logger:    backend,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Tor isolation without a proxy",
+			config: &Config{
+				Network:      "mainnet",
+				DataDir:      "/tmp/test",
+				TorIsolation: true,
+				Logger:       backend,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid Tor proxy",
+			config: &Config{
+				Network:         "mainnet",
+				DataDir:         "/tmp/test",
+				TorProxy:        "127.0.0.1:9050,localhost",
+				MaxPeers:        8,
+				BanDuration:     24 * time.Hour,
+				FilterCacheSize: 4096,
+				Logger:          backend,
+				LogLevel:        "info",
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
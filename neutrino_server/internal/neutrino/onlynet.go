@@ -0,0 +1,68 @@
+package neutrino
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// NetOnion restricts peer connections to onion addresses, see
+// Config.OnlyNet.
+const NetOnion = "onion"
+
+// splitPeers splits a comma-separated list of peer addresses.
+func splitPeers(list string) []string {
+	var peers []string
+	for _, peer := range strings.Split(list, ",") {
+		if peer = strings.TrimSpace(peer); peer != "" {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+// isOnionHost reports whether host, with or without a port, is an onion
+// address.
+func isOnionHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.HasSuffix(strings.ToLower(host), ".onion")
+}
+
+// checkOnlyNet checks that config, bootstrapping from the static peers and
+// DNS seeds of pc, can run restricted to config.OnlyNet. Onion-only nodes
+// skip the DNS seeds, which only list clearnet peers, so they need at least
+// one onion peer to connect to or learn further addresses from, and every
+// configured peer must be an onion address.
+func checkOnlyNet(config *Config, pc *PeerConfig) error {
+	switch config.OnlyNet {
+	case "":
+		return nil
+	case NetOnion:
+	default:
+		return fmt.Errorf("invalid onlynet %q: use %s", config.OnlyNet, NetOnion)
+	}
+
+	if config.TorProxy == "" {
+		return errors.New("onlynet=onion needs a Tor proxy: set --torproxy")
+	}
+	if len(pc.DNSSeeds) > 0 {
+		return errors.New("onlynet=onion does not use DNS seeds, which list clearnet peers")
+	}
+	peers := append(splitPeers(config.ConnectPeers), pc.Peers...)
+	if len(peers) == 0 {
+		return errors.New("onlynet=onion needs an onion peer to bootstrap from: set --connect, --addpeer or a peers file")
+	}
+	for _, peer := range peers {
+		if !isOnionHost(peer) {
+			return fmt.Errorf("peer %s is not an onion address, which onlynet=onion refuses", peer)
+		}
+	}
+	return nil
+}
+
+// errClearnetRefused is returned for connections to clearnet peers by
+// onion-only nodes.
+var errClearnetRefused = errors.New("clearnet peers are refused by onlynet=onion")
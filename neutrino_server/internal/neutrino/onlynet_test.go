@@ -0,0 +1,57 @@
+package neutrino
+
+import "testing"
+
+func TestCheckOnlyNet(t *testing.T) {
+	const onion = "vww6ybal4bd7szmgncyruucpgfkqahzddi37ktceo3ah7ngmcopnpyyd.onion:8333"
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"unrestricted", Config{ConnectPeers: "1.2.3.4:8333"}, false},
+		{"onion connect peer", Config{OnlyNet: NetOnion, TorProxy: "127.0.0.1:9050", ConnectPeers: onion}, false},
+		{"onion added peers", Config{OnlyNet: NetOnion, TorProxy: "127.0.0.1:9050", AddPeers: " " + onion + ",EXAMPLE.ONION"}, false},
+		{"unknown network", Config{OnlyNet: "ipv6", TorProxy: "127.0.0.1:9050", ConnectPeers: onion}, true},
+		{"no Tor proxy", Config{OnlyNet: NetOnion, ConnectPeers: onion}, true},
+		{"no peers", Config{OnlyNet: NetOnion, TorProxy: "127.0.0.1:9050"}, true},
+		{"clearnet connect peer", Config{OnlyNet: NetOnion, TorProxy: "127.0.0.1:9050", ConnectPeers: onion + ",1.2.3.4:8333"}, true},
+		{"DNS seeds", Config{OnlyNet: NetOnion, TorProxy: "127.0.0.1:9050", ConnectPeers: onion, DNSSeeds: "seed.example.com"}, true},
+		{"clearnet added peer", Config{OnlyNet: NetOnion, TorProxy: "127.0.0.1:9050", AddPeers: "node.example.com"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc, err := loadPeerConfig(&tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := checkOnlyNet(&tt.config, pc); (err != nil) != tt.wantErr {
+				t.Errorf("checkOnlyNet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsOnionHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"example.onion", true},
+		{"example.onion:8333", true},
+		{"Example.Onion:8333", true},
+		{"onion.example.com:8333", false},
+		{"1.2.3.4:8333", false},
+		{"[::1]:8333", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := isOnionHost(tt.host); got != tt.want {
+				t.Errorf("isOnionHost(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
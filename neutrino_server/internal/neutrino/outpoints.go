@@ -0,0 +1,129 @@
+package neutrino
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+const (
+	// DefaultSpentRetention is how many blocks deep spent watched UTXOs
+	// are kept for outpoint lookups by default, about a year of blocks.
+	DefaultSpentRetention = 52560
+
+	// spentPruneInterval is how often spent UTXOs past the retention
+	// depth are pruned.
+	spentPruneInterval = time.Hour
+)
+
+// Spend identifies the input that spent an outpoint. The fields are empty
+// when the spend was recorded without details.
+type Spend struct {
+	SpendingTxID   string `json:"spending_txid,omitempty"`
+	SpendingInput  uint32 `json:"spending_input,omitempty"`
+	SpendingHeight int32  `json:"spending_height,omitempty"`
+}
+
+// OutpointStatus is what the server's persisted scan data knows about an
+// outpoint paying a watched or looked-up script.
+type OutpointStatus struct {
+	UTXO
+	Spent bool `json:"spent"`
+	Spend
+}
+
+// GetOutpoint answers from persisted data only: UTXOs found by rescans of
+// watched addresses and the height hints left by GetUTXO lookups. It never
+// scans, and returns a NotFoundError if the outpoint has not been seen.
+func (n *Node) GetOutpoint(txid string, vout uint32) (*OutpointStatus, error) {
+	if n.store == nil {
+		return nil, errors.New("store not initialized")
+	}
+
+	hash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		return nil, NewBadRequestError(fmt.Sprintf("invalid txid: %v", err))
+	}
+	key := fmt.Sprintf("%s:%d", hash, vout)
+
+	status, found, err := n.store.Outpoint(key)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return &status, nil
+	}
+
+	hints, err := n.store.HeightHintsFor(key)
+	if err != nil {
+		return nil, err
+	}
+	// Prefer a hint that saw the creation; a backward lookup may have seen
+	// only the spend
+	for _, hint := range hints {
+		if hint.Created {
+			return n.outpointFromHint(hash.String(), vout, &hint), nil
+		}
+	}
+	for _, hint := range hints {
+		if hint.Spent() {
+			return n.outpointFromHint(hash.String(), vout, &hint), nil
+		}
+	}
+
+	return nil, NewNotFoundError("outpoint", fmt.Sprintf("outpoint %s has not been seen for any watched script", key))
+}
+
+// pruneSpentUTXOs periodically deletes the spent watched UTXOs spent more
+// than the configured number of blocks below the chain tip.
+func (n *Node) pruneSpentUTXOs() {
+	ticker := time.NewTicker(spentPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if best, err := n.chainService.BestBlock(); err != nil {
+			n.logger.Warnf("Failed to get the best block to prune spent UTXOs: %v", err)
+		} else if pruned, err := n.store.PruneSpentUTXOs(best.Height - n.config.SpentRetention); err != nil {
+			n.logger.Warnf("Failed to prune spent UTXOs: %v", err)
+		} else if pruned > 0 {
+			n.logger.Infof("Pruned %d spent UTXOs spent more than %d blocks deep", pruned, n.config.SpentRetention)
+		}
+		select {
+		case <-n.lifetime.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// outpointFromHint converts a height hint to an outpoint status.
+func (n *Node) outpointFromHint(txid string, vout uint32, hint *HeightHint) *OutpointStatus {
+	status := &OutpointStatus{
+		UTXO: UTXO{
+			TxID:         txid,
+			Vout:         vout,
+			Value:        hint.Value,
+			ScriptPubKey: hint.ScriptPubKey,
+			Height:       hint.CreationHeight,
+		},
+		Spent: hint.Spent(),
+		Spend: Spend{
+			SpendingTxID:   hint.SpendingTxID,
+			SpendingInput:  hint.SpendingInput,
+			SpendingHeight: hint.SpendingHeight,
+		},
+	}
+
+	if pkScript, err := hex.DecodeString(hint.ScriptPubKey); err == nil {
+		_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, n.chainParams)
+		if err == nil && len(addrs) == 1 {
+			status.Address = addrs[0].EncodeAddress()
+		}
+	}
+
+	return status
+}
@@ -0,0 +1,265 @@
+package neutrino
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// maxPatternMatches is the number of most recent matches retained per pattern.
+const maxPatternMatches = 1000
+
+// ScriptPattern is an experimental output predicate. Patterns are evaluated
+// only against blocks that scans have already downloaded for watched scripts,
+// so they never cause additional block downloads. Every set field must match.
+type ScriptPattern struct {
+	ID uint64 `json:"id"`
+
+	// ScriptType matches the standard script class, using txscript names
+	// such as "witness_v0_keyhash", "witness_v1_taproot" or "multisig".
+	ScriptType string `json:"script_type,omitempty"`
+
+	// MinValue matches outputs worth at least this many satoshis.
+	MinValue int64 `json:"min_value,omitempty"`
+
+	// Template matches the scriptPubKey hex, where "??" matches any single
+	// byte and a trailing "*" matches any remaining bytes.
+	Template string `json:"template,omitempty"`
+
+	// Matches is the number of outputs matched so far.
+	Matches int `json:"matches"`
+}
+
+// PatternMatch is an output that satisfied a script pattern.
+type PatternMatch struct {
+	TxID         string `json:"txid"`
+	Vout         uint32 `json:"vout"`
+	Value        int64  `json:"value"`
+	ScriptPubKey string `json:"scriptpubkey"`
+	Height       int32  `json:"height"`
+}
+
+// compiledPattern is a registered pattern with its template pre-parsed.
+type compiledPattern struct {
+	pattern  ScriptPattern
+	class    txscript.ScriptClass
+	template []byte
+	wildcard []bool
+	open     bool // template ends with "*"
+	matches  []PatternMatch
+
+	// seen holds the outpoints of the retained matches, so outputs of a
+	// block observed again by another scan are not counted twice. Outpoints
+	// leave it with their match, keeping it as small as matches.
+	seen map[string]bool
+}
+
+// PatternMatcher evaluates registered script patterns against blocks.
+type PatternMatcher struct {
+	mu       sync.RWMutex
+	nextID   uint64
+	patterns map[uint64]*compiledPattern
+}
+
+// NewPatternMatcher creates an empty pattern matcher.
+func NewPatternMatcher() *PatternMatcher {
+	return &PatternMatcher{
+		nextID:   1,
+		patterns: make(map[uint64]*compiledPattern),
+	}
+}
+
+// Add validates and registers a pattern, returning it with its assigned ID.
+func (m *PatternMatcher) Add(pattern ScriptPattern) (ScriptPattern, error) {
+	compiled, err := compilePattern(pattern)
+	if err != nil {
+		return ScriptPattern{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	compiled.pattern.ID = m.nextID
+	compiled.pattern.Matches = 0
+	m.nextID++
+	m.patterns[compiled.pattern.ID] = compiled
+
+	return compiled.pattern, nil
+}
+
+// Remove unregisters a pattern.
+func (m *PatternMatcher) Remove(id uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.patterns[id]; !ok {
+		return NewNotFoundError("pattern", fmt.Sprintf("pattern %d not found", id))
+	}
+	delete(m.patterns, id)
+	return nil
+}
+
+// Patterns returns all registered patterns ordered by ID.
+func (m *PatternMatcher) Patterns() []ScriptPattern {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	patterns := make([]ScriptPattern, 0, len(m.patterns))
+	for _, compiled := range m.patterns {
+		patterns = append(patterns, compiled.pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool { return patterns[i].ID < patterns[j].ID })
+	return patterns
+}
+
+// Matches returns the retained matches for a pattern, oldest first.
+func (m *PatternMatcher) Matches(id uint64) ([]PatternMatch, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	compiled, ok := m.patterns[id]
+	if !ok {
+		return nil, NewNotFoundError("pattern", fmt.Sprintf("pattern %d not found", id))
+	}
+
+	matches := make([]PatternMatch, len(compiled.matches))
+	copy(matches, compiled.matches)
+	return matches, nil
+}
+
+// ObserveBlock evaluates every registered pattern against the outputs of a
+// block that has already been fetched.
+func (m *PatternMatcher) ObserveBlock(height int32, block *btcutil.Block) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.patterns) == 0 {
+		return
+	}
+
+	for _, tx := range block.Transactions() {
+		txHash := tx.Hash().String()
+		for vout, txOut := range tx.MsgTx().TxOut {
+			class := txscript.GetScriptClass(txOut.PkScript)
+
+			for _, compiled := range m.patterns {
+				if !compiled.match(class, txOut.Value, txOut.PkScript) {
+					continue
+				}
+
+				key := fmt.Sprintf("%s:%d", txHash, vout)
+				if compiled.seen[key] {
+					continue
+				}
+				compiled.seen[key] = true
+				compiled.pattern.Matches++
+				compiled.matches = append(compiled.matches, PatternMatch{
+					TxID:         txHash,
+					Vout:         uint32(vout),
+					Value:        txOut.Value,
+					ScriptPubKey: hex.EncodeToString(txOut.PkScript),
+					Height:       height,
+				})
+				if len(compiled.matches) > maxPatternMatches {
+					dropped := compiled.matches[0]
+					delete(compiled.seen, fmt.Sprintf("%s:%d", dropped.TxID, dropped.Vout))
+					compiled.matches = compiled.matches[1:]
+				}
+			}
+		}
+	}
+}
+
+// match reports whether an output satisfies the pattern.
+func (c *compiledPattern) match(class txscript.ScriptClass, value int64, pkScript []byte) bool {
+	if c.pattern.ScriptType != "" && class != c.class {
+		return false
+	}
+
+	if value < c.pattern.MinValue {
+		return false
+	}
+
+	if c.template == nil {
+		return true
+	}
+
+	if len(pkScript) < len(c.template) || (!c.open && len(pkScript) != len(c.template)) {
+		return false
+	}
+	for i, b := range c.template {
+		if !c.wildcard[i] && pkScript[i] != b {
+			return false
+		}
+	}
+	return true
+}
+
+// compilePattern validates a pattern and parses its template.
+func compilePattern(pattern ScriptPattern) (*compiledPattern, error) {
+	compiled := &compiledPattern{
+		pattern: pattern,
+		class:   txscript.NonStandardTy,
+		seen:    make(map[string]bool),
+	}
+
+	if pattern.ScriptType == "" && pattern.MinValue == 0 && pattern.Template == "" {
+		return nil, NewBadRequestError("pattern must set at least one of script_type, min_value or template")
+	}
+
+	if pattern.MinValue < 0 {
+		return nil, NewBadRequestError("min_value must not be negative")
+	}
+
+	if pattern.ScriptType != "" {
+		class, ok := scriptClassByName(pattern.ScriptType)
+		if !ok {
+			return nil, NewBadRequestError(fmt.Sprintf("unknown script_type %q", pattern.ScriptType))
+		}
+		compiled.class = class
+	}
+
+	if pattern.Template != "" {
+		template := strings.ToLower(pattern.Template)
+		compiled.pattern.Template = template
+		if strings.HasSuffix(template, "*") {
+			compiled.open = true
+			template = strings.TrimSuffix(template, "*")
+		}
+		if len(template)%2 != 0 {
+			return nil, NewBadRequestError("template must contain whole bytes")
+		}
+
+		compiled.template = make([]byte, len(template)/2)
+		compiled.wildcard = make([]bool, len(template)/2)
+		for i := 0; i < len(template); i += 2 {
+			pair := template[i : i+2]
+			if pair == "??" {
+				compiled.wildcard[i/2] = true
+				continue
+			}
+			b, err := hex.DecodeString(pair)
+			if err != nil {
+				return nil, NewBadRequestError(fmt.Sprintf("invalid template byte %q", pair))
+			}
+			compiled.template[i/2] = b[0]
+		}
+	}
+
+	return compiled, nil
+}
+
+// scriptClassByName maps a txscript class name to its ScriptClass.
+func scriptClassByName(name string) (txscript.ScriptClass, bool) {
+	for class := txscript.NonStandardTy; class <= txscript.WitnessUnknownTy; class++ {
+		if class.String() == name {
+			return class, true
+		}
+	}
+	return txscript.NonStandardTy, false
+}
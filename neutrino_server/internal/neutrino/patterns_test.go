@@ -0,0 +1,161 @@
+package neutrino
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// patternTestBlock returns a block with one transaction paying each script.
+func patternTestBlock(t *testing.T, outputs map[string]int64) *btcutil.Block {
+	t.Helper()
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	for scriptHex, value := range outputs {
+		script, err := hex.DecodeString(scriptHex)
+		if err != nil {
+			t.Fatalf("invalid script %s: %v", scriptHex, err)
+		}
+		tx.AddTxOut(wire.NewTxOut(value, script))
+	}
+	return btcutil.NewBlock(&wire.MsgBlock{Transactions: []*wire.MsgTx{tx}})
+}
+
+const (
+	testP2WPKH = "0014751e76e8199196d454941c45d1b3a323f1433bd6"
+	testP2PKH  = "76a914751e76e8199196d454941c45d1b3a323f1433bd688ac"
+)
+
+func TestPatternMatcherObserveBlock(t *testing.T) {
+	tests := []struct {
+		name      string
+		pattern   ScriptPattern
+		wantMatch int
+	}{
+		{"script type", ScriptPattern{ScriptType: "witness_v0_keyhash"}, 2},
+		{"script type and min value", ScriptPattern{ScriptType: "witness_v0_keyhash", MinValue: 5000}, 1},
+		{"min value only", ScriptPattern{MinValue: 2000}, 2},
+		{"exact template", ScriptPattern{Template: testP2PKH}, 1},
+		{"wildcard template", ScriptPattern{Template: "0014??1e76e8199196d454941c45d1b3a323f1433bd6"}, 2},
+		{"prefix template", ScriptPattern{Template: "76a914*"}, 1},
+		{"template length mismatch", ScriptPattern{Template: "0014"}, 0},
+	}
+
+	block := patternTestBlock(t, map[string]int64{
+		testP2WPKH: 1000,
+		testP2PKH:  3000,
+	})
+	other := patternTestBlock(t, map[string]int64{
+		testP2WPKH: 9000,
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matcher := NewPatternMatcher()
+			pattern, err := matcher.Add(tt.pattern)
+			if err != nil {
+				t.Fatalf("Add() failed: %v", err)
+			}
+
+			matcher.ObserveBlock(100, block)
+			matcher.ObserveBlock(101, other)
+			// The same block observed again by another scan is not double counted
+			matcher.ObserveBlock(100, block)
+
+			matches, err := matcher.Matches(pattern.ID)
+			if err != nil {
+				t.Fatalf("Matches() failed: %v", err)
+			}
+
+			if len(matches) != tt.wantMatch {
+				t.Errorf("expected %d matches, got %d: %+v", tt.wantMatch, len(matches), matches)
+			}
+
+			if got := matcher.Patterns()[0].Matches; got != tt.wantMatch {
+				t.Errorf("expected match count %d, got %d", tt.wantMatch, got)
+			}
+		})
+	}
+}
+
+func TestPatternMatcherSeenPruned(t *testing.T) {
+	matcher := NewPatternMatcher()
+	pattern, err := matcher.Add(ScriptPattern{MinValue: 1})
+	if err != nil {
+		t.Fatalf("Add() failed: %v", err)
+	}
+
+	// Each block pays a distinct value, so each transaction is new
+	for i := range maxPatternMatches + 10 {
+		matcher.ObserveBlock(int32(i), patternTestBlock(t, map[string]int64{testP2WPKH: int64(i + 1)}))
+	}
+
+	compiled := matcher.patterns[pattern.ID]
+	if len(compiled.matches) != maxPatternMatches || len(compiled.seen) != maxPatternMatches {
+		t.Errorf("retained %d matches and %d seen outpoints, want %d of each", len(compiled.matches), len(compiled.seen), maxPatternMatches)
+	}
+	if got := matcher.Patterns()[0].Matches; got != maxPatternMatches+10 {
+		t.Errorf("match count = %d, want %d", got, maxPatternMatches+10)
+	}
+}
+
+func TestPatternMatcherAddInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern ScriptPattern
+	}{
+		{"empty", ScriptPattern{}},
+		{"negative min value", ScriptPattern{MinValue: -1}},
+		{"unknown script type", ScriptPattern{ScriptType: "p2wpkh"}},
+		{"odd template", ScriptPattern{Template: "001"}},
+		{"bad template byte", ScriptPattern{Template: "00zz"}},
+	}
+
+	matcher := NewPatternMatcher()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := matcher.Add(tt.pattern)
+			var badRequestErr *BadRequestError
+			if !errors.As(err, &badRequestErr) {
+				t.Errorf("expected BadRequestError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPatternMatcherRemove(t *testing.T) {
+	matcher := NewPatternMatcher()
+
+	pattern, err := matcher.Add(ScriptPattern{MinValue: 1})
+	if err != nil {
+		t.Fatalf("Add() failed: %v", err)
+	}
+
+	if err := matcher.Remove(pattern.ID); err != nil {
+		t.Fatalf("Remove() failed: %v", err)
+	}
+
+	var notFoundErr *NotFoundError
+	if err := matcher.Remove(pattern.ID); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected NotFoundError removing twice, got %v", err)
+	}
+
+	if _, err := matcher.Matches(pattern.ID); !errors.As(err, &notFoundErr) {
+		t.Errorf("expected NotFoundError for removed pattern, got %v", err)
+	}
+}
+
+func TestPatternMatcherAddNormalizesTemplate(t *testing.T) {
+	matcher := NewPatternMatcher()
+
+	pattern, err := matcher.Add(ScriptPattern{Template: "0014??1E76E8*"})
+	if err != nil {
+		t.Fatalf("Add() failed: %v", err)
+	}
+	if pattern.Template != "0014??1e76e8*" {
+		t.Errorf("Template = %q, want lowercase hex", pattern.Template)
+	}
+}
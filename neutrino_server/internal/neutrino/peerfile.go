@@ -0,0 +1,221 @@
+package neutrino
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// noDNSSeeds in place of a DNS seed disables DNS seeding.
+const noDNSSeeds = "none"
+
+// PeerConfig are the peers and DNS seeds the node bootstraps from, merged
+// from Config.AddPeers, Config.DNSSeeds and the peers file.
+type PeerConfig struct {
+	// Peers are static peers, connected to on startup and reconnected
+	// when they drop.
+	Peers []string
+
+	// DNSSeeds replace the network's built-in DNS seeds when set.
+	DNSSeeds []string
+
+	// NoDNSSeeds disables DNS seeding, leaving the static peers and the
+	// addresses they announce as the only peers.
+	NoDNSSeeds bool
+}
+
+// LoadPeerFile reads the peers file at path. Every line that is not blank
+// or a '#' comment is a key=value setting:
+//
+//	peer=node.example.com:8333   static peer, the port defaults to the network's
+//	dnsseed=seed.example.com     DNS seed replacing the built-in ones
+//	dnsseed=none                 disable DNS seeding
+//
+// Settings may be repeated.
+func LoadPeerFile(path string) (*PeerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read peers file: %w", err)
+	}
+
+	pc := &PeerConfig{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("peers file %s line %d: expected peer=<address> or dnsseed=<host>", path, line)
+		}
+		switch key {
+		case "peer":
+			pc.Peers = append(pc.Peers, value)
+		case "dnsseed":
+			pc.addDNSSeed(value)
+		default:
+			return nil, fmt.Errorf("peers file %s line %d: unknown setting %q", path, line, key)
+		}
+	}
+	if err := pc.validate(); err != nil {
+		return nil, fmt.Errorf("peers file %s: %w", path, err)
+	}
+	return pc, nil
+}
+
+// addDNSSeed adds a DNS seed, or disables DNS seeding for noDNSSeeds.
+func (pc *PeerConfig) addDNSSeed(seed string) {
+	if strings.EqualFold(seed, noDNSSeeds) {
+		pc.NoDNSSeeds = true
+		return
+	}
+	pc.DNSSeeds = append(pc.DNSSeeds, seed)
+}
+
+// validate checks the peer addresses and DNS seed host names, and that DNS
+// seeds are not both replaced and disabled.
+func (pc *PeerConfig) validate() error {
+	for _, peer := range pc.Peers {
+		host := peer
+		if h, _, err := net.SplitHostPort(peer); err == nil {
+			host = h
+		} else if strings.Contains(peer, ":") && net.ParseIP(peer) == nil {
+			return fmt.Errorf("invalid peer %q: %w", peer, err)
+		}
+		if host == "" {
+			return fmt.Errorf("invalid peer %q: missing host", peer)
+		}
+	}
+	for _, seed := range pc.DNSSeeds {
+		if seed == "" || strings.ContainsAny(seed, ":/ ") {
+			return fmt.Errorf("invalid DNS seed %q: expected a host name", seed)
+		}
+	}
+	if pc.NoDNSSeeds && len(pc.DNSSeeds) > 0 {
+		return errors.New("DNS seeds are both listed and disabled")
+	}
+	return nil
+}
+
+// loadPeerConfig merges the static peers and DNS seeds of config with those
+// of its peers file, dropping duplicates.
+func loadPeerConfig(config *Config) (*PeerConfig, error) {
+	pc := &PeerConfig{Peers: splitPeers(config.AddPeers)}
+	for _, seed := range splitPeers(config.DNSSeeds) {
+		pc.addDNSSeed(seed)
+	}
+	if err := pc.validate(); err != nil {
+		return nil, err
+	}
+
+	if config.PeersFile != "" {
+		file, err := LoadPeerFile(config.PeersFile)
+		if err != nil {
+			return nil, err
+		}
+		pc.Peers = append(pc.Peers, file.Peers...)
+		pc.DNSSeeds = append(pc.DNSSeeds, file.DNSSeeds...)
+		pc.NoDNSSeeds = pc.NoDNSSeeds || file.NoDNSSeeds
+		if err := pc.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	pc.Peers = dedupe(pc.Peers)
+	pc.DNSSeeds = dedupe(pc.DNSSeeds)
+	return pc, nil
+}
+
+// dnsSeeds returns the DNS seeds of network: the configured ones if any,
+// else the built-in ones.
+func (pc *PeerConfig) dnsSeeds(network string) []string {
+	if len(pc.DNSSeeds) == 0 {
+		return getDNSSeeds(network)
+	}
+	return pc.DNSSeeds
+}
+
+// chainDNSSeeds returns the configured DNS seeds as chain parameters, for
+// neutrino's own seeding. They are not assumed to filter by service bits.
+func (pc *PeerConfig) chainDNSSeeds() []chaincfg.DNSSeed {
+	seeds := make([]chaincfg.DNSSeed, len(pc.DNSSeeds))
+	for i, host := range pc.DNSSeeds {
+		seeds[i] = chaincfg.DNSSeed{Host: host}
+	}
+	return seeds
+}
+
+// dedupe returns values without repeats, keeping their first occurrence.
+func dedupe(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if !slices.Contains(result, value) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// ReloadPeers re-reads the static peers, from addPeers in place of
+// Config.AddPeers and from the peers file. Peers added since are connected
+// to and peers removed are no longer reconnected to. DNS seeds only change
+// on restart, since seeding is done by then.
+func (n *Node) ReloadPeers(addPeers string) error {
+	if n.chainService == nil {
+		return errors.New("node not started")
+	}
+
+	config := *n.config
+	config.AddPeers = addPeers
+	pc, err := loadPeerConfig(&config)
+	if err != nil {
+		return err
+	}
+	if err := checkOnlyNet(&config, pc); err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	old := n.peerConfig
+	n.peerConfig = pc
+	n.mu.Unlock()
+
+	for _, peer := range pc.Peers {
+		if slices.Contains(old.Peers, peer) {
+			continue
+		}
+		n.diversity.addManual(peer)
+		if err := n.chainService.ConnectNode(peer, true); err != nil {
+			n.logger.Warnf("Failed to connect to added peer %s: %v", logging.KV("peer", peer), err)
+			continue
+		}
+		n.logger.Infof("Adding peer: %s", logging.KV("peer", peer))
+	}
+	for _, peer := range old.Peers {
+		if slices.Contains(pc.Peers, peer) {
+			continue
+		}
+		if err := n.chainService.RemoveNodeByAddr(peer); err != nil {
+			n.logger.Warnf("Removed peer %s stays connected until it disconnects: %v", logging.KV("peer", peer), err)
+			continue
+		}
+		n.logger.Infof("Removed peer: %s", logging.KV("peer", peer))
+	}
+
+	if !slices.Equal(old.DNSSeeds, pc.DNSSeeds) || old.NoDNSSeeds != pc.NoDNSSeeds {
+		n.logger.Warn("DNS seed changes take effect on restart")
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package neutrino
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func writePeerFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "peers.conf")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPeerFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    PeerConfig
+		wantErr bool
+	}{
+		{
+			name: "peers and seeds",
+			content: `# my nodes
+peer=node.example.com:8333
+  peer = 10.0.0.2
+
+peer=[2001:db8::1]:8333
+dnsseed=seed.example.com
+`,
+			want: PeerConfig{
+				Peers:    []string{"node.example.com:8333", "10.0.0.2", "[2001:db8::1]:8333"},
+				DNSSeeds: []string{"seed.example.com"},
+			},
+		},
+		{
+			name:    "seeding disabled",
+			content: "peer=10.0.0.2\ndnsseed=none\n",
+			want:    PeerConfig{Peers: []string{"10.0.0.2"}, NoDNSSeeds: true},
+		},
+		{name: "empty", content: "# nothing\n"},
+		{name: "missing value", content: "peer=\n", wantErr: true},
+		{name: "not a setting", content: "node.example.com\n", wantErr: true},
+		{name: "unknown setting", content: "connect=node.example.com\n", wantErr: true},
+		{name: "invalid peer", content: "peer=node.example.com:8333:1\n", wantErr: true},
+		{name: "invalid seed", content: "dnsseed=seed.example.com:53\n", wantErr: true},
+		{name: "seeds listed and disabled", content: "dnsseed=seed.example.com\ndnsseed=none\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadPeerFile(writePeerFile(t, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadPeerFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !slices.Equal(got.Peers, tt.want.Peers) || !slices.Equal(got.DNSSeeds, tt.want.DNSSeeds) || got.NoDNSSeeds != tt.want.NoDNSSeeds {
+				t.Errorf("LoadPeerFile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadPeerFile(filepath.Join(t.TempDir(), "missing.conf")); err == nil {
+		t.Error("LoadPeerFile() of a missing file should fail")
+	}
+}
+
+func TestLoadPeerConfig(t *testing.T) {
+	path := writePeerFile(t, "peer=10.0.0.2\npeer=10.0.0.3\ndnsseed=seed2.example.com\n")
+
+	pc, err := loadPeerConfig(&Config{
+		AddPeers:  "10.0.0.1,10.0.0.2",
+		DNSSeeds:  "seed1.example.com",
+		PeersFile: path,
+	})
+	if err != nil {
+		t.Fatalf("loadPeerConfig() failed: %v", err)
+	}
+	if want := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}; !slices.Equal(pc.Peers, want) {
+		t.Errorf("peers = %v, want %v", pc.Peers, want)
+	}
+	if want := []string{"seed1.example.com", "seed2.example.com"}; !slices.Equal(pc.dnsSeeds("mainnet"), want) {
+		t.Errorf("dnsSeeds() = %v, want %v", pc.dnsSeeds("mainnet"), want)
+	}
+	if seeds := pc.chainDNSSeeds(); len(seeds) != 2 || seeds[0].Host != "seed1.example.com" || seeds[0].HasFiltering {
+		t.Errorf("chainDNSSeeds() = %+v", seeds)
+	}
+
+	// Without configured seeds the built-in ones are used
+	pc, err = loadPeerConfig(&Config{})
+	if err != nil {
+		t.Fatalf("loadPeerConfig() failed: %v", err)
+	}
+	if !slices.Equal(pc.dnsSeeds("mainnet"), getDNSSeeds("mainnet")) {
+		t.Errorf("dnsSeeds() = %v, want the built-in seeds", pc.dnsSeeds("mainnet"))
+	}
+
+	// Seeds disabled by the flag cannot be listed in the file
+	if _, err := loadPeerConfig(&Config{DNSSeeds: "none", PeersFile: path}); err == nil {
+		t.Error("loadPeerConfig() should refuse seeds that are both listed and disabled")
+	}
+}
@@ -0,0 +1,110 @@
+package neutrino
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/lightninglabs/neutrino"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// PeerInfo describes a connected peer.
+type PeerInfo struct {
+	Addr        string `json:"addr"`
+	UserAgent   string `json:"user_agent"`
+	Services    string `json:"services"`
+	Height      int32  `json:"height"`
+	Inbound     bool   `json:"inbound"`
+	ConnectedAt int64  `json:"connected_at"`
+
+	// Score is how well the peer served scans, nil until it served any.
+	Score *PeerScore `json:"score,omitempty"`
+}
+
+// Peers returns the connected peers.
+func (n *Node) Peers() ([]PeerInfo, error) {
+	if n.chainService == nil {
+		return nil, errors.New("node not started")
+	}
+
+	peers := []PeerInfo{}
+	for _, peer := range n.chainService.Peers() {
+		if !peer.Connected() {
+			continue
+		}
+		peers = append(peers, PeerInfo{
+			Addr:        peer.Addr(),
+			UserAgent:   peer.UserAgent(),
+			Services:    peer.Services().String(),
+			Height:      peer.LastBlock(),
+			Inbound:     peer.Inbound(),
+			ConnectedAt: peer.TimeConnected().Unix(),
+			Score:       n.peerScores.score(peer.Addr()),
+		})
+	}
+	return peers, nil
+}
+
+// ConnectPeer connects to the peer at addr, with the network's default port
+// if it has none. A permanent peer is reconnected to whenever it drops,
+// until it is disconnected or the node restarts. The connection is made
+// in the background, so ConnectPeer returns before the peer is connected.
+func (n *Node) ConnectPeer(addr string, permanent bool) error {
+	if n.chainService == nil {
+		return errors.New("node not started")
+	}
+
+	if err := (&PeerConfig{Peers: []string{addr}}).validate(); err != nil {
+		return NewBadRequestError(err.Error())
+	}
+	if n.config.OnlyNet == NetOnion && !isOnionHost(addr) {
+		return NewBadRequestError(fmt.Sprintf("%s is not an onion address: only onion peers are allowed", addr))
+	}
+	if ip := peerIP(addr); ip != nil && (n.bans.banned(ip) || n.chainService.IsBanned(addr)) {
+		return NewConflictError(fmt.Sprintf("peer %s is banned", addr))
+	}
+
+	peers := n.chainService.Peers()
+	if slices.ContainsFunc(peers, func(sp *neutrino.ServerPeer) bool { return sp.Addr() == addr }) {
+		return NewConflictError(fmt.Sprintf("peer %s is already connected", addr))
+	}
+	if len(peers) >= neutrino.MaxPeers {
+		return NewConflictError(fmt.Sprintf("max peers reached (%d): disconnect a peer first", neutrino.MaxPeers))
+	}
+
+	n.diversity.addManual(addr)
+	if err := n.chainService.ConnectNode(addr, permanent); err != nil {
+		return NewBadRequestError(fmt.Sprintf("failed to connect to %s: %v", addr, err))
+	}
+	n.logger.Infof("Connecting to peer %s (permanent: %v)", logging.KV("peer", addr), permanent)
+	return nil
+}
+
+// DisconnectPeer disconnects the peer at addr, as listed by Peers. A
+// permanent or static peer is no longer reconnected to until the node
+// restarts; other peers may be connected to again by peer discovery.
+func (n *Node) DisconnectPeer(addr string) error {
+	if n.chainService == nil {
+		return errors.New("node not started")
+	}
+
+	// Permanent peers are only known to RemoveNodeByAddr, which also stops
+	// them from being reconnected to
+	if err := n.chainService.DisconnectNodeByAddr(addr); err != nil {
+		if err := n.chainService.RemoveNodeByAddr(addr); err != nil {
+			return NewNotFoundError("peer", fmt.Sprintf("peer %s not connected", addr))
+		}
+	}
+	n.logger.Infof("Disconnected peer %s", logging.KV("peer", addr))
+	return nil
+}
+
+// BanPeer disconnects the peer at addr and bans its IP address for the
+// configured ban duration, see AddBan. Onion peers have no IP address to
+// ban.
+func (n *Node) BanPeer(addr string) error {
+	_, err := n.AddBan(addr, "banned by operator", 0)
+	return err
+}
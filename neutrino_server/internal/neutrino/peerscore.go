@@ -0,0 +1,409 @@
+package neutrino
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+	"github.com/lightninglabs/neutrino"
+	"github.com/lightninglabs/neutrino/banman"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+const (
+	// peerBlockTimeout is how long a peer has to serve a block before it
+	// counts as stalled and the block is fetched through neutrino instead.
+	peerBlockTimeout = 15 * time.Second
+
+	// slowPeerLatency is the block latency above which a peer with at
+	// least minPeerSamples requests is chronically slow and evicted.
+	slowPeerLatency = 5 * time.Second
+	minPeerSamples  = 5
+
+	// peerLatencyWeight is the weight of the latest request in a peer's
+	// moving average latency.
+	peerLatencyWeight = 0.2
+
+	// peerEvictInterval is how often the slowest peer is evicted.
+	peerEvictInterval = 10 * time.Minute
+)
+
+var (
+	errPeerStalled      = errors.New("peer stalled")
+	errBlockNotServed   = errors.New("peer does not have the block")
+	errPeerDisconnected = errors.New("peer disconnected")
+	errNoBlockPeer      = errors.New("no connected peer has the block")
+	errInvalidBlock     = errors.New("invalid block")
+)
+
+// PeerScore is how well a peer served the blocks and filters requested from
+// it during scans.
+type PeerScore struct {
+	BlocksServed  int   `json:"blocks_served"`
+	BlockFailures int   `json:"block_failures"`
+	Stalls        int   `json:"stalls"`
+	FiltersServed int   `json:"filters_served"`
+	LatencyMs     int64 `json:"latency_ms"`
+}
+
+// peerScore is the quality record of one peer. latency is a moving average
+// in which failures and stalls count as peerBlockTimeout, so it measures how
+// long a block request to the peer costs.
+type peerScore struct {
+	PeerScore
+	latency time.Duration
+}
+
+// samples returns the number of block requests made to the peer.
+func (s *peerScore) samples() int {
+	return s.BlocksServed + s.BlockFailures + s.Stalls
+}
+
+// slow reports whether the peer has been slow over enough requests to be
+// evicted.
+func (s *peerScore) slow() bool {
+	return s.samples() >= minPeerSamples && s.latency >= slowPeerLatency
+}
+
+// peerScores tracks the quality of connected peers by address.
+type peerScores struct {
+	mu     sync.Mutex
+	scores map[string]*peerScore
+}
+
+func newPeerScores() *peerScores {
+	return &peerScores{scores: make(map[string]*peerScore)}
+}
+
+// get returns the record of addr, creating it. Callers hold mu.
+func (p *peerScores) get(addr string) *peerScore {
+	score, ok := p.scores[addr]
+	if !ok {
+		score = &peerScore{}
+		p.scores[addr] = score
+	}
+	return score
+}
+
+// recordBlock records the outcome of a block request to addr that took
+// elapsed. Requests cut short by the peer disconnecting are not recorded, as
+// the peer is forgotten, and neither are those abandoned by the caller.
+func (p *peerScores) recordBlock(addr string, elapsed time.Duration, err error) {
+	if errors.Is(err, errPeerDisconnected) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	score := p.get(addr)
+	switch {
+	case err == nil:
+		score.BlocksServed++
+	case errors.Is(err, errPeerStalled):
+		score.Stalls++
+		elapsed = peerBlockTimeout
+	default:
+		score.BlockFailures++
+		elapsed = peerBlockTimeout
+	}
+	if score.samples() == 1 {
+		score.latency = elapsed
+	} else {
+		score.latency += time.Duration(peerLatencyWeight * float64(elapsed-score.latency))
+	}
+	score.LatencyMs = score.latency.Milliseconds()
+}
+
+// recordFilter counts a filter served by addr.
+func (p *peerScores) recordFilter(addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.get(addr).FiltersServed++
+}
+
+// remove forgets a disconnected peer.
+func (p *peerScores) remove(addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.scores, addr)
+}
+
+// score returns the record of addr, or nil if nothing was requested from it.
+func (p *peerScores) score(addr string) *PeerScore {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	score, ok := p.scores[addr]
+	if !ok {
+		return nil
+	}
+	snapshot := score.PeerScore
+	return &snapshot
+}
+
+// order sorts addrs from the best peer to ask for a block to the worst:
+// peers not yet requested from first, so that every peer gets measured,
+// then by latency.
+func (p *peerScores) order(addrs []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cost := func(addr string) time.Duration {
+		score, ok := p.scores[addr]
+		if !ok || score.samples() == 0 {
+			return -1
+		}
+		return score.latency
+	}
+	slices.SortStableFunc(addrs, func(a, b string) int {
+		return cmp.Compare(cost(a), cost(b))
+	})
+}
+
+// slowest returns the slowest of the chronically slow peers among addrs, or
+// "" if there is none or every peer is slow: then the network path rather
+// than the peers is to blame, and evicting them would not help.
+func (p *peerScores) slowest(addrs []string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var worst *peerScore
+	var worstAddr string
+	fast := false
+	for _, addr := range addrs {
+		score, ok := p.scores[addr]
+		if !ok || !score.slow() {
+			fast = true
+			continue
+		}
+		if worst == nil || score.latency > worst.latency {
+			worst, worstAddr = score, addr
+		}
+	}
+	if !fast {
+		return ""
+	}
+	return worstAddr
+}
+
+// blockGetter fetches blocks, as neutrino's ChainService does.
+type blockGetter interface {
+	GetBlock(hash chainhash.Hash, options ...neutrino.QueryOption) (*btcutil.Block, error)
+}
+
+// contextBlockGetter is a blockGetter whose fetches end when a context is
+// canceled. fetchBlock prefers it.
+type contextBlockGetter interface {
+	getBlock(ctx context.Context, hash chainhash.Hash) (*btcutil.Block, error)
+}
+
+// scoredBlockSource fetches blocks from the best scored peer, so lookups do
+// not wait on slow peers, falling back to neutrino, which asks every peer in
+// turn. Filters are not fetched through it: neutrino spreads filter batches
+// over the peers itself, ranking them by how they answered earlier queries.
+type scoredBlockSource struct {
+	cs      *neutrino.ChainService
+	scores  *peerScores
+	metrics *counters
+	logger  btclog.Logger
+}
+
+// GetBlock returns the block with hash, from neutrino's block cache if it
+// holds it.
+func (s *scoredBlockSource) GetBlock(hash chainhash.Hash, options ...neutrino.QueryOption) (*btcutil.Block, error) {
+	return s.fetch(context.Background(), hash, options...)
+}
+
+// getBlock is GetBlock, returning ctx's error once ctx is canceled.
+func (s *scoredBlockSource) getBlock(ctx context.Context, hash chainhash.Hash) (*btcutil.Block, error) {
+	return s.fetch(ctx, hash)
+}
+
+// fetch returns the block with hash, from neutrino's block cache, the best
+// scored peer or neutrino, passing options to neutrino.
+func (s *scoredBlockSource) fetch(ctx context.Context, hash chainhash.Hash, options ...neutrino.QueryOption) (*btcutil.Block, error) {
+	inv := wire.NewInvVect(wire.InvTypeWitnessBlock, &hash)
+	if cached, err := s.cs.BlockCache.Get(*inv); err == nil && cached != nil {
+		s.metrics.blockCacheLookup(true)
+		return cached.Block, nil
+	}
+	s.metrics.blockCacheLookup(false)
+
+	block, err := s.fetchFromBestPeer(ctx, hash)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		s.logger.Debugf("Fetching block %s through neutrino: %v", logging.KV("block_hash", hash), err)
+		return s.fetchFromNeutrino(ctx, hash, options...)
+	}
+	fill := s.metrics.blockFill(s.cs)
+	before := s.cs.BlockCache.Len()
+	if evicted, err := s.cs.BlockCache.Put(*inv, &neutrino.CacheableBlock{Block: block}); err != nil {
+		s.logger.Warnf("Failed to cache block %s: %v", logging.KV("block_hash", hash), err)
+	} else if evicted && fill != nil {
+		fill.displaced(before, 1)
+	}
+	return block, nil
+}
+
+// fetchFromNeutrino fetches the block with hash through neutrino. Its
+// queries cannot be canceled, so a canceled ctx leaves the query to finish
+// in the background and caches its block.
+func (s *scoredBlockSource) fetchFromNeutrino(ctx context.Context, hash chainhash.Hash, options ...neutrino.QueryOption) (*btcutil.Block, error) {
+	type result struct {
+		block *btcutil.Block
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var block *btcutil.Block
+		err := s.metrics.blockFill(s.cs).run(1, func() (err error) {
+			block, err = s.cs.GetBlock(hash, options...)
+			return err
+		})
+		done <- result{block, err}
+	}()
+	select {
+	case r := <-done:
+		return r.block, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetchFromBestPeer requests the block with hash from the best scored
+// connected peer.
+func (s *scoredBlockSource) fetchFromBestPeer(ctx context.Context, hash chainhash.Hash) (*btcutil.Block, error) {
+	header, height, err := s.cs.BlockHeaders.FetchHeader(&hash)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make(map[string]*neutrino.ServerPeer)
+	var addrs []string
+	for _, peer := range s.cs.Peers() {
+		if peer.Connected() && peer.LastBlock() >= int32(height) {
+			peers[peer.Addr()] = peer
+			addrs = append(addrs, peer.Addr())
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, errNoBlockPeer
+	}
+	s.scores.order(addrs)
+	peer := peers[addrs[0]]
+
+	start := time.Now()
+	block, err := fetchPeerBlock(ctx, peer, hash, header)
+	s.scores.recordBlock(peer.Addr(), time.Since(start), err)
+	if errors.Is(err, errInvalidBlock) {
+		s.logger.Warnf("Peer %s served %v, banning it", logging.KV("peer", peer.Addr()), err)
+		if err := s.cs.BanPeer(peer.Addr(), banman.InvalidBlock); err != nil {
+			s.logger.Errorf("Failed to ban peer %s: %v", logging.KV("peer", peer.Addr()), err)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("peer %s: %w", peer.Addr(), err)
+	}
+	block.SetHeight(int32(height))
+	return block, nil
+}
+
+// fetchPeerBlock requests the block with hash and header from peer, waiting
+// peerBlockTimeout for it or until ctx is canceled.
+func fetchPeerBlock(ctx context.Context, peer *neutrino.ServerPeer, hash chainhash.Hash, header *wire.BlockHeader) (*btcutil.Block, error) {
+	msgs, cancel := peer.SubscribeRecvMsg()
+	defer cancel()
+
+	inv := wire.NewInvVect(wire.InvTypeWitnessBlock, &hash)
+	getData := wire.NewMsgGetData()
+	_ = getData.AddInvVect(inv)
+	peer.QueueMessageWithEncoding(getData, nil, wire.WitnessEncoding)
+
+	timeout := time.NewTimer(peerBlockTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case msg := <-msgs:
+			switch msg := msg.(type) {
+			case *wire.MsgBlock:
+				if msg.BlockHash() != hash {
+					continue
+				}
+				block := btcutil.NewBlock(msg)
+				if err := checkBlock(block, header); err != nil {
+					return nil, err
+				}
+				return block, nil
+
+			case *wire.MsgNotFound:
+				for _, notFound := range msg.InvList {
+					if notFound.Hash == hash {
+						return nil, errBlockNotServed
+					}
+				}
+			}
+
+		case <-timeout.C:
+			return nil, errPeerStalled
+
+		case <-peer.OnDisconnect():
+			return nil, errPeerDisconnected
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// checkBlock checks that block has the transactions committed to by header,
+// as neutrino does for the blocks it fetches. The header itself was checked
+// during header sync.
+func checkBlock(block *btcutil.Block, header *wire.BlockHeader) error {
+	if block.MsgBlock().Header.BlockHash() != header.BlockHash() {
+		return fmt.Errorf("%w: header mismatch", errInvalidBlock)
+	}
+	if merkleRoot := blockchain.CalcMerkleRoot(block.Transactions(), false); merkleRoot != header.MerkleRoot {
+		return fmt.Errorf("%w: merkle root %s, want %s", errInvalidBlock, merkleRoot, header.MerkleRoot)
+	}
+	if err := blockchain.ValidateWitnessCommitment(block); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidBlock, err)
+	}
+	return nil
+}
+
+// evictSlowPeers periodically disconnects the slowest chronically slow
+// peer, so that peer discovery replaces it. Permanent and static peers are
+// never evicted. It returns when the node stops.
+func (n *Node) evictSlowPeers() {
+	ticker := time.NewTicker(peerEvictInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.lifetime.Done():
+			return
+		case <-ticker.C:
+		}
+		addr := n.peerScores.slowest(n.connectedPeers())
+		if addr == "" {
+			continue
+		}
+		score := n.peerScores.score(addr)
+		if err := n.chainService.DisconnectNodeByAddr(addr); err != nil {
+			continue
+		}
+		n.logger.Infof("Evicted slow peer %s (%d ms per block, %d stalls, %d failures)",
+			logging.KV("peer", addr), score.LatencyMs, score.Stalls, score.BlockFailures)
+	}
+}
@@ -0,0 +1,129 @@
+package neutrino
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/lightninglabs/neutrino"
+)
+
+func TestPeerScores(t *testing.T) {
+	scores := newPeerScores()
+	scores.recordBlock("fast", 200*time.Millisecond, nil)
+	scores.recordBlock("fast", 400*time.Millisecond, nil)
+	scores.recordBlock("stalling", time.Second, nil)
+	scores.recordBlock("stalling", 0, errPeerStalled)
+	scores.recordBlock("missing", 300*time.Millisecond, errBlockNotServed)
+	scores.recordBlock("gone", time.Second, errPeerDisconnected)
+	scores.recordBlock("abandoned", time.Second, context.Canceled)
+	scores.recordFilter("fast")
+
+	fast := scores.score("fast")
+	if fast == nil || fast.BlocksServed != 2 || fast.FiltersServed != 1 || fast.LatencyMs != 240 {
+		t.Errorf("score(fast) = %+v, want 2 blocks, 1 filter and 240 ms", fast)
+	}
+	stalling := scores.score("stalling")
+	if stalling == nil || stalling.Stalls != 1 || stalling.LatencyMs != 3800 {
+		t.Errorf("score(stalling) = %+v, want 1 stall and 3800 ms", stalling)
+	}
+	if missing := scores.score("missing"); missing == nil || missing.BlockFailures != 1 || missing.LatencyMs != peerBlockTimeout.Milliseconds() {
+		t.Errorf("score(missing) = %+v, want a failure at the timeout", missing)
+	}
+	if gone := scores.score("gone"); gone != nil {
+		t.Errorf("score(gone) = %+v, want nothing recorded for a disconnected peer", gone)
+	}
+	if abandoned := scores.score("abandoned"); abandoned != nil {
+		t.Errorf("score(abandoned) = %+v, want nothing recorded for a canceled request", abandoned)
+	}
+
+	addrs := []string{"missing", "stalling", "new", "fast"}
+	scores.order(addrs)
+	if want := []string{"new", "fast", "stalling", "missing"}; !slices.Equal(addrs, want) {
+		t.Errorf("order() = %v, want %v", addrs, want)
+	}
+
+	scores.remove("fast")
+	if got := scores.score("fast"); got != nil {
+		t.Errorf("score() after remove = %+v, want nil", got)
+	}
+}
+
+// cancelableBlocks serves blocks through getBlock only, failing GetBlock.
+type cancelableBlocks struct{}
+
+func (cancelableBlocks) GetBlock(chainhash.Hash, ...neutrino.QueryOption) (*btcutil.Block, error) {
+	return nil, errors.New("GetBlock() called")
+}
+
+func (cancelableBlocks) getBlock(ctx context.Context, _ chainhash.Hash) (*btcutil.Block, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// TestFetchBlockContext tests that fetchBlock passes the context to block
+// sources that honour it.
+func TestFetchBlockContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := fetchBlock(ctx, cancelableBlocks{}, chainhash.Hash{}, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("fetchBlock() = %v, want context.Canceled", err)
+	}
+}
+
+func TestSlowestPeer(t *testing.T) {
+	scores := newPeerScores()
+	for range minPeerSamples {
+		scores.recordBlock("fast", time.Second, nil)
+		scores.recordBlock("slow", 8*time.Second, nil)
+		scores.recordBlock("slower", 0, errPeerStalled)
+	}
+	scores.recordBlock("measuring", 0, errPeerStalled)
+
+	tests := []struct {
+		name  string
+		addrs []string
+		want  string
+	}{
+		{"slowest evicted", []string{"fast", "slow", "slower"}, "slower"},
+		{"too few samples", []string{"fast", "measuring"}, ""},
+		{"no slow peer", []string{"fast"}, ""},
+		{"every peer slow", []string{"slow", "slower"}, ""},
+		{"unscored peer", []string{"new", "slow"}, "slow"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scores.slowest(tt.addrs); got != tt.want {
+				t.Errorf("slowest(%v) = %q, want %q", tt.addrs, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckBlock(t *testing.T) {
+	genesis := chaincfg.RegressionNetParams.GenesisBlock
+	header := genesis.Header
+
+	if err := checkBlock(btcutil.NewBlock(genesis), &header); err != nil {
+		t.Errorf("checkBlock() of the genesis block failed: %v", err)
+	}
+
+	tampered := *genesis
+	tampered.Header.MerkleRoot = chainhash.Hash{1}
+	if err := checkBlock(btcutil.NewBlock(&tampered), &header); !errors.Is(err, errInvalidBlock) {
+		t.Errorf("checkBlock() of a block with another header = %v, want errInvalidBlock", err)
+	}
+
+	otherHeader := header
+	otherHeader.MerkleRoot = chainhash.Hash{1}
+	tampered = *genesis
+	tampered.Header = otherHeader
+	if err := checkBlock(btcutil.NewBlock(&tampered), &otherHeader); !errors.Is(err, errInvalidBlock) {
+		t.Errorf("checkBlock() of a block not matching its merkle root = %v, want errInvalidBlock", err)
+	}
+}
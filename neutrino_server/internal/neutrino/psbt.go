@@ -0,0 +1,390 @@
+package neutrino
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// Sources of the previous outputs EnrichPSBT fills in.
+const (
+	// PSBTSourcePSBT is an output the PSBT already carried, as a witness
+	// UTXO or in the full previous transaction.
+	PSBTSourcePSBT = "psbt"
+	// PSBTSourceWallet is an unspent output of a watched address.
+	PSBTSourceWallet = "wallet"
+	// PSBTSourceIndex is an output of a transaction in the transaction
+	// index.
+	PSBTSourceIndex = "index"
+	// PSBTSourceScan is an output found by scanning block filters.
+	PSBTSourceScan = "scan"
+)
+
+// PSBTInputHint tells EnrichPSBT how to scan for the previous output of the
+// input at Index, for inputs it cannot resolve otherwise. As with GetUTXO,
+// the address is needed to match block filters; it can be left out when the
+// input carries a redeem script, witness script or taproot internal key.
+type PSBTInputHint struct {
+	Index       int    `json:"index"`
+	Address     string `json:"address,omitempty"`
+	StartHeight int32  `json:"start_height"`
+}
+
+// PSBTInput reports the previous output of one PSBT input. Error is set
+// instead of the output when it could not be found.
+type PSBTInput struct {
+	Index        int    `json:"index"`
+	TxID         string `json:"txid"`
+	Vout         uint32 `json:"vout"`
+	Source       string `json:"source,omitempty"`
+	Value        int64  `json:"value,omitempty"`
+	ScriptPubKey string `json:"scriptpubkey,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// PSBTEnrichment is a PSBT with the previous outputs of its inputs filled in.
+type PSBTEnrichment struct {
+	PSBT   string      `json:"psbt"`
+	Inputs []PSBTInput `json:"inputs"`
+
+	// Complete is true when every input has its previous output, in which
+	// case Fee is the fee the transaction pays in satoshis.
+	Complete bool   `json:"complete"`
+	Fee      *int64 `json:"fee,omitempty"`
+}
+
+// EnrichPSBT fills in the previous output of every input of the base64 or
+// hex encoded PSBT that lacks one, so signers without chain access get
+// complete PSBTs. Previous outputs are taken from the PSBT's own full
+// previous transactions, the UTXOs of watched addresses and the transaction
+// index, and otherwise found by scanning block filters for the hinted or
+// derivable address. Segwit inputs get a witness UTXO and legacy inputs the
+// full previous transaction, fetched from the index or the output's block.
+// Inputs whose previous output cannot be found are reported with an error
+// and left unchanged.
+func (n *Node) EnrichPSBT(ctx context.Context, encoded string, hints []PSBTInputHint) (*PSBTEnrichment, error) {
+	packet, err := decodePSBT(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, NewBadRequestError(fmt.Sprintf("invalid PSBT: %v", err))
+	}
+
+	byIndex := make(map[int]PSBTInputHint, len(hints))
+	for i, hint := range hints {
+		if hint.Index < 0 || hint.Index >= len(packet.Inputs) {
+			return nil, NewBadRequestError(fmt.Sprintf("hints[%d]: the PSBT has no input %d", i, hint.Index))
+		}
+		if _, dup := byIndex[hint.Index]; dup {
+			return nil, NewBadRequestError(fmt.Sprintf("hints[%d]: duplicate hint for input %d", i, hint.Index))
+		}
+		if hint.Address != "" {
+			if _, err := btcutil.DecodeAddress(hint.Address, n.chainParams); err != nil {
+				return nil, NewBadRequestError(fmt.Sprintf("hints[%d]: invalid address %s: %v", i, hint.Address, err))
+			}
+		}
+		byIndex[hint.Index] = hint
+	}
+
+	inputs := make([]PSBTInput, len(packet.Inputs))
+	heights := make([]int32, len(packet.Inputs))
+	var checks []UTXOCheck
+	var checkIdx []int
+	for i, txIn := range packet.UnsignedTx.TxIn {
+		inputs[i] = PSBTInput{
+			Index: i,
+			TxID:  txIn.PreviousOutPoint.Hash.String(),
+			Vout:  txIn.PreviousOutPoint.Index,
+		}
+		var found bool
+		if heights[i], found = n.resolvePSBTInput(packet, i, &inputs[i]); found {
+			continue
+		}
+
+		hint := byIndex[i]
+		address := hint.Address
+		if address == "" {
+			addr, ok := psbtInputAddress(&packet.Inputs[i], n.chainParams)
+			if !ok {
+				inputs[i].Error = "previous output not found: give its address in a hint to scan for it"
+				continue
+			}
+			address = addr.EncodeAddress()
+		}
+		checks = append(checks, UTXOCheck{
+			TxID:        inputs[i].TxID,
+			Vout:        inputs[i].Vout,
+			Address:     address,
+			StartHeight: hint.StartHeight,
+		})
+		checkIdx = append(checkIdx, i)
+	}
+
+	if len(checks) > 0 {
+		n.logger.Infof("Scanning for the previous outputs of %d PSBT inputs", len(checks))
+		results, err := n.CheckUTXOs(ctx, checks)
+		if err != nil {
+			return nil, err
+		}
+		for j, result := range results {
+			input := &inputs[checkIdx[j]]
+			switch {
+			case result.Error != "":
+				input.Error = result.Error
+			case !result.Unspent:
+				input.Error = fmt.Sprintf("previous output already spent by %s at height %d", result.SpendingTxID, result.SpendingHeight)
+			default:
+				input.Source = PSBTSourceScan
+				input.Value = result.Value
+				input.ScriptPubKey = result.ScriptPubKey
+				script, err := hex.DecodeString(result.ScriptPubKey)
+				if err != nil {
+					return nil, fmt.Errorf("failed to decode script of input %d: %w", checkIdx[j], err)
+				}
+				setPreviousOutput(&packet.Inputs[checkIdx[j]], wire.NewTxOut(result.Value, script))
+				heights[checkIdx[j]] = int32(result.BlockHeight)
+			}
+		}
+	}
+
+	// Signers check the value a legacy input spends in its full previous
+	// transaction
+	for i := range inputs {
+		pIn := &packet.Inputs[i]
+		if inputs[i].Error != "" || pIn.NonWitnessUtxo != nil {
+			continue
+		}
+		script, err := hex.DecodeString(inputs[i].ScriptPubKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode script of input %d: %w", i, err)
+		}
+		if _, legacy := spendKinds(pIn, script); !legacy {
+			continue
+		}
+		prevTx, err := n.previousTransaction(ctx, packet.UnsignedTx.TxIn[i].PreviousOutPoint.Hash, heights[i])
+		if err != nil {
+			inputs[i].Error = fmt.Sprintf("legacy input needs its full previous transaction: %v", err)
+			continue
+		}
+		pIn.NonWitnessUtxo = prevTx
+	}
+
+	result := &PSBTEnrichment{Inputs: inputs, Complete: true}
+	var fee int64
+	for _, input := range inputs {
+		result.Complete = result.Complete && input.Error == ""
+		fee += input.Value
+	}
+	if result.Complete {
+		for _, txOut := range packet.UnsignedTx.TxOut {
+			fee -= txOut.Value
+		}
+		result.Fee = &fee
+	}
+
+	result.PSBT, err = packet.B64Encode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode PSBT: %w", err)
+	}
+	return result, nil
+}
+
+// decodePSBT parses a base64 or hex encoded PSBT.
+func decodePSBT(encoded string) (*psbt.Packet, error) {
+	if isHex(encoded) {
+		raw, _ := hex.DecodeString(encoded)
+		return psbt.NewFromRawBytes(bytes.NewReader(raw), false)
+	}
+	return psbt.NewFromRawBytes(strings.NewReader(encoded), true)
+}
+
+// resolvePSBTInput fills in input i of packet from the PSBT itself, the
+// watched UTXOs or the transaction index, reporting whether it was found and
+// the height of the previous output, or -1 if unknown.
+func (n *Node) resolvePSBTInput(packet *psbt.Packet, i int, input *PSBTInput) (int32, bool) {
+	pIn := &packet.Inputs[i]
+	outpoint := packet.UnsignedTx.TxIn[i].PreviousOutPoint
+
+	if pIn.WitnessUtxo != nil {
+		input.Source = PSBTSourcePSBT
+		input.Value = pIn.WitnessUtxo.Value
+		input.ScriptPubKey = hex.EncodeToString(pIn.WitnessUtxo.PkScript)
+		return -1, true
+	}
+
+	if pIn.NonWitnessUtxo != nil {
+		txOut, err := previousOutput(pIn.NonWitnessUtxo, outpoint)
+		if err != nil {
+			input.Error = fmt.Sprintf("non_witness_utxo: %v", err)
+			return -1, true
+		}
+		setPreviousOutput(pIn, txOut)
+		input.Source = PSBTSourcePSBT
+		input.Value = txOut.Value
+		input.ScriptPubKey = hex.EncodeToString(txOut.PkScript)
+		return -1, true
+	}
+
+	if n.rescanMgr != nil {
+		if utxo, ok := n.rescanMgr.utxo(outpoint.String()); ok {
+			script, err := hex.DecodeString(utxo.ScriptPubKey)
+			if err == nil {
+				setPreviousOutput(pIn, wire.NewTxOut(utxo.Value, script))
+				input.Source = PSBTSourceWallet
+				input.Value = utxo.Value
+				input.ScriptPubKey = utxo.ScriptPubKey
+				return utxo.Height, true
+			}
+		}
+	}
+
+	if n.store != nil {
+		indexed, found, err := n.store.Transaction(outpoint.Hash.String())
+		if err != nil {
+			n.logger.Warnf("Failed to look up %s in the transaction index: %v", outpoint.Hash, err)
+		}
+		if found {
+			tx, err := indexed.decode()
+			if err != nil {
+				n.logger.Warnf("Failed to decode indexed transaction %s: %v", logging.KV("txid", outpoint.Hash), err)
+				return -1, false
+			}
+			txOut, err := previousOutput(tx.MsgTx(), outpoint)
+			if err != nil {
+				input.Error = err.Error()
+				return -1, true
+			}
+			setPreviousOutput(pIn, txOut)
+			pIn.NonWitnessUtxo = tx.MsgTx()
+			input.Source = PSBTSourceIndex
+			input.Value = txOut.Value
+			input.ScriptPubKey = hex.EncodeToString(txOut.PkScript)
+			return indexed.BlockHeight, true
+		}
+	}
+
+	return -1, false
+}
+
+// setPreviousOutput sets txOut as the witness UTXO of pIn, unless pIn is a
+// legacy spend, for which BIP 174 has no witness UTXO.
+func setPreviousOutput(pIn *psbt.PInput, txOut *wire.TxOut) {
+	if witness, _ := spendKinds(pIn, txOut.PkScript); witness {
+		pIn.WitnessUtxo = txOut
+	}
+}
+
+// spendKinds reports whether spending pkScript from pIn may be a segwit
+// spend, signed with the previous output alone, and whether it may be a
+// legacy one, whose signers need the full previous transaction. A P2SH
+// output may be either unless pIn carries its redeem script.
+func spendKinds(pIn *psbt.PInput, pkScript []byte) (witness, legacy bool) {
+	switch {
+	case txscript.IsWitnessProgram(pkScript):
+		return true, false
+	case txscript.IsPayToScriptHash(pkScript) && len(pIn.RedeemScript) == 0:
+		return true, true
+	case txscript.IsPayToScriptHash(pkScript):
+		nested := txscript.IsWitnessProgram(pIn.RedeemScript)
+		return nested, !nested
+	default:
+		return false, true
+	}
+}
+
+// previousTransaction returns the transaction hash from the transaction
+// index, or else from its block at height, if that is known (not -1).
+func (n *Node) previousTransaction(ctx context.Context, hash chainhash.Hash, height int32) (*wire.MsgTx, error) {
+	if n.store != nil {
+		indexed, found, err := n.store.Transaction(hash.String())
+		if err != nil {
+			n.logger.Warnf("Failed to look up %s in the transaction index: %v", logging.KV("txid", hash), err)
+		}
+		if found {
+			if tx, err := indexed.decode(); err == nil {
+				return tx.MsgTx(), nil
+			}
+		}
+	}
+	if height < 0 || n.chainService == nil {
+		return nil, errors.New("transaction is not indexed and its block is unknown")
+	}
+
+	blockHash, err := n.chainService.GetBlockHash(int64(height))
+	if err != nil {
+		return nil, fmt.Errorf("no block at height %d: %w", height, err)
+	}
+	block, err := fetchBlock(ctx, n.rescanMgr.blocks, *blockHash, height)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block %s: %w", blockHash, err)
+	}
+	for _, tx := range block.Transactions() {
+		if tx.Hash().IsEqual(&hash) {
+			return tx.MsgTx(), nil
+		}
+	}
+	return nil, fmt.Errorf("transaction %s not found in block %d", hash, height)
+}
+
+// previousOutput returns the output of prevTx spent through outpoint.
+func previousOutput(prevTx *wire.MsgTx, outpoint wire.OutPoint) (*wire.TxOut, error) {
+	if prevTx.TxHash() != outpoint.Hash {
+		return nil, fmt.Errorf("transaction %s is not the previous transaction %s", prevTx.TxHash(), outpoint.Hash)
+	}
+	if outpoint.Index >= uint32(len(prevTx.TxOut)) {
+		return nil, fmt.Errorf("transaction %s has no output %d", outpoint.Hash, outpoint.Index)
+	}
+	return prevTx.TxOut[outpoint.Index], nil
+}
+
+// psbtInputAddress derives the address an input spends from the scripts or
+// keys the PSBT carries for signing it: a witness or redeem script, or a
+// taproot internal key. Inputs with only a public key are ambiguous between
+// script types and have no derivable address.
+func psbtInputAddress(pIn *psbt.PInput, params *chaincfg.Params) (btcutil.Address, bool) {
+	var addr btcutil.Address
+	var err error
+	switch {
+	case len(pIn.RedeemScript) > 0:
+		addr, err = btcutil.NewAddressScriptHash(pIn.RedeemScript, params)
+
+	case len(pIn.WitnessScript) > 0:
+		scriptHash := sha256.Sum256(pIn.WitnessScript)
+		addr, err = btcutil.NewAddressWitnessScriptHash(scriptHash[:], params)
+
+	case len(pIn.TaprootInternalKey) > 0:
+		internalKey, parseErr := schnorr.ParsePubKey(pIn.TaprootInternalKey)
+		if parseErr != nil {
+			return nil, false
+		}
+		outputKey := txscript.ComputeTaprootKeyNoScript(internalKey)
+		if len(pIn.TaprootMerkleRoot) > 0 {
+			outputKey = txscript.ComputeTaprootOutputKey(internalKey, pIn.TaprootMerkleRoot)
+		}
+		addr, err = btcutil.NewAddressTaproot(schnorr.SerializePubKey(outputKey), params)
+
+	default:
+		return nil, false
+	}
+	return addr, err == nil
+}
+
+// utxo returns the watched UTXO with the given "txid:vout" key.
+func (r *RescanManager) utxo(key string) (UTXO, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	utxo, ok := r.utxoSet[key]
+	return utxo, ok
+}
@@ -0,0 +1,268 @@
+package neutrino
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+)
+
+func TestEnrichPSBT(t *testing.T) {
+	p2wpkh, _ := hex.DecodeString("0014751e76e8199196d454941c45d1b3a323f1433bd6")
+	prevTx := func(value int64) *wire.MsgTx {
+		tx := wire.NewMsgTx(2)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{byte(value)}, 0), nil, nil))
+		tx.AddTxOut(wire.NewTxOut(1, []byte{0x51}))
+		tx.AddTxOut(wire.NewTxOut(value, p2wpkh))
+		return tx
+	}
+	carried, nonWitness, indexed := prevTx(1000), prevTx(2000), prevTx(4000)
+	walletOutpoint := wire.OutPoint{Hash: chainhash.Hash{0xaa}, Index: 3}
+	missing := wire.OutPoint{Hash: chainhash.Hash{0xbb}, Index: 0}
+
+	store := newTestStore(t)
+	var raw bytes.Buffer
+	if err := indexed.Serialize(&raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutTransactions(map[string]IndexedTx{
+		indexed.TxHash().String(): {Hex: hex.EncodeToString(raw.Bytes()), BlockHeight: 100},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	n := &Node{
+		chainParams: &chaincfg.MainNetParams,
+		logger:      btclog.Disabled,
+		store:       store,
+		rescanMgr: &RescanManager{
+			utxoSet: map[string]UTXO{
+				walletOutpoint.String(): {TxID: walletOutpoint.Hash.String(), Vout: 3, Value: 3000, ScriptPubKey: hex.EncodeToString(p2wpkh)},
+			},
+		},
+	}
+
+	newPacket := func(spend int64, outpoints ...wire.OutPoint) *psbt.Packet {
+		inputs := make([]*wire.OutPoint, len(outpoints))
+		for i := range outpoints {
+			inputs[i] = &outpoints[i]
+		}
+		packet, err := psbt.New(inputs, []*wire.TxOut{wire.NewTxOut(spend, p2wpkh)}, 2, 0, make([]uint32, len(inputs)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return packet
+	}
+
+	packet := newPacket(9000,
+		wire.OutPoint{Hash: carried.TxHash(), Index: 1},
+		wire.OutPoint{Hash: nonWitness.TxHash(), Index: 1},
+		walletOutpoint,
+		wire.OutPoint{Hash: indexed.TxHash(), Index: 1},
+		missing,
+	)
+	packet.Inputs[0].WitnessUtxo = carried.TxOut[1]
+	packet.Inputs[1].NonWitnessUtxo = nonWitness
+	encoded, err := packet.B64Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := n.EnrichPSBT(context.Background(), encoded, nil)
+	if err != nil {
+		t.Fatalf("EnrichPSBT() failed: %v", err)
+	}
+	wantSources := []string{PSBTSourcePSBT, PSBTSourcePSBT, PSBTSourceWallet, PSBTSourceIndex, ""}
+	wantValues := []int64{1000, 2000, 3000, 4000, 0}
+	for i, input := range result.Inputs {
+		if input.Source != wantSources[i] || input.Value != wantValues[i] {
+			t.Errorf("inputs[%d] = %+v, want %d from %q", i, input, wantValues[i], wantSources[i])
+		}
+	}
+	if result.Inputs[4].Error == "" || result.Complete || result.Fee != nil {
+		t.Errorf("EnrichPSBT() with an unresolved input = %+v", result)
+	}
+
+	enriched, err := decodePSBT(result.PSBT)
+	if err != nil {
+		t.Fatalf("failed to decode the enriched PSBT: %v", err)
+	}
+	for i, want := range wantValues[:4] {
+		if utxo := enriched.Inputs[i].WitnessUtxo; utxo == nil || utxo.Value != want || !bytes.Equal(utxo.PkScript, p2wpkh) {
+			t.Errorf("enriched inputs[%d].WitnessUtxo = %+v", i, utxo)
+		}
+	}
+	if enriched.Inputs[3].NonWitnessUtxo == nil || enriched.Inputs[4].WitnessUtxo != nil {
+		t.Errorf("enriched inputs = %+v", enriched.Inputs)
+	}
+
+	// With every input found, the fee is known
+	hexPacket := newPacket(6500, walletOutpoint, wire.OutPoint{Hash: indexed.TxHash(), Index: 1})
+	var buf bytes.Buffer
+	if err := hexPacket.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	result, err = n.EnrichPSBT(context.Background(), hex.EncodeToString(buf.Bytes()), nil)
+	if err != nil {
+		t.Fatalf("EnrichPSBT() of a hex PSBT failed: %v", err)
+	}
+	if !result.Complete || result.Fee == nil || *result.Fee != 500 {
+		t.Errorf("EnrichPSBT() = %+v, want a complete PSBT paying a fee of 500", result)
+	}
+
+	badRequests := []struct {
+		name  string
+		psbt  string
+		hints []PSBTInputHint
+	}{
+		{"invalid PSBT", "not a psbt", nil},
+		{"hint for a missing input", encoded, []PSBTInputHint{{Index: 5}}},
+		{"duplicate hint", encoded, []PSBTInputHint{{Index: 4}, {Index: 4}}},
+		{"invalid hint address", encoded, []PSBTInputHint{{Index: 4, Address: "bogus"}}},
+	}
+	for _, tt := range badRequests {
+		t.Run(tt.name, func(t *testing.T) {
+			var badRequest *BadRequestError
+			if _, err := n.EnrichPSBT(context.Background(), tt.psbt, tt.hints); !errors.As(err, &badRequest) {
+				t.Errorf("EnrichPSBT() error = %v, want a bad request", err)
+			}
+		})
+	}
+}
+
+func TestEnrichPSBTLegacyInputs(t *testing.T) {
+	p2pkh, _ := hex.DecodeString("76a914751e76e8199196d454941c45d1b3a323f1433bd688ac")
+	p2sh, _ := hex.DecodeString("a914bcfeb728b584253d5f3f70bcb780e9ef218a68f487")
+	prevTx := func(value int64, script []byte) *wire.MsgTx {
+		tx := wire.NewMsgTx(2)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{byte(value >> 8)}, 0), nil, nil))
+		tx.AddTxOut(wire.NewTxOut(value, script))
+		return tx
+	}
+	carried, indexed, walletTx, unknown := prevTx(1000, p2pkh), prevTx(2000, p2pkh), prevTx(3000, p2sh), prevTx(4000, p2pkh)
+
+	store := newTestStore(t)
+	txs := make(map[string]IndexedTx)
+	for _, tx := range []*wire.MsgTx{indexed, walletTx} {
+		var raw bytes.Buffer
+		if err := tx.Serialize(&raw); err != nil {
+			t.Fatal(err)
+		}
+		txs[tx.TxHash().String()] = IndexedTx{Hex: hex.EncodeToString(raw.Bytes()), BlockHeight: 100}
+	}
+	if err := store.PutTransactions(txs); err != nil {
+		t.Fatal(err)
+	}
+
+	walletOutpoint := wire.OutPoint{Hash: walletTx.TxHash()}
+	unknownOutpoint := wire.OutPoint{Hash: unknown.TxHash()}
+	n := &Node{
+		chainParams: &chaincfg.MainNetParams,
+		logger:      btclog.Disabled,
+		store:       store,
+		rescanMgr: &RescanManager{
+			utxoSet: map[string]UTXO{
+				walletOutpoint.String():  {TxID: walletOutpoint.Hash.String(), Value: 3000, ScriptPubKey: hex.EncodeToString(p2sh), Height: 100},
+				unknownOutpoint.String(): {TxID: unknownOutpoint.Hash.String(), Value: 4000, ScriptPubKey: hex.EncodeToString(p2pkh), Height: 100},
+			},
+		},
+	}
+
+	outpoints := []*wire.OutPoint{{Hash: carried.TxHash()}, {Hash: indexed.TxHash()}, &walletOutpoint, &unknownOutpoint}
+	packet, err := psbt.New(outpoints, []*wire.TxOut{wire.NewTxOut(9000, p2pkh)}, 2, 0, make([]uint32, len(outpoints)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet.Inputs[0].NonWitnessUtxo = carried
+	encoded, err := packet.B64Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := n.EnrichPSBT(context.Background(), encoded, nil)
+	if err != nil {
+		t.Fatalf("EnrichPSBT() failed: %v", err)
+	}
+	enriched, err := decodePSBT(result.PSBT)
+	if err != nil {
+		t.Fatalf("failed to decode the enriched PSBT: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		prevTx         *wire.MsgTx
+		witnessUTXO    bool
+		wantInputError bool
+	}{
+		{"carried P2PKH", carried, false, false},
+		{"indexed P2PKH", indexed, false, false},
+		// Without its redeem script a P2SH output may be segwit or legacy
+		{"wallet P2SH", walletTx, true, false},
+		{"P2PKH without its transaction", nil, false, true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pIn := enriched.Inputs[i]
+			if (result.Inputs[i].Error != "") != tt.wantInputError {
+				t.Errorf("inputs[%d].Error = %q, want an error %v", i, result.Inputs[i].Error, tt.wantInputError)
+			}
+			if (pIn.WitnessUtxo != nil) != tt.witnessUTXO {
+				t.Errorf("inputs[%d].WitnessUtxo = %+v, want one %v", i, pIn.WitnessUtxo, tt.witnessUTXO)
+			}
+			switch {
+			case tt.prevTx == nil && pIn.NonWitnessUtxo != nil:
+				t.Errorf("inputs[%d].NonWitnessUtxo = %v, want none", i, pIn.NonWitnessUtxo.TxHash())
+			case tt.prevTx != nil && (pIn.NonWitnessUtxo == nil || pIn.NonWitnessUtxo.TxHash() != tt.prevTx.TxHash()):
+				t.Errorf("inputs[%d].NonWitnessUtxo = %+v, want %s", i, pIn.NonWitnessUtxo, tt.prevTx.TxHash())
+			}
+		})
+	}
+	if result.Complete {
+		t.Error("EnrichPSBT() without the previous transaction of a legacy input is complete")
+	}
+}
+
+func TestPSBTInputAddress(t *testing.T) {
+	witnessScript, _ := hex.DecodeString("51210279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f8179851ae")
+	redeemScript, _ := hex.DecodeString("0014751e76e8199196d454941c45d1b3a323f1433bd6")
+	internalKey, _ := hex.DecodeString("cc8a4bc64d897bddc5fbc2f670f7a8ba0b386779106cf1223c6fc5d7cd6fc115")
+
+	scriptHash := sha256.Sum256(witnessScript)
+	wsh, _ := btcutil.NewAddressWitnessScriptHash(scriptHash[:], &chaincfg.MainNetParams)
+
+	tests := []struct {
+		name  string
+		input psbt.PInput
+		want  string
+	}{
+		{"witness script", psbt.PInput{WitnessScript: witnessScript}, wsh.EncodeAddress()},
+		{"redeem script", psbt.PInput{RedeemScript: redeemScript}, "3JvL6Ymt8MVWiCNHC7oWU6nLeHNJKLZGLN"},
+		// BIP86 test vector m/86'/0'/0'/0/0
+		{"taproot internal key", psbt.PInput{TaprootInternalKey: internalKey}, "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"},
+		{"public key only", psbt.PInput{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, ok := psbtInputAddress(&tt.input, &chaincfg.MainNetParams)
+			if tt.want == "" {
+				if ok {
+					t.Errorf("psbtInputAddress() = %v, want none", addr)
+				}
+				return
+			}
+			if !ok || addr.EncodeAddress() != tt.want {
+				t.Errorf("psbtInputAddress() = %v, want %s", addr, tt.want)
+			}
+		})
+	}
+}
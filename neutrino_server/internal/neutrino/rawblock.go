@@ -0,0 +1,97 @@
+package neutrino
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// rawBlockRefreshInterval is how old the access time of a cached block must
+// be for a request to refresh it. Refreshing rewrites the whole block, so
+// blocks requested often are rewritten at most once per interval, at the
+// cost of pruning blocks requested within the same interval in any order.
+const rawBlockRefreshInterval = time.Hour
+
+// RawBlock is a serialized block in wire format.
+type RawBlock struct {
+	Hash   string
+	Height int32
+	Data   []byte
+
+	// Cached is set if the block was served from the block cache instead of
+	// being downloaded.
+	Cached bool
+}
+
+// GetRawBlock returns the serialized block identified by height (if
+// non-negative) and/or hashStr. Blocks are downloaded from peers, and kept
+// in the block cache when it is enabled so repeated requests are served
+// locally.
+func (n *Node) GetRawBlock(ctx context.Context, height int32, hashStr string) (*RawBlock, error) {
+	if n.chainService == nil {
+		return nil, errors.New("chain service not initialized")
+	}
+	if height < 0 && hashStr == "" {
+		return nil, NewBadRequestError("block height or hash is required")
+	}
+
+	hash, height, err := n.resolveBlock(height, hashStr)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := n.config.BlockCacheMaxBytes > 0 && n.store != nil
+	if cache {
+		data, accessed, found, err := n.store.RawBlock(hash)
+		if err != nil {
+			n.logger.Warnf("Failed to read cached block %s: %v", logging.KV("block_hash", hash), err)
+		} else if found {
+			// Refresh the access time so the block is pruned last
+			if now := time.Now().Unix(); now-accessed >= int64(rawBlockRefreshInterval/time.Second) {
+				if err := n.store.PutRawBlock(hash, data, now); err != nil {
+					n.logger.Warnf("Failed to update cached block %s: %v", logging.KV("block_hash", hash), err)
+				}
+			}
+			return &RawBlock{Hash: hash.String(), Height: height, Data: data, Cached: true}, nil
+		}
+	}
+
+	block, err := fetchBlock(ctx, n.rescanMgr.blocks, *hash, height)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block %s: %w", hash, err)
+	}
+
+	var buf bytes.Buffer
+	if err := block.MsgBlock().Serialize(&buf); err != nil {
+		return nil, fmt.Errorf("failed to serialize block %s: %w", hash, err)
+	}
+
+	if cache {
+		n.cacheRawBlock(hash, buf.Bytes())
+	}
+
+	return &RawBlock{Hash: hash.String(), Height: height, Data: buf.Bytes()}, nil
+}
+
+// cacheRawBlock adds a downloaded block to the block cache and prunes the
+// least recently requested blocks to stay under the configured limit.
+// Failures are only logged, since the block can always be downloaded again.
+func (n *Node) cacheRawBlock(hash *chainhash.Hash, data []byte) {
+	if err := n.store.PutRawBlock(hash, data, time.Now().Unix()); err != nil {
+		n.logger.Warnf("Failed to cache block %s: %v", logging.KV("block_hash", hash), err)
+		return
+	}
+
+	pruned, err := n.store.PruneRawBlocks(n.config.BlockCacheMaxBytes)
+	if err != nil {
+		n.logger.Warnf("Failed to prune block cache: %v", err)
+	} else if pruned > 0 {
+		n.logger.Debugf("Pruned %d cached blocks to stay under %d bytes", pruned, n.config.BlockCacheMaxBytes)
+	}
+}
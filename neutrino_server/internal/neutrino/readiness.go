@@ -0,0 +1,187 @@
+package neutrino
+
+import "fmt"
+
+// ReadinessConfig selects which conditions must hold before the node is
+// considered ready to serve wallet traffic. A node is never ready before its
+// chain service has started, or while its header chains contradict the
+// configured checkpoints; the zero value disables every other check, so
+// operators opt in to the conditions that matter to them.
+type ReadinessConfig struct {
+	// MinPeers is the minimum number of connected peers. Zero disables the check.
+	MinPeers int
+
+	// RequireHeadersCurrent requires the chain service to report that its
+	// block header chain is current with the network.
+	RequireHeadersCurrent bool
+
+	// RequireTipCurrent requires the block header chain to be within
+	// MaxTipLag blocks of the best height announced by connected peers.
+	RequireTipCurrent bool
+	MaxTipLag         int32
+
+	// RequireFiltersCurrent requires the filter chain to be within
+	// MaxFilterLag blocks of the block header chain.
+	RequireFiltersCurrent bool
+	MaxFilterLag          int32
+
+	// RequireHealthyScans requires that the most recent background rescan
+	// did not fail.
+	RequireHealthyScans bool
+}
+
+// ReadinessCheck is the outcome of a single readiness condition.
+type ReadinessCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// Readiness reports whether the node is ready to serve wallet traffic, along
+// with the individual checks that were evaluated.
+type Readiness struct {
+	Ready  bool             `json:"ready"`
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+// readinessState is a snapshot of the node state that readiness is derived from.
+type readinessState struct {
+	started        bool
+	peers          int
+	peerHeight     int32
+	headersCurrent bool
+	blockHeight    int32
+	filterHeight   int32
+	scanErr        error
+
+	// checkpoints is set when checkpoints are configured, checkpointErr
+	// when the header chains contradict them.
+	checkpoints   bool
+	checkpointErr error
+}
+
+// GetReadiness evaluates the configured readiness conditions against the
+// current node state.
+func (n *Node) GetReadiness() Readiness {
+	n.mu.RLock()
+	state := readinessState{
+		headersCurrent: n.synced,
+		blockHeight:    n.blockHeight,
+		filterHeight:   n.filterHeight,
+	}
+	n.mu.RUnlock()
+
+	if n.chainService != nil {
+		state.started = true
+		for _, peer := range n.chainService.Peers() {
+			if peer.Connected() {
+				state.peers++
+				state.peerHeight = max(state.peerHeight, peer.LastBlock())
+			}
+		}
+	}
+	if n.rescanMgr != nil {
+		state.scanErr = n.rescanMgr.LastRescanError()
+	}
+	if n.checkpoints != nil {
+		state.checkpoints = true
+		state.checkpointErr = n.checkpoints.err()
+	}
+
+	return evaluateReadiness(n.config.Readiness, state)
+}
+
+// evaluateReadiness applies each enabled condition in cfg to state. The node
+// is ready only if every enabled check passes.
+func evaluateReadiness(cfg ReadinessConfig, state readinessState) Readiness {
+	checks := make([]ReadinessCheck, 0, 6)
+
+	detail := "chain service started"
+	if !state.started {
+		detail = "chain service not started"
+	}
+	checks = append(checks, ReadinessCheck{
+		Name:   "started",
+		OK:     state.started,
+		Detail: detail,
+	})
+
+	if cfg.MinPeers > 0 {
+		checks = append(checks, ReadinessCheck{
+			Name:   "peers",
+			OK:     state.peers >= cfg.MinPeers,
+			Detail: fmt.Sprintf("%d connected, %d required", state.peers, cfg.MinPeers),
+		})
+	}
+
+	if cfg.RequireHeadersCurrent {
+		detail := "header chain is current"
+		if !state.headersCurrent {
+			detail = fmt.Sprintf("header chain is syncing at height %d", state.blockHeight)
+		}
+		checks = append(checks, ReadinessCheck{
+			Name:   "headers",
+			OK:     state.headersCurrent,
+			Detail: detail,
+		})
+	}
+
+	if cfg.RequireTipCurrent {
+		lag := max(state.peerHeight-state.blockHeight, 0)
+		detail := fmt.Sprintf("headers %d blocks behind the best peer at %d, %d allowed", lag, state.peerHeight, cfg.MaxTipLag)
+		if state.peers == 0 {
+			detail = "no connected peers to compare the header chain with"
+		}
+		checks = append(checks, ReadinessCheck{
+			Name:   "tip",
+			OK:     state.peers > 0 && lag <= cfg.MaxTipLag,
+			Detail: detail,
+		})
+	}
+
+	if cfg.RequireFiltersCurrent {
+		lag := state.blockHeight - state.filterHeight
+		checks = append(checks, ReadinessCheck{
+			Name:   "filters",
+			OK:     lag <= cfg.MaxFilterLag,
+			Detail: fmt.Sprintf("filters %d blocks behind headers, %d allowed", lag, cfg.MaxFilterLag),
+		})
+	}
+
+	if cfg.RequireHealthyScans {
+		detail := "no failed background rescans"
+		if state.scanErr != nil {
+			detail = fmt.Sprintf("last background rescan failed: %v", state.scanErr)
+		}
+		checks = append(checks, ReadinessCheck{
+			Name:   "scans",
+			OK:     state.scanErr == nil,
+			Detail: detail,
+		})
+	}
+
+	if state.checkpoints {
+		detail := "header chains agree with the checkpoints"
+		if state.checkpointErr != nil {
+			detail = fmt.Sprintf("header chains contradict the checkpoints: %v", state.checkpointErr)
+		}
+		checks = append(checks, ReadinessCheck{
+			Name:   "checkpoints",
+			OK:     state.checkpointErr == nil,
+			Detail: detail,
+		})
+	}
+
+	ready := true
+	for _, check := range checks {
+		if !check.OK {
+			ready = false
+			break
+		}
+	}
+
+	return Readiness{
+		Ready:  ready,
+		Checks: checks,
+	}
+}
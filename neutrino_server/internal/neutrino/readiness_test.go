@@ -0,0 +1,155 @@
+package neutrino
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEvaluateReadiness(t *testing.T) {
+	healthy := readinessState{
+		started:        true,
+		peers:          3,
+		peerHeight:     1001,
+		headersCurrent: true,
+		blockHeight:    1000,
+		filterHeight:   998,
+	}
+
+	tests := []struct {
+		name       string
+		config     ReadinessConfig
+		state      readinessState
+		wantReady  bool
+		wantChecks int
+		wantFailed string
+	}{
+		{
+			name:       "no checks configured",
+			config:     ReadinessConfig{},
+			state:      readinessState{started: true},
+			wantReady:  true,
+			wantChecks: 1,
+		},
+		{
+			name:       "chain service not started",
+			config:     ReadinessConfig{},
+			state:      readinessState{},
+			wantReady:  false,
+			wantChecks: 1,
+			wantFailed: "started",
+		},
+		{
+			name: "all checks pass",
+			config: ReadinessConfig{
+				MinPeers:              2,
+				RequireHeadersCurrent: true,
+				RequireTipCurrent:     true,
+				MaxTipLag:             1,
+				RequireFiltersCurrent: true,
+				MaxFilterLag:          2,
+				RequireHealthyScans:   true,
+			},
+			state:      healthy,
+			wantReady:  true,
+			wantChecks: 6,
+		},
+		{
+			name:       "too few peers",
+			config:     ReadinessConfig{MinPeers: 5},
+			state:      healthy,
+			wantReady:  false,
+			wantChecks: 2,
+			wantFailed: "peers",
+		},
+		{
+			name:   "headers syncing",
+			config: ReadinessConfig{RequireHeadersCurrent: true},
+			state: readinessState{
+				started:     true,
+				peers:       3,
+				blockHeight: 500,
+			},
+			wantReady:  false,
+			wantChecks: 2,
+			wantFailed: "headers",
+		},
+		{
+			name:   "headers behind peers",
+			config: ReadinessConfig{RequireTipCurrent: true, MaxTipLag: 6},
+			state: readinessState{
+				started:     true,
+				peers:       3,
+				peerHeight:  1000,
+				blockHeight: 900,
+			},
+			wantReady:  false,
+			wantChecks: 2,
+			wantFailed: "tip",
+		},
+		{
+			name:       "no peers to compare the tip with",
+			config:     ReadinessConfig{RequireTipCurrent: true, MaxTipLag: 6},
+			state:      readinessState{started: true},
+			wantReady:  false,
+			wantChecks: 2,
+			wantFailed: "tip",
+		},
+		{
+			name: "filters lagging",
+			config: ReadinessConfig{
+				RequireFiltersCurrent: true,
+				MaxFilterLag:          1,
+			},
+			state:      healthy,
+			wantReady:  false,
+			wantChecks: 2,
+			wantFailed: "filters",
+		},
+		{
+			name:   "headers contradicting the checkpoints",
+			config: ReadinessConfig{},
+			state: readinessState{
+				started:       true,
+				checkpoints:   true,
+				checkpointErr: errors.New("block 100 is 01, but the checkpoint is 02"),
+			},
+			wantReady:  false,
+			wantChecks: 2,
+			wantFailed: "checkpoints",
+		},
+		{
+			name:   "failed background rescan",
+			config: ReadinessConfig{RequireHealthyScans: true},
+			state: readinessState{
+				started: true,
+				scanErr: errors.New("no valid scripts to scan for"),
+			},
+			wantReady:  false,
+			wantChecks: 2,
+			wantFailed: "scans",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readiness := evaluateReadiness(tt.config, tt.state)
+
+			if readiness.Ready != tt.wantReady {
+				t.Errorf("Ready = %v, want %v", readiness.Ready, tt.wantReady)
+			}
+
+			if len(readiness.Checks) != tt.wantChecks {
+				t.Fatalf("got %d checks, want %d", len(readiness.Checks), tt.wantChecks)
+			}
+
+			for _, check := range readiness.Checks {
+				if !check.OK && check.Name != tt.wantFailed {
+					t.Errorf("unexpected failed check %q: %s", check.Name, check.Detail)
+				}
+				if check.Detail == "" {
+					t.Errorf("check %q has no detail", check.Name)
+				}
+			}
+		})
+	}
+}
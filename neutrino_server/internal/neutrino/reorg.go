@@ -0,0 +1,171 @@
+package neutrino
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// reorgWindow is the number of recent block hashes remembered to detect
+// reorgs. A reorg deeper than this is reported with the fork at the bottom of
+// the window.
+const reorgWindow = 100
+
+// Reorg describes a chain reorganization: the blocks above ForkHeight on the
+// old chain were replaced.
+type Reorg struct {
+	OldTipHeight int32  `json:"old_tip_height"`
+	OldTipHash   string `json:"old_tip_hash"`
+	NewTipHeight int32  `json:"new_tip_height"`
+	NewTipHash   string `json:"new_tip_hash"`
+
+	// ForkHeight is the height of the last block shared by both chains.
+	ForkHeight int32 `json:"fork_height"`
+
+	// Depth is the number of blocks disconnected from the old chain.
+	Depth int32 `json:"depth"`
+
+	Time int64 `json:"time"`
+}
+
+// recentBlocks remembers the best chain hashes of the last reorgWindow
+// heights seen by the node.
+type recentBlocks struct {
+	mu     sync.Mutex
+	hashes map[int32]chainhash.Hash
+	tip    int32
+
+	// last is the most recent reorg, reported by the status endpoint.
+	last *Reorg
+}
+
+// newRecentBlocks creates an empty recentBlocks.
+func newRecentBlocks() *recentBlocks {
+	return &recentBlocks{hashes: make(map[int32]chainhash.Hash), tip: -1}
+}
+
+// observe records the chain ending at tip with hash tipHash, where hashAt
+// returns the current best chain hash at a height, and returns the reorg that
+// replaced previously seen blocks, if any.
+func (b *recentBlocks) observe(tip int32, tipHash chainhash.Hash, hashAt func(height int32) (chainhash.Hash, error)) (*Reorg, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var reorg *Reorg
+	oldTip := b.tip
+	if oldTip >= 0 {
+		oldTipHash := b.hashes[oldTip]
+
+		// Walk down from the old tip to the last block still in the chain
+		fork := oldTip - reorgWindow
+		for height := oldTip; height > oldTip-reorgWindow; height-- {
+			seen, ok := b.hashes[height]
+			if !ok {
+				fork = height
+				break
+			}
+			if height > tip {
+				continue
+			}
+			current := tipHash
+			if height != tip {
+				var err error
+				if current, err = hashAt(height); err != nil {
+					return nil, fmt.Errorf("failed to get block hash at height %d: %w", height, err)
+				}
+			}
+			if current == seen {
+				fork = height
+				break
+			}
+		}
+
+		if fork < oldTip {
+			reorg = &Reorg{
+				OldTipHeight: oldTip,
+				OldTipHash:   oldTipHash.String(),
+				NewTipHeight: tip,
+				NewTipHash:   tipHash.String(),
+				ForkHeight:   fork,
+				Depth:        oldTip - fork,
+				Time:         time.Now().Unix(),
+			}
+			for height := range b.hashes {
+				if height > fork {
+					delete(b.hashes, height)
+				}
+			}
+			b.last = reorg
+		}
+	}
+
+	// Record the new blocks, at most a window's worth
+	from := max(0, tip-reorgWindow+1)
+	for height := from; height <= tip; height++ {
+		if _, ok := b.hashes[height]; ok {
+			continue
+		}
+		hash := tipHash
+		if height != tip {
+			var err error
+			if hash, err = hashAt(height); err != nil {
+				return nil, fmt.Errorf("failed to get block hash at height %d: %w", height, err)
+			}
+		}
+		b.hashes[height] = hash
+	}
+	for height := range b.hashes {
+		if height < from || height > tip {
+			delete(b.hashes, height)
+		}
+	}
+	b.tip = tip
+
+	return reorg, nil
+}
+
+// lastReorg returns the most recent reorg, or nil if none was seen.
+func (b *recentBlocks) lastReorg() *Reorg {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.last
+}
+
+// detectReorg checks the chain ending at tip for a reorg of the blocks seen
+// so far, reports it to every wallet's event stream and to reorg webhooks, and
+// unwinds the watched UTXO changes of the disconnected blocks unless the live
+// follower already does.
+func (n *Node) detectReorg(tip int32, tipHash chainhash.Hash) *Reorg {
+	reorg, err := n.recentBlocks.observe(tip, tipHash, func(height int32) (chainhash.Hash, error) {
+		hash, err := n.chainService.GetBlockHash(int64(height))
+		if err != nil {
+			return chainhash.Hash{}, err
+		}
+		return *hash, nil
+	})
+	if err != nil {
+		n.logger.Warnf("Failed to check for reorgs: %v", err)
+		return nil
+	}
+	if reorg == nil {
+		return nil
+	}
+
+	n.logger.Warnf("Reorg of %d blocks: tip %d (%s) replaced by %d (%s), fork at %d",
+		reorg.Depth, reorg.OldTipHeight, reorg.OldTipHash, reorg.NewTipHeight, reorg.NewTipHash, reorg.ForkHeight)
+	n.scanMemo.truncate(reorg.ForkHeight)
+	if n.rescanMgr != nil {
+		n.rescanMgr.emitToAllWallets(EventReorg, reorg)
+		// The live follower unwinds disconnected blocks itself
+		if !n.rescanMgr.isLive() {
+			n.rescanMgr.background(func(ctx context.Context) { n.reapplyReorg(ctx, reorg) })
+		}
+	}
+	if n.webhooks != nil {
+		n.webhooks.Dispatch(WebhookReorg, "", reorg)
+	}
+	return reorg
+}
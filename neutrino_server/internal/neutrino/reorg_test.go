@@ -0,0 +1,117 @@
+package neutrino
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// testChain returns block hashes for heights 0 through tip, where blocks
+// above fork are on a branch named by branch.
+func testChain(tip, fork int32, branch byte) map[int32]chainhash.Hash {
+	chain := make(map[int32]chainhash.Hash)
+	for height := int32(0); height <= tip; height++ {
+		var hash chainhash.Hash
+		hash[0] = byte(height)
+		hash[1] = byte(height >> 8)
+		if height > fork {
+			hash[31] = branch
+		}
+		chain[height] = hash
+	}
+	return chain
+}
+
+func TestRecentBlocksObserve(t *testing.T) {
+	tests := []struct {
+		name      string
+		chains    []map[int32]chainhash.Hash
+		tips      []int32
+		wantReorg *Reorg
+	}{
+		{
+			name:   "chain extended",
+			chains: []map[int32]chainhash.Hash{testChain(150, 150, 0), testChain(152, 152, 0)},
+			tips:   []int32{150, 152},
+		},
+		{
+			name:      "tip replaced",
+			chains:    []map[int32]chainhash.Hash{testChain(150, 150, 0), testChain(150, 149, 1)},
+			tips:      []int32{150, 150},
+			wantReorg: &Reorg{OldTipHeight: 150, NewTipHeight: 150, ForkHeight: 149, Depth: 1},
+		},
+		{
+			name:      "longer branch",
+			chains:    []map[int32]chainhash.Hash{testChain(150, 150, 0), testChain(152, 147, 1)},
+			tips:      []int32{150, 152},
+			wantReorg: &Reorg{OldTipHeight: 150, NewTipHeight: 152, ForkHeight: 147, Depth: 3},
+		},
+		{
+			name:      "shorter chain",
+			chains:    []map[int32]chainhash.Hash{testChain(150, 150, 0), testChain(148, 148, 0)},
+			tips:      []int32{150, 148},
+			wantReorg: &Reorg{OldTipHeight: 150, NewTipHeight: 148, ForkHeight: 148, Depth: 2},
+		},
+		{
+			name:      "deeper than the window",
+			chains:    []map[int32]chainhash.Hash{testChain(150, 150, 0), testChain(150, 10, 1)},
+			tips:      []int32{150, 150},
+			wantReorg: &Reorg{OldTipHeight: 150, NewTipHeight: 150, ForkHeight: 150 - reorgWindow, Depth: reorgWindow},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks := newRecentBlocks()
+
+			var reorg *Reorg
+			for i, chain := range tt.chains {
+				hashAt := func(height int32) (chainhash.Hash, error) {
+					hash, ok := chain[height]
+					if !ok {
+						return chainhash.Hash{}, errors.New("height not in chain")
+					}
+					return hash, nil
+				}
+				var err error
+				reorg, err = blocks.observe(tt.tips[i], chain[tt.tips[i]], hashAt)
+				if err != nil {
+					t.Fatalf("observe() failed: %v", err)
+				}
+				if i == 0 && reorg != nil {
+					t.Fatalf("first observe() reported a reorg: %+v", reorg)
+				}
+			}
+
+			if tt.wantReorg == nil {
+				if reorg != nil || blocks.lastReorg() != nil {
+					t.Errorf("observe() = %+v, want no reorg", reorg)
+				}
+				return
+			}
+			if reorg == nil {
+				t.Fatal("observe() reported no reorg")
+			}
+			if reorg.OldTipHeight != tt.wantReorg.OldTipHeight || reorg.NewTipHeight != tt.wantReorg.NewTipHeight ||
+				reorg.ForkHeight != tt.wantReorg.ForkHeight || reorg.Depth != tt.wantReorg.Depth {
+				t.Errorf("observe() = %+v, want %+v", reorg, tt.wantReorg)
+			}
+			oldChain, newChain := tt.chains[0], tt.chains[len(tt.chains)-1]
+			if reorg.OldTipHash != oldChain[reorg.OldTipHeight].String() || reorg.NewTipHash != newChain[reorg.NewTipHeight].String() {
+				t.Errorf("observe() tip hashes = %s -> %s", reorg.OldTipHash, reorg.NewTipHash)
+			}
+			if blocks.lastReorg() != reorg {
+				t.Error("lastReorg() is not the reported reorg")
+			}
+
+			// The new chain is remembered, so observing it again is quiet
+			again, err := blocks.observe(reorg.NewTipHeight, newChain[reorg.NewTipHeight], func(height int32) (chainhash.Hash, error) {
+				return newChain[height], nil
+			})
+			if err != nil || again != nil {
+				t.Errorf("second observe() = %+v, %v; want no reorg", again, err)
+			}
+		})
+	}
+}
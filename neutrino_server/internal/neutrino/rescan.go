@@ -4,68 +4,474 @@ Package neutrino provides UTXO scanning using compact block filters.
 package neutrino
 
 import (
+	"cmp"
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/gcs"
 	"github.com/btcsuite/btcd/btcutil/gcs/builder"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/txscript"
-	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btclog"
 	"github.com/lightninglabs/neutrino"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
 )
 
+// rescanCheckpointInterval is the number of blocks scanned between persisted
+// checkpoints. After a crash, at most this many blocks are scanned again.
+const rescanCheckpointInterval = 1000
+
+// DefaultMaxRescanJobs is the number of rescan jobs StartRescan runs at once.
+const DefaultMaxRescanJobs = 4
+
+// RescanJob is a persisted rescan of a set of addresses over a height range.
+type RescanJob struct {
+	ID               uint64   `json:"id"`
+	Addresses        []string `json:"addresses"`
+	StartHeight      int32    `json:"start_height"`
+	EndHeight        int32    `json:"end_height"`
+	CheckpointHeight int32    `json:"checkpoint_height"`
+	CreatedAt        int64    `json:"created_at"`
+}
+
 // RescanManager handles address watching and UTXO scanning.
 type RescanManager struct {
 	chainService *neutrino.ChainService
 	chainParams  *chaincfg.Params
+	store        *Store
 	logger       btclog.Logger
 
-	mu           sync.RWMutex
-	watchedAddrs map[string]btcutil.Address
-	utxoSet      map[string]UTXO // key: "txid:vout"
+	mu sync.RWMutex
+
+	// watchedScripts maps every watch entry to the scriptPubKey it matches.
+	// An entry is an address, or the scriptPubKey hex of an output with no
+	// address form.
+	watchedScripts map[string][]byte
+	utxoSet        map[string]UTXO // key: "txid:vout"
+
+	// addrWallets maps each watched address to the wallets it belongs to.
+	// Addresses without an entry belong to DefaultWallet.
+	addrWallets map[string][]string
+
+	// scripts maps the scriptPubKey hex of every P2SH/P2WSH form of a
+	// registered redeem/witness script to the script itself.
+	scripts map[string][]byte
+
+	// archivedWallets holds soft-deleted wallets, whose addresses are not
+	// scanned unless another wallet contains them. walletRetention is how
+	// long they are kept before being purged; zero keeps them forever.
+	archivedWallets map[string]ArchivedWallet
+	walletRetention time.Duration
+
+	// createdWallets holds the wallets created by CreateWallet. Other
+	// wallets exist while they contain addresses.
+	createdWallets map[string]CreatedWallet
+
+	// unwatched holds addresses removed by UnwatchAddress while rescans
+	// run, so rescans that started before the removal drop their results.
+	// It is cleared once no rescan runs.
+	unwatched map[string]bool
+
+	// scanOpts tunes filter and block fetching during scans.
+	scanOpts ScanOptions
+
+	// metrics counts scanned blocks and filter cache lookups.
+	metrics *counters
+
+	// memo remembers the ranges in which scripts matched no filters, so
+	// rescans repeated for the same addresses skip them. Set by the node.
+	memo *scanMemo
+
+	// flights shares the filter and block fetches of concurrent rescans
+	// with each other and with the node's other scans. Set by the node.
+	flights *scanFlights
+
+	// scans shares filter matches through the scan cache, if the node has
+	// one. Set by the node.
+	scans *sharedScans
+
+	// blocks fetches the blocks whose filters match, preferring the best
+	// scored peers once the node sets it.
+	blocks blockGetter
+
+	// retainBlocks keeps the watched transactions' merkle branches of every
+	// block a rescan downloads.
+	retainBlocks bool
 
 	// rescanInProgress tracks the number of active rescans (atomic).
 	// Non-zero means a rescan goroutine is running.
 	rescanInProgress atomic.Int32
+
+	// lastRescanErr holds the error returned by the most recent rescan, or
+	// nil if it succeeded. Protected by mu.
+	lastRescanErr error
+
+	// activeJobs tracks the progress of running rescan jobs and lastJob the
+	// final status of the most recently finished one. Protected by mu.
+	activeJobs []*scanProgress
+	lastJob    *RescanJobStatus
+
+	// ctx is the context of the rescan jobs run in the background, which
+	// jobs tracks. Stop cancels it, and jobs interrupted that way resume
+	// from their last checkpoint on the next start.
+	ctx    context.Context
+	cancel context.CancelFunc
+	jobs   sync.WaitGroup
+
+	// jobSlots bounds the rescan jobs started by StartRescan, which each
+	// hold a slot until they finish. Unbounded if nil.
+	jobSlots chan struct{}
+
+	// resumeMu serializes ResumeJobs, which runs at startup and again when
+	// a wallet is restored.
+	resumeMu sync.Mutex
+
+	// observers are called with every block a scan downloads, and
+	// eventObservers with every event emitted.
+	observersMu    sync.RWMutex
+	observers      []BlockObserver
+	eventObservers []EventObserver
+
+	// live follows the chain tip with neutrino's Rescan once StartLive is
+	// called, applying each block as it connects and unwinding it if it is
+	// disconnected. liveFrom is the height it started from. Protected by
+	// liveMu.
+	liveMu   sync.Mutex
+	live     *neutrino.Rescan
+	liveQuit chan struct{}
+	liveFrom int32
 }
 
-// NewRescanManager creates a new rescan manager.
-func NewRescanManager(cs *neutrino.ChainService, logger btclog.Logger) *RescanManager {
+// NewRescanManager creates a new rescan manager. If store is non-nil, watched
+// addresses and discovered UTXOs are persisted to it. Filter and block fetching
+// during scans is tuned by scanOpts.
+func NewRescanManager(cs *neutrino.ChainService, store *Store, scanOpts ScanOptions, logger btclog.Logger) *RescanManager {
 	chainParams := cs.ChainParams()
+	ctx, cancel := context.WithCancel(context.Background())
 	return &RescanManager{
-		chainService: cs,
-		chainParams:  &chainParams,
-		logger:       logger,
-		watchedAddrs: make(map[string]btcutil.Address),
-		utxoSet:      make(map[string]UTXO),
+		ctx:            ctx,
+		cancel:         cancel,
+		chainService:   cs,
+		blocks:         cs,
+		chainParams:    &chainParams,
+		store:          store,
+		scanOpts:       scanOpts,
+		logger:         logger,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
+		addrWallets:    make(map[string][]string),
+		scripts:        make(map[string][]byte),
+
+		archivedWallets: make(map[string]ArchivedWallet),
+		createdWallets:  make(map[string]CreatedWallet),
 	}
 }
 
-// WatchAddress adds an address to the watch list.
+// Restore loads watched addresses and UTXOs from the store, so a restart does
+// not require clients to rescan.
+func (r *RescanManager) Restore() error {
+	if r.store == nil {
+		return nil
+	}
+
+	records, err := r.store.WatchedAddresses()
+	if err != nil {
+		return fmt.Errorf("failed to load watched addresses: %w", err)
+	}
+
+	utxos, err := r.store.UTXOs()
+	if err != nil {
+		return fmt.Errorf("failed to load UTXOs: %w", err)
+	}
+
+	scripts, err := r.store.Scripts()
+	if err != nil {
+		return fmt.Errorf("failed to load registered scripts: %w", err)
+	}
+
+	archived, err := r.store.ArchivedWallets()
+	if err != nil {
+		return fmt.Errorf("failed to load archived wallets: %w", err)
+	}
+
+	created, err := r.store.CreatedWallets()
+	if err != nil {
+		return fmt.Errorf("failed to load created wallets: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for addrStr, record := range records {
+		_, script, err := parseWatchEntry(addrStr, r.chainParams)
+		if err != nil {
+			r.logger.Warnf("Skipping persisted watch address %s: %v", logging.KV("address", addrStr), err)
+			continue
+		}
+		r.watchedScripts[addrStr] = script
+		r.setWallets(addrStr, record.Wallets)
+		r.logger.Debugf("Restored watch address %s (scanned to height %d)", logging.KV("address", addrStr), logging.KV("height", record.ScannedHeight))
+	}
+
+	for utxoKey, utxo := range utxos {
+		r.utxoSet[utxoKey] = utxo
+	}
+
+	if r.scripts == nil {
+		r.scripts = make(map[string][]byte)
+	}
+	for pkScript, script := range scripts {
+		r.scripts[pkScript] = script
+	}
+	r.archivedWallets = archived
+	r.createdWallets = created
+
+	r.logger.Infof("Restored %d watched addresses and %d UTXOs from disk", len(records), len(utxos))
+	return nil
+}
+
+// WatchAddress adds an address to the watch list. A newly watched address
+// joins DefaultWallet.
 func (r *RescanManager) WatchAddress(addrStr string) error {
+	return r.WatchAddressInWallet(addrStr, "")
+}
+
+// WatchAddressInWallet adds an address to the watch list as part of wallet.
+// addrStr may also be a hex scriptPubKey, which is watched under its address
+// if it has one. An address may belong to several wallets; an empty wallet
+// leaves the membership of an already watched address unchanged.
+func (r *RescanManager) WatchAddressInWallet(addrStr, wallet string) error {
+	if wallet != "" {
+		if err := ValidateWalletName(wallet); err != nil {
+			return err
+		}
+		if r.isArchived(wallet) {
+			return NewBadRequestError(fmt.Sprintf("wallet %s is archived: restore it before adding addresses", wallet))
+		}
+	}
+
+	addrStr, script, err := parseWatchEntry(addrStr, r.chainParams)
+	if err != nil {
+		return err
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.watchedAddrs[addrStr]; exists {
+	_, exists := r.watchedScripts[addrStr]
+	if exists && (wallet == "" || slices.Contains(r.walletsFor(addrStr), wallet)) {
 		return nil // Already watching
 	}
 
-	addr, err := btcutil.DecodeAddress(addrStr, r.chainParams)
-	if err != nil {
-		return fmt.Errorf("invalid address %s: %w", addrStr, err)
+	var addedHeight int32
+	if r.chainService != nil {
+		if bestBlock, err := r.chainService.BestBlock(); err == nil {
+			addedHeight = bestBlock.Height
+		}
+	}
+
+	wallets := []string{DefaultWallet}
+	if exists {
+		wallets = append(slices.Clone(r.walletsFor(addrStr)), wallet)
+	} else if wallet != "" {
+		wallets = []string{wallet}
+	}
+
+	if r.store != nil {
+		if err := r.store.AddWatchedAddress(addrStr, wallets, addedHeight); err != nil {
+			return fmt.Errorf("failed to persist watch address %s: %w", addrStr, err)
+		}
 	}
 
-	r.watchedAddrs[addrStr] = addr
-	r.logger.Debugf("Added watch address: %s", addrStr)
+	r.watchedScripts[addrStr] = script
+	r.setWallets(addrStr, wallets)
+	delete(r.unwatched, addrStr)
+	if !exists {
+		r.watchLiveScript(addrStr, script, addedHeight)
+	}
+	r.logger.Debugf("Added watch address: %s (wallets %v)", logging.KV("address", addrStr), wallets)
 	return nil
 }
 
-// GetUTXOs returns UTXOs for the given addresses.
+// parseWatchEntry returns the watch entry and scriptPubKey of entry, an
+// address or a hex scriptPubKey. A script with an address form is watched as
+// that address, so both forms share one entry.
+func parseWatchEntry(entry string, params *chaincfg.Params) (string, []byte, error) {
+	if addr, err := btcutil.DecodeAddress(entry, params); err == nil {
+		script, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid address %s: %w", entry, err)
+		}
+		return entry, script, nil
+	}
+
+	script, err := hex.DecodeString(entry)
+	if err != nil || len(script) == 0 || len(script) > txscript.MaxScriptSize {
+		return "", nil, fmt.Errorf("invalid address %s: not an address or a hex scriptPubKey", entry)
+	}
+	if address, ok := scriptAddress(script, params); ok {
+		return address, script, nil
+	}
+	return hex.EncodeToString(script), script, nil
+}
+
+// scriptAddress returns the address paid by script, if it is one of the
+// single-address script types.
+func scriptAddress(script []byte, params *chaincfg.Params) (string, bool) {
+	class, addrs, _, err := txscript.ExtractPkScriptAddrs(script, params)
+	if err != nil || len(addrs) != 1 {
+		return "", false
+	}
+	switch class {
+	case txscript.PubKeyHashTy, txscript.ScriptHashTy, txscript.WitnessV0PubKeyHashTy,
+		txscript.WitnessV0ScriptHashTy, txscript.WitnessV1TaprootTy:
+		return addrs[0].EncodeAddress(), true
+	default:
+		return "", false
+	}
+}
+
+// setWallets records the wallets address belongs to. Callers must hold mu.
+func (r *RescanManager) setWallets(address string, wallets []string) {
+	if r.addrWallets == nil {
+		r.addrWallets = make(map[string][]string)
+	}
+	if len(wallets) == 0 {
+		delete(r.addrWallets, address)
+		return
+	}
+	r.addrWallets[address] = wallets
+}
+
+// WatchedAddress describes an address on the watch list.
+type WatchedAddress struct {
+	Address string   `json:"address"`
+	Wallets []string `json:"wallets"`
+
+	// AddedHeight is the chain tip when the address was first watched, and
+	// ScannedHeight how far it has been scanned (-1 if never). Both come
+	// from the store and are zero and -1 without one.
+	AddedHeight   int32 `json:"added_height"`
+	ScannedHeight int32 `json:"scanned_height"`
+}
+
+// WatchedAddresses returns the watch list ordered by address.
+func (r *RescanManager) WatchedAddresses() ([]WatchedAddress, error) {
+	var records map[string]WatchRecord
+	if r.store != nil {
+		var err error
+		records, err = r.store.WatchedAddresses()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load watched addresses: %w", err)
+		}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	watched := make([]WatchedAddress, 0, len(r.watchedScripts))
+	for address := range r.watchedScripts {
+		entry := WatchedAddress{
+			Address:       address,
+			Wallets:       r.walletsFor(address),
+			ScannedHeight: -1,
+		}
+		if record, ok := records[address]; ok {
+			entry.AddedHeight = record.AddedHeight
+			entry.ScannedHeight = record.ScannedHeight
+		}
+		watched = append(watched, entry)
+	}
+	slices.SortFunc(watched, func(a, b WatchedAddress) int { return cmp.Compare(a.Address, b.Address) })
+	return watched, nil
+}
+
+// UnwatchAddress removes an address from the watch list and from every
+// wallet, and deletes its UTXOs. Spent outpoints and indexed transactions are
+// kept.
+func (r *RescanManager) UnwatchAddress(addrStr string) error {
+	if entry, _, err := parseWatchEntry(addrStr, r.chainParams); err == nil {
+		addrStr = entry
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.watchedScripts[addrStr]; !ok {
+		return NewNotFoundError("address", fmt.Sprintf("address %s is not watched", addrStr))
+	}
+	return r.unwatchAddress(addrStr)
+}
+
+// UnwatchAddressInWallet removes an address from wallet. An address no other
+// wallet contains leaves the watch list, as with UnwatchAddress.
+func (r *RescanManager) UnwatchAddressInWallet(addrStr, wallet string) error {
+	if entry, _, err := parseWatchEntry(addrStr, r.chainParams); err == nil {
+		addrStr = entry
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.watchedScripts[addrStr]; !ok {
+		return NewNotFoundError("address", fmt.Sprintf("address %s is not watched", addrStr))
+	}
+	wallets := r.walletsFor(addrStr)
+	if !slices.Contains(wallets, wallet) {
+		return NewNotFoundError("address", fmt.Sprintf("address %s is not in wallet %s", addrStr, wallet))
+	}
+	remaining := slices.DeleteFunc(slices.Clone(wallets), func(w string) bool { return w == wallet })
+	if len(remaining) == 0 {
+		return r.unwatchAddress(addrStr)
+	}
+
+	if r.store != nil {
+		if err := r.store.AddWatchedAddress(addrStr, remaining, 0); err != nil {
+			return fmt.Errorf("failed to persist watch address %s: %w", addrStr, err)
+		}
+	}
+	r.setWallets(addrStr, remaining)
+	r.logger.Debugf("Removed watch address %s from wallet %s", logging.KV("address", addrStr), logging.KV("wallet", wallet))
+	return nil
+}
+
+// unwatchAddress removes the watched address addrStr from the watch list and
+// deletes its UTXOs. Callers must hold mu.
+func (r *RescanManager) unwatchAddress(addrStr string) error {
+	if r.store != nil {
+		if err := r.store.UnwatchAddress(addrStr); err != nil {
+			return fmt.Errorf("failed to unwatch address %s: %w", addrStr, err)
+		}
+	}
+
+	delete(r.watchedScripts, addrStr)
+	delete(r.addrWallets, addrStr)
+	removed := 0
+	for key, utxo := range r.utxoSet {
+		if utxo.Address == addrStr {
+			delete(r.utxoSet, key)
+			removed++
+		}
+	}
+	r.dropRunningResults(addrStr)
+
+	r.logger.Infof("Unwatched address %s and removed %d UTXOs", logging.KV("address", addrStr), removed)
+	return nil
+}
+
+// GetUTXOs returns UTXOs for the given addresses, ordered by height and
+// outpoint so that pages of them are stable.
 // This performs a rescan using compact block filters if needed.
 func (r *RescanManager) GetUTXOs(addresses []string) ([]UTXO, error) {
 	if r.chainService == nil {
@@ -81,8 +487,6 @@ func (r *RescanManager) GetUTXOs(addresses []string) ([]UTXO, error) {
 
 	// Collect UTXOs for the requested addresses
 	r.mu.RLock()
-	defer r.mu.RUnlock()
-
 	utxos := make([]UTXO, 0)
 	addrSet := make(map[string]bool)
 	for _, addr := range addresses {
@@ -94,71 +498,327 @@ func (r *RescanManager) GetUTXOs(addresses []string) ([]UTXO, error) {
 			utxos = append(utxos, utxo)
 		}
 	}
+	r.mu.RUnlock()
+
+	slices.SortFunc(utxos, func(a, b UTXO) int {
+		return cmp.Or(cmp.Compare(a.Height, b.Height), cmp.Compare(a.TxID, b.TxID), cmp.Compare(a.Vout, b.Vout))
+	})
+	r.annotateTimelocks(utxos)
 
 	r.logger.Debugf("GetUTXOs returning %d UTXOs for %d addresses", len(utxos), len(addresses))
 	return utxos, nil
 }
 
+// UTXOConfidence describes how complete the persisted scans behind GetUTXOs
+// are for addresses. Results are always cached as of the lowest height
+// through which every address has been scanned, and partial if a lenient
+// rescan skipped blocks for any of them.
+func (r *RescanManager) UTXOConfidence(addresses []string) *Confidence {
+	confidence := &Confidence{Level: ConfidenceCached}
+	if r.store == nil {
+		return confidence
+	}
+
+	records, err := r.store.WatchedAddresses()
+	if err != nil {
+		r.logger.Warnf("Failed to load scan state for confidence: %v", err)
+		return confidence
+	}
+
+	first := true
+	var skipped []HeightRange
+	for _, addr := range addresses {
+		record, ok := records[addr]
+		if !ok {
+			continue
+		}
+		if first || record.ScannedHeight < confidence.AsOfHeight {
+			confidence.AsOfHeight = record.ScannedHeight
+			first = false
+		}
+		skipped = append(skipped, record.SkippedRanges...)
+	}
+
+	if len(skipped) > 0 {
+		confidence.Level = ConfidencePartial
+		confidence.SkippedRanges = mergeRanges(skipped)
+	}
+	return confidence
+}
+
 // IsRescanInProgress returns true if a rescan goroutine is currently running.
 func (r *RescanManager) IsRescanInProgress() bool {
 	return r.rescanInProgress.Load() > 0
 }
 
 // Rescan triggers a rescan from the given height for specified addresses.
-// This uses neutrino's block filter-based scanning.
-func (r *RescanManager) Rescan(startHeight int32, addresses []string) error {
+// The job is driven by neutrino's Rescan, fed by the scan workers. Progress is
+// checkpointed as a rescan job so an interrupted rescan can be resumed after a restart.
+// Canceling ctx interrupts the rescan, leaving the job to be resumed.
+func (r *RescanManager) Rescan(ctx context.Context, startHeight int32, addresses []string) error {
 	if r.chainService == nil {
 		return errors.New("chain service not initialized")
 	}
 
-	// Add addresses to watch list and collect btcutil.Address objects
-	addrs := make([]btcutil.Address, 0, len(addresses))
-	for _, addrStr := range addresses {
-		if err := r.WatchAddress(addrStr); err != nil {
+	if len(addresses) == 0 {
+		r.logger.Debug("Rescan called with no addresses")
+		return nil
+	}
+
+	// The job ends at the filter tip, as blocks above it cannot be checked
+	endHeight, err := r.scanEnd(startHeight)
+	if err != nil {
+		r.setLastRescanError(err)
+		return err
+	}
+
+	job := &RescanJob{
+		Addresses:        addresses,
+		StartHeight:      startHeight,
+		EndHeight:        endHeight,
+		CheckpointHeight: startHeight - 1,
+		CreatedAt:        time.Now().Unix(),
+	}
+
+	return r.runJob(ctx, job)
+}
+
+// StartRescan runs a rescan from startHeight for addresses in the
+// background, as Rescan does. It fails with a BusyError while the maximum
+// number of jobs it started are running.
+func (r *RescanManager) StartRescan(startHeight int32, addresses []string) error {
+	// A range the filters are not synced for is refused before the job
+	// starts, so the caller learns of it
+	if r.chainService != nil {
+		if _, err := r.scanEnd(startHeight); err != nil {
 			return err
 		}
-		r.mu.RLock()
-		addr := r.watchedAddrs[addrStr]
-		r.mu.RUnlock()
-		addrs = append(addrs, addr)
 	}
+	if r.jobSlots != nil {
+		select {
+		case r.jobSlots <- struct{}{}:
+		default:
+			return NewBusyError(fmt.Sprintf("%d rescan jobs are running, try again later", cap(r.jobSlots)))
+		}
+	}
+	r.background(func(ctx context.Context) {
+		if r.jobSlots != nil {
+			defer func() { <-r.jobSlots }()
+		}
+		if err := r.Rescan(ctx, startHeight, addresses); err != nil && !errors.Is(err, context.Canceled) {
+			r.logger.Errorf("Rescan failed: %v", err)
+		}
+	})
+	return nil
+}
+
+// rescanInBackground runs a rescan from startHeight for addresses in the
+// background, as StartRescan does but without taking a job slot. It serves
+// the rescans the node starts itself, which must not be refused.
+func (r *RescanManager) rescanInBackground(startHeight int32, addresses []string) {
+	r.background(func(ctx context.Context) {
+		if err := r.Rescan(ctx, startHeight, addresses); err != nil && !errors.Is(err, context.Canceled) {
+			r.logger.Errorf("Rescan failed: %v", err)
+		}
+	})
+}
+
+// background runs fn in a goroutine Stop waits for, with the context Stop
+// cancels.
+func (r *RescanManager) background(fn func(ctx context.Context)) {
+	ctx := r.context()
+	r.jobs.Go(func() { fn(ctx) })
+}
+
+// context returns the context Stop cancels.
+func (r *RescanManager) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// Stop stops following the chain tip and interrupts the rescan jobs running
+// in the background. Wait waits for them to return.
+func (r *RescanManager) Stop() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.StopLive()
+}
 
-	if len(addrs) == 0 {
-		r.logger.Debug("Rescan called with no addresses")
+// Wait waits for the background rescan jobs interrupted by Stop to return.
+func (r *RescanManager) Wait() {
+	r.jobs.Wait()
+}
+
+// ResumeJobs resumes rescan jobs that were interrupted before completing,
+// continuing each from its last checkpoint up to the current chain tip.
+// Canceling ctx interrupts them again.
+func (r *RescanManager) ResumeJobs(ctx context.Context) error {
+	if r.store == nil || r.chainService == nil {
 		return nil
 	}
 
-	r.logger.Infof("Starting rescan from height %d for %d addresses", startHeight, len(addrs))
+	r.resumeMu.Lock()
+	defer r.resumeMu.Unlock()
+
+	jobs, err := r.store.RescanJobs()
+	if err != nil {
+		return fmt.Errorf("failed to load rescan jobs: %w", err)
+	}
+
+	for i := range jobs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		job := &jobs[i]
+		if r.jobRunning(job.ID) || len(r.activeAddresses(job.Addresses)) == 0 {
+			continue
+		}
+
+		endHeight, err := r.scanEnd(job.CheckpointHeight + 1)
+		var notSynced *FiltersNotSyncedError
+		if errors.As(err, &notSynced) {
+			r.logger.Infof("Rescan job %d waits for filters up to height %d", logging.KV("job_id", job.ID), logging.KV("height", notSynced.Height))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		job.EndHeight = endHeight
+
+		r.logger.Infof("Resuming rescan job %d from height %d to %d (originally started at %d)",
+			logging.KV("job_id", job.ID), logging.KV("height", job.CheckpointHeight+1), job.EndHeight, job.StartHeight)
+
+		if err := r.runJob(ctx, job); err != nil && !errors.Is(err, context.Canceled) {
+			r.logger.Errorf("Resumed rescan job %d failed: %v", logging.KV("job_id", job.ID), err)
+		}
+	}
+
+	return nil
+}
+
+// dropRunningResults makes the running rescans drop their results for the
+// unwatched address. Rescans started later do not scan it. r.mu must be
+// held.
+func (r *RescanManager) dropRunningResults(address string) {
+	if r.rescanInProgress.Load() == 0 {
+		return
+	}
+	if r.unwatched == nil {
+		r.unwatched = make(map[string]bool)
+	}
+	r.unwatched[address] = true
+}
+
+// endRescan marks a rescan as ended, forgetting the unwatched addresses once
+// no rescan runs, since only running rescans can hold results for them.
+func (r *RescanManager) endRescan() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rescanInProgress.Add(-1) == 0 {
+		clear(r.unwatched)
+	}
+}
+
+// runJob scans the remaining range of job and removes it once it completes.
+// Addresses of archived wallets are parked in a job of their own. A job
+// interrupted by canceling ctx is kept at its last checkpoint.
+func (r *RescanManager) runJob(ctx context.Context, job *RescanJob) error {
+	if scan, err := r.parkArchivedAddresses(job); err != nil {
+		return fmt.Errorf("failed to park rescan of archived wallets: %w", err)
+	} else if !scan {
+		r.logger.Infof("Rescan job %d paused: its addresses belong to archived wallets", logging.KV("job_id", job.ID))
+		return nil
+	}
 
 	// Mark rescan as in-progress so callers can poll /v1/rescan/status.
+	// It is marked before its addresses are watched, so addresses
+	// unwatched from then on are remembered until it ends.
 	r.rescanInProgress.Add(1)
-	defer r.rescanInProgress.Add(-1)
+	defer r.endRescan()
 
-	// Get current best block
-	bestBlock, err := r.chainService.BestBlock()
-	if err != nil {
-		return fmt.Errorf("failed to get best block: %w", err)
+	// Add addresses to watch list and collect the scripts they match
+	scriptEntries := make(map[string]string, len(job.Addresses))
+	for _, addrStr := range job.Addresses {
+		if err := r.WatchAddress(addrStr); err != nil {
+			return err
+		}
+		entry, script, err := parseWatchEntry(addrStr, r.chainParams)
+		if err != nil {
+			return err
+		}
+		scriptEntries[hex.EncodeToString(script)] = entry
 	}
 
-	// Scan blocks from startHeight to bestBlock.Height
-	return r.scanBlocks(startHeight, bestBlock.Height, addrs)
+	r.logger.Infof("Starting rescan from height %d for %d addresses", logging.KV("height", job.CheckpointHeight+1), len(scriptEntries))
+
+	var err error
+	if r.store != nil {
+		err = r.store.PutRescanJob(job)
+	}
+	var metrics *ScanMetrics
+	if err == nil {
+		// Jobs outlive the requests that start them, so each is traced
+		// from a root span of its own
+		ctx, span := tracer.Start(ctx, "rescan.job", trace.WithNewRoot(), trace.WithAttributes(
+			attribute.Int64("neutrino.job_id", int64(job.ID)),
+			attribute.Int("neutrino.addresses", len(scriptEntries)),
+			attrStartHeight.Int(int(job.CheckpointHeight+1)),
+			attrEndHeight.Int(int(job.EndHeight)),
+		))
+		progress := newScanProgress(job)
+		r.trackJob(progress)
+		err = r.scanBlocks(ctx, job, scriptEntries, progress)
+		endSpan(span, err)
+		if err == nil && r.store != nil {
+			err = r.store.DeleteRescanJob(job.ID)
+		}
+		status := r.finishJob(progress, err)
+		metrics = &status.Metrics
+	}
+	if errors.Is(err, context.Canceled) {
+		r.logger.Infof("Rescan job %d interrupted, it resumes from height %d", logging.KV("job_id", job.ID), logging.KV("height", job.CheckpointHeight+1))
+		return err
+	}
+
+	// Remember the outcome so readiness checks can report scan health
+	r.setLastRescanError(err)
+	r.emitRescanFinished(job, err, metrics)
+	return err
 }
 
-// scanBlocks scans blocks in the given range for transactions matching the addresses.
-func (r *RescanManager) scanBlocks(startHeight, endHeight int32, addrs []btcutil.Address) error {
-	r.logger.Infof("Scanning blocks %d to %d for %d addresses", startHeight, endHeight, len(addrs))
+// setLastRescanError records the outcome of the most recent rescan.
+func (r *RescanManager) setLastRescanError(err error) {
+	r.mu.Lock()
+	r.lastRescanErr = err
+	r.mu.Unlock()
+}
+
+// LastRescanError returns the error from the most recent rescan, or nil if it
+// completed successfully or no rescan has run yet.
+func (r *RescanManager) LastRescanError() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lastRescanErr
+}
+
+// scanBlocks scans the remaining range of job for transactions matching the
+// scripts of scriptEntries, which maps each scriptPubKey hex to its watch
+// entry, committing results and checkpointing the job periodically.
+func (r *RescanManager) scanBlocks(ctx context.Context, job *RescanJob, scriptEntries map[string]string, progress *scanProgress) error {
+	startHeight := job.CheckpointHeight + 1
+	endHeight := job.EndHeight
+	r.logger.Infof("Scanning blocks %d to %d for %d addresses", startHeight, endHeight, len(scriptEntries))
 
 	// Build script filters for matching
-	scripts := make([][]byte, 0, len(addrs))
-	addrToScript := make(map[string]string) // scriptHex -> address
-	for _, addr := range addrs {
-		script, err := txscript.PayToAddrScript(addr)
-		if err != nil {
-			r.logger.Warnf("Failed to create script for address %s: %v", addr.String(), err)
-			continue
-		}
+	scripts := make([][]byte, 0, len(scriptEntries))
+	scanned := make([]string, 0, len(scriptEntries))
+	for scriptHex, entry := range scriptEntries {
+		script, _ := hex.DecodeString(scriptHex)
 		scripts = append(scripts, script)
-		addrToScript[hex.EncodeToString(script)] = addr.String()
+		scanned = append(scanned, entry)
 	}
 
 	if len(scripts) == 0 {
@@ -166,99 +826,354 @@ func (r *RescanManager) scanBlocks(startHeight, endHeight int32, addrs []btcutil
 	}
 
 	// Track spent outputs to remove from UTXO set
-	spentOutputs := make(map[string]bool)
+	spentOutputs := make(map[string]Spend)
 	foundUTXOs := make(map[string]UTXO)
+	foundTxs := make(map[string]IndexedTx)
+	totalFound, totalSpent := 0, 0
 
-	// Scan each block
-	for height := startHeight; height <= endHeight; height++ {
-		// Get block hash
-		blockHash, err := r.chainService.GetBlockHash(int64(height))
-		if err != nil {
-			r.logger.Debugf("Failed to get block hash for height %d: %v", height, err)
-			continue
+	// Fetch blocks concurrently, applying them in height order and
+	// committing at every checkpoint and at the end
+	prefetch := newFilterPrefetcher(ctx, r.chainService, startHeight, endHeight, r.scanOpts.FilterBatchSize, r.logger)
+	prefetch.flights = r.flights
+	prefetch.fill = r.metrics.filterFill(r.chainService)
+	var skips skipTracker
+
+	// Heights earlier scans found none of the scripts in are not fetched,
+	// and the misses of this scan are remembered at every checkpoint
+	memoized, generation := r.memo.lookup(scripts, startHeight, endHeight)
+	var matchedHeights []int32
+
+	// Segments of the range covered by the scan cache are only matched
+	// against the scripts it has no matches of
+	plan := r.scans.newPlan(r.chainService, scripts, startHeight, endHeight)
+	fetch := func(height int32) (*btcutil.Block, *gcs.Filter) {
+		if rangesContain(memoized, height) {
+			r.metrics.scanMemoHit()
+			return nil, nil
+		}
+		prefetch.wait(height)
+		block, filter, checked := r.fetchMatchedBlock(ctx, height, scripts, plan, progress)
+		if !checked {
+			skips.add(height)
 		}
+		return block, filter
+	}
+	checkpointStart := startHeight
+	apply := func(height int32, block *btcutil.Block) error {
+		if block != nil {
+			r.processBlock(height, block, scriptEntries, foundUTXOs, spentOutputs, foundTxs)
+			matchedHeights = append(matchedHeights, height)
+		}
+		progress.height.Store(height)
+		r.metrics.scannedBlock()
 
-		// Get basic filter for this block
-		filter, err := r.chainService.GetCFilter(*blockHash, wire.GCSFilterRegular)
-		if err != nil {
-			r.logger.Debugf("Failed to get filter for block %d: %v", height, err)
-			continue
+		if height != endHeight && (height-startHeight+1)%rescanCheckpointInterval != 0 {
+			return nil
 		}
 
-		if filter == nil {
-			continue
+		// A strict scan stops before committing past a block it could not
+		// check, so the job resumes from the last complete checkpoint
+		skipped := skips.ranges(checkpointStart, height)
+		r.memo.record(generation, scripts, checkpointStart, height, matchedHeights, skipped)
+		plan.store(ctx, startHeight, height, skips.ranges(startHeight, height))
+		matchedHeights = matchedHeights[:0]
+		if len(skipped) > 0 && r.scanOpts.Mode == ScanStrict {
+			return &IncompleteScanError{Skipped: skipped}
 		}
 
-		// Check if any of our scripts match the filter
-		key := builder.DeriveKey(blockHash)
-		matched, err := filter.MatchAny(key, scripts)
-		if err != nil {
-			r.logger.Debugf("Filter match error for block %d: %v", height, err)
-			continue
+		totalFound += len(foundUTXOs)
+		totalSpent += len(spentOutputs)
+		if err := r.commitScanProgress(job, height, scanned, foundUTXOs, spentOutputs); err != nil {
+			return err
 		}
+		if r.store != nil {
+			if err := r.store.PutTransactions(foundTxs); err != nil {
+				return fmt.Errorf("failed to index transactions: %w", err)
+			}
+			checked := HeightRange{Start: checkpointStart, End: height}
+			if err := r.store.UpdateSkippedRanges(scanned, checked, skipped); err != nil {
+				return fmt.Errorf("failed to persist skipped ranges: %w", err)
+			}
+		}
+		if len(skipped) > 0 {
+			r.logger.Warnf("Rescan could not check blocks %s; results are partial", formatRanges(skipped))
+		}
+		checkpointStart = height + 1
+		clear(foundUTXOs)
+		clear(spentOutputs)
+		clear(foundTxs)
+		return nil
+	}
 
-		if !matched {
-			continue
+	chain := &neutrino.RescanChainSource{ChainService: r.chainService}
+	if err := rescanRange(ctx, chain, startHeight, endHeight, r.scanOpts.Workers, scripts, fetch, apply); err != nil {
+		return err
+	}
+
+	r.logger.Infof("Rescan complete: found %d UTXOs, %d spent", totalFound, totalSpent)
+	return nil
+}
+
+// fetchMatchedBlock matches the filter for the block at height against
+// scripts and returns the full block and its filter on a match, or nils
+// otherwise. In the segments of plan, only the scripts without cached matches
+// are matched. checked is false if the filter or block could not be fetched.
+// Fetched data is counted in progress.
+func (r *RescanManager) fetchMatchedBlock(ctx context.Context, height int32, scripts [][]byte, plan *scanPlan, progress *scanProgress) (block *btcutil.Block, filter *gcs.Filter, checked bool) {
+	// Get block hash
+	blockHash, err := r.chainService.GetBlockHash(int64(height))
+	if err != nil {
+		r.logger.Debugf("Failed to get block hash for height %d: %v", logging.KV("height", height), err)
+		return nil, nil, false
+	}
+
+	// Get basic filter for this block
+	getFilter := func() bool {
+		filter, err = shareFetch(r.flights, filterFlight(*blockHash), func() (*gcs.Filter, error) {
+			return r.metrics.getCFilter(ctx, r.chainService, *blockHash)
+		})
+		if err != nil {
+			r.logger.Debugf("Failed to get filter for block %d: %v", logging.KV("height", height), err)
+			return false
 		}
+		return filter != nil
+	}
 
-		r.logger.Debugf("Block %d filter matched, fetching full block", height)
+	// Check if any of our scripts match the filter
+	key := builder.DeriveKey(blockHash)
+	var matched bool
+	if segment := plan.segment(ctx, height); segment != nil {
+		checked = true
+		hits := plan.match(segment, height, func(missing [][]byte) []int {
+			if checked = getFilter(); !checked {
+				return nil
+			}
+			hits, err := filterMatches(filter, key, missing)
+			if err != nil {
+				r.logger.Debugf("Filter match error for block %d: %v", logging.KV("height", height), err)
+				checked = false
+			}
+			return hits
+		})
+		if !checked {
+			return nil, nil, false
+		}
 
-		// Filter matched - fetch the full block to find exact transactions
-		block, err := r.chainService.GetBlock(*blockHash)
+		// The block of a cached match is still verified against its
+		// filter by the Rescan
+		matched = len(hits) > 0
+		if matched && filter == nil && !getFilter() {
+			return nil, nil, false
+		}
+	} else {
+		if !getFilter() {
+			return nil, nil, false
+		}
+		matched, err = filter.MatchAny(key, scripts)
 		if err != nil {
-			r.logger.Warnf("Failed to get block %d: %v", height, err)
-			continue
+			r.logger.Debugf("Filter match error for block %d: %v", logging.KV("height", height), err)
+			return nil, nil, false
+		}
+	}
+
+	if filter != nil {
+		if filterBytes, err := filter.NBytes(); err == nil {
+			progress.addFilter(len(filterBytes), matched)
 		}
+	}
+	if !matched {
+		return nil, nil, true
+	}
 
-		// Scan all transactions in the block
-		for _, tx := range block.Transactions() {
-			txHash := tx.Hash().String()
+	r.logger.Debugf("Block %d filter matched, fetching full block", logging.KV("height", height))
+
+	// Filter matched - fetch the full block to find exact transactions
+	block, err = shareFetch(r.flights, blockFlight(*blockHash), func() (*btcutil.Block, error) {
+		return fetchBlock(ctx, r.blocks, *blockHash, height)
+	})
+	if err != nil {
+		r.logger.Warnf("Failed to get block %d: %v", logging.KV("height", height), err)
+		return nil, nil, false
+	}
+	progress.addBlock(block.MsgBlock().SerializeSize())
+
+	return block, filter, true
+}
 
-			// Check inputs (mark UTXOs as spent)
-			for _, txIn := range tx.MsgTx().TxIn {
-				prevOut := txIn.PreviousOutPoint
-				key := fmt.Sprintf("%s:%d", prevOut.Hash.String(), prevOut.Index)
-				spentOutputs[key] = true
+// processBlock records outputs paying the scripts of scriptEntries, which
+// maps each scriptPubKey hex to its watch entry, and every outpoint spent by
+// the block, and collects the transactions that pay a watched script or spend
+// a watched UTXO for the transaction index.
+func (r *RescanManager) processBlock(height int32, block *btcutil.Block, scriptEntries map[string]string,
+	foundUTXOs map[string]UTXO, spentOutputs map[string]Spend, foundTxs map[string]IndexedTx) {
+
+	r.NotifyBlock(height, block)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Scan all transactions in the block
+	var retained []int
+	for txIdx, tx := range block.Transactions() {
+		txHash := tx.Hash().String()
+		touchesWatched := false
+
+		// Check inputs (mark UTXOs as spent)
+		for inputIdx, txIn := range tx.MsgTx().TxIn {
+			prevOut := txIn.PreviousOutPoint
+			key := fmt.Sprintf("%s:%d", prevOut.Hash.String(), prevOut.Index)
+			spentOutputs[key] = Spend{
+				SpendingTxID:   txHash,
+				SpendingInput:  uint32(inputIdx),
+				SpendingHeight: height,
 			}
 
-			// Check outputs (find new UTXOs)
-			for vout, txOut := range tx.MsgTx().TxOut {
-				scriptHex := hex.EncodeToString(txOut.PkScript)
-				if addrStr, ok := addrToScript[scriptHex]; ok {
-					utxoKey := fmt.Sprintf("%s:%d", txHash, vout)
-					utxo := UTXO{
-						TxID:         txHash,
-						Vout:         uint32(vout),
-						Value:        txOut.Value,
-						Address:      addrStr,
-						ScriptPubKey: scriptHex,
-						Height:       height,
-					}
-					foundUTXOs[utxoKey] = utxo
-					r.logger.Infof("Found UTXO: %s:%d value=%d address=%s", txHash, vout, txOut.Value, addrStr)
+			if _, ok := foundUTXOs[key]; ok {
+				touchesWatched = true
+			} else if _, ok := r.utxoSet[key]; ok {
+				touchesWatched = true
+			}
+		}
+
+		// Check outputs (find new UTXOs)
+		for vout, txOut := range tx.MsgTx().TxOut {
+			scriptHex := hex.EncodeToString(txOut.PkScript)
+			if addrStr, ok := scriptEntries[scriptHex]; ok {
+				utxoKey := fmt.Sprintf("%s:%d", txHash, vout)
+				utxo := UTXO{
+					TxID:         txHash,
+					Vout:         uint32(vout),
+					Value:        txOut.Value,
+					Address:      addrStr,
+					ScriptPubKey: scriptHex,
+					Height:       height,
 				}
+				foundUTXOs[utxoKey] = utxo
+				touchesWatched = true
+				r.logger.Infof("Found UTXO: %s:%d value=%d address=%s", txHash, vout, txOut.Value, logging.KV("address", addrStr))
+			}
+		}
+
+		if touchesWatched {
+			retained = append(retained, txIdx)
+
+			indexed, err := newIndexedTx(tx, block, height)
+			if err != nil {
+				r.logger.Warnf("Failed to index transaction: %v", err)
+				continue
 			}
+			foundTxs[txHash] = indexed
 		}
 	}
 
-	// Update UTXO set
+	r.retainBlock(height, block, retained)
+}
+
+// AddBlockObserver registers fn to be called with every block downloaded by a
+// scan. Observers run on the scan goroutine and must not block.
+func (r *RescanManager) AddBlockObserver(fn BlockObserver) {
+	r.observersMu.Lock()
+	defer r.observersMu.Unlock()
+	r.observers = append(r.observers, fn)
+}
+
+// AddEventObserver registers fn to be called with every event emitted to a
+// wallet stream, after it has been recorded. Observers run on the emitting
+// goroutine and must not block.
+func (r *RescanManager) AddEventObserver(fn EventObserver) {
+	r.observersMu.Lock()
+	defer r.observersMu.Unlock()
+	r.eventObservers = append(r.eventObservers, fn)
+}
+
+// NotifyBlock passes an already-fetched block to every registered observer.
+func (r *RescanManager) NotifyBlock(height int32, block *btcutil.Block) {
+	r.observersMu.RLock()
+	defer r.observersMu.RUnlock()
+	for _, fn := range r.observers {
+		fn(height, block)
+	}
+}
+
+// commitScanProgress applies the UTXO changes found so far and checkpoints
+// job at height. Changes are persisted before being applied in memory, so the
+// on-disk set never trails what clients have already been served.
+func (r *RescanManager) commitScanProgress(job *RescanJob, height int32, addresses []string,
+	foundUTXOs map[string]UTXO, spentOutputs map[string]Spend) error {
+
+	job.CheckpointHeight = height
+
+	// Drop the results for addresses unwatched while the job was running
+	r.mu.RLock()
+	if len(r.unwatched) > 0 {
+		addresses = slices.DeleteFunc(slices.Clone(addresses), func(address string) bool { return r.unwatched[address] })
+		job.Addresses = slices.DeleteFunc(slices.Clone(job.Addresses), func(address string) bool { return r.unwatched[address] })
+		foundUTXOs = maps.Clone(foundUTXOs)
+		maps.DeleteFunc(foundUTXOs, func(_ string, utxo UTXO) bool { return r.unwatched[utxo.Address] })
+	}
+	undo := r.blockUndo(foundUTXOs, spentOutputs)
+	r.mu.RUnlock()
+
+	if r.store != nil {
+		if err := r.persistUTXOChanges(undo, foundUTXOs, spentOutputs); err != nil {
+			return err
+		}
+		if err := r.store.SetScannedHeight(addresses, height); err != nil {
+			return fmt.Errorf("failed to persist scanned height: %w", err)
+		}
+		if err := r.store.PutRescanJob(job); err != nil {
+			return fmt.Errorf("failed to checkpoint rescan job: %w", err)
+		}
+	}
+
+	r.applyUTXOChanges(foundUTXOs, spentOutputs)
+
+	// The live follower reports spends of UTXOs found behind its tip
+	r.watchLiveInputs(foundUTXOs)
+	return nil
+}
+
+// persistUTXOChanges stores the UTXO changes of a scan batch. Undo data is
+// written first, so an applied change can always be unwound.
+func (r *RescanManager) persistUTXOChanges(undo map[int32]BlockUndo, foundUTXOs map[string]UTXO, spentOutputs map[string]Spend) error {
+	if err := r.store.AddBlockUndo(undo); err != nil {
+		return fmt.Errorf("failed to persist block undo data: %w", err)
+	}
+	if err := r.store.ApplyUTXOChanges(foundUTXOs, spentOutputs); err != nil {
+		return fmt.Errorf("failed to persist UTXO changes: %w", err)
+	}
+	return nil
+}
+
+// applyUTXOChanges applies persisted UTXO changes to the in-memory set and
+// emits their events.
+func (r *RescanManager) applyUTXOChanges(foundUTXOs map[string]UTXO, spentOutputs map[string]Spend) {
+	var events []Event
 	r.mu.Lock()
-	defer r.mu.Unlock()
 
-	// Add new UTXOs (if not spent)
+	// Add new UTXOs, reporting them even if they were spent in the same batch
 	for utxoKey, utxo := range foundUTXOs {
-		if !spentOutputs[utxoKey] {
+		if _, known := r.utxoSet[utxoKey]; !known {
+			events = append(events, r.addressEvents(utxo.Address, EventUTXOReceived, utxo)...)
+		}
+		if _, spent := spentOutputs[utxoKey]; !spent {
 			r.utxoSet[utxoKey] = utxo
 		}
 	}
 
 	// Remove spent UTXOs
 	for utxoKey := range spentOutputs {
-		delete(r.utxoSet, utxoKey)
+		if utxo, ok := r.utxoSet[utxoKey]; ok {
+			events = append(events, r.addressEvents(utxo.Address, EventUTXOSpent, utxo)...)
+			delete(r.utxoSet, utxoKey)
+		} else if utxo, ok := foundUTXOs[utxoKey]; ok {
+			events = append(events, r.addressEvents(utxo.Address, EventUTXOSpent, utxo)...)
+		}
 	}
 
-	r.logger.Infof("Rescan complete: found %d UTXOs, %d spent", len(foundUTXOs), len(spentOutputs))
-	return nil
+	r.mu.Unlock()
+
+	r.emit(events)
 }
 
 // AddUTXO adds a UTXO to the set (for use by notification handlers).
@@ -276,6 +1191,12 @@ func (r *RescanManager) AddUTXO(txHash string, vout uint32, value int64, addrStr
 		Height:       height,
 	}
 
+	if r.store != nil {
+		if err := r.store.ApplyUTXOChanges(map[string]UTXO{utxoKey: utxo}, nil); err != nil {
+			r.logger.Warnf("Failed to persist UTXO %s: %v", utxoKey, err)
+		}
+	}
+
 	r.utxoSet[utxoKey] = utxo
 	r.logger.Debugf("Added UTXO: %s", utxoKey)
 }
@@ -286,6 +1207,12 @@ func (r *RescanManager) RemoveUTXO(txid string, vout uint32) {
 	defer r.mu.Unlock()
 
 	utxoKey := fmt.Sprintf("%s:%d", txid, vout)
+	if r.store != nil {
+		if err := r.store.ApplyUTXOChanges(nil, map[string]Spend{utxoKey: {}}); err != nil {
+			r.logger.Warnf("Failed to persist removal of UTXO %s: %v", utxoKey, err)
+		}
+	}
+
 	delete(r.utxoSet, utxoKey)
 	r.logger.Debugf("Removed UTXO: %s", utxoKey)
 }
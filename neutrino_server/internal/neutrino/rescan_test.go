@@ -1,10 +1,19 @@
 package neutrino
 
 import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btclog"
 )
 
@@ -16,18 +25,18 @@ func TestNewRescanManager(t *testing.T) {
 	logger := backend.Logger("TEST")
 
 	mgr := &RescanManager{
-		chainParams:  &chaincfg.MainNetParams,
-		logger:       logger,
-		watchedAddrs: make(map[string]btcutil.Address),
-		utxoSet:      make(map[string]UTXO),
+		chainParams:    &chaincfg.MainNetParams,
+		logger:         logger,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
 	}
 
 	if mgr.logger == nil {
 		t.Error("expected logger to be set")
 	}
 
-	if mgr.watchedAddrs == nil {
-		t.Error("expected watchedAddrs map to be initialized")
+	if mgr.watchedScripts == nil {
+		t.Error("expected watchedScripts map to be initialized")
 	}
 
 	if mgr.utxoSet == nil {
@@ -45,10 +54,10 @@ func TestWatchAddress(t *testing.T) {
 	logger := backend.Logger("TEST")
 
 	mgr := &RescanManager{
-		chainParams:  &chaincfg.MainNetParams,
-		logger:       logger,
-		watchedAddrs: make(map[string]btcutil.Address),
-		utxoSet:      make(map[string]UTXO),
+		chainParams:    &chaincfg.MainNetParams,
+		logger:         logger,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
 	}
 
 	tests := []struct {
@@ -81,8 +90,8 @@ func TestWatchAddress(t *testing.T) {
 			}
 
 			if !tt.wantError && err == nil {
-				if _, exists := mgr.watchedAddrs[tt.address]; !exists {
-					t.Error("expected address to be in watchedAddrs")
+				if _, exists := mgr.watchedScripts[tt.address]; !exists {
+					t.Error("expected address to be in watchedScripts")
 				}
 			}
 		})
@@ -95,10 +104,10 @@ func TestAddUTXO(t *testing.T) {
 	logger := backend.Logger("TEST")
 
 	mgr := &RescanManager{
-		chainParams:  &chaincfg.MainNetParams,
-		logger:       logger,
-		watchedAddrs: make(map[string]btcutil.Address),
-		utxoSet:      make(map[string]UTXO),
+		chainParams:    &chaincfg.MainNetParams,
+		logger:         logger,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
 	}
 
 	txHash := "0000000000000000000000000000000000000000000000000000000000000001"
@@ -143,10 +152,10 @@ func TestRemoveUTXO(t *testing.T) {
 	logger := backend.Logger("TEST")
 
 	mgr := &RescanManager{
-		chainParams:  &chaincfg.MainNetParams,
-		logger:       logger,
-		watchedAddrs: make(map[string]btcutil.Address),
-		utxoSet:      make(map[string]UTXO),
+		chainParams:    &chaincfg.MainNetParams,
+		logger:         logger,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
 	}
 
 	// Add a UTXO first
@@ -173,11 +182,11 @@ func TestGetUTXOs(t *testing.T) {
 	logger := backend.Logger("TEST")
 
 	mgr := &RescanManager{
-		chainService: nil,
-		chainParams:  &chaincfg.MainNetParams,
-		logger:       logger,
-		watchedAddrs: make(map[string]btcutil.Address),
-		utxoSet:      make(map[string]UTXO),
+		chainService:   nil,
+		chainParams:    &chaincfg.MainNetParams,
+		logger:         logger,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
 	}
 
 	// Add some UTXOs
@@ -250,14 +259,14 @@ func TestRescanNilChainService(t *testing.T) {
 	logger := backend.Logger("TEST")
 
 	mgr := &RescanManager{
-		chainService: nil,
-		chainParams:  &chaincfg.MainNetParams,
-		logger:       logger,
-		watchedAddrs: make(map[string]btcutil.Address),
-		utxoSet:      make(map[string]UTXO),
+		chainService:   nil,
+		chainParams:    &chaincfg.MainNetParams,
+		logger:         logger,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
 	}
 
-	err := mgr.Rescan(0, []string{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"})
+	err := mgr.Rescan(context.Background(), 0, []string{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"})
 	if err == nil {
 		t.Error("expected error when chain service is nil")
 	}
@@ -266,3 +275,307 @@ func TestRescanNilChainService(t *testing.T) {
 		t.Errorf("expected 'chain service not initialized', got '%s'", err.Error())
 	}
 }
+
+// TestStartRescanBusy tests that StartRescan refuses jobs while every job
+// slot is held, and frees the slot of a job once it finishes.
+func TestStartRescanBusy(t *testing.T) {
+	mgr := &RescanManager{
+		chainParams:    &chaincfg.MainNetParams,
+		logger:         btclog.Disabled,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
+		jobSlots:       make(chan struct{}, 1),
+	}
+	address := "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+
+	mgr.jobSlots <- struct{}{}
+	var busy *BusyError
+	if err := mgr.StartRescan(0, []string{address}); !errors.As(err, &busy) {
+		t.Fatalf("StartRescan() with every slot held = %v, want a BusyError", err)
+	}
+	<-mgr.jobSlots
+
+	// Without a chain service the job fails at once, releasing its slot
+	if err := mgr.StartRescan(0, []string{address}); err != nil {
+		t.Fatalf("StartRescan() = %v", err)
+	}
+	select {
+	case mgr.jobSlots <- struct{}{}:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the finished job did not release its slot")
+	}
+}
+
+// TestCommitScanProgress tests that checkpoints apply UTXO changes and persist
+// the job so an interrupted rescan can resume from the checkpoint.
+func TestCommitScanProgress(t *testing.T) {
+	store := newTestStore(t)
+
+	mgr := &RescanManager{
+		chainParams:    &chaincfg.MainNetParams,
+		store:          store,
+		logger:         btclog.Disabled,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
+	}
+
+	address := "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	job := &RescanJob{Addresses: []string{address}, StartHeight: 0, EndHeight: 2500, CheckpointHeight: -1}
+	if err := store.PutRescanJob(job); err != nil {
+		t.Fatalf("PutRescanJob() failed: %v", err)
+	}
+
+	// First checkpoint finds two UTXOs
+	found := map[string]UTXO{
+		"tx1:0": {TxID: "tx1", Vout: 0, Value: 1000, Address: address, Height: 10},
+		"tx2:0": {TxID: "tx2", Vout: 0, Value: 2000, Address: address, Height: 20},
+	}
+	if err := mgr.commitScanProgress(job, 999, []string{address}, found, map[string]Spend{}); err != nil {
+		t.Fatalf("commitScanProgress() failed: %v", err)
+	}
+
+	// Second checkpoint spends one of them
+	if err := mgr.commitScanProgress(job, 1999, []string{address}, map[string]UTXO{}, map[string]Spend{"tx1:0": {}}); err != nil {
+		t.Fatalf("commitScanProgress() failed: %v", err)
+	}
+
+	if len(mgr.utxoSet) != 1 {
+		t.Errorf("expected 1 UTXO in memory, got %d", len(mgr.utxoSet))
+	}
+
+	utxos, err := store.UTXOs()
+	if err != nil {
+		t.Fatalf("UTXOs() failed: %v", err)
+	}
+	if _, ok := utxos["tx2:0"]; !ok || len(utxos) != 1 {
+		t.Errorf("expected only tx2:0 persisted, got %v", utxos)
+	}
+
+	jobs, err := store.RescanJobs()
+	if err != nil {
+		t.Fatalf("RescanJobs() failed: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].CheckpointHeight != 1999 {
+		t.Errorf("expected job checkpointed at 1999, got %+v", jobs)
+	}
+
+	records, err := store.WatchedAddresses()
+	if err != nil {
+		t.Fatalf("WatchedAddresses() failed: %v", err)
+	}
+	if records[address].ScannedHeight != 1999 {
+		t.Errorf("expected scanned height 1999, got %d", records[address].ScannedHeight)
+	}
+}
+
+func TestUnwatchAddress(t *testing.T) {
+	store := newTestStore(t)
+	mgr := &RescanManager{
+		chainParams:    &chaincfg.MainNetParams,
+		store:          store,
+		logger:         btclog.Disabled,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
+	}
+
+	kept := "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	removed := "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S"
+	for _, address := range []string{kept, removed} {
+		if err := mgr.WatchAddressInWallet(address, "shop"); err != nil {
+			t.Fatalf("WatchAddressInWallet(%s) failed: %v", address, err)
+		}
+	}
+
+	job := &RescanJob{Addresses: []string{kept, removed}, CheckpointHeight: -1}
+	found := map[string]UTXO{
+		"tx1:0": {TxID: "tx1", Vout: 0, Value: 1000, Address: kept, Height: 10},
+		"tx2:0": {TxID: "tx2", Vout: 0, Value: 2000, Address: removed, Height: 11},
+	}
+	if err := mgr.commitScanProgress(job, 999, job.Addresses, found, map[string]Spend{}); err != nil {
+		t.Fatalf("commitScanProgress() failed: %v", err)
+	}
+	removedOnly := &RescanJob{Addresses: []string{removed}, CheckpointHeight: -1}
+	if err := store.PutRescanJob(removedOnly); err != nil {
+		t.Fatalf("PutRescanJob() failed: %v", err)
+	}
+
+	var notFoundErr *NotFoundError
+	if err := mgr.UnwatchAddress("1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"); !errors.As(err, &notFoundErr) {
+		t.Errorf("UnwatchAddress() of an unwatched address error = %v, want NotFoundError", err)
+	}
+	// The job is still running when the address is removed
+	mgr.rescanInProgress.Add(1)
+	if err := mgr.UnwatchAddress(removed); err != nil {
+		t.Fatalf("UnwatchAddress() failed: %v", err)
+	}
+
+	watched, err := mgr.WatchedAddresses()
+	if err != nil {
+		t.Fatalf("WatchedAddresses() failed: %v", err)
+	}
+	if len(watched) != 1 || watched[0].Address != kept || watched[0].ScannedHeight != 999 {
+		t.Errorf("WatchedAddresses() = %+v, want only %s scanned to 999", watched, kept)
+	}
+	if _, ok := mgr.utxoSet["tx2:0"]; ok {
+		t.Error("UTXO of the unwatched address was kept in memory")
+	}
+
+	utxos, err := store.UTXOs()
+	if err != nil {
+		t.Fatalf("UTXOs() failed: %v", err)
+	}
+	if _, ok := utxos["tx2:0"]; ok || len(utxos) != 1 {
+		t.Errorf("persisted UTXOs = %v, want only tx1:0", utxos)
+	}
+
+	jobs, err := store.RescanJobs()
+	if err != nil {
+		t.Fatalf("RescanJobs() failed: %v", err)
+	}
+	if len(jobs) != 1 || !reflect.DeepEqual(jobs[0].Addresses, []string{kept}) {
+		t.Errorf("persisted jobs = %+v, want one job for %s", jobs, kept)
+	}
+
+	// A scan that started before the removal does not bring it back
+	late := map[string]UTXO{"tx3:0": {TxID: "tx3", Vout: 0, Value: 3000, Address: removed, Height: 1500}}
+	if err := mgr.commitScanProgress(job, 1999, []string{kept, removed}, late, map[string]Spend{}); err != nil {
+		t.Fatalf("commitScanProgress() failed: %v", err)
+	}
+	records, err := store.WatchedAddresses()
+	if err != nil {
+		t.Fatalf("WatchedAddresses() failed: %v", err)
+	}
+	if _, ok := records[removed]; ok {
+		t.Error("late checkpoint persisted the unwatched address again")
+	}
+	if _, ok := mgr.utxoSet["tx3:0"]; ok {
+		t.Error("late checkpoint kept a UTXO of the unwatched address")
+	}
+
+	// Watching the address again accepts its results
+	if err := mgr.WatchAddress(removed); err != nil {
+		t.Fatalf("WatchAddress() failed: %v", err)
+	}
+	if err := mgr.commitScanProgress(job, 2999, []string{removed}, late, map[string]Spend{}); err != nil {
+		t.Fatalf("commitScanProgress() failed: %v", err)
+	}
+	if _, ok := mgr.utxoSet["tx3:0"]; !ok {
+		t.Error("UTXO of a re-watched address was dropped")
+	}
+
+	// Removals are forgotten once no rescan runs, and not recorded then
+	if err := mgr.UnwatchAddress(removed); err != nil {
+		t.Fatalf("UnwatchAddress() failed: %v", err)
+	}
+	mgr.endRescan()
+	if err := mgr.UnwatchAddress(kept); err != nil {
+		t.Fatalf("UnwatchAddress() failed: %v", err)
+	}
+	if len(mgr.unwatched) != 0 {
+		t.Errorf("unwatched addresses = %v with no rescan running, want none", mgr.unwatched)
+	}
+}
+
+func TestWatchScriptPubKey(t *testing.T) {
+	store := newTestStore(t)
+	mgr := &RescanManager{
+		chainParams:    &chaincfg.MainNetParams,
+		store:          store,
+		logger:         btclog.Disabled,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
+	}
+
+	// 1-of-1 bare multisig has no address form
+	bareMultisig := "51210279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f8179851ae"
+	p2wpkh := "0014751e76e8199196d454941c45d1b3a323f1433bd6"
+
+	tests := []struct {
+		name      string
+		entry     string
+		wantEntry string
+		wantErr   bool
+	}{
+		{"address", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", false},
+		{"script with an address", p2wpkh, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", false},
+		{"bare multisig", bareMultisig, bareMultisig, false},
+		{"uppercase hex", strings.ToUpper(bareMultisig), bareMultisig, false},
+		{"garbage", "not an address", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, _, err := parseWatchEntry(tt.entry, &chaincfg.MainNetParams)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseWatchEntry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if entry != tt.wantEntry {
+				t.Errorf("parseWatchEntry() = %s, want %s", entry, tt.wantEntry)
+			}
+		})
+	}
+
+	if err := mgr.WatchAddress(bareMultisig); err != nil {
+		t.Fatalf("WatchAddress() failed: %v", err)
+	}
+
+	script, _ := hex.DecodeString(bareMultisig)
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{0x01}, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(5000, script))
+	msgBlock := wire.NewMsgBlock(wire.NewBlockHeader(1, &chainhash.Hash{}, &chainhash.Hash{}, 0, 0))
+	if err := msgBlock.AddTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	foundUTXOs := make(map[string]UTXO)
+	scriptEntries := map[string]string{bareMultisig: bareMultisig}
+	mgr.processBlock(100, btcutil.NewBlock(msgBlock), scriptEntries, foundUTXOs, make(map[string]Spend), make(map[string]IndexedTx))
+	utxo, ok := foundUTXOs[tx.TxHash().String()+":0"]
+	if !ok || utxo.Address != bareMultisig || utxo.ScriptPubKey != bareMultisig {
+		t.Errorf("processBlock() found %+v, want the bare multisig output", foundUTXOs)
+	}
+
+	// The script survives a restart
+	restored := &RescanManager{
+		chainParams:    &chaincfg.MainNetParams,
+		store:          store,
+		logger:         btclog.Disabled,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
+	}
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+	if !bytes.Equal(restored.watchedScripts[bareMultisig], script) {
+		t.Errorf("restored script = %x, want %s", restored.watchedScripts[bareMultisig], bareMultisig)
+	}
+
+	if err := mgr.UnwatchAddress(strings.ToUpper(bareMultisig)); err != nil {
+		t.Fatalf("UnwatchAddress() failed: %v", err)
+	}
+	if len(mgr.watchedScripts) != 0 {
+		t.Errorf("watched scripts after unwatching = %v", mgr.watchedScripts)
+	}
+}
+
+// TestRescanManagerStop tests that Stop cancels the context of background
+// jobs and Wait returns once they do.
+func TestRescanManagerStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	mgr := &RescanManager{ctx: ctx, cancel: cancel, logger: btclog.Disabled}
+
+	started := make(chan struct{})
+	var jobErr error
+	mgr.background(func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		jobErr = ctx.Err()
+	})
+	<-started
+
+	mgr.Stop()
+	mgr.Wait()
+	if !errors.Is(jobErr, context.Canceled) {
+		t.Errorf("job context error = %v, want context.Canceled", jobErr)
+	}
+}
@@ -0,0 +1,227 @@
+package neutrino
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+const (
+	// DefaultRetentionMaxBytes bounds the retained block data when block
+	// retention is enabled without an explicit limit.
+	DefaultRetentionMaxBytes = 64 << 20
+
+	// retentionPruneInterval is how often retained blocks are pruned back
+	// under the configured limit.
+	retentionPruneInterval = 10 * time.Minute
+)
+
+// RetentionConfig controls retention of the parts of scanned blocks that
+// touch the watch set.
+type RetentionConfig struct {
+	// Enabled turns on retention for blocks downloaded by rescans.
+	Enabled bool
+
+	// MaxBytes bounds the stored size of retained blocks. The oldest blocks
+	// are pruned first. Zero selects DefaultRetentionMaxBytes.
+	MaxBytes int64
+}
+
+// RetainedBlock is what is kept of a block that confirmed transactions
+// touching watched addresses: its header and, for each such transaction, the
+// merkle branch proving its inclusion. The transactions themselves are kept
+// in the transaction index.
+type RetainedBlock struct {
+	Hash    string       `json:"hash"`
+	Height  int32        `json:"height"`
+	Header  string       `json:"header"`
+	TxCount int          `json:"tx_count"`
+	Txs     []RetainedTx `json:"txs"`
+}
+
+// RetainedTx locates a transaction within its retained block.
+type RetainedTx struct {
+	TxID         string   `json:"txid"`
+	Index        int      `json:"index"`
+	MerkleBranch []string `json:"merkle_branch"`
+}
+
+// TxProof is a merkle inclusion proof for a transaction. Hashing the txid
+// with each branch hash in turn, on the side given by the bits of TxIndex
+// from the least significant, yields the merkle root in BlockHeader.
+type TxProof struct {
+	TxID         string   `json:"txid"`
+	BlockHash    string   `json:"block_hash"`
+	BlockHeight  int32    `json:"block_height"`
+	BlockHeader  string   `json:"block_header"`
+	MerkleRoot   string   `json:"merkle_root"`
+	TxIndex      int      `json:"tx_index"`
+	TxCount      int      `json:"tx_count"`
+	MerkleBranch []string `json:"merkle_branch"`
+}
+
+// newRetainedBlock keeps the header of block and the merkle branches of the
+// transactions at indices.
+func newRetainedBlock(block *btcutil.Block, height int32, indices []int) (RetainedBlock, error) {
+	var header bytes.Buffer
+	if err := block.MsgBlock().Header.Serialize(&header); err != nil {
+		return RetainedBlock{}, fmt.Errorf("failed to serialize header of block %s: %w", block.Hash(), err)
+	}
+
+	txs := block.Transactions()
+	tree := blockchain.BuildMerkleTreeStore(txs, false)
+
+	retained := RetainedBlock{
+		Hash:    block.Hash().String(),
+		Height:  height,
+		Header:  hex.EncodeToString(header.Bytes()),
+		TxCount: len(txs),
+		Txs:     make([]RetainedTx, 0, len(indices)),
+	}
+	for _, index := range indices {
+		retained.Txs = append(retained.Txs, RetainedTx{
+			TxID:         txs[index].Hash().String(),
+			Index:        index,
+			MerkleBranch: merkleBranch(tree, len(txs), index),
+		})
+	}
+	return retained, nil
+}
+
+// merkleBranch returns the sibling hashes on the path from leaf index to the
+// root of tree, as laid out by blockchain.BuildMerkleTreeStore for numTxs
+// transactions. A missing right sibling means the node was paired with
+// itself.
+func merkleBranch(tree []*chainhash.Hash, numTxs, index int) []string {
+	width := 1
+	for width < numTxs {
+		width <<= 1
+	}
+
+	var branch []string
+	for offset := 0; width > 1; width >>= 1 {
+		sibling := tree[offset+(index^1)]
+		if sibling == nil {
+			sibling = tree[offset+index]
+		}
+		branch = append(branch, sibling.String())
+		offset += width
+		index >>= 1
+	}
+	return branch
+}
+
+// retainBlock stores the watched transactions at indices of block, if block
+// retention is enabled.
+func (r *RescanManager) retainBlock(height int32, block *btcutil.Block, indices []int) {
+	if !r.retainBlocks || r.store == nil || len(indices) == 0 {
+		return
+	}
+
+	retained, err := newRetainedBlock(block, height, indices)
+	if err == nil {
+		err = r.store.PutRetainedBlock(retained)
+	}
+	if err != nil {
+		r.logger.Warnf("Failed to retain block %d: %v", logging.KV("height", height), err)
+	}
+}
+
+// pruneRetainedBlocks periodically prunes retained blocks, oldest first,
+// until they fit in the configured limit.
+func (n *Node) pruneRetainedBlocks() {
+	maxBytes := n.config.Retention.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultRetentionMaxBytes
+	}
+
+	ticker := time.NewTicker(retentionPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		pruned, err := n.store.PruneRetainedBlocks(maxBytes)
+		if err != nil {
+			n.logger.Warnf("Failed to prune retained blocks: %v", err)
+		} else if pruned > 0 {
+			n.logger.Infof("Pruned %d retained blocks to stay under %d bytes", pruned, maxBytes)
+		}
+		select {
+		case <-n.lifetime.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GetTxProof returns a merkle inclusion proof for txid from retained block
+// data. It never downloads blocks, and returns a NotFoundError if the
+// transaction is not indexed or its block has not been retained or has been
+// pruned.
+func (n *Node) GetTxProof(txid string) (*TxProof, error) {
+	if n.store == nil {
+		return nil, errors.New("store not initialized")
+	}
+
+	hash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		return nil, NewBadRequestError(fmt.Sprintf("invalid txid: %v", err))
+	}
+
+	indexed, found, err := n.store.Transaction(hash.String())
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, NewNotFoundError("transaction", fmt.Sprintf("transaction %s is not indexed", txid))
+	}
+
+	blockHash, err := chainhash.NewHashFromStr(indexed.BlockHash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid indexed block hash: %w", err)
+	}
+	block, found, err := n.store.RetainedBlock(indexed.BlockHeight, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, NewNotFoundError("block", fmt.Sprintf("block %s is not retained", indexed.BlockHash))
+	}
+
+	for _, tx := range block.Txs {
+		if tx.TxID != hash.String() {
+			continue
+		}
+
+		header, err := hex.DecodeString(block.Header)
+		if err != nil || len(header) < 68 {
+			return nil, fmt.Errorf("invalid retained header for block %s", block.Hash)
+		}
+		// The merkle root follows the 4-byte version and 32-byte previous
+		// block hash
+		root, err := chainhash.NewHash(header[36:68])
+		if err != nil {
+			return nil, err
+		}
+
+		return &TxProof{
+			TxID:         tx.TxID,
+			BlockHash:    block.Hash,
+			BlockHeight:  block.Height,
+			BlockHeader:  block.Header,
+			MerkleRoot:   root.String(),
+			TxIndex:      tx.Index,
+			TxCount:      block.TxCount,
+			MerkleBranch: tx.MerkleBranch,
+		}, nil
+	}
+
+	return nil, NewNotFoundError("transaction", fmt.Sprintf("transaction %s is not retained in block %s", txid, block.Hash))
+}
@@ -0,0 +1,205 @@
+package neutrino
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+)
+
+// retentionTestBlock builds a block of n distinct transactions, the first
+// paying pkScript, with a valid merkle root.
+func retentionTestBlock(t *testing.T, n int, pkScript []byte) *btcutil.Block {
+	t.Helper()
+
+	msgBlock := wire.NewMsgBlock(wire.NewBlockHeader(1, &chainhash.Hash{}, &chainhash.Hash{}, 0, uint32(n)))
+	for i := 0; i < n; i++ {
+		script := []byte{txscript.OP_TRUE}
+		if i == 0 {
+			script = pkScript
+		}
+		tx := wire.NewMsgTx(2)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{byte(n), byte(i)}, 0), nil, nil))
+		tx.AddTxOut(wire.NewTxOut(1000, script))
+		if err := msgBlock.AddTransaction(tx); err != nil {
+			t.Fatalf("failed to add transaction: %v", err)
+		}
+	}
+
+	block := btcutil.NewBlock(msgBlock)
+	tree := blockchain.BuildMerkleTreeStore(block.Transactions(), false)
+	msgBlock.Header.MerkleRoot = *tree[len(tree)-1]
+	return btcutil.NewBlock(msgBlock)
+}
+
+// foldMerkleBranch recomputes the merkle root from a transaction and its
+// branch.
+func foldMerkleBranch(t *testing.T, txid string, index int, branch []string) chainhash.Hash {
+	t.Helper()
+
+	current, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range branch {
+		sibling, err := chainhash.NewHashFromStr(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var next chainhash.Hash
+		if index&1 == 0 {
+			next = blockchain.HashMerkleBranches(current, sibling)
+		} else {
+			next = blockchain.HashMerkleBranches(sibling, current)
+		}
+		current = &next
+		index >>= 1
+	}
+	return *current
+}
+
+func TestMerkleBranch(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		block := retentionTestBlock(t, n, []byte{txscript.OP_TRUE})
+		txs := block.Transactions()
+		tree := blockchain.BuildMerkleTreeStore(txs, false)
+
+		for index := range txs {
+			t.Run(fmt.Sprintf("%d of %d", index, n), func(t *testing.T) {
+				branch := merkleBranch(tree, n, index)
+				root := foldMerkleBranch(t, txs[index].Hash().String(), index, branch)
+				if root != block.MsgBlock().Header.MerkleRoot {
+					t.Errorf("branch folds to %s, want merkle root %s", root, block.MsgBlock().Header.MerkleRoot)
+				}
+			})
+		}
+	}
+}
+
+func TestBlockRetention(t *testing.T) {
+	store := newTestStore(t)
+	mgr := &RescanManager{
+		chainParams:    &chaincfg.MainNetParams,
+		store:          store,
+		logger:         btclog.Disabled,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
+		retainBlocks:   true,
+	}
+	node := &Node{store: store, chainParams: &chaincfg.MainNetParams}
+
+	addr, err := btcutil.DecodeAddress("1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("failed to decode address: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("failed to create script: %v", err)
+	}
+	addrToScript := map[string]string{hex.EncodeToString(pkScript): addr.String()}
+
+	block := retentionTestBlock(t, 5, pkScript)
+	watched := block.Transactions()[0].Hash().String()
+	unrelated := block.Transactions()[3].Hash().String()
+
+	foundTxs := make(map[string]IndexedTx)
+	mgr.processBlock(100, block, addrToScript, make(map[string]UTXO), make(map[string]Spend), foundTxs)
+	if err := store.PutTransactions(foundTxs); err != nil {
+		t.Fatalf("PutTransactions() failed: %v", err)
+	}
+
+	proof, err := node.GetTxProof(watched)
+	if err != nil {
+		t.Fatalf("GetTxProof() failed: %v", err)
+	}
+	if proof.BlockHeight != 100 || proof.BlockHash != block.Hash().String() || proof.TxCount != 5 || proof.TxIndex != 0 {
+		t.Errorf("unexpected proof: %+v", proof)
+	}
+	if proof.MerkleRoot != block.MsgBlock().Header.MerkleRoot.String() {
+		t.Errorf("proof merkle root %s, want %s", proof.MerkleRoot, block.MsgBlock().Header.MerkleRoot)
+	}
+	if root := foldMerkleBranch(t, proof.TxID, proof.TxIndex, proof.MerkleBranch); root.String() != proof.MerkleRoot {
+		t.Errorf("proof branch folds to %s, want %s", root, proof.MerkleRoot)
+	}
+
+	var notFound *NotFoundError
+	if _, err := node.GetTxProof(unrelated); !errors.As(err, &notFound) {
+		t.Errorf("GetTxProof(unrelated) error = %v, want NotFoundError", err)
+	}
+
+	// Without retention the transaction is still indexed but has no proof
+	mgr.retainBlocks = false
+	other := retentionTestBlock(t, 2, pkScript)
+	foundTxs = make(map[string]IndexedTx)
+	mgr.processBlock(101, other, addrToScript, make(map[string]UTXO), make(map[string]Spend), foundTxs)
+	if err := store.PutTransactions(foundTxs); err != nil {
+		t.Fatalf("PutTransactions() failed: %v", err)
+	}
+	if _, err := node.GetTxProof(other.Transactions()[0].Hash().String()); !errors.As(err, &notFound) {
+		t.Errorf("GetTxProof() without retention error = %v, want NotFoundError", err)
+	}
+}
+
+func TestPruneRetainedBlocks(t *testing.T) {
+	store := newTestStore(t)
+
+	var heights []int32
+	for height := int32(3); height >= 1; height-- {
+		block := retentionTestBlock(t, int(height)+1, []byte{txscript.OP_TRUE})
+		retained, err := newRetainedBlock(block, height, []int{0})
+		if err != nil {
+			t.Fatalf("newRetainedBlock() failed: %v", err)
+		}
+		if err := store.PutRetainedBlock(retained); err != nil {
+			t.Fatalf("PutRetainedBlock() failed: %v", err)
+		}
+		heights = append(heights, height)
+	}
+
+	retainedHeights := func() []int32 {
+		var got []int32
+		err := store.forEach(retainedBlocksBucket, func(k, v []byte) error {
+			got = append(got, int32(binary.BigEndian.Uint32(k)))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to list retained blocks: %v", err)
+		}
+		return got
+	}
+	if got := retainedHeights(); len(got) != len(heights) {
+		t.Fatalf("expected %d retained blocks, got %v", len(heights), got)
+	}
+
+	// A generous limit prunes nothing
+	if pruned, err := store.PruneRetainedBlocks(1 << 20); err != nil || pruned != 0 {
+		t.Fatalf("PruneRetainedBlocks() = %d, %v; want 0, nil", pruned, err)
+	}
+
+	// A tighter limit drops the oldest blocks first
+	if pruned, err := store.PruneRetainedBlocks(1000); err != nil || pruned == 0 {
+		t.Fatalf("PruneRetainedBlocks() = %d, %v; want pruning", pruned, err)
+	}
+	got := retainedHeights()
+	if len(got) == 0 || got[len(got)-1] != 3 {
+		t.Errorf("expected the newest block to survive pruning, got %v", got)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i] < got[i-1] {
+			t.Errorf("retained blocks out of height order: %v", got)
+		}
+	}
+
+	if pruned, err := store.PruneRetainedBlocks(1); err != nil || pruned != len(got) {
+		t.Errorf("PruneRetainedBlocks(1) = %d, %v; want %d, nil", pruned, err, len(got))
+	}
+}
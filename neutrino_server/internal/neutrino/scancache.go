@@ -0,0 +1,292 @@
+package neutrino
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcutil/gcs"
+	"github.com/btcsuite/btcd/btcutil/gcs/builder"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btclog"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// scanCacheSegment is the size of the aligned height ranges whose filter
+// matches scans cache for each script. Only segments a scan covers whole are
+// cached, so that scans of overlapping ranges share them.
+const scanCacheSegment = 1000
+
+// ScanCache stores the results of filter scans, shared by the nodes using
+// the same cache. See the scancache package for implementations.
+type ScanCache interface {
+	// Get returns the values stored under keys, nil for keys without one.
+	Get(ctx context.Context, keys []string) ([][]byte, error)
+
+	// Set stores values under their keys.
+	Set(ctx context.Context, values map[string][]byte) error
+}
+
+// scanCacheWindow is the number of segments whose cached matches a scan reads
+// in one batch, when it first reaches one of them.
+const scanCacheWindow = 100
+
+// scanCacheKey returns the key caching the heights whose filters match
+// script in the segment ending with the block endHash. A reorg changes the
+// hash, so matches of replaced blocks are never read.
+func scanCacheKey(endHash *chainhash.Hash, script []byte) string {
+	return fmt.Sprintf("neutrinod:filter-matches:%s:%x", endHash, sha256.Sum256(script))
+}
+
+// blockHasher looks up the hashes of the blocks ending cache segments.
+type blockHasher interface {
+	GetBlockHash(height int64) (*chainhash.Hash, error)
+}
+
+// sharedScans shares the filter matches of the scans of a node and its
+// rescan jobs through a ScanCache.
+type sharedScans struct {
+	cache   ScanCache
+	metrics *counters
+	logger  btclog.Logger
+}
+
+// cacheSegment is a segment whole in the range of a scan, and what the scan
+// cache holds of it.
+type cacheSegment struct {
+	start, end int32
+	endHash    *chainhash.Hash
+
+	// cached maps the heights the scripts with cached matches match at to
+	// their indexes, and missing holds the indexes of the other scripts.
+	cached  map[int32][]int
+	missing []int
+
+	// hits holds the indexes of the missing scripts matching at each height
+	// from start, written by the worker fetching the height. It is dropped
+	// once stored, when the scan is past the segment.
+	hits   [][]int
+	stored bool
+}
+
+// scanPlan is how a scan of scripts uses the scan cache: the segments its
+// range covers whole are only matched against the scripts the cache has no
+// matches of, matched one by one to be cached. Segments are planned a window
+// at a time, as the scan reaches them.
+type scanPlan struct {
+	shared  *sharedScans
+	chain   blockHasher
+	scripts [][]byte
+
+	// first and last are the starts of the first and last segments the
+	// range covers whole; first is past last if it covers none.
+	first, last int32
+
+	mu       sync.Mutex
+	segments map[int32]*cacheSegment
+}
+
+// newPlan returns the plan of a scan of startHeight through endHeight of
+// chain for scripts, or nil if s is, since there is no cache to use.
+func (s *sharedScans) newPlan(chain blockHasher, scripts [][]byte, startHeight, endHeight int32) *scanPlan {
+	if s == nil {
+		return nil
+	}
+	return &scanPlan{
+		shared:   s,
+		chain:    chain,
+		scripts:  scripts,
+		first:    (startHeight + scanCacheSegment - 1) / scanCacheSegment * scanCacheSegment,
+		last:     (endHeight+1)/scanCacheSegment*scanCacheSegment - scanCacheSegment,
+		segments: make(map[int32]*cacheSegment),
+	}
+}
+
+// segment returns the segment holding height, planning its window if it is
+// the first reached, or nil if the range does not cover it whole or p is
+// nil.
+func (p *scanPlan) segment(ctx context.Context, height int32) *cacheSegment {
+	if p == nil || height < p.first || height >= p.last+scanCacheSegment {
+		return nil
+	}
+	start := height / scanCacheSegment * scanCacheSegment
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if segment, ok := p.segments[start]; ok {
+		return segment
+	}
+	windowSize := int32(scanCacheWindow * scanCacheSegment)
+	p.planWindow(ctx, p.first+(start-p.first)/windowSize*windowSize)
+	return p.segments[start]
+}
+
+// planWindow reads the cached matches of the scripts in the window of
+// segments from first. A cache that cannot be read leaves every segment to
+// scan. p.mu must be held.
+func (p *scanPlan) planWindow(ctx context.Context, first int32) {
+	var window []*cacheSegment
+	var keys []string
+	for start := first; start <= p.last && len(window) < scanCacheWindow; start += scanCacheSegment {
+		segment := &cacheSegment{start: start, end: start + scanCacheSegment - 1, cached: make(map[int32][]int)}
+		hash, err := p.chain.GetBlockHash(int64(segment.end))
+		if err != nil {
+			p.shared.logger.Debugf("Failed to get block hash for height %d: %v", logging.KV("height", segment.end), err)
+		} else {
+			segment.endHash = hash
+			for _, script := range p.scripts {
+				keys = append(keys, scanCacheKey(hash, script))
+			}
+		}
+		window = append(window, segment)
+		p.segments[start] = segment
+	}
+
+	var values [][]byte
+	var err error
+	if len(keys) > 0 {
+		values, err = p.shared.cache.Get(ctx, keys)
+		if err == nil && len(values) != len(keys) {
+			err = fmt.Errorf("read %d values for %d keys", len(values), len(keys))
+		}
+	}
+	if err != nil {
+		p.shared.logger.Warnf("Failed to read the scan cache: %v", err)
+		values = make([][]byte, len(keys))
+	}
+	for _, segment := range window {
+		for i := range p.scripts {
+			if segment.endHash == nil {
+				segment.missing = append(segment.missing, i)
+				continue
+			}
+			value := values[0]
+			values = values[1:]
+			var heights []int32
+			if value == nil || json.Unmarshal(value, &heights) != nil {
+				p.shared.metrics.scanCacheLookup(false)
+				segment.missing = append(segment.missing, i)
+				continue
+			}
+			p.shared.metrics.scanCacheLookup(true)
+			for _, height := range heights {
+				if height >= segment.start && height <= segment.end {
+					segment.cached[height] = append(segment.cached[height], i)
+				}
+			}
+		}
+		if len(segment.missing) > 0 {
+			segment.hits = make([][]int, scanCacheSegment)
+		}
+	}
+}
+
+// match returns the indexes of the scripts of p the block at height, in
+// segment, matches: those the cache holds matches at height of, and those of
+// the missing scripts matchEach reports matching the block's filter, which
+// are kept to be stored. matchEach is only called if scripts are missing.
+func (p *scanPlan) match(segment *cacheSegment, height int32, matchEach func(scripts [][]byte) []int) []int {
+	hits := slices.Clone(segment.cached[height])
+	if len(segment.missing) == 0 {
+		return hits
+	}
+	missing := make([][]byte, len(segment.missing))
+	for i, index := range segment.missing {
+		missing[i] = p.scripts[index]
+	}
+	var found []int
+	for _, i := range matchEach(missing) {
+		found = append(found, segment.missing[i])
+	}
+	segment.hits[height-segment.start] = found
+	return append(hits, found...)
+}
+
+// store caches the matches of the missing scripts of the segments within from
+// through through, every height of which the scan must have fetched. Segments
+// overlapping skipped are left out, as their matches are incomplete.
+func (p *scanPlan) store(ctx context.Context, from, through int32, skipped []HeightRange) {
+	if p == nil {
+		return
+	}
+	values := make(map[string][]byte)
+	p.mu.Lock()
+	for _, segment := range p.segments {
+		if segment.stored || segment.endHash == nil || len(segment.missing) == 0 ||
+			segment.start < from || segment.end > through || overlapsRanges(segment.start, segment.end, skipped) {
+			continue
+		}
+		matches := make([][]int32, len(p.scripts))
+		for i, hits := range segment.hits {
+			for _, index := range hits {
+				matches[index] = append(matches[index], segment.start+int32(i))
+			}
+		}
+		for _, index := range segment.missing {
+			heights := matches[index]
+			if heights == nil {
+				heights = []int32{}
+			}
+			value, _ := json.Marshal(heights)
+			values[scanCacheKey(segment.endHash, p.scripts[index])] = value
+		}
+		segment.stored = true
+		segment.hits = nil
+	}
+	p.mu.Unlock()
+
+	if len(values) == 0 {
+		return
+	}
+	if err := p.shared.cache.Set(ctx, values); err != nil {
+		p.shared.logger.Warnf("Failed to write the scan cache: %v", err)
+	}
+}
+
+// overlapsRanges reports whether start through end overlaps any of ranges.
+func overlapsRanges(start, end int32, ranges []HeightRange) bool {
+	for _, r := range ranges {
+		if r.Start <= end && r.End >= start {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFilterEach returns the indexes of the scripts the filter of the block
+// at height matches. Heights whose filter cannot be fetched or matched are
+// added to skips.
+func (n *Node) matchFilterEach(ctx context.Context, height int32, scripts [][]byte, skips *skipTracker) []int {
+	blockHash, filter := n.filterAt(ctx, height, skips)
+	if filter == nil {
+		return nil
+	}
+	hits, err := filterMatches(filter, builder.DeriveKey(blockHash), scripts)
+	if err != nil {
+		n.logger.Debugf("Filter match error for block %d: %v", logging.KV("height", height), err)
+		skips.add(height)
+		return nil
+	}
+	return hits
+}
+
+// filterMatches returns the indexes of the scripts filter matches under key.
+func filterMatches(filter *gcs.Filter, key [gcs.KeySize]byte, scripts [][]byte) ([]int, error) {
+	// Most filters match none of the scripts, which one MatchAny settles
+	matched, err := filter.MatchAny(key, scripts)
+	var hits []int
+	for i := 0; err == nil && matched && i < len(scripts); i++ {
+		var hit bool
+		if hit, err = filter.Match(key, scripts[i]); hit {
+			hits = append(hits, i)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hits, nil
+}
@@ -0,0 +1,135 @@
+package neutrino
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btclog"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/scancache"
+)
+
+// heightHasher hashes heights as the block hashes of a test chain.
+type heightHasher struct{}
+
+func (heightHasher) GetBlockHash(height int64) (*chainhash.Hash, error) {
+	return &chainhash.Hash{byte(height), byte(height >> 8), byte(height >> 16)}, nil
+}
+
+// countingCache counts the reads of a cache.
+type countingCache struct {
+	ScanCache
+	gets int
+}
+
+func (c *countingCache) Get(ctx context.Context, keys []string) ([][]byte, error) {
+	c.gets++
+	return c.ScanCache.Get(ctx, keys)
+}
+
+func TestScanPlanSegment(t *testing.T) {
+	cache := &countingCache{ScanCache: scancache.NewMemory(100, 0)}
+	shared := &sharedScans{cache: cache, logger: btclog.Disabled}
+	plan := shared.newPlan(heightHasher{}, [][]byte{{0x51}}, 900, 3100)
+	tests := []struct {
+		height    int32
+		wantStart int32 // 0 for no segment
+	}{
+		{999, 0},
+		{1000, 1000},
+		{1999, 1000},
+		{2000, 2000},
+		{2999, 2000},
+		{3000, 0},
+	}
+	for _, tt := range tests {
+		segment := plan.segment(context.Background(), tt.height)
+		switch {
+		case tt.wantStart == 0 && segment != nil:
+			t.Errorf("segment(%d) = %d-%d, want none", tt.height, segment.start, segment.end)
+		case tt.wantStart != 0 && (segment == nil || segment.start != tt.wantStart):
+			t.Errorf("segment(%d) = %v, want the segment from %d", tt.height, segment, tt.wantStart)
+		}
+	}
+	if cache.gets != 1 {
+		t.Errorf("read the cache %d times, want the window once", cache.gets)
+	}
+	if segment := (*scanPlan)(nil).segment(context.Background(), 1000); segment != nil {
+		t.Errorf("segment() of no plan = %v, want none", segment)
+	}
+	if plan := (*sharedScans)(nil).newPlan(heightHasher{}, nil, 0, 5000); plan != nil {
+		t.Errorf("newPlan() without a cache = %v, want none", plan)
+	}
+}
+
+func TestScanPlanStore(t *testing.T) {
+	ctx := context.Background()
+	cache := scancache.NewMemory(100, 0)
+	first, _ := heightHasher{}.GetBlockHash(1999)
+	second, _ := heightHasher{}.GetBlockHash(2999)
+	a, b := []byte{0x51}, []byte{0x52}
+	if err := cache.Set(ctx, map[string][]byte{scanCacheKey(second, b): []byte("[2100]")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The range runs from 900 through 3100: the segment from 2000 has a
+	// skipped height and the one from 3000 is not covered whole
+	shared := &sharedScans{cache: cache, logger: btclog.Disabled}
+	plan := shared.newPlan(heightHasher{}, [][]byte{a, b}, 900, 3100)
+	match := func(height int32, matching []int, wantScripts int) []int {
+		t.Helper()
+		return plan.match(plan.segment(ctx, height), height, func(scripts [][]byte) []int {
+			if len(scripts) != wantScripts {
+				t.Errorf("matched %d scripts at height %d, want %d", len(scripts), height, wantScripts)
+			}
+			return matching
+		})
+	}
+	match(1005, []int{1}, 2)
+	match(1500, []int{0, 1}, 2)
+	if hits := match(2100, []int{0}, 1); !slices.Equal(hits, []int{1, 0}) {
+		t.Errorf("match(2100) = %v, want the cached and the matched script", hits)
+	}
+
+	keys := []string{scanCacheKey(first, a), scanCacheKey(first, b), scanCacheKey(second, a)}
+	plan.store(ctx, 900, 1998, nil)
+	values, err := cache.Get(ctx, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.ContainsFunc(values, func(value []byte) bool { return value != nil }) {
+		t.Fatalf("stored %q before the segments were scanned", values)
+	}
+
+	plan.store(ctx, 900, 3100, []HeightRange{{Start: 2500, End: 2501}})
+	values, err = cache.Get(ctx, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"[1500]", "[1005,1500]", ""}
+	for i, value := range values {
+		if string(value) != want[i] {
+			t.Errorf("cached matches %d = %q, want %q", i, value, want[i])
+		}
+	}
+}
+
+func TestOverlapsRanges(t *testing.T) {
+	ranges := []HeightRange{{Start: 10, End: 20}}
+	for _, tt := range []struct {
+		start, end int32
+		want       bool
+	}{
+		{0, 9, false},
+		{0, 10, true},
+		{15, 16, true},
+		{20, 30, true},
+		{21, 30, false},
+	} {
+		if got := overlapsRanges(tt.start, tt.end, ranges); got != tt.want {
+			t.Errorf("overlapsRanges(%d, %d) = %t, want %t", tt.start, tt.end, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package neutrino
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// scanFlights coalesces the fetches of concurrent scans over overlapping
+// ranges. A scan needing a filter batch, filter or block that another scan is
+// already fetching waits for that fetch and shares its result instead of
+// asking peers again, so scans that reach the same heights together fetch
+// each once between them. Scans are not merged into one pass: each keeps its
+// own position in the chain, matches the shared filters against its own
+// scripts and applies the blocks it matched, and only fetches in flight at
+// the same time are shared. A nil *scanFlights fetches everything separately.
+type scanFlights struct {
+	metrics *counters
+
+	mu    sync.Mutex
+	calls map[string]*flightCall
+
+	// joined, if set, is sent the key of every fetch a scan waits for
+	// instead of running, so tests can tell when scans have joined.
+	joined chan<- string
+}
+
+// flightCall is a fetch in flight, whose result is set before done is
+// closed.
+type flightCall struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+// newScanFlights creates the fetch coalescing shared by a node's scans,
+// counting the shared fetches in metrics.
+func newScanFlights(metrics *counters) *scanFlights {
+	return &scanFlights{metrics: metrics, calls: make(map[string]*flightCall)}
+}
+
+// filterFlight, blockFlight and batchFlight are the keys of the fetches of
+// the filter of a block, of the block, and of a batch of filters from a
+// block, which the size and direction of the batch tell apart.
+func filterFlight(hash chainhash.Hash) string { return "filter:" + hash.String() }
+
+func blockFlight(hash chainhash.Hash) string { return "block:" + hash.String() }
+
+func batchFlight(hash chainhash.Hash, size int32, reverse bool) string {
+	return fmt.Sprintf("batch:%s:%d:%t", hash, size, reverse)
+}
+
+// shareFetch runs fetch for key, unless a concurrent scan is already running
+// it, in which case it waits for and returns that scan's result.
+func shareFetch[T any](f *scanFlights, key string, fetch func() (T, error)) (T, error) {
+	if f == nil {
+		return fetch()
+	}
+
+	f.mu.Lock()
+	if call, ok := f.calls[key]; ok {
+		f.mu.Unlock()
+		f.metrics.sharedFetch()
+		if f.joined != nil {
+			f.joined <- key
+		}
+		<-call.done
+		result, _ := call.value.(T)
+		return result, call.err
+	}
+
+	// fetch runs on the goroutine of the leading scan only. If it panics,
+	// the scans waiting for it get an error.
+	call := &flightCall{done: make(chan struct{}), err: fmt.Errorf("shared fetch of %s did not complete", key)}
+	f.calls[key] = call
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		delete(f.calls, key)
+		f.mu.Unlock()
+		close(call.done)
+	}()
+
+	value, err := fetch()
+	call.value, call.err = value, err
+	return value, err
+}
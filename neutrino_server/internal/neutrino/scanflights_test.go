@@ -0,0 +1,89 @@
+package neutrino
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShareFetch(t *testing.T) {
+	metrics := &counters{}
+	flights := newScanFlights(metrics)
+	joined := make(chan string)
+	flights.joined = joined
+
+	// The first scan holds the fetch until the others have joined it
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	fetch := func() (int, error) {
+		fetches.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	const scans = 5
+	results := make([]int, scans)
+	var wg sync.WaitGroup
+	for i := range scans {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = shareFetch(flights, "filter:a", fetch)
+		}()
+	}
+	for range scans - 1 {
+		<-joined
+	}
+	close(release)
+	wg.Wait()
+
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("fetched %d times, want once", got)
+	}
+	for i, result := range results {
+		if result != 42 {
+			t.Errorf("scan %d got %d, want 42", i, result)
+		}
+	}
+	if got := metrics.sharedFetches.Load(); got != scans-1 {
+		t.Errorf("sharedFetches = %d, want %d", got, scans-1)
+	}
+
+	// Later fetches of the key run again, and errors are returned to the
+	// scans sharing them
+	wantErr := errors.New("no peers")
+	if _, err := shareFetch(flights, "filter:a", func() (int, error) { return 0, wantErr }); !errors.Is(err, wantErr) {
+		t.Errorf("shareFetch() error = %v, want %v", err, wantErr)
+	}
+
+	// A scan waiting for a fetch that panics gets an error
+	release = make(chan struct{})
+	started, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() { _ = recover() }()
+		_, _ = shareFetch(flights, "block:b", func() (int, error) {
+			close(started)
+			<-release
+			panic("fetch failed")
+		})
+	}()
+	<-started
+	waited := make(chan error)
+	go func() {
+		_, err := shareFetch(flights, "block:b", func() (int, error) { return 1, nil })
+		waited <- err
+	}()
+	<-joined
+	close(release)
+	if err := <-waited; err == nil {
+		t.Error("shareFetch() of a panicked fetch succeeded, want an error")
+	}
+	<-done
+
+	var disabled *scanFlights
+	if result, err := shareFetch(disabled, "filter:a", func() (int, error) { return 7, nil }); result != 7 || err != nil {
+		t.Errorf("shareFetch() without flights = %d, %v, want 7", result, err)
+	}
+}
@@ -0,0 +1,212 @@
+package neutrino
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultScanMemoTTL is how long the scan memo remembers the ranges in which
+// a script matched no filters after they were last recorded.
+const DefaultScanMemoTTL = 10 * time.Minute
+
+// scanMemoScripts bounds the number of scripts the scan memo remembers. The
+// least recently recorded are dropped first.
+const scanMemoScripts = 100000
+
+// scanMemo remembers, for each script, the height ranges in which the filters
+// of the current chain did not match it, so scans repeated within the TTL skip
+// them without fetching a filter. Only misses are remembered: a height whose
+// filter matched, or could not be checked, is scanned again. A nil memo
+// remembers nothing.
+type scanMemo struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	scripts map[string]*memoEntry
+
+	// generation changes with every reorg, so that scans started before
+	// one do not record ranges of the replaced blocks
+	generation uint64
+}
+
+// memoEntry holds the merged ranges in which a script matched no filters.
+type memoEntry struct {
+	ranges   []HeightRange
+	recorded time.Time
+}
+
+// newScanMemo creates a scan memo remembering misses for ttl. A ttl of zero
+// or less disables it.
+func newScanMemo(ttl time.Duration) *scanMemo {
+	if ttl <= 0 {
+		return nil
+	}
+	return &scanMemo{ttl: ttl, now: time.Now, scripts: make(map[string]*memoEntry)}
+}
+
+// lookup returns the ranges from start through end in which none of scripts
+// matched, and the generation the scan is to record its misses with.
+func (m *scanMemo) lookup(scripts [][]byte, start, end int32) ([]HeightRange, uint64) {
+	if m == nil {
+		return nil, 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(scripts) == 0 || end < start {
+		return nil, m.generation
+	}
+	covered := []HeightRange{{Start: start, End: end}}
+	now := m.now()
+	for _, script := range scripts {
+		entry, ok := m.scripts[string(script)]
+		if ok && now.Sub(entry.recorded) > m.ttl {
+			delete(m.scripts, string(script))
+			ok = false
+		}
+		if !ok {
+			return nil, m.generation
+		}
+		if covered = intersectRanges(covered, entry.ranges); len(covered) == 0 {
+			return nil, m.generation
+		}
+	}
+	return covered, m.generation
+}
+
+// record remembers that none of scripts matched the filters from start
+// through end, apart from the matched heights and the skipped ranges, which
+// could not be checked. Scans started before the last reorg, at an earlier
+// generation, record nothing.
+func (m *scanMemo) record(generation uint64, scripts [][]byte, start, end int32, matched []int32, skipped []HeightRange) {
+	if m == nil || len(scripts) == 0 || end < start {
+		return
+	}
+	misses := missRanges(start, end, matched)
+	for _, r := range skipped {
+		misses = subtractRange(misses, r)
+	}
+	if len(misses) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if generation != m.generation {
+		return
+	}
+	now := m.now()
+	for _, script := range scripts {
+		entry, ok := m.scripts[string(script)]
+		if !ok || now.Sub(entry.recorded) > m.ttl {
+			entry = &memoEntry{}
+			m.scripts[string(script)] = entry
+		}
+		entry.ranges = mergeRanges(append(entry.ranges, misses...))
+		entry.recorded = now
+	}
+	m.evict(now)
+}
+
+// evict drops expired scripts and, while the memo holds too many, the least
+// recently recorded ones. Callers hold mu.
+func (m *scanMemo) evict(now time.Time) {
+	if len(m.scripts) <= scanMemoScripts {
+		return
+	}
+	for script, entry := range m.scripts {
+		if now.Sub(entry.recorded) > m.ttl {
+			delete(m.scripts, script)
+		}
+	}
+	excess := len(m.scripts) - scanMemoScripts
+	if excess <= 0 {
+		return
+	}
+	scripts := make([]string, 0, len(m.scripts))
+	for script := range m.scripts {
+		scripts = append(scripts, script)
+	}
+	slices.SortFunc(scripts, func(a, b string) int {
+		return m.scripts[a].recorded.Compare(m.scripts[b].recorded)
+	})
+	for _, script := range scripts[:excess] {
+		delete(m.scripts, script)
+	}
+}
+
+// truncate forgets the misses above fork, whose blocks a reorg replaced.
+func (m *scanMemo) truncate(fork int32) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.generation++
+	for script, entry := range m.scripts {
+		entry.ranges = subtractRange(entry.ranges, HeightRange{Start: fork + 1, End: math.MaxInt32})
+		if len(entry.ranges) == 0 {
+			delete(m.scripts, script)
+		}
+	}
+}
+
+// missRanges returns start through end without the matched heights, which
+// may be unsorted and repeated.
+func missRanges(start, end int32, matched []int32) []HeightRange {
+	heights := slices.Clone(matched)
+	slices.Sort(heights)
+	var ranges []HeightRange
+	next := start
+	for _, height := range slices.Compact(heights) {
+		if height < next || height > end {
+			continue
+		}
+		if height > next {
+			ranges = append(ranges, HeightRange{Start: next, End: height - 1})
+		}
+		next = height + 1
+	}
+	if next <= end {
+		ranges = append(ranges, HeightRange{Start: next, End: end})
+	}
+	return ranges
+}
+
+// intersectRanges returns the heights in both a and b, which are sorted and
+// merged.
+func intersectRanges(a, b []HeightRange) []HeightRange {
+	var result []HeightRange
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		start, end := max(a[i].Start, b[j].Start), min(a[i].End, b[j].End)
+		if start <= end {
+			result = append(result, HeightRange{Start: start, End: end})
+		}
+		if a[i].End < b[j].End {
+			i++
+		} else {
+			j++
+		}
+	}
+	return result
+}
+
+// rangesContain reports whether height is in ranges, which are sorted and
+// merged.
+func rangesContain(ranges []HeightRange, height int32) bool {
+	_, found := slices.BinarySearchFunc(ranges, height, func(r HeightRange, height int32) int {
+		switch {
+		case r.End < height:
+			return -1
+		case r.Start > height:
+			return 1
+		}
+		return 0
+	})
+	return found
+}
@@ -0,0 +1,107 @@
+package neutrino
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScanMemo(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	memo := newScanMemo(10 * time.Minute)
+	memo.now = func() time.Time { return now }
+	a, b := []byte{0x51}, []byte{0x52}
+
+	if covered, _ := memo.lookup([][]byte{a}, 0, 100); covered != nil {
+		t.Fatalf("lookup() of an empty memo = %v, want none", covered)
+	}
+
+	// a matched at 50 and 120 could not be checked; b missed everywhere
+	_, generation := memo.lookup([][]byte{a, b}, 0, 200)
+	memo.record(generation, [][]byte{a}, 0, 200, []int32{50, 50}, []HeightRange{{Start: 120, End: 120}})
+	memo.record(generation, [][]byte{b}, 0, 200, nil, nil)
+
+	tests := []struct {
+		name       string
+		scripts    [][]byte
+		start, end int32
+		want       []HeightRange
+	}{
+		{"one script", [][]byte{a}, 0, 200, []HeightRange{{0, 49}, {51, 119}, {121, 200}}},
+		{"clipped", [][]byte{a}, 40, 130, []HeightRange{{40, 49}, {51, 119}, {121, 130}}},
+		{"both scripts", [][]byte{a, b}, 100, 300, []HeightRange{{100, 119}, {121, 200}}},
+		{"unknown script", [][]byte{a, {0x53}}, 0, 200, nil},
+		{"beyond the ranges", [][]byte{b}, 201, 300, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			covered, _ := memo.lookup(tt.scripts, tt.start, tt.end)
+			if !reflect.DeepEqual(covered, tt.want) {
+				t.Errorf("lookup() = %v, want %v", covered, tt.want)
+			}
+		})
+	}
+
+	// Misses of later scans extend the remembered ranges
+	memo.record(generation, [][]byte{b}, 201, 300, nil, nil)
+	if covered, _ := memo.lookup([][]byte{b}, 0, 300); !reflect.DeepEqual(covered, []HeightRange{{0, 300}}) {
+		t.Errorf("lookup() after extending = %v, want 0-300", covered)
+	}
+
+	// A reorg forgets the replaced heights and drops misses of scans that
+	// started before it
+	memo.truncate(150)
+	memo.record(generation, [][]byte{b}, 151, 300, nil, nil)
+	if covered, _ := memo.lookup([][]byte{b}, 0, 300); !reflect.DeepEqual(covered, []HeightRange{{0, 150}}) {
+		t.Errorf("lookup() after a reorg = %v, want 0-150", covered)
+	}
+
+	now = now.Add(11 * time.Minute)
+	if covered, _ := memo.lookup([][]byte{b}, 0, 300); covered != nil {
+		t.Errorf("lookup() after the TTL = %v, want none", covered)
+	}
+
+	// A disabled memo remembers nothing
+	var disabled *scanMemo
+	disabled.record(0, [][]byte{a}, 0, 100, nil, nil)
+	disabled.truncate(10)
+	if covered, _ := disabled.lookup([][]byte{a}, 0, 100); covered != nil {
+		t.Errorf("lookup() of a disabled memo = %v, want none", covered)
+	}
+	if newScanMemo(0) != nil {
+		t.Error("newScanMemo(0) is enabled, want nil")
+	}
+}
+
+func TestMissRanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		matched []int32
+		want    []HeightRange
+	}{
+		{"no matches", nil, []HeightRange{{10, 20}}},
+		{"unsorted and repeated", []int32{15, 12, 15}, []HeightRange{{10, 11}, {13, 14}, {16, 20}}},
+		{"at the ends", []int32{10, 20}, []HeightRange{{11, 19}}},
+		{"outside the range", []int32{5, 25}, []HeightRange{{10, 20}}},
+		{"every height", []int32{10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missRanges(10, 20, tt.matched); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missRanges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRangesContain(t *testing.T) {
+	ranges := []HeightRange{{10, 20}, {30, 30}}
+	for height, want := range map[int32]bool{9: false, 10: true, 20: true, 21: false, 30: true, 31: false} {
+		if got := rangesContain(ranges, height); got != want {
+			t.Errorf("rangesContain(%d) = %v, want %v", height, got, want)
+		}
+	}
+	if rangesContain(nil, 10) {
+		t.Error("rangesContain() of no ranges = true, want false")
+	}
+}
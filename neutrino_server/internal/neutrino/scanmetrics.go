@@ -0,0 +1,175 @@
+package neutrino
+
+import (
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// ScanMetrics describes the throughput of a rescan job since it was started
+// or resumed by this process.
+type ScanMetrics struct {
+	BlocksScanned    int64   `json:"blocks_scanned"`
+	BlocksPerSecond  float64 `json:"blocks_per_second"`
+	FiltersMatched   int64   `json:"filters_matched"`
+	BlocksDownloaded int64   `json:"blocks_downloaded"`
+	BytesDownloaded  int64   `json:"bytes_downloaded"`
+	ElapsedSeconds   float64 `json:"elapsed_seconds"`
+
+	// RemainingBlocks and EstimatedSecondsRemaining project completion at
+	// the current rate. The estimate is omitted until a block is scanned.
+	RemainingBlocks           int64   `json:"remaining_blocks"`
+	EstimatedSecondsRemaining float64 `json:"estimated_seconds_remaining,omitempty"`
+}
+
+// RescanJobStatus is the progress of a running or finished rescan job.
+type RescanJobStatus struct {
+	JobID         uint64      `json:"job_id"`
+	Addresses     int         `json:"addresses"`
+	StartHeight   int32       `json:"start_height"`
+	EndHeight     int32       `json:"end_height"`
+	CurrentHeight int32       `json:"current_height"`
+	Metrics       ScanMetrics `json:"metrics"`
+	Error         string      `json:"error,omitempty"`
+}
+
+// RescanStatus reports running rescan jobs and the most recently finished
+// one.
+type RescanStatus struct {
+	InProgress bool              `json:"in_progress"`
+	Jobs       []RescanJobStatus `json:"jobs"`
+	LastJob    *RescanJobStatus  `json:"last_job,omitempty"`
+}
+
+// scanProgress counts the work done by one run of a rescan job. Counters are
+// updated by scan workers and read concurrently by status requests.
+type scanProgress struct {
+	jobID       uint64
+	addresses   int
+	startHeight int32
+	endHeight   int32
+
+	// scanFrom is the first height scanned by this run, which differs from
+	// startHeight for resumed jobs.
+	scanFrom int32
+	started  time.Time
+
+	height           atomic.Int32
+	filtersMatched   atomic.Int64
+	blocksDownloaded atomic.Int64
+	bytesDownloaded  atomic.Int64
+}
+
+// newScanProgress starts tracking a run of job from its checkpoint.
+func newScanProgress(job *RescanJob) *scanProgress {
+	p := &scanProgress{
+		jobID:       job.ID,
+		addresses:   len(job.Addresses),
+		startHeight: job.StartHeight,
+		endHeight:   job.EndHeight,
+		scanFrom:    job.CheckpointHeight + 1,
+		started:     time.Now(),
+	}
+	p.height.Store(job.CheckpointHeight)
+	return p
+}
+
+// addFilter records a fetched filter of the given size and whether it
+// matched. It is safe to call on a nil progress.
+func (p *scanProgress) addFilter(size int, matched bool) {
+	if p == nil {
+		return
+	}
+	p.bytesDownloaded.Add(int64(size))
+	if matched {
+		p.filtersMatched.Add(1)
+	}
+}
+
+// addBlock records a downloaded block of the given size. It is safe to call
+// on a nil progress.
+func (p *scanProgress) addBlock(size int) {
+	if p == nil {
+		return
+	}
+	p.blocksDownloaded.Add(1)
+	p.bytesDownloaded.Add(int64(size))
+}
+
+// status returns a snapshot of the job's progress.
+func (p *scanProgress) status() RescanJobStatus {
+	height := p.height.Load()
+	elapsed := time.Since(p.started).Seconds()
+
+	metrics := ScanMetrics{
+		BlocksScanned:    int64(height - p.scanFrom + 1),
+		FiltersMatched:   p.filtersMatched.Load(),
+		BlocksDownloaded: p.blocksDownloaded.Load(),
+		BytesDownloaded:  p.bytesDownloaded.Load(),
+		ElapsedSeconds:   elapsed,
+		RemainingBlocks:  int64(max(p.endHeight-height, 0)),
+	}
+	if elapsed > 0 {
+		metrics.BlocksPerSecond = float64(metrics.BlocksScanned) / elapsed
+	}
+	if metrics.BlocksPerSecond > 0 {
+		metrics.EstimatedSecondsRemaining = float64(metrics.RemainingBlocks) / metrics.BlocksPerSecond
+	}
+
+	return RescanJobStatus{
+		JobID:         p.jobID,
+		Addresses:     p.addresses,
+		StartHeight:   p.startHeight,
+		EndHeight:     p.endHeight,
+		CurrentHeight: height,
+		Metrics:       metrics,
+	}
+}
+
+// trackJob registers progress as a running job.
+func (r *RescanManager) trackJob(progress *scanProgress) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.activeJobs = append(r.activeJobs, progress)
+}
+
+// jobRunning reports whether the job with the given ID is running.
+func (r *RescanManager) jobRunning(id uint64) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.ContainsFunc(r.activeJobs, func(p *scanProgress) bool { return p.jobID == id })
+}
+
+// finishJob moves progress from the running jobs to the last finished job.
+func (r *RescanManager) finishJob(progress *scanProgress, jobErr error) RescanJobStatus {
+	status := progress.status()
+	if jobErr != nil {
+		status.Error = jobErr.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.activeJobs = slices.DeleteFunc(r.activeJobs, func(p *scanProgress) bool { return p == progress })
+	r.lastJob = &status
+	return status
+}
+
+// RescanStatus returns the progress of running rescan jobs and the most
+// recently finished one.
+func (r *RescanManager) RescanStatus() RescanStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	status := RescanStatus{
+		InProgress: r.rescanInProgress.Load() > 0,
+		Jobs:       make([]RescanJobStatus, 0, len(r.activeJobs)),
+	}
+	for _, progress := range r.activeJobs {
+		status.Jobs = append(status.Jobs, progress.status())
+	}
+	if r.lastJob != nil {
+		last := *r.lastJob
+		status.LastJob = &last
+	}
+	return status
+}
@@ -0,0 +1,82 @@
+package neutrino
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestScanProgress(t *testing.T) {
+	job := &RescanJob{ID: 7, Addresses: []string{"a", "b"}, StartHeight: 100, EndHeight: 1099, CheckpointHeight: 599}
+	progress := newScanProgress(job)
+	progress.started = time.Now().Add(-10 * time.Second)
+
+	// A resumed job has scanned nothing in this run yet
+	status := progress.status()
+	if status.CurrentHeight != 599 || status.Metrics.BlocksScanned != 0 || status.Metrics.RemainingBlocks != 500 {
+		t.Errorf("unexpected initial status: %+v", status)
+	}
+	if status.Metrics.EstimatedSecondsRemaining != 0 {
+		t.Errorf("expected no estimate before scanning, got %v", status.Metrics.EstimatedSecondsRemaining)
+	}
+
+	progress.addFilter(200, false)
+	progress.addFilter(300, true)
+	progress.addBlock(1000)
+	progress.height.Store(699)
+
+	status = progress.status()
+	metrics := status.Metrics
+	if status.JobID != 7 || status.Addresses != 2 || status.StartHeight != 100 || status.EndHeight != 1099 || status.CurrentHeight != 699 {
+		t.Errorf("unexpected job fields: %+v", status)
+	}
+	if metrics.BlocksScanned != 100 || metrics.FiltersMatched != 1 || metrics.BlocksDownloaded != 1 || metrics.BytesDownloaded != 1500 {
+		t.Errorf("unexpected counters: %+v", metrics)
+	}
+	if metrics.RemainingBlocks != 400 {
+		t.Errorf("RemainingBlocks = %d, want 400", metrics.RemainingBlocks)
+	}
+
+	// About 10 blocks per second leaves about 40 seconds
+	if metrics.BlocksPerSecond < 9 || metrics.BlocksPerSecond > 10.1 {
+		t.Errorf("BlocksPerSecond = %v, want about 10", metrics.BlocksPerSecond)
+	}
+	if metrics.EstimatedSecondsRemaining < 39 || metrics.EstimatedSecondsRemaining > 45 {
+		t.Errorf("EstimatedSecondsRemaining = %v, want about 40", metrics.EstimatedSecondsRemaining)
+	}
+
+	// Counting on a nil progress is a no-op
+	var none *scanProgress
+	none.addFilter(1, true)
+	none.addBlock(1)
+}
+
+func TestRescanStatus(t *testing.T) {
+	mgr := &RescanManager{}
+
+	if status := mgr.RescanStatus(); status.InProgress || len(status.Jobs) != 0 || status.LastJob != nil {
+		t.Fatalf("expected empty status, got %+v", status)
+	}
+
+	first := newScanProgress(&RescanJob{ID: 1, EndHeight: 10, CheckpointHeight: -1})
+	second := newScanProgress(&RescanJob{ID: 2, EndHeight: 10, CheckpointHeight: -1})
+	mgr.trackJob(first)
+	mgr.trackJob(second)
+
+	if status := mgr.RescanStatus(); len(status.Jobs) != 2 || status.Jobs[0].JobID != 1 || status.Jobs[1].JobID != 2 {
+		t.Fatalf("expected both running jobs, got %+v", status.Jobs)
+	}
+
+	finished := mgr.finishJob(first, errors.New("boom"))
+	if finished.Error != "boom" {
+		t.Errorf("finishJob() error = %q, want boom", finished.Error)
+	}
+
+	status := mgr.RescanStatus()
+	if len(status.Jobs) != 1 || status.Jobs[0].JobID != 2 {
+		t.Errorf("expected only job 2 running, got %+v", status.Jobs)
+	}
+	if status.LastJob == nil || status.LastJob.JobID != 1 || status.LastJob.Error != "boom" {
+		t.Errorf("unexpected last job: %+v", status.LastJob)
+	}
+}
@@ -0,0 +1,326 @@
+package neutrino
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/gcs"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+	"github.com/lightninglabs/neutrino"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+const (
+	// DefaultScanWorkers is the number of concurrent filter/block fetchers
+	// used by scans when no explicit worker count is configured.
+	DefaultScanWorkers = 4
+
+	// DefaultFilterBatchSize is the number of compact filters requested per
+	// round trip by scans. Prefetched filters are held in neutrino's filter
+	// cache, so the batch should fit comfortably within it.
+	DefaultFilterBatchSize = 100
+)
+
+// ScanDirection is the order in which a lookup scans block heights.
+type ScanDirection string
+
+const (
+	// ScanForward scans from the start height up to the tip.
+	ScanForward ScanDirection = "forward"
+
+	// ScanBackward scans from the tip down to the start height, stopping at
+	// the first spend or the creation block.
+	ScanBackward ScanDirection = "backward"
+)
+
+// ScanMode controls how scans treat blocks whose filter or contents could not
+// be fetched.
+type ScanMode string
+
+const (
+	// ScanLenient skips blocks that cannot be checked and labels the result
+	// partial, listing the skipped heights.
+	ScanLenient ScanMode = "lenient"
+
+	// ScanStrict fails the scan with an IncompleteScanError if any block
+	// cannot be checked.
+	ScanStrict ScanMode = "strict"
+)
+
+// ScanOptions tunes how scans fetch filters and blocks.
+type ScanOptions struct {
+	// Mode is ScanLenient or ScanStrict. The zero value is lenient.
+	Mode ScanMode
+
+	// Workers is the number of concurrent filter/block fetchers.
+	Workers int
+
+	// FilterBatchSize is the number of filters requested per peer round
+	// trip. Values of 1 or less fetch filters one at a time.
+	FilterBatchSize int
+}
+
+// errStopScan is returned by a scan apply function to end a scan early
+// without reporting an error.
+var errStopScan = errors.New("stop scan")
+
+// deadlineError returns the error ending a scan that applied every height
+// before resume, turned into a ScanDeadlineError if the scan reached the
+// deadline of its request.
+func deadlineError(err error, resume int32) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &ScanDeadlineError{ResumeHeight: resume}
+	}
+	return err
+}
+
+// blockFetcher returns the full block at height if it is relevant to the
+// scan, or nil if its filter did not match or it could not be fetched.
+type blockFetcher func(height int32) *btcutil.Block
+
+// blockApplier consumes the fetch result for height. It is called once per
+// height, strictly in ascending height order.
+type blockApplier func(height int32, block *btcutil.Block) error
+
+// BlockObserver is called with a block that a scan has already downloaded,
+// allowing extra analysis without any additional block fetches.
+type BlockObserver func(height int32, block *btcutil.Block)
+
+// scanRange fetches heights start through end using a bounded pool of
+// workers, while applying results in height order so that spends are always
+// processed after the outputs they consume. At most a small multiple of
+// workers fetched blocks are held in memory at any time.
+//
+// If apply returns errStopScan the scan ends early and scanRange returns nil;
+// any other error ends the scan and is returned. Canceling ctx, such as when
+// the client of the request being answered disconnects, stops fetching and
+// returns ctx's error.
+func scanRange(ctx context.Context, start, end int32, workers int, fetch blockFetcher, apply blockApplier) error {
+	if end < start {
+		return nil
+	}
+	return scanHeights(ctx, start, end-start+1, 1, workers, fetch, apply)
+}
+
+// scanRangeBackward is like scanRange but applies heights from end down to
+// start, for lookups that are most likely answered near the tip.
+func scanRangeBackward(ctx context.Context, start, end int32, workers int, fetch blockFetcher, apply blockApplier) error {
+	if end < start {
+		return nil
+	}
+	return scanHeights(ctx, end, end-start+1, -1, workers, fetch, apply)
+}
+
+// scanHeights fetches count heights beginning at first and moving by step,
+// applying them in that order.
+func scanHeights(ctx context.Context, first, count, step int32, workers int, fetch blockFetcher, apply blockApplier) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	type pending struct {
+		height int32
+		result chan *btcutil.Block
+	}
+
+	// queue preserves height order for the consumer, while jobs feeds the
+	// workers. The queue buffer bounds how far fetching runs ahead.
+	queue := make(chan pending, workers*2)
+	jobs := make(chan pending)
+	quit := make(chan struct{})
+
+	go func() {
+		defer close(queue)
+		defer close(jobs)
+
+		for i := int32(0); i < count; i++ {
+			p := pending{height: first + i*step, result: make(chan *btcutil.Block, 1)}
+			select {
+			case queue <- p:
+			case <-quit:
+				return
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- p:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				// Heights queued before a cancellation are not fetched
+				if ctx.Err() != nil {
+					p.result <- nil
+					continue
+				}
+				p.result <- fetch(p.height)
+			}
+		}()
+	}
+
+	// Stop the producer and wait for in-flight fetches before returning, so
+	// no worker outlives the scan.
+	defer wg.Wait()
+	defer close(quit)
+
+	for p := range queue {
+		block := <-p.result
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := apply(p.height, block); err != nil {
+			if errors.Is(err, errStopScan) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	// The producer also stops early when ctx is canceled
+	return ctx.Err()
+}
+
+// filterSource is the subset of the chain service used to prefetch filters.
+type filterSource interface {
+	GetBlockHash(height int64) (*chainhash.Hash, error)
+	GetCFilter(blockHash chainhash.Hash, filterType wire.FilterType,
+		options ...neutrino.QueryOption) (*gcs.Filter, error)
+}
+
+// filterPrefetcher requests compact filters in batches over a scan range,
+// keeping one batch in flight ahead of the heights being matched. Batched
+// filters land in neutrino's filter cache, so the scan's per-height
+// GetCFilter calls are then served without a network round trip.
+type filterPrefetcher struct {
+	ctx       context.Context // parents the batch spans
+	source    filterSource
+	start     int32
+	end       int32
+	batchSize int32
+	reverse   bool // batches run from end down to start
+	logger    btclog.Logger
+
+	// flights, if set, shares batches with concurrent scans requesting
+	// the same ones
+	flights *scanFlights
+
+	// fill, if set, counts the filter cache evictions batches cause
+	fill *cacheFill
+
+	mu      sync.Mutex
+	batches map[int32]chan struct{}
+}
+
+// newFilterPrefetcher creates a prefetcher for heights start through end.
+func newFilterPrefetcher(ctx context.Context, source filterSource, start, end int32, batchSize int, logger btclog.Logger) *filterPrefetcher {
+	return &filterPrefetcher{
+		ctx:       ctx,
+		source:    source,
+		start:     start,
+		end:       end,
+		batchSize: int32(batchSize),
+		logger:    logger,
+		batches:   make(map[int32]chan struct{}),
+	}
+}
+
+// newReverseFilterPrefetcher creates a prefetcher for a scan running from end
+// down to start.
+func newReverseFilterPrefetcher(ctx context.Context, source filterSource, start, end int32, batchSize int, logger btclog.Logger) *filterPrefetcher {
+	p := newFilterPrefetcher(ctx, source, start, end, batchSize, logger)
+	p.reverse = true
+	return p
+}
+
+// wait blocks until the batch containing height has been fetched and starts
+// fetching the following batch. A failed batch is not retried here; the
+// caller's own GetCFilter falls back to fetching the single filter.
+func (p *filterPrefetcher) wait(height int32) {
+	if p.batchSize <= 1 || height < p.start || height > p.end {
+		return
+	}
+
+	batch := (height - p.start) / p.batchSize
+	if p.reverse {
+		batch = (p.end - height) / p.batchSize
+	}
+	done := p.request(batch)
+	p.request(batch + 1)
+	<-done
+}
+
+// request starts fetching batch if it has not been requested yet and returns
+// a channel that is closed once it completes.
+func (p *filterPrefetcher) request(batch int32) <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if done, ok := p.batches[batch]; ok {
+		return done
+	}
+
+	done := make(chan struct{})
+	p.batches[batch] = done
+	// Workers only run a few heights apart, so old batches are never needed
+	delete(p.batches, batch-2)
+
+	// A forward batch is requested at its lowest height, a reverse batch at
+	// its highest, so neutrino fetches the filters the scan will need next
+	first := p.start + batch*p.batchSize
+	batchType := neutrino.OptimisticBatch()
+	size := min(p.batchSize, p.end-first+1)
+	if p.reverse {
+		first = p.end - batch*p.batchSize
+		batchType = neutrino.OptimisticReverseBatch()
+		size = min(p.batchSize, first-p.start+1)
+	}
+	if size <= 0 {
+		close(done)
+		return done
+	}
+
+	go func() {
+		defer close(done)
+
+		_, span := tracer.Start(p.ctx, "filter.prefetch", trace.WithAttributes(
+			attrHeight.Int(int(first)),
+			attribute.Int("neutrino.batch_size", int(size)),
+			attribute.Bool("neutrino.reverse", p.reverse),
+		))
+		hash, err := p.source.GetBlockHash(int64(first))
+		if err != nil {
+			p.logger.Debugf("Failed to get block hash for filter batch at %d: %v", first, err)
+			endSpan(span, err)
+			return
+		}
+
+		_, err = shareFetch(p.flights, batchFlight(*hash, size, p.reverse), func() (filter *gcs.Filter, err error) {
+			err = p.fill.run(int(size), func() error {
+				filter, err = p.source.GetCFilter(*hash, wire.GCSFilterRegular, batchType, neutrino.MaxBatchSize(int64(size)))
+				return err
+			})
+			return filter, err
+		})
+		if err != nil {
+			p.logger.Debugf("Failed to prefetch %d filters from height %d: %v", size, logging.KV("height", first), err)
+		}
+		endSpan(span, err)
+	}()
+
+	return done
+}
@@ -0,0 +1,325 @@
+package neutrino
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/gcs"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+	"github.com/lightninglabs/neutrino"
+)
+
+// testBlock returns a distinct block whose header nonce encodes height.
+func testBlock(height int32) *btcutil.Block {
+	return btcutil.NewBlock(&wire.MsgBlock{Header: wire.BlockHeader{Nonce: uint32(height)}})
+}
+
+func TestScanRangeOrdered(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+	}{
+		{"zero workers falls back to one", 0},
+		{"single worker", 1},
+		{"many workers", 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Out-of-order completion: later heights may finish first
+			fetch := func(height int32) *btcutil.Block {
+				time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+				if height%3 == 0 {
+					return nil
+				}
+				return testBlock(height)
+			}
+
+			next := int32(10)
+			apply := func(height int32, block *btcutil.Block) error {
+				if height != next {
+					t.Fatalf("applied height %d, want %d", height, next)
+				}
+				next++
+
+				if height%3 == 0 {
+					if block != nil {
+						t.Errorf("expected nil block at height %d", height)
+					}
+				} else if block == nil || int32(block.MsgBlock().Header.Nonce) != height {
+					t.Errorf("wrong block applied at height %d", height)
+				}
+				return nil
+			}
+
+			if err := scanRange(context.Background(), 10, 200, tt.workers, fetch, apply); err != nil {
+				t.Fatalf("scanRange() error = %v", err)
+			}
+
+			if next != 201 {
+				t.Errorf("expected to apply through height 200, stopped before %d", next)
+			}
+		})
+	}
+}
+
+func TestScanRangeStopsEarly(t *testing.T) {
+	var fetched atomic.Int32
+	fetch := func(height int32) *btcutil.Block {
+		fetched.Add(1)
+		return testBlock(height)
+	}
+
+	wantErr := errors.New("apply failed")
+
+	tests := []struct {
+		name    string
+		stopErr error
+		wantErr error
+	}{
+		{"stop sentinel returns nil", errStopScan, nil},
+		{"other errors are returned", wantErr, wantErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetched.Store(0)
+			var applied int32
+			apply := func(height int32, block *btcutil.Block) error {
+				applied++
+				if height == 5 {
+					return tt.stopErr
+				}
+				return nil
+			}
+
+			err := scanRange(context.Background(), 0, 100000, 4, fetch, apply)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("scanRange() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if applied != 6 {
+				t.Errorf("expected 6 applied heights, got %d", applied)
+			}
+
+			// Fetching is bounded to a small window ahead of the consumer
+			if n := fetched.Load(); n > 50 {
+				t.Errorf("fetched %d heights, expected fetching to stop shortly after the scan", n)
+			}
+		})
+	}
+}
+
+func TestScanRangeCanceled(t *testing.T) {
+	var fetched atomic.Int32
+	fetch := func(height int32) *btcutil.Block {
+		fetched.Add(1)
+		return testBlock(height)
+	}
+
+	// The client disconnects while height 5 is applied
+	ctx, cancel := context.WithCancel(context.Background())
+	var applied int32
+	apply := func(height int32, block *btcutil.Block) error {
+		applied++
+		if height == 5 {
+			cancel()
+		}
+		return nil
+	}
+
+	err := scanRange(ctx, 0, 100000, 4, fetch, apply)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("scanRange() error = %v, want %v", err, context.Canceled)
+	}
+	if applied != 6 {
+		t.Errorf("expected 6 applied heights, got %d", applied)
+	}
+	if n := fetched.Load(); n > 50 {
+		t.Errorf("fetched %d heights, expected fetching to stop shortly after the cancellation", n)
+	}
+
+	// A scan whose request is already gone fetches nothing
+	fetched.Store(0)
+	if err := scanRange(ctx, 0, 100, 4, fetch, apply); !errors.Is(err, context.Canceled) {
+		t.Fatalf("scanRange() error = %v, want %v", err, context.Canceled)
+	}
+	if n := fetched.Load(); n != 0 {
+		t.Errorf("fetched %d heights of a canceled scan, want none", n)
+	}
+}
+
+func TestDeadlineError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	err := deadlineError(scanRange(ctx, 0, 100, 4, testBlock, func(int32, *btcutil.Block) error { return nil }), 40)
+
+	var deadlineErr *ScanDeadlineError
+	if !errors.As(err, &deadlineErr) || deadlineErr.ResumeHeight != 40 {
+		t.Fatalf("deadlineError() = %v, want a ScanDeadlineError resuming at 40", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("ScanDeadlineError does not match context.DeadlineExceeded")
+	}
+
+	// Other errors are returned as they are
+	if err := deadlineError(context.Canceled, 40); err != context.Canceled {
+		t.Errorf("deadlineError(context.Canceled) = %v", err)
+	}
+}
+
+func TestScanRangeBackward(t *testing.T) {
+	fetch := func(height int32) *btcutil.Block {
+		time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+		return testBlock(height)
+	}
+
+	next := int32(200)
+	apply := func(height int32, block *btcutil.Block) error {
+		if height != next {
+			t.Fatalf("applied height %d, want %d", height, next)
+		}
+		if int32(block.MsgBlock().Header.Nonce) != height {
+			t.Errorf("wrong block applied at height %d", height)
+		}
+		next--
+		if height == 150 {
+			return errStopScan
+		}
+		return nil
+	}
+
+	if err := scanRangeBackward(context.Background(), 10, 200, 4, fetch, apply); err != nil {
+		t.Fatalf("scanRangeBackward() error = %v", err)
+	}
+
+	if next != 149 {
+		t.Errorf("expected to stop after height 150, next was %d", next)
+	}
+}
+
+func TestScanRangeEmpty(t *testing.T) {
+	called := false
+	apply := func(height int32, block *btcutil.Block) error {
+		called = true
+		return nil
+	}
+
+	if err := scanRange(context.Background(), 10, 9, 4, func(int32) *btcutil.Block { return nil }, apply); err != nil {
+		t.Fatalf("scanRange() error = %v", err)
+	}
+
+	if called {
+		t.Error("apply should not be called for an empty range")
+	}
+}
+
+// fakeFilterSource records the heights at which filter requests were made.
+type fakeFilterSource struct {
+	mu       sync.Mutex
+	requests []int32
+}
+
+func (f *fakeFilterSource) GetBlockHash(height int64) (*chainhash.Hash, error) {
+	var hash chainhash.Hash
+	hash[0], hash[1], hash[2] = byte(height), byte(height>>8), byte(height>>16)
+	return &hash, nil
+}
+
+func (f *fakeFilterSource) GetCFilter(blockHash chainhash.Hash, filterType wire.FilterType,
+	options ...neutrino.QueryOption) (*gcs.Filter, error) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	height := int32(blockHash[0]) | int32(blockHash[1])<<8 | int32(blockHash[2])<<16
+	f.requests = append(f.requests, height)
+	return nil, nil
+}
+
+func TestFilterPrefetcher(t *testing.T) {
+	tests := []struct {
+		name      string
+		start     int32
+		end       int32
+		batchSize int
+		want      []int32
+	}{
+		{"batches cover range", 10, 34, 10, []int32{10, 20, 30}},
+		{"single partial batch", 5, 7, 100, []int32{5}},
+		{"batching disabled", 0, 100, 1, nil},
+	}
+
+	reverseTests := []struct {
+		name      string
+		start     int32
+		end       int32
+		batchSize int
+		want      []int32
+	}{
+		{"reverse batches from the tip", 10, 34, 10, []int32{34, 24, 14}},
+		{"reverse single partial batch", 5, 7, 100, []int32{7}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &fakeFilterSource{}
+			prefetch := newFilterPrefetcher(context.Background(), source, tt.start, tt.end, tt.batchSize, btclog.Disabled)
+
+			err := scanRange(context.Background(), tt.start, tt.end, 4, func(height int32) *btcutil.Block {
+				prefetch.wait(height)
+				return nil
+			}, func(int32, *btcutil.Block) error { return nil })
+			if err != nil {
+				t.Fatalf("scanRange() error = %v", err)
+			}
+
+			source.assertRequests(t, tt.want)
+		})
+	}
+
+	for _, tt := range reverseTests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &fakeFilterSource{}
+			prefetch := newReverseFilterPrefetcher(context.Background(), source, tt.start, tt.end, tt.batchSize, btclog.Disabled)
+
+			err := scanRangeBackward(context.Background(), tt.start, tt.end, 4, func(height int32) *btcutil.Block {
+				prefetch.wait(height)
+				return nil
+			}, func(int32, *btcutil.Block) error { return nil })
+			if err != nil {
+				t.Fatalf("scanRangeBackward() error = %v", err)
+			}
+
+			source.assertRequests(t, tt.want)
+		})
+	}
+}
+
+// assertRequests checks that exactly the heights in want were requested.
+func (f *fakeFilterSource) assertRequests(t *testing.T, want []int32) {
+	t.Helper()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	seen := make(map[int32]bool)
+	for _, height := range f.requests {
+		seen[height] = true
+	}
+	if len(seen) != len(want) {
+		t.Fatalf("expected batch requests at %v, got %v", want, f.requests)
+	}
+	for _, height := range want {
+		if !seen[height] {
+			t.Errorf("missing batch request at height %d, got %v", height, f.requests)
+		}
+	}
+}
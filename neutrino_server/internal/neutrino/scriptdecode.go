@@ -0,0 +1,74 @@
+package neutrino
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// scriptTypes names the standard script classes in DecodedScript.
+var scriptTypes = map[txscript.ScriptClass]string{
+	txscript.PubKeyTy:              "p2pk",
+	txscript.PubKeyHashTy:          "p2pkh",
+	txscript.ScriptHashTy:          "p2sh",
+	txscript.WitnessV0PubKeyHashTy: "p2wpkh",
+	txscript.WitnessV0ScriptHashTy: "p2wsh",
+	txscript.WitnessV1TaprootTy:    "p2tr",
+	txscript.MultiSigTy:            "multisig",
+	txscript.NullDataTy:            "nulldata",
+	txscript.WitnessUnknownTy:      "witness_unknown",
+}
+
+// DecodedScript is a script with its disassembly and classification.
+// Address is set for scripts paying to a single address on the configured
+// network; bare multisig scripts list their keys instead.
+type DecodedScript struct {
+	Hex          string   `json:"hex"`
+	Asm          string   `json:"asm"`
+	Type         string   `json:"type"`
+	Address      string   `json:"address,omitempty"`
+	RequiredSigs int      `json:"required_sigs,omitempty"`
+	PubKeys      []string `json:"pubkeys,omitempty"`
+
+	// Error describes why a malformed script could not be fully
+	// disassembled. Asm then ends in "[error]".
+	Error string `json:"error,omitempty"`
+}
+
+// DecodeScript disassembles and classifies the hex-encoded script.
+func (n *Node) DecodeScript(scriptHex string) (*DecodedScript, error) {
+	script, err := hex.DecodeString(scriptHex)
+	if err != nil {
+		return nil, NewBadRequestError(fmt.Sprintf("invalid script hex: %v", err))
+	}
+	if len(script) > txscript.MaxScriptSize {
+		return nil, NewBadRequestError(fmt.Sprintf("script too large: %d bytes (max %d)", len(script), txscript.MaxScriptSize))
+	}
+
+	decoded := &DecodedScript{Hex: hex.EncodeToString(script), Type: "nonstandard"}
+	decoded.Asm, err = txscript.DisasmString(script)
+	if err != nil {
+		decoded.Error = err.Error()
+		return decoded, nil
+	}
+
+	class, addrs, requiredSigs, err := txscript.ExtractPkScriptAddrs(script, n.chainParams)
+	if err != nil {
+		return decoded, nil
+	}
+	if name, ok := scriptTypes[class]; ok {
+		decoded.Type = name
+	}
+
+	switch {
+	case class == txscript.MultiSigTy:
+		decoded.RequiredSigs = requiredSigs
+		for _, addr := range addrs {
+			decoded.PubKeys = append(decoded.PubKeys, hex.EncodeToString(addr.ScriptAddress()))
+		}
+	case len(addrs) == 1:
+		decoded.Address = addrs[0].EncodeAddress()
+	}
+	return decoded, nil
+}
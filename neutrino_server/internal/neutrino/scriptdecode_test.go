@@ -0,0 +1,58 @@
+package neutrino
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+func TestDecodeScript(t *testing.T) {
+	n := &Node{chainParams: &chaincfg.MainNetParams}
+
+	tests := []struct {
+		name     string
+		script   string
+		wantType string
+		wantAsm  string
+		wantAddr string
+		wantKeys int
+	}{
+		{"p2pkh", "76a914751e76e8199196d454941c45d1b3a323f1433bd688ac", "p2pkh", "OP_DUP OP_HASH160 751e76e8199196d454941c45d1b3a323f1433bd6 OP_EQUALVERIFY OP_CHECKSIG", "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH", 0},
+		{"p2sh", "a914748284390f9e263a4b766a75d0633c50426eb87587", "p2sh", "OP_HASH160 748284390f9e263a4b766a75d0633c50426eb875 OP_EQUAL", "3CK4fEwbMP7heJarmU4eqA3sMbVJyEnU3V", 0},
+		{"p2wpkh", "0014751e76e8199196d454941c45d1b3a323f1433bd6", "p2wpkh", "0 751e76e8199196d454941c45d1b3a323f1433bd6", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", 0},
+		{"p2tr", "5120a60869f0dbcf1dc659c9cecbaf8050135ea9e8cdc487053f1dc6880949dc684c", "p2tr", "1 a60869f0dbcf1dc659c9cecbaf8050135ea9e8cdc487053f1dc6880949dc684c", "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr", 0},
+		{"multisig", "51210279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f8179851ae", "multisig", "1 0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798 1 OP_CHECKMULTISIG", "", 1},
+		{"nulldata", "6a0568656c6c6f", "nulldata", "OP_RETURN 68656c6c6f", "", 0},
+		{"nonstandard", "51", "nonstandard", "1", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := n.DecodeScript(tt.script)
+			if err != nil {
+				t.Fatalf("DecodeScript() failed: %v", err)
+			}
+			if decoded.Type != tt.wantType || decoded.Asm != tt.wantAsm || decoded.Address != tt.wantAddr || len(decoded.PubKeys) != tt.wantKeys {
+				t.Errorf("DecodeScript() = %+v", decoded)
+			}
+		})
+	}
+
+	// A push running past the end of the script is disassembled up to it
+	decoded, err := n.DecodeScript("4c05ab")
+	if err != nil {
+		t.Fatalf("DecodeScript() of a truncated push failed: %v", err)
+	}
+	if decoded.Type != "nonstandard" || !strings.HasSuffix(decoded.Asm, "[error]") || decoded.Error == "" {
+		t.Errorf("DecodeScript() of a truncated push = %+v", decoded)
+	}
+
+	for _, script := range []string{"zz", strings.Repeat("51", 10001)} {
+		var badRequest *BadRequestError
+		if _, err := n.DecodeScript(script); !errors.As(err, &badRequest) {
+			t.Errorf("DecodeScript(%.8s...) error = %v, want a bad request", script, err)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package neutrino
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// maxSpendSubscriptions bounds the outpoints subscribed to at once.
+const maxSpendSubscriptions = 1000
+
+// SpendSubscription asks to be notified when an outpoint is spent.
+type SpendSubscription struct {
+	TxID string `json:"txid"`
+	Vout uint32 `json:"vout"`
+
+	// ScriptPubKey is the hex script paid by the outpoint. Block filters
+	// match it for the transaction spending the outpoint.
+	ScriptPubKey string `json:"script_pubkey"`
+
+	// ScannedHeight is the height through which blocks have been searched
+	// for the spend.
+	ScannedHeight int32 `json:"scanned_height"`
+
+	Spent bool `json:"spent"`
+	Spend
+
+	// SpendingBlockHash is the hash of the block at SpendingHeight, checked
+	// against the best chain to notice the spend being reorged out.
+	SpendingBlockHash string `json:"spending_block_hash,omitempty"`
+
+	CreatedAt int64 `json:"created_at"`
+}
+
+// Outpoint returns the "txid:vout" key of the subscribed outpoint.
+func (s SpendSubscription) Outpoint() string {
+	return fmt.Sprintf("%s:%d", s.TxID, s.Vout)
+}
+
+// refresh checks that the spend of s is still in the best chain, whose tip is
+// at tip and where hashAt returns the hash at a height. A spend whose block
+// left the best chain is forgotten and searched for again from its height.
+// refresh reports whether s changed.
+func (s *SpendSubscription) refresh(tip int32, hashAt func(height int32) (string, error)) (bool, error) {
+	if !s.Spent {
+		return false, nil
+	}
+
+	var hash string
+	if s.SpendingHeight <= tip {
+		var err error
+		if hash, err = hashAt(s.SpendingHeight); err != nil {
+			return false, err
+		}
+	}
+	if s.SpendingBlockHash == "" && hash != "" {
+		// Spends reported from a rescan or a lookup did not record their
+		// block, so the current one is taken as theirs
+		s.SpendingBlockHash = hash
+		return true, nil
+	}
+	if hash == s.SpendingBlockHash {
+		return false, nil
+	}
+
+	s.ScannedHeight = min(s.ScannedHeight, s.SpendingHeight-1)
+	s.Spent = false
+	s.Spend = Spend{}
+	s.SpendingBlockHash = ""
+	return true, nil
+}
+
+// spendSubscriptions holds the outpoints subscribed to for spends.
+type spendSubscriptions struct {
+	mu   sync.Mutex
+	subs map[string]SpendSubscription
+
+	// wake asks the watch loop to check subscriptions now, after a new
+	// block or a new subscription.
+	wake chan struct{}
+}
+
+// restoreSpendSubscriptions loads spend subscriptions from the store.
+func (n *Node) restoreSpendSubscriptions() error {
+	n.spends = &spendSubscriptions{
+		subs: make(map[string]SpendSubscription),
+		wake: make(chan struct{}, 1),
+	}
+	if n.store == nil {
+		return nil
+	}
+
+	subs, err := n.store.SpendSubscriptions()
+	if err != nil {
+		return fmt.Errorf("failed to load spend subscriptions: %w", err)
+	}
+	n.spends.subs = subs
+	return nil
+}
+
+// wakeSpendWatcher schedules a check of the spend subscriptions.
+func (n *Node) wakeSpendWatcher() {
+	if n.spends == nil {
+		return
+	}
+	select {
+	case n.spends.wake <- struct{}{}:
+	default:
+	}
+}
+
+// SubscribeSpend subscribes to the spend of txid:vout, which pays the hex
+// scriptPubKey. Blocks are searched from startHeight, or only new blocks if
+// negative. The spend is delivered to spend webhooks and reported by
+// SpendSubscriptions.
+func (n *Node) SubscribeSpend(txid string, vout uint32, scriptPubKey string, startHeight int32) (*SpendSubscription, error) {
+	if n.chainService == nil || n.spends == nil {
+		return nil, errors.New("chain service not initialized")
+	}
+
+	hash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		return nil, NewBadRequestError(fmt.Sprintf("invalid txid: %v", err))
+	}
+	pkScript, err := hex.DecodeString(scriptPubKey)
+	if err != nil || len(pkScript) == 0 || len(pkScript) > txscript.MaxScriptSize {
+		return nil, NewBadRequestError("invalid script_pubkey")
+	}
+
+	bestBlock, err := n.chainService.BestBlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get best block: %w", err)
+	}
+	if startHeight < 0 {
+		startHeight = bestBlock.Height + 1
+	}
+	if startHeight > bestBlock.Height+1 {
+		return nil, NewBadRequestError(fmt.Sprintf("start_height %d is above the tip %d", startHeight, bestBlock.Height))
+	}
+
+	sub := SpendSubscription{
+		TxID:          hash.String(),
+		Vout:          vout,
+		ScriptPubKey:  strings.ToLower(scriptPubKey),
+		ScannedHeight: startHeight - 1,
+		CreatedAt:     time.Now().Unix(),
+	}
+
+	// A spend already found by a rescan or a lookup is reported at once
+	if n.store != nil {
+		status, found, err := n.store.Outpoint(sub.Outpoint())
+		if err != nil {
+			return nil, err
+		}
+		if found && status.Spent && status.SpendingTxID != "" {
+			sub.Spent = true
+			sub.Spend = status.Spend
+			sub.ScannedHeight = status.SpendingHeight
+		}
+	}
+
+	n.spends.mu.Lock()
+	if existing, ok := n.spends.subs[sub.Outpoint()]; ok {
+		n.spends.mu.Unlock()
+		return &existing, nil
+	}
+	if len(n.spends.subs) >= maxSpendSubscriptions {
+		n.spends.mu.Unlock()
+		return nil, NewBadRequestError(fmt.Sprintf("too many spend subscriptions (max %d)", maxSpendSubscriptions))
+	}
+	n.spends.subs[sub.Outpoint()] = sub
+	n.spends.mu.Unlock()
+
+	if n.store != nil {
+		if err := n.store.PutSpendSubscription(sub); err != nil {
+			return nil, fmt.Errorf("failed to persist spend subscription: %w", err)
+		}
+	}
+
+	if sub.Spent {
+		n.notifySpend(sub)
+	} else {
+		n.wakeSpendWatcher()
+	}
+	return &sub, nil
+}
+
+// SpendSubscriptions lists the spend subscriptions ordered by outpoint.
+func (n *Node) SpendSubscriptions() ([]SpendSubscription, error) {
+	if n.spends == nil {
+		return nil, errors.New("chain service not initialized")
+	}
+
+	n.spends.mu.Lock()
+	defer n.spends.mu.Unlock()
+	subs := make([]SpendSubscription, 0, len(n.spends.subs))
+	for _, sub := range n.spends.subs {
+		subs = append(subs, sub)
+	}
+	slices.SortFunc(subs, func(a, b SpendSubscription) int {
+		return strings.Compare(a.Outpoint(), b.Outpoint())
+	})
+	return subs, nil
+}
+
+// UnsubscribeSpend removes the spend subscription for txid:vout.
+func (n *Node) UnsubscribeSpend(txid string, vout uint32) error {
+	if n.spends == nil {
+		return errors.New("chain service not initialized")
+	}
+
+	hash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		return NewBadRequestError(fmt.Sprintf("invalid txid: %v", err))
+	}
+	key := fmt.Sprintf("%s:%d", hash, vout)
+
+	n.spends.mu.Lock()
+	defer n.spends.mu.Unlock()
+	if _, ok := n.spends.subs[key]; !ok {
+		return NewNotFoundError("outpoint", fmt.Sprintf("outpoint %s has no spend subscription", key))
+	}
+	if n.store != nil {
+		if err := n.store.DeleteSpendSubscription(key); err != nil {
+			return fmt.Errorf("failed to delete spend subscription: %w", err)
+		}
+	}
+	delete(n.spends.subs, key)
+	return nil
+}
+
+// watchSpends checks the subscriptions when woken by a new block or
+// subscription, and at trackCheckInterval in case a wake-up was missed.
+func (n *Node) watchSpends() {
+	ticker := time.NewTicker(trackCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		n.spends.mu.Lock()
+		subs := make([]SpendSubscription, 0, len(n.spends.subs))
+		for _, sub := range n.spends.subs {
+			subs = append(subs, sub)
+		}
+		n.spends.mu.Unlock()
+
+		if len(subs) > 0 {
+			n.checkSpends(n.lifetime, subs)
+		}
+
+		select {
+		case <-n.lifetime.Done():
+			return
+		case <-ticker.C:
+		case <-n.spends.wake:
+		}
+	}
+}
+
+// checkSpends reverts the found spends of subs that a reorg removed, searches
+// the blocks above each unspent subscription's scanned height for its spend
+// until ctx is done, persists the progress and notifies found spends.
+func (n *Node) checkSpends(ctx context.Context, subs []SpendSubscription) {
+	blockHeight, filterHeight, err := n.scanTip()
+	if err != nil {
+		n.logger.Warnf("Failed to get the chain tip for spend subscriptions: %v", err)
+		return
+	}
+
+	for _, sub := range subs {
+		before := sub
+		if _, err := sub.refresh(blockHeight, n.blockHashAt); err != nil {
+			n.logger.Debugf("Failed to check the spend of %s: %v", sub.Outpoint(), err)
+			continue
+		}
+		if before.Spent && !sub.Spent {
+			n.logger.Warnf("Spend of subscribed outpoint %s by %s left the best chain in a reorg",
+				sub.Outpoint(), before.SpendingTxID)
+		}
+
+		if !sub.Spent {
+			endHeight, err := scanEnd(sub.ScannedHeight+1, 0, blockHeight, filterHeight)
+			if err == nil {
+				checkpoint := func() { n.saveSpendProgress(sub.Outpoint(), sub.ScannedHeight) }
+				err = n.findSpend(ctx, &sub, endHeight, checkpoint)
+			}
+			if err != nil {
+				n.logger.Debugf("Failed to search for the spend of %s: %v", sub.Outpoint(), err)
+			}
+		}
+		if sub == before {
+			continue
+		}
+		if !n.putSpendSubscription(sub) {
+			continue
+		}
+		if sub.Spent && !before.Spent {
+			n.notifySpend(sub)
+		}
+	}
+}
+
+// putSpendSubscription stores the updated sub, reporting false if it was
+// unsubscribed while it was being checked.
+func (n *Node) putSpendSubscription(sub SpendSubscription) bool {
+	n.spends.mu.Lock()
+	if _, ok := n.spends.subs[sub.Outpoint()]; !ok {
+		n.spends.mu.Unlock()
+		return false
+	}
+	n.spends.subs[sub.Outpoint()] = sub
+	n.spends.mu.Unlock()
+
+	if n.store != nil {
+		if err := n.store.PutSpendSubscription(sub); err != nil {
+			n.logger.Warnf("Failed to persist spend subscription %s: %v", sub.Outpoint(), err)
+		}
+	}
+	return true
+}
+
+// saveSpendProgress persists that the search for the spend of outpoint has
+// scanned through scanned.
+func (n *Node) saveSpendProgress(outpoint string, scanned int32) {
+	n.spends.mu.Lock()
+	sub, ok := n.spends.subs[outpoint]
+	n.spends.mu.Unlock()
+	if !ok || sub.Spent || sub.ScannedHeight >= scanned {
+		return
+	}
+	sub.ScannedHeight = scanned
+	n.putSpendSubscription(sub)
+}
+
+// findSpend searches the blocks above sub.ScannedHeight through tip whose
+// filters match the subscribed script, calling checkpoint as the search
+// advances. The search stops at the first block whose filter or block cannot
+// be fetched, so it is retried on the next check.
+func (n *Node) findSpend(ctx context.Context, sub *SpendSubscription, tip int32, checkpoint func()) error {
+	pkScript, err := hex.DecodeString(sub.ScriptPubKey)
+	if err != nil {
+		return err
+	}
+	txHash, err := chainhash.NewHashFromStr(sub.TxID)
+	if err != nil {
+		return err
+	}
+
+	found := func(height int32, block *btcutil.Block) bool {
+		for _, tx := range block.Transactions() {
+			for inputIdx, txIn := range tx.MsgTx().TxIn {
+				prevOut := txIn.PreviousOutPoint
+				if prevOut.Hash.IsEqual(txHash) && prevOut.Index == sub.Vout {
+					sub.Spent = true
+					sub.Spend = Spend{
+						SpendingTxID:   tx.Hash().String(),
+						SpendingInput:  uint32(inputIdx),
+						SpendingHeight: height,
+					}
+					sub.SpendingBlockHash = block.Hash().String()
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return searchBlocks(ctx, &sub.ScannedHeight, tip, n.config.ScanWorkers, n.blockMatching([][]byte{pkScript}), found, checkpoint)
+}
+
+// notifySpend delivers a found spend to spend webhooks and checks it for a
+// double spend of a broadcast transaction.
+func (n *Node) notifySpend(sub SpendSubscription) {
+	n.logger.Infof("Subscribed outpoint %s spent by %s:%d at height %d",
+		sub.Outpoint(), sub.SpendingTxID, sub.SpendingInput, logging.KV("height", sub.SpendingHeight))
+	if n.webhooks != nil {
+		n.webhooks.Dispatch(WebhookSpend, "", sub)
+	}
+	n.checkSpendConflict(sub)
+}
@@ -0,0 +1,128 @@
+package neutrino
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+)
+
+func TestSpendSubscriptionsRestoreAndRemove(t *testing.T) {
+	store := newTestStore(t)
+
+	txid := "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16"
+	pending := SpendSubscription{TxID: txid, Vout: 0, ScriptPubKey: "00", ScannedHeight: 169}
+	spent := SpendSubscription{
+		TxID:          txid,
+		Vout:          1,
+		ScriptPubKey:  "00",
+		ScannedHeight: 200,
+		Spent:         true,
+		Spend:         Spend{SpendingTxID: "ea44e97271691990157559d0bdd9959e02790c34db6c006d779e82fa5aee708e", SpendingInput: 2, SpendingHeight: 200},
+	}
+	for _, sub := range []SpendSubscription{spent, pending} {
+		if err := store.PutSpendSubscription(sub); err != nil {
+			t.Fatalf("PutSpendSubscription() failed: %v", err)
+		}
+	}
+
+	n := &Node{store: store, logger: btclog.Disabled}
+	if err := n.restoreSpendSubscriptions(); err != nil {
+		t.Fatalf("restoreSpendSubscriptions() failed: %v", err)
+	}
+
+	subs, err := n.SpendSubscriptions()
+	if err != nil {
+		t.Fatalf("SpendSubscriptions() failed: %v", err)
+	}
+	if len(subs) != 2 || subs[0] != pending || subs[1] != spent {
+		t.Fatalf("SpendSubscriptions() = %+v, want %s:0 then %s:1", subs, txid, txid)
+	}
+
+	if err := n.UnsubscribeSpend(txid, 0); err != nil {
+		t.Fatalf("UnsubscribeSpend() failed: %v", err)
+	}
+	var notFoundErr *NotFoundError
+	if err := n.UnsubscribeSpend(txid, 0); !errors.As(err, &notFoundErr) {
+		t.Errorf("second UnsubscribeSpend() error = %v, want NotFoundError", err)
+	}
+	var badRequestErr *BadRequestError
+	if err := n.UnsubscribeSpend("not-a-txid", 0); !errors.As(err, &badRequestErr) {
+		t.Errorf("UnsubscribeSpend(not-a-txid) error = %v, want BadRequestError", err)
+	}
+
+	persisted, err := store.SpendSubscriptions()
+	if err != nil {
+		t.Fatalf("store SpendSubscriptions() failed: %v", err)
+	}
+	if len(persisted) != 1 || persisted[spent.Outpoint()] != spent {
+		t.Errorf("persisted subscriptions = %+v, want only %s", persisted, spent.Outpoint())
+	}
+}
+
+func TestSpendSubscriptionRefresh(t *testing.T) {
+	chain := map[int32]string{100: "aa", 101: "bb", 102: "cc"}
+	hashAt := func(height int32) (string, error) {
+		hash, ok := chain[height]
+		if !ok {
+			return "", errors.New("height not in chain")
+		}
+		return hash, nil
+	}
+	spend := Spend{SpendingTxID: "dd", SpendingInput: 1, SpendingHeight: 101}
+
+	tests := []struct {
+		name        string
+		sub         SpendSubscription
+		tip         int32
+		want        SpendSubscription
+		wantChanged bool
+	}{
+		{
+			name: "not spent",
+			sub:  SpendSubscription{ScannedHeight: 102},
+			tip:  102,
+			want: SpendSubscription{ScannedHeight: 102},
+		},
+		{
+			name: "spend still in the best chain",
+			sub:  SpendSubscription{ScannedHeight: 101, Spent: true, Spend: spend, SpendingBlockHash: "bb"},
+			tip:  102,
+			want: SpendSubscription{ScannedHeight: 101, Spent: true, Spend: spend, SpendingBlockHash: "bb"},
+		},
+		{
+			name: "spend without a block hash takes the current one",
+			sub:  SpendSubscription{ScannedHeight: 101, Spent: true, Spend: spend},
+			tip:  102,
+			want: SpendSubscription{ScannedHeight: 101, Spent: true, Spend: spend, SpendingBlockHash: "bb"}, wantChanged: true,
+		},
+		{
+			name: "spending block replaced",
+			sub:  SpendSubscription{ScannedHeight: 101, Spent: true, Spend: spend, SpendingBlockHash: "b2"},
+			tip:  102,
+			want: SpendSubscription{ScannedHeight: 100}, wantChanged: true,
+		},
+		{
+			name: "spending block above the tip",
+			sub:  SpendSubscription{ScannedHeight: 101, Spent: true, Spend: spend, SpendingBlockHash: "bb"},
+			tip:  100,
+			want: SpendSubscription{ScannedHeight: 100}, wantChanged: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := tt.sub
+			changed, err := sub.refresh(tt.tip, hashAt)
+			if err != nil {
+				t.Fatalf("refresh() failed: %v", err)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("refresh() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if sub != tt.want {
+				t.Errorf("refresh() = %+v, want %+v", sub, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package neutrino
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// DefaultStallTimeout is how long the header or filter height may stand
+// still while peers are ahead before sync counts as stalled.
+const DefaultStallTimeout = 20 * time.Minute
+
+// Recoveries from a sync stall, see Config.StallRecovery.
+const (
+	// StallRecoveryNone only reports stalls.
+	StallRecoveryNone = "none"
+
+	// StallRecoveryRotate disconnects every peer found through discovery,
+	// so that peer discovery connects to new ones.
+	StallRecoveryRotate = "rotate"
+
+	// StallRecoveryRestart restarts the daemon, giving neutrino a fresh
+	// chain service, which it cannot restart in place.
+	StallRecoveryRestart = "restart"
+)
+
+// SyncStall describes a stalled sync. It is the payload of WebhookSyncStalled
+// deliveries and shown in Status while sync is stalled.
+type SyncStall struct {
+	HeaderHeight int32 `json:"header_height"`
+	FilterHeight int32 `json:"filter_height"`
+	PeerHeight   int32 `json:"peer_height"`
+	Peers        int   `json:"peers"`
+
+	// Since is when the heights last advanced.
+	Since    int64  `json:"since"`
+	Recovery string `json:"recovery"`
+}
+
+// syncSample is the sync state the watchdog checks.
+type syncSample struct {
+	headerHeight int32
+	filterHeight int32
+	peerHeight   int32
+	peers        int
+}
+
+// behind reports whether the node has anything left to sync from its peers.
+func (s syncSample) behind() bool {
+	return s.peers > 0 && (s.headerHeight < s.peerHeight || s.filterHeight < s.headerHeight)
+}
+
+// stallWatchdog detects sync stalls: neither the header nor the filter
+// height advancing for timeout while peers are ahead or filters lag the
+// headers.
+type stallWatchdog struct {
+	timeout time.Duration
+
+	mu       sync.Mutex
+	last     syncSample
+	progress time.Time
+	stall    *SyncStall
+	stalls   uint64
+}
+
+// check records sample, taken at now, and returns a stall once sync has not
+// advanced for the timeout, and again after every further timeout it stays
+// stalled. resumed is set when a stall ends.
+func (w *stallWatchdog) check(now time.Time, sample syncSample) (stall *SyncStall, resumed bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	advanced := sample.headerHeight > w.last.headerHeight || sample.filterHeight > w.last.filterHeight
+	w.last = sample
+	if advanced || !sample.behind() || w.progress.IsZero() {
+		w.progress = now
+		resumed = w.stall != nil
+		w.stall = nil
+		return nil, resumed
+	}
+	if now.Sub(w.progress) < w.timeout {
+		return nil, false
+	}
+
+	since := w.progress
+	if w.stall != nil {
+		since = time.Unix(w.stall.Since, 0)
+	}
+	w.stall = &SyncStall{
+		HeaderHeight: sample.headerHeight,
+		FilterHeight: sample.filterHeight,
+		PeerHeight:   sample.peerHeight,
+		Peers:        sample.peers,
+		Since:        since.Unix(),
+	}
+	w.stalls++
+	// Recover again if sync is still stalled after another timeout
+	w.progress = now
+	snapshot := *w.stall
+	return &snapshot, false
+}
+
+// current returns the stall in progress, or nil.
+func (w *stallWatchdog) current() *SyncStall {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stall == nil {
+		return nil
+	}
+	snapshot := *w.stall
+	return &snapshot
+}
+
+// count returns the number of stalls detected.
+func (w *stallWatchdog) count() uint64 {
+	if w == nil {
+		return 0
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stalls
+}
+
+// syncSample samples the header and filter tips and the best height peers
+// announced.
+func (n *Node) syncSample() (syncSample, error) {
+	headerHeight, filterHeight, err := n.scanTip()
+	if err != nil {
+		return syncSample{}, err
+	}
+
+	sample := syncSample{headerHeight: headerHeight, filterHeight: filterHeight}
+	for _, peer := range n.chainService.Peers() {
+		if peer.Connected() {
+			sample.peers++
+			sample.peerHeight = max(sample.peerHeight, peer.LastBlock())
+		}
+	}
+	return sample, nil
+}
+
+// watchSyncStalls checks for sync stalls every tenth of the stall timeout,
+// reporting them and recovering as configured, until the node stops.
+func (n *Node) watchSyncStalls() {
+	ticker := time.NewTicker(max(n.stalls.timeout/10, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.lifetime.Done():
+			return
+		case <-ticker.C:
+		}
+		sample, err := n.syncSample()
+		if err != nil {
+			n.logger.Warnf("Failed to check sync progress: %v", err)
+			continue
+		}
+		stall, resumed := n.stalls.check(time.Now(), sample)
+		if resumed {
+			n.logger.Infof("Sync resumed at block %d, filters at %d", logging.KV("height", sample.headerHeight), sample.filterHeight)
+		}
+		if stall == nil {
+			continue
+		}
+
+		stall.Recovery = n.config.stallRecovery()
+		n.logger.Errorf("SYNC STALLED: headers at %d and filters at %d have not advanced since %s, with %d peers at up to %d (recovery: %s)",
+			stall.HeaderHeight, stall.FilterHeight, time.Unix(stall.Since, 0).UTC().Format(time.RFC3339),
+			stall.Peers, stall.PeerHeight, stall.Recovery)
+		if n.webhooks != nil {
+			n.webhooks.Dispatch(WebhookSyncStalled, "", stall)
+		}
+		n.recoverStall(stall.Recovery)
+	}
+}
+
+// recoverStall applies the recovery configured for sync stalls.
+func (n *Node) recoverStall(recovery string) {
+	switch recovery {
+	case StallRecoveryRotate:
+		rotated := 0
+		for _, addr := range n.connectedPeers() {
+			if err := n.chainService.DisconnectNodeByAddr(addr); err == nil {
+				rotated++
+			}
+		}
+		n.logger.Warnf("Disconnected %d peers to find new ones", rotated)
+
+	case StallRecoveryRestart:
+		n.restartOnce.Do(func() {
+			n.logger.Warn("Restarting to recover from the sync stall")
+			close(n.restart)
+		})
+	}
+}
+
+// Restart is closed when the node needs the daemon to restart it, as
+// StallRecoveryRestart does.
+func (n *Node) Restart() <-chan struct{} {
+	return n.restart
+}
+
+// stallTimeout returns the configured stall timeout.
+func (c *Config) stallTimeout() time.Duration {
+	if c.StallTimeout > 0 {
+		return c.StallTimeout
+	}
+	return DefaultStallTimeout
+}
+
+// stallRecovery returns the configured stall recovery.
+func (c *Config) stallRecovery() string {
+	if c.StallRecovery != "" {
+		return c.StallRecovery
+	}
+	return StallRecoveryNone
+}
+
+// checkStallRecovery checks that recovery names a stall recovery.
+func checkStallRecovery(recovery string) error {
+	switch recovery {
+	case "", StallRecoveryNone, StallRecoveryRotate, StallRecoveryRestart:
+		return nil
+	}
+	return fmt.Errorf("invalid stall recovery %q: use %s, %s or %s", recovery, StallRecoveryNone, StallRecoveryRotate, StallRecoveryRestart)
+}
@@ -0,0 +1,70 @@
+package neutrino
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStallWatchdog(t *testing.T) {
+	w := &stallWatchdog{timeout: 10 * time.Minute}
+	start := time.Unix(1700000000, 0)
+	behind := syncSample{headerHeight: 100, filterHeight: 100, peerHeight: 200, peers: 2}
+
+	steps := []struct {
+		name    string
+		after   time.Duration
+		sample  syncSample
+		stall   bool
+		resumed bool
+	}{
+		{"first sample", 0, behind, false, false},
+		{"stuck within timeout", 9 * time.Minute, behind, false, false},
+		{"stuck past timeout", 11 * time.Minute, behind, true, false},
+		{"still stuck", 15 * time.Minute, behind, false, false},
+		{"stuck another timeout", 22 * time.Minute, behind, true, false},
+		{"headers advance", 23 * time.Minute, syncSample{headerHeight: 150, filterHeight: 100, peerHeight: 200, peers: 2}, false, true},
+		{"filters lag", 40 * time.Minute, syncSample{headerHeight: 150, filterHeight: 100, peerHeight: 200, peers: 2}, true, false},
+		{"caught up", 41 * time.Minute, syncSample{headerHeight: 200, filterHeight: 200, peerHeight: 200, peers: 2}, false, true},
+		{"no new blocks", 90 * time.Minute, syncSample{headerHeight: 200, filterHeight: 200, peerHeight: 200, peers: 2}, false, false},
+		{"no peers", 200 * time.Minute, syncSample{headerHeight: 200, filterHeight: 200}, false, false},
+	}
+	for _, step := range steps {
+		stall, resumed := w.check(start.Add(step.after), step.sample)
+		if (stall != nil) != step.stall || resumed != step.resumed {
+			t.Fatalf("%s: check() = %+v, %v; want stall %v, resumed %v", step.name, stall, resumed, step.stall, step.resumed)
+		}
+	}
+	if got := w.count(); got != 3 {
+		t.Errorf("count() = %d, want 3", got)
+	}
+	if got := w.current(); got != nil {
+		t.Errorf("current() = %+v after sync caught up, want nil", got)
+	}
+}
+
+func TestStallSince(t *testing.T) {
+	w := &stallWatchdog{timeout: time.Minute}
+	start := time.Unix(1700000000, 0)
+	sample := syncSample{headerHeight: 10, filterHeight: 5, peerHeight: 10, peers: 1}
+
+	w.check(start, sample)
+	w.check(start.Add(2*time.Minute), sample)
+	stall, _ := w.check(start.Add(4*time.Minute), sample)
+	if stall == nil || stall.Since != start.Unix() || stall.FilterHeight != 5 || stall.Peers != 1 {
+		t.Errorf("check() = %+v, want a stall since the last progress", stall)
+	}
+	if current := w.current(); current == nil || current.Since != start.Unix() {
+		t.Errorf("current() = %+v, want the stall in progress", current)
+	}
+}
+
+func TestCheckStallRecovery(t *testing.T) {
+	for _, recovery := range []string{"", StallRecoveryNone, StallRecoveryRotate, StallRecoveryRestart} {
+		if err := checkStallRecovery(recovery); err != nil {
+			t.Errorf("checkStallRecovery(%q) failed: %v", recovery, err)
+		}
+	}
+	if err := checkStallRecovery("reboot"); err == nil {
+		t.Error("checkStallRecovery() of an unknown recovery should fail")
+	}
+}
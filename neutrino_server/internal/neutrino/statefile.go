@@ -0,0 +1,174 @@
+package neutrino
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// stateFileName is the name of the shutdown state file in the data directory.
+const stateFileName = "state.json"
+
+// Node lifecycle states recorded in the state file.
+const (
+	nodeStateRunning = "running"
+	nodeStateStopped = "stopped"
+)
+
+// NodeState is the content of the state file. It is marked running on start
+// and rewritten with the final chain and scan state on clean shutdown, so a
+// running state found on start means the previous process did not stop
+// cleanly.
+type NodeState struct {
+	State        string      `json:"state"`
+	PID          int         `json:"pid"`
+	StartedAt    int64       `json:"started_at"`
+	StoppedAt    int64       `json:"stopped_at,omitempty"`
+	BlockHeight  int32       `json:"block_height"`
+	FilterHeight int32       `json:"filter_height"`
+	ActiveJobs   []RescanJob `json:"active_jobs,omitempty"`
+}
+
+// CrashReport describes an unclean shutdown detected on start. It is logged
+// and recorded as an EventUncleanShutdown event.
+type CrashReport struct {
+	// PID and StartedAt identify the process that did not stop cleanly.
+	PID       int   `json:"pid"`
+	StartedAt int64 `json:"started_at"`
+	// DetectedAt is when the restarted node found the stale state file.
+	DetectedAt int64 `json:"detected_at"`
+	// BlockHeight and FilterHeight are the persisted chain tips on recovery.
+	BlockHeight  int32 `json:"block_height"`
+	FilterHeight int32 `json:"filter_height"`
+	// InterruptedJobs are the rescan jobs left unfinished; their results may
+	// be incomplete until they are resumed.
+	InterruptedJobs []RescanJob `json:"interrupted_jobs"`
+}
+
+// readNodeState reads the state file in dataDir. It returns nil if there is no
+// state file, as on first start.
+func readNodeState(dataDir string) (*NodeState, error) {
+	data, err := os.ReadFile(filepath.Join(dataDir, stateFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var state NodeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode state file: %w", err)
+	}
+	return &state, nil
+}
+
+// writeNodeState atomically replaces the state file in dataDir.
+func writeNodeState(dataDir string, state *NodeState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state file: %w", err)
+	}
+
+	path := filepath.Join(dataDir, stateFileName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
+
+// recoverState checks the state file left by the previous process, reports an
+// unclean shutdown if it was still marked running, and marks this process as
+// running. It must be called once the store and rescan manager are ready.
+func (n *Node) recoverState() {
+	previous, err := readNodeState(n.config.DataDir)
+	if err != nil {
+		n.logger.Warnf("Ignoring unreadable state file: %v", err)
+	}
+
+	if previous != nil && previous.State == nodeStateRunning {
+		n.reportUncleanShutdown(previous)
+	}
+
+	n.startedAt = time.Now().Unix()
+	state := &NodeState{
+		State:     nodeStateRunning,
+		PID:       os.Getpid(),
+		StartedAt: n.startedAt,
+	}
+	if err := writeNodeState(n.config.DataDir, state); err != nil {
+		n.logger.Warnf("Failed to mark node running: %v", err)
+	}
+}
+
+// reportUncleanShutdown logs and records a crash report for the process
+// described by previous.
+func (n *Node) reportUncleanShutdown(previous *NodeState) {
+	report := CrashReport{
+		PID:        previous.PID,
+		StartedAt:  previous.StartedAt,
+		DetectedAt: time.Now().Unix(),
+	}
+
+	if bestBlock, err := n.chainService.BestBlock(); err == nil {
+		report.BlockHeight = bestBlock.Height
+	}
+	if header, height, err := n.chainService.RegFilterHeaders.ChainTip(); err == nil && header != nil {
+		report.FilterHeight = int32(height)
+	}
+
+	jobs, err := n.store.RescanJobs()
+	if err != nil {
+		n.logger.Warnf("Failed to load interrupted rescan jobs: %v", err)
+	}
+	report.InterruptedJobs = jobs
+
+	jobIDs := make([]uint64, 0, len(jobs))
+	for _, job := range jobs {
+		jobIDs = append(jobIDs, job.ID)
+	}
+
+	n.logger.Warnf("Unclean shutdown detected: pid=%d started_at=%s block_height=%d filter_height=%d "+
+		"interrupted_jobs=%v; scan results of interrupted jobs may be incomplete until they are resumed",
+		report.PID, time.Unix(report.StartedAt, 0).UTC().Format(time.RFC3339),
+		logging.KV("height", report.BlockHeight), report.FilterHeight, jobIDs)
+
+	n.rescanMgr.emitToAllWallets(EventUncleanShutdown, report)
+}
+
+// saveCleanShutdown records the final chain and scan state in the state file.
+// It must be called before the database is closed.
+func (n *Node) saveCleanShutdown() {
+	n.mu.RLock()
+	state := &NodeState{
+		State:        nodeStateStopped,
+		PID:          os.Getpid(),
+		StartedAt:    n.startedAt,
+		StoppedAt:    time.Now().Unix(),
+		BlockHeight:  n.blockHeight,
+		FilterHeight: n.filterHeight,
+	}
+	n.mu.RUnlock()
+
+	if n.store != nil {
+		jobs, err := n.store.RescanJobs()
+		if err != nil {
+			n.logger.Warnf("Failed to load active rescan jobs: %v", err)
+		}
+		state.ActiveJobs = jobs
+	}
+
+	if err := writeNodeState(n.config.DataDir, state); err != nil {
+		n.logger.Warnf("Failed to write shutdown state: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package neutrino
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNodeStateFile(t *testing.T) {
+	dir := t.TempDir()
+
+	// First start has no state file
+	state, err := readNodeState(dir)
+	if err != nil || state != nil {
+		t.Fatalf("readNodeState() = %+v, %v; want nil, nil", state, err)
+	}
+
+	want := &NodeState{
+		State:        nodeStateStopped,
+		PID:          42,
+		StartedAt:    1700000000,
+		StoppedAt:    1700003600,
+		BlockHeight:  850000,
+		FilterHeight: 849990,
+		ActiveJobs:   []RescanJob{{ID: 3, Addresses: []string{"addr"}, StartHeight: 1, EndHeight: 2, CheckpointHeight: -1}},
+	}
+	if err := writeNodeState(dir, want); err != nil {
+		t.Fatalf("writeNodeState() failed: %v", err)
+	}
+
+	got, err := readNodeState(dir)
+	if err != nil {
+		t.Fatalf("readNodeState() failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readNodeState() = %+v, want %+v", got, want)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, stateFileName+".tmp")); !os.IsNotExist(err) {
+		t.Errorf("expected temporary state file to be renamed, stat error = %v", err)
+	}
+
+	// A corrupt state file is reported rather than treated as a crash
+	if err := os.WriteFile(filepath.Join(dir, stateFileName), []byte("{"), 0o600); err != nil {
+		t.Fatalf("failed to corrupt state file: %v", err)
+	}
+	if _, err := readNodeState(dir); err == nil {
+		t.Error("expected error for corrupt state file")
+	}
+}
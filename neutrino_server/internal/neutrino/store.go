@@ -0,0 +1,1507 @@
+package neutrino
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcwallet/walletdb"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/addrindex"
+)
+
+var (
+	// rootBucket is the top-level bucket holding all neutrinod state. It lives
+	// in the same walletdb as neutrino's own headers and filters.
+	rootBucket = []byte("neutrinod")
+
+	// utxoBucket stores discovered UTXOs keyed by "txid:vout".
+	utxoBucket = []byte("utxos")
+
+	// spentBucket stores watched UTXOs that have been spent, keyed by
+	// "txid:vout", so outpoint lookups can report their spend.
+	spentBucket = []byte("spent-utxos")
+
+	// txIndexBucket stores transactions touching watched addresses keyed by
+	// txid.
+	txIndexBucket = []byte("transactions")
+
+	// retainedBlocksBucket stores the retained parts of scanned blocks keyed
+	// by big-endian height followed by block hash, so iteration runs from the
+	// oldest block.
+	retainedBlocksBucket = []byte("retained-blocks")
+
+	// watchedBucket stores watched addresses and how far they have been scanned.
+	watchedBucket = []byte("watched")
+
+	// rescanJobsBucket stores unfinished rescan jobs keyed by big-endian job ID.
+	rescanJobsBucket = []byte("rescan-jobs")
+
+	// eventsBucket holds one nested bucket per wallet, storing that wallet's
+	// events keyed by big-endian sequence number.
+	eventsBucket = []byte("events")
+
+	// heightHintsBucket stores GetUTXO height hints keyed by
+	// "txid:vout:scriptpubkey".
+	heightHintsBucket = []byte("height-hints")
+
+	// scriptsBucket stores registered redeem/witness scripts keyed by the
+	// hex scriptPubKey of each address form that pays to them.
+	scriptsBucket = []byte("scripts")
+
+	// archivedWalletsBucket stores soft-deleted wallets keyed by name.
+	archivedWalletsBucket = []byte("archived-wallets")
+
+	// createdWalletsBucket stores the wallets created by CreateWallet keyed
+	// by name, which exist before any address joins them.
+	createdWalletsBucket = []byte("created-wallets")
+
+	// rawBlocksBucket caches serialized blocks returned by GetRawBlock keyed
+	// by block hash. Each value is the big-endian Unix time of the last
+	// request followed by the block.
+	rawBlocksBucket = []byte("raw-blocks")
+
+	// webhooksBucket stores webhook registrations keyed by big-endian ID.
+	webhooksBucket = []byte("webhooks")
+
+	// trackedTxsBucket stores transactions tracked for confirmations keyed
+	// by txid.
+	trackedTxsBucket = []byte("tracked-txs")
+
+	// spendSubscriptionsBucket stores spend subscriptions keyed by
+	// "txid:vout".
+	spendSubscriptionsBucket = []byte("spend-subscriptions")
+
+	// blockUndoBucket stores the watched UTXO changes of recent blocks keyed
+	// by big-endian height, so a reorg can unwind them.
+	blockUndoBucket = []byte("block-undo")
+
+	// broadcastsBucket stores transactions queued for rebroadcast until
+	// confirmed, keyed by txid.
+	broadcastsBucket = []byte("broadcasts")
+
+	// idempotencyKeysBucket maps the idempotency keys of recent broadcast
+	// requests to their transactions.
+	idempotencyKeysBucket = []byte("idempotency-keys")
+
+	// xpubsBucket stores watched xpubs and descriptors with their
+	// derivation state, keyed by ID.
+	xpubsBucket = []byte("xpubs")
+
+	// bansBucket stores peer bans keyed by IP address or CIDR network.
+	bansBucket = []byte("bans")
+
+	// metaBucket stores single values about the store as a whole, keyed by
+	// name.
+	metaBucket = []byte("meta")
+
+	// indexSyncTokenKey is the metaBucket key of the token shared with an
+	// address index holding a copy of the store, see indexMirror.close.
+	indexSyncTokenKey = []byte("index-sync-token")
+)
+
+// storeBuckets lists every nested bucket created under rootBucket.
+var storeBuckets = [][]byte{
+	utxoBucket,
+	watchedBucket,
+	rescanJobsBucket,
+	scriptsBucket,
+	eventsBucket,
+	heightHintsBucket,
+	spentBucket,
+	txIndexBucket,
+	retainedBlocksBucket,
+	archivedWalletsBucket,
+	createdWalletsBucket,
+	rawBlocksBucket,
+	webhooksBucket,
+	trackedTxsBucket,
+	spendSubscriptionsBucket,
+	blockUndoBucket,
+	broadcastsBucket,
+	idempotencyKeysBucket,
+	xpubsBucket,
+	bansBucket,
+	metaBucket,
+}
+
+// WatchRecord is the persisted state of a watched address.
+type WatchRecord struct {
+	// ScannedHeight is the highest block height through which the address
+	// has been scanned, or -1 if it has never been scanned.
+	ScannedHeight int32 `json:"scanned_height"`
+
+	// Wallets lists the wallets the address belongs to. Records written
+	// before wallets existed have none and belong to DefaultWallet.
+	Wallets []string `json:"wallets,omitempty"`
+
+	// SkippedRanges lists heights a lenient rescan could not check for the
+	// address. A later rescan that checks them removes them.
+	SkippedRanges []HeightRange `json:"skipped_ranges,omitempty"`
+
+	// AddedHeight is the chain tip when the address was first watched. It is
+	// zero for records written before it was tracked.
+	AddedHeight int32 `json:"added_height,omitempty"`
+}
+
+// Store persists watch state and discovered UTXOs so they survive restarts.
+type Store struct {
+	db walletdb.DB
+
+	// index mirrors UTXO and transaction changes into the external address
+	// index, nil if none is configured
+	index *indexMirror
+}
+
+// NewStore creates a store backed by db, creating its buckets if needed.
+func NewStore(db walletdb.DB) (*Store, error) {
+	if db == nil {
+		return nil, errors.New("database is required")
+	}
+
+	err := walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		root, err := tx.CreateTopLevelBucket(rootBucket)
+		if err != nil {
+			return err
+		}
+		for _, name := range storeBuckets {
+			if _, err := root.CreateBucketIfNotExists(name); err != nil {
+				return fmt.Errorf("failed to create bucket %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize store: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// UTXOs returns every persisted UTXO keyed by "txid:vout".
+func (s *Store) UTXOs() (map[string]UTXO, error) {
+	utxos := make(map[string]UTXO)
+	err := s.forEach(utxoBucket, func(k, v []byte) error {
+		var utxo UTXO
+		if err := json.Unmarshal(v, &utxo); err != nil {
+			return fmt.Errorf("failed to decode UTXO %s: %w", k, err)
+		}
+		utxos[string(k)] = utxo
+		return nil
+	})
+	return utxos, err
+}
+
+// ApplyUTXOChanges atomically adds the given UTXOs and moves spent ones to the
+// spent bucket. Spends of outpoints that were never stored are ignored.
+func (s *Store) ApplyUTXOChanges(added map[string]UTXO, spent map[string]Spend) error {
+	return s.index.mirror(func() error {
+		return s.applyUTXOChanges(added, spent)
+	}, func(db *addrindex.DB) error {
+		utxos, spends, err := indexUTXOChanges(added, spent)
+		if err != nil {
+			return err
+		}
+		return db.Apply(utxos, spends, nil)
+	})
+}
+
+func (s *Store) applyUTXOChanges(added map[string]UTXO, spent map[string]Spend) error {
+	return walletdb.Update(s.db, func(tx walletdb.ReadWriteTx) error {
+		root := tx.ReadWriteBucket(rootBucket)
+		utxos := root.NestedReadWriteBucket(utxoBucket)
+		spentUTXOs := root.NestedReadWriteBucket(spentBucket)
+		if utxos == nil || spentUTXOs == nil {
+			return fmt.Errorf("buckets %s and %s are required", utxoBucket, spentBucket)
+		}
+
+		for key, utxo := range added {
+			if _, ok := spent[key]; ok {
+				continue
+			}
+			if err := putJSON(utxos, key, utxo); err != nil {
+				return err
+			}
+		}
+
+		for key, spend := range spent {
+			utxo, ok := added[key]
+			if !ok {
+				v := utxos.Get([]byte(key))
+				if v == nil {
+					continue
+				}
+				if err := json.Unmarshal(v, &utxo); err != nil {
+					return fmt.Errorf("failed to decode UTXO %s: %w", key, err)
+				}
+			}
+
+			status := OutpointStatus{UTXO: utxo, Spent: true, Spend: spend}
+			if err := putJSON(spentUTXOs, key, status); err != nil {
+				return err
+			}
+			if err := utxos.Delete([]byte(key)); err != nil {
+				return fmt.Errorf("failed to delete UTXO %s: %w", key, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Outpoint returns the persisted status of the watched outpoint key
+// ("txid:vout") and whether it has ever been seen.
+func (s *Store) Outpoint(key string) (OutpointStatus, bool, error) {
+	var status OutpointStatus
+	found := false
+	err := walletdb.View(s.db, func(tx walletdb.ReadTx) error {
+		root := tx.ReadBucket(rootBucket)
+		if v := root.NestedReadBucket(utxoBucket).Get([]byte(key)); v != nil {
+			found = true
+			return json.Unmarshal(v, &status.UTXO)
+		}
+		if v := root.NestedReadBucket(spentBucket).Get([]byte(key)); v != nil {
+			found = true
+			return json.Unmarshal(v, &status)
+		}
+		return nil
+	})
+	if err != nil {
+		return OutpointStatus{}, false, fmt.Errorf("failed to load outpoint %s: %w", key, err)
+	}
+	return status, found, nil
+}
+
+// PruneSpentUTXOs deletes the spent UTXOs spent below height and returns how
+// many were deleted. Spends recorded without a height are kept.
+func (s *Store) PruneSpentUTXOs(height int32) (int, error) {
+	pruned := 0
+	err := s.update(spentBucket, func(bucket walletdb.ReadWriteBucket) error {
+		var stale [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var status OutpointStatus
+			if err := json.Unmarshal(v, &status); err != nil {
+				return fmt.Errorf("failed to decode spent UTXO %s: %w", k, err)
+			}
+			if status.SpendingHeight > 0 && status.SpendingHeight < height {
+				stale = append(stale, bytes.Clone(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range stale {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+			pruned++
+		}
+		return nil
+	})
+	return pruned, err
+}
+
+// PutTransactions adds txs, keyed by txid, to the transaction index.
+func (s *Store) PutTransactions(txs map[string]IndexedTx) error {
+	if len(txs) == 0 {
+		return nil
+	}
+	return s.index.mirror(func() error {
+		return s.putTransactions(txs)
+	}, func(db *addrindex.DB) error {
+		rows := make([]addrindex.Transaction, 0, len(txs))
+		for txid, tx := range txs {
+			rows = append(rows, indexTransaction(txid, tx))
+		}
+		return db.Apply(nil, nil, rows)
+	})
+}
+
+func (s *Store) putTransactions(txs map[string]IndexedTx) error {
+	return s.update(txIndexBucket, func(bucket walletdb.ReadWriteBucket) error {
+		for txid, tx := range txs {
+			if err := putJSON(bucket, txid, tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Transaction returns the indexed transaction txid and whether it exists.
+func (s *Store) Transaction(txid string) (IndexedTx, bool, error) {
+	var tx IndexedTx
+	found := false
+	err := walletdb.View(s.db, func(dbTx walletdb.ReadTx) error {
+		bucket := dbTx.ReadBucket(rootBucket).NestedReadBucket(txIndexBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %s not found", txIndexBucket)
+		}
+		v := bucket.Get([]byte(txid))
+		if v == nil {
+			return nil
+		}
+		found = true
+		if err := json.Unmarshal(v, &tx); err != nil {
+			return fmt.Errorf("failed to decode indexed transaction %s: %w", txid, err)
+		}
+		return nil
+	})
+	return tx, found, err
+}
+
+// PutRetainedBlock stores block, merging its transactions with any already
+// retained for the same block.
+func (s *Store) PutRetainedBlock(block RetainedBlock) error {
+	hash, err := chainhash.NewHashFromStr(block.Hash)
+	if err != nil {
+		return fmt.Errorf("invalid block hash %s: %w", block.Hash, err)
+	}
+	key := retainedBlockKey(block.Height, hash)
+
+	return s.update(retainedBlocksBucket, func(bucket walletdb.ReadWriteBucket) error {
+		if v := bucket.Get(key); v != nil {
+			var existing RetainedBlock
+			if err := json.Unmarshal(v, &existing); err != nil {
+				return fmt.Errorf("failed to decode retained block %s: %w", block.Hash, err)
+			}
+			for _, tx := range existing.Txs {
+				if !slices.ContainsFunc(block.Txs, func(t RetainedTx) bool { return t.Index == tx.Index }) {
+					block.Txs = append(block.Txs, tx)
+				}
+			}
+		}
+
+		data, err := json.Marshal(block)
+		if err != nil {
+			return fmt.Errorf("failed to encode retained block %s: %w", block.Hash, err)
+		}
+		return bucket.Put(key, data)
+	})
+}
+
+// RetainedBlock returns the retained block at height with hash and whether it
+// exists.
+func (s *Store) RetainedBlock(height int32, hash *chainhash.Hash) (RetainedBlock, bool, error) {
+	var block RetainedBlock
+	found := false
+	err := walletdb.View(s.db, func(tx walletdb.ReadTx) error {
+		bucket := tx.ReadBucket(rootBucket).NestedReadBucket(retainedBlocksBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %s not found", retainedBlocksBucket)
+		}
+		v := bucket.Get(retainedBlockKey(height, hash))
+		if v == nil {
+			return nil
+		}
+		found = true
+		if err := json.Unmarshal(v, &block); err != nil {
+			return fmt.Errorf("failed to decode retained block %s: %w", hash, err)
+		}
+		return nil
+	})
+	return block, found, err
+}
+
+// PruneRetainedBlocks deletes the oldest retained blocks until the rest take
+// at most maxBytes, and returns how many were deleted.
+func (s *Store) PruneRetainedBlocks(maxBytes int64) (int, error) {
+	pruned := 0
+	err := s.update(retainedBlocksBucket, func(bucket walletdb.ReadWriteBucket) error {
+		var keys [][]byte
+		var sizes []int64
+		var total int64
+		err := bucket.ForEach(func(k, v []byte) error {
+			keys = append(keys, bytes.Clone(k))
+			sizes = append(sizes, int64(len(k)+len(v)))
+			total += int64(len(k) + len(v))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < len(keys) && total > maxBytes; i++ {
+			if err := bucket.Delete(keys[i]); err != nil {
+				return err
+			}
+			total -= sizes[i]
+			pruned++
+		}
+		return nil
+	})
+	return pruned, err
+}
+
+// PutRawBlock caches the serialized block with hash, last requested at
+// accessed.
+func (s *Store) PutRawBlock(hash *chainhash.Hash, block []byte, accessed int64) error {
+	value := make([]byte, 8+len(block))
+	binary.BigEndian.PutUint64(value, uint64(accessed))
+	copy(value[8:], block)
+
+	return s.update(rawBlocksBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return bucket.Put(hash[:], value)
+	})
+}
+
+// RawBlock returns the cached serialized block with hash, when it was last
+// requested and whether it exists.
+func (s *Store) RawBlock(hash *chainhash.Hash) ([]byte, int64, bool, error) {
+	var block []byte
+	var accessed int64
+	err := walletdb.View(s.db, func(tx walletdb.ReadTx) error {
+		bucket := tx.ReadBucket(rootBucket).NestedReadBucket(rawBlocksBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %s not found", rawBlocksBucket)
+		}
+		v := bucket.Get(hash[:])
+		if v == nil {
+			return nil
+		}
+		if len(v) < 8 {
+			return fmt.Errorf("invalid cached block %s", hash)
+		}
+		accessed = int64(binary.BigEndian.Uint64(v))
+		block = bytes.Clone(v[8:])
+		return nil
+	})
+	return block, accessed, block != nil, err
+}
+
+// PruneRawBlocks deletes the least recently requested cached blocks until the
+// rest take at most maxBytes, and returns how many were deleted.
+func (s *Store) PruneRawBlocks(maxBytes int64) (int, error) {
+	type entry struct {
+		key      []byte
+		size     int64
+		accessed uint64
+	}
+
+	pruned := 0
+	err := s.update(rawBlocksBucket, func(bucket walletdb.ReadWriteBucket) error {
+		var entries []entry
+		var total int64
+		err := bucket.ForEach(func(k, v []byte) error {
+			if len(v) < 8 {
+				return fmt.Errorf("invalid cached block %x", k)
+			}
+			entries = append(entries, entry{
+				key:      bytes.Clone(k),
+				size:     int64(len(k) + len(v)),
+				accessed: binary.BigEndian.Uint64(v),
+			})
+			total += int64(len(k) + len(v))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		slices.SortFunc(entries, func(a, b entry) int { return cmp.Compare(a.accessed, b.accessed) })
+		for i := 0; i < len(entries) && total > maxBytes; i++ {
+			if err := bucket.Delete(entries[i].key); err != nil {
+				return err
+			}
+			total -= entries[i].size
+			pruned++
+		}
+		return nil
+	})
+	return pruned, err
+}
+
+// WatchedAddresses returns every persisted watched address and its record.
+func (s *Store) WatchedAddresses() (map[string]WatchRecord, error) {
+	records := make(map[string]WatchRecord)
+	err := s.forEach(watchedBucket, func(k, v []byte) error {
+		var record WatchRecord
+		if err := json.Unmarshal(v, &record); err != nil {
+			return fmt.Errorf("failed to decode watch record %s: %w", k, err)
+		}
+		records[string(k)] = record
+		return nil
+	})
+	return records, err
+}
+
+// AddWatchedAddress persists a watched address and the wallets it belongs to,
+// recording addedHeight if the address was not watched yet.
+func (s *Store) AddWatchedAddress(address string, wallets []string, addedHeight int32) error {
+	return s.update(watchedBucket, func(bucket walletdb.ReadWriteBucket) error {
+		record := WatchRecord{ScannedHeight: -1, AddedHeight: addedHeight}
+		if v := bucket.Get([]byte(address)); v != nil {
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("failed to decode watch record %s: %w", address, err)
+			}
+		}
+		record.Wallets = wallets
+		return putJSON(bucket, address, record)
+	})
+}
+
+// UnwatchAddress removes address from the watch list in one transaction,
+// deleting its watch record and UTXOs and dropping it from unfinished rescan
+// jobs. Jobs left without addresses are deleted.
+func (s *Store) UnwatchAddress(address string) error {
+	return s.index.mirror(func() error {
+		return s.unwatchAddress(address)
+	}, func(db *addrindex.DB) error {
+		return db.RemoveUnspent([]string{address})
+	})
+}
+
+func (s *Store) unwatchAddress(address string) error {
+	return walletdb.Update(s.db, func(tx walletdb.ReadWriteTx) error {
+		root := tx.ReadWriteBucket(rootBucket)
+		watched := root.NestedReadWriteBucket(watchedBucket)
+		utxos := root.NestedReadWriteBucket(utxoBucket)
+		jobs := root.NestedReadWriteBucket(rescanJobsBucket)
+		if watched == nil || utxos == nil || jobs == nil {
+			return fmt.Errorf("buckets %s, %s and %s are required", watchedBucket, utxoBucket, rescanJobsBucket)
+		}
+
+		if err := watched.Delete([]byte(address)); err != nil {
+			return fmt.Errorf("failed to delete watch record %s: %w", address, err)
+		}
+
+		// Collect keys first, since deleting during ForEach is unsafe
+		var stale [][]byte
+		err := utxos.ForEach(func(k, v []byte) error {
+			var utxo UTXO
+			if err := json.Unmarshal(v, &utxo); err != nil {
+				return fmt.Errorf("failed to decode UTXO %s: %w", k, err)
+			}
+			if utxo.Address == address {
+				stale = append(stale, bytes.Clone(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range stale {
+			if err := utxos.Delete(key); err != nil {
+				return fmt.Errorf("failed to delete UTXO %s: %w", key, err)
+			}
+		}
+
+		updated := make(map[string]*RescanJob)
+		err = jobs.ForEach(func(k, v []byte) error {
+			var job RescanJob
+			if err := json.Unmarshal(v, &job); err != nil {
+				return fmt.Errorf("failed to decode rescan job %x: %w", k, err)
+			}
+			if slices.Contains(job.Addresses, address) {
+				job.Addresses = slices.DeleteFunc(job.Addresses, func(a string) bool { return a == address })
+				updated[string(k)] = &job
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for k, job := range updated {
+			if len(job.Addresses) == 0 {
+				if err := jobs.Delete([]byte(k)); err != nil {
+					return fmt.Errorf("failed to delete rescan job %d: %w", job.ID, err)
+				}
+				continue
+			}
+			data, err := json.Marshal(job)
+			if err != nil {
+				return fmt.Errorf("failed to encode rescan job %d: %w", job.ID, err)
+			}
+			if err := jobs.Put([]byte(k), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetScannedHeight records that the given addresses have been scanned through
+// height. Heights only move forward, so an older rescan never rewinds progress.
+func (s *Store) SetScannedHeight(addresses []string, height int32) error {
+	return s.update(watchedBucket, func(bucket walletdb.ReadWriteBucket) error {
+		for _, address := range addresses {
+			record := WatchRecord{ScannedHeight: -1}
+			if v := bucket.Get([]byte(address)); v != nil {
+				if err := json.Unmarshal(v, &record); err != nil {
+					return fmt.Errorf("failed to decode watch record %s: %w", address, err)
+				}
+			}
+			if height <= record.ScannedHeight {
+				continue
+			}
+			record.ScannedHeight = height
+			if err := putJSON(bucket, address, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AdvanceScannedHeight records that those of addresses scanned through at
+// least from are now scanned through height, every block in between having
+// been applied as it connected. Addresses with a gap below from are left for
+// a rescan to fill.
+func (s *Store) AdvanceScannedHeight(addresses []string, from, height int32) error {
+	return s.update(watchedBucket, func(bucket walletdb.ReadWriteBucket) error {
+		for _, address := range addresses {
+			v := bucket.Get([]byte(address))
+			if v == nil {
+				continue
+			}
+			var record WatchRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("failed to decode watch record %s: %w", address, err)
+			}
+			if record.ScannedHeight < from || record.ScannedHeight >= height {
+				continue
+			}
+			record.ScannedHeight = height
+			if err := putJSON(bucket, address, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateSkippedRanges replaces the skipped ranges of the given addresses
+// within checked by skipped, the heights in it that could not be checked.
+func (s *Store) UpdateSkippedRanges(addresses []string, checked HeightRange, skipped []HeightRange) error {
+	return s.update(watchedBucket, func(bucket walletdb.ReadWriteBucket) error {
+		for _, address := range addresses {
+			record := WatchRecord{ScannedHeight: -1}
+			if v := bucket.Get([]byte(address)); v != nil {
+				if err := json.Unmarshal(v, &record); err != nil {
+					return fmt.Errorf("failed to decode watch record %s: %w", address, err)
+				}
+			}
+			if len(record.SkippedRanges) == 0 && len(skipped) == 0 {
+				continue
+			}
+			remaining := subtractRange(record.SkippedRanges, checked)
+			record.SkippedRanges = mergeRanges(append(remaining, skipped...))
+			if err := putJSON(bucket, address, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PutRescanJob stores job, assigning it a new ID if it does not have one yet.
+func (s *Store) PutRescanJob(job *RescanJob) error {
+	return s.update(rescanJobsBucket, func(bucket walletdb.ReadWriteBucket) error {
+		if job.ID == 0 {
+			id, err := bucket.NextSequence()
+			if err != nil {
+				return fmt.Errorf("failed to allocate rescan job ID: %w", err)
+			}
+			job.ID = id
+		}
+
+		data, err := json.Marshal(job)
+		if err != nil {
+			return fmt.Errorf("failed to encode rescan job %d: %w", job.ID, err)
+		}
+		return bucket.Put(seqKey(job.ID), data)
+	})
+}
+
+// DeleteRescanJob removes a finished rescan job.
+func (s *Store) DeleteRescanJob(id uint64) error {
+	return s.update(rescanJobsBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return bucket.Delete(seqKey(id))
+	})
+}
+
+// RescanJobs returns all unfinished rescan jobs in the order they were created.
+func (s *Store) RescanJobs() ([]RescanJob, error) {
+	var jobs []RescanJob
+	err := s.forEach(rescanJobsBucket, func(k, v []byte) error {
+		var job RescanJob
+		if err := json.Unmarshal(v, &job); err != nil {
+			return fmt.Errorf("failed to decode rescan job %x: %w", k, err)
+		}
+		jobs = append(jobs, job)
+		return nil
+	})
+	return jobs, err
+}
+
+// PutScripts stores script under each of the given scriptPubKeys.
+func (s *Store) PutScripts(pkScripts []string, scriptHex string) error {
+	return s.update(scriptsBucket, func(bucket walletdb.ReadWriteBucket) error {
+		for _, pkScript := range pkScripts {
+			if err := putJSON(bucket, pkScript, scriptHex); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Scripts returns every registered script keyed by scriptPubKey hex.
+func (s *Store) Scripts() (map[string][]byte, error) {
+	scripts := make(map[string][]byte)
+	err := s.forEach(scriptsBucket, func(k, v []byte) error {
+		var scriptHex string
+		if err := json.Unmarshal(v, &scriptHex); err != nil {
+			return fmt.Errorf("failed to decode script %s: %w", k, err)
+		}
+		script, err := hex.DecodeString(scriptHex)
+		if err != nil {
+			return fmt.Errorf("failed to decode script %s: %w", k, err)
+		}
+		scripts[string(k)] = script
+		return nil
+	})
+	return scripts, err
+}
+
+// HeightHint returns the height hint stored under key and whether it exists.
+func (s *Store) HeightHint(key string) (HeightHint, bool, error) {
+	var hint HeightHint
+	found := false
+	err := walletdb.View(s.db, func(tx walletdb.ReadTx) error {
+		bucket := tx.ReadBucket(rootBucket).NestedReadBucket(heightHintsBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %s not found", heightHintsBucket)
+		}
+		v := bucket.Get([]byte(key))
+		if v == nil {
+			return nil
+		}
+		found = true
+		if err := json.Unmarshal(v, &hint); err != nil {
+			return fmt.Errorf("failed to decode height hint %s: %w", key, err)
+		}
+		return nil
+	})
+	return hint, found, err
+}
+
+// HeightHintsFor returns the height hints recorded for the outpoint key
+// ("txid:vout") under any script.
+func (s *Store) HeightHintsFor(outpoint string) ([]HeightHint, error) {
+	var hints []HeightHint
+	prefix := []byte(outpoint + ":")
+	err := walletdb.View(s.db, func(tx walletdb.ReadTx) error {
+		bucket := tx.ReadBucket(rootBucket).NestedReadBucket(heightHintsBucket)
+		if bucket == nil {
+			return fmt.Errorf("bucket %s not found", heightHintsBucket)
+		}
+
+		cursor := bucket.ReadCursor()
+		for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+			var hint HeightHint
+			if err := json.Unmarshal(v, &hint); err != nil {
+				return fmt.Errorf("failed to decode height hint %s: %w", k, err)
+			}
+			hints = append(hints, hint)
+		}
+		return nil
+	})
+	return hints, err
+}
+
+// PutHeightHint stores hint under key.
+func (s *Store) PutHeightHint(key string, hint HeightHint) error {
+	return s.update(heightHintsBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return putJSON(bucket, key, hint)
+	})
+}
+
+// AppendEvent assigns event the next sequence number in its wallet's stream
+// and stores it, pruning the oldest event once the stream is full.
+func (s *Store) AppendEvent(event *Event) error {
+	return s.update(eventsBucket, func(bucket walletdb.ReadWriteBucket) error {
+		stream, err := bucket.CreateBucketIfNotExists([]byte(event.Wallet))
+		if err != nil {
+			return fmt.Errorf("failed to create event stream %s: %w", event.Wallet, err)
+		}
+
+		seq, err := stream.NextSequence()
+		if err != nil {
+			return fmt.Errorf("failed to allocate event sequence: %w", err)
+		}
+		event.Seq = seq
+
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode event %d: %w", seq, err)
+		}
+		if err := stream.Put(seqKey(seq), data); err != nil {
+			return err
+		}
+
+		if seq > maxEventsPerWallet {
+			return stream.Delete(seqKey(seq - maxEventsPerWallet))
+		}
+		return nil
+	})
+}
+
+// Events returns up to limit events from wallet's stream with a sequence
+// number greater than after, oldest first.
+func (s *Store) Events(wallet string, after uint64, limit int) ([]Event, error) {
+	events := make([]Event, 0)
+	err := walletdb.View(s.db, func(tx walletdb.ReadTx) error {
+		stream := tx.ReadBucket(rootBucket).NestedReadBucket(eventsBucket).NestedReadBucket([]byte(wallet))
+		if stream == nil {
+			return nil
+		}
+
+		cursor := stream.ReadCursor()
+		for k, v := cursor.Seek(seqKey(after + 1)); k != nil && len(events) < limit; k, v = cursor.Next() {
+			var event Event
+			if err := json.Unmarshal(v, &event); err != nil {
+				return fmt.Errorf("failed to decode event %x: %w", k, err)
+			}
+			events = append(events, event)
+		}
+		return nil
+	})
+	return events, err
+}
+
+// PutWebhook stores hook, assigning it a new ID if it does not have one yet.
+func (s *Store) PutWebhook(hook *Webhook) error {
+	return s.update(webhooksBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return putWebhook(bucket, hook)
+	})
+}
+
+// ReplaceWebhooks stores hooks and deletes the webhooks of deleted in one
+// transaction, so either all of the changes are made or none are. Hooks
+// without an ID are assigned one, as by PutWebhook.
+func (s *Store) ReplaceWebhooks(hooks []*Webhook, deleted []uint64) error {
+	return s.update(webhooksBucket, func(bucket walletdb.ReadWriteBucket) error {
+		for _, hook := range hooks {
+			if err := putWebhook(bucket, hook); err != nil {
+				return err
+			}
+		}
+		for _, id := range deleted {
+			if err := bucket.Delete(seqKey(id)); err != nil {
+				return fmt.Errorf("failed to delete webhook %d: %w", id, err)
+			}
+		}
+		return nil
+	})
+}
+
+// putWebhook stores hook in bucket, assigning it a new ID if it does not
+// have one yet.
+func putWebhook(bucket walletdb.ReadWriteBucket, hook *Webhook) error {
+	if hook.ID == 0 {
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return fmt.Errorf("failed to allocate webhook ID: %w", err)
+		}
+		hook.ID = id
+	}
+
+	data, err := json.Marshal(hook)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook %d: %w", hook.ID, err)
+	}
+	return bucket.Put(seqKey(hook.ID), data)
+}
+
+// DeleteWebhook removes a webhook registration.
+func (s *Store) DeleteWebhook(id uint64) error {
+	return s.update(webhooksBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return bucket.Delete(seqKey(id))
+	})
+}
+
+// Webhooks returns every webhook registration ordered by ID.
+func (s *Store) Webhooks() ([]Webhook, error) {
+	var hooks []Webhook
+	err := s.forEach(webhooksBucket, func(k, v []byte) error {
+		var hook Webhook
+		if err := json.Unmarshal(v, &hook); err != nil {
+			return fmt.Errorf("failed to decode webhook %x: %w", k, err)
+		}
+		hooks = append(hooks, hook)
+		return nil
+	})
+	return hooks, err
+}
+
+// PutTrackedTx stores the confirmation tracking state of a transaction.
+func (s *Store) PutTrackedTx(tracked TrackedTx) error {
+	return s.update(trackedTxsBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return putJSON(bucket, tracked.TxID, tracked)
+	})
+}
+
+// DeleteTrackedTx stops persisting the tracking state of txid.
+func (s *Store) DeleteTrackedTx(txid string) error {
+	return s.update(trackedTxsBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return bucket.Delete([]byte(txid))
+	})
+}
+
+// TrackedTxs returns every tracked transaction keyed by txid.
+func (s *Store) TrackedTxs() (map[string]TrackedTx, error) {
+	tracked := make(map[string]TrackedTx)
+	err := s.forEach(trackedTxsBucket, func(k, v []byte) error {
+		var tx TrackedTx
+		if err := json.Unmarshal(v, &tx); err != nil {
+			return fmt.Errorf("failed to decode tracked transaction %s: %w", k, err)
+		}
+		tracked[string(k)] = tx
+		return nil
+	})
+	return tracked, err
+}
+
+// PutSpendSubscription stores a spend subscription.
+func (s *Store) PutSpendSubscription(sub SpendSubscription) error {
+	return s.update(spendSubscriptionsBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return putJSON(bucket, sub.Outpoint(), sub)
+	})
+}
+
+// DeleteSpendSubscription removes the spend subscription for outpoint.
+func (s *Store) DeleteSpendSubscription(outpoint string) error {
+	return s.update(spendSubscriptionsBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return bucket.Delete([]byte(outpoint))
+	})
+}
+
+// SpendSubscriptions returns every spend subscription keyed by outpoint.
+func (s *Store) SpendSubscriptions() (map[string]SpendSubscription, error) {
+	subs := make(map[string]SpendSubscription)
+	err := s.forEach(spendSubscriptionsBucket, func(k, v []byte) error {
+		var sub SpendSubscription
+		if err := json.Unmarshal(v, &sub); err != nil {
+			return fmt.Errorf("failed to decode spend subscription %s: %w", k, err)
+		}
+		subs[string(k)] = sub
+		return nil
+	})
+	return subs, err
+}
+
+// PutBroadcast stores the rebroadcast state of a transaction.
+func (s *Store) PutBroadcast(broadcast BroadcastTx) error {
+	return s.update(broadcastsBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return putJSON(bucket, broadcast.TxID, broadcast)
+	})
+}
+
+// DeleteBroadcast removes the rebroadcast state of txid.
+func (s *Store) DeleteBroadcast(txid string) error {
+	return s.update(broadcastsBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return bucket.Delete([]byte(txid))
+	})
+}
+
+// Broadcasts returns every queued broadcast keyed by txid.
+func (s *Store) Broadcasts() (map[string]BroadcastTx, error) {
+	broadcasts := make(map[string]BroadcastTx)
+	err := s.forEach(broadcastsBucket, func(k, v []byte) error {
+		var broadcast BroadcastTx
+		if err := json.Unmarshal(v, &broadcast); err != nil {
+			return fmt.Errorf("failed to decode broadcast %s: %w", k, err)
+		}
+		broadcasts[string(k)] = broadcast
+		return nil
+	})
+	return broadcasts, err
+}
+
+// PutIdempotencyKey stores the transaction broadcast with an idempotency key.
+func (s *Store) PutIdempotencyKey(key string, entry IdempotencyKey) error {
+	return s.update(idempotencyKeysBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return putJSON(bucket, key, entry)
+	})
+}
+
+// DeleteIdempotencyKey forgets an idempotency key.
+func (s *Store) DeleteIdempotencyKey(key string) error {
+	return s.update(idempotencyKeysBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return bucket.Delete([]byte(key))
+	})
+}
+
+// IdempotencyKeys returns every stored idempotency key.
+func (s *Store) IdempotencyKeys() (map[string]IdempotencyKey, error) {
+	keys := make(map[string]IdempotencyKey)
+	err := s.forEach(idempotencyKeysBucket, func(k, v []byte) error {
+		var entry IdempotencyKey
+		if err := json.Unmarshal(v, &entry); err != nil {
+			return fmt.Errorf("failed to decode idempotency key: %w", err)
+		}
+		keys[string(k)] = entry
+		return nil
+	})
+	return keys, err
+}
+
+// PutArchivedWallet marks wallet as archived.
+func (s *Store) PutArchivedWallet(wallet string, archived ArchivedWallet) error {
+	return s.update(archivedWalletsBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return putJSON(bucket, wallet, archived)
+	})
+}
+
+// DeleteArchivedWallet removes the archive mark of a restored wallet.
+func (s *Store) DeleteArchivedWallet(wallet string) error {
+	return s.update(archivedWalletsBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return bucket.Delete([]byte(wallet))
+	})
+}
+
+// ArchivedWallets returns every archived wallet keyed by name.
+func (s *Store) ArchivedWallets() (map[string]ArchivedWallet, error) {
+	wallets := make(map[string]ArchivedWallet)
+	err := s.forEach(archivedWalletsBucket, func(k, v []byte) error {
+		var archived ArchivedWallet
+		if err := json.Unmarshal(v, &archived); err != nil {
+			return fmt.Errorf("failed to decode archived wallet %s: %w", k, err)
+		}
+		wallets[string(k)] = archived
+		return nil
+	})
+	return wallets, err
+}
+
+// PutCreatedWallet records a created wallet.
+func (s *Store) PutCreatedWallet(wallet string, created CreatedWallet) error {
+	return s.update(createdWalletsBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return putJSON(bucket, wallet, created)
+	})
+}
+
+// CreatedWallets returns every created wallet keyed by name.
+func (s *Store) CreatedWallets() (map[string]CreatedWallet, error) {
+	wallets := make(map[string]CreatedWallet)
+	err := s.forEach(createdWalletsBucket, func(k, v []byte) error {
+		var created CreatedWallet
+		if err := json.Unmarshal(v, &created); err != nil {
+			return fmt.Errorf("failed to decode created wallet %s: %w", k, err)
+		}
+		wallets[string(k)] = created
+		return nil
+	})
+	return wallets, err
+}
+
+// PurgeWallet permanently removes wallet in one transaction. remaining maps
+// each of the wallet's addresses to the wallets it still belongs to; an
+// address left without wallets is unwatched and its UTXOs are deleted. The
+// wallet's event stream, archive mark and creation record are deleted too. Spent outpoints and
+// indexed transactions are kept, since other wallets may share them.
+func (s *Store) PurgeWallet(wallet string, remaining map[string][]string) error {
+	return s.index.mirror(func() error {
+		return s.purgeWallet(wallet, remaining)
+	}, func(db *addrindex.DB) error {
+		var unwatched []string
+		for address, wallets := range remaining {
+			if len(wallets) == 0 {
+				unwatched = append(unwatched, address)
+			}
+		}
+		return db.RemoveUnspent(unwatched)
+	})
+}
+
+func (s *Store) purgeWallet(wallet string, remaining map[string][]string) error {
+	return walletdb.Update(s.db, func(tx walletdb.ReadWriteTx) error {
+		root := tx.ReadWriteBucket(rootBucket)
+		watched := root.NestedReadWriteBucket(watchedBucket)
+		utxos := root.NestedReadWriteBucket(utxoBucket)
+		if watched == nil || utxos == nil {
+			return fmt.Errorf("buckets %s and %s are required", watchedBucket, utxoBucket)
+		}
+
+		unwatched := make(map[string]bool)
+		for address, wallets := range remaining {
+			if len(wallets) == 0 {
+				if err := watched.Delete([]byte(address)); err != nil {
+					return fmt.Errorf("failed to delete watch record %s: %w", address, err)
+				}
+				unwatched[address] = true
+				continue
+			}
+
+			var record WatchRecord
+			v := watched.Get([]byte(address))
+			if v == nil {
+				continue
+			}
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("failed to decode watch record %s: %w", address, err)
+			}
+			record.Wallets = wallets
+			if err := putJSON(watched, address, record); err != nil {
+				return err
+			}
+		}
+
+		// Collect keys first, since deleting during ForEach is unsafe
+		var stale [][]byte
+		err := utxos.ForEach(func(k, v []byte) error {
+			var utxo UTXO
+			if err := json.Unmarshal(v, &utxo); err != nil {
+				return fmt.Errorf("failed to decode UTXO %s: %w", k, err)
+			}
+			if unwatched[utxo.Address] {
+				stale = append(stale, bytes.Clone(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range stale {
+			if err := utxos.Delete(key); err != nil {
+				return fmt.Errorf("failed to delete UTXO %s: %w", key, err)
+			}
+		}
+
+		events := root.NestedReadWriteBucket(eventsBucket)
+		if events != nil && events.NestedReadBucket([]byte(wallet)) != nil {
+			if err := events.DeleteNestedBucket([]byte(wallet)); err != nil {
+				return fmt.Errorf("failed to delete event stream %s: %w", wallet, err)
+			}
+		}
+
+		if err := root.NestedReadWriteBucket(createdWalletsBucket).Delete([]byte(wallet)); err != nil {
+			return fmt.Errorf("failed to delete created wallet %s: %w", wallet, err)
+		}
+		return root.NestedReadWriteBucket(archivedWalletsBucket).Delete([]byte(wallet))
+	})
+}
+
+// AddBlockUndo merges undo, keyed by height, into the stored undo data.
+func (s *Store) AddBlockUndo(undo map[int32]BlockUndo) error {
+	if len(undo) == 0 {
+		return nil
+	}
+	return s.update(blockUndoBucket, func(bucket walletdb.ReadWriteBucket) error {
+		for height, block := range undo {
+			key := heightKey(height)
+			if v := bucket.Get(key); v != nil {
+				var existing BlockUndo
+				if err := json.Unmarshal(v, &existing); err != nil {
+					return fmt.Errorf("failed to decode undo data at height %d: %w", height, err)
+				}
+				block = existing.merge(block)
+			}
+
+			data, err := json.Marshal(block)
+			if err != nil {
+				return fmt.Errorf("failed to encode undo data at height %d: %w", height, err)
+			}
+			if err := bucket.Put(key, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PruneBlockUndo deletes the undo data of blocks below height and returns
+// how many were deleted.
+func (s *Store) PruneBlockUndo(height int32) (int, error) {
+	pruned := 0
+	err := s.update(blockUndoBucket, func(bucket walletdb.ReadWriteBucket) error {
+		var stale [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			if int32(binary.BigEndian.Uint32(k)) < height {
+				stale = append(stale, bytes.Clone(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range stale {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+			pruned++
+		}
+		return nil
+	})
+	return pruned, err
+}
+
+// RollbackBlocks unwinds the watched UTXO changes of the blocks above fork
+// using their undo data: UTXOs they created are deleted and UTXOs they spent
+// are unspent. Indexed transactions above fork are dropped and watched
+// addresses scanned past fork are rewound to it.
+func (s *Store) RollbackBlocks(fork int32) (Rollback, error) {
+	var result Rollback
+	err := s.index.mirror(func() error {
+		var err error
+		result, err = s.rollbackBlocks(fork)
+		return err
+	}, func(db *addrindex.DB) error {
+		return db.Rollback(fork)
+	})
+	return result, err
+}
+
+func (s *Store) rollbackBlocks(fork int32) (Rollback, error) {
+	var result Rollback
+	err := walletdb.Update(s.db, func(tx walletdb.ReadWriteTx) error {
+		root := tx.ReadWriteBucket(rootBucket)
+		undoData := root.NestedReadWriteBucket(blockUndoBucket)
+		utxos := root.NestedReadWriteBucket(utxoBucket)
+		spentUTXOs := root.NestedReadWriteBucket(spentBucket)
+		txIndex := root.NestedReadWriteBucket(txIndexBucket)
+		watched := root.NestedReadWriteBucket(watchedBucket)
+		if undoData == nil || utxos == nil || spentUTXOs == nil || txIndex == nil || watched == nil {
+			return fmt.Errorf("buckets %s, %s, %s, %s and %s are required",
+				blockUndoBucket, utxoBucket, spentBucket, txIndexBucket, watchedBucket)
+		}
+
+		// Collect keys first, since deleting during ForEach is unsafe
+		var undoKeys [][]byte
+		var blocks []BlockUndo
+		err := undoData.ForEach(func(k, v []byte) error {
+			if int32(binary.BigEndian.Uint32(k)) <= fork {
+				return nil
+			}
+			var block BlockUndo
+			if err := json.Unmarshal(v, &block); err != nil {
+				return fmt.Errorf("failed to decode undo data %x: %w", k, err)
+			}
+			undoKeys = append(undoKeys, bytes.Clone(k))
+			blocks = append(blocks, block)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, block := range blocks {
+			for _, key := range block.Created {
+				if err := utxos.Delete([]byte(key)); err != nil {
+					return fmt.Errorf("failed to delete UTXO %s: %w", key, err)
+				}
+				if err := spentUTXOs.Delete([]byte(key)); err != nil {
+					return fmt.Errorf("failed to delete spent UTXO %s: %w", key, err)
+				}
+				result.Removed = append(result.Removed, key)
+			}
+		}
+		// Spent UTXOs created above the fork were deleted with their block
+		for _, block := range blocks {
+			for _, utxo := range block.Spent {
+				if utxo.Height > fork {
+					continue
+				}
+				key := fmt.Sprintf("%s:%d", utxo.TxID, utxo.Vout)
+				if err := putJSON(utxos, key, utxo); err != nil {
+					return err
+				}
+				if err := spentUTXOs.Delete([]byte(key)); err != nil {
+					return fmt.Errorf("failed to delete spent UTXO %s: %w", key, err)
+				}
+				result.Restored = append(result.Restored, utxo)
+			}
+		}
+		for _, key := range undoKeys {
+			if err := undoData.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		var orphanedTxs [][]byte
+		err = txIndex.ForEach(func(k, v []byte) error {
+			var indexed IndexedTx
+			if err := json.Unmarshal(v, &indexed); err != nil {
+				return fmt.Errorf("failed to decode indexed transaction %s: %w", k, err)
+			}
+			if indexed.BlockHeight > fork {
+				orphanedTxs = append(orphanedTxs, bytes.Clone(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range orphanedTxs {
+			if err := txIndex.Delete(key); err != nil {
+				return fmt.Errorf("failed to delete indexed transaction %s: %w", key, err)
+			}
+		}
+
+		rewound := make(map[string]WatchRecord)
+		err = watched.ForEach(func(k, v []byte) error {
+			var record WatchRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("failed to decode watch record %s: %w", k, err)
+			}
+			if record.ScannedHeight > fork {
+				record.ScannedHeight = fork
+				rewound[string(k)] = record
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for address, record := range rewound {
+			if err := putJSON(watched, address, record); err != nil {
+				return err
+			}
+			result.Addresses = append(result.Addresses, address)
+		}
+		slices.Sort(result.Addresses)
+		return nil
+	})
+	if err != nil {
+		return Rollback{}, fmt.Errorf("failed to roll back blocks above %d: %w", fork, err)
+	}
+	return result, nil
+}
+
+// PutBan stores a peer ban.
+func (s *Store) PutBan(ban Ban) error {
+	return s.update(bansBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return putJSON(bucket, ban.Addr, ban)
+	})
+}
+
+// DeleteBan removes the ban of addr.
+func (s *Store) DeleteBan(addr string) error {
+	return s.update(bansBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return bucket.Delete([]byte(addr))
+	})
+}
+
+// Bans returns every stored peer ban, expired ones included.
+func (s *Store) Bans() ([]Ban, error) {
+	var bans []Ban
+	err := s.forEach(bansBucket, func(k, v []byte) error {
+		var ban Ban
+		if err := json.Unmarshal(v, &ban); err != nil {
+			return fmt.Errorf("failed to decode ban %s: %w", k, err)
+		}
+		bans = append(bans, ban)
+		return nil
+	})
+	return bans, err
+}
+
+// putIndexSyncToken stores the token shared with the address index, or
+// removes it if token is empty.
+func (s *Store) putIndexSyncToken(token string) error {
+	return s.update(metaBucket, func(bucket walletdb.ReadWriteBucket) error {
+		if token == "" {
+			return bucket.Delete(indexSyncTokenKey)
+		}
+		return bucket.Put(indexSyncTokenKey, []byte(token))
+	})
+}
+
+// indexSyncToken returns the token stored by putIndexSyncToken, "" if none
+// is.
+func (s *Store) indexSyncToken() (string, error) {
+	var token string
+	err := walletdb.View(s.db, func(tx walletdb.ReadTx) error {
+		token = string(tx.ReadBucket(rootBucket).NestedReadBucket(metaBucket).Get(indexSyncTokenKey))
+		return nil
+	})
+	return token, err
+}
+
+// seqKey encodes a sequence number so that keys sort in creation order.
+func seqKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// heightKey encodes a block height so that keys sort by height.
+func heightKey(height int32) []byte {
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, uint32(height))
+	return key
+}
+
+// retainedBlockKey orders retained blocks by height.
+func retainedBlockKey(height int32, hash *chainhash.Hash) []byte {
+	key := make([]byte, 4+chainhash.HashSize)
+	binary.BigEndian.PutUint32(key, uint32(height))
+	copy(key[4:], hash[:])
+	return key
+}
+
+// forEach calls fn for every key/value pair in the named bucket.
+func (s *Store) forEach(name []byte, fn func(k, v []byte) error) error {
+	return walletdb.View(s.db, func(tx walletdb.ReadTx) error {
+		bucket := tx.ReadBucket(rootBucket).NestedReadBucket(name)
+		if bucket == nil {
+			return fmt.Errorf("bucket %s not found", name)
+		}
+		return bucket.ForEach(fn)
+	})
+}
+
+// update runs fn against the named bucket inside a read-write transaction.
+func (s *Store) update(name []byte, fn func(bucket walletdb.ReadWriteBucket) error) error {
+	return walletdb.Update(s.db, func(tx walletdb.ReadWriteTx) error {
+		bucket := tx.ReadWriteBucket(rootBucket).NestedReadWriteBucket(name)
+		if bucket == nil {
+			return fmt.Errorf("bucket %s not found", name)
+		}
+		return fn(bucket)
+	})
+}
+
+// putJSON encodes value as JSON and stores it under key.
+func putJSON(bucket walletdb.ReadWriteBucket, key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	return bucket.Put([]byte(key), data)
+}
+
+// PutWatchedXpub stores the derivation state of a watched xpub.
+func (s *Store) PutWatchedXpub(xpub WatchedXpub) error {
+	return s.update(xpubsBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return putJSON(bucket, xpub.ID, xpub)
+	})
+}
+
+// DeleteWatchedXpub removes the watched xpub id.
+func (s *Store) DeleteWatchedXpub(id string) error {
+	return s.update(xpubsBucket, func(bucket walletdb.ReadWriteBucket) error {
+		return bucket.Delete([]byte(id))
+	})
+}
+
+// WatchedXpubs returns every watched xpub keyed by ID.
+func (s *Store) WatchedXpubs() (map[string]WatchedXpub, error) {
+	xpubs := make(map[string]WatchedXpub)
+	err := s.forEach(xpubsBucket, func(k, v []byte) error {
+		var xpub WatchedXpub
+		if err := json.Unmarshal(v, &xpub); err != nil {
+			return fmt.Errorf("failed to decode watched xpub %s: %w", k, err)
+		}
+		xpubs[string(k)] = xpub
+		return nil
+	})
+	return xpubs, err
+}
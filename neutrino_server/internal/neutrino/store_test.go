@@ -0,0 +1,362 @@
+package neutrino
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btclog"
+	"github.com/btcsuite/btcwallet/walletdb"
+)
+
+// newTestStore opens a store backed by a fresh bbolt database.
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	db, err := walletdb.Create("bdb", filepath.Join(t.TempDir(), "neutrino.db"), true, time.Second)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := NewStore(db)
+	if err != nil {
+		t.Fatalf("NewStore() failed: %v", err)
+	}
+	return store
+}
+
+func TestNewStoreNilDB(t *testing.T) {
+	if _, err := NewStore(nil); err == nil {
+		t.Error("expected error for nil database")
+	}
+}
+
+func TestStoreUTXOs(t *testing.T) {
+	store := newTestStore(t)
+
+	added := map[string]UTXO{
+		"tx1:0": {TxID: "tx1", Vout: 0, Value: 1000, Address: "addr1", Height: 10},
+		"tx2:1": {TxID: "tx2", Vout: 1, Value: 2000, Address: "addr1", Height: 11},
+		"tx3:0": {TxID: "tx3", Vout: 0, Value: 3000, Address: "addr2", Height: 12},
+	}
+	spent := map[string]Spend{"tx3:0": {}}
+
+	if err := store.ApplyUTXOChanges(added, spent); err != nil {
+		t.Fatalf("ApplyUTXOChanges() failed: %v", err)
+	}
+
+	utxos, err := store.UTXOs()
+	if err != nil {
+		t.Fatalf("UTXOs() failed: %v", err)
+	}
+
+	if len(utxos) != 2 {
+		t.Fatalf("expected 2 UTXOs, got %d", len(utxos))
+	}
+
+	if utxos["tx2:1"].Value != 2000 {
+		t.Errorf("expected value 2000, got %d", utxos["tx2:1"].Value)
+	}
+
+	if _, ok := utxos["tx3:0"]; ok {
+		t.Error("spent UTXO should not be stored")
+	}
+
+	// A later spend removes a previously stored UTXO
+	if err := store.ApplyUTXOChanges(nil, map[string]Spend{"tx1:0": {}}); err != nil {
+		t.Fatalf("ApplyUTXOChanges() failed: %v", err)
+	}
+
+	utxos, err = store.UTXOs()
+	if err != nil {
+		t.Fatalf("UTXOs() failed: %v", err)
+	}
+
+	if len(utxos) != 1 {
+		t.Errorf("expected 1 UTXO after spend, got %d", len(utxos))
+	}
+}
+
+func TestStoreScannedHeight(t *testing.T) {
+	store := newTestStore(t)
+
+	if err := store.AddWatchedAddress("addr1", nil, 0); err != nil {
+		t.Fatalf("AddWatchedAddress() failed: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		height     int32
+		wantHeight int32
+	}{
+		{"first scan", 100, 100},
+		{"scan advances", 200, 200},
+		{"older scan does not rewind", 150, 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := store.SetScannedHeight([]string{"addr1"}, tt.height); err != nil {
+				t.Fatalf("SetScannedHeight() failed: %v", err)
+			}
+
+			records, err := store.WatchedAddresses()
+			if err != nil {
+				t.Fatalf("WatchedAddresses() failed: %v", err)
+			}
+
+			if got := records["addr1"].ScannedHeight; got != tt.wantHeight {
+				t.Errorf("ScannedHeight = %d, want %d", got, tt.wantHeight)
+			}
+		})
+	}
+
+	// Re-adding an address must not reset its progress
+	if err := store.AddWatchedAddress("addr1", nil, 0); err != nil {
+		t.Fatalf("AddWatchedAddress() failed: %v", err)
+	}
+
+	records, err := store.WatchedAddresses()
+	if err != nil {
+		t.Fatalf("WatchedAddresses() failed: %v", err)
+	}
+
+	if got := records["addr1"].ScannedHeight; got != 200 {
+		t.Errorf("ScannedHeight after re-add = %d, want 200", got)
+	}
+}
+
+func TestRescanManagerRestore(t *testing.T) {
+	logger := btclog.Disabled
+	store := newTestStore(t)
+
+	address := "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+
+	mgr := &RescanManager{
+		chainParams:    &chaincfg.MainNetParams,
+		store:          store,
+		logger:         logger,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
+	}
+
+	if err := mgr.WatchAddress(address); err != nil {
+		t.Fatalf("WatchAddress() failed: %v", err)
+	}
+	mgr.AddUTXO("tx1", 0, 50000000, address, []byte{0x76}, 100)
+	mgr.AddUTXO("tx2", 0, 25000000, address, []byte{0x76}, 101)
+	mgr.RemoveUTXO("tx2", 0)
+
+	// A fresh manager over the same store sees the persisted state
+	restored := &RescanManager{
+		chainParams:    &chaincfg.MainNetParams,
+		store:          store,
+		logger:         logger,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
+	}
+
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+
+	if _, ok := restored.watchedScripts[address]; !ok {
+		t.Error("expected watched address to be restored")
+	}
+
+	if len(restored.utxoSet) != 1 {
+		t.Fatalf("expected 1 restored UTXO, got %d", len(restored.utxoSet))
+	}
+
+	if utxo := restored.utxoSet["tx1:0"]; utxo.Value != 50000000 {
+		t.Errorf("expected value 50000000, got %d", utxo.Value)
+	}
+}
+
+func TestStoreRescanJobs(t *testing.T) {
+	store := newTestStore(t)
+
+	first := &RescanJob{Addresses: []string{"addr1"}, StartHeight: 10, EndHeight: 5000, CheckpointHeight: 9}
+	second := &RescanJob{Addresses: []string{"addr2"}, StartHeight: 20, EndHeight: 6000, CheckpointHeight: 19}
+
+	for _, job := range []*RescanJob{first, second} {
+		if err := store.PutRescanJob(job); err != nil {
+			t.Fatalf("PutRescanJob() failed: %v", err)
+		}
+	}
+
+	if first.ID == 0 || second.ID <= first.ID {
+		t.Fatalf("expected increasing job IDs, got %d and %d", first.ID, second.ID)
+	}
+
+	// Checkpointing an existing job updates it in place
+	first.CheckpointHeight = 1009
+	if err := store.PutRescanJob(first); err != nil {
+		t.Fatalf("PutRescanJob() failed: %v", err)
+	}
+
+	jobs, err := store.RescanJobs()
+	if err != nil {
+		t.Fatalf("RescanJobs() failed: %v", err)
+	}
+
+	if len(jobs) != 2 {
+		t.Fatalf("expected 2 jobs, got %d", len(jobs))
+	}
+
+	if jobs[0].ID != first.ID || jobs[0].CheckpointHeight != 1009 {
+		t.Errorf("unexpected first job: %+v", jobs[0])
+	}
+
+	if err := store.DeleteRescanJob(first.ID); err != nil {
+		t.Fatalf("DeleteRescanJob() failed: %v", err)
+	}
+
+	jobs, err = store.RescanJobs()
+	if err != nil {
+		t.Fatalf("RescanJobs() failed: %v", err)
+	}
+
+	if len(jobs) != 1 || jobs[0].ID != second.ID {
+		t.Errorf("expected only job %d to remain, got %+v", second.ID, jobs)
+	}
+}
+
+func TestStoreOutpoint(t *testing.T) {
+	store := newTestStore(t)
+
+	added := map[string]UTXO{
+		"tx1:0": {TxID: "tx1", Vout: 0, Value: 1000, Address: "addr1", Height: 10},
+		"tx2:0": {TxID: "tx2", Vout: 0, Value: 2000, Address: "addr1", Height: 11},
+	}
+	spend := Spend{SpendingTxID: "tx9", SpendingInput: 1, SpendingHeight: 12}
+	spent := map[string]Spend{
+		"tx2:0": spend,
+		// Spends of outpoints that were never watched are not recorded
+		"other:0": {SpendingTxID: "tx9", SpendingHeight: 12},
+	}
+	if err := store.ApplyUTXOChanges(added, spent); err != nil {
+		t.Fatalf("ApplyUTXOChanges() failed: %v", err)
+	}
+
+	tests := []struct {
+		key       string
+		wantFound bool
+		want      OutpointStatus
+	}{
+		{"tx1:0", true, OutpointStatus{UTXO: added["tx1:0"]}},
+		{"tx2:0", true, OutpointStatus{UTXO: added["tx2:0"], Spent: true, Spend: spend}},
+		{"other:0", false, OutpointStatus{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, found, err := store.Outpoint(tt.key)
+			if err != nil {
+				t.Fatalf("Outpoint() failed: %v", err)
+			}
+			if found != tt.wantFound {
+				t.Fatalf("Outpoint() found = %v, want %v", found, tt.wantFound)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Outpoint() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// Height hints are found by outpoint regardless of script, without
+	// matching outpoints that share a prefix
+	for _, key := range []string{"tx3:1:0014", "tx3:1:5120", "tx3:10:0014"} {
+		if err := store.PutHeightHint(key, HeightHint{Created: true}); err != nil {
+			t.Fatalf("PutHeightHint() failed: %v", err)
+		}
+	}
+	hints, err := store.HeightHintsFor("tx3:1")
+	if err != nil {
+		t.Fatalf("HeightHintsFor() failed: %v", err)
+	}
+	if len(hints) != 2 {
+		t.Errorf("expected 2 hints for tx3:1, got %d", len(hints))
+	}
+}
+
+func TestStorePruneSpentUTXOs(t *testing.T) {
+	store := newTestStore(t)
+
+	added := map[string]UTXO{
+		"tx1:0": {TxID: "tx1", Vout: 0, Value: 1000, Height: 10},
+		"tx2:0": {TxID: "tx2", Vout: 0, Value: 2000, Height: 10},
+		"tx3:0": {TxID: "tx3", Vout: 0, Value: 3000, Height: 10},
+		"tx4:0": {TxID: "tx4", Vout: 0, Value: 4000, Height: 10},
+	}
+	spent := map[string]Spend{
+		"tx1:0": {SpendingTxID: "tx8", SpendingHeight: 50},
+		"tx2:0": {SpendingTxID: "tx9", SpendingHeight: 150},
+		"tx3:0": {},
+	}
+	if err := store.ApplyUTXOChanges(added, spent); err != nil {
+		t.Fatalf("ApplyUTXOChanges() failed: %v", err)
+	}
+
+	pruned, err := store.PruneSpentUTXOs(100)
+	if err != nil {
+		t.Fatalf("PruneSpentUTXOs() failed: %v", err)
+	}
+	if pruned != 1 {
+		t.Errorf("PruneSpentUTXOs() pruned %d, want 1", pruned)
+	}
+	// Only the deep spend goes; unspent UTXOs and spends without a height stay
+	for key, want := range map[string]bool{"tx1:0": false, "tx2:0": true, "tx3:0": true, "tx4:0": true} {
+		if _, found, err := store.Outpoint(key); err != nil || found != want {
+			t.Errorf("Outpoint(%s) found = %v, %v, want %v", key, found, err, want)
+		}
+	}
+}
+
+func TestStoreRawBlocks(t *testing.T) {
+	store := newTestStore(t)
+
+	hashes := make([]*chainhash.Hash, 3)
+	for i := range hashes {
+		hashes[i] = &chainhash.Hash{byte(i + 1)}
+		block := bytes.Repeat([]byte{byte(i + 1)}, 100)
+		if err := store.PutRawBlock(hashes[i], block, int64(1000+i)); err != nil {
+			t.Fatalf("PutRawBlock() failed: %v", err)
+		}
+	}
+
+	block, accessed, found, err := store.RawBlock(hashes[1])
+	if err != nil || !found || accessed != 1001 {
+		t.Fatalf("RawBlock() = %d, %v, %v; want found, accessed at 1001", accessed, found, err)
+	}
+	if !bytes.Equal(block, bytes.Repeat([]byte{2}, 100)) {
+		t.Errorf("RawBlock() = %x", block)
+	}
+	if _, _, found, err := store.RawBlock(&chainhash.Hash{9}); err != nil || found {
+		t.Errorf("RawBlock() of an uncached block = %v, %v; want not found", found, err)
+	}
+
+	// Requesting the oldest block again keeps it over the other two
+	if err := store.PutRawBlock(hashes[0], bytes.Repeat([]byte{1}, 100), 2000); err != nil {
+		t.Fatalf("PutRawBlock() failed: %v", err)
+	}
+
+	// Each entry takes a 32-byte key, an 8-byte access time and the block
+	pruned, err := store.PruneRawBlocks(2 * 140)
+	if err != nil {
+		t.Fatalf("PruneRawBlocks() failed: %v", err)
+	}
+	if pruned != 1 {
+		t.Errorf("PruneRawBlocks() pruned %d blocks, want 1", pruned)
+	}
+	for i, want := range []bool{true, false, true} {
+		if _, _, found, _ := store.RawBlock(hashes[i]); found != want {
+			t.Errorf("block %d cached = %v, want %v", i, found, want)
+		}
+	}
+}
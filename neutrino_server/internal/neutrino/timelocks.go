@@ -0,0 +1,315 @@
+package neutrino
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// medianTimeBlocks is the number of blocks used to compute median time past.
+const medianTimeBlocks = 11
+
+// ScriptTimelocks describes the CLTV and CSV constraints found in a redeem or
+// witness script. When a script has several locks of the same kind, the most
+// restrictive one is reported.
+type ScriptTimelocks struct {
+	// LockHeight and LockTime are absolute OP_CHECKLOCKTIMEVERIFY locks,
+	// by block height and by unix time respectively.
+	LockHeight int32 `json:"lock_height,omitempty"`
+	LockTime   int64 `json:"lock_time,omitempty"`
+
+	// RelativeBlocks and RelativeSeconds are OP_CHECKSEQUENCEVERIFY locks,
+	// counted from the block that confirmed the output.
+	RelativeBlocks  int32 `json:"relative_blocks,omitempty"`
+	RelativeSeconds int64 `json:"relative_seconds,omitempty"`
+
+	// Conditional is true when a lock sits inside an OP_IF/OP_NOTIF branch,
+	// so other spending paths may not be time-locked at all.
+	Conditional bool `json:"conditional,omitempty"`
+}
+
+// IsZero reports whether the script has no time locks.
+func (l ScriptTimelocks) IsZero() bool {
+	return l.LockHeight == 0 && l.LockTime == 0 && l.RelativeBlocks == 0 && l.RelativeSeconds == 0
+}
+
+// Timelock reports when a time-locked UTXO becomes spendable.
+type Timelock struct {
+	ScriptTimelocks
+
+	// EarliestSpendableHeight is the first block height in which a spend
+	// can be mined, or 0 if there is no height-based lock.
+	EarliestSpendableHeight int32 `json:"earliest_spendable_height,omitempty"`
+
+	// EarliestSpendableTime is the median time past a block must exceed
+	// before a spend can be mined in it, or 0 if there is no time-based lock.
+	EarliestSpendableTime int64 `json:"earliest_spendable_time,omitempty"`
+
+	// Locked is true if the output cannot be spent in the next block.
+	Locked bool `json:"locked"`
+}
+
+// ScriptRegistration is a registered redeem/witness script and the addresses
+// that pay to it.
+type ScriptRegistration struct {
+	Script    string          `json:"script"`
+	P2SH      string          `json:"p2sh"`
+	P2WSH     string          `json:"p2wsh"`
+	P2SHP2WSH string          `json:"p2sh_p2wsh"`
+	Timelocks ScriptTimelocks `json:"timelocks"`
+}
+
+// analyzeTimelocks extracts the CLTV and CSV locks from script. Only locks
+// whose operand is a literal push immediately before the opcode are detected.
+func analyzeTimelocks(script []byte) (ScriptTimelocks, error) {
+	var locks ScriptTimelocks
+
+	var operand int64
+	haveOperand := false
+	depth := 0
+
+	tokenizer := txscript.MakeScriptTokenizer(0, script)
+	for tokenizer.Next() {
+		op := tokenizer.Opcode()
+
+		switch {
+		case op == txscript.OP_IF || op == txscript.OP_NOTIF:
+			depth++
+
+		case op == txscript.OP_ENDIF:
+			depth--
+
+		case op == txscript.OP_CHECKLOCKTIMEVERIFY && haveOperand:
+			if operand < txscript.LockTimeThreshold {
+				locks.LockHeight = max(locks.LockHeight, int32(operand))
+			} else {
+				locks.LockTime = max(locks.LockTime, operand)
+			}
+			locks.Conditional = locks.Conditional || depth > 0
+
+		case op == txscript.OP_CHECKSEQUENCEVERIFY && haveOperand:
+			if operand&wire.SequenceLockTimeDisabled != 0 {
+				break
+			}
+			value := operand & wire.SequenceLockTimeMask
+			if operand&wire.SequenceLockTimeIsSeconds != 0 {
+				locks.RelativeSeconds = max(locks.RelativeSeconds, value<<wire.SequenceLockTimeGranularity)
+			} else {
+				locks.RelativeBlocks = max(locks.RelativeBlocks, int32(value))
+			}
+			locks.Conditional = locks.Conditional || depth > 0
+		}
+
+		// Remember a literal operand for the next opcode
+		haveOperand = false
+		switch {
+		case txscript.IsSmallInt(op):
+			operand, haveOperand = int64(txscript.AsSmallInt(op)), true
+		case op > txscript.OP_0 && op <= txscript.OP_PUSHDATA4:
+			// Lock operands are up to 5 bytes, as consensus allows
+			if num, err := txscript.MakeScriptNum(tokenizer.Data(), false, 5); err == nil && num >= 0 {
+				operand, haveOperand = int64(num), true
+			}
+		}
+	}
+
+	if err := tokenizer.Err(); err != nil {
+		return ScriptTimelocks{}, fmt.Errorf("failed to parse script: %w", err)
+	}
+
+	return locks, nil
+}
+
+// evaluateTimelock computes when an output locked by locks, confirmed at
+// confHeight, becomes spendable. prevMTP is the median time past of the block
+// before confHeight, which relative time locks count from; tipHeight and
+// tipMTP describe the current chain tip.
+func evaluateTimelock(locks ScriptTimelocks, confHeight int32, prevMTP int64, tipHeight int32, tipMTP int64) Timelock {
+	result := Timelock{ScriptTimelocks: locks}
+
+	// A transaction with nLockTime n can first be mined in block n+1, and a
+	// time lock requires the median time past to exceed it
+	if locks.LockHeight > 0 {
+		result.EarliestSpendableHeight = locks.LockHeight + 1
+	}
+	if locks.RelativeBlocks > 0 {
+		result.EarliestSpendableHeight = max(result.EarliestSpendableHeight, confHeight+locks.RelativeBlocks)
+	}
+	if locks.LockTime > 0 {
+		result.EarliestSpendableTime = locks.LockTime + 1
+	}
+	if locks.RelativeSeconds > 0 {
+		result.EarliestSpendableTime = max(result.EarliestSpendableTime, prevMTP+locks.RelativeSeconds)
+	}
+
+	result.Locked = (result.EarliestSpendableHeight > 0 && tipHeight+1 < result.EarliestSpendableHeight) ||
+		(result.EarliestSpendableTime > 0 && tipMTP < result.EarliestSpendableTime)
+
+	return result
+}
+
+// newScriptRegistration derives the P2SH, P2WSH and P2SH-P2WSH addresses for
+// script, returning the registration and the scriptPubKeys that pay to it.
+func newScriptRegistration(script []byte, params *chaincfg.Params) (*ScriptRegistration, [][]byte, error) {
+	if len(script) == 0 || len(script) > txscript.MaxScriptSize {
+		return nil, nil, NewBadRequestError("script must be between 1 and 10000 bytes")
+	}
+
+	locks, err := analyzeTimelocks(script)
+	if err != nil {
+		return nil, nil, NewBadRequestError(err.Error())
+	}
+
+	witnessHash := sha256.Sum256(script)
+	p2wsh, err := btcutil.NewAddressWitnessScriptHash(witnessHash[:], params)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive P2WSH address: %w", err)
+	}
+
+	p2wshScript, err := txscript.PayToAddrScript(p2wsh)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive P2WSH script: %w", err)
+	}
+
+	p2sh, err := btcutil.NewAddressScriptHash(script, params)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive P2SH address: %w", err)
+	}
+
+	nested, err := btcutil.NewAddressScriptHash(p2wshScript, params)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive P2SH-P2WSH address: %w", err)
+	}
+
+	pkScripts := [][]byte{p2wshScript}
+	for _, addr := range []btcutil.Address{p2sh, nested} {
+		pkScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to derive script for %s: %w", addr, err)
+		}
+		pkScripts = append(pkScripts, pkScript)
+	}
+
+	return &ScriptRegistration{
+		Script:    hex.EncodeToString(script),
+		P2SH:      p2sh.EncodeAddress(),
+		P2WSH:     p2wsh.EncodeAddress(),
+		P2SHP2WSH: nested.EncodeAddress(),
+		Timelocks: locks,
+	}, pkScripts, nil
+}
+
+// RegisterScript registers a redeem/witness script so that UTXOs paying to
+// any of its P2SH, P2WSH or P2SH-P2WSH forms report their time locks.
+func (r *RescanManager) RegisterScript(script []byte) (*ScriptRegistration, error) {
+	reg, pkScripts, err := newScriptRegistration(script, r.chainParams)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(pkScripts))
+	for _, pkScript := range pkScripts {
+		keys = append(keys, hex.EncodeToString(pkScript))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.store != nil {
+		if err := r.store.PutScripts(keys, reg.Script); err != nil {
+			return nil, fmt.Errorf("failed to persist script: %w", err)
+		}
+	}
+
+	for _, key := range keys {
+		r.scripts[key] = script
+	}
+
+	r.logger.Debugf("Registered script %s", reg.Script)
+	return reg, nil
+}
+
+// annotateTimelocks sets the Timelock of every UTXO paying to a registered
+// script that contains time locks.
+func (r *RescanManager) annotateTimelocks(utxos []UTXO) {
+	r.mu.RLock()
+	if len(r.scripts) == 0 {
+		r.mu.RUnlock()
+		return
+	}
+	locksByScript := make(map[string]ScriptTimelocks)
+	for i := range utxos {
+		script, ok := r.scripts[utxos[i].ScriptPubKey]
+		if !ok {
+			continue
+		}
+		if locks, err := analyzeTimelocks(script); err == nil && !locks.IsZero() {
+			locksByScript[utxos[i].ScriptPubKey] = locks
+		}
+	}
+	r.mu.RUnlock()
+
+	if len(locksByScript) == 0 || r.chainService == nil {
+		return
+	}
+
+	// The UTXOs are known as of the filter tip, so their locks are
+	// evaluated there too
+	_, tipHeight, err := chainScanTip(r.chainService)
+	if err != nil {
+		r.logger.Warnf("Failed to get the chain tip for time lock evaluation: %v", err)
+		return
+	}
+	tipMTP, err := r.medianTimePast(tipHeight)
+	if err != nil {
+		r.logger.Warnf("Failed to compute median time past at tip: %v", err)
+		return
+	}
+
+	for i := range utxos {
+		locks, ok := locksByScript[utxos[i].ScriptPubKey]
+		if !ok {
+			continue
+		}
+
+		var prevMTP int64
+		if locks.RelativeSeconds > 0 {
+			prevMTP, err = r.medianTimePast(utxos[i].Height - 1)
+			if err != nil {
+				r.logger.Warnf("Failed to compute median time past at height %d: %v", logging.KV("height", utxos[i].Height-1), err)
+				continue
+			}
+		}
+
+		timelock := evaluateTimelock(locks, utxos[i].Height, prevMTP, tipHeight, tipMTP)
+		utxos[i].Timelock = &timelock
+	}
+}
+
+// medianTimePast returns the median timestamp of the medianTimeBlocks blocks
+// ending at height.
+func (r *RescanManager) medianTimePast(height int32) (int64, error) {
+	timestamps := make([]int64, 0, medianTimeBlocks)
+	for h := height; h >= 0 && h > height-medianTimeBlocks; h-- {
+		header, err := r.chainService.BlockHeaders.FetchHeaderByHeight(uint32(h))
+		if err != nil {
+			return 0, fmt.Errorf("failed to fetch header %d: %w", h, err)
+		}
+		timestamps = append(timestamps, header.Timestamp.Unix())
+	}
+
+	if len(timestamps) == 0 {
+		return 0, nil
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2], nil
+}
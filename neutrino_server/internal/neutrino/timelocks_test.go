@@ -0,0 +1,182 @@
+package neutrino
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+)
+
+// testPubKey is a placeholder compressed public key for script templates.
+var testPubKey = append([]byte{0x02}, bytes.Repeat([]byte{0x11}, 32)...)
+
+// lockedScript builds "<lock> <op> OP_DROP <pubkey> OP_CHECKSIG".
+func lockedScript(t *testing.T, lock int64, op byte) []byte {
+	t.Helper()
+
+	script, err := txscript.NewScriptBuilder().
+		AddInt64(lock).AddOp(op).AddOp(txscript.OP_DROP).
+		AddData(testPubKey).AddOp(txscript.OP_CHECKSIG).
+		Script()
+	if err != nil {
+		t.Fatalf("failed to build script: %v", err)
+	}
+	return script
+}
+
+func TestAnalyzeTimelocks(t *testing.T) {
+	htlc, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_IF).
+		AddOp(txscript.OP_SHA256).AddData(bytes.Repeat([]byte{0x22}, 32)).AddOp(txscript.OP_EQUALVERIFY).
+		AddOp(txscript.OP_ELSE).
+		AddInt64(100).AddOp(txscript.OP_CHECKSEQUENCEVERIFY).AddOp(txscript.OP_DROP).
+		AddOp(txscript.OP_ENDIF).
+		AddData(testPubKey).AddOp(txscript.OP_CHECKSIG).
+		Script()
+	if err != nil {
+		t.Fatalf("failed to build script: %v", err)
+	}
+
+	plain, err := txscript.NewScriptBuilder().AddData(testPubKey).AddOp(txscript.OP_CHECKSIG).Script()
+	if err != nil {
+		t.Fatalf("failed to build script: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		script []byte
+		want   ScriptTimelocks
+	}{
+		{"absolute height", lockedScript(t, 800000, txscript.OP_CHECKLOCKTIMEVERIFY), ScriptTimelocks{LockHeight: 800000}},
+		{"absolute time", lockedScript(t, 1700000000, txscript.OP_CHECKLOCKTIMEVERIFY), ScriptTimelocks{LockTime: 1700000000}},
+		{"relative blocks", lockedScript(t, 144, txscript.OP_CHECKSEQUENCEVERIFY), ScriptTimelocks{RelativeBlocks: 144}},
+		{"relative small int", lockedScript(t, 16, txscript.OP_CHECKSEQUENCEVERIFY), ScriptTimelocks{RelativeBlocks: 16}},
+		{
+			"relative seconds",
+			lockedScript(t, wire.SequenceLockTimeIsSeconds|10, txscript.OP_CHECKSEQUENCEVERIFY),
+			ScriptTimelocks{RelativeSeconds: 10 << wire.SequenceLockTimeGranularity},
+		},
+		{"relative disabled", lockedScript(t, wire.SequenceLockTimeDisabled|5, txscript.OP_CHECKSEQUENCEVERIFY), ScriptTimelocks{}},
+		{"conditional branch", htlc, ScriptTimelocks{RelativeBlocks: 100, Conditional: true}},
+		{"no locks", plain, ScriptTimelocks{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := analyzeTimelocks(tt.script)
+			if err != nil {
+				t.Fatalf("analyzeTimelocks() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("analyzeTimelocks() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// A truncated push is rejected
+	if _, err := analyzeTimelocks([]byte{txscript.OP_DATA_5, 0x01}); err == nil {
+		t.Error("expected error for malformed script")
+	}
+}
+
+func TestEvaluateTimelock(t *testing.T) {
+	tests := []struct {
+		name       string
+		locks      ScriptTimelocks
+		confHeight int32
+		prevMTP    int64
+		tipHeight  int32
+		tipMTP     int64
+		wantHeight int32
+		wantTime   int64
+		wantLocked bool
+	}{
+		{"absolute height pending", ScriptTimelocks{LockHeight: 800000}, 700000, 0, 799999, 0, 800001, 0, true},
+		{"absolute height reached", ScriptTimelocks{LockHeight: 800000}, 700000, 0, 800000, 0, 800001, 0, false},
+		{"relative blocks pending", ScriptTimelocks{RelativeBlocks: 144}, 1000, 0, 1142, 0, 1144, 0, true},
+		{"relative blocks reached", ScriptTimelocks{RelativeBlocks: 144}, 1000, 0, 1143, 0, 1144, 0, false},
+		{"relative seconds pending", ScriptTimelocks{RelativeSeconds: 5120}, 1000, 1000, 2000, 6119, 0, 6120, true},
+		{"relative seconds reached", ScriptTimelocks{RelativeSeconds: 5120}, 1000, 1000, 2000, 6120, 0, 6120, false},
+		{"absolute time pending", ScriptTimelocks{LockTime: 1700000000}, 1000, 0, 2000, 1700000000, 0, 1700000001, true},
+		{
+			"most restrictive lock wins",
+			ScriptTimelocks{LockHeight: 900, RelativeBlocks: 144},
+			1000, 0, 1100, 0, 1144, 0, true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := evaluateTimelock(tt.locks, tt.confHeight, tt.prevMTP, tt.tipHeight, tt.tipMTP)
+
+			if got.EarliestSpendableHeight != tt.wantHeight {
+				t.Errorf("EarliestSpendableHeight = %d, want %d", got.EarliestSpendableHeight, tt.wantHeight)
+			}
+			if got.EarliestSpendableTime != tt.wantTime {
+				t.Errorf("EarliestSpendableTime = %d, want %d", got.EarliestSpendableTime, tt.wantTime)
+			}
+			if got.Locked != tt.wantLocked {
+				t.Errorf("Locked = %v, want %v", got.Locked, tt.wantLocked)
+			}
+		})
+	}
+}
+
+func TestRegisterScript(t *testing.T) {
+	store := newTestStore(t)
+	newManager := func() *RescanManager {
+		return &RescanManager{
+			chainParams:    &chaincfg.MainNetParams,
+			store:          store,
+			logger:         btclog.Disabled,
+			watchedScripts: make(map[string][]byte),
+			utxoSet:        make(map[string]UTXO),
+			scripts:        make(map[string][]byte),
+		}
+	}
+
+	script := lockedScript(t, 800000, txscript.OP_CHECKLOCKTIMEVERIFY)
+
+	mgr := newManager()
+	reg, err := mgr.RegisterScript(script)
+	if err != nil {
+		t.Fatalf("RegisterScript() failed: %v", err)
+	}
+
+	if !strings.HasPrefix(reg.P2WSH, "bc1q") || !strings.HasPrefix(reg.P2SH, "3") || !strings.HasPrefix(reg.P2SHP2WSH, "3") {
+		t.Errorf("unexpected addresses: %+v", reg)
+	}
+
+	if reg.Timelocks.LockHeight != 800000 {
+		t.Errorf("expected lock height 800000, got %d", reg.Timelocks.LockHeight)
+	}
+
+	if len(mgr.scripts) != 3 {
+		t.Errorf("expected 3 registered scriptPubKeys, got %d", len(mgr.scripts))
+	}
+
+	// Registrations survive a restart
+	restored := newManager()
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+
+	if len(restored.scripts) != 3 {
+		t.Fatalf("expected 3 restored scriptPubKeys, got %d", len(restored.scripts))
+	}
+	for _, got := range restored.scripts {
+		if !bytes.Equal(got, script) {
+			t.Errorf("restored script %x, want %x", got, script)
+		}
+	}
+
+	var badRequestErr *BadRequestError
+	if _, err := mgr.RegisterScript(nil); !errors.As(err, &badRequestErr) {
+		t.Errorf("expected BadRequestError for empty script, got %v", err)
+	}
+}
@@ -0,0 +1,363 @@
+package neutrino
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btclog"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	// torHealthCheckInterval is how often each configured proxy is probed.
+	torHealthCheckInterval = 30 * time.Second
+
+	// torProxyDialTimeout bounds connecting to a proxy, both for health
+	// checks and for connections routed through it.
+	torProxyDialTimeout = 10 * time.Second
+)
+
+// SOCKS5 authentication methods and Tor's RESOLVE command.
+const (
+	socksNoAuth       = 0x00
+	socksPasswordAuth = 0x02
+	socksResolveCmd   = 0xf0
+)
+
+// torProxyAddr is a proxy address with the credentials to authenticate
+// to it, if any.
+type torProxyAddr struct {
+	addr string
+	auth *proxy.Auth
+}
+
+// parseTorProxies splits a comma-separated list of SOCKS5 proxy addresses,
+// each host:port or user:password@host:port for proxies requiring
+// username/password authentication.
+func parseTorProxies(list string) ([]torProxyAddr, error) {
+	var proxies []torProxyAddr
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		p := torProxyAddr{addr: entry}
+		if at := strings.LastIndex(entry, "@"); at >= 0 {
+			p.addr = entry[at+1:]
+			user, password, _ := strings.Cut(entry[:at], ":")
+			if user == "" || len(user) > 255 || len(password) > 255 {
+				return nil, fmt.Errorf("invalid Tor proxy credentials for %s: the user must be 1 to 255 bytes and the password at most 255", p.addr)
+			}
+			p.auth = &proxy.Auth{User: user, Password: password}
+		}
+		if _, _, err := net.SplitHostPort(p.addr); err != nil {
+			return nil, fmt.Errorf("invalid Tor proxy %q: %w", p.addr, err)
+		}
+		proxies = append(proxies, p)
+	}
+	return proxies, nil
+}
+
+// RedactTorProxy returns a list of proxy addresses with their passwords
+// masked, for logging.
+func RedactTorProxy(list string) string {
+	proxies, err := parseTorProxies(list)
+	if err != nil {
+		return "(invalid)"
+	}
+	entries := make([]string, len(proxies))
+	for i, p := range proxies {
+		entries[i] = p.addr
+		if p.auth != nil {
+			entries[i] = p.auth.User + ":xxxxx@" + p.addr
+		}
+	}
+	return strings.Join(entries, ",")
+}
+
+// randomAuth returns fresh random credentials. Tor puts connections
+// authenticating with different credentials on different circuits, so
+// connections using their own random credentials are isolated from each
+// other.
+func randomAuth() *proxy.Auth {
+	var b [16]byte
+	rand.Read(b[:])
+	credentials := hex.EncodeToString(b[:])
+	return &proxy.Auth{User: credentials, Password: credentials}
+}
+
+// proxyUnreachableError reports that a proxy itself could not be reached, as
+// opposed to the proxy failing to reach the destination.
+type proxyUnreachableError struct {
+	addr string
+	err  error
+}
+
+func (e *proxyUnreachableError) Error() string {
+	return fmt.Sprintf("Tor proxy %s unreachable: %v", e.addr, e.err)
+}
+
+func (e *proxyUnreachableError) Unwrap() error {
+	return e.err
+}
+
+// torProxy is one SOCKS5 proxy of a pool.
+type torProxy struct {
+	addr    string
+	auth    *proxy.Auth
+	healthy atomic.Bool
+}
+
+// torProxyPool routes connections through one or more SOCKS5 proxies, such as
+// several Tor daemons. Connections rotate across healthy proxies and fail over
+// to the next one when a proxy cannot be reached. A proxy that fails is
+// skipped until a health check finds it listening again; if every proxy is
+// down they are all still tried, in case the health state is stale.
+//
+// With isolate set, every connection and lookup authenticates with random
+// credentials of its own, so Tor builds a separate circuit for each peer.
+type torProxyPool struct {
+	proxies []*torProxy
+	isolate bool
+	next    atomic.Uint32
+	logger  btclog.Logger
+}
+
+// newTorProxyPool creates a pool from a comma-separated list of proxy
+// addresses. Every proxy starts out healthy. Isolating connections replaces
+// the credentials of every connection, so it cannot be combined with
+// proxies requiring credentials of their own.
+func newTorProxyPool(list string, isolate bool, logger btclog.Logger) (*torProxyPool, error) {
+	addrs, err := parseTorProxies(list)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("no Tor proxy configured")
+	}
+
+	pool := &torProxyPool{isolate: isolate, logger: logger}
+	for _, addr := range addrs {
+		if isolate && addr.auth != nil {
+			return nil, fmt.Errorf("Tor proxy %s has credentials, which circuit isolation would replace", addr.addr)
+		}
+		p := &torProxy{addr: addr.addr, auth: addr.auth}
+		p.healthy.Store(true)
+		pool.proxies = append(pool.proxies, p)
+	}
+	return pool, nil
+}
+
+// credentials returns the credentials of the next connection through tp.
+func (p *torProxyPool) credentials(tp *torProxy) *proxy.Auth {
+	if p.isolate {
+		return randomAuth()
+	}
+	return tp.auth
+}
+
+// proxyForward connects to a proxy on behalf of its SOCKS5 dialer, marking
+// the proxy down when the connection fails.
+type proxyForward struct {
+	pool  *torProxyPool
+	proxy *torProxy
+}
+
+func (f proxyForward) Dial(network, addr string) (net.Conn, error) {
+	return f.DialContext(context.Background(), network, addr)
+}
+
+func (f proxyForward) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: torProxyDialTimeout}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		f.pool.markDown(f.proxy, err)
+		return nil, &proxyUnreachableError{addr: f.proxy.addr, err: err}
+	}
+	return conn, nil
+}
+
+// candidates returns the proxies in the order to try them: healthy ones
+// first, rotating the starting proxy on every call, then unhealthy ones.
+func (p *torProxyPool) candidates() []*torProxy {
+	n := len(p.proxies)
+	start := int(p.next.Add(1)-1) % n
+
+	healthy := make([]*torProxy, 0, n)
+	var unhealthy []*torProxy
+	for i := range n {
+		tp := p.proxies[(start+i)%n]
+		if tp.healthy.Load() {
+			healthy = append(healthy, tp)
+		} else {
+			unhealthy = append(unhealthy, tp)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// Dial connects to addr through the first proxy that can be reached.
+func (p *torProxyPool) Dial(network, addr string) (net.Conn, error) {
+	return p.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to addr through the first proxy that can be reached.
+// Errors from a reachable proxy, such as the destination refusing the
+// connection, are returned without trying the other proxies.
+func (p *torProxyPool) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var lastErr error
+	for _, tp := range p.candidates() {
+		dialer, err := proxy.SOCKS5("tcp", tp.addr, p.credentials(tp), proxyForward{pool: p, proxy: tp})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Tor SOCKS5 dialer for %s: %w", tp.addr, err)
+		}
+		conn, err := dialer.(proxy.ContextDialer).DialContext(ctx, network, addr)
+		if err == nil {
+			return conn, nil
+		}
+
+		var unreachable *proxyUnreachableError
+		if !errors.As(err, &unreachable) || ctx.Err() != nil {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// LookupIP resolves host through the first proxy that can be reached, using
+// Tor's SOCKS5 RESOLVE extension.
+func (p *torProxyPool) LookupIP(host string) ([]net.IP, error) {
+	var lastErr error
+	for _, tp := range p.candidates() {
+		conn, err := net.DialTimeout("tcp", tp.addr, torProxyDialTimeout)
+		if err != nil {
+			p.markDown(tp, err)
+			lastErr = &proxyUnreachableError{addr: tp.addr, err: err}
+			continue
+		}
+		ips, err := socksResolve(conn, host, p.credentials(tp))
+		conn.Close()
+		return ips, err
+	}
+	return nil, lastErr
+}
+
+// socksResolve resolves host with Tor's SOCKS5 RESOLVE command on conn, a
+// connection to the proxy, authenticating with auth if it is not nil.
+func socksResolve(conn net.Conn, host string, auth *proxy.Auth) ([]net.IP, error) {
+	if len(host) > 255 {
+		return nil, fmt.Errorf("host name %s is too long", host)
+	}
+	conn.SetDeadline(time.Now().Add(torProxyDialTimeout))
+
+	method := byte(socksNoAuth)
+	if auth != nil {
+		method = socksPasswordAuth
+	}
+	if _, err := conn.Write([]byte{5, 1, method}); err != nil {
+		return nil, err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, err
+	}
+	if reply[0] != 5 || reply[1] != method {
+		return nil, errors.New("Tor proxy does not accept the authentication method")
+	}
+
+	if auth != nil {
+		request := []byte{1, byte(len(auth.User))}
+		request = append(request, auth.User...)
+		request = append(request, byte(len(auth.Password)))
+		request = append(request, auth.Password...)
+		if _, err := conn.Write(request); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return nil, err
+		}
+		if reply[1] != 0 {
+			return nil, errors.New("Tor proxy rejected the credentials")
+		}
+	}
+
+	request := []byte{5, socksResolveCmd, 0, 3, byte(len(host))}
+	request = append(request, host...)
+	request = append(request, 0, 0)
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	if header[0] != 5 {
+		return nil, errors.New("invalid Tor proxy response")
+	}
+	if header[1] != 0 {
+		return nil, fmt.Errorf("Tor failed to resolve %s: SOCKS5 error %d", host, header[1])
+	}
+
+	var ip net.IP
+	switch header[3] {
+	case 1:
+		ip = make(net.IP, net.IPv4len)
+	case 4:
+		ip = make(net.IP, net.IPv6len)
+	default:
+		return nil, fmt.Errorf("Tor resolved %s to an unsupported address type %d", host, header[3])
+	}
+	if _, err := io.ReadFull(conn, ip); err != nil {
+		return nil, err
+	}
+	return []net.IP{ip}, nil
+}
+
+// markDown marks a proxy unhealthy after a failed connection.
+func (p *torProxyPool) markDown(tp *torProxy, err error) {
+	if tp.healthy.Swap(false) {
+		p.logger.Warnf("Tor proxy %s is down: %v", tp.addr, err)
+	}
+}
+
+// checkHealth probes every proxy with a TCP connection and updates its
+// health.
+func (p *torProxyPool) checkHealth() {
+	for _, tp := range p.proxies {
+		conn, err := net.DialTimeout("tcp", tp.addr, torProxyDialTimeout)
+		if err != nil {
+			p.markDown(tp, err)
+			continue
+		}
+		conn.Close()
+		if !tp.healthy.Swap(true) {
+			p.logger.Infof("Tor proxy %s is back up", tp.addr)
+		}
+	}
+}
+
+// monitor periodically checks the health of every proxy until ctx is
+// canceled.
+func (p *torProxyPool) monitor(ctx context.Context) {
+	ticker := time.NewTicker(torHealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		p.checkHealth()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
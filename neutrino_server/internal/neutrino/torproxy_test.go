@@ -0,0 +1,415 @@
+package neutrino
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btclog"
+	"golang.org/x/net/proxy"
+)
+
+// startTestSOCKS5 runs a minimal SOCKS5 server that answers every CONNECT with
+// reply and echoes data on successful connections. It returns the server
+// address.
+func startTestSOCKS5(t *testing.T, reply byte) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+
+				// Greeting: version, method count, methods
+				header := make([]byte, 2)
+				if _, err := io.ReadFull(conn, header); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(conn, make([]byte, header[1])); err != nil {
+					return
+				}
+				conn.Write([]byte{5, 0})
+
+				// Request: version, command, reserved, address type,
+				// address and port
+				request := make([]byte, 4)
+				if _, err := io.ReadFull(conn, request); err != nil {
+					return
+				}
+				var addrLen int
+				switch request[3] {
+				case 1:
+					addrLen = 4
+				case 4:
+					addrLen = 16
+				case 3:
+					length := make([]byte, 1)
+					if _, err := io.ReadFull(conn, length); err != nil {
+						return
+					}
+					addrLen = int(length[0])
+				}
+				if _, err := io.ReadFull(conn, make([]byte, addrLen+2)); err != nil {
+					return
+				}
+				conn.Write([]byte{5, reply, 0, 1, 0, 0, 0, 0, 0, 0})
+				if reply == 0 {
+					io.Copy(conn, conn)
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// startAuthSOCKS5 runs a minimal SOCKS5 server requiring username/password
+// authentication. It accepts any credentials but those of user "wrong",
+// sends the credentials of every connection on the returned channel, and
+// answers CONNECT requests with success and Tor RESOLVE requests with
+// 10.1.2.3.
+func startAuthSOCKS5(t *testing.T) (string, <-chan proxy.Auth) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	credentials := make(chan proxy.Auth, 16)
+	readString := func(conn net.Conn) (string, error) {
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return "", err
+		}
+		value := make([]byte, length[0])
+		_, err := io.ReadFull(conn, value)
+		return string(value), err
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+
+				header := make([]byte, 2)
+				if _, err := io.ReadFull(conn, header); err != nil {
+					return
+				}
+				methods := make([]byte, header[1])
+				if _, err := io.ReadFull(conn, methods); err != nil {
+					return
+				}
+				if !bytes.Contains(methods, []byte{socksPasswordAuth}) {
+					conn.Write([]byte{5, 0xff})
+					return
+				}
+				conn.Write([]byte{5, socksPasswordAuth})
+
+				// Username/password request: version, user, password
+				if _, err := io.ReadFull(conn, make([]byte, 1)); err != nil {
+					return
+				}
+				user, err := readString(conn)
+				if err != nil {
+					return
+				}
+				password, err := readString(conn)
+				if err != nil {
+					return
+				}
+				if user == "wrong" {
+					conn.Write([]byte{1, 1})
+					return
+				}
+				conn.Write([]byte{1, 0})
+				credentials <- proxy.Auth{User: user, Password: password}
+
+				request := make([]byte, 4)
+				if _, err := io.ReadFull(conn, request); err != nil {
+					return
+				}
+				if _, err := readString(conn); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(conn, make([]byte, 2)); err != nil {
+					return
+				}
+				if request[1] == socksResolveCmd {
+					conn.Write([]byte{5, 0, 0, 1, 10, 1, 2, 3})
+				} else {
+					conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), credentials
+}
+
+// closedAddr returns an address nothing listens on.
+func closedAddr(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+func TestParseTorProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    int
+		wantErr bool
+	}{
+		{"empty", "", 0, false},
+		{"single", "127.0.0.1:9050", 1, false},
+		{"several", "127.0.0.1:9050, tor:9050,,127.0.0.1:9150", 3, false},
+		{"missing port", "127.0.0.1", 0, true},
+		{"credentials", "user:pass:word@127.0.0.1:9050,user@tor:9050", 2, false},
+		{"empty user", ":password@127.0.0.1:9050", 0, true},
+		{"credentials missing port", "user:password@127.0.0.1", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTorProxies(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTorProxies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Errorf("parseTorProxies() = %v, want %d proxies", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTorProxyPoolFailover(t *testing.T) {
+	down := closedAddr(t)
+	up := startTestSOCKS5(t, 0)
+
+	pool, err := newTorProxyPool(down+","+up, false, btclog.Disabled)
+	if err != nil {
+		t.Fatalf("newTorProxyPool() failed: %v", err)
+	}
+
+	for i := range 3 {
+		conn, err := pool.Dial("tcp", "peer.example:8333")
+		if err != nil {
+			t.Fatalf("Dial() %d failed: %v", i, err)
+		}
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatalf("Write() failed: %v", err)
+		}
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+			t.Fatalf("echo = %q, %v; want ping", buf, err)
+		}
+		conn.Close()
+	}
+
+	if pool.proxies[0].healthy.Load() {
+		t.Error("unreachable proxy should be marked down")
+	}
+	if !pool.proxies[1].healthy.Load() {
+		t.Error("working proxy should stay healthy")
+	}
+
+	// Healthy proxies are tried first regardless of rotation
+	for range 2 {
+		if got := pool.candidates()[0].addr; got != up {
+			t.Errorf("first candidate = %s, want %s", got, up)
+		}
+	}
+}
+
+func TestTorProxyPoolRotation(t *testing.T) {
+	first := startTestSOCKS5(t, 0)
+	second := startTestSOCKS5(t, 0)
+
+	pool, err := newTorProxyPool(first+","+second, false, btclog.Disabled)
+	if err != nil {
+		t.Fatalf("newTorProxyPool() failed: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for range 4 {
+		seen[pool.candidates()[0].addr] = true
+	}
+	if !seen[first] || !seen[second] {
+		t.Errorf("expected connections to rotate across both proxies, got %v", seen)
+	}
+}
+
+func TestTorProxyPoolDestinationError(t *testing.T) {
+	// The proxy is reachable but refuses the destination, which says
+	// nothing about the proxy's health
+	refusing := startTestSOCKS5(t, 5)
+
+	pool, err := newTorProxyPool(refusing, false, btclog.Disabled)
+	if err != nil {
+		t.Fatalf("newTorProxyPool() failed: %v", err)
+	}
+
+	if _, err := pool.Dial("tcp", "peer.example:8333"); err == nil {
+		t.Fatal("Dial() should fail when the destination is refused")
+	}
+	if !pool.proxies[0].healthy.Load() {
+		t.Error("proxy should stay healthy after a destination error")
+	}
+}
+
+func TestTorProxyPoolHealthCheck(t *testing.T) {
+	down := closedAddr(t)
+	up := startTestSOCKS5(t, 0)
+
+	pool, err := newTorProxyPool(down+","+up, false, btclog.Disabled)
+	if err != nil {
+		t.Fatalf("newTorProxyPool() failed: %v", err)
+	}
+
+	// A proxy marked down recovers once it is listening again
+	pool.markDown(pool.proxies[1], io.EOF)
+	pool.checkHealth()
+
+	if pool.proxies[0].healthy.Load() {
+		t.Error("unreachable proxy should be marked down by the health check")
+	}
+	if !pool.proxies[1].healthy.Load() {
+		t.Error("listening proxy should be marked up by the health check")
+	}
+
+	if _, err := pool.Dial("tcp", "peer.example:8333"); err != nil {
+		t.Errorf("Dial() failed: %v", err)
+	}
+}
+
+// TestTorProxyPoolMonitorStops tests that the health monitor returns once its
+// context is canceled.
+func TestTorProxyPoolMonitorStops(t *testing.T) {
+	pool, err := newTorProxyPool(startTestSOCKS5(t, 0), false, btclog.Disabled)
+	if err != nil {
+		t.Fatalf("newTorProxyPool() failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pool.monitor(ctx)
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("monitor() did not return after its context was canceled")
+	}
+}
+
+func TestRedactTorProxy(t *testing.T) {
+	got := RedactTorProxy("127.0.0.1:9050, user:secret@proxy:1080")
+	if want := "127.0.0.1:9050,user:xxxxx@proxy:1080"; got != want {
+		t.Errorf("RedactTorProxy() = %q, want %q", got, want)
+	}
+}
+
+func TestTorProxyPoolAuthentication(t *testing.T) {
+	addr, credentials := startAuthSOCKS5(t)
+
+	pool, err := newTorProxyPool("alice:s3cret@"+addr, false, btclog.Disabled)
+	if err != nil {
+		t.Fatalf("newTorProxyPool() failed: %v", err)
+	}
+	conn, err := pool.Dial("tcp", "peer.example:8333")
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	conn.Close()
+	ips, err := pool.LookupIP("peer.example")
+	if err != nil || len(ips) != 1 || !ips[0].Equal(net.IPv4(10, 1, 2, 3)) {
+		t.Fatalf("LookupIP() = %v, %v; want 10.1.2.3", ips, err)
+	}
+	for range 2 {
+		if got := <-credentials; got != (proxy.Auth{User: "alice", Password: "s3cret"}) {
+			t.Errorf("proxy got credentials %+v, want alice:s3cret", got)
+		}
+	}
+
+	rejected, err := newTorProxyPool("wrong:password@"+addr, false, btclog.Disabled)
+	if err != nil {
+		t.Fatalf("newTorProxyPool() failed: %v", err)
+	}
+	if _, err := rejected.Dial("tcp", "peer.example:8333"); err == nil {
+		t.Error("Dial() with rejected credentials should fail")
+	}
+	if _, err := rejected.LookupIP("peer.example"); err == nil {
+		t.Error("LookupIP() with rejected credentials should fail")
+	}
+	if !rejected.proxies[0].healthy.Load() {
+		t.Error("proxy should stay healthy after rejecting credentials")
+	}
+
+	// An unauthenticated lookup is refused by the proxy
+	open, err := newTorProxyPool(addr, false, btclog.Disabled)
+	if err != nil {
+		t.Fatalf("newTorProxyPool() failed: %v", err)
+	}
+	if _, err := open.LookupIP("peer.example"); err == nil {
+		t.Error("LookupIP() without credentials should fail")
+	}
+}
+
+func TestTorProxyPoolIsolation(t *testing.T) {
+	addr, credentials := startAuthSOCKS5(t)
+
+	if _, err := newTorProxyPool("alice:s3cret@"+addr, true, btclog.Disabled); err == nil {
+		t.Error("newTorProxyPool() should refuse isolating a proxy with credentials")
+	}
+
+	pool, err := newTorProxyPool(addr, true, btclog.Disabled)
+	if err != nil {
+		t.Fatalf("newTorProxyPool() failed: %v", err)
+	}
+	for range 2 {
+		conn, err := pool.Dial("tcp", "peer.example:8333")
+		if err != nil {
+			t.Fatalf("Dial() failed: %v", err)
+		}
+		conn.Close()
+	}
+	if _, err := pool.LookupIP("peer.example"); err != nil {
+		t.Fatalf("LookupIP() failed: %v", err)
+	}
+
+	seen := make(map[proxy.Auth]bool)
+	for range 3 {
+		seen[<-credentials] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("isolated connections used credentials %v, want 3 distinct", seen)
+	}
+}
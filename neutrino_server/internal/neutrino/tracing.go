@@ -0,0 +1,58 @@
+package neutrino
+
+import (
+	"context"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records the spans of scans. Spans are only exported once a tracer
+// provider is installed, see the tracing package; until then they cost
+// little more than a function call.
+var tracer = otel.Tracer("github.com/yourusername/neutrino-api/neutrino_server/internal/neutrino")
+
+// Span attribute keys shared by the scan paths.
+const (
+	attrHeight      = attribute.Key("neutrino.height")
+	attrBlockHash   = attribute.Key("neutrino.block_hash")
+	attrStartHeight = attribute.Key("neutrino.start_height")
+	attrEndHeight   = attribute.Key("neutrino.end_height")
+)
+
+// endSpan ends span, marking it failed if err is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// fetchBlock fetches the block with hash at height from blocks in a span of
+// its own, since full block downloads usually dominate a lookup's latency.
+func fetchBlock(ctx context.Context, blocks blockGetter, hash chainhash.Hash, height int32) (*btcutil.Block, error) {
+	_, span := tracer.Start(ctx, "block.fetch", trace.WithAttributes(
+		attrHeight.Int(int(height)),
+		attrBlockHash.String(hash.String()),
+	))
+	var block *btcutil.Block
+	var err error
+	if source, ok := blocks.(contextBlockGetter); ok {
+		block, err = source.getBlock(ctx, hash)
+	} else {
+		block, err = blocks.GetBlock(hash)
+	}
+	if err == nil {
+		span.SetAttributes(
+			attribute.Int("neutrino.block_size", block.MsgBlock().SerializeSize()),
+			attribute.Int("neutrino.block_txs", len(block.Transactions())),
+		)
+	}
+	endSpan(span, err)
+	return block, err
+}
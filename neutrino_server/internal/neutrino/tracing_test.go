@@ -0,0 +1,51 @@
+package neutrino
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btclog"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spanRecorder records the spans of the package tracer. The global provider
+// is installed once, since the package tracer stays bound to the first.
+var spanRecorder = func() *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	return recorder
+}()
+
+func TestFilterPrefetcherSpans(t *testing.T) {
+	ctx, root := tracer.Start(context.Background(), "scan")
+	prefetch := newFilterPrefetcher(ctx, &fakeFilterSource{}, 10, 34, 10, btclog.Disabled)
+	err := scanRange(ctx, 10, 34, 4, func(height int32) *btcutil.Block {
+		prefetch.wait(height)
+		return nil
+	}, func(int32, *btcutil.Block) error { return nil })
+	if err != nil {
+		t.Fatalf("scanRange() error = %v", err)
+	}
+	root.End()
+
+	// Spans of scans left running by other tests are ignored
+	heights := make(map[int64]bool)
+	for _, span := range spanRecorder.Ended() {
+		if span.Name() != "filter.prefetch" || span.Parent().SpanID() != root.SpanContext().SpanID() {
+			continue
+		}
+		for _, attr := range span.Attributes() {
+			if attr.Key == attrHeight {
+				heights[attr.Value.AsInt64()] = true
+			}
+		}
+	}
+	if got := slices.Sorted(maps.Keys(heights)); !slices.Equal(got, []int64{10, 20, 30}) {
+		t.Errorf("filter.prefetch spans at heights %v, want one per batch at 10, 20 and 30", got)
+	}
+}
@@ -0,0 +1,213 @@
+package neutrino
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Transaction represents a blockchain transaction and the block that
+// confirmed it.
+type Transaction struct {
+	TxID          string     `json:"txid"`
+	WTxID         string     `json:"wtxid"`
+	Version       int32      `json:"version"`
+	LockTime      uint32     `json:"locktime"`
+	Size          int        `json:"size"`
+	VSize         int64      `json:"vsize"`
+	Weight        int64      `json:"weight"`
+	Hex           string     `json:"hex"`
+	Inputs        []TxInput  `json:"inputs"`
+	Outputs       []TxOutput `json:"outputs"`
+	BlockHash     string     `json:"block_hash"`
+	BlockHeight   int32      `json:"block_height"`
+	BlockTime     int64      `json:"block_time"`
+	Confirmations int32      `json:"confirmations"`
+}
+
+// TxInput is a transaction input. Coinbase inputs have no previous outpoint.
+type TxInput struct {
+	TxID      string   `json:"txid,omitempty"`
+	Vout      uint32   `json:"vout"`
+	Coinbase  bool     `json:"coinbase,omitempty"`
+	ScriptSig string   `json:"scriptsig"`
+	Witness   []string `json:"witness,omitempty"`
+	Sequence  uint32   `json:"sequence"`
+}
+
+// TxOutput is a transaction output. Address is empty for scripts that do not
+// pay to a single standard address.
+type TxOutput struct {
+	Vout         uint32 `json:"vout"`
+	Value        int64  `json:"value"`
+	ScriptPubKey string `json:"scriptpubkey"`
+	Type         string `json:"type"`
+	Address      string `json:"address,omitempty"`
+}
+
+// GetTransaction returns the transaction txid. Transactions touching watched
+// addresses are served from the transaction index; any other transaction is
+// found by fetching the block identified by blockHeight or blockHash, since
+// neutrino keeps no full transaction index. blockHeight is ignored when
+// negative; if both are given they must refer to the same block.
+func (n *Node) GetTransaction(ctx context.Context, txid string, blockHeight int32, blockHash string) (*Transaction, error) {
+	if n.chainService == nil {
+		return nil, errors.New("chain service not initialized")
+	}
+
+	targetHash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		return nil, NewBadRequestError(fmt.Sprintf("invalid txid: %v", err))
+	}
+
+	bestBlock, err := n.chainService.BestBlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get best block: %w", err)
+	}
+
+	indexed, found, err := n.indexedTransaction(targetHash.String(), blockHeight, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		indexed.Confirmations = bestBlock.Height - indexed.BlockHeight + 1
+		return indexed, nil
+	}
+
+	hash, height, err := n.resolveBlock(blockHeight, blockHash)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := fetchBlock(ctx, n.rescanMgr.blocks, *hash, height)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block %s: %w", hash, err)
+	}
+
+	for _, tx := range block.Transactions() {
+		if !tx.Hash().IsEqual(targetHash) {
+			continue
+		}
+
+		result, err := decodeTransaction(tx, n.chainParams)
+		if err != nil {
+			return nil, err
+		}
+		result.BlockHash = hash.String()
+		result.BlockHeight = height
+		result.BlockTime = block.MsgBlock().Header.Timestamp.Unix()
+		result.Confirmations = bestBlock.Height - height + 1
+		return result, nil
+	}
+
+	return nil, NewNotFoundError("transaction", fmt.Sprintf("transaction %s not found in block %d", txid, height))
+}
+
+// resolveBlock returns the hash and height of the block identified by height
+// (if non-negative) and/or hashStr.
+func (n *Node) resolveBlock(height int32, hashStr string) (*chainhash.Hash, int32, error) {
+	if hashStr == "" {
+		if height < 0 {
+			return nil, 0, NewBadRequestError("transaction is not indexed: block_height or block_hash is required")
+		}
+
+		hash, err := n.chainService.GetBlockHash(int64(height))
+		if err != nil {
+			return nil, 0, NewNotFoundError("block", fmt.Sprintf("no block at height %d", height))
+		}
+		return hash, height, nil
+	}
+
+	hash, err := chainhash.NewHashFromStr(hashStr)
+	if err != nil {
+		return nil, 0, NewBadRequestError(fmt.Sprintf("invalid block_hash: %v", err))
+	}
+
+	hashHeight, err := n.chainService.GetBlockHeight(hash)
+	if err != nil {
+		return nil, 0, NewNotFoundError("block", fmt.Sprintf("block %s not found", hashStr))
+	}
+
+	if height >= 0 && height != hashHeight {
+		return nil, 0, NewBadRequestError(fmt.Sprintf("block_hash %s is at height %d, not %d", hashStr, hashHeight, height))
+	}
+
+	return hash, hashHeight, nil
+}
+
+// decodeTransaction converts tx to its API representation, without block
+// details.
+func decodeTransaction(tx *btcutil.Tx, params *chaincfg.Params) (*Transaction, error) {
+	msgTx := tx.MsgTx()
+
+	var buf bytes.Buffer
+	if err := msgTx.Serialize(&buf); err != nil {
+		return nil, fmt.Errorf("failed to serialize transaction: %w", err)
+	}
+
+	weight := blockchain.GetTransactionWeight(tx)
+	result := &Transaction{
+		TxID:     tx.Hash().String(),
+		WTxID:    tx.WitnessHash().String(),
+		Version:  msgTx.Version,
+		LockTime: msgTx.LockTime,
+		Size:     buf.Len(),
+		VSize:    (weight + blockchain.WitnessScaleFactor - 1) / blockchain.WitnessScaleFactor,
+		Weight:   weight,
+		Hex:      hex.EncodeToString(buf.Bytes()),
+		Inputs:   make([]TxInput, 0, len(msgTx.TxIn)),
+		Outputs:  make([]TxOutput, 0, len(msgTx.TxOut)),
+	}
+
+	coinbase := blockchain.IsCoinBaseTx(msgTx)
+	for _, txIn := range msgTx.TxIn {
+		input := TxInput{
+			ScriptSig: hex.EncodeToString(txIn.SignatureScript),
+			Sequence:  txIn.Sequence,
+			Coinbase:  coinbase,
+		}
+		if !coinbase {
+			input.TxID = txIn.PreviousOutPoint.Hash.String()
+			input.Vout = txIn.PreviousOutPoint.Index
+		}
+		for _, item := range txIn.Witness {
+			input.Witness = append(input.Witness, hex.EncodeToString(item))
+		}
+		result.Inputs = append(result.Inputs, input)
+	}
+
+	for i, txOut := range msgTx.TxOut {
+		result.Outputs = append(result.Outputs, decodeOutput(uint32(i), txOut, params))
+	}
+
+	return result, nil
+}
+
+// decodeOutput converts txOut to its API representation.
+func decodeOutput(vout uint32, txOut *wire.TxOut, params *chaincfg.Params) TxOutput {
+	output := TxOutput{
+		Vout:         vout,
+		Value:        txOut.Value,
+		ScriptPubKey: hex.EncodeToString(txOut.PkScript),
+	}
+
+	class, addrs, _, err := txscript.ExtractPkScriptAddrs(txOut.PkScript, params)
+	if err != nil {
+		class = txscript.NonStandardTy
+	}
+	output.Type = class.String()
+	if len(addrs) == 1 && class != txscript.MultiSigTy {
+		output.Address = addrs[0].EncodeAddress()
+	}
+
+	return output
+}
@@ -0,0 +1,63 @@
+package neutrino
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestDecodeTransaction(t *testing.T) {
+	genesis := btcutil.NewTx(chaincfg.MainNetParams.GenesisBlock.Transactions[0])
+
+	got, err := decodeTransaction(genesis, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("decodeTransaction() failed: %v", err)
+	}
+
+	if got.TxID != "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b" || got.WTxID != got.TxID {
+		t.Errorf("unexpected ids: txid=%s wtxid=%s", got.TxID, got.WTxID)
+	}
+	if got.Size != 204 || got.VSize != 204 || got.Weight != 816 {
+		t.Errorf("unexpected size: size=%d vsize=%d weight=%d", got.Size, got.VSize, got.Weight)
+	}
+	if len(got.Hex) != 2*got.Size {
+		t.Errorf("hex has %d chars, want %d", len(got.Hex), 2*got.Size)
+	}
+
+	if len(got.Inputs) != 1 || !got.Inputs[0].Coinbase || got.Inputs[0].TxID != "" {
+		t.Errorf("expected a single coinbase input, got %+v", got.Inputs)
+	}
+
+	want := TxOutput{Vout: 0, Value: 5000000000, Type: "pubkey", Address: "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"}
+	if len(got.Outputs) != 1 {
+		t.Fatalf("expected 1 output, got %d", len(got.Outputs))
+	}
+	got.Outputs[0].ScriptPubKey = ""
+	if got.Outputs[0] != want {
+		t.Errorf("output = %+v, want %+v", got.Outputs[0], want)
+	}
+}
+
+func TestDecodeOutput(t *testing.T) {
+	tests := []struct {
+		name        string
+		pkScript    []byte
+		wantType    string
+		wantAddress string
+	}{
+		{"p2pkh", append(append([]byte{0x76, 0xa9, 0x14}, make([]byte, 20)...), 0x88, 0xac), "pubkeyhash", "1111111111111111111114oLvT2"},
+		{"op_return", []byte{0x6a, 0x01, 0x01}, "nulldata", ""},
+		{"nonstandard", []byte{0xff}, "nonstandard", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decodeOutput(0, wire.NewTxOut(1, tt.pkScript), &chaincfg.MainNetParams)
+			if got.Type != tt.wantType || got.Address != tt.wantAddress {
+				t.Errorf("decodeOutput() = %+v, want type %s address %q", got, tt.wantType, tt.wantAddress)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package neutrino
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// IndexedTx is a transaction touching a watched address, stored so it can be
+// served without downloading its block again.
+type IndexedTx struct {
+	Hex         string `json:"hex"`
+	BlockHash   string `json:"block_hash"`
+	BlockHeight int32  `json:"block_height"`
+	BlockTime   int64  `json:"block_time"`
+}
+
+// newIndexedTx serializes tx, confirmed in block at height, for the index.
+func newIndexedTx(tx *btcutil.Tx, block *btcutil.Block, height int32) (IndexedTx, error) {
+	var buf bytes.Buffer
+	if err := tx.MsgTx().Serialize(&buf); err != nil {
+		return IndexedTx{}, fmt.Errorf("failed to serialize transaction %s: %w", tx.Hash(), err)
+	}
+
+	return IndexedTx{
+		Hex:         hex.EncodeToString(buf.Bytes()),
+		BlockHash:   block.Hash().String(),
+		BlockHeight: height,
+		BlockTime:   block.MsgBlock().Header.Timestamp.Unix(),
+	}, nil
+}
+
+// decode parses the stored transaction.
+func (t *IndexedTx) decode() (*btcutil.Tx, error) {
+	raw, err := hex.DecodeString(t.Hex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode indexed transaction: %w", err)
+	}
+
+	var msgTx wire.MsgTx
+	if err := msgTx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("failed to deserialize indexed transaction: %w", err)
+	}
+	return btcutil.NewTx(&msgTx), nil
+}
+
+// indexedTransaction returns txid from the transaction index if it is there
+// and consistent with the optional block height and hash the caller gave.
+func (n *Node) indexedTransaction(txid string, blockHeight int32, blockHash string) (*Transaction, bool, error) {
+	if n.store == nil {
+		return nil, false, nil
+	}
+
+	indexed, found, err := n.store.Transaction(txid)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	if (blockHeight >= 0 && blockHeight != indexed.BlockHeight) || (blockHash != "" && blockHash != indexed.BlockHash) {
+		return nil, false, nil
+	}
+
+	tx, err := indexed.decode()
+	if err != nil {
+		return nil, false, err
+	}
+
+	result, err := decodeTransaction(tx, n.chainParams)
+	if err != nil {
+		return nil, false, err
+	}
+	result.BlockHash = indexed.BlockHash
+	result.BlockHeight = indexed.BlockHeight
+	result.BlockTime = indexed.BlockTime
+	return result, true, nil
+}
@@ -0,0 +1,108 @@
+package neutrino
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+)
+
+func TestTransactionIndex(t *testing.T) {
+	store := newTestStore(t)
+	mgr := &RescanManager{
+		chainParams:    &chaincfg.MainNetParams,
+		store:          store,
+		logger:         btclog.Disabled,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
+	}
+
+	addr, err := btcutil.DecodeAddress("1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("failed to decode address: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("failed to create script: %v", err)
+	}
+
+	// A UTXO found by an earlier scan
+	watchedPrev := chainhash.Hash{0x01}
+	mgr.utxoSet[watchedPrev.String()+":0"] = UTXO{TxID: watchedPrev.String(), Address: addr.String()}
+
+	newTx := func(prev chainhash.Hash, outScript []byte) *wire.MsgTx {
+		tx := wire.NewMsgTx(2)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prev, 0), nil, nil))
+		tx.AddTxOut(wire.NewTxOut(1000, outScript))
+		return tx
+	}
+	receive := newTx(chainhash.Hash{0x02}, pkScript)
+	spend := newTx(watchedPrev, []byte{txscript.OP_TRUE})
+	unrelated := newTx(chainhash.Hash{0x03}, []byte{txscript.OP_TRUE})
+
+	msgBlock := wire.NewMsgBlock(wire.NewBlockHeader(1, &chainhash.Hash{}, &chainhash.Hash{}, 0, 0))
+	msgBlock.Header.Timestamp = time.Unix(1700000000, 0)
+	for _, tx := range []*wire.MsgTx{receive, spend, unrelated} {
+		if err := msgBlock.AddTransaction(tx); err != nil {
+			t.Fatalf("failed to add transaction: %v", err)
+		}
+	}
+	block := btcutil.NewBlock(msgBlock)
+
+	foundTxs := make(map[string]IndexedTx)
+	addrToScript := map[string]string{hex.EncodeToString(pkScript): addr.String()}
+	mgr.processBlock(100, block, addrToScript, make(map[string]UTXO), make(map[string]Spend), foundTxs)
+
+	if len(foundTxs) != 2 {
+		t.Fatalf("expected 2 indexed transactions, got %d", len(foundTxs))
+	}
+	if _, ok := foundTxs[unrelated.TxHash().String()]; ok {
+		t.Error("unrelated transaction should not be indexed")
+	}
+
+	if err := store.PutTransactions(foundTxs); err != nil {
+		t.Fatalf("PutTransactions() failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		txid      string
+		wantFound bool
+	}{
+		{"receive", receive.TxHash().String(), true},
+		{"spend", spend.TxHash().String(), true},
+		{"unrelated", unrelated.TxHash().String(), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexed, found, err := store.Transaction(tt.txid)
+			if err != nil {
+				t.Fatalf("Transaction() failed: %v", err)
+			}
+			if found != tt.wantFound {
+				t.Fatalf("Transaction() found = %v, want %v", found, tt.wantFound)
+			}
+			if !found {
+				return
+			}
+
+			if indexed.BlockHeight != 100 || indexed.BlockHash != block.Hash().String() || indexed.BlockTime != 1700000000 {
+				t.Errorf("unexpected block details: %+v", indexed)
+			}
+			tx, err := indexed.decode()
+			if err != nil {
+				t.Fatalf("decode() failed: %v", err)
+			}
+			if tx.Hash().String() != tt.txid {
+				t.Errorf("decoded txid %s, want %s", tx.Hash(), tt.txid)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package neutrino
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// BlockUndo records the changes a block made to the watched UTXO set, so
+// they can be unwound if the block is disconnected by a reorg.
+type BlockUndo struct {
+	// Created lists the "txid:vout" keys of watched UTXOs the block created.
+	Created []string `json:"created,omitempty"`
+
+	// Spent holds the watched UTXOs the block spent, as they were before.
+	Spent []UTXO `json:"spent,omitempty"`
+}
+
+// merge returns the union of b and other.
+func (b BlockUndo) merge(other BlockUndo) BlockUndo {
+	merged := BlockUndo{
+		Created: slices.Clone(b.Created),
+		Spent:   slices.Clone(b.Spent),
+	}
+	for _, key := range other.Created {
+		if !slices.Contains(merged.Created, key) {
+			merged.Created = append(merged.Created, key)
+		}
+	}
+	for _, utxo := range other.Spent {
+		if !slices.ContainsFunc(merged.Spent, func(u UTXO) bool { return u.TxID == utxo.TxID && u.Vout == utxo.Vout }) {
+			merged.Spent = append(merged.Spent, utxo)
+		}
+	}
+	return merged
+}
+
+// Rollback is the result of unwinding the blocks above a fork.
+type Rollback struct {
+	// Removed lists the UTXOs created above the fork, which were deleted.
+	Removed []string
+
+	// Restored holds the UTXOs spent above the fork, which are unspent again.
+	Restored []UTXO
+
+	// Addresses lists the watched addresses whose scanned height was rewound
+	// to the fork, which must be scanned again on the new chain.
+	Addresses []string
+}
+
+// blockUndo groups the changes of a scan batch by block height. Spends
+// without a height cannot be attributed to a block and are not recorded.
+// Callers must hold mu.
+func (r *RescanManager) blockUndo(foundUTXOs map[string]UTXO, spentOutputs map[string]Spend) map[int32]BlockUndo {
+	undo := make(map[int32]BlockUndo)
+	for key, utxo := range foundUTXOs {
+		block := undo[utxo.Height]
+		block.Created = append(block.Created, key)
+		undo[utxo.Height] = block
+	}
+	for key, spend := range spentOutputs {
+		if spend.SpendingHeight <= 0 {
+			continue
+		}
+		utxo, ok := r.utxoSet[key]
+		if !ok {
+			// Created in this batch, so unwound with its own block
+			continue
+		}
+		block := undo[spend.SpendingHeight]
+		block.Spent = append(block.Spent, utxo)
+		undo[spend.SpendingHeight] = block
+	}
+	return undo
+}
+
+// RollbackBlocks unwinds the UTXO changes recorded for blocks above fork,
+// both on disk and in memory, and returns the addresses that must be
+// rescanned from fork+1.
+func (r *RescanManager) RollbackBlocks(fork int32) ([]string, error) {
+	if r.store == nil {
+		return nil, nil
+	}
+
+	rollback, err := r.store.RollbackBlocks(fork)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	for _, key := range rollback.Removed {
+		delete(r.utxoSet, key)
+	}
+	for _, utxo := range rollback.Restored {
+		r.utxoSet[fmt.Sprintf("%s:%d", utxo.TxID, utxo.Vout)] = utxo
+	}
+	r.mu.Unlock()
+
+	r.logger.Infof("Rolled back blocks above %d: removed %d UTXOs, restored %d", fork, len(rollback.Removed), len(rollback.Restored))
+	return rollback.Addresses, nil
+}
+
+// PruneBlockUndo drops the undo data of blocks below height, which are too
+// deep to be reorged.
+func (r *RescanManager) PruneBlockUndo(height int32) {
+	if r.store == nil {
+		return
+	}
+	if _, err := r.store.PruneBlockUndo(height); err != nil {
+		r.logger.Warnf("Failed to prune block undo data: %v", err)
+	}
+}
+
+// reapplyReorg unwinds the watched UTXO changes of the blocks disconnected
+// by reorg and rescans the new chain from the fork for the affected
+// addresses, until ctx is canceled.
+func (n *Node) reapplyReorg(ctx context.Context, reorg *Reorg) {
+	addresses, err := n.rescanMgr.RollbackBlocks(reorg.ForkHeight)
+	if err != nil {
+		n.logger.Errorf("Failed to roll back reorged blocks: %v", err)
+		return
+	}
+	if len(addresses) == 0 {
+		return
+	}
+
+	n.logger.Infof("Rescanning %d addresses from height %d after reorg", len(addresses), logging.KV("height", reorg.ForkHeight+1))
+	if err := n.rescanMgr.Rescan(ctx, reorg.ForkHeight+1, addresses); err != nil && !errors.Is(err, context.Canceled) {
+		n.logger.Errorf("Rescan after reorg failed: %v", err)
+	}
+}
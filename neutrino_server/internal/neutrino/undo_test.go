@@ -0,0 +1,132 @@
+package neutrino
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btclog"
+)
+
+func TestRollbackBlocks(t *testing.T) {
+	store := newTestStore(t)
+	mgr := &RescanManager{
+		chainParams:    &chaincfg.MainNetParams,
+		store:          store,
+		logger:         btclog.Disabled,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
+	}
+
+	addr := "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	if err := mgr.WatchAddress(addr); err != nil {
+		t.Fatal(err)
+	}
+
+	job := &RescanJob{Addresses: []string{addr}, CheckpointHeight: -1}
+	early := map[string]UTXO{
+		"tx1:0": {TxID: "tx1", Vout: 0, Value: 1000, Address: addr, Height: 10},
+		"tx2:0": {TxID: "tx2", Vout: 0, Value: 2000, Address: addr, Height: 20},
+	}
+	if err := mgr.commitScanProgress(job, 100, job.Addresses, early, map[string]Spend{}); err != nil {
+		t.Fatalf("commitScanProgress() failed: %v", err)
+	}
+
+	// Blocks 150 and 151 create a UTXO, spend tx1:0 and spend the new UTXO
+	late := map[string]UTXO{
+		"tx3:0": {TxID: "tx3", Vout: 0, Value: 3000, Address: addr, Height: 150},
+	}
+	spent := map[string]Spend{
+		"tx1:0": {SpendingTxID: "tx4", SpendingHeight: 150},
+		"tx3:0": {SpendingTxID: "tx5", SpendingHeight: 151},
+	}
+	if err := mgr.commitScanProgress(job, 160, job.Addresses, late, spent); err != nil {
+		t.Fatalf("commitScanProgress() failed: %v", err)
+	}
+	if err := store.PutTransactions(map[string]IndexedTx{
+		"tx2": {BlockHeight: 20},
+		"tx4": {BlockHeight: 150},
+	}); err != nil {
+		t.Fatalf("PutTransactions() failed: %v", err)
+	}
+
+	addresses, err := mgr.RollbackBlocks(149)
+	if err != nil {
+		t.Fatalf("RollbackBlocks() failed: %v", err)
+	}
+	if !slices.Equal(addresses, []string{addr}) {
+		t.Errorf("RollbackBlocks() = %v, want [%s]", addresses, addr)
+	}
+
+	wantKeys := []string{"tx1:0", "tx2:0"}
+	if got := slices.Sorted(maps.Keys(mgr.utxoSet)); !slices.Equal(got, wantKeys) {
+		t.Errorf("in-memory UTXOs = %v, want %v", got, wantKeys)
+	}
+	utxos, err := store.UTXOs()
+	if err != nil {
+		t.Fatalf("UTXOs() failed: %v", err)
+	}
+	if got := slices.Sorted(maps.Keys(utxos)); !slices.Equal(got, wantKeys) {
+		t.Errorf("persisted UTXOs = %v, want %v", got, wantKeys)
+	}
+	if status, found, err := store.Outpoint("tx1:0"); err != nil || !found || status.Spent {
+		t.Errorf("Outpoint(tx1:0) = %+v, %v, %v; want unspent", status, found, err)
+	}
+	if _, found, err := store.Outpoint("tx3:0"); err != nil || found {
+		t.Errorf("Outpoint(tx3:0) found = %v, %v; want unknown", found, err)
+	}
+
+	if _, found, _ := store.Transaction("tx4"); found {
+		t.Error("transaction from a disconnected block is still indexed")
+	}
+	if _, found, _ := store.Transaction("tx2"); !found {
+		t.Error("transaction below the fork was dropped from the index")
+	}
+
+	watched, err := store.WatchedAddresses()
+	if err != nil {
+		t.Fatalf("WatchedAddresses() failed: %v", err)
+	}
+	if watched[addr].ScannedHeight != 149 {
+		t.Errorf("scanned height = %d, want 149", watched[addr].ScannedHeight)
+	}
+
+	// The undo data was consumed
+	if addresses, err := mgr.RollbackBlocks(149); err != nil || len(addresses) != 0 {
+		t.Errorf("second RollbackBlocks() = %v, %v; want nothing to rescan", addresses, err)
+	}
+}
+
+func TestPruneBlockUndo(t *testing.T) {
+	store := newTestStore(t)
+
+	undo := map[int32]BlockUndo{
+		10: {Created: []string{"tx1:0"}},
+		20: {Created: []string{"tx2:0"}},
+		30: {Spent: []UTXO{{TxID: "tx1", Vout: 0, Height: 10}}},
+	}
+	if err := store.AddBlockUndo(undo); err != nil {
+		t.Fatalf("AddBlockUndo() failed: %v", err)
+	}
+	// A rescan of the same block merges with its undo data
+	if err := store.AddBlockUndo(map[int32]BlockUndo{20: {Created: []string{"tx2:0", "tx2:1"}}}); err != nil {
+		t.Fatalf("AddBlockUndo() failed: %v", err)
+	}
+
+	pruned, err := store.PruneBlockUndo(20)
+	if err != nil || pruned != 1 {
+		t.Fatalf("PruneBlockUndo() = %d, %v; want 1", pruned, err)
+	}
+
+	rollback, err := store.RollbackBlocks(0)
+	if err != nil {
+		t.Fatalf("RollbackBlocks() failed: %v", err)
+	}
+	if want := []string{"tx2:0", "tx2:1"}; !slices.Equal(rollback.Removed, want) {
+		t.Errorf("removed = %v, want %v", rollback.Removed, want)
+	}
+	if len(rollback.Restored) != 0 {
+		t.Errorf("restored %v, want nothing for a UTXO created above the fork", rollback.Restored)
+	}
+}
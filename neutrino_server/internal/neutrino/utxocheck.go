@@ -0,0 +1,449 @@
+package neutrino
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/gcs"
+	"github.com/btcsuite/btcd/btcutil/gcs/builder"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btclog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// maxUTXOChecks bounds the number of outpoints in one CheckUTXOs call.
+const maxUTXOChecks = 1000
+
+// UTXOCheck is one outpoint of a batch spend check. As with GetUTXO, the
+// address it pays is required to match compact block filters.
+type UTXOCheck struct {
+	TxID        string `json:"txid"`
+	Vout        uint32 `json:"vout"`
+	Address     string `json:"address"`
+	StartHeight int32  `json:"start_height"`
+}
+
+// UTXOCheckResult answers one UTXOCheck. Error is set instead of the report
+// when the outpoint could not be answered, for example because it was not
+// found.
+type UTXOCheckResult struct {
+	TxID string `json:"txid"`
+	Vout uint32 `json:"vout"`
+	*UTXOSpendReport
+	Error string `json:"error,omitempty"`
+}
+
+// outpointLookup is the scan state of one outpoint lookup.
+type outpointLookup struct {
+	txid     *chainhash.Hash
+	vout     uint32
+	pkScript []byte
+
+	// startHeight is where scanning starts: the requested height, or just
+	// past the hint's scanned height once the creation is known.
+	startHeight int32
+
+	hintKey string
+	hint    HeightHint
+
+	// logger tags the lookup's log lines with the ID of the request it
+	// serves.
+	logger btclog.Logger
+}
+
+// newOutpointLookup validates a lookup of txid:vout paying address and loads
+// the height hint left by earlier lookups of the same outpoint and script, so
+// known-empty ranges are never rescanned.
+func (n *Node) newOutpointLookup(ctx context.Context, txid string, vout uint32, address string, startHeight int32) (*outpointLookup, error) {
+	if address == "" {
+		return nil, NewBadRequestError("address is required: neutrino uses compact block filters which match on scripts, not outpoints")
+	}
+
+	// Parse the address to get the pkScript
+	addr, err := btcutil.DecodeAddress(address, n.chainParams)
+	if err != nil {
+		return nil, NewBadRequestError(fmt.Sprintf("invalid address %s: %v", address, err))
+	}
+
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create script for address %s: %w", address, err)
+	}
+
+	// Parse txid
+	targetHash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		return nil, NewBadRequestError(fmt.Sprintf("invalid txid: %v", err))
+	}
+
+	lookup := &outpointLookup{
+		txid:        targetHash,
+		vout:        vout,
+		pkScript:    pkScript,
+		startHeight: startHeight,
+		hintKey:     heightHintKey(targetHash.String(), vout, pkScript),
+		logger:      logging.FromContext(ctx, n.logger),
+	}
+	lookup.hint = n.heightHint(lookup.hintKey)
+	if lookup.hint.Created {
+		// The creating transaction is known and unspent through ScannedHeight
+		lookup.startHeight = lookup.hint.ScannedHeight + 1
+	}
+	return lookup, nil
+}
+
+// cachedReport returns the report for a spend already recorded by the height
+// hint, or nil if the outpoint still needs scanning.
+func (l *outpointLookup) cachedReport() *UTXOSpendReport {
+	if !l.hint.Spent() {
+		return nil
+	}
+	report := l.hint.report()
+	report.Confidence = &Confidence{Level: ConfidenceCached, AsOfHeight: l.hint.SpendingHeight}
+	return report
+}
+
+// fetchMatchingBlock returns the block at height if its filter matches any of
+// scripts, or nil. Heights whose filter or block cannot be fetched are added
+// to skips.
+func (n *Node) fetchMatchingBlock(ctx context.Context, height int32, scripts [][]byte, skips *skipTracker) *btcutil.Block {
+	blockHash, matched := n.matchFilter(ctx, height, scripts, skips)
+	if !matched {
+		return nil
+	}
+	return n.fetchBlockAt(ctx, height, blockHash, skips)
+}
+
+// fetchPlannedBlock is fetchMatchingBlock for a scan using plan at a height
+// in segment. It returns the block if its filter matches any of the scripts
+// of plan that active reports scanned for, or all of them if active is nil.
+func (n *Node) fetchPlannedBlock(ctx context.Context, plan *scanPlan, segment *cacheSegment, height int32, active func(i int) bool, skips *skipTracker) *btcutil.Block {
+	hits := plan.match(segment, height, func(scripts [][]byte) []int {
+		return n.matchFilterEach(ctx, height, scripts, skips)
+	})
+	if !slices.ContainsFunc(hits, func(i int) bool { return active == nil || active(i) }) {
+		return nil
+	}
+
+	blockHash, err := n.chainService.GetBlockHash(int64(height))
+	if err != nil {
+		n.logger.Debugf("Failed to get block hash for height %d: %v", logging.KV("height", height), err)
+		skips.add(height)
+		return nil
+	}
+	return n.fetchBlockAt(ctx, height, blockHash, skips)
+}
+
+// fetchBlockAt fetches the block at height with blockHash, whose filter
+// matched. A block that cannot be fetched is added to skips.
+func (n *Node) fetchBlockAt(ctx context.Context, height int32, blockHash *chainhash.Hash, skips *skipTracker) *btcutil.Block {
+	logger := logging.FromContext(ctx, n.logger)
+	logger.Debugf("Block %d filter matched, fetching full block", logging.KV("height", height))
+
+	// Filter matched - fetch the full block
+	block, err := shareFetch(n.flights, blockFlight(*blockHash), func() (*btcutil.Block, error) {
+		return fetchBlock(ctx, n.rescanMgr.blocks, *blockHash, height)
+	})
+	if err != nil {
+		logger.Warnf("Failed to get block %d: %v", logging.KV("height", height), err)
+		skips.add(height)
+		return nil
+	}
+
+	return block
+}
+
+// matchFilter reports whether the filter of the block at height matches any
+// of scripts, returning the block's hash. Heights whose filter cannot be
+// fetched are added to skips and reported as not matching.
+func (n *Node) matchFilter(ctx context.Context, height int32, scripts [][]byte, skips *skipTracker) (*chainhash.Hash, bool) {
+	blockHash, filter := n.filterAt(ctx, height, skips)
+	if filter == nil {
+		return nil, false
+	}
+
+	// Check if the filter matches any of our scripts
+	key := builder.DeriveKey(blockHash)
+	matched, err := filter.MatchAny(key, scripts)
+	if err != nil {
+		n.logger.Debugf("Filter match error for block %d: %v", logging.KV("height", height), err)
+		skips.add(height)
+		return nil, false
+	}
+
+	return blockHash, matched
+}
+
+// filterAt returns the hash and compact filter of the block at height. Heights
+// whose filter cannot be fetched are added to skips and return no filter.
+func (n *Node) filterAt(ctx context.Context, height int32, skips *skipTracker) (*chainhash.Hash, *gcs.Filter) {
+	// Get block hash
+	blockHash, err := n.chainService.GetBlockHash(int64(height))
+	if err != nil {
+		n.logger.Debugf("Failed to get block hash for height %d: %v", logging.KV("height", height), err)
+		skips.add(height)
+		return nil, nil
+	}
+
+	// Get compact block filter
+	filter, err := shareFetch(n.flights, filterFlight(*blockHash), func() (*gcs.Filter, error) {
+		return n.metrics.getCFilter(ctx, n.chainService, *blockHash)
+	})
+	if err != nil {
+		n.logger.Debugf("Failed to get filter for block %d: %v", logging.KV("height", height), err)
+		skips.add(height)
+		return nil, nil
+	}
+
+	if filter == nil {
+		skips.add(height)
+		return nil, nil
+	}
+	return blockHash, filter
+}
+
+// notifyBlock passes a block fetched by a lookup to the rescan manager's
+// block observers.
+func (n *Node) notifyBlock(height int32, block *btcutil.Block) {
+	if n.rescanMgr != nil {
+		n.rescanMgr.NotifyBlock(height, block)
+	}
+}
+
+// observeOutpoint records the creation and spend of the looked-up outpoint in
+// block.
+func (n *Node) observeOutpoint(l *outpointLookup, height int32, block *btcutil.Block, direction ScanDirection) {
+	for _, tx := range block.Transactions() {
+		txHash := tx.Hash()
+
+		// Check if this is the transaction we're looking for
+		if !l.hint.Created && txHash.IsEqual(l.txid) && int(l.vout) < len(tx.MsgTx().TxOut) {
+			l.hint.recordCreation(height, tx.MsgTx().TxOut[l.vout])
+			l.logger.Infof("Found UTXO creation at height %d", logging.KV("height", height))
+		}
+
+		// Check if this transaction spends our UTXO. Scanning backward
+		// the spend is seen before the creation.
+		if !l.hint.Created && direction == ScanForward {
+			continue
+		}
+		for inputIdx, txIn := range tx.MsgTx().TxIn {
+			prevOut := txIn.PreviousOutPoint
+			if prevOut.Hash.IsEqual(l.txid) && prevOut.Index == l.vout {
+				l.hint.recordSpend(txHash.String(), uint32(inputIdx), height)
+				l.logger.Infof("Found UTXO spend at height %d in tx %s", logging.KV("height", height), logging.KV("txid", l.hint.SpendingTxID))
+				break
+			}
+		}
+	}
+}
+
+// saveLookupProgress saves the height hint of l after its scan stopped short
+// with the blocks from its start height below next checked, so a lookup
+// repeated from next still knows where the outpoint was created.
+func (n *Node) saveLookupProgress(l *outpointLookup, skips *skipTracker, next int32) {
+	hint := &l.hint
+	if !hint.Created {
+		return
+	}
+	if !hint.Spent() {
+		through := next - 1
+		if skipped := skips.ranges(max(l.startHeight, hint.CreationHeight+1), through); len(skipped) > 0 {
+			through = skipped[0].Start - 1
+		}
+		hint.ScannedHeight = max(hint.ScannedHeight, hint.CreationHeight, through)
+	}
+	n.putHeightHint(l.hintKey, *hint)
+}
+
+// finishLookup builds the report for l once blocks from its start height
+// through endHeight have been scanned, and saves the advanced height hint.
+func (n *Node) finishLookup(l *outpointLookup, skips *skipTracker, endHeight int32) (*UTXOSpendReport, error) {
+	hint := &l.hint
+
+	// A spend is definitive, since an outpoint can only be spent once.
+	// Otherwise only blocks after the creation could hold a missed spend.
+	var skipped []HeightRange
+	if !hint.Spent() {
+		from := l.startHeight
+		if hint.Created {
+			from = max(from, hint.CreationHeight+1)
+		}
+		skipped = skips.ranges(from, endHeight)
+	}
+	if len(skipped) > 0 && n.config.ScanMode == ScanStrict {
+		return nil, &IncompleteScanError{Skipped: skipped}
+	}
+
+	// Build response
+	if !hint.Created && !hint.Spent() {
+		if len(skipped) > 0 {
+			return nil, NewNotFoundError("UTXO", fmt.Sprintf("UTXO not found, but blocks %s could not be checked", formatRanges(skipped)))
+		}
+		return nil, NewNotFoundError("UTXO", "UTXO not found: ensure start_height is at or before the block containing the transaction")
+	}
+
+	// The hint only advances through blocks that were all checked
+	scanned := l.startHeight <= endHeight
+	if !hint.Spent() && scanned {
+		hint.ScannedHeight = endHeight
+		if len(skipped) > 0 {
+			hint.ScannedHeight = skipped[0].Start - 1
+		}
+	}
+	n.putHeightHint(l.hintKey, *hint)
+
+	report := hint.report()
+	report.Confidence = scanConfidence(skipped)
+	if !scanned {
+		report.Confidence = &Confidence{Level: ConfidenceCached, AsOfHeight: hint.ScannedHeight}
+	}
+	l.logger.Infof("UTXO %s:%d found at height %d, unspent=%v", l.txid, l.vout, logging.KV("height", hint.CreationHeight), report.Unspent)
+	return report, nil
+}
+
+// CheckUTXOs answers a batch of GetUTXO-style lookups with a single forward
+// scan from the lowest start height to the tip. Each block is fetched at most
+// once and is matched against the scripts of every lookup that has started
+// by that height. Invalid checks fail the whole batch; outpoints that cannot
+// be answered get an error in their result.
+func (n *Node) CheckUTXOs(ctx context.Context, checks []UTXOCheck) (results []UTXOCheckResult, err error) {
+	ctx, span := tracer.Start(ctx, "CheckUTXOs", trace.WithAttributes(attribute.Int("neutrino.checks", len(checks))))
+	defer func() { endSpan(span, err) }()
+
+	if n.chainService == nil {
+		return nil, errors.New("chain service not initialized")
+	}
+
+	if len(checks) == 0 {
+		return nil, NewBadRequestError("at least one check is required")
+	}
+	if len(checks) > maxUTXOChecks {
+		return nil, NewBadRequestError(fmt.Sprintf("too many checks: %d (max %d)", len(checks), maxUTXOChecks))
+	}
+
+	// Scan up to the filter tip, as blocks above it cannot be checked
+	blockHeight, endHeight, err := n.scanTip()
+	if err != nil {
+		return nil, err
+	}
+
+	results = make([]UTXOCheckResult, len(checks))
+	var pending []*outpointLookup
+	var pendingIdx []int
+	for i, check := range checks {
+		lookup, err := n.newOutpointLookup(ctx, check.TxID, check.Vout, check.Address, check.StartHeight)
+		if err != nil {
+			var badRequest *BadRequestError
+			if errors.As(err, &badRequest) {
+				return nil, NewBadRequestError(fmt.Sprintf("checks[%d]: %s", i, badRequest.Message))
+			}
+			return nil, err
+		}
+
+		results[i] = UTXOCheckResult{TxID: lookup.txid.String(), Vout: check.Vout}
+		if report := lookup.cachedReport(); report != nil {
+			results[i].UTXOSpendReport = report
+			continue
+		}
+		if _, err := scanEnd(check.StartHeight, 0, blockHeight, endHeight); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		pending = append(pending, lookup)
+		pendingIdx = append(pendingIdx, i)
+	}
+
+	var skips skipTracker
+	if len(pending) > 0 {
+		startHeight := pending[0].startHeight
+		for _, lookup := range pending[1:] {
+			startHeight = min(startHeight, lookup.startHeight)
+		}
+
+		logging.FromContext(ctx, n.logger).Infof("Checking %d UTXOs (%d cached) from height %d to %d",
+			len(checks), len(checks)-len(pending), logging.KV("height", startHeight), endHeight)
+		span.SetAttributes(attrStartHeight.Int(int(startHeight)), attrEndHeight.Int(int(endHeight)))
+
+		prefetch := newFilterPrefetcher(ctx, n.chainService, startHeight, endHeight, n.config.FilterBatchSize, n.logger)
+		prefetch.flights = n.flights
+		prefetch.fill = n.metrics.filterFill(n.chainService)
+		scripts := make([][]byte, len(pending))
+		for i, lookup := range pending {
+			scripts[i] = lookup.pkScript
+		}
+		plan := n.scans.newPlan(n.chainService, scripts, startHeight, endHeight)
+		fetch := func(height int32) *btcutil.Block {
+			prefetch.wait(height)
+
+			// Only lookups that have started by this height need to match,
+			// but cached segments are matched for every lookup
+			if segment := plan.segment(ctx, height); segment != nil {
+				started := func(i int) bool { return pending[i].startHeight <= height }
+				return n.fetchPlannedBlock(ctx, plan, segment, height, started, &skips)
+			}
+			var scripts [][]byte
+			for _, lookup := range pending {
+				if lookup.startHeight <= height {
+					scripts = append(scripts, lookup.pkScript)
+				}
+			}
+			if len(scripts) == 0 {
+				return nil
+			}
+			return n.fetchMatchingBlock(ctx, height, scripts, &skips)
+		}
+
+		next := startHeight
+		apply := func(height int32, block *btcutil.Block) error {
+			next = height + 1
+			if block == nil {
+				return nil
+			}
+
+			n.notifyBlock(height, block)
+
+			// Stop once every outpoint is spent, since nothing later can
+			// change the answers
+			done := true
+			for _, lookup := range pending {
+				if height >= lookup.startHeight && !lookup.hint.Spent() {
+					n.observeOutpoint(lookup, height, block, ScanForward)
+				}
+				done = done && lookup.hint.Spent()
+			}
+			if done {
+				return errStopScan
+			}
+			return nil
+		}
+
+		if err := scanRange(ctx, startHeight, endHeight, n.config.ScanWorkers, fetch, apply); err != nil {
+			// Outpoints found so far are answered from their hints when
+			// the batch is repeated from next
+			for _, lookup := range pending {
+				n.saveLookupProgress(lookup, &skips, next)
+			}
+			return nil, deadlineError(err, next)
+		}
+		plan.store(ctx, startHeight, next-1, skips.ranges(startHeight, next-1))
+	}
+
+	for i, lookup := range pending {
+		report, err := n.finishLookup(lookup, &skips, endHeight)
+		if err != nil {
+			results[pendingIdx[i]].Error = err.Error()
+			continue
+		}
+		results[pendingIdx[i]].UTXOSpendReport = report
+	}
+
+	return results, nil
+}
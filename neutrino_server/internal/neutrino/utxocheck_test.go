@@ -0,0 +1,116 @@
+package neutrino
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+)
+
+func TestOutpointLookup(t *testing.T) {
+	store := newTestStore(t)
+	node := &Node{store: store, chainParams: &chaincfg.MainNetParams, logger: btclog.Disabled}
+
+	const (
+		address = "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+		created = "0e3e2357e806b6cdb1f70b54c3a3a17b6714ee1f0e68bebb44a74b1efd512098"
+		spent   = "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16"
+	)
+	addr, err := btcutil.DecodeAddress(address, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("failed to decode address: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("failed to create script: %v", err)
+	}
+
+	var createdHint HeightHint
+	createdHint.recordCreation(100, &wire.TxOut{Value: 5000, PkScript: pkScript})
+	createdHint.ScannedHeight = 200
+	node.putHeightHint(heightHintKey(created, 0, pkScript), createdHint)
+
+	spentHint := createdHint
+	spentHint.recordSpend("bb", 0, 150)
+	node.putHeightHint(heightHintKey(spent, 0, pkScript), spentHint)
+
+	tests := []struct {
+		name       string
+		txid       string
+		address    string
+		wantStart  int32
+		wantCached bool
+		wantErr    bool
+	}{
+		{"unknown outpoint", "ea44e97271691990157559d0bdd9959e02790c34db6c006d779e82fa5aee708e", address, 10, false, false},
+		{"known creation", created, address, 201, false, false},
+		{"known spend", spent, address, 201, true, false},
+		{"missing address", created, "", 0, false, true},
+		{"invalid address", created, "not-an-address", 0, false, true},
+		{"invalid txid", "zz", address, 0, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookup, err := node.newOutpointLookup(context.Background(), tt.txid, 0, tt.address, 10)
+			if tt.wantErr {
+				var badRequest *BadRequestError
+				if !errors.As(err, &badRequest) {
+					t.Fatalf("newOutpointLookup() error = %v, want BadRequestError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newOutpointLookup() failed: %v", err)
+			}
+
+			if lookup.startHeight != tt.wantStart {
+				t.Errorf("startHeight = %d, want %d", lookup.startHeight, tt.wantStart)
+			}
+			report := lookup.cachedReport()
+			if (report != nil) != tt.wantCached {
+				t.Fatalf("cachedReport() = %+v, want cached=%v", report, tt.wantCached)
+			}
+			if report != nil && (report.SpendingHeight != 150 || report.Confidence.Level != ConfidenceCached) {
+				t.Errorf("unexpected cached report: %+v", report)
+			}
+		})
+	}
+}
+
+func TestUTXOCheckResultJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		result UTXOCheckResult
+		want   string
+	}{
+		{
+			"report",
+			UTXOCheckResult{TxID: "aa", Vout: 1, UTXOSpendReport: &UTXOSpendReport{Unspent: true, Value: 5000, BlockHeight: 100}},
+			`{"txid":"aa","vout":1,"unspent":true,"value":5000,"block_height":100}`,
+		},
+		{
+			"error",
+			UTXOCheckResult{TxID: "aa", Vout: 1, Error: "UTXO not found"},
+			`{"txid":"aa","vout":1,"error":"UTXO not found"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.result)
+			if err != nil {
+				t.Fatalf("Marshal() failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Marshal() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
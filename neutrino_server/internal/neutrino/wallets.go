@@ -0,0 +1,496 @@
+package neutrino
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+const (
+	// DefaultWalletRetention is how long an archived wallet's data is kept
+	// before it is purged.
+	DefaultWalletRetention = 30 * 24 * time.Hour
+
+	// walletPurgeInterval is how often archived wallets are checked for
+	// expiry.
+	walletPurgeInterval = time.Hour
+)
+
+// ArchivedWallet is the persisted state of a soft-deleted wallet.
+type ArchivedWallet struct {
+	ArchivedAt int64 `json:"archived_at"`
+}
+
+// CreatedWallet is the persisted state of a wallet created by CreateWallet.
+type CreatedWallet struct {
+	CreatedAt int64 `json:"created_at"`
+}
+
+// WalletInfo describes a wallet and its watched addresses.
+type WalletInfo struct {
+	Name      string `json:"name"`
+	Addresses int    `json:"addresses"`
+	Archived  bool   `json:"archived"`
+
+	// CreatedAt is when the wallet was created, for wallets created by
+	// CreateWallet rather than by watching an address in them.
+	CreatedAt int64 `json:"created_at,omitempty"`
+
+	// ArchivedAt is when the wallet was archived, and PurgeAt when its data
+	// will be deleted. PurgeAt is omitted if archived data is kept forever.
+	ArchivedAt int64 `json:"archived_at,omitempty"`
+	PurgeAt    int64 `json:"purge_at,omitempty"`
+}
+
+// walletInfo describes wallet with the given number of addresses. Callers
+// must hold mu.
+func (r *RescanManager) walletInfo(wallet string, addresses int) WalletInfo {
+	info := WalletInfo{Name: wallet, Addresses: addresses}
+	if created, ok := r.createdWallets[wallet]; ok {
+		info.CreatedAt = created.CreatedAt
+	}
+	if archived, ok := r.archivedWallets[wallet]; ok {
+		info.Archived = true
+		info.ArchivedAt = archived.ArchivedAt
+		if r.walletRetention > 0 {
+			info.PurgeAt = archived.ArchivedAt + int64(r.walletRetention/time.Second)
+		}
+	}
+	return info
+}
+
+// walletAddresses returns the number of watched addresses in each wallet.
+// Callers must hold mu.
+func (r *RescanManager) walletAddresses() map[string]int {
+	counts := make(map[string]int)
+	for address := range r.watchedScripts {
+		for _, wallet := range r.walletsFor(address) {
+			counts[wallet]++
+		}
+	}
+	return counts
+}
+
+// Wallets lists wallets ordered by name. Archived wallets are only listed if
+// includeArchived is set.
+func (r *RescanManager) Wallets(includeArchived bool) []WalletInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counts := r.walletAddresses()
+	for wallet := range r.archivedWallets {
+		if _, ok := counts[wallet]; !ok {
+			counts[wallet] = 0
+		}
+	}
+	for wallet := range r.createdWallets {
+		if _, ok := counts[wallet]; !ok {
+			counts[wallet] = 0
+		}
+	}
+
+	wallets := make([]WalletInfo, 0, len(counts))
+	for wallet, addresses := range counts {
+		info := r.walletInfo(wallet, addresses)
+		if info.Archived && !includeArchived {
+			continue
+		}
+		wallets = append(wallets, info)
+	}
+	slices.SortFunc(wallets, func(a, b WalletInfo) int { return cmp.Compare(a.Name, b.Name) })
+	return wallets
+}
+
+// CreateWallet creates the empty wallet named wallet, so that it is listed
+// and its scoped queries answer before any address joins it. Watching an
+// address in a wallet that does not exist still creates it.
+func (r *RescanManager) CreateWallet(wallet string) (WalletInfo, error) {
+	if err := ValidateWalletName(wallet); err != nil {
+		return WalletInfo{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.walletExists(wallet) {
+		return WalletInfo{}, NewConflictError(fmt.Sprintf("wallet %s already exists", wallet))
+	}
+
+	created := CreatedWallet{CreatedAt: time.Now().Unix()}
+	if r.store != nil {
+		if err := r.store.PutCreatedWallet(wallet, created); err != nil {
+			return WalletInfo{}, fmt.Errorf("failed to create wallet %s: %w", wallet, err)
+		}
+	}
+	if r.createdWallets == nil {
+		r.createdWallets = make(map[string]CreatedWallet)
+	}
+	r.createdWallets[wallet] = created
+
+	r.logger.Infof("Created wallet %s", logging.KV("wallet", wallet))
+	return r.walletInfo(wallet, 0), nil
+}
+
+// walletExists reports whether wallet was created, contains addresses or is
+// archived. DefaultWallet always exists. Callers must hold mu.
+func (r *RescanManager) walletExists(wallet string) bool {
+	if wallet == DefaultWallet {
+		return true
+	}
+	if _, ok := r.createdWallets[wallet]; ok {
+		return true
+	}
+	if _, ok := r.archivedWallets[wallet]; ok {
+		return true
+	}
+	return r.walletAddresses()[wallet] > 0
+}
+
+// WalletAddresses returns the watched addresses of wallet ordered by
+// address, archived or not.
+func (r *RescanManager) WalletAddresses(wallet string) ([]string, error) {
+	if err := ValidateWalletName(wallet); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if !r.walletExists(wallet) {
+		return nil, NewNotFoundError("wallet", fmt.Sprintf("wallet %s not found", wallet))
+	}
+	addresses := []string{}
+	for address := range r.watchedScripts {
+		if slices.Contains(r.walletsFor(address), wallet) {
+			addresses = append(addresses, address)
+		}
+	}
+	slices.Sort(addresses)
+	return addresses, nil
+}
+
+// ArchiveWallet soft-deletes wallet. Its addresses stop being scanned unless
+// they also belong to an active wallet, and it is hidden from listings, but
+// its UTXOs, scan progress and events are kept until the retention period
+// ends or it is restored. Archiving an archived wallet changes nothing.
+func (r *RescanManager) ArchiveWallet(wallet string) (WalletInfo, error) {
+	if err := ValidateWalletName(wallet); err != nil {
+		return WalletInfo{}, err
+	}
+	if wallet == DefaultWallet {
+		return WalletInfo{}, NewBadRequestError("the default wallet cannot be deleted")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	addresses := r.walletAddresses()[wallet]
+	if _, ok := r.archivedWallets[wallet]; ok {
+		return r.walletInfo(wallet, addresses), nil
+	}
+	if !r.walletExists(wallet) {
+		return WalletInfo{}, NewNotFoundError("wallet", fmt.Sprintf("wallet %s not found", wallet))
+	}
+
+	archived := ArchivedWallet{ArchivedAt: time.Now().Unix()}
+	if r.store != nil {
+		if err := r.store.PutArchivedWallet(wallet, archived); err != nil {
+			return WalletInfo{}, fmt.Errorf("failed to archive wallet %s: %w", wallet, err)
+		}
+	}
+	if r.archivedWallets == nil {
+		r.archivedWallets = make(map[string]ArchivedWallet)
+	}
+	r.archivedWallets[wallet] = archived
+
+	r.logger.Infof("Archived wallet %s with %d addresses", logging.KV("wallet", wallet), addresses)
+	return r.walletInfo(wallet, addresses), nil
+}
+
+// RestoreWallet reverses ArchiveWallet. Rescan jobs paused by the archive
+// resume from their checkpoints when ResumeJobs next runs.
+func (r *RescanManager) RestoreWallet(wallet string) (WalletInfo, error) {
+	if err := ValidateWalletName(wallet); err != nil {
+		return WalletInfo{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.archivedWallets[wallet]; !ok {
+		return WalletInfo{}, NewNotFoundError("wallet", fmt.Sprintf("wallet %s is not archived", wallet))
+	}
+	if r.store != nil {
+		if err := r.store.DeleteArchivedWallet(wallet); err != nil {
+			return WalletInfo{}, fmt.Errorf("failed to restore wallet %s: %w", wallet, err)
+		}
+	}
+	delete(r.archivedWallets, wallet)
+
+	addresses := r.walletAddresses()[wallet]
+	r.logger.Infof("Restored wallet %s with %d addresses", logging.KV("wallet", wallet), addresses)
+	return r.walletInfo(wallet, addresses), nil
+}
+
+// PurgeWallet permanently deletes an archived wallet. Its addresses leave
+// the watch list, with their UTXOs, unless another wallet still contains
+// them, and its event stream is deleted.
+func (r *RescanManager) PurgeWallet(wallet string) error {
+	if err := ValidateWalletName(wallet); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.archivedWallets[wallet]; !ok {
+		return NewBadRequestError(fmt.Sprintf("wallet %s must be archived before it is purged", wallet))
+	}
+
+	remaining := make(map[string][]string)
+	for address := range r.watchedScripts {
+		wallets := r.walletsFor(address)
+		if slices.Contains(wallets, wallet) {
+			remaining[address] = slices.DeleteFunc(slices.Clone(wallets), func(w string) bool { return w == wallet })
+		}
+	}
+
+	if r.store != nil {
+		if err := r.store.PurgeWallet(wallet, remaining); err != nil {
+			return fmt.Errorf("failed to purge wallet %s: %w", wallet, err)
+		}
+	}
+
+	unwatched := make(map[string]bool)
+	for address, wallets := range remaining {
+		if len(wallets) > 0 {
+			r.setWallets(address, wallets)
+			continue
+		}
+		delete(r.watchedScripts, address)
+		delete(r.addrWallets, address)
+		unwatched[address] = true
+		r.dropRunningResults(address)
+	}
+	for key, utxo := range r.utxoSet {
+		if unwatched[utxo.Address] {
+			delete(r.utxoSet, key)
+		}
+	}
+	delete(r.archivedWallets, wallet)
+	delete(r.createdWallets, wallet)
+
+	r.logger.Infof("Purged wallet %s: %d addresses unwatched", logging.KV("wallet", wallet), len(unwatched))
+	return nil
+}
+
+// PurgeExpiredWallets purges wallets archived longer than the retention
+// period and returns how many were purged.
+func (r *RescanManager) PurgeExpiredWallets(now time.Time) (int, error) {
+	if r.walletRetention <= 0 {
+		return 0, nil
+	}
+
+	r.mu.RLock()
+	var expired []string
+	for wallet, archived := range r.archivedWallets {
+		if now.Sub(time.Unix(archived.ArchivedAt, 0)) >= r.walletRetention {
+			expired = append(expired, wallet)
+		}
+	}
+	r.mu.RUnlock()
+
+	for i, wallet := range expired {
+		if err := r.PurgeWallet(wallet); err != nil {
+			return i, err
+		}
+	}
+	return len(expired), nil
+}
+
+// activeAddresses returns the addresses that belong to at least one wallet
+// that is not archived.
+func (r *RescanManager) activeAddresses(addresses []string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.archivedWallets) == 0 {
+		return addresses
+	}
+
+	active := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		for _, wallet := range r.walletsFor(address) {
+			if _, archived := r.archivedWallets[wallet]; !archived {
+				active = append(active, address)
+				break
+			}
+		}
+	}
+	return active
+}
+
+// parkArchivedAddresses splits the addresses that only belong to archived
+// wallets off job into a persisted job of their own, so ResumeJobs scans them
+// from the same checkpoint once their wallet is restored. It reports whether
+// job still has addresses to scan; if not, the whole job stays persisted.
+func (r *RescanManager) parkArchivedAddresses(job *RescanJob) (bool, error) {
+	active := r.activeAddresses(job.Addresses)
+	if len(active) == len(job.Addresses) {
+		return true, nil
+	}
+
+	if len(active) == 0 {
+		if r.store != nil {
+			if err := r.store.PutRescanJob(job); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	}
+
+	parked := *job
+	parked.ID = 0
+	parked.Addresses = slices.DeleteFunc(slices.Clone(job.Addresses), func(address string) bool {
+		return slices.Contains(active, address)
+	})
+	if r.store != nil {
+		if err := r.store.PutRescanJob(&parked); err != nil {
+			return false, err
+		}
+	}
+	job.Addresses = active
+	return true, nil
+}
+
+// isArchived reports whether wallet is archived.
+func (r *RescanManager) isArchived(wallet string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.archivedWallets[wallet]
+	return ok
+}
+
+// purgeExpiredWallets periodically purges archived wallets whose retention
+// period has ended.
+func (n *Node) purgeExpiredWallets() {
+	ticker := time.NewTicker(walletPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if purged, err := n.rescanMgr.PurgeExpiredWallets(time.Now()); err != nil {
+			n.logger.Warnf("Failed to purge expired wallets: %v", err)
+		} else if purged > 0 {
+			n.logger.Infof("Purged %d archived wallets past their retention period", purged)
+		}
+		select {
+		case <-n.lifetime.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Wallets lists wallets, including archived ones if includeArchived is set.
+func (n *Node) Wallets(includeArchived bool) ([]WalletInfo, error) {
+	if n.rescanMgr == nil {
+		return nil, errors.New("rescan manager not initialized")
+	}
+	return n.rescanMgr.Wallets(includeArchived), nil
+}
+
+// ArchiveWallet soft-deletes wallet, keeping its data for the configured
+// retention period.
+func (n *Node) ArchiveWallet(wallet string) (*WalletInfo, error) {
+	if n.rescanMgr == nil {
+		return nil, errors.New("rescan manager not initialized")
+	}
+
+	info, err := n.rescanMgr.ArchiveWallet(wallet)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// PurgeWallet permanently deletes wallet, archiving it first if needed.
+func (n *Node) PurgeWallet(wallet string) error {
+	if n.rescanMgr == nil {
+		return errors.New("rescan manager not initialized")
+	}
+
+	if _, err := n.rescanMgr.ArchiveWallet(wallet); err != nil {
+		return err
+	}
+	return n.rescanMgr.PurgeWallet(wallet)
+}
+
+// CreateWallet creates an empty wallet.
+func (n *Node) CreateWallet(wallet string) (*WalletInfo, error) {
+	if n.rescanMgr == nil {
+		return nil, errors.New("rescan manager not initialized")
+	}
+
+	info, err := n.rescanMgr.CreateWallet(wallet)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// WalletAddresses returns the watched addresses of wallet.
+func (n *Node) WalletAddresses(wallet string) ([]string, error) {
+	if n.rescanMgr == nil {
+		return nil, errors.New("rescan manager not initialized")
+	}
+	return n.rescanMgr.WalletAddresses(wallet)
+}
+
+// WalletBalance sums up the UTXOs of the addresses of a wallet.
+type WalletBalance struct {
+	Wallet    string `json:"wallet"`
+	Addresses int    `json:"addresses"`
+	Balance   int64  `json:"balance"`
+	UTXOCount int    `json:"utxo_count"`
+}
+
+// WalletBalance returns the balance of wallet.
+func (n *Node) WalletBalance(wallet string) (*WalletBalance, error) {
+	addresses, err := n.WalletAddresses(wallet)
+	if err != nil {
+		return nil, err
+	}
+	utxos, err := n.rescanMgr.GetUTXOs(addresses)
+	if err != nil {
+		return nil, err
+	}
+	balance := &WalletBalance{Wallet: wallet, Addresses: len(addresses), UTXOCount: len(utxos)}
+	for _, utxo := range utxos {
+		balance.Balance += utxo.Value
+	}
+	return balance, nil
+}
+
+// RestoreWallet restores an archived wallet and resumes its paused rescan
+// jobs.
+func (n *Node) RestoreWallet(wallet string) (*WalletInfo, error) {
+	if n.rescanMgr == nil {
+		return nil, errors.New("rescan manager not initialized")
+	}
+
+	info, err := n.rescanMgr.RestoreWallet(wallet)
+	if err != nil {
+		return nil, err
+	}
+	n.rescanMgr.background(func(ctx context.Context) {
+		if err := n.rescanMgr.ResumeJobs(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			n.logger.Errorf("Failed to resume rescan jobs: %v", err)
+		}
+	})
+	return &info, nil
+}
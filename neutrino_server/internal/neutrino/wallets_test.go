@@ -0,0 +1,327 @@
+package neutrino
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btclog"
+)
+
+func TestArchiveAndRestoreWallet(t *testing.T) {
+	store := newTestStore(t)
+	mgr := &RescanManager{
+		chainParams:     &chaincfg.MainNetParams,
+		store:           store,
+		logger:          btclog.Disabled,
+		watchedScripts:  make(map[string][]byte),
+		utxoSet:         make(map[string]UTXO),
+		archivedWallets: make(map[string]ArchivedWallet),
+		walletRetention: DefaultWalletRetention,
+	}
+
+	shared := "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	coldOnly := "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S"
+	for _, watch := range []struct{ address, wallet string }{
+		{shared, "hot"},
+		{shared, "cold"},
+		{coldOnly, "cold"},
+	} {
+		if err := mgr.WatchAddressInWallet(watch.address, watch.wallet); err != nil {
+			t.Fatalf("WatchAddressInWallet(%s, %s) failed: %v", watch.address, watch.wallet, err)
+		}
+	}
+
+	var badRequestErr *BadRequestError
+	var notFoundErr *NotFoundError
+	if _, err := mgr.ArchiveWallet(DefaultWallet); !errors.As(err, &badRequestErr) {
+		t.Errorf("ArchiveWallet(default) error = %v, want BadRequestError", err)
+	}
+	if _, err := mgr.ArchiveWallet("missing"); !errors.As(err, &notFoundErr) {
+		t.Errorf("ArchiveWallet(missing) error = %v, want NotFoundError", err)
+	}
+	if err := mgr.PurgeWallet("cold"); !errors.As(err, &badRequestErr) {
+		t.Errorf("PurgeWallet() of an active wallet error = %v, want BadRequestError", err)
+	}
+
+	info, err := mgr.ArchiveWallet("cold")
+	if err != nil {
+		t.Fatalf("ArchiveWallet() failed: %v", err)
+	}
+	if !info.Archived || info.Addresses != 2 || info.PurgeAt != info.ArchivedAt+int64(DefaultWalletRetention/time.Second) {
+		t.Errorf("ArchiveWallet() = %+v", info)
+	}
+	if again, err := mgr.ArchiveWallet("cold"); err != nil || again != info {
+		t.Errorf("second ArchiveWallet() = %+v, %v; want %+v", again, err, info)
+	}
+
+	if got := mgr.Wallets(false); len(got) != 1 || got[0].Name != "hot" {
+		t.Errorf("Wallets(false) = %+v, want only hot", got)
+	}
+	if got := mgr.Wallets(true); len(got) != 2 || got[0].Name != "cold" || !got[0].Archived {
+		t.Errorf("Wallets(true) = %+v, want archived cold first", got)
+	}
+
+	// The shared address is still scanned for hot; coldOnly is not
+	if got := mgr.activeAddresses([]string{shared, coldOnly}); !slices.Equal(got, []string{shared}) {
+		t.Errorf("activeAddresses() = %v, want [%s]", got, shared)
+	}
+	if err := mgr.WatchAddressInWallet(shared, "cold"); !errors.As(err, &badRequestErr) {
+		t.Errorf("WatchAddressInWallet() into an archived wallet error = %v, want BadRequestError", err)
+	}
+
+	// The archive survives a restart
+	restarted := &RescanManager{
+		chainParams:     &chaincfg.MainNetParams,
+		store:           store,
+		logger:          btclog.Disabled,
+		watchedScripts:  make(map[string][]byte),
+		utxoSet:         make(map[string]UTXO),
+		archivedWallets: make(map[string]ArchivedWallet),
+	}
+	if err := restarted.Restore(); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+	if !restarted.isArchived("cold") {
+		t.Error("archived wallet not restored from the store")
+	}
+
+	if _, err := mgr.RestoreWallet("hot"); !errors.As(err, &notFoundErr) {
+		t.Errorf("RestoreWallet() of an active wallet error = %v, want NotFoundError", err)
+	}
+	info, err = mgr.RestoreWallet("cold")
+	if err != nil {
+		t.Fatalf("RestoreWallet() failed: %v", err)
+	}
+	if info.Archived || info.Addresses != 2 {
+		t.Errorf("RestoreWallet() = %+v", info)
+	}
+
+	archived, err := store.ArchivedWallets()
+	if err != nil {
+		t.Fatalf("ArchivedWallets() failed: %v", err)
+	}
+	if len(archived) != 0 {
+		t.Errorf("ArchivedWallets() = %v, want none after restore", archived)
+	}
+}
+
+func TestCreateWallet(t *testing.T) {
+	store := newTestStore(t)
+	newManager := func() *RescanManager {
+		return &RescanManager{
+			chainParams:     &chaincfg.MainNetParams,
+			store:           store,
+			logger:          btclog.Disabled,
+			watchedScripts:  make(map[string][]byte),
+			utxoSet:         make(map[string]UTXO),
+			archivedWallets: make(map[string]ArchivedWallet),
+			createdWallets:  make(map[string]CreatedWallet),
+		}
+	}
+	mgr := newManager()
+
+	info, err := mgr.CreateWallet("shop")
+	if err != nil {
+		t.Fatalf("CreateWallet() failed: %v", err)
+	}
+	if info.Name != "shop" || info.Addresses != 0 || info.CreatedAt == 0 {
+		t.Errorf("CreateWallet() = %+v", info)
+	}
+
+	var conflictErr *ConflictError
+	var badRequestErr *BadRequestError
+	var notFoundErr *NotFoundError
+	for _, wallet := range []string{"shop", DefaultWallet} {
+		if _, err := mgr.CreateWallet(wallet); !errors.As(err, &conflictErr) {
+			t.Errorf("CreateWallet(%s) error = %v, want ConflictError", wallet, err)
+		}
+	}
+	if _, err := mgr.CreateWallet("no spaces"); !errors.As(err, &badRequestErr) {
+		t.Errorf("CreateWallet() of an invalid name error = %v, want BadRequestError", err)
+	}
+
+	if addresses, err := mgr.WalletAddresses("shop"); err != nil || len(addresses) != 0 {
+		t.Errorf("WalletAddresses() of an empty wallet = %v, %v; want none", addresses, err)
+	}
+	if _, err := mgr.WalletAddresses("missing"); !errors.As(err, &notFoundErr) {
+		t.Errorf("WalletAddresses(missing) error = %v, want NotFoundError", err)
+	}
+
+	address := "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S"
+	if err := mgr.WatchAddressInWallet(address, "shop"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.WatchAddressInWallet("1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if addresses, err := mgr.WalletAddresses("shop"); err != nil || !slices.Equal(addresses, []string{address}) {
+		t.Errorf("WalletAddresses() = %v, %v; want [%s]", addresses, err, address)
+	}
+
+	// The created wallet survives a restart, and is purged like any other
+	restarted := newManager()
+	if err := restarted.Restore(); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+	empty, err := restarted.CreateWallet("empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallets := restarted.Wallets(false)
+	if len(wallets) != 3 || wallets[0] != empty || wallets[2].Name != "shop" || wallets[2].CreatedAt != info.CreatedAt {
+		t.Errorf("Wallets() after restart = %+v", wallets)
+	}
+	if _, err := restarted.ArchiveWallet("empty"); err != nil {
+		t.Fatalf("ArchiveWallet() of an empty wallet failed: %v", err)
+	}
+	if err := restarted.PurgeWallet("empty"); err != nil {
+		t.Fatalf("PurgeWallet() failed: %v", err)
+	}
+	if created, err := store.CreatedWallets(); err != nil || len(created) != 1 {
+		t.Errorf("CreatedWallets() after purge = %v, %v; want only shop", created, err)
+	}
+}
+
+func TestPurgeWallet(t *testing.T) {
+	store := newTestStore(t)
+	mgr := &RescanManager{
+		chainParams:     &chaincfg.MainNetParams,
+		store:           store,
+		logger:          btclog.Disabled,
+		watchedScripts:  make(map[string][]byte),
+		utxoSet:         make(map[string]UTXO),
+		archivedWallets: make(map[string]ArchivedWallet),
+		walletRetention: time.Hour,
+	}
+
+	shared := "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	coldOnly := "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S"
+	for _, watch := range []struct{ address, wallet string }{
+		{shared, "hot"},
+		{shared, "cold"},
+		{coldOnly, "cold"},
+	} {
+		if err := mgr.WatchAddressInWallet(watch.address, watch.wallet); err != nil {
+			t.Fatalf("WatchAddressInWallet(%s, %s) failed: %v", watch.address, watch.wallet, err)
+		}
+	}
+
+	job := &RescanJob{Addresses: []string{shared, coldOnly}, CheckpointHeight: -1}
+	found := map[string]UTXO{
+		"tx1:0": {TxID: "tx1", Vout: 0, Value: 1000, Address: shared, Height: 10},
+		"tx2:0": {TxID: "tx2", Vout: 0, Value: 2000, Address: coldOnly, Height: 11},
+	}
+	if err := mgr.commitScanProgress(job, 999, job.Addresses, found, map[string]Spend{}); err != nil {
+		t.Fatalf("commitScanProgress() failed: %v", err)
+	}
+
+	if events, err := store.Events("cold", 0, 100); err != nil || len(events) == 0 {
+		t.Fatalf("Events(cold) = %d events, %v; want some before the purge", len(events), err)
+	}
+
+	if _, err := mgr.ArchiveWallet("cold"); err != nil {
+		t.Fatalf("ArchiveWallet() failed: %v", err)
+	}
+
+	// Nothing has expired yet
+	if purged, err := mgr.PurgeExpiredWallets(time.Now()); err != nil || purged != 0 {
+		t.Fatalf("PurgeExpiredWallets() = %d, %v; want 0", purged, err)
+	}
+	purged, err := mgr.PurgeExpiredWallets(time.Now().Add(2 * time.Hour))
+	if err != nil || purged != 1 {
+		t.Fatalf("PurgeExpiredWallets() = %d, %v; want 1", purged, err)
+	}
+
+	if _, ok := mgr.watchedScripts[coldOnly]; ok {
+		t.Error("address only in the purged wallet is still watched")
+	}
+	if got := mgr.walletsFor(shared); !slices.Equal(got, []string{"hot"}) {
+		t.Errorf("walletsFor(shared) = %v, want [hot]", got)
+	}
+	if _, ok := mgr.utxoSet["tx2:0"]; ok {
+		t.Error("UTXO of an unwatched address was kept")
+	}
+	if _, ok := mgr.utxoSet["tx1:0"]; !ok {
+		t.Error("UTXO of a still watched address was deleted")
+	}
+	if got := mgr.Wallets(true); len(got) != 1 || got[0].Name != "hot" {
+		t.Errorf("Wallets(true) = %+v, want only hot", got)
+	}
+
+	watched, err := store.WatchedAddresses()
+	if err != nil {
+		t.Fatalf("WatchedAddresses() failed: %v", err)
+	}
+	if _, ok := watched[coldOnly]; ok {
+		t.Error("purged address still persisted")
+	}
+	if !slices.Equal(watched[shared].Wallets, []string{"hot"}) {
+		t.Errorf("persisted wallets for shared = %v, want [hot]", watched[shared].Wallets)
+	}
+
+	utxos, err := store.UTXOs()
+	if err != nil {
+		t.Fatalf("UTXOs() failed: %v", err)
+	}
+	if _, ok := utxos["tx2:0"]; ok || len(utxos) != 1 {
+		t.Errorf("persisted UTXOs = %v, want only tx1:0", utxos)
+	}
+
+	events, err := store.Events("cold", 0, 100)
+	if err != nil {
+		t.Fatalf("Events() failed: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("Events(cold) = %d events, want none", len(events))
+	}
+}
+
+func TestParkArchivedAddresses(t *testing.T) {
+	store := newTestStore(t)
+	mgr := &RescanManager{
+		chainParams:     &chaincfg.MainNetParams,
+		store:           store,
+		logger:          btclog.Disabled,
+		watchedScripts:  make(map[string][]byte),
+		utxoSet:         make(map[string]UTXO),
+		archivedWallets: make(map[string]ArchivedWallet),
+	}
+
+	hotOnly := "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	coldOnly := "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S"
+	if err := mgr.WatchAddressInWallet(hotOnly, "hot"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.WatchAddressInWallet(coldOnly, "cold"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mgr.ArchiveWallet("cold"); err != nil {
+		t.Fatalf("ArchiveWallet() failed: %v", err)
+	}
+
+	job := &RescanJob{ID: 7, Addresses: []string{hotOnly, coldOnly}, StartHeight: 100, CheckpointHeight: 500}
+	ok, err := mgr.parkArchivedAddresses(job)
+	if err != nil || !ok {
+		t.Fatalf("parkArchivedAddresses() = %v, %v; want true", ok, err)
+	}
+	if !slices.Equal(job.Addresses, []string{hotOnly}) {
+		t.Errorf("job addresses = %v, want [%s]", job.Addresses, hotOnly)
+	}
+
+	jobs, err := store.RescanJobs()
+	if err != nil {
+		t.Fatalf("RescanJobs() failed: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID == 7 || !slices.Equal(jobs[0].Addresses, []string{coldOnly}) || jobs[0].CheckpointHeight != 500 {
+		t.Errorf("parked jobs = %+v, want one job for %s from checkpoint 500", jobs, coldOnly)
+	}
+
+	// A job with only archived addresses is kept whole
+	coldJob := &RescanJob{Addresses: []string{coldOnly}, CheckpointHeight: -1}
+	if ok, err := mgr.parkArchivedAddresses(coldJob); err != nil || ok {
+		t.Errorf("parkArchivedAddresses() = %v, %v; want false", ok, err)
+	}
+}
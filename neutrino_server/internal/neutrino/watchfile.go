@@ -0,0 +1,280 @@
+package neutrino
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// WatchFileEntry is one address in a watch file. Birthday is the height the
+// address was first used; scanning starts there instead of at genesis.
+type WatchFileEntry struct {
+	Address    string `json:"address"`
+	Descriptor string `json:"descriptor,omitempty"`
+	Birthday   int32  `json:"birthday,omitempty"`
+	Wallet     string `json:"wallet,omitempty"`
+
+	// Range selects the indexes of a ranged descriptor, as that of a
+	// DescriptorRange does.
+	Range []uint32 `json:"range,omitempty"`
+}
+
+// LoadWatchFile reads the watch list at path. A file starting with '[' is a
+// JSON array of entries; anything else is CSV with one address or output
+// descriptor per line, followed by an optional birthday and wallet. A
+// descriptor other than addr() stands for every address it derives, each an
+// entry of its own. Entries are validated against params, and an address
+// listed more than once for the same wallet keeps its lowest birthday.
+func LoadWatchFile(path string, params *chaincfg.Params) ([]WatchFileEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watch file: %w", err)
+	}
+
+	var entries []WatchFileEntry
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse watch file %s: %w", path, err)
+		}
+	} else {
+		entries, err = parseWatchCSV(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse watch file %s: %w", path, err)
+		}
+	}
+
+	var result []WatchFileEntry
+	seen := make(map[[2]string]int)
+	for i, listed := range entries {
+		expanded, err := listed.expand(params)
+		if err != nil {
+			return nil, fmt.Errorf("watch file %s entry %d: %w", path, i+1, err)
+		}
+		for _, entry := range expanded {
+			if err := entry.resolve(params); err != nil {
+				return nil, fmt.Errorf("watch file %s entry %d: %w", path, i+1, err)
+			}
+
+			key := [2]string{entry.Address, entry.Wallet}
+			if j, ok := seen[key]; ok {
+				result[j].Birthday = min(result[j].Birthday, entry.Birthday)
+				continue
+			}
+			seen[key] = len(result)
+			result = append(result, entry)
+		}
+	}
+	return result, nil
+}
+
+// parseWatchCSV parses CSV watch file records. Lines starting with '#' and a
+// header line beginning with "address" or "descriptor" are ignored.
+func parseWatchCSV(r io.Reader) ([]WatchFileEntry, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var entries []WatchFileEntry
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		target := strings.TrimSpace(record[0])
+		if first && (strings.EqualFold(target, "address") || strings.EqualFold(target, "descriptor")) {
+			continue
+		}
+		if len(record) > 3 {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("line %d: expected at most 3 fields, got %d", line, len(record))
+		}
+
+		var entry WatchFileEntry
+		if strings.Contains(target, "(") {
+			entry.Descriptor = target
+		} else {
+			entry.Address = target
+		}
+		if len(record) > 1 && strings.TrimSpace(record[1]) != "" {
+			birthday, err := strconv.ParseInt(strings.TrimSpace(record[1]), 10, 32)
+			if err != nil {
+				line, _ := reader.FieldPos(1)
+				return nil, fmt.Errorf("line %d: invalid birthday %q", line, record[1])
+			}
+			entry.Birthday = int32(birthday)
+		}
+		if len(record) > 2 {
+			entry.Wallet = strings.TrimSpace(record[2])
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// expand returns an entry for every address the descriptor of e derives for
+// params, or e itself if it lists an address or an addr() descriptor.
+func (e WatchFileEntry) expand(params *chaincfg.Params) ([]WatchFileEntry, error) {
+	if e.Descriptor == "" || isAddrDescriptor(e.Descriptor) {
+		return []WatchFileEntry{e}, nil
+	}
+	if e.Address != "" {
+		return nil, fmt.Errorf("address %s can only be given with an addr() descriptor", e.Address)
+	}
+
+	addresses, err := descriptorAddresses([]DescriptorRange{{Descriptor: e.Descriptor, Range: e.Range}}, params)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]WatchFileEntry, 0, len(addresses))
+	for _, address := range addresses {
+		entry := e
+		entry.Address = address
+		entry.Range = nil
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// resolve validates the entry and sets Address to its canonical encoding,
+// taking it from an addr() Descriptor if needed.
+func (e *WatchFileEntry) resolve(params *chaincfg.Params) error {
+	if len(e.Range) > 0 {
+		return errors.New("range is only valid for ranged descriptors")
+	}
+	if e.Descriptor != "" && isAddrDescriptor(e.Descriptor) {
+		address, err := descriptorAddress(e.Descriptor)
+		if err != nil {
+			return err
+		}
+		if e.Address != "" && e.Address != address {
+			return fmt.Errorf("address %s does not match descriptor %s", e.Address, e.Descriptor)
+		}
+		e.Address = address
+	}
+	if e.Address == "" {
+		return errors.New("address or descriptor is required")
+	}
+
+	addr, err := btcutil.DecodeAddress(e.Address, params)
+	if err != nil {
+		return fmt.Errorf("invalid address %s: %w", e.Address, err)
+	}
+	if !addr.IsForNet(params) {
+		return fmt.Errorf("address %s is not for %s", e.Address, params.Name)
+	}
+	e.Address = addr.EncodeAddress()
+
+	if e.Birthday < 0 {
+		return fmt.Errorf("invalid birthday %d", e.Birthday)
+	}
+	if e.Wallet != "" {
+		if err := ValidateWalletName(e.Wallet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isAddrDescriptor reports whether descriptor is an addr() descriptor.
+func isAddrDescriptor(descriptor string) bool {
+	return strings.HasPrefix(strings.TrimSpace(descriptor), "addr(")
+}
+
+// descriptorAddress returns the address of an addr() descriptor, ignoring
+// any checksum.
+func descriptorAddress(descriptor string) (string, error) {
+	desc, _, _ := strings.Cut(strings.TrimSpace(descriptor), "#")
+	address, ok := strings.CutPrefix(desc, "addr(")
+	if !ok || !strings.HasSuffix(address, ")") {
+		return "", fmt.Errorf("invalid addr() descriptor %q", descriptor)
+	}
+	return strings.TrimSuffix(address, ")"), nil
+}
+
+// ImportWatchList watches the given entries and schedules a rescan job from
+// each distinct birthday for the addresses that were not already watched.
+// Jobs are persisted and picked up by ResumeJobs, so they run once the node
+// is current and survive restarts. Already watched addresses keep their scan
+// progress and only gain the entry's wallet. It returns the number of newly
+// watched addresses.
+func (r *RescanManager) ImportWatchList(entries []WatchFileEntry) (int, error) {
+	// Addresses watched before the import keep their progress; new ones
+	// listed for several wallets are scanned once from the lowest birthday
+	birthdays := make(map[string]int32)
+	for _, entry := range entries {
+		r.mu.RLock()
+		_, exists := r.watchedScripts[entry.Address]
+		r.mu.RUnlock()
+
+		if birthday, ok := birthdays[entry.Address]; ok {
+			birthdays[entry.Address] = min(birthday, entry.Birthday)
+		} else if !exists {
+			birthdays[entry.Address] = entry.Birthday
+		}
+
+		if err := r.WatchAddressInWallet(entry.Address, entry.Wallet); err != nil {
+			return 0, err
+		}
+	}
+
+	byBirthday := make(map[int32][]string)
+	for _, entry := range entries {
+		birthday, ok := birthdays[entry.Address]
+		if ok && !slices.Contains(byBirthday[birthday], entry.Address) {
+			byBirthday[birthday] = append(byBirthday[birthday], entry.Address)
+		}
+	}
+
+	if r.store != nil {
+		heights := make([]int32, 0, len(byBirthday))
+		for birthday := range byBirthday {
+			heights = append(heights, birthday)
+		}
+		slices.Sort(heights)
+
+		for _, birthday := range heights {
+			job := &RescanJob{
+				Addresses:        byBirthday[birthday],
+				StartHeight:      birthday,
+				EndHeight:        birthday,
+				CheckpointHeight: birthday - 1,
+				CreatedAt:        time.Now().Unix(),
+			}
+			if err := r.store.PutRescanJob(job); err != nil {
+				return 0, fmt.Errorf("failed to schedule rescan from height %d: %w", birthday, err)
+			}
+		}
+	}
+
+	return len(birthdays), nil
+}
+
+// importWatchFile loads the configured watch file into the rescan manager.
+func (n *Node) importWatchFile() error {
+	entries, err := LoadWatchFile(n.config.WatchFile, n.chainParams)
+	if err != nil {
+		return err
+	}
+
+	imported, err := n.rescanMgr.ImportWatchList(entries)
+	if err != nil {
+		return fmt.Errorf("failed to import watch file: %w", err)
+	}
+	n.logger.Infof("Imported watch file %s: %d entries, %d newly watched addresses", n.config.WatchFile, len(entries), imported)
+	return nil
+}
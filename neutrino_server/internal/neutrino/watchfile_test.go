@@ -0,0 +1,169 @@
+package neutrino
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btclog"
+)
+
+func TestLoadWatchFile(t *testing.T) {
+	const (
+		addr1 = "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+		addr2 = "bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq"
+	)
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []WatchFileEntry
+		wantErr bool
+	}{
+		{
+			"json",
+			"watch.json",
+			`[{"address": "` + addr1 + `", "birthday": 100}, {"descriptor": "addr(` + addr2 + `)#8rzcx2f5", "wallet": "cold"}]`,
+			[]WatchFileEntry{{Address: addr1, Birthday: 100}, {Address: addr2, Descriptor: "addr(" + addr2 + ")#8rzcx2f5", Wallet: "cold"}},
+			false,
+		},
+		{
+			"csv with header and comments",
+			"watch.csv",
+			"address,birthday,wallet\n# treasury\n" + addr1 + ",100\naddr(" + addr2 + "),,cold\n",
+			[]WatchFileEntry{{Address: addr1, Birthday: 100}, {Address: addr2, Descriptor: "addr(" + addr2 + ")", Wallet: "cold"}},
+			false,
+		},
+		{
+			"duplicates keep lowest birthday per wallet",
+			"watch.csv",
+			addr1 + ",500\n" + addr1 + ",200\n" + addr1 + ",300,hot\n",
+			[]WatchFileEntry{{Address: addr1, Birthday: 200}, {Address: addr1, Birthday: 300, Wallet: "hot"}},
+			false,
+		},
+		{"empty", "watch.csv", "", nil, false},
+		{"invalid address", "watch.csv", "notanaddress,1\n", nil, true},
+		{"wrong network", "watch.csv", "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx\n", nil, true},
+		{
+			"wpkh descriptor",
+			"watch.csv",
+			"wpkh(02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9),100,hot\n",
+			[]WatchFileEntry{{Address: "bc1q0ht9tyks4vh7p5p904t340cr9nvahy7u3re7zg", Descriptor: "wpkh(02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9)", Birthday: 100, Wallet: "hot"}},
+			false,
+		},
+		{
+			"ranged descriptor",
+			"watch.json",
+			`[{"descriptor": "` + bip84Zpub + `", "range": [0, 1], "birthday": 800000}]`,
+			[]WatchFileEntry{
+				{Address: "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", Descriptor: bip84Zpub, Birthday: 800000},
+				{Address: "bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g", Descriptor: bip84Zpub, Birthday: 800000},
+				{Address: "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el", Descriptor: bip84Zpub, Birthday: 800000},
+				{Address: "bc1qggnasd834t54yulsep6fta8lpjekv4zj6gv5rf", Descriptor: bip84Zpub, Birthday: 800000},
+			},
+			false,
+		},
+		{"unsupported descriptor", "watch.csv", "raw(0014751e76e8199196d454941c45d1b3a323f1433bd6)\n", nil, true},
+		{"address with a derived descriptor", "watch.json", `[{"address": "` + addr2 + `", "descriptor": "wpkh(02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9)"}]`, nil, true},
+		{"range of an address", "watch.json", `[{"address": "` + addr1 + `", "range": [0, 1]}]`, nil, true},
+		{"invalid birthday", "watch.csv", addr1 + ",soon\n", nil, true},
+		{"invalid wallet", "watch.csv", addr1 + ",1,bad wallet!\n", nil, true},
+		{"too many fields", "watch.csv", addr1 + ",1,hot,extra\n", nil, true},
+		{"malformed json", "watch.json", `[{"address": `, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := LoadWatchFile(path, &chaincfg.MainNetParams)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadWatchFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadWatchFile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadWatchFile(filepath.Join(t.TempDir(), "missing.json"), &chaincfg.MainNetParams); err == nil {
+		t.Error("expected error for missing watch file")
+	}
+}
+
+func TestImportWatchList(t *testing.T) {
+	store := newTestStore(t)
+	mgr := &RescanManager{
+		chainParams:    &chaincfg.MainNetParams,
+		store:          store,
+		logger:         btclog.Disabled,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
+		addrWallets:    make(map[string][]string),
+	}
+
+	const (
+		existing = "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+		newAddr1 = "bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq"
+		newAddr2 = "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"
+		newAddr3 = "1Q2TWHE3GMdB6BZKafqwxXtWAWgFt5Jvm3"
+	)
+	if err := mgr.WatchAddress(existing); err != nil {
+		t.Fatalf("WatchAddress() failed: %v", err)
+	}
+	if err := store.SetScannedHeight([]string{existing}, 800000); err != nil {
+		t.Fatalf("SetScannedHeight() failed: %v", err)
+	}
+
+	imported, err := mgr.ImportWatchList([]WatchFileEntry{
+		{Address: existing, Birthday: 1, Wallet: "cold"},
+		{Address: newAddr1, Birthday: 700000},
+		{Address: newAddr2, Birthday: 600000},
+		{Address: newAddr1, Birthday: 650000, Wallet: "cold"},
+		{Address: newAddr3, Birthday: 600000},
+	})
+	if err != nil {
+		t.Fatalf("ImportWatchList() failed: %v", err)
+	}
+	if imported != 3 {
+		t.Errorf("ImportWatchList() imported %d addresses, want 3", imported)
+	}
+
+	jobs, err := store.RescanJobs()
+	if err != nil {
+		t.Fatalf("RescanJobs() failed: %v", err)
+	}
+	var got []RescanJob
+	for _, job := range jobs {
+		got = append(got, RescanJob{Addresses: job.Addresses, StartHeight: job.StartHeight, CheckpointHeight: job.CheckpointHeight})
+	}
+	want := []RescanJob{
+		{Addresses: []string{newAddr2, newAddr3}, StartHeight: 600000, CheckpointHeight: 599999},
+		{Addresses: []string{newAddr1}, StartHeight: 650000, CheckpointHeight: 649999},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("scheduled jobs = %+v, want %+v", got, want)
+	}
+
+	records, err := store.WatchedAddresses()
+	if err != nil {
+		t.Fatalf("WatchedAddresses() failed: %v", err)
+	}
+	if record := records[existing]; record.ScannedHeight != 800000 || !reflect.DeepEqual(record.Wallets, []string{DefaultWallet, "cold"}) {
+		t.Errorf("existing address record = %+v, want scan progress kept and cold wallet added", record)
+	}
+	if record := records[newAddr1]; !reflect.DeepEqual(record.Wallets, []string{DefaultWallet, "cold"}) {
+		t.Errorf("new address wallets = %v, want both wallets", record.Wallets)
+	}
+
+	// Importing the same list again schedules nothing
+	if imported, err := mgr.ImportWatchList([]WatchFileEntry{{Address: newAddr1, Birthday: 1}}); err != nil || imported != 0 {
+		t.Errorf("second ImportWatchList() = %d, %v; want 0, nil", imported, err)
+	}
+}
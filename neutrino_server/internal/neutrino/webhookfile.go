@@ -0,0 +1,137 @@
+package neutrino
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// minWebhookSecretLength is the shortest secret accepted for configured
+// webhooks, whose secrets are chosen by the operator.
+const minWebhookSecretLength = 16
+
+// WebhookFileEntry is one webhook in a webhooks file. Its deliveries are
+// signed with Secret, which the receiver checks them with.
+type WebhookFileEntry struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Wallet string   `json:"wallet,omitempty"`
+	Secret string   `json:"secret"`
+}
+
+// LoadWebhookFile reads the webhooks file at path, a JSON array of
+// entries, returning the webhooks it configures. A URL may only be listed
+// once per wallet.
+func LoadWebhookFile(path string) ([]Webhook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhooks file: %w", err)
+	}
+
+	var entries []WebhookFileEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse webhooks file %s: %w", path, err)
+	}
+
+	hooks := make([]Webhook, 0, len(entries))
+	for i, entry := range entries {
+		hook, err := newWebhook(entry.URL, entry.Events, entry.Wallet)
+		if err != nil {
+			return nil, fmt.Errorf("webhooks file %s entry %d: %w", path, i+1, err)
+		}
+		if len(entry.Secret) < minWebhookSecretLength {
+			return nil, fmt.Errorf("webhooks file %s entry %d: the secret must be at least %d characters", path, i+1, minWebhookSecretLength)
+		}
+		if slices.ContainsFunc(hooks, func(h Webhook) bool { return h.URL == hook.URL && h.Wallet == hook.Wallet }) {
+			return nil, fmt.Errorf("webhooks file %s entry %d: %s is already listed", path, i+1, redactURL(hook.URL))
+		}
+		hook.Secret = entry.Secret
+		hook.Configured = true
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// SetConfigured replaces the configured webhooks with hooks. Webhooks kept
+// with the same URL and wallet keep their ID, which deliveries carry, and
+// registrations made through the API are left alone. The changes are
+// persisted in one transaction before any is applied, so a failure leaves
+// the previous webhooks in place.
+func (d *WebhookDispatcher) SetConfigured(hooks []Webhook) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	existing := make(map[[2]string]Webhook)
+	registered := 0
+	for _, hook := range d.hooks {
+		if hook.Configured {
+			existing[[2]string{hook.URL, hook.Wallet}] = hook
+		} else {
+			registered++
+		}
+	}
+	if registered+len(hooks) > maxWebhooks {
+		return fmt.Errorf("too many webhooks: %d configured and %d registered (max %d)", len(hooks), registered, maxWebhooks)
+	}
+
+	var changed []*Webhook
+	var added, updated int
+	for _, hook := range hooks {
+		key := [2]string{hook.URL, hook.Wallet}
+		if old, ok := existing[key]; ok {
+			delete(existing, key)
+			if slices.Equal(old.Events, hook.Events) && old.Secret == hook.Secret {
+				continue
+			}
+			hook.ID, hook.CreatedAt = old.ID, old.CreatedAt
+			updated++
+		} else {
+			added++
+		}
+		changed = append(changed, &hook)
+	}
+	removed := make([]uint64, 0, len(existing))
+	for _, hook := range existing {
+		removed = append(removed, hook.ID)
+	}
+
+	if d.store != nil {
+		if err := d.store.ReplaceWebhooks(changed, removed); err != nil {
+			return fmt.Errorf("failed to persist webhooks: %w", err)
+		}
+	}
+	for _, hook := range changed {
+		if hook.ID == 0 {
+			d.nextID++
+			hook.ID = d.nextID
+		}
+		d.hooks[hook.ID] = *hook
+	}
+	for _, id := range removed {
+		delete(d.hooks, id)
+	}
+
+	if added+updated+len(existing) > 0 {
+		d.logger.Infof("Configured webhooks: %d added, %d updated, %d removed", added, updated, len(existing))
+	}
+	return nil
+}
+
+// ReloadWebhooks replaces the configured webhooks with those of the
+// webhooks file at path. An empty path removes every configured webhook.
+func (n *Node) ReloadWebhooks(path string) error {
+	if n.webhooks == nil {
+		return errors.New("webhooks not initialized")
+	}
+
+	var hooks []Webhook
+	if path != "" {
+		var err error
+		if hooks, err = LoadWebhookFile(path); err != nil {
+			return err
+		}
+	}
+	return n.webhooks.SetConfigured(hooks)
+}
@@ -0,0 +1,171 @@
+package neutrino
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+)
+
+func writeWebhookFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadWebhookFile(t *testing.T) {
+	const secret = "0123456789abcdef"
+
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		wantErr bool
+	}{
+		{"empty", `[]`, 0, false},
+		{"webhooks", `[
+			{"url": "https://example.com/a", "events": ["new_block"], "secret": "` + secret + `"},
+			{"url": "https://example.com/a", "events": ["rescan_finished"], "wallet": "shop", "secret": "` + secret + `"}
+		]`, 2, false},
+		{"not JSON", `url=https://example.com/a`, 0, true},
+		{"invalid URL", `[{"url": "/hook", "events": ["new_block"], "secret": "` + secret + `"}]`, 0, true},
+		{"unknown event", `[{"url": "https://example.com/a", "events": ["mempool_tx"], "secret": "` + secret + `"}]`, 0, true},
+		{"short secret", `[{"url": "https://example.com/a", "events": ["new_block"], "secret": "short"}]`, 0, true},
+		{"listed twice", `[
+			{"url": "https://example.com/a", "events": ["new_block"], "secret": "` + secret + `"},
+			{"url": "https://example.com/a", "events": ["outpoint_spent"], "secret": "` + secret + `"}
+		]`, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hooks, err := LoadWebhookFile(writeWebhookFile(t, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadWebhookFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(hooks) != tt.want {
+				t.Fatalf("LoadWebhookFile() = %d webhooks, want %d", len(hooks), tt.want)
+			}
+			for _, hook := range hooks {
+				if !hook.Configured || hook.Secret != secret {
+					t.Errorf("webhook %+v should be configured with the file's secret", hook)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookSetConfigured(t *testing.T) {
+	store := newTestStore(t)
+	d := NewWebhookDispatcher(store, btclog.Disabled)
+
+	registered, err := d.Register("https://example.com/api", []string{WebhookNewBlock}, "")
+	if err != nil {
+		t.Fatalf("Register() failed: %v", err)
+	}
+
+	load := func(content string) []Webhook {
+		t.Helper()
+		hooks, err := LoadWebhookFile(writeWebhookFile(t, content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hooks
+	}
+	configured := func() map[string]Webhook {
+		byURL := make(map[string]Webhook)
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+		for _, hook := range d.hooks {
+			if hook.Configured {
+				byURL[hook.URL] = hook
+			}
+		}
+		return byURL
+	}
+
+	if err := d.SetConfigured(load(`[
+		{"url": "https://example.com/a", "events": ["new_block"], "secret": "aaaaaaaaaaaaaaaa"},
+		{"url": "https://example.com/b", "events": ["new_block"], "secret": "bbbbbbbbbbbbbbbb"}
+	]`)); err != nil {
+		t.Fatalf("SetConfigured() failed: %v", err)
+	}
+	before := configured()
+	if len(before) != 2 {
+		t.Fatalf("configured webhooks = %+v, want 2", before)
+	}
+
+	// a is updated, b removed and c added
+	if err := d.SetConfigured(load(`[
+		{"url": "https://example.com/a", "events": ["new_block", "rescan_finished"], "secret": "aaaaaaaaaaaaaaaa"},
+		{"url": "https://example.com/c", "events": ["new_block"], "secret": "cccccccccccccccc"}
+	]`)); err != nil {
+		t.Fatalf("SetConfigured() failed: %v", err)
+	}
+	after := configured()
+	if len(after) != 2 || after["https://example.com/a"].ID != before["https://example.com/a"].ID {
+		t.Errorf("configured webhooks = %+v, want a kept with ID %d and c added", after, before["https://example.com/a"].ID)
+	}
+	if len(after["https://example.com/a"].Events) != 2 {
+		t.Errorf("webhook a has events %v, want them updated", after["https://example.com/a"].Events)
+	}
+	if _, ok := after["https://example.com/b"]; ok {
+		t.Error("webhook b should be removed")
+	}
+
+	// Configured webhooks are managed through the file only
+	var badRequestErr *BadRequestError
+	if err := d.Remove(after["https://example.com/c"].ID); !errors.As(err, &badRequestErr) {
+		t.Errorf("Remove() of a configured webhook error = %v, want BadRequestError", err)
+	}
+
+	// They persist alongside registered ones, which reloads leave alone
+	if err := d.SetConfigured(nil); err != nil {
+		t.Fatalf("SetConfigured() failed: %v", err)
+	}
+	restored := NewWebhookDispatcher(store, btclog.Disabled)
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+	if hooks := restored.Webhooks(); len(hooks) != 1 || hooks[0].ID != registered.ID {
+		t.Errorf("Webhooks() after restore = %+v, want only webhook %d", hooks, registered.ID)
+	}
+}
+
+func TestWebhookSetConfiguredFailure(t *testing.T) {
+	store := newTestStore(t)
+	d := NewWebhookDispatcher(store, btclog.Disabled)
+	hooks, err := LoadWebhookFile(writeWebhookFile(t, `[{"url": "https://example.com/a", "events": ["new_block"], "secret": "aaaaaaaaaaaaaaaa"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetConfigured(hooks); err != nil {
+		t.Fatalf("SetConfigured() failed: %v", err)
+	}
+	before := d.Webhooks()
+
+	// A store failure applies none of the changes
+	replacement, err := LoadWebhookFile(writeWebhookFile(t, `[
+		{"url": "https://example.com/b", "events": ["new_block"], "secret": "bbbbbbbbbbbbbbbb"},
+		{"url": "https://example.com/c", "events": ["new_block"], "secret": "cccccccccccccccc"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.db.Close()
+	if err := d.SetConfigured(replacement); err == nil {
+		t.Fatal("SetConfigured() succeeded with a closed store")
+	}
+	if after := d.Webhooks(); len(after) != 1 || after[0].ID != before[0].ID || after[0].URL != before[0].URL {
+		t.Errorf("Webhooks() after a failed SetConfigured() = %+v, want %+v", after, before)
+	}
+}
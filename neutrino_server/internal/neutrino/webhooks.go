@@ -0,0 +1,502 @@
+package neutrino
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btclog"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/logging"
+)
+
+// Webhook event types a registration can subscribe to.
+const (
+	// WebhookNewBlock is delivered for every block connected once the node is
+	// synced. Data is a NewBlock.
+	WebhookNewBlock = "new_block"
+
+	// WebhookAddressActivity is delivered for every utxo_received and
+	// utxo_spent wallet event. Data is the Event.
+	WebhookAddressActivity = "address_activity"
+
+	// WebhookOutpointSpent is delivered when a known UTXO of a watched
+	// address is spent. Data is the utxo_spent Event.
+	WebhookOutpointSpent = "outpoint_spent"
+
+	// WebhookRescanFinished is delivered when a rescan job ends. Data is the
+	// rescan_finished Event.
+	WebhookRescanFinished = "rescan_finished"
+
+	// WebhookTxStatus is delivered when a transaction tracked for
+	// confirmations changes status. Data is the TrackedTx.
+	WebhookTxStatus = "tx_status"
+
+	// WebhookSpend is delivered when an outpoint with a spend subscription
+	// is spent. Data is the SpendSubscription.
+	WebhookSpend = "spend"
+
+	// WebhookReorg is delivered once per reorg of blocks seen by the node.
+	// Data is the Reorg.
+	WebhookReorg = "reorg"
+
+	// WebhookDoubleSpend is delivered when a block spends an input of a
+	// transaction broadcast by the node with another transaction. Data is
+	// the DoubleSpend.
+	WebhookDoubleSpend = "double_spend"
+
+	// WebhookSyncStalled is delivered when sync stalls, and again after
+	// every further stall timeout it stays stalled. Data is the SyncStall.
+	WebhookSyncStalled = "sync_stalled"
+)
+
+// webhookEventTypes lists every type a webhook can subscribe to.
+var webhookEventTypes = []string{WebhookNewBlock, WebhookAddressActivity, WebhookOutpointSpent, WebhookRescanFinished, WebhookTxStatus, WebhookSpend, WebhookReorg, WebhookDoubleSpend, WebhookSyncStalled}
+
+const (
+	// WebhookSignatureHeader carries "sha256=" followed by the hex HMAC-SHA256
+	// of the request body, keyed by the webhook's secret.
+	WebhookSignatureHeader = "X-Neutrino-Signature"
+
+	// maxWebhooks bounds the number of registrations.
+	maxWebhooks = 100
+
+	// maxWebhookDeliveries bounds the deliveries being attempted or waiting
+	// for a retry at once. Deliveries beyond it are dropped.
+	maxWebhookDeliveries = 1000
+
+	// webhookMaxAttempts is how many times a delivery is attempted before it
+	// is dropped.
+	webhookMaxAttempts = 8
+
+	// webhookBaseBackoff is the delay before the first retry. It doubles
+	// with every attempt up to webhookMaxBackoff.
+	webhookBaseBackoff = 2 * time.Second
+	webhookMaxBackoff  = 5 * time.Minute
+
+	// webhookTimeout bounds a single delivery attempt.
+	webhookTimeout = 10 * time.Second
+
+	// maxNewBlockNotifications bounds the new_block deliveries of one sync
+	// check.
+	maxNewBlockNotifications = 10
+)
+
+// Webhook is a registered webhook. The secret is only returned when the
+// webhook is registered.
+type Webhook struct {
+	ID     uint64   `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+
+	// Wallet restricts wallet events to one wallet. It does not apply to
+	// new_block.
+	Wallet string `json:"wallet,omitempty"`
+
+	Secret    string `json:"secret,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+
+	// Configured webhooks come from the webhooks file, see
+	// LoadWebhookFile, and can only be changed there.
+	Configured bool `json:"configured,omitempty"`
+}
+
+// WebhookPayload is the JSON body of a webhook delivery. ID is the same for
+// every attempt of a delivery, so receivers can deduplicate retries.
+type WebhookPayload struct {
+	ID        string          `json:"id"`
+	WebhookID uint64          `json:"webhook_id"`
+	Type      string          `json:"type"`
+	Time      int64           `json:"time"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// NewBlock is the payload of a new_block delivery.
+type NewBlock struct {
+	Height int32  `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+// WebhookDispatcher delivers events to registered webhooks, retrying failed
+// deliveries with exponential backoff.
+type WebhookDispatcher struct {
+	store  *Store
+	client *http.Client
+	logger btclog.Logger
+
+	mu    sync.RWMutex
+	hooks map[uint64]Webhook
+
+	// nextID numbers registrations when there is no store to assign IDs.
+	nextID uint64
+
+	// pending limits the deliveries in flight to maxWebhookDeliveries.
+	pending chan struct{}
+
+	// ctx is canceled by Stop, abandoning the deliveries in flight, which
+	// deliveries tracks.
+	ctx        context.Context
+	cancel     context.CancelFunc
+	deliveries sync.WaitGroup
+
+	// maxAttempts and baseBackoff are webhookMaxAttempts and
+	// webhookBaseBackoff, and are only changed by tests.
+	maxAttempts int
+	baseBackoff time.Duration
+}
+
+// NewWebhookDispatcher creates a dispatcher. If store is non-nil,
+// registrations are persisted to it.
+func NewWebhookDispatcher(store *Store, logger btclog.Logger) *WebhookDispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &WebhookDispatcher{
+		ctx:         ctx,
+		cancel:      cancel,
+		store:       store,
+		client:      &http.Client{Timeout: webhookTimeout},
+		logger:      logger,
+		hooks:       make(map[uint64]Webhook),
+		pending:     make(chan struct{}, maxWebhookDeliveries),
+		maxAttempts: webhookMaxAttempts,
+		baseBackoff: webhookBaseBackoff,
+	}
+}
+
+// Restore loads webhook registrations from the store.
+func (d *WebhookDispatcher) Restore() error {
+	if d.store == nil {
+		return nil
+	}
+
+	hooks, err := d.store.Webhooks()
+	if err != nil {
+		return fmt.Errorf("failed to load webhooks: %w", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, hook := range hooks {
+		d.hooks[hook.ID] = hook
+	}
+	return nil
+}
+
+// Register validates and adds a webhook, returning it with its ID and the
+// secret its deliveries are signed with.
+func (d *WebhookDispatcher) Register(rawURL string, events []string, wallet string) (Webhook, error) {
+	hook, err := newWebhook(rawURL, events, wallet)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Webhook{}, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	hook.Secret = hex.EncodeToString(secret)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.hooks) >= maxWebhooks {
+		return Webhook{}, NewBadRequestError(fmt.Sprintf("too many webhooks (max %d)", maxWebhooks))
+	}
+	if d.store != nil {
+		if err := d.store.PutWebhook(&hook); err != nil {
+			return Webhook{}, fmt.Errorf("failed to persist webhook: %w", err)
+		}
+	} else {
+		d.nextID++
+		hook.ID = d.nextID
+	}
+	d.hooks[hook.ID] = hook
+
+	d.logger.Infof("Registered webhook %d for %v to %s", hook.ID, hook.Events, redactURL(hook.URL))
+	return hook, nil
+}
+
+// newWebhook validates a webhook to url for events, restricted to wallet,
+// returning it without an ID or secret.
+func newWebhook(rawURL string, events []string, wallet string) (Webhook, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return Webhook{}, NewBadRequestError(fmt.Sprintf("invalid webhook url %q: use an absolute http or https URL", rawURL))
+	}
+
+	if len(events) == 0 {
+		return Webhook{}, NewBadRequestError("at least one event type is required")
+	}
+	var types []string
+	for _, eventType := range events {
+		if !slices.Contains(webhookEventTypes, eventType) {
+			return Webhook{}, NewBadRequestError(fmt.Sprintf("unknown event type %q: use one of %v", eventType, webhookEventTypes))
+		}
+		if !slices.Contains(types, eventType) {
+			types = append(types, eventType)
+		}
+	}
+
+	if wallet != "" {
+		if err := ValidateWalletName(wallet); err != nil {
+			return Webhook{}, err
+		}
+	}
+
+	return Webhook{
+		URL:       parsed.String(),
+		Events:    types,
+		Wallet:    wallet,
+		CreatedAt: time.Now().Unix(),
+	}, nil
+}
+
+// redactURL returns rawURL with any password masked, for logging.
+func redactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return parsed.Redacted()
+}
+
+// Webhooks returns the registered webhooks ordered by ID, without secrets.
+func (d *WebhookDispatcher) Webhooks() []Webhook {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	hooks := make([]Webhook, 0, len(d.hooks))
+	for _, hook := range d.hooks {
+		hook.Secret = ""
+		hooks = append(hooks, hook)
+	}
+	slices.SortFunc(hooks, func(a, b Webhook) int { return cmp.Compare(a.ID, b.ID) })
+	return hooks
+}
+
+// Remove deletes a webhook. Pending retries to it are abandoned.
+func (d *WebhookDispatcher) Remove(id uint64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hook, ok := d.hooks[id]
+	if !ok {
+		return NewNotFoundError("webhook", fmt.Sprintf("webhook %d not found", id))
+	}
+	if hook.Configured {
+		return NewBadRequestError(fmt.Sprintf("webhook %d is configured in the webhooks file: remove it there", id))
+	}
+	if d.store != nil {
+		if err := d.store.DeleteWebhook(id); err != nil {
+			return fmt.Errorf("failed to delete webhook %d: %w", id, err)
+		}
+	}
+	delete(d.hooks, id)
+	return nil
+}
+
+// ObserveEvent delivers a wallet event to the webhooks subscribed to it. It
+// is registered as an EventObserver.
+func (d *WebhookDispatcher) ObserveEvent(event Event) {
+	switch event.Type {
+	case EventUTXOReceived:
+		d.Dispatch(WebhookAddressActivity, event.Wallet, event)
+	case EventUTXOSpent:
+		d.Dispatch(WebhookAddressActivity, event.Wallet, event)
+		d.Dispatch(WebhookOutpointSpent, event.Wallet, event)
+	case EventRescanFinished:
+		d.Dispatch(WebhookRescanFinished, event.Wallet, event)
+	}
+}
+
+// Dispatch delivers data as an eventType payload to every webhook subscribed
+// to it. An empty wallet reaches webhooks regardless of their wallet filter.
+// Deliveries run in the background.
+func (d *WebhookDispatcher) Dispatch(eventType, wallet string, data any) {
+	d.mu.RLock()
+	var targets []Webhook
+	for _, hook := range d.hooks {
+		if !slices.Contains(hook.Events, eventType) {
+			continue
+		}
+		if wallet != "" && hook.Wallet != "" && hook.Wallet != wallet {
+			continue
+		}
+		targets = append(targets, hook)
+	}
+	d.mu.RUnlock()
+
+	if len(targets) == 0 {
+		return
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		d.logger.Warnf("Failed to encode %s webhook payload: %v", eventType, err)
+		return
+	}
+
+	for _, hook := range targets {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			d.logger.Warnf("Failed to generate webhook delivery ID: %v", err)
+			return
+		}
+		body, err := json.Marshal(WebhookPayload{
+			ID:        hex.EncodeToString(id),
+			WebhookID: hook.ID,
+			Type:      eventType,
+			Time:      time.Now().Unix(),
+			Data:      encoded,
+		})
+		if err != nil {
+			d.logger.Warnf("Failed to encode %s webhook payload: %v", eventType, err)
+			return
+		}
+
+		select {
+		case d.pending <- struct{}{}:
+			d.deliveries.Go(func() {
+				defer func() { <-d.pending }()
+				d.deliver(d.ctx, hook, eventType, body)
+			})
+		default:
+			d.logger.Warnf("Dropping %s delivery to webhook %d: %d deliveries pending", eventType, hook.ID, maxWebhookDeliveries)
+		}
+	}
+}
+
+// Stop abandons the deliveries in flight and waits for them to return.
+func (d *WebhookDispatcher) Stop() {
+	d.cancel()
+	d.deliveries.Wait()
+}
+
+// deliver posts body to hook, retrying with exponential backoff until it is
+// accepted with a 2xx status, the attempts run out, the webhook is removed or
+// ctx is canceled.
+func (d *WebhookDispatcher) deliver(ctx context.Context, hook Webhook, eventType string, body []byte) {
+	backoff := d.baseBackoff
+	for attempt := 1; ; attempt++ {
+		err := d.post(ctx, hook, eventType, body)
+		if err == nil {
+			return
+		}
+		if ctx.Err() != nil {
+			d.logger.Debugf("Abandoning %s delivery to webhook %d on shutdown", eventType, hook.ID)
+			return
+		}
+		if attempt >= d.maxAttempts {
+			d.logger.Warnf("Giving up on %s delivery to webhook %d after %d attempts: %v", eventType, hook.ID, attempt, err)
+			return
+		}
+		d.logger.Debugf("Webhook %d delivery attempt %d failed, retrying in %s: %v", hook.ID, attempt, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			d.logger.Debugf("Abandoning %s delivery to webhook %d on shutdown", eventType, hook.ID)
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, webhookMaxBackoff)
+
+		d.mu.RLock()
+		_, registered := d.hooks[hook.ID]
+		d.mu.RUnlock()
+		if !registered {
+			return
+		}
+	}
+}
+
+// post makes a single signed delivery attempt.
+func (d *WebhookDispatcher) post(ctx context.Context, hook Webhook, eventType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Neutrino-Event", eventType)
+	req.Header.Set("X-Neutrino-Webhook", strconv.FormatUint(hook.ID, 10))
+	req.Header.Set(WebhookSignatureHeader, signWebhook(hook.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// signWebhook returns the WebhookSignatureHeader value for body.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// notifyNewBlocks delivers new_block for the heights from startHeight
+// through endHeight. At most the last maxNewBlockNotifications are delivered
+// after a long gap.
+func (n *Node) notifyNewBlocks(startHeight, endHeight int32) {
+	if n.webhooks == nil {
+		return
+	}
+
+	startHeight = max(startHeight, endHeight-maxNewBlockNotifications+1)
+	for height := startHeight; height <= endHeight; height++ {
+		hash, err := n.chainService.GetBlockHash(int64(height))
+		if err != nil {
+			n.logger.Warnf("Failed to get block hash at height %d for webhooks: %v", logging.KV("height", height), err)
+			return
+		}
+		n.webhooks.Dispatch(WebhookNewBlock, "", NewBlock{Height: height, Hash: hash.String()})
+	}
+}
+
+// RegisterWebhook registers a webhook for events.
+func (n *Node) RegisterWebhook(url string, events []string, wallet string) (*Webhook, error) {
+	if n.webhooks == nil {
+		return nil, errors.New("webhooks not initialized")
+	}
+
+	hook, err := n.webhooks.Register(url, events, wallet)
+	if err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// Webhooks lists the registered webhooks.
+func (n *Node) Webhooks() ([]Webhook, error) {
+	if n.webhooks == nil {
+		return nil, errors.New("webhooks not initialized")
+	}
+
+	return n.webhooks.Webhooks(), nil
+}
+
+// DeleteWebhook removes a webhook.
+func (n *Node) DeleteWebhook(id uint64) error {
+	if n.webhooks == nil {
+		return errors.New("webhooks not initialized")
+	}
+
+	return n.webhooks.Remove(id)
+}
@@ -0,0 +1,282 @@
+package neutrino
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btclog"
+)
+
+// webhookReceiver records the deliveries it accepts and fails the first
+// failures requests.
+type webhookReceiver struct {
+	mu         sync.Mutex
+	failures   int
+	attempts   int
+	payloads   []WebhookPayload
+	signatures []string
+	bodies     [][]byte
+	received   chan struct{}
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	rcv.attempts++
+	if rcv.attempts <= rcv.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rcv.payloads = append(rcv.payloads, payload)
+	rcv.signatures = append(rcv.signatures, r.Header.Get(WebhookSignatureHeader))
+	rcv.bodies = append(rcv.bodies, body)
+	rcv.received <- struct{}{}
+}
+
+func (rcv *webhookReceiver) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-rcv.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a webhook delivery")
+	}
+}
+
+func TestWebhookRegister(t *testing.T) {
+	d := NewWebhookDispatcher(newTestStore(t), btclog.Disabled)
+
+	tests := []struct {
+		name    string
+		url     string
+		events  []string
+		wallet  string
+		wantErr bool
+	}{
+		{"valid", "https://example.com/hook", []string{WebhookNewBlock, WebhookAddressActivity}, "", false},
+		{"valid with wallet", "http://127.0.0.1:8080/hook", []string{WebhookRescanFinished}, "shop", false},
+		{"relative url", "/hook", []string{WebhookNewBlock}, "", true},
+		{"unsupported scheme", "ftp://example.com/hook", []string{WebhookNewBlock}, "", true},
+		{"no events", "https://example.com/hook", nil, "", true},
+		{"unknown event", "https://example.com/hook", []string{"mempool_tx"}, "", true},
+		{"invalid wallet", "https://example.com/hook", []string{WebhookNewBlock}, "no/slashes", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook, err := d.Register(tt.url, tt.events, tt.wallet)
+			var badRequestErr *BadRequestError
+			if tt.wantErr {
+				if !errors.As(err, &badRequestErr) {
+					t.Errorf("Register() error = %v, want BadRequestError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Register() failed: %v", err)
+			}
+			if hook.ID == 0 || len(hook.Secret) != 64 {
+				t.Errorf("Register() = %+v, want an ID and a 32-byte secret", hook)
+			}
+		})
+	}
+}
+
+func TestWebhookPersistence(t *testing.T) {
+	store := newTestStore(t)
+	d := NewWebhookDispatcher(store, btclog.Disabled)
+
+	first, err := d.Register("https://example.com/a", []string{WebhookNewBlock}, "")
+	if err != nil {
+		t.Fatalf("Register() failed: %v", err)
+	}
+	second, err := d.Register("https://example.com/b", []string{WebhookOutpointSpent}, "shop")
+	if err != nil {
+		t.Fatalf("Register() failed: %v", err)
+	}
+	if err := d.Remove(first.ID); err != nil {
+		t.Fatalf("Remove() failed: %v", err)
+	}
+	var notFoundErr *NotFoundError
+	if err := d.Remove(first.ID); !errors.As(err, &notFoundErr) {
+		t.Errorf("second Remove() error = %v, want NotFoundError", err)
+	}
+
+	restored := NewWebhookDispatcher(store, btclog.Disabled)
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+	hooks := restored.Webhooks()
+	if len(hooks) != 1 || hooks[0].ID != second.ID || hooks[0].Wallet != "shop" {
+		t.Fatalf("Webhooks() after restore = %+v, want only webhook %d", hooks, second.ID)
+	}
+	if hooks[0].Secret != "" {
+		t.Error("Webhooks() exposed a secret")
+	}
+
+	// The secret survives the restart, so signatures stay verifiable
+	restored.mu.RLock()
+	secret := restored.hooks[second.ID].Secret
+	restored.mu.RUnlock()
+	if secret != second.Secret {
+		t.Error("restored webhook has a different secret")
+	}
+}
+
+func TestWebhookDeliveryRetries(t *testing.T) {
+	rcv := &webhookReceiver{failures: 2, received: make(chan struct{}, 10)}
+	server := httptest.NewServer(rcv)
+	defer server.Close()
+
+	d := NewWebhookDispatcher(nil, btclog.Disabled)
+	d.baseBackoff = time.Millisecond
+
+	hook, err := d.Register(server.URL, []string{WebhookNewBlock}, "")
+	if err != nil {
+		t.Fatalf("Register() failed: %v", err)
+	}
+
+	d.Dispatch(WebhookNewBlock, "", NewBlock{Height: 100, Hash: "00ab"})
+	rcv.wait(t)
+
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	if rcv.attempts != 3 {
+		t.Errorf("delivery took %d attempts, want 3", rcv.attempts)
+	}
+	payload := rcv.payloads[0]
+	if payload.Type != WebhookNewBlock || payload.WebhookID != hook.ID || payload.ID == "" {
+		t.Errorf("payload = %+v", payload)
+	}
+	var block NewBlock
+	if err := json.Unmarshal(payload.Data, &block); err != nil || block.Height != 100 {
+		t.Errorf("payload data = %s, want height 100", payload.Data)
+	}
+	if want := signWebhook(hook.Secret, rcv.bodies[0]); rcv.signatures[0] != want {
+		t.Errorf("signature = %s, want %s", rcv.signatures[0], want)
+	}
+}
+
+func TestWebhookDeliveryGivesUp(t *testing.T) {
+	rcv := &webhookReceiver{failures: 100, received: make(chan struct{}, 10)}
+	server := httptest.NewServer(rcv)
+	defer server.Close()
+
+	d := NewWebhookDispatcher(nil, btclog.Disabled)
+	d.baseBackoff = time.Millisecond
+	d.maxAttempts = 3
+
+	hook, err := d.Register(server.URL, []string{WebhookNewBlock}, "")
+	if err != nil {
+		t.Fatalf("Register() failed: %v", err)
+	}
+
+	// deliver returns once the attempts are exhausted
+	d.deliver(context.Background(), hook, WebhookNewBlock, []byte(`{}`))
+
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	if rcv.attempts != 3 {
+		t.Errorf("delivery made %d attempts, want 3", rcv.attempts)
+	}
+}
+
+// TestWebhookDispatcherStop tests that Stop abandons a delivery waiting to
+// retry instead of waiting out its backoff.
+func TestWebhookDispatcherStop(t *testing.T) {
+	rcv := &webhookReceiver{failures: 100, received: make(chan struct{}, 10)}
+	server := httptest.NewServer(rcv)
+	defer server.Close()
+
+	d := NewWebhookDispatcher(nil, btclog.Disabled)
+	d.baseBackoff = time.Hour
+	if _, err := d.Register(server.URL, []string{WebhookNewBlock}, ""); err != nil {
+		t.Fatalf("Register() failed: %v", err)
+	}
+	d.Dispatch(WebhookNewBlock, "", NewBlock{Height: 100})
+
+	stopped := make(chan struct{})
+	go func() {
+		d.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop() waited out the retry backoff")
+	}
+}
+
+func TestWebhookWalletEvents(t *testing.T) {
+	rcv := &webhookReceiver{received: make(chan struct{}, 10)}
+	server := httptest.NewServer(rcv)
+	defer server.Close()
+
+	d := NewWebhookDispatcher(nil, btclog.Disabled)
+	if _, err := d.Register(server.URL, []string{WebhookOutpointSpent}, "shop"); err != nil {
+		t.Fatalf("Register() failed: %v", err)
+	}
+
+	mgr := &RescanManager{
+		chainParams:    &chaincfg.MainNetParams,
+		logger:         btclog.Disabled,
+		watchedScripts: make(map[string][]byte),
+		utxoSet:        make(map[string]UTXO),
+	}
+	mgr.AddEventObserver(d.ObserveEvent)
+
+	shop := "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	other := "12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S"
+	if err := mgr.WatchAddressInWallet(shop, "shop"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.WatchAddressInWallet(other, "exchange"); err != nil {
+		t.Fatal(err)
+	}
+
+	job := &RescanJob{Addresses: []string{shop, other}, CheckpointHeight: -1}
+	found := map[string]UTXO{
+		"tx1:0": {TxID: "tx1", Vout: 0, Value: 1000, Address: shop, Height: 10},
+		"tx2:0": {TxID: "tx2", Vout: 0, Value: 2000, Address: other, Height: 11},
+	}
+	if err := mgr.commitScanProgress(job, 999, job.Addresses, found, map[string]Spend{}); err != nil {
+		t.Fatalf("commitScanProgress() failed: %v", err)
+	}
+	spent := map[string]Spend{"tx1:0": {}, "tx2:0": {}}
+	if err := mgr.commitScanProgress(job, 1999, job.Addresses, map[string]UTXO{}, spent); err != nil {
+		t.Fatalf("commitScanProgress() failed: %v", err)
+	}
+
+	// Only the spend in the shop wallet is delivered
+	rcv.wait(t)
+	select {
+	case <-rcv.received:
+		t.Fatal("unexpected second delivery")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	var event Event
+	if err := json.Unmarshal(rcv.payloads[0].Data, &event); err != nil {
+		t.Fatalf("failed to decode event: %v", err)
+	}
+	if rcv.payloads[0].Type != WebhookOutpointSpent || event.Type != EventUTXOSpent || event.Wallet != "shop" {
+		t.Errorf("delivered %s with event %+v, want outpoint_spent for shop", rcv.payloads[0].Type, event)
+	}
+}
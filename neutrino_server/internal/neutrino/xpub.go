@@ -0,0 +1,502 @@
+package neutrino
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+const (
+	// DefaultGapLimit is the number of unused addresses kept derived past
+	// the last used one on every chain of a watched xpub.
+	DefaultGapLimit = 20
+
+	// maxGapLimit bounds the gap limit of a watched xpub.
+	maxGapLimit = 1000
+
+	// maxWatchedXpubs bounds the xpubs and descriptors watched at once.
+	maxWatchedXpubs = 100
+)
+
+// WatchedXpub is an extended public key or descriptor whose addresses are
+// derived and watched.
+type WatchedXpub struct {
+	// ID is derived from the wallet and the normalized descriptor, so
+	// watching the same key twice in a wallet yields the same ID.
+	ID         string `json:"id"`
+	Descriptor string `json:"descriptor"`
+	Wallet     string `json:"wallet,omitempty"`
+	GapLimit   int    `json:"gap_limit"`
+
+	// StartHeight is the height every derived address is rescanned from,
+	// or -1 if addresses are only watched from when they are derived.
+	StartHeight int32 `json:"start_height"`
+
+	Chains    []XpubChain `json:"chains"`
+	CreatedAt int64       `json:"created_at"`
+}
+
+// XpubChain is the derivation state of one chain of a watched xpub, such as
+// its receive or change chain.
+type XpubChain struct {
+	// Derived is the number of addresses derived and watched, from index 0.
+	Derived uint32 `json:"derived"`
+
+	// LastUsed is the highest index that received funds, or -1 if none did.
+	LastUsed int64 `json:"last_used"`
+
+	// NextAddress is the first address past LastUsed.
+	NextAddress string `json:"next_address,omitempty"`
+}
+
+// XpubBalance reports the funds of a watched xpub.
+type XpubBalance struct {
+	WatchedXpub
+	Balance int64  `json:"balance"`
+	UTXOs   []UTXO `json:"utxos"`
+}
+
+// watchedXpub is a watched xpub with its parsed descriptor and derived
+// addresses.
+type watchedXpub struct {
+	WatchedXpub
+	desc *descriptor
+
+	// addresses holds the derived addresses of every chain by index.
+	addresses [][]string
+}
+
+// xpubAddress locates an address derived from a watched xpub.
+type xpubAddress struct {
+	id    string
+	chain int
+	index uint32
+}
+
+// xpubWatcher holds the watched xpubs and the addresses derived from them.
+// Several xpubs may derive the same address, so each address is located in
+// every xpub deriving it.
+type xpubWatcher struct {
+	mu        sync.Mutex
+	xpubs     map[string]*watchedXpub
+	addresses map[string][]xpubAddress
+
+	// used holds the derived addresses that received funds since
+	// extendXpubs last ran, which wake signals.
+	used map[string]struct{}
+	wake chan struct{}
+}
+
+// restoreXpubs loads the watched xpubs from the store and derives their
+// addresses again. The addresses themselves are already watched.
+func (n *Node) restoreXpubs() error {
+	n.xpubs = &xpubWatcher{
+		xpubs:     make(map[string]*watchedXpub),
+		addresses: make(map[string][]xpubAddress),
+		used:      make(map[string]struct{}),
+		wake:      make(chan struct{}, 1),
+	}
+	if n.store == nil {
+		return nil
+	}
+
+	xpubs, err := n.store.WatchedXpubs()
+	if err != nil {
+		return fmt.Errorf("failed to load watched xpubs: %w", err)
+	}
+	for _, xpub := range xpubs {
+		watched, err := n.newWatchedXpub(xpub)
+		if err != nil {
+			n.logger.Warnf("Failed to restore watched xpub %s: %v", xpub.ID, err)
+			continue
+		}
+		for chain, state := range xpub.Chains {
+			if _, err := n.xpubs.derive(watched, chain, state.Derived, n.chainParams); err != nil {
+				n.logger.Warnf("Failed to restore watched xpub %s: %v", xpub.ID, err)
+			}
+		}
+		n.xpubs.xpubs[xpub.ID] = watched
+	}
+	return nil
+}
+
+// newWatchedXpub parses xpub's descriptor. No address is derived yet.
+func (n *Node) newWatchedXpub(xpub WatchedXpub) (*watchedXpub, error) {
+	desc, err := parseDescriptor(xpub.Descriptor, n.chainParams)
+	if err != nil {
+		return nil, err
+	}
+	watched := &watchedXpub{WatchedXpub: xpub, desc: desc, addresses: make([][]string, desc.chains())}
+	watched.Chains = make([]XpubChain, desc.chains())
+	for chain := range watched.Chains {
+		watched.Chains[chain].LastUsed = -1
+		if chain < len(xpub.Chains) {
+			watched.Chains[chain].LastUsed = xpub.Chains[chain].LastUsed
+		}
+	}
+	return watched, nil
+}
+
+// derive extends chain of xpub to count addresses for params and returns the
+// new ones. Callers must hold mu.
+func (w *xpubWatcher) derive(xpub *watchedXpub, chain int, count uint32, params *chaincfg.Params) ([]string, error) {
+	var added []string
+	for index := uint32(len(xpub.addresses[chain])); index < count; index++ {
+		addr, err := xpub.desc.deriveAddress(chain, index, params)
+		if err != nil {
+			return added, err
+		}
+		address := addr.EncodeAddress()
+		xpub.addresses[chain] = append(xpub.addresses[chain], address)
+		xpub.Chains[chain].Derived = index + 1
+		w.addresses[address] = append(w.addresses[address], xpubAddress{id: xpub.ID, chain: chain, index: index})
+		added = append(added, address)
+	}
+	return added, nil
+}
+
+// release drops the addresses derived from xpub, which must no longer be in
+// xpubs, and returns those that no other xpub of its wallet derives.
+// Callers must hold mu.
+func (w *xpubWatcher) release(xpub *watchedXpub) []string {
+	wallet := cmp.Or(xpub.Wallet, DefaultWallet)
+	var released []string
+	for _, chain := range xpub.addresses {
+		for _, address := range chain {
+			locations := slices.DeleteFunc(w.addresses[address], func(l xpubAddress) bool { return l.id == xpub.ID })
+			if len(locations) == 0 {
+				delete(w.addresses, address)
+			} else {
+				w.addresses[address] = locations
+			}
+			shared := slices.ContainsFunc(locations, func(l xpubAddress) bool {
+				return cmp.Or(w.xpubs[l.id].Wallet, DefaultWallet) == wallet
+			})
+			if !shared {
+				released = append(released, address)
+			}
+		}
+	}
+	return released
+}
+
+// WatchXpub watches the addresses derived from an extended public key or
+// output descriptor as part of wallet. gapLimit unused addresses are kept
+// derived past the last used one on every chain; zero selects
+// DefaultGapLimit. Every derived address is rescanned in the background from
+// startHeight, or only watched from now on if it is negative. Watching the
+// same descriptor again in the same wallet returns the existing state.
+func (n *Node) WatchXpub(input, wallet string, gapLimit int, startHeight int32) (*WatchedXpub, error) {
+	if n.rescanMgr == nil || n.xpubs == nil {
+		return nil, errors.New("rescan manager not initialized")
+	}
+	if wallet != "" {
+		if err := ValidateWalletName(wallet); err != nil {
+			return nil, err
+		}
+	}
+	if gapLimit == 0 {
+		gapLimit = DefaultGapLimit
+	}
+	if gapLimit < 1 || gapLimit > maxGapLimit {
+		return nil, NewBadRequestError(fmt.Sprintf("gap_limit must be between 1 and %d", maxGapLimit))
+	}
+
+	desc, err := parseDescriptor(input, n.chainParams)
+	if err != nil {
+		return nil, err
+	}
+	if !desc.ranged() {
+		return nil, NewBadRequestError("descriptor must be ranged: end a key path with /*")
+	}
+	normalized := desc.String()
+	sum := sha256.Sum256([]byte(cmp.Or(wallet, DefaultWallet) + "\x00" + normalized))
+	id := hex.EncodeToString(sum[:8])
+
+	n.xpubs.mu.Lock()
+	// Xpubs watched before IDs covered the wallet are found by descriptor
+	for _, existing := range n.xpubs.xpubs {
+		if existing.Descriptor == normalized && cmp.Or(existing.Wallet, DefaultWallet) == cmp.Or(wallet, DefaultWallet) {
+			xpub := existing.report()
+			n.xpubs.mu.Unlock()
+			return &xpub, nil
+		}
+	}
+	if len(n.xpubs.xpubs) >= maxWatchedXpubs {
+		n.xpubs.mu.Unlock()
+		return nil, NewBadRequestError(fmt.Sprintf("too many watched xpubs (max %d)", maxWatchedXpubs))
+	}
+
+	watched, err := n.newWatchedXpub(WatchedXpub{
+		ID:          id,
+		Descriptor:  normalized,
+		Wallet:      wallet,
+		GapLimit:    gapLimit,
+		StartHeight: max(startHeight, -1),
+		CreatedAt:   time.Now().Unix(),
+	})
+	if err != nil {
+		n.xpubs.mu.Unlock()
+		return nil, err
+	}
+	var added []string
+	for chain := range watched.Chains {
+		addresses, err := n.xpubs.derive(watched, chain, uint32(gapLimit), n.chainParams)
+		if err != nil {
+			n.xpubs.release(watched)
+			n.xpubs.mu.Unlock()
+			return nil, err
+		}
+		added = append(added, addresses...)
+	}
+	n.xpubs.xpubs[id] = watched
+	xpub := watched.WatchedXpub
+	n.xpubs.mu.Unlock()
+
+	err = n.watchXpubAddresses(xpub, added)
+	if err == nil && xpub.StartHeight >= 0 && len(added) > 0 {
+		// The rescan runs in the background, in a job slot like those of
+		// the other watch requests
+		err = n.rescanMgr.StartRescan(xpub.StartHeight, added)
+	}
+	if err != nil {
+		// Undo the addresses watched and the state persisted so far
+		n.xpubs.mu.Lock()
+		delete(n.xpubs.xpubs, id)
+		released := n.xpubs.release(watched)
+		n.xpubs.mu.Unlock()
+		if rollbackErr := n.dropXpub(xpub, released); rollbackErr != nil {
+			n.logger.Warnf("Failed to roll back watching xpub %s: %v", id, rollbackErr)
+		}
+		return nil, err
+	}
+
+	// Addresses watched before may already have funds
+	if utxos, err := n.rescanMgr.GetUTXOs(added); err == nil {
+		used := make([]string, 0, len(utxos))
+		for _, utxo := range utxos {
+			used = append(used, utxo.Address)
+		}
+		n.markXpubUsed(used)
+	}
+
+	n.xpubs.mu.Lock()
+	report := watched.report()
+	n.xpubs.mu.Unlock()
+	n.logger.Infof("Watching %s as xpub %s with %d addresses", normalized, id, len(added))
+	return &report, nil
+}
+
+// watchXpubAddresses watches addresses derived from xpub and persists its
+// state. Rescanning the addresses is left to the caller.
+func (n *Node) watchXpubAddresses(xpub WatchedXpub, addresses []string) error {
+	for _, address := range addresses {
+		if err := n.rescanMgr.WatchAddressInWallet(address, xpub.Wallet); err != nil {
+			return fmt.Errorf("failed to watch derived address %s: %w", address, err)
+		}
+	}
+	if n.store != nil {
+		if err := n.store.PutWatchedXpub(xpub); err != nil {
+			return fmt.Errorf("failed to persist watched xpub: %w", err)
+		}
+	}
+	return nil
+}
+
+// ObserveXpubUsage extends the derivation of watched xpubs when one of their
+// addresses receives funds. It is registered as an EventObserver.
+func (n *Node) ObserveXpubUsage(event Event) {
+	if event.Type != EventUTXOReceived {
+		return
+	}
+	var utxo UTXO
+	if err := json.Unmarshal(event.Data, &utxo); err != nil {
+		return
+	}
+
+	n.xpubs.mu.Lock()
+	_, derived := n.xpubs.addresses[utxo.Address]
+	if derived {
+		n.xpubs.used[utxo.Address] = struct{}{}
+	}
+	n.xpubs.mu.Unlock()
+	if !derived {
+		return
+	}
+	// Observers must not block, and watching takes the rescan lock, so
+	// extendXpubs watches the new addresses
+	select {
+	case n.xpubs.wake <- struct{}{}:
+	default:
+	}
+}
+
+// extendXpubs marks the addresses ObserveXpubUsage collected as used, a
+// batch at a time, until the node stops.
+func (n *Node) extendXpubs() {
+	for {
+		select {
+		case <-n.lifetime.Done():
+			return
+		case <-n.xpubs.wake:
+		}
+
+		n.xpubs.mu.Lock()
+		used := slices.Collect(maps.Keys(n.xpubs.used))
+		clear(n.xpubs.used)
+		n.xpubs.mu.Unlock()
+		n.markXpubUsed(used)
+	}
+}
+
+// markXpubUsed records that addresses received funds and derives and watches
+// addresses until every affected chain has a full gap past its last used
+// index.
+func (n *Node) markXpubUsed(addresses []string) {
+	n.xpubs.mu.Lock()
+	added := make(map[string][]string)
+	for _, address := range addresses {
+		for _, location := range slices.Clone(n.xpubs.addresses[address]) {
+			xpub := n.xpubs.xpubs[location.id]
+			chain := &xpub.Chains[location.chain]
+			if int64(location.index) <= chain.LastUsed {
+				continue
+			}
+			chain.LastUsed = int64(location.index)
+
+			addrs, err := n.xpubs.derive(xpub, location.chain, uint32(chain.LastUsed)+1+uint32(xpub.GapLimit), n.chainParams)
+			if err != nil {
+				n.logger.Warnf("Failed to extend xpub %s: %v", xpub.ID, err)
+			}
+			added[xpub.ID] = append(added[xpub.ID], addrs...)
+		}
+	}
+	var updates []WatchedXpub
+	for id := range added {
+		updates = append(updates, n.xpubs.xpubs[id].WatchedXpub)
+	}
+	n.xpubs.mu.Unlock()
+
+	for _, xpub := range updates {
+		if len(added[xpub.ID]) > 0 {
+			n.logger.Infof("Xpub %s used, watching %d more addresses", xpub.ID, len(added[xpub.ID]))
+		}
+		if err := n.watchXpubAddresses(xpub, added[xpub.ID]); err != nil {
+			n.logger.Warnf("Failed to extend xpub %s: %v", xpub.ID, err)
+			continue
+		}
+		if xpub.StartHeight >= 0 && len(added[xpub.ID]) > 0 {
+			n.rescanMgr.rescanInBackground(xpub.StartHeight, added[xpub.ID])
+		}
+	}
+}
+
+// report returns the state of x with the next unused address of every chain.
+// Callers must hold the watcher's mu.
+func (x *watchedXpub) report() WatchedXpub {
+	xpub := x.WatchedXpub
+	xpub.Chains = slices.Clone(x.Chains)
+	for chain := range xpub.Chains {
+		if next := xpub.Chains[chain].LastUsed + 1; next < int64(len(x.addresses[chain])) {
+			xpub.Chains[chain].NextAddress = x.addresses[chain][next]
+		}
+	}
+	return xpub
+}
+
+// WatchedXpubs returns every watched xpub.
+func (n *Node) WatchedXpubs() ([]WatchedXpub, error) {
+	if n.xpubs == nil {
+		return nil, errors.New("rescan manager not initialized")
+	}
+
+	n.xpubs.mu.Lock()
+	defer n.xpubs.mu.Unlock()
+	xpubs := make([]WatchedXpub, 0, len(n.xpubs.xpubs))
+	for _, watched := range n.xpubs.xpubs {
+		xpubs = append(xpubs, watched.report())
+	}
+	slices.SortFunc(xpubs, func(a, b WatchedXpub) int {
+		return int(a.CreatedAt - b.CreatedAt)
+	})
+	return xpubs, nil
+}
+
+// XpubBalance returns the balance and UTXOs of every address derived from
+// the watched xpub id.
+func (n *Node) XpubBalance(id string) (*XpubBalance, error) {
+	if n.rescanMgr == nil || n.xpubs == nil {
+		return nil, errors.New("rescan manager not initialized")
+	}
+
+	n.xpubs.mu.Lock()
+	watched, ok := n.xpubs.xpubs[id]
+	if !ok {
+		n.xpubs.mu.Unlock()
+		return nil, NewNotFoundError("xpub", fmt.Sprintf("xpub %s is not watched", id))
+	}
+	balance := XpubBalance{WatchedXpub: watched.report()}
+	var addresses []string
+	for _, chain := range watched.addresses {
+		addresses = append(addresses, chain...)
+	}
+	n.xpubs.mu.Unlock()
+
+	utxos, err := n.rescanMgr.GetUTXOs(addresses)
+	if err != nil {
+		return nil, err
+	}
+	balance.UTXOs = utxos
+	for _, utxo := range utxos {
+		balance.Balance += utxo.Value
+	}
+	return &balance, nil
+}
+
+// UnwatchXpub stops watching the xpub id. Its derived addresses leave its
+// wallet unless another xpub of the wallet derives them, and leave the watch
+// list unless another wallet still contains them.
+func (n *Node) UnwatchXpub(id string) error {
+	if n.rescanMgr == nil || n.xpubs == nil {
+		return errors.New("rescan manager not initialized")
+	}
+
+	n.xpubs.mu.Lock()
+	watched, ok := n.xpubs.xpubs[id]
+	if !ok {
+		n.xpubs.mu.Unlock()
+		return NewNotFoundError("xpub", fmt.Sprintf("xpub %s is not watched", id))
+	}
+	delete(n.xpubs.xpubs, id)
+	addresses := n.xpubs.release(watched)
+	n.xpubs.mu.Unlock()
+
+	return n.dropXpub(watched.WatchedXpub, addresses)
+}
+
+// dropXpub deletes the stored state of xpub and removes addresses, those
+// released from it, from its wallet.
+func (n *Node) dropXpub(xpub WatchedXpub, addresses []string) error {
+	if n.store != nil {
+		if err := n.store.DeleteWatchedXpub(xpub.ID); err != nil {
+			return fmt.Errorf("failed to delete watched xpub: %w", err)
+		}
+	}
+	wallet := cmp.Or(xpub.Wallet, DefaultWallet)
+	for _, address := range addresses {
+		var notFound *NotFoundError
+		if err := n.rescanMgr.UnwatchAddressInWallet(address, wallet); err != nil && !errors.As(err, &notFound) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package neutrino
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btclog"
+)
+
+// newXpubTestNode returns a node watching xpubs in store.
+func newXpubTestNode(t *testing.T, store *Store) *Node {
+	t.Helper()
+	n := &Node{
+		chainParams: &chaincfg.MainNetParams,
+		store:       store,
+		logger:      btclog.Disabled,
+		rescanMgr: &RescanManager{
+			chainParams:    &chaincfg.MainNetParams,
+			store:          store,
+			logger:         btclog.Disabled,
+			watchedScripts: make(map[string][]byte),
+			utxoSet:        make(map[string]UTXO),
+			addrWallets:    make(map[string][]string),
+		},
+	}
+	if err := n.restoreXpubs(); err != nil {
+		t.Fatalf("restoreXpubs() failed: %v", err)
+	}
+	return n
+}
+
+func TestWatchXpubGapLimit(t *testing.T) {
+	store := newTestStore(t)
+	newNode := func() *Node { return newXpubTestNode(t, store) }
+	n := newNode()
+
+	if _, err := n.WatchXpub("wpkh(02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9)", "", 3, -1); err == nil {
+		t.Error("WatchXpub() of a descriptor without a range succeeded")
+	}
+
+	xpub, err := n.WatchXpub(bip84Zpub, "savings", 3, -1)
+	if err != nil {
+		t.Fatalf("WatchXpub() failed: %v", err)
+	}
+	if len(xpub.Chains) != 2 || xpub.Chains[0].Derived != 3 || xpub.Chains[1].Derived != 3 {
+		t.Fatalf("WatchXpub() chains = %+v, want 3 addresses on 2 chains", xpub.Chains)
+	}
+	if xpub.Chains[0].NextAddress != "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu" {
+		t.Errorf("next receive address = %s", xpub.Chains[0].NextAddress)
+	}
+	if len(n.rescanMgr.watchedScripts) != 6 {
+		t.Errorf("watched %d addresses, want 6", len(n.rescanMgr.watchedScripts))
+	}
+
+	// Watching the same key again in the wallet, even as a descriptor,
+	// changes nothing
+	again, err := n.WatchXpub(xpub.Descriptor, "savings", 0, -1)
+	if err != nil {
+		t.Fatalf("WatchXpub() again failed: %v", err)
+	}
+	if again.ID != xpub.ID || again.GapLimit != 3 {
+		t.Errorf("WatchXpub() again = %+v, want %+v", again, xpub)
+	}
+
+	// Funds on receive address 1 keep 3 unused addresses past it
+	n.xpubs.mu.Lock()
+	used := n.xpubs.xpubs[xpub.ID].addresses[0][1]
+	n.xpubs.mu.Unlock()
+	n.markXpubUsed([]string{used})
+
+	xpubs, err := n.WatchedXpubs()
+	if err != nil {
+		t.Fatalf("WatchedXpubs() failed: %v", err)
+	}
+	if len(xpubs) != 1 || xpubs[0].Chains[0].Derived != 5 || xpubs[0].Chains[0].LastUsed != 1 || xpubs[0].Chains[1].Derived != 3 {
+		t.Fatalf("WatchedXpubs() = %+v", xpubs)
+	}
+	if len(n.rescanMgr.watchedScripts) != 8 {
+		t.Errorf("watched %d addresses, want 8", len(n.rescanMgr.watchedScripts))
+	}
+	if wallets := n.rescanMgr.addrWallets[xpubs[0].Chains[0].NextAddress]; len(wallets) != 1 || wallets[0] != "savings" {
+		t.Errorf("derived address wallets = %v, want [savings]", wallets)
+	}
+
+	// A restart derives the same addresses again
+	restored := newNode()
+	xpubs, err = restored.WatchedXpubs()
+	if err != nil {
+		t.Fatalf("WatchedXpubs() after restore failed: %v", err)
+	}
+	if len(xpubs) != 1 || xpubs[0].Chains[0].Derived != 5 || xpubs[0].Chains[0].LastUsed != 1 {
+		t.Fatalf("WatchedXpubs() after restore = %+v", xpubs)
+	}
+	if len(restored.xpubs.addresses) != 8 {
+		t.Errorf("restored %d derived addresses, want 8", len(restored.xpubs.addresses))
+	}
+
+	if err := n.UnwatchXpub(xpub.ID); err != nil {
+		t.Fatalf("UnwatchXpub() failed: %v", err)
+	}
+	if len(n.rescanMgr.watchedScripts) != 0 {
+		t.Errorf("watched %d addresses after unwatching, want 0", len(n.rescanMgr.watchedScripts))
+	}
+	if err := n.UnwatchXpub(xpub.ID); err == nil {
+		t.Error("UnwatchXpub() of an unwatched xpub succeeded")
+	}
+}
+
+func TestUnwatchXpubSharedAddresses(t *testing.T) {
+	n := newXpubTestNode(t, newTestStore(t))
+
+	both, err := n.WatchXpub(bip84Zpub, "savings", 3, -1)
+	if err != nil {
+		t.Fatalf("WatchXpub() failed: %v", err)
+	}
+	// The receive chain alone derives the same receive addresses
+	receive := strings.Replace(strings.Split(both.Descriptor, "#")[0], "/<0;1>/*", "/0/*", 1)
+	shared, err := n.WatchXpub(receive, "savings", 3, -1)
+	if err != nil {
+		t.Fatalf("WatchXpub() of the receive chain failed: %v", err)
+	}
+	if shared.ID == both.ID || len(n.rescanMgr.watchedScripts) != 6 {
+		t.Fatalf("watched %d addresses for xpubs %s and %s, want 6", len(n.rescanMgr.watchedScripts), both.ID, shared.ID)
+	}
+
+	// A change address is also in another wallet
+	n.xpubs.mu.Lock()
+	receiveAddress := n.xpubs.xpubs[both.ID].addresses[0][0]
+	changeAddresses := slices.Clone(n.xpubs.xpubs[both.ID].addresses[1])
+	n.xpubs.mu.Unlock()
+	if err := n.rescanMgr.WatchAddressInWallet(changeAddresses[0], "shop"); err != nil {
+		t.Fatalf("WatchAddressInWallet() failed: %v", err)
+	}
+
+	if err := n.UnwatchXpub(both.ID); err != nil {
+		t.Fatalf("UnwatchXpub() failed: %v", err)
+	}
+	if len(n.rescanMgr.watchedScripts) != 4 {
+		t.Errorf("watched %d addresses after unwatching, want 4", len(n.rescanMgr.watchedScripts))
+	}
+	if wallets := n.rescanMgr.addrWallets[receiveAddress]; !slices.Equal(wallets, []string{"savings"}) {
+		t.Errorf("shared receive address wallets = %v, want [savings]", wallets)
+	}
+	if wallets := n.rescanMgr.addrWallets[changeAddresses[0]]; !slices.Equal(wallets, []string{"shop"}) {
+		t.Errorf("change address in another wallet has wallets %v, want [shop]", wallets)
+	}
+	if _, ok := n.rescanMgr.watchedScripts[changeAddresses[1]]; ok {
+		t.Errorf("change address %s is still watched", changeAddresses[1])
+	}
+	records, err := n.store.WatchedAddresses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wallets := records[changeAddresses[0]].Wallets; !slices.Equal(wallets, []string{"shop"}) {
+		t.Errorf("stored change address wallets = %v, want [shop]", wallets)
+	}
+
+	if err := n.UnwatchXpub(shared.ID); err != nil {
+		t.Fatalf("UnwatchXpub() of the receive chain failed: %v", err)
+	}
+	if len(n.rescanMgr.watchedScripts) != 1 || len(n.xpubs.addresses) != 0 {
+		t.Errorf("watched %d addresses and %d derived ones, want 1 and 0", len(n.rescanMgr.watchedScripts), len(n.xpubs.addresses))
+	}
+}
+
+func TestWatchXpubWallets(t *testing.T) {
+	n := newXpubTestNode(t, newTestStore(t))
+
+	savings, err := n.WatchXpub(bip84Zpub, "savings", 3, -1)
+	if err != nil {
+		t.Fatalf("WatchXpub() failed: %v", err)
+	}
+	// Another wallet watching the same key gets an xpub of its own
+	shop, err := n.WatchXpub(bip84Zpub, "shop", 3, -1)
+	if err != nil {
+		t.Fatalf("WatchXpub() in another wallet failed: %v", err)
+	}
+	if shop.ID == savings.ID || shop.Wallet != "shop" {
+		t.Fatalf("WatchXpub() in another wallet = %+v, want a new xpub of shop", shop)
+	}
+	n.xpubs.mu.Lock()
+	address := n.xpubs.xpubs[shop.ID].addresses[0][0]
+	n.xpubs.mu.Unlock()
+	if wallets := n.rescanMgr.addrWallets[address]; !slices.Equal(wallets, []string{"savings", "shop"}) {
+		t.Errorf("derived address wallets = %v, want [savings shop]", wallets)
+	}
+
+	// Funds extend both, and unwatching one leaves the other's addresses
+	n.markXpubUsed([]string{address})
+	xpubs, err := n.WatchedXpubs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, xpub := range xpubs {
+		if xpub.Chains[0].LastUsed != 0 {
+			t.Errorf("xpub of %s has last used index %d, want 0", xpub.Wallet, xpub.Chains[0].LastUsed)
+		}
+	}
+	if err := n.UnwatchXpub(savings.ID); err != nil {
+		t.Fatalf("UnwatchXpub() failed: %v", err)
+	}
+	if wallets := n.rescanMgr.addrWallets[address]; !slices.Equal(wallets, []string{"shop"}) {
+		t.Errorf("derived address wallets after unwatching savings = %v, want [shop]", wallets)
+	}
+}
+
+func TestWatchXpubRollback(t *testing.T) {
+	n := newXpubTestNode(t, newTestStore(t))
+
+	// Scheduling the rescan fails after every address is watched and the
+	// xpub persisted, as every job slot is taken
+	n.rescanMgr.jobSlots = make(chan struct{}, 1)
+	n.rescanMgr.jobSlots <- struct{}{}
+	var busy *BusyError
+	if _, err := n.WatchXpub(bip84Zpub, "savings", 3, 0); !errors.As(err, &busy) {
+		t.Fatalf("WatchXpub() with every job slot taken: %v, want a busy error", err)
+	}
+	if len(n.rescanMgr.watchedScripts) != 0 || len(n.xpubs.xpubs) != 0 || len(n.xpubs.addresses) != 0 {
+		t.Errorf("after a failed watch: %d watched addresses, %d xpubs, %d derived addresses, want none",
+			len(n.rescanMgr.watchedScripts), len(n.xpubs.xpubs), len(n.xpubs.addresses))
+	}
+	if stored, err := n.store.WatchedXpubs(); err != nil || len(stored) != 0 {
+		t.Errorf("stored xpubs after a failed watch = %v, %v, want none", stored, err)
+	}
+
+	// The rescan runs in the background, where it fails without a chain
+	// service, and leaves the watch in place
+	<-n.rescanMgr.jobSlots
+	xpub, err := n.WatchXpub(bip84Zpub, "savings", 3, 0)
+	if err != nil {
+		t.Fatalf("WatchXpub() after a failed watch failed: %v", err)
+	}
+	n.rescanMgr.jobs.Wait()
+	if xpub.Chains[0].Derived != 3 || len(n.rescanMgr.watchedScripts) != 6 {
+		t.Errorf("WatchXpub() after a failed watch = %+v with %d watched addresses", xpub, len(n.rescanMgr.watchedScripts))
+	}
+}
+
+func TestObserveXpubUsage(t *testing.T) {
+	n := newXpubTestNode(t, newTestStore(t))
+	xpub, err := n.WatchXpub(bip84Zpub, "savings", 3, -1)
+	if err != nil {
+		t.Fatalf("WatchXpub() failed: %v", err)
+	}
+	n.xpubs.mu.Lock()
+	used := n.xpubs.xpubs[xpub.ID].addresses[0][2]
+	n.xpubs.mu.Unlock()
+
+	// Payments to the same address are collected for one worker
+	for range 10 {
+		data, _ := json.Marshal(UTXO{Address: used, Value: 1000})
+		n.ObserveXpubUsage(Event{Type: EventUTXOReceived, Data: data})
+	}
+	data, _ := json.Marshal(UTXO{Address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", Value: 1000})
+	n.ObserveXpubUsage(Event{Type: EventUTXOReceived, Data: data})
+	if len(n.xpubs.used) != 1 || len(n.xpubs.wake) != 1 {
+		t.Fatalf("collected %d used addresses with %d wakeups, want 1 and 1", len(n.xpubs.used), len(n.xpubs.wake))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n.lifetime = ctx
+	var wg sync.WaitGroup
+	wg.Go(n.extendXpubs)
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		xpubs, err := n.WatchedXpubs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if xpubs[0].Chains[0].Derived == 6 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("receive chain derived %d addresses, want 6", xpubs[0].Chains[0].Derived)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	wg.Wait()
+}
@@ -0,0 +1,191 @@
+package onion
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// controlTimeout bounds each exchange with Tor's control port.
+const controlTimeout = 30 * time.Second
+
+// controlConn is an authenticated connection to Tor's control port.
+type controlConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dialControl connects to the control port at addr, a host:port or
+// unix:/path, and authenticates with password if set, or else with Tor's
+// cookie file or no authentication, whichever Tor offers.
+func dialControl(ctx context.Context, addr, password string) (*controlConn, error) {
+	network := "tcp"
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		network, addr = "unix", path
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Tor control port: %w", err)
+	}
+	c := &controlConn{conn: conn, reader: bufio.NewReader(conn)}
+	if err := c.authenticate(password); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// authenticate authenticates the connection with the first method Tor
+// offers that is configured: a password, no authentication or a cookie.
+func (c *controlConn) authenticate(password string) error {
+	lines, err := c.command("PROTOCOLINFO 1")
+	if err != nil {
+		return fmt.Errorf("failed to query Tor authentication methods: %w", err)
+	}
+
+	var methods []string
+	var cookieFile string
+	for _, line := range lines {
+		rest, ok := strings.CutPrefix(line, "AUTH ")
+		if !ok {
+			continue
+		}
+		for _, field := range splitFields(rest) {
+			key, value, _ := strings.Cut(field, "=")
+			switch key {
+			case "METHODS":
+				methods = strings.Split(value, ",")
+			case "COOKIEFILE":
+				cookieFile = unquote(value)
+			}
+		}
+	}
+	offers := func(method string) bool {
+		for _, m := range methods {
+			if m == method {
+				return true
+			}
+		}
+		return false
+	}
+
+	var auth string
+	switch {
+	case password != "":
+		auth = "AUTHENTICATE " + quote(password)
+	case offers("NULL"):
+		auth = "AUTHENTICATE"
+	case offers("COOKIE") && cookieFile != "":
+		cookie, err := os.ReadFile(cookieFile)
+		if err != nil {
+			return fmt.Errorf("failed to read Tor cookie file: %w", err)
+		}
+		auth = "AUTHENTICATE " + hex.EncodeToString(cookie)
+	case offers("HASHEDPASSWORD"):
+		return errors.New("Tor control port needs a password: set --tor-control-password")
+	default:
+		return fmt.Errorf("no supported Tor control authentication method in %v", methods)
+	}
+	if _, err := c.command(auth); err != nil {
+		return fmt.Errorf("Tor control authentication failed: %w", err)
+	}
+	return nil
+}
+
+// command sends a command line and returns the lines of a successful
+// reply, without their status codes.
+func (c *controlConn) command(line string) ([]string, error) {
+	c.conn.SetDeadline(time.Now().Add(controlTimeout))
+	if _, err := fmt.Fprintf(c.conn, "%s\r\n", line); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for {
+		reply, err := c.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		reply = strings.TrimRight(reply, "\r\n")
+		if len(reply) < 4 {
+			return nil, fmt.Errorf("malformed Tor control reply %q", reply)
+		}
+		code, sep, text := reply[:3], reply[3], reply[4:]
+		if code != "250" {
+			return nil, fmt.Errorf("Tor replied %s %s", code, text)
+		}
+		switch sep {
+		case ' ':
+			return append(lines, text), nil
+		case '-':
+			lines = append(lines, text)
+		case '+':
+			// Data replies run until a line holding a single dot
+			lines = append(lines, text)
+			for {
+				data, err := c.reader.ReadString('\n')
+				if err != nil {
+					return nil, err
+				}
+				if data = strings.TrimRight(data, "\r\n"); data == "." {
+					break
+				}
+				lines = append(lines, data)
+			}
+		default:
+			return nil, fmt.Errorf("malformed Tor control reply %q", reply)
+		}
+	}
+}
+
+func (c *controlConn) Close() error {
+	return c.conn.Close()
+}
+
+// splitFields splits space-separated fields, keeping quoted values whole.
+func splitFields(s string) []string {
+	var fields []string
+	var field strings.Builder
+	quoted, escaped := false, false
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quoted:
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+			continue
+		}
+		field.WriteRune(r)
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+// quote returns s as a control protocol quoted string.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// unquote returns the value of a control protocol quoted string.
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	return strings.NewReplacer(`\\`, `\`, `\"`, `"`).Replace(s[1 : len(s)-1])
+}
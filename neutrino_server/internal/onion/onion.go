@@ -0,0 +1,210 @@
+// Package onion publishes the REST API as a Tor v3 onion service through
+// Tor's control port.
+package onion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btclog"
+)
+
+// checkInterval is how often the control connection is checked, so the
+// service is published again after Tor restarts.
+var checkInterval = time.Minute
+
+// Config configures an onion service.
+type Config struct {
+	// ControlAddr is Tor's control port, as host:port or unix:/path.
+	ControlAddr string
+	// ControlPassword authenticates with Tor's HashedControlPassword. If
+	// empty, a cookie file or no authentication is used.
+	ControlPassword string
+
+	// KeyPath stores the service's private key, so its address survives
+	// restarts. A new key is generated when the file does not exist.
+	KeyPath string
+
+	// Port is the port of the onion address, and Target the address Tor
+	// forwards its connections to.
+	Port   int
+	Target string
+}
+
+// Service is a published onion service. Tor removes it when the control
+// connection that added it closes, so it never outlives the process.
+type Service struct {
+	cfg    Config
+	logger btclog.Logger
+	key    string
+
+	mu        sync.Mutex
+	conn      *controlConn
+	serviceID string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Publish publishes the onion service of cfg and keeps it published until
+// Close, checking the control connection every minute.
+func Publish(ctx context.Context, cfg Config, logger btclog.Logger) (*Service, error) {
+	if cfg.Port <= 0 || cfg.Port > 65535 {
+		return nil, fmt.Errorf("invalid onion port %d", cfg.Port)
+	}
+	if _, _, err := net.SplitHostPort(cfg.Target); err != nil {
+		return nil, fmt.Errorf("invalid onion target %q: %w", cfg.Target, err)
+	}
+
+	s := &Service{
+		cfg:    cfg,
+		logger: logger,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	key, err := os.ReadFile(cfg.KeyPath)
+	switch {
+	case err == nil:
+		s.key = strings.TrimSpace(string(key))
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("failed to read onion key: %w", err)
+	}
+
+	s.mu.Lock()
+	err = s.publish(ctx)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	go s.maintain()
+	return s, nil
+}
+
+// Address returns the service's .onion host and port.
+func (s *Service) Address() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return net.JoinHostPort(s.serviceID+".onion", strconv.Itoa(s.cfg.Port))
+}
+
+// publish adds the service to Tor on a new control connection, which it
+// keeps. A newly generated key is saved before the service is used. It is
+// called with s.mu held.
+func (s *Service) publish(ctx context.Context) error {
+	conn, err := dialControl(ctx, s.cfg.ControlAddr, s.cfg.ControlPassword)
+	if err != nil {
+		return err
+	}
+
+	key := s.key
+	if key == "" {
+		key = "NEW:ED25519-V3"
+	}
+	lines, err := conn.command(fmt.Sprintf("ADD_ONION %s Port=%d,%s", key, s.cfg.Port, s.cfg.Target))
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to add onion service: %w", err)
+	}
+
+	var serviceID, privateKey string
+	for _, line := range lines {
+		if value, ok := strings.CutPrefix(line, "ServiceID="); ok {
+			serviceID = value
+		} else if value, ok := strings.CutPrefix(line, "PrivateKey="); ok {
+			privateKey = value
+		}
+	}
+	if serviceID == "" {
+		conn.Close()
+		return errors.New("Tor did not return the onion service ID")
+	}
+	if s.key == "" {
+		if privateKey == "" {
+			conn.Close()
+			return errors.New("Tor did not return the onion service key")
+		}
+		if err := saveKey(s.cfg.KeyPath, privateKey); err != nil {
+			conn.Close()
+			return err
+		}
+		s.key = privateKey
+	}
+
+	s.conn, s.serviceID = conn, serviceID
+	return nil
+}
+
+// maintain checks the control connection every minute and publishes the
+// service again if it was lost, such as when Tor restarted, until Close.
+func (s *Service) maintain() {
+	defer close(s.done)
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		if s.conn != nil {
+			if _, err := s.conn.command("GETINFO version"); err != nil {
+				s.logger.Warnf("Lost Tor control connection of onion service %s.onion: %v", s.serviceID, err)
+				s.conn.Close()
+				s.conn = nil
+			}
+		}
+		if s.conn == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), controlTimeout)
+			if err := s.publish(ctx); err != nil {
+				s.logger.Warnf("Failed to publish onion service again: %v", err)
+			} else {
+				s.logger.Infof("Published onion service %s.onion again", s.serviceID)
+			}
+			cancel()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Close stops maintaining the service and removes it from Tor.
+func (s *Service) Close() error {
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	conn := s.conn
+	s.conn = nil
+	return conn.Close()
+}
+
+// saveKey atomically writes an onion service key, readable only by the
+// owner since it controls the service's address.
+func saveKey(path, key string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("failed to create onion key directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(key+"\n"), 0o600); err != nil {
+		return fmt.Errorf("failed to write onion key: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write onion key: %w", err)
+	}
+	return nil
+}
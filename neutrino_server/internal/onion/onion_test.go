@@ -0,0 +1,240 @@
+package onion
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btclog"
+)
+
+// fakeTor is a Tor control port answering the commands the package uses.
+type fakeTor struct {
+	t        *testing.T
+	listener net.Listener
+	methods  string
+	cookie   []byte
+	password string
+
+	mu    sync.Mutex
+	added []string
+	conns []net.Conn
+}
+
+func newFakeTor(t *testing.T, methods string) *fakeTor {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeTor{t: t, listener: listener, methods: methods}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns = append(f.conns, conn)
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeTor) serve(conn net.Conn) {
+	defer conn.Close()
+	cookieFile := filepath.Join(f.t.TempDir(), "control_auth_cookie")
+	if f.cookie != nil {
+		os.WriteFile(cookieFile, f.cookie, 0o600)
+	}
+
+	authenticated := false
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "PROTOCOLINFO 1":
+			fmt.Fprintf(conn, "250-PROTOCOLINFO 1\r\n250-AUTH METHODS=%s COOKIEFILE=%q\r\n250-VERSION Tor=\"0.4.8.10\"\r\n250 OK\r\n", f.methods, cookieFile)
+		case strings.HasPrefix(line, "AUTHENTICATE"):
+			secret := strings.TrimSpace(strings.TrimPrefix(line, "AUTHENTICATE"))
+			switch {
+			case f.password != "" && secret == quote(f.password),
+				f.cookie != nil && secret == hex.EncodeToString(f.cookie),
+				f.password == "" && f.cookie == nil:
+				authenticated = true
+				fmt.Fprint(conn, "250 OK\r\n")
+			default:
+				fmt.Fprint(conn, "515 Authentication failed\r\n")
+			}
+		case !authenticated:
+			fmt.Fprint(conn, "514 Authentication required.\r\n")
+		case strings.HasPrefix(line, "ADD_ONION "):
+			f.mu.Lock()
+			f.added = append(f.added, line)
+			f.mu.Unlock()
+			if strings.HasPrefix(line, "ADD_ONION NEW:ED25519-V3 ") {
+				fmt.Fprint(conn, "250-ServiceID=abcdefghijklmnopqrstuvwxyz234567abcdefghijklmnopqrstuvwx\r\n250-PrivateKey=ED25519-V3:c2VjcmV0\r\n250 OK\r\n")
+			} else {
+				fmt.Fprint(conn, "250-ServiceID=abcdefghijklmnopqrstuvwxyz234567abcdefghijklmnopqrstuvwx\r\n250 OK\r\n")
+			}
+		case line == "GETINFO version":
+			fmt.Fprint(conn, "250-version=0.4.8.10\r\n250 OK\r\n")
+		default:
+			fmt.Fprint(conn, "510 Unrecognized command\r\n")
+		}
+	}
+}
+
+// dropConnections closes every control connection, as a Tor restart does.
+func (f *fakeTor) dropConnections() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+	f.conns = nil
+}
+
+func (f *fakeTor) addCommands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.added...)
+}
+
+func TestPublish(t *testing.T) {
+	tor := newFakeTor(t, "COOKIE,SAFECOOKIE")
+	tor.cookie = []byte("0123456789abcdef0123456789abcdef")
+	cfg := Config{
+		ControlAddr: tor.listener.Addr().String(),
+		KeyPath:     filepath.Join(t.TempDir(), "onion", "api.key"),
+		Port:        8334,
+		Target:      "127.0.0.1:8334",
+	}
+
+	service, err := Publish(context.Background(), cfg, btclog.Disabled)
+	if err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if want := "abcdefghijklmnopqrstuvwxyz234567abcdefghijklmnopqrstuvwx.onion:8334"; service.Address() != want {
+		t.Errorf("Address() = %s, want %s", service.Address(), want)
+	}
+	if err := service.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+
+	key, err := os.ReadFile(cfg.KeyPath)
+	if err != nil || strings.TrimSpace(string(key)) != "ED25519-V3:c2VjcmV0" {
+		t.Fatalf("saved key = %q, %v", key, err)
+	}
+	if info, _ := os.Stat(cfg.KeyPath); info.Mode().Perm() != 0o600 {
+		t.Errorf("key file mode = %o, want 600", info.Mode().Perm())
+	}
+
+	// The saved key keeps the address across restarts
+	service, err = Publish(context.Background(), cfg, btclog.Disabled)
+	if err != nil {
+		t.Fatalf("second Publish() error = %v", err)
+	}
+	service.Close()
+	added := tor.addCommands()
+	if len(added) != 2 || added[0] != "ADD_ONION NEW:ED25519-V3 Port=8334,127.0.0.1:8334" ||
+		added[1] != "ADD_ONION ED25519-V3:c2VjcmV0 Port=8334,127.0.0.1:8334" {
+		t.Errorf("ADD_ONION commands = %q", added)
+	}
+}
+
+func TestPublishAgain(t *testing.T) {
+	interval := checkInterval
+	checkInterval = 10 * time.Millisecond
+	defer func() { checkInterval = interval }()
+
+	tor := newFakeTor(t, "NULL")
+	service, err := Publish(context.Background(), Config{
+		ControlAddr: tor.listener.Addr().String(),
+		KeyPath:     filepath.Join(t.TempDir(), "api.key"),
+		Port:        80,
+		Target:      "127.0.0.1:8334",
+	}, btclog.Disabled)
+	if err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	defer service.Close()
+
+	tor.dropConnections()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(tor.addCommands()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("service not published again after the control connection was lost")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPublishErrors(t *testing.T) {
+	passwordTor := newFakeTor(t, "HASHEDPASSWORD")
+	passwordTor.password = "hunter2"
+	keyPath := filepath.Join(t.TempDir(), "api.key")
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"password required", Config{ControlAddr: passwordTor.listener.Addr().String()}, "needs a password"},
+		{"wrong password", Config{ControlAddr: passwordTor.listener.Addr().String(), ControlPassword: "wrong"}, "authentication failed"},
+		{"no control port", Config{ControlAddr: "127.0.0.1:1"}, "failed to connect"},
+		{"invalid port", Config{ControlAddr: passwordTor.listener.Addr().String(), Port: 70000}, "invalid onion port"},
+		{"invalid target", Config{ControlAddr: passwordTor.listener.Addr().String(), Target: "localhost"}, "invalid onion target"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.KeyPath = keyPath
+			if cfg.Port == 0 {
+				cfg.Port = 80
+			}
+			if cfg.Target == "" {
+				cfg.Target = "127.0.0.1:8334"
+			}
+			_, err := Publish(context.Background(), cfg, btclog.Disabled)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Publish() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	service, err := Publish(context.Background(), Config{
+		ControlAddr:     passwordTor.listener.Addr().String(),
+		ControlPassword: "hunter2",
+		KeyPath:         keyPath,
+		Port:            80,
+		Target:          "127.0.0.1:8334",
+	}, btclog.Disabled)
+	if err != nil {
+		t.Fatalf("Publish() with the password error = %v", err)
+	}
+	service.Close()
+}
+
+func TestSplitFields(t *testing.T) {
+	got := splitFields(`METHODS=COOKIE,SAFECOOKIE COOKIEFILE="/var/lib/tor/control auth \"cookie\""`)
+	if len(got) != 2 || unquote(strings.TrimPrefix(got[1], "COOKIEFILE=")) != `/var/lib/tor/control auth "cookie"` {
+		t.Errorf("splitFields() = %q", got)
+	}
+}
@@ -0,0 +1,198 @@
+// Package scancache implements the stores neutrino.ScanCache shares scan
+// results through: an in-memory cache for a single node, and Redis for
+// nodes behind a load balancer, which then scan each script and height
+// range once between them.
+package scancache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	neturl "net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultMemoryEntries bounds the entries an in-memory cache holds.
+const DefaultMemoryEntries = 100000
+
+// redisBatchSize bounds the keys of one MGET.
+const redisBatchSize = 1000
+
+// Cache stores values under keys until they expire. Keys are read and
+// written in batches, which Redis answers in a round trip.
+type Cache interface {
+	// Get returns the values stored under keys, nil for keys without one.
+	Get(ctx context.Context, keys []string) ([][]byte, error)
+
+	// Set stores values under their keys.
+	Set(ctx context.Context, values map[string][]byte) error
+
+	// Close releases the cache's connections.
+	Close() error
+}
+
+// Open opens the cache named by url: memory for an in-memory cache, or a
+// redis:// or rediss:// URL, such as redis://:password@host:6379/0. Values
+// expire after ttl; zero keeps them until evicted.
+func Open(url string, ttl time.Duration) (Cache, error) {
+	switch {
+	case url == "memory":
+		return NewMemory(DefaultMemoryEntries, ttl), nil
+	case strings.HasPrefix(url, "redis://"), strings.HasPrefix(url, "rediss://"):
+		options, err := redis.ParseURL(url)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scan cache URL: %w", err)
+		}
+		return NewRedis(redis.NewClient(options), ttl), nil
+	default:
+		return nil, fmt.Errorf("invalid scan cache %q: use memory or redis://host:port", url)
+	}
+}
+
+// Redact returns url with its password masked, for logging.
+func Redact(url string) string {
+	parsed, err := neturl.Parse(url)
+	if err != nil {
+		return "<invalid URL>"
+	}
+	return parsed.Redacted()
+}
+
+// Memory is an in-memory cache evicting the least recently used entries.
+type Memory struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// memoryEntry is an entry of a Memory cache.
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemory returns an in-memory cache holding up to maxEntries values for
+// ttl each.
+func NewMemory(maxEntries int, ttl time.Duration) *Memory {
+	return &Memory{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Get implements Cache.
+func (m *Memory) Get(_ context.Context, keys []string) ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		elem, ok := m.entries[key]
+		if !ok {
+			continue
+		}
+		entry := elem.Value.(*memoryEntry)
+		if !entry.expires.IsZero() && now.After(entry.expires) {
+			m.order.Remove(elem)
+			delete(m.entries, key)
+			continue
+		}
+		m.order.MoveToFront(elem)
+		values[i] = entry.value
+	}
+	return values, nil
+}
+
+// Set implements Cache.
+func (m *Memory) Set(_ context.Context, values map[string][]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expires time.Time
+	if m.ttl > 0 {
+		expires = time.Now().Add(m.ttl)
+	}
+	for key, value := range values {
+		entry := &memoryEntry{key: key, value: value, expires: expires}
+		if elem, ok := m.entries[key]; ok {
+			elem.Value = entry
+			m.order.MoveToFront(elem)
+			continue
+		}
+		m.entries[key] = m.order.PushFront(entry)
+	}
+	for m.order.Len() > m.maxEntries {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
+
+// Close implements Cache.
+func (m *Memory) Close() error {
+	return nil
+}
+
+// Redis is a cache stored in Redis.
+type Redis struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedis returns a cache storing values in client for ttl each.
+func NewRedis(client *redis.Client, ttl time.Duration) *Redis {
+	return &Redis{client: client, ttl: ttl}
+}
+
+// Get implements Cache.
+func (r *Redis) Get(ctx context.Context, keys []string) ([][]byte, error) {
+	values := make([][]byte, 0, len(keys))
+	for batch := range slices.Chunk(keys, redisBatchSize) {
+		results, err := r.client.MGet(ctx, batch...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			// Keys without a value are returned as nil
+			value, ok := result.(string)
+			if !ok {
+				values = append(values, nil)
+				continue
+			}
+			values = append(values, []byte(value))
+		}
+	}
+	return values, nil
+}
+
+// Set implements Cache.
+func (r *Redis) Set(ctx context.Context, values map[string][]byte) error {
+	if len(values) == 0 {
+		return nil
+	}
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, value := range values {
+			pipe.Set(ctx, key, value, r.ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// Close implements Cache.
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
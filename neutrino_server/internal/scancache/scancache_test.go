@@ -0,0 +1,220 @@
+package scancache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "memory"},
+		{url: "redis://localhost:6379/0"},
+		{url: "rediss://:secret@localhost:6380"},
+		{url: "redis://localhost:6379/notadb", wantErr: true},
+		{url: "memcached://localhost", wantErr: true},
+		{url: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			cache, err := Open(tt.url, time.Minute)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Open(%q) error = %v, want error %t", tt.url, err, tt.wantErr)
+			}
+			if cache != nil {
+				cache.Close()
+			}
+		})
+	}
+}
+
+// get reads keys from cache, failing the test on an error.
+func get(t *testing.T, cache Cache, keys ...string) []string {
+	t.Helper()
+	values, err := cache.Get(context.Background(), keys)
+	if err != nil {
+		t.Fatalf("Get(%v) failed: %v", keys, err)
+	}
+	if len(values) != len(keys) {
+		t.Fatalf("Get(%v) returned %d values", keys, len(values))
+	}
+	got := make([]string, len(values))
+	for i, value := range values {
+		got[i] = "<nil>"
+		if value != nil {
+			got[i] = string(value)
+		}
+	}
+	return got
+}
+
+func TestRedact(t *testing.T) {
+	for url, want := range map[string]string{
+		"memory":                           "memory",
+		"redis://:secret@localhost:6379/0": "redis://:xxxxx@localhost:6379/0",
+		"redis://localhost:6379":           "redis://localhost:6379",
+	} {
+		if got := Redact(url); got != want {
+			t.Errorf("Redact(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemory(2, 0)
+
+	cache.Set(ctx, map[string][]byte{"a": []byte("1")})
+	cache.Set(ctx, map[string][]byte{"b": []byte("2")})
+	// Reading a makes b the least recently used entry, which c evicts
+	if got := get(t, cache, "a"); got[0] != "1" {
+		t.Fatalf("Get(a) = %v, want 1", got)
+	}
+	cache.Set(ctx, map[string][]byte{"c": []byte("3")})
+	if got := get(t, cache, "a", "b", "c"); !slices.Equal(got, []string{"1", "<nil>", "3"}) {
+		t.Errorf("Get(a, b, c) = %v, want b evicted", got)
+	}
+
+	cache.Set(ctx, map[string][]byte{"a": []byte("4")})
+	if got := get(t, cache, "a"); got[0] != "4" {
+		t.Errorf("Get(a) after overwriting = %v, want 4", got)
+	}
+}
+
+func TestMemoryExpiry(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemory(10, time.Millisecond)
+	cache.Set(ctx, map[string][]byte{"a": []byte("1")})
+	time.Sleep(5 * time.Millisecond)
+	if got := get(t, cache, "a"); got[0] != "<nil>" {
+		t.Errorf("Get() = %v, want the entry expired", got)
+	}
+	if len(cache.entries) != 0 {
+		t.Errorf("expired entry was not removed, %d entries left", len(cache.entries))
+	}
+}
+
+// fakeRedis serves MGET and SET over the Redis protocol, answering other
+// commands with an error, as a server too old for them would.
+type fakeRedis struct {
+	mu     sync.Mutex
+	values map[string]string
+	ttls   map[string]string
+}
+
+// serve starts the server and returns its address.
+func (f *fakeRedis) serve(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.handle(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		switch strings.ToUpper(args[0]) {
+		case "MGET":
+			fmt.Fprintf(conn, "*%d\r\n", len(args)-1)
+			for _, key := range args[1:] {
+				if value, ok := f.values[key]; ok {
+					fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(value), value)
+				} else {
+					io.WriteString(conn, "$-1\r\n")
+				}
+			}
+		case "SET":
+			f.values[args[1]] = args[2]
+			f.ttls[args[1]] = strings.Join(args[3:], " ")
+			io.WriteString(conn, "+OK\r\n")
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+		f.mu.Unlock()
+	}
+}
+
+// readCommand reads a command sent as an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || line[0] != '*' {
+		return nil, fmt.Errorf("unexpected %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func TestRedis(t *testing.T) {
+	ctx := context.Background()
+	server := &fakeRedis{values: make(map[string]string), ttls: make(map[string]string)}
+	cache := NewRedis(redis.NewClient(&redis.Options{Addr: server.serve(t)}), time.Hour)
+	defer cache.Close()
+
+	if got := get(t, cache, "missing"); got[0] != "<nil>" {
+		t.Fatalf("Get(missing) = %v, want no value", got)
+	}
+	err := cache.Set(ctx, map[string][]byte{"key": []byte("[1,2,3]"), "empty": []byte("[]")})
+	if err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if got := get(t, cache, "key", "missing", "empty"); !slices.Equal(got, []string{"[1,2,3]", "<nil>", "[]"}) {
+		t.Fatalf("Get() = %v, want [1,2,3], nothing and []", got)
+	}
+	if ttl := server.ttls["key"]; ttl != "ex 3600" {
+		t.Errorf("Set() sent expiry %q, want ex 3600", ttl)
+	}
+
+	// Reads of more keys than fit one MGET are split
+	keys := make([]string, redisBatchSize+5)
+	for i := range keys {
+		keys[i] = "key"
+	}
+	if got := get(t, cache, keys...); got[redisBatchSize+4] != "[1,2,3]" {
+		t.Errorf("Get() of %d keys = ..., %s, want [1,2,3] last", len(keys), got[redisBatchSize+4])
+	}
+}
@@ -0,0 +1,671 @@
+package sqlitedb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcwallet/walletdb"
+	_ "modernc.org/sqlite" // Register the SQLite database/sql driver
+)
+
+// The limits bbolt puts on keys and values, which the driver keeps so that
+// databases migrate between the two.
+const (
+	maxKeySize   = 32768
+	maxValueSize = (1 << 31) - 2
+)
+
+// forEachPageSize is how many keys ForEach reads from the database at once.
+const forEachPageSize = 1000
+
+// schema stores every key of every bucket in one table. A row is either a
+// value or, with a bucket ID, a nested bucket whose keys are the rows with
+// that ID as their parent. Top-level buckets have parent 0. SQLite orders
+// blobs like bytes.Compare, as bbolt orders keys.
+const schema = `CREATE TABLE IF NOT EXISTS kv (
+	parent   INTEGER NOT NULL,
+	key      BLOB NOT NULL,
+	value    BLOB,
+	bucket   INTEGER UNIQUE,
+	sequence INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (parent, key)
+) WITHOUT ROWID`
+
+// db is a walletdb.DB backed by a SQLite database. Writes go through a single
+// connection, so that write transactions queue up in the process instead of
+// failing as busy, while reads use their own connections.
+type db struct {
+	path  string
+	lock  *os.File
+	read  *sql.DB
+	write *sql.DB
+}
+
+var _ walletdb.BatchDB = (*db)(nil)
+
+// openDB opens the database at path, creating it if create is set, and
+// switches it to journalMode unless empty.
+func openDB(path string, create bool, timeout time.Duration, journalMode string) (walletdb.DB, error) {
+	if !create {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return nil, walletdb.ErrDbDoesNotExist
+		}
+	}
+	lock, err := lockFile(path+".lock", timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &db{path: path, lock: lock}
+	dsn := fmt.Sprintf("%s?_pragma=busy_timeout(%d)", path, max(timeout.Milliseconds(), 1))
+	d.write, err = sql.Open("sqlite", dsn+"&_txlock=immediate")
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+	d.write.SetMaxOpenConns(1)
+	if err := d.init(journalMode); err != nil {
+		d.Close()
+		return nil, err
+	}
+	d.read, err = sql.Open("sqlite", dsn)
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// init creates the schema and sets the journal mode.
+func (d *db) init(journalMode string) error {
+	if journalMode != "" {
+		if strings.ContainsFunc(journalMode, func(r rune) bool { return (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') }) {
+			return fmt.Errorf("invalid journal mode %q", journalMode)
+		}
+		var mode string
+		if err := d.write.QueryRow("PRAGMA journal_mode = " + journalMode).Scan(&mode); err != nil {
+			return fmt.Errorf("failed to set journal mode %s: %w", journalMode, err)
+		}
+		if !strings.EqualFold(mode, journalMode) {
+			return fmt.Errorf("failed to set journal mode %s, the database stays in %s mode", journalMode, mode)
+		}
+	}
+	if _, err := d.write.Exec(schema); err != nil {
+		return fmt.Errorf("failed to create schema: %w", err)
+	}
+	return nil
+}
+
+// errLocked is returned by tryLock when another process holds the lock.
+var errLocked = errors.New("file is locked")
+
+// lockFile takes an exclusive lock on the file at path, waiting up to
+// timeout for another process to release it. SQLite lets many processes open
+// a database, but the files kept next to it by its users must not be shared.
+func lockFile(path string, timeout time.Duration) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		err := tryLock(f)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, errLocked) || time.Now().After(deadline) {
+			f.Close()
+			if errors.Is(err, errLocked) {
+				return nil, fmt.Errorf("timeout waiting for the lock on %s", path)
+			}
+			return nil, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// BeginReadTx opens a database read transaction.
+func (d *db) BeginReadTx() (walletdb.ReadTx, error) {
+	tx, err := d.read.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &transaction{sqlTx: tx}, nil
+}
+
+// BeginReadWriteTx opens a database read+write transaction.
+func (d *db) BeginReadWriteTx() (walletdb.ReadWriteTx, error) {
+	tx, err := d.write.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &transaction{sqlTx: tx, writable: true}, nil
+}
+
+// Copy writes a consistent copy of the database to w, without blocking
+// writes.
+func (d *db) Copy(w io.Writer) error {
+	tmp, err := os.CreateTemp(filepath.Dir(d.path), filepath.Base(d.path)+".copy-*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	os.Remove(tmp.Name())
+	defer os.Remove(tmp.Name())
+
+	if _, err := d.read.Exec("VACUUM INTO ?", tmp.Name()); err != nil {
+		return fmt.Errorf("failed to copy database: %w", err)
+	}
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Batch runs f in a read+write transaction. SQLite has no cheaper way to
+// group concurrent writes.
+func (d *db) Batch(f func(tx walletdb.ReadWriteTx) error) error {
+	return walletdb.Update(d, f)
+}
+
+// Close closes the database and releases its lock.
+func (d *db) Close() error {
+	var err error
+	for _, pool := range []*sql.DB{d.read, d.write} {
+		if pool == nil {
+			continue
+		}
+		if closeErr := pool.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if d.lock != nil {
+		d.lock.Close()
+		d.lock = nil
+	}
+	return err
+}
+
+// transaction is a walletdb transaction on a SQLite transaction.
+type transaction struct {
+	sqlTx    *sql.Tx
+	writable bool
+	closed   bool
+	onCommit []func()
+
+	// stmts are the statements prepared in the transaction by their query.
+	stmts map[string]*sql.Stmt
+
+	// err is the first error of a method that cannot return one, which
+	// Commit returns instead of committing.
+	err error
+}
+
+// fail records err for Commit to return.
+func (tx *transaction) fail(err error) {
+	if tx.err == nil {
+		tx.err = err
+	}
+}
+
+// stmt returns query prepared in the transaction. Transactions run the
+// same few queries many times, which SQLite then parses once.
+func (tx *transaction) stmt(query string) (*sql.Stmt, error) {
+	if stmt, ok := tx.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := tx.sqlTx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	if tx.stmts == nil {
+		tx.stmts = make(map[string]*sql.Stmt)
+	}
+	tx.stmts[query] = stmt
+	return stmt, nil
+}
+
+func (tx *transaction) query(query string, args ...any) (*sql.Rows, error) {
+	stmt, err := tx.stmt(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Query(args...)
+}
+
+// queryRow runs query for a single row. Preparing errors surface from Scan,
+// as they do for QueryRow, if the statement is run through the transaction.
+func (tx *transaction) queryRow(query string, args ...any) *sql.Row {
+	stmt, err := tx.stmt(query)
+	if err != nil {
+		return tx.sqlTx.QueryRow(query, args...)
+	}
+	return stmt.QueryRow(args...)
+}
+
+func (tx *transaction) exec(query string, args ...any) (sql.Result, error) {
+	stmt, err := tx.stmt(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Exec(args...)
+}
+
+// root returns the bucket holding the top-level buckets.
+func (tx *transaction) root() *bucket {
+	return &bucket{tx: tx, id: 0}
+}
+
+func (tx *transaction) ReadBucket(key []byte) walletdb.ReadBucket {
+	if b := tx.root().nested(key); b != nil {
+		return b
+	}
+	return nil
+}
+
+func (tx *transaction) ForEachBucket(fn func(key []byte) error) error {
+	return tx.root().ForEach(func(k, v []byte) error {
+		if v != nil {
+			return nil
+		}
+		return fn(k)
+	})
+}
+
+func (tx *transaction) ReadWriteBucket(key []byte) walletdb.ReadWriteBucket {
+	if b := tx.root().nested(key); b != nil {
+		return b
+	}
+	return nil
+}
+
+func (tx *transaction) CreateTopLevelBucket(key []byte) (walletdb.ReadWriteBucket, error) {
+	return tx.root().CreateBucketIfNotExists(key)
+}
+
+func (tx *transaction) DeleteTopLevelBucket(key []byte) error {
+	return tx.root().DeleteNestedBucket(key)
+}
+
+func (tx *transaction) Commit() error {
+	if tx.closed {
+		return walletdb.ErrTxClosed
+	}
+	if !tx.writable {
+		return walletdb.ErrTxNotWritable
+	}
+	tx.closed = true
+	if tx.err != nil {
+		tx.sqlTx.Rollback()
+		return tx.err
+	}
+	if err := tx.sqlTx.Commit(); err != nil {
+		return err
+	}
+	for _, f := range tx.onCommit {
+		f()
+	}
+	return nil
+}
+
+func (tx *transaction) Rollback() error {
+	if tx.closed {
+		return walletdb.ErrTxClosed
+	}
+	tx.closed = true
+	return tx.sqlTx.Rollback()
+}
+
+func (tx *transaction) OnCommit(f func()) {
+	tx.onCommit = append(tx.onCommit, f)
+}
+
+// bucket is a walletdb bucket, the rows of the kv table with its ID as their
+// parent.
+type bucket struct {
+	tx *transaction
+	id int64
+}
+
+// entry is a key of a bucket, with a nil value if it is a nested bucket.
+type entry struct {
+	key, value []byte
+	bucket     sql.NullInt64
+}
+
+// scan reads the entry of row.
+func (e *entry) scan(row interface{ Scan(...any) error }) error {
+	if err := row.Scan(&e.key, &e.value, &e.bucket); err != nil {
+		return err
+	}
+	if e.bucket.Valid {
+		e.value = nil
+	} else if e.value == nil {
+		e.value = []byte{}
+	}
+	return nil
+}
+
+// lookup returns the entry of key, or nil if the bucket has none.
+func (b *bucket) lookup(key []byte) (*entry, error) {
+	var e entry
+	row := b.tx.queryRow("SELECT key, value, bucket FROM kv WHERE parent = ? AND key = ?", b.id, key)
+	switch err := e.scan(row); {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	return &e, nil
+}
+
+// nested returns the nested bucket at key, or nil if there is none.
+func (b *bucket) nested(key []byte) *bucket {
+	e, err := b.lookup(key)
+	if err != nil {
+		b.tx.fail(err)
+		return nil
+	}
+	if e == nil || !e.bucket.Valid {
+		return nil
+	}
+	return &bucket{tx: b.tx, id: e.bucket.Int64}
+}
+
+// checkWritable returns an error unless the bucket's transaction can write.
+func (b *bucket) checkWritable() error {
+	switch {
+	case b.tx.closed:
+		return walletdb.ErrTxClosed
+	case !b.tx.writable:
+		return walletdb.ErrTxNotWritable
+	}
+	return nil
+}
+
+func (b *bucket) NestedReadBucket(key []byte) walletdb.ReadBucket {
+	if nested := b.nested(key); nested != nil {
+		return nested
+	}
+	return nil
+}
+
+func (b *bucket) NestedReadWriteBucket(key []byte) walletdb.ReadWriteBucket {
+	if nested := b.nested(key); nested != nil {
+		return nested
+	}
+	return nil
+}
+
+// ForEach calls fn for every key of the bucket in order, with a nil value
+// for nested buckets. It reads the keys a page at a time, so fn may use the
+// transaction but must not modify the bucket.
+func (b *bucket) ForEach(fn func(k, v []byte) error) error {
+	var after []byte
+	for {
+		entries, err := b.page(after)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := fn(e.key, e.value); err != nil {
+				return err
+			}
+		}
+		if len(entries) < forEachPageSize {
+			return nil
+		}
+		after = entries[len(entries)-1].key
+	}
+}
+
+// page returns the next forEachPageSize entries after the key after, from
+// the first if nil.
+func (b *bucket) page(after []byte) ([]entry, error) {
+	query := "SELECT key, value, bucket FROM kv WHERE parent = ? ORDER BY key LIMIT ?"
+	args := []any{b.id, forEachPageSize}
+	if after != nil {
+		query = "SELECT key, value, bucket FROM kv WHERE parent = ? AND key > ? ORDER BY key LIMIT ?"
+		args = []any{b.id, after, forEachPageSize}
+	}
+	rows, err := b.tx.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := e.scan(rows); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (b *bucket) Get(key []byte) []byte {
+	e, err := b.lookup(key)
+	if err != nil {
+		b.tx.fail(err)
+		return nil
+	}
+	if e == nil {
+		return nil
+	}
+	return e.value
+}
+
+func (b *bucket) Put(key, value []byte) error {
+	if err := b.checkWritable(); err != nil {
+		return err
+	}
+	switch {
+	case len(key) == 0:
+		return walletdb.ErrKeyRequired
+	case len(key) > maxKeySize:
+		return walletdb.ErrKeyTooLarge
+	case len(value) > maxValueSize:
+		return walletdb.ErrValueTooLarge
+	}
+	e, err := b.lookup(key)
+	if err != nil {
+		return err
+	}
+	if e != nil && e.bucket.Valid {
+		return walletdb.ErrIncompatibleValue
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	_, err = b.tx.exec(`INSERT INTO kv (parent, key, value) VALUES (?, ?, ?)
+		ON CONFLICT (parent, key) DO UPDATE SET value = excluded.value`, b.id, key, value)
+	return err
+}
+
+func (b *bucket) Delete(key []byte) error {
+	if err := b.checkWritable(); err != nil {
+		return err
+	}
+	e, err := b.lookup(key)
+	if err != nil || e == nil {
+		return err
+	}
+	if e.bucket.Valid {
+		return walletdb.ErrIncompatibleValue
+	}
+	_, err = b.tx.exec("DELETE FROM kv WHERE parent = ? AND key = ?", b.id, key)
+	return err
+}
+
+func (b *bucket) CreateBucket(key []byte) (walletdb.ReadWriteBucket, error) {
+	if err := b.checkWritable(); err != nil {
+		return nil, err
+	}
+	switch {
+	case len(key) == 0:
+		return nil, walletdb.ErrBucketNameRequired
+	case len(key) > maxKeySize:
+		return nil, walletdb.ErrKeyTooLarge
+	}
+	e, err := b.lookup(key)
+	switch {
+	case err != nil:
+		return nil, err
+	case e != nil && e.bucket.Valid:
+		return nil, walletdb.ErrBucketExists
+	case e != nil:
+		return nil, walletdb.ErrIncompatibleValue
+	}
+
+	var id int64
+	if err := b.tx.queryRow("SELECT COALESCE(MAX(bucket), 0) + 1 FROM kv").Scan(&id); err != nil {
+		return nil, err
+	}
+	if _, err := b.tx.exec("INSERT INTO kv (parent, key, bucket) VALUES (?, ?, ?)", b.id, key, id); err != nil {
+		return nil, err
+	}
+	return &bucket{tx: b.tx, id: id}, nil
+}
+
+func (b *bucket) CreateBucketIfNotExists(key []byte) (walletdb.ReadWriteBucket, error) {
+	nested, err := b.CreateBucket(key)
+	if errors.Is(err, walletdb.ErrBucketExists) {
+		return b.nested(key), nil
+	}
+	return nested, err
+}
+
+// DeleteNestedBucket deletes the nested bucket at key and everything in it.
+func (b *bucket) DeleteNestedBucket(key []byte) error {
+	if err := b.checkWritable(); err != nil {
+		return err
+	}
+	if len(key) == 0 {
+		return walletdb.ErrIncompatibleValue
+	}
+	e, err := b.lookup(key)
+	switch {
+	case err != nil:
+		return err
+	case e == nil:
+		return walletdb.ErrBucketNotFound
+	case !e.bucket.Valid:
+		return walletdb.ErrIncompatibleValue
+	}
+	_, err = b.tx.exec(`WITH RECURSIVE tree (id) AS (
+			SELECT ?
+			UNION ALL
+			SELECT kv.bucket FROM kv JOIN tree ON kv.parent = tree.id WHERE kv.bucket IS NOT NULL
+		)
+		DELETE FROM kv WHERE parent IN tree`, e.bucket.Int64)
+	if err != nil {
+		return err
+	}
+	_, err = b.tx.exec("DELETE FROM kv WHERE parent = ? AND key = ?", b.id, key)
+	return err
+}
+
+func (b *bucket) ReadCursor() walletdb.ReadCursor {
+	return &cursor{bucket: b}
+}
+
+func (b *bucket) ReadWriteCursor() walletdb.ReadWriteCursor {
+	return &cursor{bucket: b}
+}
+
+func (b *bucket) Tx() walletdb.ReadWriteTx {
+	return b.tx
+}
+
+func (b *bucket) NextSequence() (uint64, error) {
+	if err := b.checkWritable(); err != nil {
+		return 0, err
+	}
+	var sequence int64
+	err := b.tx.queryRow("UPDATE kv SET sequence = sequence + 1 WHERE bucket = ? RETURNING sequence", b.id).Scan(&sequence)
+	return uint64(sequence), err
+}
+
+func (b *bucket) SetSequence(v uint64) error {
+	if err := b.checkWritable(); err != nil {
+		return err
+	}
+	_, err := b.tx.exec("UPDATE kv SET sequence = ? WHERE bucket = ?", int64(v), b.id)
+	return err
+}
+
+func (b *bucket) Sequence() uint64 {
+	var sequence int64
+	if err := b.tx.queryRow("SELECT sequence FROM kv WHERE bucket = ?", b.id).Scan(&sequence); err != nil {
+		b.tx.fail(err)
+	}
+	return uint64(sequence)
+}
+
+// cursor is a walletdb cursor over the keys of a bucket, positioned at key.
+type cursor struct {
+	bucket *bucket
+	key    []byte
+}
+
+// move positions the cursor at the entry the query condition and order
+// select, or past the end.
+func (c *cursor) move(condition, order string, args ...any) ([]byte, []byte) {
+	var e entry
+	query := "SELECT key, value, bucket FROM kv WHERE parent = ?" + condition + " ORDER BY key " + order + " LIMIT 1"
+	err := e.scan(c.bucket.tx.queryRow(query, append([]any{c.bucket.id}, args...)...))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			c.bucket.tx.fail(err)
+		}
+		c.key = nil
+		return nil, nil
+	}
+	c.key = e.key
+	return e.key, e.value
+}
+
+func (c *cursor) First() ([]byte, []byte) {
+	return c.move("", "ASC")
+}
+
+func (c *cursor) Last() ([]byte, []byte) {
+	return c.move("", "DESC")
+}
+
+func (c *cursor) Next() ([]byte, []byte) {
+	if c.key == nil {
+		return nil, nil
+	}
+	return c.move(" AND key > ?", "ASC", c.key)
+}
+
+func (c *cursor) Prev() ([]byte, []byte) {
+	if c.key == nil {
+		return nil, nil
+	}
+	return c.move(" AND key < ?", "DESC", c.key)
+}
+
+func (c *cursor) Seek(seek []byte) ([]byte, []byte) {
+	return c.move(" AND key >= ?", "ASC", seek)
+}
+
+// Delete deletes the key at the cursor, which stays there so that Next
+// moves on to the key after it.
+func (c *cursor) Delete() error {
+	if c.key == nil {
+		return nil
+	}
+	return c.bucket.Delete(c.key)
+}
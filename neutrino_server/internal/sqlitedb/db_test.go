@@ -0,0 +1,138 @@
+package sqlitedb
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcwallet/walletdb"
+	"github.com/btcsuite/btcwallet/walletdb/walletdbtest"
+)
+
+func TestInterface(t *testing.T) {
+	for _, mode := range []string{"wal", "delete"} {
+		t.Run(mode, func(t *testing.T) {
+			walletdbtest.TestInterface(t, dbType, filepath.Join(t.TempDir(), "db.sqlite"), time.Second, mode)
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.sqlite")
+	if _, err := walletdb.Open(dbType, path, time.Second, ""); err != walletdb.ErrDbDoesNotExist {
+		t.Errorf("Open() of a missing database = %v, want %v", err, walletdb.ErrDbDoesNotExist)
+	}
+	db, err := walletdb.Create(dbType, path, time.Second, "wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process, or another open in this one, waits for the lock
+	if second, err := walletdb.Open(dbType, path, 100*time.Millisecond, ""); err == nil {
+		second.Close()
+		t.Error("Open() of a database in use succeeded")
+	}
+	if _, err := walletdb.Create(dbType, path, time.Second, "bogus;"); err == nil {
+		t.Error("Create() with an invalid journal mode succeeded")
+	}
+	db.Close()
+
+	db, err = walletdb.Open(dbType, path, time.Second, "")
+	if err != nil {
+		t.Fatalf("Open() after Close() failed: %v", err)
+	}
+	db.Close()
+}
+
+func TestCursor(t *testing.T) {
+	db, err := walletdb.Create(dbType, filepath.Join(t.TempDir(), "db.sqlite"), time.Second, "wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	keys := [][]byte{{0}, {0, 0}, {1}, {1, 0xff}, {0xff}}
+	err = walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		bucket, err := tx.CreateTopLevelBucket([]byte("keys"))
+		if err != nil {
+			return err
+		}
+		for _, k := range keys[1:] {
+			if err := bucket.Put(k, k); err != nil {
+				return err
+			}
+		}
+		_, err = bucket.CreateBucket(keys[0])
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = walletdb.View(db, func(tx walletdb.ReadTx) error {
+		c := tx.ReadBucket([]byte("keys")).ReadCursor()
+		var got [][]byte
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if (v == nil) != bytes.Equal(k, keys[0]) {
+				t.Errorf("key %x has value %x", k, v)
+			}
+			got = append(got, k)
+		}
+		if len(got) != len(keys) {
+			t.Fatalf("cursor visited %x, want %x", got, keys)
+		}
+		for i := range keys {
+			if !bytes.Equal(got[i], keys[i]) {
+				t.Errorf("cursor visited %x, want %x", got, keys)
+			}
+		}
+
+		if k, _ := c.Seek([]byte{}); !bytes.Equal(k, keys[0]) {
+			t.Errorf("Seek(empty) = %x, want %x", k, keys[0])
+		}
+		if k, _ := c.Seek([]byte{1, 1}); !bytes.Equal(k, keys[3]) {
+			t.Errorf("Seek(0101) = %x, want %x", k, keys[3])
+		}
+		if k, _ := c.Prev(); !bytes.Equal(k, keys[2]) {
+			t.Errorf("Prev() = %x, want %x", k, keys[2])
+		}
+		if k, _ := c.Last(); !bytes.Equal(k, keys[4]) {
+			t.Errorf("Last() = %x, want %x", k, keys[4])
+		}
+		if k, _ := c.Next(); k != nil {
+			t.Errorf("Next() past the end = %x", k)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	dir := t.TempDir()
+	db, err := walletdb.Create(dbType, filepath.Join(dir, "db.sqlite"), time.Second, "wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		bucket, err := tx.CreateTopLevelBucket([]byte("bucket"))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte("key"), []byte("value"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var copied bytes.Buffer
+	if err := db.Copy(&copied); err != nil {
+		t.Fatalf("Copy() failed: %v", err)
+	}
+	if !bytes.HasPrefix(copied.Bytes(), []byte("SQLite format 3\x00")) {
+		t.Fatalf("Copy() wrote %d bytes that are no SQLite database", copied.Len())
+	}
+}
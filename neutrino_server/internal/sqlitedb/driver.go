@@ -0,0 +1,60 @@
+// Package sqlitedb implements a walletdb driver storing buckets and keys in a
+// SQLite database, an alternative to bbolt that copes with network file
+// systems and can be inspected with the sqlite3 shell.
+//
+// The driver registers as "sqlite" and takes the database path, how long to
+// wait for another process to release the database, and the SQLite journal
+// mode to switch the database to, empty to keep the current one.
+package sqlitedb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcwallet/walletdb"
+)
+
+const dbType = "sqlite"
+
+// parseArgs parses the arguments of walletdb.Open and walletdb.Create.
+func parseArgs(funcName string, args ...any) (string, time.Duration, string, error) {
+	if len(args) != 3 {
+		return "", 0, "", fmt.Errorf("invalid arguments to %s.%s -- expected database path, timeout and journal mode", dbType, funcName)
+	}
+	path, ok := args[0].(string)
+	if !ok {
+		return "", 0, "", fmt.Errorf("first argument to %s.%s is invalid -- expected database path string", dbType, funcName)
+	}
+	timeout, ok := args[1].(time.Duration)
+	if !ok {
+		return "", 0, "", fmt.Errorf("second argument to %s.%s is invalid -- expected timeout time.Duration", dbType, funcName)
+	}
+	journalMode, ok := args[2].(string)
+	if !ok {
+		return "", 0, "", fmt.Errorf("third argument to %s.%s is invalid -- expected journal mode string", dbType, funcName)
+	}
+	return path, timeout, journalMode, nil
+}
+
+func init() {
+	driver := walletdb.Driver{
+		DbType: dbType,
+		Create: func(args ...any) (walletdb.DB, error) {
+			path, timeout, journalMode, err := parseArgs("Create", args...)
+			if err != nil {
+				return nil, err
+			}
+			return openDB(path, true, timeout, journalMode)
+		},
+		Open: func(args ...any) (walletdb.DB, error) {
+			path, timeout, journalMode, err := parseArgs("Open", args...)
+			if err != nil {
+				return nil, err
+			}
+			return openDB(path, false, timeout, journalMode)
+		},
+	}
+	if err := walletdb.RegisterDriver(driver); err != nil {
+		panic(fmt.Sprintf("failed to register database driver %q: %v", dbType, err))
+	}
+}
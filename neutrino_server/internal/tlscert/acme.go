@@ -0,0 +1,82 @@
+package tlscert
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ACMEConfig configures certificates provisioned by an ACME CA such as
+// Let's Encrypt.
+type ACMEConfig struct {
+	// Domains are the names certificates are requested for. Requests for
+	// any other name are refused, so the CA is never asked for names the
+	// node does not serve.
+	Domains []string
+
+	// Email is given to the CA for expiry and revocation notices.
+	Email string
+
+	// CacheDir stores the account key and certificates across restarts,
+	// so they are renewed rather than requested anew.
+	CacheDir string
+
+	// DirectoryURL is the CA's directory, Let's Encrypt's production
+	// directory if empty.
+	DirectoryURL string
+}
+
+// NewACMEManager returns a manager that provisions certificates for the
+// domains of cfg on their first TLS handshake and renews them before they
+// expire. The manager answers TLS-ALPN-01 challenges itself; HTTP-01
+// challenges need its HTTPHandler served on port 80.
+func NewACMEManager(cfg ACMEConfig) (*autocert.Manager, error) {
+	var domains []string
+	for _, domain := range cfg.Domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" {
+			continue
+		}
+		if net.ParseIP(domain) != nil || !strings.Contains(domain, ".") || strings.ContainsAny(domain, "/:*") {
+			return nil, fmt.Errorf("invalid ACME domain %q: must be a fully qualified domain name", domain)
+		}
+		domains = append(domains, domain)
+	}
+	if len(domains) == 0 {
+		return nil, errors.New("no ACME domain given")
+	}
+	if cfg.CacheDir == "" {
+		return nil, errors.New("no ACME cache directory given")
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cfg.CacheDir),
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Email:      cfg.Email,
+	}
+	if cfg.DirectoryURL != "" {
+		manager.Client = &acme.Client{DirectoryURL: cfg.DirectoryURL}
+	}
+	return manager, nil
+}
+
+// RedirectHandler redirects plain HTTP requests to the same URL over HTTPS
+// on port.
+func RedirectHandler(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,78 @@
+package tlscert
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewACMEManager(t *testing.T) {
+	tests := []struct {
+		name    string
+		domains []string
+		wantErr bool
+	}{
+		{"single domain", []string{"node.example.com"}, false},
+		{"trimmed domains", []string{" Node.Example.com", "api.example.com "}, false},
+		{"no domains", nil, true},
+		{"blank domain", []string{""}, true},
+		{"IP address", []string{"203.0.113.7"}, true},
+		{"unqualified name", []string{"localhost"}, true},
+		{"wildcard", []string{"*.example.com"}, true},
+		{"with port", []string{"node.example.com:443"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewACMEManager(ACMEConfig{Domains: tt.domains, CacheDir: t.TempDir()})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewACMEManager() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := NewACMEManager(ACMEConfig{Domains: []string{"node.example.com"}}); err == nil {
+		t.Error("NewACMEManager() without a cache directory succeeded")
+	}
+}
+
+func TestACMEHostPolicy(t *testing.T) {
+	manager, err := NewACMEManager(ACMEConfig{Domains: []string{"Node.example.com"}, CacheDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for host, allowed := range map[string]bool{
+		"node.example.com":  true,
+		"other.example.com": false,
+		"203.0.113.7":       false,
+	} {
+		if err := manager.HostPolicy(context.Background(), host); (err == nil) != allowed {
+			t.Errorf("HostPolicy(%s) error = %v, want allowed %v", host, err, allowed)
+		}
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		port string
+		host string
+		want string
+	}{
+		{"8334", "node.example.com", "https://node.example.com:8334/v1/status?verbose=1"},
+		{"8334", "node.example.com:80", "https://node.example.com:8334/v1/status?verbose=1"},
+		{"443", "node.example.com", "https://node.example.com/v1/status?verbose=1"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/v1/status?verbose=1", nil)
+		req.Host = tt.host
+		rr := httptest.NewRecorder()
+		RedirectHandler(tt.port).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusMovedPermanently || rr.Header().Get("Location") != tt.want {
+			t.Errorf("redirect of %s to port %s = %d %s, want %s", tt.host, tt.port, rr.Code, rr.Header().Get("Location"), tt.want)
+		}
+	}
+}
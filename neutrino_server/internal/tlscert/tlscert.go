@@ -0,0 +1,170 @@
+// Package tlscert loads the TLS certificate the REST API is served with,
+// generating a self-signed one when asked to.
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// selfSignedOrganization marks certificates generated by this package, so
+// only those are replaced when they expire.
+const selfSignedOrganization = "neutrinod autogenerated cert"
+
+// selfSignedValidity is how long generated certificates are valid for.
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// Config locates the certificate and key files.
+type Config struct {
+	CertPath string
+	KeyPath  string
+
+	// Generate creates a self-signed certificate when neither file exists,
+	// and replaces an expired one it generated before. Hosts are the DNS
+	// names and IP addresses it is valid for, besides localhost and the
+	// loopback addresses.
+	Generate bool
+	Hosts    []string
+}
+
+// Load returns the certificate of cfg, generating it first if cfg allows.
+// The returned certificate's Leaf is set.
+func Load(cfg Config) (tls.Certificate, error) {
+	if cfg.CertPath == "" || cfg.KeyPath == "" {
+		return tls.Certificate{}, errors.New("both a TLS certificate and a key file are needed")
+	}
+
+	_, certErr := os.Stat(cfg.CertPath)
+	_, keyErr := os.Stat(cfg.KeyPath)
+	missing := errors.Is(certErr, os.ErrNotExist) && errors.Is(keyErr, os.ErrNotExist)
+	if missing && cfg.Generate {
+		if err := generate(cfg, time.Now()); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.CertPath, cfg.KeyPath)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	if cfg.Generate && slices.Equal(cert.Leaf.Subject.Organization, []string{selfSignedOrganization}) &&
+		time.Now().After(cert.Leaf.NotAfter) {
+		if err := generate(cfg, time.Now()); err != nil {
+			return tls.Certificate{}, err
+		}
+		return Load(Config{CertPath: cfg.CertPath, KeyPath: cfg.KeyPath})
+	}
+	return cert, nil
+}
+
+// LoadClientCAs returns the pool of the PEM encoded CA certificates in the
+// file at path, which client certificates must be signed by.
+func LoadClientCAs(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("client CA file %s holds no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+// Fingerprint returns the hex SHA-256 fingerprint of cert, which clients of
+// a self-signed certificate can pin.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// generate writes a self-signed ECDSA P-256 certificate and its key to the
+// files of cfg, valid from now.
+func generate(cfg Config, now time.Time) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate TLS key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return fmt.Errorf("failed to generate certificate serial number: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{selfSignedOrganization},
+			CommonName:   "localhost",
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	for _, host := range cfg.Hosts {
+		host = strings.TrimSpace(host)
+		ip := net.ParseIP(host)
+		switch {
+		case ip != nil && !slices.ContainsFunc(template.IPAddresses, ip.Equal):
+			template.IPAddresses = append(template.IPAddresses, ip)
+		case ip == nil && host != "" && !slices.Contains(template.DNSNames, host):
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create TLS certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode TLS key: %w", err)
+	}
+
+	// The key is written first, so a certificate never exists without it
+	if err := writePEM(cfg.KeyPath, "EC PRIVATE KEY", keyDER, 0o600); err != nil {
+		return err
+	}
+	return writePEM(cfg.CertPath, "CERTIFICATE", der, 0o644)
+}
+
+// writePEM atomically writes a PEM block to path with mode perm, creating
+// its directory if needed.
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("failed to create TLS directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package tlscert
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLoadGenerate(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{
+		CertPath: filepath.Join(dir, "tls", "tls.cert"),
+		KeyPath:  filepath.Join(dir, "tls", "tls.key"),
+		Generate: true,
+		Hosts:    []string{"node.example.com", "203.0.113.7"},
+	}
+
+	cert, err := Load(cfg)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	leaf := cert.Leaf
+	if !slices.Contains(leaf.DNSNames, "localhost") || !slices.Contains(leaf.DNSNames, "node.example.com") {
+		t.Errorf("DNS names = %v", leaf.DNSNames)
+	}
+	if !slices.ContainsFunc(leaf.IPAddresses, func(ip net.IP) bool { return ip.Equal(net.ParseIP("203.0.113.7")) }) {
+		t.Errorf("IP addresses = %v", leaf.IPAddresses)
+	}
+	if err := leaf.VerifyHostname("node.example.com"); err != nil {
+		t.Errorf("VerifyHostname() error = %v", err)
+	}
+	info, err := os.Stat(cfg.KeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("key file mode = %o, want 600", perm)
+	}
+
+	// The generated certificate is kept on the next start
+	again, err := Load(cfg)
+	if err != nil {
+		t.Fatalf("second Load() error = %v", err)
+	}
+	if Fingerprint(again.Leaf) != Fingerprint(leaf) {
+		t.Error("second Load() generated a new certificate")
+	}
+
+	// An expired generated certificate is replaced
+	if err := generate(cfg, time.Now().Add(-2*selfSignedValidity)); err != nil {
+		t.Fatal(err)
+	}
+	renewed, err := Load(cfg)
+	if err != nil {
+		t.Fatalf("Load() of an expired certificate error = %v", err)
+	}
+	if !time.Now().Before(renewed.Leaf.NotAfter) {
+		t.Errorf("renewed certificate expires %v", renewed.Leaf.NotAfter)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := filepath.Join(dir, "tls.cert"), filepath.Join(dir, "tls.key")
+
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"missing key path", Config{CertPath: cert}},
+		{"missing files", Config{CertPath: cert, KeyPath: key}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(tt.cfg); err == nil {
+				t.Error("Load() succeeded")
+			}
+		})
+	}
+
+	// A lone certificate is not replaced, since its key may be elsewhere
+	if err := os.WriteFile(cert, []byte("not a certificate"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(Config{CertPath: cert, KeyPath: key, Generate: true}); err == nil {
+		t.Error("Load() with only a certificate file succeeded")
+	}
+	if data, _ := os.ReadFile(cert); string(data) != "not a certificate" {
+		t.Error("Load() overwrote an existing certificate")
+	}
+}
+
+func TestLoadClientCAs(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{CertPath: filepath.Join(dir, "ca.cert"), KeyPath: filepath.Join(dir, "ca.key"), Generate: true}
+	if _, err := Load(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadClientCAs(cfg.CertPath); err != nil {
+		t.Errorf("LoadClientCAs() error = %v", err)
+	}
+	if _, err := LoadClientCAs(cfg.KeyPath); err == nil {
+		t.Error("LoadClientCAs() of a key file succeeded")
+	}
+	if _, err := LoadClientCAs(filepath.Join(dir, "missing.pem")); err == nil {
+		t.Error("LoadClientCAs() of a missing file succeeded")
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Package tracing exports the OpenTelemetry spans recorded by the API and the
+scan paths of neutrinod over OTLP.
+
+Spans are recorded through the global tracer provider, so until Setup
+installs one they are dropped at almost no cost.
+*/
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// ServiceName identifies neutrinod in exported traces.
+const ServiceName = "neutrinod"
+
+// Config selects where and how many traces are exported.
+type Config struct {
+	// Endpoint is the URL of an OTLP/HTTP collector, such as
+	// http://localhost:4318. Empty disables tracing.
+	Endpoint string
+
+	// SampleRatio is the share of traces started here that are exported,
+	// from 0 to 1. Requests carrying a sampled trace context are always
+	// exported, so a caller's trace is never cut short.
+	SampleRatio float64
+
+	// Version is reported as the service version.
+	Version string
+}
+
+// Setup installs a tracer provider exporting to cfg.Endpoint and the W3C
+// trace context propagator. The returned function flushes pending spans and
+// stops exporting; it does nothing when tracing is disabled.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, fmt.Errorf("invalid trace sample ratio %v: must be between 0 and 1", cfg.SampleRatio)
+	}
+
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: want an http or https URL", cfg.Endpoint)
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", ServiceName),
+		attribute.String("service.version", cfg.Version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,35 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"disabled", Config{SampleRatio: 5}, false},
+		{"enabled", Config{Endpoint: "http://127.0.0.1:4318", SampleRatio: 0.5}, false},
+		{"ratio above one", Config{Endpoint: "http://127.0.0.1:4318", SampleRatio: 1.5}, true},
+		{"negative ratio", Config{Endpoint: "http://127.0.0.1:4318", SampleRatio: -1}, true},
+		{"invalid endpoint", Config{Endpoint: "://collector", SampleRatio: 1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shutdown, err := Setup(context.Background(), tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Setup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if err := shutdown(context.Background()); err != nil {
+				t.Errorf("shutdown() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+// Package node embeds a neutrino light client node and its REST API in
+// another Go program, which then serves the API from its own HTTP server
+// next to its own routes instead of running neutrinod beside it.
+package node
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/btcsuite/btclog"
+	"github.com/gorilla/mux"
+
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/api"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/auth"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/buildinfo"
+	"github.com/yourusername/neutrino-api/neutrino_server/internal/neutrino"
+)
+
+// modulePath is the module this package is built from, whose version the
+// API reports in /v1/info.
+const modulePath = "github.com/yourusername/neutrino-api/neutrino_server"
+
+// Config configures the node as neutrinod's flags do. Network and DataDir
+// are required; Logger defaults to discarding logs.
+type Config = neutrino.Config
+
+// The types of Config's fields.
+type (
+	ReadinessConfig = neutrino.ReadinessConfig
+	FeeConfig       = neutrino.FeeConfig
+	RetentionConfig = neutrino.RetentionConfig
+	Checkpoint      = neutrino.Checkpoint
+	ScanMode        = neutrino.ScanMode
+	ScanCache       = neutrino.ScanCache
+)
+
+// Scan modes of Config.ScanMode.
+const (
+	ScanLenient = neutrino.ScanLenient
+	ScanStrict  = neutrino.ScanStrict
+)
+
+// Database backends of Config.DBBackend.
+const (
+	DBBackendBolt   = neutrino.DBBackendBolt
+	DBBackendSQLite = neutrino.DBBackendSQLite
+	DBBackendMemory = neutrino.DBBackendMemory
+)
+
+// The types of APIConfig's fields.
+type (
+	RateLimitConfig   = api.RateLimitConfig
+	ConcurrencyConfig = api.ConcurrencyConfig
+	TimeoutConfig     = api.TimeoutConfig
+)
+
+// APIConfig configures the REST API as neutrinod's flags do.
+type APIConfig struct {
+	// BasePath is the path prefix the API is served under, such as
+	// /neutrino, or empty for the root.
+	BasePath string
+
+	// APIKeysFile names the JSON file of API keys and their scopes. When
+	// set, every request except the health probes needs a key.
+	APIKeysFile string
+
+	// TrustedProxies are the IP addresses and CIDR ranges of reverse
+	// proxies whose X-Forwarded-For and X-Real-IP headers are trusted.
+	TrustedProxies []string
+
+	RateLimits  RateLimitConfig
+	Concurrency ConcurrencyConfig
+
+	// Timeouts should be those of the server serving the API, which scans
+	// derive their deadlines from. Server applies them to an http.Server.
+	Timeouts TimeoutConfig
+
+	// MaxBodyBytes bounds request bodies; zero or less removes the bound.
+	MaxBodyBytes int64
+
+	// SwaggerUI serves a Swagger UI page at /docs, loading its scripts and
+	// styles from SwaggerUIDir, an unpacked swagger-ui-dist package.
+	SwaggerUI    bool
+	SwaggerUIDir string
+}
+
+// DefaultAPIConfig returns the API configuration neutrinod runs with by
+// default.
+func DefaultAPIConfig() APIConfig {
+	return APIConfig{
+		Concurrency: ConcurrencyConfig{
+			MaxConcurrent: api.DefaultMaxConcurrentScans,
+			MaxQueued:     api.DefaultMaxQueuedScans,
+		},
+		Timeouts:     api.DefaultTimeouts(),
+		MaxBodyBytes: api.DefaultMaxBodyBytes,
+	}
+}
+
+// Node is an embedded neutrino node.
+type Node struct {
+	node   *neutrino.Node
+	config *Config
+}
+
+// New creates a node from config, which it keeps and must not be changed
+// afterwards.
+func New(config *Config) (*Node, error) {
+	if config == nil {
+		return nil, errors.New("config is required")
+	}
+	if config.Logger == nil {
+		config.Logger = disabledBackend{}
+	}
+	node, err := neutrino.NewNode(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Node{node: node, config: config}, nil
+}
+
+// Start connects to peers and starts syncing. It returns once the node's
+// database is open; sync continues in the background.
+func (n *Node) Start() error {
+	return n.node.Start()
+}
+
+// Stop disconnects from peers and closes the database.
+func (n *Node) Stop() error {
+	return n.node.Stop()
+}
+
+// Restart is closed when the "restart" stall recovery asks for the node to
+// be restarted. neutrinod then stops and starts itself again; an embedding
+// program stops the node and creates a new one.
+func (n *Node) Restart() <-chan struct{} {
+	return n.node.Restart()
+}
+
+// Handler returns the REST API of the node. It serves requests under
+// cfg.BasePath and answers others with 404, so it can be registered on the
+// program's mux for that prefix:
+//
+//	mux.Handle("/neutrino/", handler)
+func (n *Node) Handler(cfg APIConfig) (http.Handler, error) {
+	handler := api.NewHandler(n.node, n.config.Logger.Logger("API"))
+	handler.SetBuildInfo(buildinfo.New(moduleVersion(), "", ""))
+	if cfg.APIKeysFile != "" {
+		keyring, err := auth.Load(cfg.APIKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load API keys: %w", err)
+		}
+		handler.SetKeyring(keyring)
+	}
+	proxies, err := api.ParseTrustedProxies(strings.Join(cfg.TrustedProxies, ","))
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	handler.SetTrustedProxies(proxies)
+	if index := n.node.AddressIndex(); index != nil {
+		handler.SetAddressIndex(index)
+	}
+	handler.SetRateLimits(cfg.RateLimits)
+	handler.SetConcurrencyLimits(cfg.Concurrency)
+	handler.SetTimeouts(cfg.Timeouts)
+	handler.SetMaxBodyBytes(cfg.MaxBodyBytes)
+	if cfg.SwaggerUI {
+		assets, err := api.SwaggerUIAssets(cfg.SwaggerUIDir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Swagger UI assets: %w", err)
+		}
+		handler.SetSwaggerUI(assets)
+	}
+
+	// The API gets a router of its own: its middleware must not apply to
+	// the program's routes, and it looks routes up by their templates
+	// without the prefix
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+	return api.MountAt(cfg.BasePath, router)
+}
+
+// moduleVersion returns the version of this module the program was built
+// with.
+func moduleVersion() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if bi.Main.Path == modulePath {
+		return bi.Main.Version
+	}
+	for _, dep := range bi.Deps {
+		if dep.Path == modulePath {
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
+
+// disabledBackend is the log backend of nodes configured without one.
+type disabledBackend struct{}
+
+func (disabledBackend) Logger(string) btclog.Logger {
+	return btclog.Disabled
+}
@@ -0,0 +1,64 @@
+package node
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEmbeddedNode(t *testing.T) {
+	n, err := New(&Config{
+		Network:   "regtest",
+		DataDir:   t.TempDir(),
+		DBBackend: DBBackendMemory,
+		DNSSeeds:  "none",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Start(); err != nil {
+		t.Fatalf("Start() failed: %v", err)
+	}
+	defer n.Stop()
+
+	handler, err := n.Handler(APIConfig{BasePath: "/neutrino"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/neutrino/", handler)
+	mux.HandleFunc("/app", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "app")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/neutrino/v1/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var status struct {
+		BlockHeight *int32 `json:"block_height"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil || resp.StatusCode != http.StatusOK || status.BlockHeight == nil {
+		t.Errorf("GET /neutrino/v1/status returned %d, %+v, %v", resp.StatusCode, status, err)
+	}
+
+	// The program's routes are left alone
+	resp, err = http.Get(server.URL + "/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "app" || resp.Header.Get("X-Request-ID") != "" {
+		t.Errorf("GET /app = %q with request ID %q, want the program's answer", body, resp.Header.Get("X-Request-ID"))
+	}
+
+	if _, err := n.Handler(APIConfig{BasePath: "neutrino"}); err == nil {
+		t.Error("Handler() accepted a relative base path")
+	}
+}